@@ -0,0 +1,325 @@
+import type { BasicLit, Field } from '../utils/go-ast.js';
+import { isExported } from '../utils/go-ast.js';
+import { alignCells, indentAt } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { errorLocation } from '../utils/go-references.js';
+import { unquoteGoString } from '../utils/go-scanner.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { indexToPosition } from '../utils/line-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+// How a field name becomes the name in its tag: UserID as user_id, userId
+// or UserID.
+export type TagNaming = 'snake_case' | 'camelCase' | 'as-is';
+
+export interface AddStructTagsOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  // A struct type declared in the package of filePath.
+  typeName: string;
+  // The tag key to set, such as json, yaml or db.
+  key: string;
+  naming?: TagNaming;
+  // Add the omitempty option to the tags.
+  omitEmpty?: boolean;
+  dryRun?: boolean;
+}
+
+export interface AddStructTagsResult {
+  typeName: string;
+  key: string;
+  // Fields whose tag was added or changed.
+  updated: string[];
+  // Exported fields left out because their tag for the key is "-".
+  ignored: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// Splits an identifier into its words: UserID into User and ID, HTTPServer
+// into HTTP and Server, and IDs into IDs.
+function words(name: string): string[] {
+  return name
+    .split('_')
+    .flatMap(
+      part =>
+        part.match(
+          /\p{Lu}{2,}s(?!\p{Ll})|\p{Lu}+(?!\p{Ll})\d*|\p{Lu}?[\p{Ll}\d]+|[^\p{Lu}\p{Ll}\d]+/gu
+        ) ?? []
+    );
+}
+
+function tagName(name: string, naming: TagNaming): string {
+  if (naming === 'as-is') return name;
+  const parts = words(name).map(w => w.toLowerCase());
+  if (naming === 'snake_case') return parts.join('_');
+  return parts
+    .map((w, i) => (i === 0 ? w : w.charAt(0).toUpperCase() + w.slice(1)))
+    .join('');
+}
+
+interface TagPair {
+  key: string;
+  // Where the quoted value of the pair is in the tag.
+  pos: number;
+  end: number;
+}
+
+// Splits the content of a struct tag into its key:"value" pairs, following
+// the conventions of reflect.StructTag. Returns undefined if the tag does
+// not follow them.
+function parseTag(tag: string): TagPair[] | undefined {
+  const pairs: TagPair[] = [];
+  let i = 0;
+  for (;;) {
+    while (tag[i] === ' ') i++;
+    if (i >= tag.length) return pairs;
+    const start = i;
+    while (i < tag.length && !/[\s:"\x00-\x1f\x7f]/.test(tag[i])) i++;
+    if (i === start || tag[i] !== ':' || tag[i + 1] !== '"') return undefined;
+    const key = tag.substring(start, i);
+    const pos = ++i;
+    for (i++; i < tag.length && tag[i] !== '"'; i++) {
+      if (tag[i] === '\\') i++;
+    }
+    if (i >= tag.length) return undefined;
+    pairs.push({ key, pos, end: ++i });
+  }
+}
+
+function quote(value: string): string {
+  return `"${value.replace(/[\\"]/g, '\\$&')}"`;
+}
+
+// One line of the struct: a field, or one of the names of a field that
+// declares several, which need a tag each.
+interface Entry {
+  names: string;
+  type: string;
+  tag?: string;
+  comment?: string;
+}
+
+function cells(entry: Entry): string[] {
+  const { names, type, tag, comment } = entry;
+  return [...(names ? [names] : []), type, tag, comment].filter(
+    (c): c is string => c !== undefined
+  );
+}
+
+export async function performAddStructTags(
+  options: AddStructTagsOptions
+): Promise<AddStructTagsResult> {
+  const {
+    key,
+    naming = 'snake_case',
+    omitEmpty = false,
+    dryRun = false,
+  } = options;
+  if (!/^[^\s:"\x00-\x1f\x7f]+$/.test(key)) {
+    throw new ToolError(
+      'invalid_argument',
+      `'${key}' is not a valid struct tag key`
+    );
+  }
+  const { file: given } = await loadGoFile(options.filePath, options);
+  const pkg = given.pkg;
+  const typeObj = pkg.scope?.lookup(options.typeName);
+  const spec = typeObj?.decl;
+  if (typeObj?.kind !== 'type' || spec?.type !== 'TypeSpec' || !typeObj.file) {
+    throw new ToolError(
+      'symbol_not_found',
+      `'${options.typeName}' is not a type declared in package ${pkg.name}`
+    );
+  }
+  const file = typeObj.file;
+  if (spec.specType.type !== 'StructType') {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${typeObj.name}' is not declared as a struct type`,
+      errorLocation(file, typeObj.pos)
+    );
+  }
+  const { src } = file;
+  const line = (pos: number) =>
+    indexToPosition(src, pos, file.lineStarts).line;
+
+  const updated: string[] = [];
+  const ignored: string[] = [];
+  // Returns the tag literal of the field name given its current one.
+  const retag = (name: string, literal: BasicLit | undefined) => {
+    const content = literal ? unquoteGoString(literal.value) : '';
+    const pairs = parseTag(content);
+    if (!pairs) {
+      throw new ToolError(
+        'unsupported_construct',
+        `The tag of field ${name} does not consist of key:"value" pairs`,
+        errorLocation(file, literal!.pos)
+      );
+    }
+    // Like reflect, only the first pair with the key counts.
+    const pair = pairs.find(p => p.key === key);
+    const current =
+      pair && unquoteGoString(content.substring(pair.pos, pair.end));
+    if (current === '-') {
+      ignored.push(name);
+      return literal?.value;
+    }
+    const opts = current === undefined ? [] : current.split(',').slice(1);
+    if (omitEmpty && !opts.includes('omitempty')) opts.push('omitempty');
+    const value = quote([tagName(name, naming), ...opts].join(','));
+    const next = pair
+      ? content.substring(0, pair.pos) + value + content.substring(pair.end)
+      : [content.trimEnd(), `${key}:${value}`].filter(Boolean).join(' ');
+    if (next === content) return literal?.value;
+    updated.push(name);
+    return literal?.value.startsWith('"') || next.includes('`')
+      ? JSON.stringify(next)
+      : `\`${next}\``;
+  };
+
+  const entries = (field: Field): Entry[] => {
+    const type = src.substring(field.fieldType.pos, field.fieldType.end);
+    const comment =
+      field.comment && line(field.comment.pos) === line(field.end)
+        ? src.substring(field.comment.pos, field.comment.end)
+        : undefined;
+    const names = field.names.map(n => n.name);
+    if (!names.some(isExported)) {
+      const tag = field.tag?.value;
+      return [{ names: names.join(', '), type, tag, comment }];
+    }
+    if (names.length > 1 && line(field.pos) !== line(field.end)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Fields ${names.join(', ')} share a type spanning several lines, so they cannot get a tag each`,
+        errorLocation(file, field.pos)
+      );
+    }
+    // Names declared together share their tag, so each gets its own line.
+    return names.map((name, i) => ({
+      names: name,
+      type,
+      tag: isExported(name) ? retag(name, field.tag) : field.tag?.value,
+      comment: i === 0 ? comment : undefined,
+    }));
+  };
+
+  const fields = spec.specType.fields.list;
+  const edits: TextEdit[] = [];
+  const replace = (pos: number, end: number, newText: string) => {
+    if (src.substring(pos, end) !== newText) edits.push({ pos, end, newText });
+  };
+  const struct = spec.specType;
+  const oneLine = line(struct.pos) === line(struct.end);
+  const shared = fields.some(
+    (f, i) => i > 0 && line(f.pos) === line(fields[i - 1].end)
+  );
+  const all = fields.map(entries);
+  if (oneLine) {
+    // gofmt only keeps a struct on one line if it has a single field
+    // without a tag.
+    const indent = indentAt(src, struct.pos);
+    const rows = alignCells(all.flat().map(cells));
+    replace(
+      struct.pos,
+      struct.end,
+      `struct {\n${rows.map(r => `${indent}\t${r}\n`).join('')}${indent}}`
+    );
+  } else if (shared) {
+    // Fields sharing a line are not aligned.
+    fields.forEach((field, i) => {
+      const text = all[i]
+        .map(e => [e.names, e.type, e.tag].filter(Boolean).join(' '))
+        .join('; ');
+      replace(field.pos, field.end, text);
+    });
+  } else {
+    // Lays out runs of fields on adjacent lines like gofmt does. A field
+    // spanning several lines ends its run, and only its names take part.
+    let run: { field: Field; entries: Entry[] }[] = [];
+    const flush = () => {
+      const rows = run.flatMap(({ field, entries }) =>
+        line(field.pos) === line(field.end)
+          ? entries.map(cells)
+          : [entries[0].names ? [entries[0].names, ''] : ['']]
+      );
+      const text = alignCells(rows);
+      let r = 0;
+      for (const { field, entries } of run) {
+        if (line(field.pos) !== line(field.end)) {
+          const [entry] = entries;
+          if (entry.names) {
+            replace(field.names[0].pos, field.fieldType.pos, text[r]);
+          }
+          r++;
+          if (field.tag && entry.tag) {
+            replace(field.tag.pos, field.tag.end, entry.tag);
+          } else if (entry.tag) {
+            const end = field.fieldType.end;
+            edits.push({ pos: end, end, newText: ` ${entry.tag}` });
+          }
+          continue;
+        }
+        const lines = text.slice(r, r + entries.length);
+        r += entries.length;
+        const end = entries[0].comment ? field.comment!.end : field.end;
+        replace(field.pos, end, lines.join(`\n${indentAt(src, field.pos)}`));
+      }
+      run = [];
+    };
+    fields.forEach((field, i) => {
+      const prev = run[run.length - 1]?.field;
+      if (prev && line(field.pos) !== line(prev.end) + 1) flush();
+      run.push({ field, entries: all[i] });
+      if (line(field.pos) !== line(field.end)) flush();
+    });
+    flush();
+  }
+
+  // Without a tag to change, the layout of the fields is left alone too.
+  const updatedSrc = updated.length > 0 ? applyTextEdits(src, edits) : src;
+  return {
+    typeName: typeObj.name,
+    key,
+    updated,
+    ignored,
+    changes: await commitFileChanges(
+      [{ filePath: file.filePath, original: src, updated: updatedSrc }],
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+export function formatAddStructTagsResults(
+  result: AddStructTagsResult
+): string {
+  const { key, typeName } = result;
+  const output: string[] = [];
+  if (result.updated.length === 0) {
+    output.push(`The ${key} tags of '${typeName}' are up to date`);
+  } else {
+    const count = result.updated.length;
+    output.push(
+      `Set the ${key} tag of ${count} field${count === 1 ? '' : 's'} of '${typeName}': ${result.updated.join(', ')}`
+    );
+  }
+  if (result.ignored.length > 0) {
+    output.push(
+      `Left alone, since their ${key} tag is "-": ${result.ignored.join(', ')}`
+    );
+  }
+  if (result.changes.length === 0) return output.join('\n');
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,154 @@
+import { execFile } from 'child_process';
+import { existsSync, statSync } from 'fs';
+import { dirname, resolve } from 'path';
+import { promisify } from 'util';
+import { displayPath } from '../utils/file-utils.js';
+import { defaultGoFormat, GO_FORMATS } from '../utils/go-format.js';
+import type { GoFormat } from '../utils/go-format.js';
+import { findGoModule, findGoWorkspace } from '../utils/go-loader.js';
+import type { JsonSchema } from '../utils/json-schema.js';
+
+// A tool of the server, as the capabilities tool lists it.
+export interface ToolCapability {
+  name: string;
+  title: string;
+  description: string;
+  readOnly: boolean;
+  inputSchema: JsonSchema;
+}
+
+export interface CapabilitiesOptions {
+  // A file or directory of the module whose Go version is reported.
+  filePath: string;
+  server: { name: string; version: string };
+  tools: ToolCapability[];
+}
+
+// The installed go command, and the Go version of a module and what it
+// decides about the language.
+export interface GoCapabilities {
+  // What go version prints of the go command on PATH, such as
+  // go1.22.3 linux/amd64, when one is installed.
+  installed?: string;
+  // Root of the module, and its path, when one governs filePath.
+  root?: string;
+  module?: string;
+  // The go and toolchain directives of go.mod, as written.
+  goVersion?: string;
+  toolchain?: string;
+  // The go.work that loads the module together with others, if any.
+  workspace?: string;
+  // Whether the version allows type parameters, added in Go 1.18.
+  generics: boolean;
+  // Whether each iteration of a for loop declares its variables anew,
+  // as they do from Go 1.22.
+  perIterationLoopVars: boolean;
+}
+
+export interface CapabilitiesResult {
+  server: { name: string; version: string };
+  tools: ToolCapability[];
+  go: GoCapabilities;
+  features: {
+    // Renames follow generic functions and types to their instantiations.
+    genericsAwareRename: boolean;
+    // Modules that a go.work uses are loaded and refactored together.
+    goWork: boolean;
+    // The formats the tools write Go files in; gofumpt is built in, so it
+    // needs no gofumpt binary.
+    formats: GoFormat[];
+    defaultFormat: GoFormat;
+  };
+}
+
+// Reports whether the Go version version, such as 1.22 or 1.22.3, is at
+// least 1.minor. A go.mod without a go directive counts as Go 1.16,
+// as it does for the go command.
+function atLeast(version: string | undefined, minor: number): boolean {
+  const m = (version ?? '1.16').match(/^(\d+)\.(\d+)/);
+  return !!m && (Number(m[1]) > 1 || Number(m[2]) >= minor);
+}
+
+// Returns the version of the go command on PATH, or undefined if it cannot
+// be run. GOTOOLCHAIN=local keeps it from switching to, and downloading,
+// the toolchain that a go.mod asks for.
+async function installedGo(): Promise<string | undefined> {
+  try {
+    const { stdout } = await promisify(execFile)('go', ['version'], {
+      env: { ...process.env, GOTOOLCHAIN: 'local' },
+      timeout: 10000,
+    });
+    return stdout.trim().replace(/^go version /, '') || undefined;
+  } catch {
+    return undefined;
+  }
+}
+
+export async function performCapabilities(
+  options: CapabilitiesOptions
+): Promise<CapabilitiesResult> {
+  const abs = resolve(options.filePath);
+  const dir =
+    existsSync(abs) && statSync(abs).isDirectory() ? abs : dirname(abs);
+  const module = findGoModule(dir);
+  const workspace = module ? findGoWorkspace(dir) : undefined;
+  return {
+    server: options.server,
+    tools: options.tools,
+    go: {
+      installed: await installedGo(),
+      root: module?.root,
+      module: module?.path,
+      goVersion: module?.goVersion,
+      toolchain: module?.toolchain,
+      workspace: workspace?.file,
+      generics: !!module && atLeast(module.goVersion, 18),
+      perIterationLoopVars: !!module && atLeast(module.goVersion, 22),
+    },
+    features: {
+      genericsAwareRename: true,
+      goWork: true,
+      formats: [...GO_FORMATS],
+      defaultFormat: defaultGoFormat(),
+    },
+  };
+}
+
+export function formatCapabilitiesResults(result: CapabilitiesResult): string {
+  const { server, tools, go, features } = result;
+  const yes = (b: boolean) => (b ? 'yes' : 'no');
+  const count = `${tools.length} tool${tools.length === 1 ? '' : 's'}`;
+  const output = [
+    `${server.name} ${server.version} with ${count}:`,
+    ...tools.map(t => `  ${t.name}${t.readOnly ? ' (read-only)' : ''}`),
+    go.installed
+      ? `Installed go command: ${go.installed}`
+      : 'No go command found',
+  ];
+  if (go.root === undefined) {
+    output.push('No Go module found');
+  } else {
+    const version = go.goVersion
+      ? `go ${go.goVersion}`
+      : 'no go directive, read as go 1.16';
+    const toolchain = go.toolchain ? `, toolchain ${go.toolchain}` : '';
+    output.push(
+      `Go module ${go.module} at ${displayPath(go.root)}: ${version}${toolchain}`
+    );
+    if (go.workspace) {
+      const workspace = displayPath(go.workspace);
+      output.push(`  loaded with the workspace of ${workspace}`);
+    }
+    output.push(
+      `  generics: ${yes(go.generics)}`,
+      `  per-iteration loop variables: ${yes(go.perIterationLoopVars)}`
+    );
+  }
+  output.push(
+    'Features:',
+    `  generics-aware rename: ${yes(features.genericsAwareRename)}`,
+    `  go.work workspaces: ${yes(features.goWork)}`,
+    `  formats: ${features.formats.join(', ')}, default ${features.defaultFormat}`
+  );
+  return output.join('\n');
+}
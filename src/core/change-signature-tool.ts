@@ -0,0 +1,88 @@
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { objectKindLabel, resolveSymbol } from '../utils/go-references.js';
+import type { GoSymbolInput } from '../utils/go-references.js';
+import { applySignatureEdits, signatureEdits } from '../utils/go-signature.js';
+import type { ParameterChange } from '../utils/go-signature.js';
+import { commitFileChanges, formatFileChanges } from '../utils/edit-utils.js';
+import type { FileChange, WriteOptions } from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export type { ParameterChange } from '../utils/go-signature.js';
+
+export interface ChangeSignatureOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoSymbolInput {
+  filePath: string;
+  parameters: ParameterChange[];
+  dryRun?: boolean;
+}
+
+export interface ChangeSignatureResult {
+  functionName: string;
+  // The new signature as it appears in the declaration.
+  signature: string;
+  // Declarations changed along with the target because they declare or
+  // implement the same interface method, as path:line:column.
+  related: string[];
+  // Locations of the updated calls, as path:line:column.
+  callSites: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+export async function performChangeSignature(
+  options: ChangeSignatureOptions
+): Promise<ChangeSignatureResult> {
+  const { dryRun = false, parameters: changes } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const { obj } = resolveSymbol(program, file, options);
+  if (obj.kind !== 'func') {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is a ${objectKindLabel(obj)}, not a function or method`
+    );
+  }
+  if (!obj.file) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is declared outside the module`
+    );
+  }
+  const { signature, related, callSites, files } = await signatureEdits(
+    program,
+    obj,
+    changes,
+    options
+  );
+  const changed = applySignatureEdits(program.check().info, files);
+  return {
+    functionName: obj.name,
+    signature,
+    related,
+    callSites,
+    changes: await commitFileChanges(changed, dryRun, options),
+    dryRun,
+  };
+}
+
+export function formatChangeSignatureResults(
+  result: ChangeSignatureResult
+): string {
+  const lines = [`Changed '${result.functionName}' to ${result.signature}`];
+  if (result.related.length > 0) {
+    lines.push(
+      `Also changed ${result.related.length} declaration${result.related.length === 1 ? '' : 's'} of the same interface method:`,
+      ...result.related.map(r => `  ${r}`)
+    );
+  }
+  const count = result.callSites.length;
+  if (count > 0) {
+    lines.push(
+      `Updated ${count} call site${count === 1 ? '' : 's'}:`,
+      ...result.callSites.map(s => `  ${s}`)
+    );
+  }
+  return `${lines.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
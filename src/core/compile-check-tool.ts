@@ -0,0 +1,358 @@
+import { existsSync, statSync } from 'fs';
+import { dirname, join, resolve, sep } from 'path';
+import { displayPath } from '../utils/file-utils.js';
+import type { Expr, Node, ReturnStmt } from '../utils/go-ast.js';
+import { inspect, pathEnclosingInterval, unparen } from '../utils/go-ast.js';
+import { isLocal } from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import { fileQualifier, importPathOf } from '../utils/go-edit.js';
+import { GoProgram, exclusionWarnings } from '../utils/go-loader.js';
+import type { GoModule, LoadOptions } from '../utils/go-loader.js';
+import { errorLocation } from '../utils/go-references.js';
+import { deref, typeString, under } from '../utils/go-types.js';
+import type {
+  GoObject,
+  GoPackage,
+  GoSourceFile,
+  SignatureType,
+  Type,
+} from '../utils/go-types.js';
+import type { ErrorLocation } from '../utils/tool-error.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export type CompileCheckScope = 'package' | 'module';
+
+export interface CompileCheckOptions extends LoadOptions {
+  // A package directory, or a Go file of the package.
+  filePath: string;
+  // Check the package of filePath, with its external tests, or every
+  // package of its module. Defaults to the package.
+  scope?: CompileCheckScope;
+}
+
+export interface CompileError extends ErrorLocation {
+  message: string;
+}
+
+export interface CompileCheckResult {
+  scope: CompileCheckScope;
+  // The import path of the package, or the path of the module.
+  target: string;
+  packages: number;
+  files: number;
+  // Sorted by file and position; empty when the code checks.
+  errors: CompileError[];
+  // Files that build constraints kept from being checked.
+  warnings: string[];
+}
+
+// Reports whether the members of t are all known: t is declared in the
+// module, and so are the types it embeds, so that a member the checker
+// cannot find does not exist.
+function knownMembers(t: Type, seen = new Set<GoObject>()): boolean {
+  t = deref(t).type;
+  if (t.kind !== 'named' || t.obj.externalPath || !t.obj.file) return false;
+  if (seen.has(t.obj)) return true;
+  seen.add(t.obj);
+  const u = under(t);
+  if (u.kind === 'interface' || u.kind === 'invalid') return false;
+  if (u.kind !== 'struct') return true;
+  return u.fields.every(f => !f.embedded || knownMembers(f.type!, seen));
+}
+
+// Returns the number of values e stands for: the results of a call of a
+// function with several, or 1. Undefined when the type of a call is
+// unknown.
+function valueCount(info: GoInfo, e: Expr): number | undefined {
+  const t = info.typeOf(e);
+  if (t?.kind === 'tuple') return t.types.length;
+  if (unparen(e).type === 'CallExpr' && (!t || t.kind === 'invalid')) {
+    return undefined;
+  }
+  return 1;
+}
+
+// Returns the function of the module that call calls, if it names one.
+function calledFunction(info: GoInfo, fun: Expr): GoObject | undefined {
+  const e = unparen(fun);
+  const id =
+    e.type === 'Ident' ? e : e.type === 'SelectorExpr' ? e.sel : undefined;
+  const obj = id && info.uses.get(id);
+  return obj?.kind === 'func' && obj.file ? obj : undefined;
+}
+
+// Returns the packages checked for filePath in scope, with the module.
+function packagesAt(
+  program: GoProgram,
+  filePath: string,
+  scope: CompileCheckScope
+): { pkgs: GoPackage[]; module: GoModule; dir: string } {
+  const target = resolve(filePath);
+  const isDir = existsSync(target) && statSync(target).isDirectory();
+  const dir = isDir ? target : dirname(target);
+  const module = program.moduleOf(dir);
+  if (!module || (!isDir && !existsSync(target))) {
+    throw new ToolError(
+      'invalid_location',
+      `Not a Go source file in the module: ${filePath}`
+    );
+  }
+  const pkgs = program.packages.filter(p =>
+    scope === 'module' ? program.moduleOf(p.dir) === module : p.dir === dir
+  );
+  return { pkgs, module, dir };
+}
+
+// Type-checks the package of a file, or its whole module, and reports what
+// the go command would refuse to compile, as far as the checker can tell:
+// syntax errors, undefined names and members, imports that cannot be found
+// or that are not used, local variables that are not used, and calls and
+// returns with the wrong number of values. Nothing is built or written.
+// The checker doing so is forgiving about what it does not know, such as
+// packages outside the module, so that code it reports is broken but code
+// it accepts may not compile.
+export async function performCompileCheck(
+  options: CompileCheckOptions
+): Promise<CompileCheckResult> {
+  const { scope = 'package' } = options;
+  const program = await GoProgram.load(resolve(options.filePath), options);
+  const { pkgs, module, dir } = packagesAt(program, options.filePath, scope);
+  const inScope = (filePath: string) =>
+    scope === 'module'
+      ? program.moduleOf(dirname(filePath)) === module
+      : dirname(filePath) === dir;
+  const loadErrors = program.errors.filter(e => inScope(e.filePath));
+  if (pkgs.length === 0 && loadErrors.length === 0) {
+    throw new ToolError(
+      'invalid_location',
+      `No Go package found in ${displayPath(dir)}`
+    );
+  }
+  const info = (await program.checkPackagesAsync(pkgs, options)).info;
+  const files = new Set(pkgs.flatMap(p => p.files));
+
+  // Syntax errors come as file:line:column: message.
+  const errors: CompileError[] = loadErrors.map(e => ({
+    ...(e.location ?? {
+      filePath: displayPath(e.filePath),
+      line: 1,
+      column: 1,
+    }),
+    message: e.location
+      ? e.message.replace(/^.*?:\d+:\d+: /, '')
+      : e.message,
+  }));
+  const report = (file: GoSourceFile, pos: number, message: string) =>
+    errors.push({ ...errorLocation(file, pos), message });
+
+  const used = new Set(info.uses.values());
+  for (const file of files) {
+    const src = (n: Node) => file.src.slice(n.pos, n.end);
+
+    // Imports. A package outside the module may be named otherwise than
+    // its path suggests, in which case its import looks unused and the
+    // uses of its name undefined: neither is reported then.
+    const uncertain = new Set<string>();
+    for (const spec of file.ast.imports) {
+      const path = importPathOf(spec);
+      const local = spec.name?.name;
+      const inModule = program.modules.find(
+        m => path === m.path || path.startsWith(`${m.path}/`)
+      );
+      if (inModule && !program.packageByImportPath(path)) {
+        const rel = path.slice(inModule.path.length + 1);
+        const pkgDir = join(inModule.root, ...rel.split('/'));
+        if (program.moduleOf(pkgDir) === inModule) {
+          const excluded = program.excluded.some(
+            f => dirname(f.filePath) === pkgDir
+          );
+          report(
+            file,
+            spec.path.pos,
+            excluded
+              ? `could not import ${path}: build constraints exclude all Go files in ${displayPath(pkgDir)}`
+              : `could not import ${path}: no Go files in ${displayPath(pkgDir)}`
+          );
+          continue;
+        }
+      }
+      const obj = info.implicits.get(spec);
+      if (!obj || path === 'C' || local === '_' || local === '.') continue;
+      if (used.has(obj)) continue;
+      if (!local && !inModule && path.split('/')[0].includes('.')) {
+        uncertain.add(obj.name);
+        continue;
+      }
+      const as = local ? ` as ${local}` : '';
+      report(file, spec.pos, `"${path}" imported${as} and not used`);
+    }
+
+    // Undefined names and members.
+    for (const u of info.unresolved) {
+      if (u.file !== file) continue;
+      const path = pathEnclosingInterval(file.ast, u.ident.pos, u.ident.end);
+      const parent = path[path.length - 2];
+      if (u.selector) {
+        const t = info.typeOf(u.selector.x);
+        if (!t || !knownMembers(t)) continue;
+        const type = typeString(t, fileQualifier(file));
+        report(
+          file,
+          u.selector.sel.pos,
+          `${src(u.selector)} undefined (type ${type} has no field or method ${u.ident.name})`
+        );
+      } else if (parent?.type === 'SelectorExpr' && parent.sel === u.ident) {
+        report(file, u.ident.pos, `undefined: ${src(parent)}`);
+      } else {
+        const qualifier =
+          parent?.type === 'SelectorExpr' && parent.x === u.ident;
+        if (qualifier && uncertain.size > 0) continue;
+        report(file, u.ident.pos, `undefined: ${u.ident.name}`);
+      }
+    }
+
+    // Local variables that are never used, and types of the module's
+    // packages that the checker took for types of packages outside it.
+    inspect(file.ast, n => {
+      if (n.type === 'SelectorExpr') {
+        const path = info.uses.get(n.sel)?.externalPath;
+        if (path && program.packageByImportPath(path)) {
+          report(file, n.sel.pos, `undefined: ${src(n)}`);
+        }
+        return;
+      }
+      if (n.type === 'Ident') {
+        const obj = info.defs.get(n);
+        if (
+          obj?.kind === 'var' &&
+          n.name !== '_' &&
+          !obj.isParam &&
+          !obj.isField &&
+          isLocal(obj) &&
+          !used.has(obj)
+        ) {
+          report(file, n.pos, `declared and not used: ${n.name}`);
+        }
+        return;
+      }
+      if (n.type !== 'TypeSwitchStmt' || n.assign.type !== 'AssignStmt') {
+        return;
+      }
+      const symbol = n.assign.lhs[0];
+      if (symbol?.type !== 'Ident' || !info.defs.get(symbol)) return;
+      const clauses = n.body.list.map(c => info.implicits.get(c));
+      if (!clauses.some(obj => obj && used.has(obj))) {
+        report(file, symbol.pos, `${symbol.name} declared and not used`);
+      }
+    });
+
+    // Calls of the functions of the module, and returns.
+    const checkReturn = (r: ReturnStmt, sig: SignatureType) => {
+      const want = sig.results.length;
+      if (r.results.length === 0) {
+        if (want > 0 && sig.results[0].name === '') {
+          report(file, r.pos, 'not enough return values');
+        }
+        return;
+      }
+      const have =
+        r.results.length === 1
+          ? valueCount(info, r.results[0])
+          : r.results.length;
+      if (have === undefined || have === want) return;
+      if (have < want) {
+        report(file, r.results.at(-1)!.pos, 'not enough return values');
+      } else {
+        const extra = r.results.length > 1 ? r.results[want] : r.results[0];
+        report(file, extra.pos, 'too many return values');
+      }
+    };
+    const visitBody = (body: Node, sig: SignatureType | undefined) => {
+      inspect(body, n => {
+        if (n === body) return;
+        if (n.type === 'FuncLit') {
+          const t = info.typeOf(n);
+          visitBody(n.body, t?.kind === 'signature' ? t : undefined);
+          return false;
+        }
+        if (n.type === 'ReturnStmt' && sig) checkReturn(n, sig);
+        if (n.type !== 'CallExpr' || !calledFunction(info, n.fun)) return;
+        const t = info.typeOf(n.fun);
+        if (t?.kind !== 'signature' || t.typeParams?.length) return;
+        const have =
+          n.args.length === 1 ? valueCount(info, n.args[0]) : n.args.length;
+        if (have === undefined) return;
+        const want = t.params.length;
+        const fewer = t.variadic && n.ellipsis === undefined ? 1 : 0;
+        const name = src(n.fun);
+        if (have < want - fewer) {
+          const at = n.args.at(-1)?.pos ?? n.pos;
+          report(file, at, `not enough arguments in call to ${name}`);
+        } else if (have > want && !(t.variadic && n.ellipsis === undefined)) {
+          const extra = n.args.length > 1 ? n.args[want].pos : n.args[0].pos;
+          report(file, extra, `too many arguments in call to ${name}`);
+        }
+      });
+    };
+    for (const decl of file.ast.decls) {
+      if (decl.type === 'FuncDecl' && decl.body) {
+        const t = info.defs.get(decl.name)?.type;
+        visitBody(decl.body, t?.kind === 'signature' ? t : undefined);
+      } else if (decl.type === 'GenDecl') {
+        visitBody(decl, undefined);
+      }
+    }
+  }
+
+  const seen = new Set<string>();
+  const unique = errors.filter(e => {
+    const key = `${e.filePath}:${e.line}:${e.column}:${e.message}`;
+    return !seen.has(key) && !!seen.add(key);
+  });
+  unique.sort((a, b) =>
+    a.filePath !== b.filePath
+      ? a.filePath < b.filePath
+        ? -1
+        : 1
+      : a.line - b.line || a.column - b.column
+  );
+  const rel = dir.slice(module.root.length).split(sep).join('/');
+  return {
+    scope,
+    target:
+      scope === 'module'
+        ? module.path
+        : (pkgs.find(p => !p.isXTest)?.importPath ?? `${module.path}${rel}`),
+    packages: pkgs.length,
+    files: files.size,
+    errors: unique,
+    warnings: exclusionWarnings(program, pkgs),
+  };
+}
+
+export function formatCompileCheckResults(result: CompileCheckResult): string {
+  const what =
+    result.scope === 'module'
+      ? `the ${result.packages} package${result.packages === 1 ? '' : 's'} of module ${result.target}`
+      : `package ${result.target}`;
+  const files = `${result.files} file${result.files === 1 ? '' : 's'}`;
+  const output: string[] = [];
+  const count = result.errors.length;
+  if (count === 0) {
+    output.push(`No errors in ${what} (${files})`);
+  } else {
+    output.push(
+      `Found ${count} error${count === 1 ? '' : 's'} in ${what} (${files}):`
+    );
+    output.push(
+      ...result.errors.map(
+        e => `  ${e.filePath}:${e.line}:${e.column}: ${e.message}`
+      )
+    );
+  }
+  if (result.warnings.length > 0) {
+    output.push('Not checked, check these by hand:');
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  return output.join('\n');
+}
@@ -0,0 +1,675 @@
+import type { Expr, FuncDecl, Node } from '../utils/go-ast.js';
+import { isExported, pathEnclosingInterval, unparen } from '../utils/go-ast.js';
+import {
+  isAddressable,
+  isPure,
+  lookupAt,
+  relatedMethods,
+} from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  addImportEdits,
+  conversion,
+  fileQualifier,
+  isPackageLevelName,
+  pruneImports,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { GoProgram, LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  findReferences,
+  locationOf,
+  resolveSymbol,
+} from '../utils/go-references.js';
+import type { GoSymbolInput } from '../utils/go-references.js';
+import {
+  isUntyped,
+  lookupFieldOrMethod,
+  typeString,
+  under,
+} from '../utils/go-types.js';
+import type {
+  GoObject,
+  GoSourceFile,
+  Qualifier,
+  SignatureType,
+} from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { step } from '../utils/task.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ConvertFuncToMethodOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoSymbolInput {
+  filePath: string;
+  // 0-based index of the parameter that becomes the receiver.
+  parameter: number;
+  dryRun?: boolean;
+}
+
+export interface ConvertMethodToFuncOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoSymbolInput {
+  filePath: string;
+  // 0-based index the receiver takes among the parameters; first when
+  // omitted.
+  parameter?: number;
+  dryRun?: boolean;
+}
+
+export interface ConvertFuncMethodResult {
+  // The declaration before and after, as func F or method T.F.
+  from: string;
+  to: string;
+  // Locations of the updated calls and method expressions, as
+  // path:line:column.
+  callSites: string[];
+  warnings: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// Returns the text of a range of the file, with the edits of the rewrites
+// inside it and extra edits applied.
+type TextIn = (pos: number, end: number, extra?: TextEdit[]) => string;
+
+// An expression replaced as a whole. Calls may be nested in the arguments
+// of others, so the text is built once the inner ones are done.
+interface Rewrite {
+  pos: number;
+  end: number;
+  render: (textIn: TextIn) => string;
+}
+
+interface FileEdits {
+  edits: TextEdit[];
+  rewrites: Rewrite[];
+  missing: ImportRequest[];
+  qualifier: Qualifier;
+}
+
+function editsFor(
+  byFile: Map<GoSourceFile, FileEdits>,
+  file: GoSourceFile
+): FileEdits {
+  let entry = byFile.get(file);
+  if (!entry) {
+    const missing: ImportRequest[] = [];
+    entry = {
+      edits: [],
+      rewrites: [],
+      missing,
+      qualifier: fileQualifier(file, missing),
+    };
+    byFile.set(file, entry);
+  }
+  return entry;
+}
+
+// Returns the edit deleting items[i] from a comma-separated list between
+// the delimiters at open and close, with the comma that separates it.
+function removalEdit(
+  items: Node[],
+  i: number,
+  open: number,
+  close: number
+): TextEdit {
+  if (items.length === 1) return { pos: open + 1, end: close, newText: '' };
+  return i < items.length - 1
+    ? { pos: items[i].pos, end: items[i + 1].pos, newText: '' }
+    : { pos: items[i - 1].end, end: items[i].end, newText: '' };
+}
+
+// Writes e as the operand of a selector, parenthesized unless it is a
+// primary expression.
+function operand(e: Expr, text: string): string {
+  const primary = [
+    'Ident',
+    'SelectorExpr',
+    'CallExpr',
+    'IndexExpr',
+    'SliceExpr',
+    'TypeAssertExpr',
+    'ParenExpr',
+  ];
+  return primary.includes(e.type) ? text : `(${text})`;
+}
+
+// Returns the node that calls or refers to the function at the reference
+// [pos, end), a qualified identifier included, and the call, if any, that
+// it is the function of.
+function referenceAt(
+  file: GoSourceFile,
+  pos: number,
+  end: number
+): { fun: Node; call?: Node } {
+  const path = pathEnclosingInterval(file.ast, pos, end);
+  let i = path.length - 1;
+  let fun: Node = path[i];
+  const p = path[i - 1];
+  if (p?.type === 'SelectorExpr' && p.sel === fun) fun = path[--i];
+  while (path[i - 1]?.type === 'ParenExpr') fun = path[--i];
+  const call = path[i - 1];
+  return {
+    fun,
+    call: call?.type === 'CallExpr' && call.fun === fun ? call : undefined,
+  };
+}
+
+// Applies the edits and rewrites of every file, adding the imports they
+// need and dropping those they no longer do.
+function fileChanges(
+  info: GoInfo,
+  byFile: Map<GoSourceFile, FileEdits>
+): FileChange[] {
+  const changes: FileChange[] = [];
+  for (const [f, entry] of byFile) {
+    const list = [...entry.rewrites].sort(
+      (a, b) => a.end - a.pos - (b.end - b.pos)
+    );
+    // Inner rewrites are rendered first so that the outer ones include
+    // them.
+    const done: TextEdit[] = [];
+    for (const rewrite of list) {
+      const textIn: TextIn = (pos, end, extra = []) => {
+        const inner = done.filter(
+          d =>
+            pos <= d.pos &&
+            d.end <= end &&
+            !extra.some(x => x.pos < x.end && x.pos <= d.pos && d.end <= x.end)
+        );
+        return applyTextEdits(
+          f.src.substring(pos, end),
+          [...extra, ...inner].map(d => ({
+            ...d,
+            pos: d.pos - pos,
+            end: d.end - pos,
+          }))
+        );
+      };
+      done.push({
+        pos: rewrite.pos,
+        end: rewrite.end,
+        newText: rewrite.render(textIn),
+      });
+    }
+    const outermost = done.filter(
+      d => !done.some(o => o !== d && o.pos <= d.pos && d.end <= o.end)
+    );
+    let updated = applyTextEdits(f.src, [
+      ...addImportEdits(f, entry.missing),
+      ...entry.edits,
+      ...outermost,
+    ]);
+    updated = pruneImports(f, info, updated);
+    changes.push({ filePath: f.filePath, original: f.src, updated });
+  }
+  return changes;
+}
+
+// Resolves the function or method to convert.
+async function loadTarget(
+  options: LoadOptions & GoSymbolInput & { filePath: string }
+): Promise<{
+  program: GoProgram;
+  info: GoInfo;
+  obj: GoObject;
+  decl: FuncDecl;
+}> {
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const { obj } = resolveSymbol(program, file, options);
+  const decl = obj.decl;
+  if (obj.kind !== 'func' || decl?.type !== 'FuncDecl' || !obj.file) {
+    throw new ToolError(
+      'invalid_argument',
+      `'${obj.name}' is not a function or method declared in the module`
+    );
+  }
+  return { program, info, obj, decl };
+}
+
+export async function performConvertFuncToMethod(
+  options: ConvertFuncToMethodOptions
+): Promise<ConvertFuncMethodResult> {
+  const { dryRun = false, parameter: index } = options;
+  const { program, info, obj, decl } = await loadTarget(options);
+  const from = `func ${obj.name}`;
+  if (decl.recv) {
+    throw new ToolError(
+      'invalid_argument',
+      `'${obj.name}' is already a method`
+    );
+  }
+  const sig = obj.type as SignatureType;
+  if (sig.typeParams?.length) {
+    throw new ToolError(
+      'unsupported_construct',
+      `${from} has type parameters, which methods cannot have`,
+      errorLocation(obj.file!, decl.name.pos)
+    );
+  }
+  const params = sig.params;
+  if (params.length === 0) {
+    throw new ToolError(
+      'invalid_argument',
+      `${from} has no parameters to make the receiver`
+    );
+  }
+  if (!Number.isInteger(index) || index < 0 || index >= params.length) {
+    throw new ToolError(
+      'invalid_argument',
+      `${from} has no parameter ${index}; give an index from 0 to ${params.length - 1}`
+    );
+  }
+  if (sig.variadic && index === params.length - 1) {
+    throw new ToolError(
+      'unsupported_construct',
+      `The variadic parameter of ${from} cannot be the receiver`
+    );
+  }
+  const t = params[index].type!;
+  const pointer = t.kind === 'pointer';
+  const base = pointer ? t.elem : t;
+  const paramName = params[index].name || `${index}`;
+  if (base.kind !== 'named') {
+    throw new ToolError(
+      'unsupported_construct',
+      `The parameter ${paramName} of ${from} has type ${typeString(t)}; only a named type or a pointer to one can be a receiver`
+    );
+  }
+  const typeObj = base.obj;
+  const pkg = obj.pkg!;
+  if (typeObj.externalPath || typeObj.pkg !== pkg) {
+    const where = typeObj.externalPath ?? typeObj.pkg?.importPath;
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot make ${from} a method of ${typeString(base)}: methods can only be declared in the package of their receiver type, ${where}, and ${from} is in ${pkg.importPath}`
+    );
+  }
+  if (typeObj.typeParams?.length) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot make ${from} a method of the generic type ${typeObj.name}`
+    );
+  }
+  const u = under(base);
+  if (u.kind === 'pointer' || u.kind === 'interface') {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${typeObj.name}' cannot have methods`,
+      typeObj.file ? errorLocation(typeObj.file, typeObj.pos) : undefined
+    );
+  }
+  const clash = lookupFieldOrMethod(base, obj.name);
+  if (clash) {
+    const via = clash.path.length
+      ? ` promoted from ${clash.path.map(f => f.name).join('.')}`
+      : '';
+    const at = clash.obj.file
+      ? ` at ${locationOf(clash.obj.file, clash.obj.pos)}`
+      : '';
+    throw new ToolError(
+      'name_conflict',
+      `${typeObj.name} already has a ${clash.kind} named ${obj.name}${via}${at}`,
+      clash.obj.file ? errorLocation(clash.obj.file, clash.obj.pos) : undefined
+    );
+  }
+
+  // The parameter moves to the receiver with its name and type as written.
+  const file = obj.file!;
+  const byFile = new Map<GoSourceFile, FileEdits>();
+  const fields = decl.funcType.params.list;
+  let first = 0;
+  const fi = fields.findIndex(f => {
+    const n = Math.max(f.names.length, 1);
+    if (index < first + n) return true;
+    first += n;
+    return false;
+  });
+  const field = fields[fi];
+  const name = field.names[index - first]?.name;
+  const typeText = file.src.substring(field.fieldType.pos, field.fieldType.end);
+  const { params: list } = decl.funcType;
+  editsFor(byFile, file).edits.push(
+    {
+      pos: decl.name.pos,
+      end: decl.name.pos,
+      newText: `(${name ? `${name} ${typeText}` : typeText}) `,
+    },
+    field.names.length > 1
+      ? removalEdit(field.names, index - first, -1, -1)
+      : removalEdit(fields, fi, list.pos, list.end - 1)
+  );
+
+  await step(options, 'Finding references');
+  const callSites: string[] = [];
+  for (const ref of findReferences(program, obj)) {
+    if (ref.isDeclaration) continue;
+    const f = ref.file;
+    const entry = editsFor(byFile, f);
+    const { fun, call } = referenceAt(f, ref.pos, ref.end);
+    const location = locationOf(f, fun.pos);
+    if (call?.type !== 'CallExpr') {
+      if (index !== 0) {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot convert ${from}, which is used as a value at ${location}; only a function whose first parameter becomes the receiver can be replaced by a method expression`,
+          errorLocation(f, fun.pos)
+        );
+      }
+      const text = typeString(t, entry.qualifier);
+      const expr = pointer ? `(${text}).${obj.name}` : `${text}.${obj.name}`;
+      entry.rewrites.push({ pos: fun.pos, end: fun.end, render: () => expr });
+      callSites.push(location);
+      continue;
+    }
+    const { args } = call;
+    if (args.length === 1 && info.typeOf(args[0])?.kind === 'tuple') {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot update the call at ${location}, which passes the results of another call`,
+        errorLocation(f, call.pos)
+      );
+    }
+    const arg = args[index];
+    // The receiver is evaluated before the arguments that preceded it.
+    if (
+      !isPure(info, arg) &&
+      args.slice(0, index).some(a => !isPure(info, a))
+    ) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Making '${f.src.substring(arg.pos, arg.end)}' the receiver of the call at ${location} would change the order in which the arguments are evaluated`,
+        errorLocation(f, arg.pos)
+      );
+    }
+    const argType = info.typeOf(arg);
+    const x = unparen(arg);
+    entry.rewrites.push({
+      pos: call.pos,
+      end: call.end,
+      render: textIn => {
+        let recv: string;
+        if (argType && isUntyped(argType)) {
+          const type = typeString(t, entry.qualifier);
+          recv = conversion(type, textIn(arg.pos, arg.end));
+        } else if (
+          pointer &&
+          x.type === 'UnaryExpr' &&
+          x.op === '&' &&
+          isAddressable(info, x.x)
+        ) {
+          // Methods with pointer receivers take the address themselves.
+          recv = operand(x.x, textIn(x.x.pos, x.x.end));
+        } else {
+          recv = operand(arg, textIn(arg.pos, arg.end));
+        }
+        const removal = removalEdit(args, index, call.lparen, call.end - 1);
+        return `${recv}.${obj.name}${textIn(call.lparen, call.end, [removal])}`;
+      },
+    });
+    callSites.push(location);
+  }
+
+  const warnings: string[] = [];
+  if (isExported(obj.name) && pkg.name !== 'main' && !pkg.isXTest) {
+    warnings.push(
+      `${obj.name} is exported, so code outside the module that calls ${from} breaks`
+    );
+  }
+  return {
+    from,
+    to: `method ${typeObj.name}.${obj.name}`,
+    callSites,
+    warnings,
+    changes: await commitFileChanges(
+      fileChanges(info, byFile),
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+export async function performConvertMethodToFunc(
+  options: ConvertMethodToFuncOptions
+): Promise<ConvertFuncMethodResult> {
+  const { dryRun = false, parameter: position = 0 } = options;
+  const { program, info, obj, decl } = await loadTarget(options);
+  const typeObj = obj.recv;
+  if (!decl.recv || !typeObj) {
+    throw new ToolError('invalid_argument', `'${obj.name}' is not a method`);
+  }
+  const from = `method ${typeObj.name}.${obj.name}`;
+  if (typeObj.typeParams?.length) {
+    throw new ToolError(
+      'unsupported_construct',
+      `${from} belongs to the generic type ${typeObj.name}, whose type parameters the function would need`
+    );
+  }
+  const pkg = obj.pkg!;
+  if (isPackageLevelName(pkg, obj.name)) {
+    const existing = pkg.scope?.lookup(obj.name);
+    const at = existing?.file
+      ? ` at ${locationOf(existing.file, existing.pos)}`
+      : '';
+    throw new ToolError(
+      'name_conflict',
+      `'${obj.name}' is already declared in package ${pkg.name}${at}`,
+      existing?.file ? errorLocation(existing.file, existing.pos) : undefined
+    );
+  }
+  const iface = relatedMethods(program, obj).find(
+    m => m !== obj && m.decl?.type === 'Field'
+  );
+  if (iface) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot convert ${from}, which ${typeObj.name} needs to implement ${iface.recv?.name}.${iface.name} at ${locationOf(iface.file!, iface.pos)}`,
+      errorLocation(obj.file!, decl.name.pos)
+    );
+  }
+  const sig = obj.type as SignatureType;
+  const count = sig.params.length;
+  if (
+    !Number.isInteger(position) ||
+    position < 0 ||
+    position > count ||
+    (sig.variadic && position === count)
+  ) {
+    const last = sig.variadic ? count - 1 : count;
+    throw new ToolError(
+      'invalid_argument',
+      `The receiver cannot become parameter ${position} of ${obj.name}; give an index from 0 to ${last}`
+    );
+  }
+
+  // The receiver becomes a parameter with its name and type as written.
+  // Parameters are either all named or all unnamed.
+  const file = obj.file!;
+  const byFile = new Map<GoSourceFile, FileEdits>();
+  const recvField = decl.recv.list[0];
+  const recvName = recvField.names[0]?.name;
+  const recvType = file.src.substring(
+    recvField.fieldType.pos,
+    recvField.fieldType.end
+  );
+  const { params } = decl.funcType;
+  const fields = params.list;
+  const named = fields.some(f => f.names.length > 0);
+  const item = recvName
+    ? `${recvName} ${recvType}`
+    : named
+      ? `_ ${recvType}`
+      : recvType;
+  const edits = editsFor(byFile, file).edits;
+  edits.push({ pos: decl.recv.pos, end: decl.name.pos, newText: '' });
+  if (fields.length === 0) {
+    edits.push({ pos: params.pos + 1, end: params.pos + 1, newText: item });
+  } else if (position === 0) {
+    const pos = fields[0].pos;
+    edits.push({ pos, end: pos, newText: `${item}, ` });
+  } else {
+    let n = 0;
+    const before = fields.find(
+      f => (n += Math.max(f.names.length, 1)) === position
+    );
+    if (!before) {
+      throw new ToolError(
+        'invalid_argument',
+        `Parameter ${position - 1} of ${obj.name} shares its type with the next one; choose a position between two declarations`
+      );
+    }
+    edits.push({ pos: before.end, end: before.end, newText: `, ${item}` });
+  }
+  if (recvName && !named) {
+    for (const f of fields) {
+      const pos = f.fieldType.pos;
+      edits.push({ pos, end: pos, newText: '_ ' });
+    }
+  }
+
+  await step(options, 'Finding references');
+  const callSites: string[] = [];
+  for (const ref of findReferences(program, obj)) {
+    if (ref.isDeclaration) continue;
+    const f = ref.file;
+    const entry = editsFor(byFile, f);
+    const { fun: sel, call } = referenceAt(f, ref.pos, ref.end);
+    if (sel.type !== 'SelectorExpr') continue;
+    const location = locationOf(f, sel.pos);
+    const q = entry.qualifier({ path: pkg.importPath, name: pkg.name });
+    const name = q ? `${q}.${obj.name}` : obj.name;
+    // The function, or the package qualifying it, must not be hidden where
+    // it is called.
+    const visible = lookupAt(info, f, sel.pos, q || obj.name);
+    if (
+      visible &&
+      !(q && visible.kind === 'pkgname' && visible.imported === pkg.importPath)
+    ) {
+      throw new ToolError(
+        'name_conflict',
+        `'${q || obj.name}' at ${location} already refers to ${visible.file ? `the ${visible.kind} declared at ${locationOf(visible.file, visible.pos)}` : `the predeclared ${visible.name}`}`,
+        errorLocation(f, sel.pos)
+      );
+    }
+    const recvExpr = info.types.get(sel.x);
+    if (recvExpr?.mode === 'type') {
+      const pointerExpr = under(recvExpr.type).kind === 'pointer';
+      if (position !== 0 || pointerExpr !== !!obj.pointerRecv) {
+        throw new ToolError(
+          'unsupported_construct',
+          `The method expression at ${location} does not take the parameters of the function`,
+          errorLocation(f, sel.pos)
+        );
+      }
+      entry.rewrites.push({ pos: sel.pos, end: sel.end, render: () => name });
+      callSites.push(location);
+      continue;
+    }
+    if (call?.type !== 'CallExpr') {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot convert ${from}, which is used as a method value at ${location}`,
+        errorLocation(f, sel.pos)
+      );
+    }
+    const { args } = call;
+    if (args.length === 1 && info.typeOf(args[0])?.kind === 'tuple') {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot update the call at ${location}, which passes the results of another call`,
+        errorLocation(f, call.pos)
+      );
+    }
+    if (
+      !isPure(info, sel.x) &&
+      args.slice(0, position).some(a => !isPure(info, a))
+    ) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Passing the receiver of the call at ${location} as parameter ${position} would change the order in which the arguments are evaluated`,
+        errorLocation(f, call.pos)
+      );
+    }
+    const selection = info.selections.get(sel);
+    entry.rewrites.push({
+      pos: call.pos,
+      end: call.end,
+      render: textIn => {
+        // Promoted methods are called on the embedded field, and the
+        // address or value is taken where the call did it implicitly.
+        let recv = textIn(sel.x.pos, sel.x.end);
+        let recvT = info.typeOf(sel.x);
+        for (const field of selection?.path ?? []) {
+          recv += `.${field.name}`;
+          recvT = field.type;
+        }
+        const isPointer = !!recvT && under(recvT).kind === 'pointer';
+        if (obj.pointerRecv && !isPointer) recv = `&${recv}`;
+        else if (!obj.pointerRecv && isPointer) recv = `*${recv}`;
+        const insertion: TextEdit =
+          args.length === 0
+            ? { pos: call.lparen + 1, end: call.lparen + 1, newText: recv }
+            : position === 0
+              ? { pos: args[0].pos, end: args[0].pos, newText: `${recv}, ` }
+              : {
+                  pos: args[position - 1].end,
+                  end: args[position - 1].end,
+                  newText: `, ${recv}`,
+                };
+        return `${name}${textIn(call.lparen, call.end, [insertion])}`;
+      },
+    });
+    callSites.push(location);
+  }
+
+  const warnings: string[] = [];
+  if (isExported(obj.name) && pkg.name !== 'main' && !pkg.isXTest) {
+    warnings.push(
+      `${obj.name} is exported, so code outside the module that calls ${from}, or needs ${typeObj.name} to have it to implement an interface such as fmt.Stringer, may break`
+    );
+  }
+  return {
+    from,
+    to: `func ${obj.name}`,
+    callSites,
+    warnings,
+    changes: await commitFileChanges(
+      fileChanges(info, byFile),
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+export function formatConvertFuncMethodResults(
+  result: ConvertFuncMethodResult
+): string {
+  const output = [`Converted ${result.from} to ${result.to}`];
+  const sites = result.callSites.length;
+  if (sites > 0) {
+    output.push(`Updated ${sites} call site${sites === 1 ? '' : 's'}:`);
+    output.push(...result.callSites.map(s => `  ${s}`));
+  }
+  if (result.warnings.length > 0) {
+    output.push('Check these by hand:');
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
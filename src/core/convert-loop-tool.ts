@@ -0,0 +1,561 @@
+import type {
+  Expr,
+  ForStmt,
+  Ident,
+  IndexExpr,
+  Node,
+  RangeStmt,
+} from '../utils/go-ast.js';
+import { inspect, unparen } from '../utils/go-ast.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import { checkIdentifier, indentAt } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { errorLocation, locationOf } from '../utils/go-references.js';
+import { under } from '../utils/go-types.js';
+import type { GoObject, GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ConvertLoopOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  // 1-based line of the for keyword of the loop.
+  line: number;
+  // The name of the variable introduced for the element or the index; v
+  // and i by default, followed by a number if those are taken.
+  name?: string;
+  dryRun?: boolean;
+}
+
+export interface ConvertLoopResult {
+  location: string;
+  // The loop headers before and after, without the body.
+  from: string;
+  to: string;
+  // What the tool could not tell would keep working, to check by hand.
+  warnings: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// Finds the outermost for statement whose for keyword is on line.
+function loopAt(file: GoSourceFile, line: number): ForStmt | RangeStmt {
+  const { lineStarts } = file;
+  if (!Number.isInteger(line) || line < 1 || line > lineStarts.length) {
+    throw new ToolError('invalid_location', `Invalid line ${line}`);
+  }
+  const start = lineStarts[line - 1];
+  const end = line < lineStarts.length ? lineStarts[line] : file.src.length;
+  let loop: ForStmt | RangeStmt | undefined;
+  inspect(file.ast, n => {
+    if (loop || n.end <= start || n.pos >= end) return false;
+    if ((n.type === 'ForStmt' || n.type === 'RangeStmt') && n.pos >= start) {
+      loop = n;
+    }
+  });
+  if (!loop) {
+    throw new ToolError(
+      'invalid_location',
+      `No for loop starts on line ${line} of ${file.filePath}`
+    );
+  }
+  return loop;
+}
+
+// Returns the identifiers of e if it is a variable, possibly a field
+// selected from one, that can be evaluated again without effects.
+function operandIdents(info: GoInfo, e: Expr): Ident[] | undefined {
+  e = unparen(e);
+  if (e.type === 'Ident') return [e];
+  if (e.type !== 'SelectorExpr') return undefined;
+  const sel = info.selections.get(e);
+  if (sel && sel.kind !== 'field') return undefined;
+  const x = unparen(e.x);
+  if (!sel) {
+    // A variable of another package.
+    const obj = x.type === 'Ident' ? info.uses.get(x) : undefined;
+    return obj?.kind === 'pkgname' ? [x as Ident, e.sel] : undefined;
+  }
+  const idents = operandIdents(info, x);
+  return idents && [...idents, e.sel];
+}
+
+// Reports whether a and b are the same operand, or a is a part of b that
+// assigning changes b.
+function covers(info: GoInfo, a: Expr, b: Expr): boolean {
+  const ia = operandIdents(info, a);
+  const ib = operandIdents(info, b);
+  if (!ia || !ib || ia.length > ib.length) return false;
+  return ia.every((id, k) => {
+    const x = info.objectOf(id);
+    return !!x && x === info.objectOf(ib[k]);
+  });
+}
+
+// Returns the expressions that body assigns, increments, takes the address
+// of or calls a pointer method on without a pointer.
+function writeTargets(info: GoInfo, body: Node): Expr[] {
+  const targets: Expr[] = [];
+  inspect(body, n => {
+    switch (n.type) {
+      case 'AssignStmt':
+        targets.push(...n.lhs);
+        break;
+      case 'IncDecStmt':
+        targets.push(n.x);
+        break;
+      case 'RangeStmt':
+        if (n.tok === '=') {
+          if (n.key) targets.push(n.key);
+          if (n.value) targets.push(n.value);
+        }
+        break;
+      case 'UnaryExpr':
+        if (n.op === '&') targets.push(n.x);
+        break;
+      case 'SelectorExpr': {
+        const sel = info.selections.get(n);
+        const t = info.typeOf(n.x);
+        if (
+          sel?.kind === 'method' &&
+          sel.obj.pointerRecv &&
+          t &&
+          t.kind !== 'pointer'
+        ) {
+          targets.push(n.x);
+        }
+        break;
+      }
+    }
+  });
+  return targets;
+}
+
+// Returns the operand an assignment to target stores into: the indexed
+// collection or the variable that the fields, elements and parentheses
+// of target are parts of.
+function storedInto(target: Expr): Expr {
+  let e = unparen(target);
+  for (;;) {
+    if (e.type === 'SelectorExpr' || e.type === 'ParenExpr') {
+      e = unparen(e.x);
+    } else if (e.type === 'IndexExpr' && e.x.type === 'IndexExpr') {
+      e = e.x;
+    } else {
+      return e;
+    }
+  }
+}
+
+// Reports whether e is coll[index] with index the variable obj.
+function isElement(
+  info: GoInfo,
+  e: Node,
+  coll: Expr,
+  obj: GoObject | undefined
+): e is IndexExpr {
+  if (e.type !== 'IndexExpr' || e.indices.length !== 1) return false;
+  const index = unparen(e.indices[0]);
+  return (
+    index.type === 'Ident' &&
+    !!obj &&
+    info.uses.get(index) === obj &&
+    covers(info, e.x, coll) &&
+    covers(info, coll, e.x)
+  );
+}
+
+// Reports whether body may change an element of coll: by assigning it or a
+// part of it, or by taking its address or that of the array coll.
+function changesElements(info: GoInfo, body: Node, coll: Expr): boolean {
+  const stored = writeTargets(info, body).map(storedInto);
+  if (stored.some(e => e.type === 'IndexExpr' && covers(info, e.x, coll))) {
+    return true;
+  }
+  let sliced = false;
+  inspect(body, n => {
+    if (n.type !== 'SliceExpr' || !covers(info, n.x, coll)) return;
+    const t = info.typeOf(n.x);
+    if (t && under(t).kind === 'array') sliced = true;
+  });
+  return sliced;
+}
+
+// Returns the first call of a function or write through a pointer in
+// body, either of which may change the elements of an array that it does
+// not name. Builtins and conversions are not counted.
+function indirectChange(info: GoInfo, body: Node): Node | undefined {
+  const changes: Node[] = [];
+  inspect(body, n => {
+    if (n.type !== 'CallExpr') return;
+    const fun = unparen(n.fun);
+    const builtin =
+      fun.type === 'Ident' && info.uses.get(fun)?.kind === 'builtin';
+    if (!builtin && info.types.get(fun)?.mode !== 'type') changes.push(n);
+  });
+  for (const target of writeTargets(info, body)) {
+    const e = storedInto(target);
+    const through = e.type === 'IndexExpr' ? unparen(e.x) : e;
+    const pointer = info.typeOf(through)?.kind === 'pointer';
+    if (e.type === 'StarExpr' || (through !== unparen(target) && pointer)) {
+      changes.push(target);
+    }
+  }
+  return changes.sort((a, b) => a.pos - b.pos)[0];
+}
+
+// Rejects collections that range would iterate differently from indexes
+// 0 to len(coll)-1.
+function checkCollection(
+  info: GoInfo,
+  file: GoSourceFile,
+  loop: Node,
+  coll: Expr
+): 'slice' | 'array' {
+  const where = `Cannot convert the loop at ${locationOf(file, loop.pos)}`;
+  const t = info.typeOf(coll);
+  const u = t && under(t);
+  const text = file.src.substring(coll.pos, coll.end);
+  if (u?.kind === 'slice') return 'slice';
+  if (u?.kind === 'array') return 'array';
+  if (u?.kind === 'pointer' && under(u.elem).kind === 'array') return 'slice';
+  const reason =
+    u?.kind === 'map'
+      ? `${text} is a map, whose keys range visits instead of the indexes 0 to len(${text})-1`
+      : u?.kind === 'basic' && u.name.endsWith('string')
+        ? `${text} is a string, whose runes range visits instead of its bytes`
+        : `only loops over slices and arrays can be converted, and ${text} is not one`;
+  throw new ToolError(
+    'unsupported_construct',
+    `${where}: ${reason}`,
+    errorLocation(file, coll.pos)
+  );
+}
+
+// Rejects bodies assigning the collection or a variable it is part of,
+// which can change its length while the loop runs.
+function checkNotAssigned(
+  info: GoInfo,
+  file: GoSourceFile,
+  loop: ForStmt | RangeStmt,
+  coll: Expr
+): void {
+  const text = file.src.substring(coll.pos, coll.end);
+  for (const target of writeTargets(info, loop.body)) {
+    const e = unparen(target);
+    if (e.type !== 'IndexExpr' && covers(info, e, coll)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot convert the loop at ${locationOf(file, loop.pos)}: its body assigns ${text}, which may change its length during the loop`,
+        errorLocation(file, e.pos)
+      );
+    }
+  }
+}
+
+// Returns name, or v or i followed by the first number that makes it
+// differ from every identifier in loop.
+function freshName(
+  loop: Node,
+  base: string,
+  name: string | undefined
+): string {
+  const used = new Set<string>();
+  inspect(loop, n => {
+    if (n.type === 'Ident') used.add(n.name);
+  });
+  if (name !== undefined) {
+    checkIdentifier(name);
+    if (used.has(name)) {
+      throw new ToolError(
+        'name_conflict',
+        `'${name}' is already used in the loop`
+      );
+    }
+    return name;
+  }
+  let candidate = base;
+  for (let k = 1; used.has(candidate); k++) candidate = `${base}${k}`;
+  return candidate;
+}
+
+// Matches for i := 0; i < len(x); i++, returning the index and x.
+function matchIndexLoop(
+  info: GoInfo,
+  file: GoSourceFile,
+  loop: ForStmt
+): { index: Ident; coll: Expr } {
+  const where = `Cannot convert the loop at ${locationOf(file, loop.pos)}`;
+  const fail = (reason: string, node: Node = loop): never => {
+    throw new ToolError(
+      'unsupported_construct',
+      `${where}: ${reason}`,
+      errorLocation(file, node.pos)
+    );
+  };
+  const { init, cond, post } = loop;
+  const text = (n: Node) => file.src.substring(n.pos, n.end);
+  if (
+    init?.type !== 'AssignStmt' ||
+    init.tok !== ':=' ||
+    init.lhs.length !== 1 ||
+    init.lhs[0].type !== 'Ident' ||
+    init.rhs.length !== 1
+  ) {
+    return fail(
+      'it does not declare an index with :=, as in for i := 0; i < len(x); i++',
+      init
+    );
+  }
+  const index = init.lhs[0];
+  const obj = info.defs.get(index);
+  const zero = unparen(init.rhs[0]);
+  if (zero.type !== 'BasicLit' || zero.value !== '0') {
+    return fail(
+      `the index starts at ${text(init.rhs[0])} rather than 0`,
+      init.rhs[0]
+    );
+  }
+  const isIndex = (e: Expr) => {
+    e = unparen(e);
+    return e.type === 'Ident' && !!obj && info.uses.get(e) === obj;
+  };
+  const bound = cond && unparen(cond);
+  const len =
+    bound?.type === 'BinaryExpr' && bound.op === '<' && isIndex(bound.x)
+      ? unparen(bound.y)
+      : undefined;
+  const fun = len?.type === 'CallExpr' ? unparen(len.fun) : undefined;
+  if (
+    len?.type !== 'CallExpr' ||
+    fun?.type !== 'Ident' ||
+    info.uses.get(fun)?.kind !== 'builtin' ||
+    fun.name !== 'len' ||
+    len.args.length !== 1
+  ) {
+    return fail(
+      `its condition ${cond ? text(cond) : 'is missing and'} is not ${index.name} < len(x)`,
+      cond
+    );
+  }
+  const coll = len.args[0];
+  if (post?.type !== 'IncDecStmt' || post.tok !== '++' || !isIndex(post.x)) {
+    return fail(
+      `${post ? `it steps the index with ${text(post)}` : 'it does not step the index'} rather than ${index.name}++`,
+      post
+    );
+  }
+  if (!operandIdents(info, coll)) {
+    return fail(
+      `len(${text(coll)}) is evaluated on each iteration, and range would evaluate ${text(coll)} once`,
+      coll
+    );
+  }
+  for (const target of writeTargets(info, loop.body)) {
+    if (isIndex(storedInto(target))) {
+      return fail(
+        `its body assigns the index ${index.name}, which range cannot express`,
+        target
+      );
+    }
+  }
+  return { index, coll };
+}
+
+function loopHeader(file: GoSourceFile, loop: ForStmt | RangeStmt): string {
+  return file.src.substring(loop.pos, loop.body.pos).trim();
+}
+
+async function finish(
+  file: GoSourceFile,
+  loop: ForStmt | RangeStmt,
+  header: string,
+  edits: TextEdit[],
+  warnings: string[],
+  options: ConvertLoopOptions
+): Promise<ConvertLoopResult> {
+  const { dryRun = false } = options;
+  edits.push({ pos: loop.pos, end: loop.body.pos, newText: `${header} ` });
+  const updated = applyTextEdits(file.src, edits);
+  return {
+    location: locationOf(file, loop.pos),
+    from: loopHeader(file, loop),
+    to: header,
+    warnings,
+    changes: await commitFileChanges(
+      [{ filePath: file.filePath, original: file.src, updated }],
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+// Rewrites a loop counting an index from 0 to len(x)-1 as a range loop
+// over x. The elements of x that the body reads at the index become the
+// value variable, unless the body also changes them, which range would
+// not see; the index is kept if the body still uses it.
+export async function performReplaceLoopWithRange(
+  options: ConvertLoopOptions
+): Promise<ConvertLoopResult> {
+  const { file, program } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const loop = loopAt(file, options.line);
+  if (loop.type === 'RangeStmt') {
+    throw new ToolError(
+      'invalid_argument',
+      `The loop at ${locationOf(file, loop.pos)} is already a range loop`
+    );
+  }
+  const { index, coll } = matchIndexLoop(info, file, loop);
+  checkCollection(info, file, loop, coll);
+  checkNotAssigned(info, file, loop, coll);
+  const obj = info.defs.get(index);
+
+  // The value holds the element as it was when the iteration began, and
+  // of a copy for arrays, so it only replaces the reads of the elements
+  // if the body changes none.
+  const reads: IndexExpr[] = [];
+  if (!changesElements(info, loop.body, coll)) {
+    inspect(loop.body, n => {
+      if (isElement(info, n, coll, obj)) {
+        reads.push(n);
+        return false;
+      }
+    });
+  }
+
+  const value = reads.length > 0 ? freshName(loop, 'v', options.name) : '';
+  const edits: TextEdit[] = reads.map(e => ({
+    pos: e.pos,
+    end: e.end,
+    newText: value,
+  }));
+  let indexUsed = false;
+  inspect(loop.body, n => {
+    if (reads.includes(n as IndexExpr)) return false;
+    if (n.type === 'Ident' && info.uses.get(n) === obj) indexUsed = true;
+  });
+  const key = indexUsed ? index.name : '_';
+  const vars = value ? `${key}, ${value} := ` : indexUsed ? `${key} := ` : '';
+  const collText = file.src.substring(coll.pos, coll.end);
+  const header = `for ${vars}range ${collText}`;
+  return finish(file, loop, header, edits, [], options);
+}
+
+// Rewrites a range loop over a slice or array as a loop counting an index
+// from 0 to len(x)-1, declaring the value variable at the top of the body.
+export async function performReplaceRangeWithIndex(
+  options: ConvertLoopOptions
+): Promise<ConvertLoopResult> {
+  const { file, program } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const loop = loopAt(file, options.line);
+  const location = locationOf(file, loop.pos);
+  if (loop.type === 'ForStmt') {
+    throw new ToolError(
+      'invalid_argument',
+      `The loop at ${location} is not a range loop`
+    );
+  }
+  const coll = loop.x;
+  const collText = file.src.substring(coll.pos, coll.end);
+  const kind = checkCollection(info, file, loop, coll);
+  if (loop.tok === '=') {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot convert the loop at ${location}: it assigns variables declared outside of it, which end with other values after an index loop`,
+      errorLocation(file, loop.pos)
+    );
+  }
+  if (!operandIdents(info, coll)) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot convert the loop at ${location}: range evaluates ${collText} once, and an index loop evaluates it on each iteration`,
+      errorLocation(file, coll.pos)
+    );
+  }
+  checkNotAssigned(info, file, loop, coll);
+
+  const named = (e: Expr | undefined) =>
+    e?.type === 'Ident' && e.name !== '_' ? info.defs.get(e) : undefined;
+  const keyObj = named(loop.key);
+  const valueObj = named(loop.value);
+  // Assigning the key changes a copy in a range loop, but the counter of
+  // an index loop.
+  for (const target of writeTargets(info, loop.body)) {
+    const e = unparen(storedInto(target));
+    if (keyObj && e.type === 'Ident' && info.uses.get(e) === keyObj) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot convert the loop at ${location}: its body assigns the key ${keyObj.name}, which would change the index of the loop`,
+        errorLocation(file, target.pos)
+      );
+    }
+  }
+  let valueUsed = false;
+  inspect(loop.body, n => {
+    if (n.type === 'Ident' && valueObj && info.uses.get(n) === valueObj) {
+      valueUsed = true;
+    }
+  });
+  const warnings: string[] = [];
+  if (valueUsed && kind === 'array') {
+    if (changesElements(info, loop.body, coll)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot convert the loop at ${location}: its body changes elements of the array ${collText}, which range copies before the loop starts`,
+        errorLocation(file, loop.pos)
+      );
+    }
+    const change = indirectChange(info, loop.body);
+    if (change) {
+      const what =
+        change.type === 'CallExpr' ? 'call' : 'write through a pointer';
+      warnings.push(
+        `${locationOf(file, change.pos)}: the ${what} may change elements of the array ${collText}, which range copies before the loop starts; ${valueObj!.name} would then see the change`
+      );
+    }
+  }
+  if (valueUsed && info.scopes.get(loop.body)?.lookup(valueObj!.name)) {
+    throw new ToolError(
+      'name_conflict',
+      `Cannot convert the loop at ${location}: its body declares another '${valueObj!.name}'`
+    );
+  }
+
+  const index = keyObj ? keyObj.name : freshName(loop, 'i', options.name);
+  const edits: TextEdit[] = [];
+  if (valueUsed) {
+    const indent = `${indentAt(file.src, loop.pos)}\t`;
+    const pos = loop.body.pos + 1;
+    const decl = `\n${indent}${valueObj!.name} := ${collText}[${index}]`;
+    edits.push({
+      pos,
+      end: pos,
+      newText: file.src[pos] === '\n' ? decl : `${decl}\n${indent}`,
+    });
+  }
+  const header = `for ${index} := 0; ${index} < len(${collText}); ${index}++`;
+  return finish(file, loop, header, edits, warnings, options);
+}
+
+export function formatConvertLoopResults(result: ConvertLoopResult): string {
+  const output = [
+    `Replaced '${result.from}' with '${result.to}' at ${result.location}`,
+  ];
+  if (result.warnings.length > 0) {
+    output.push('Check these by hand:');
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,460 @@
+import type {
+  BlockStmt,
+  Field,
+  FuncDecl,
+  FuncLit,
+  Ident,
+  Node,
+  ReturnStmt,
+} from '../utils/go-ast.js';
+import { inspect, pathEnclosingInterval } from '../utils/go-ast.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  checkIdentifier,
+  indentAt,
+  lineStart,
+  zeroOf,
+} from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  locationOf,
+  objectKindLabel,
+  resolveLocation,
+} from '../utils/go-references.js';
+import type { GoLocationInput } from '../utils/go-references.js';
+import { GO_KEYWORDS } from '../utils/go-scanner.js';
+import { sameObject, universe } from '../utils/go-types.js';
+import type { GoObject, GoSourceFile, Type } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+// Whether the results are given names or have their names removed.
+export type NamedReturnsMode = 'name' | 'unname';
+
+export interface ConvertNamedReturnsOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoLocationInput {
+  filePath: string;
+  mode: NamedReturnsMode;
+  // The names to give the results in order, when naming them. By default
+  // they are derived from the result types.
+  names?: string[];
+  dryRun?: boolean;
+}
+
+export interface ConvertNamedReturnsResult {
+  // The function, as func F, method T.M or the function literal at a
+  // location.
+  functionName: string;
+  mode: NamedReturnsMode;
+  // The names given to or removed from the results.
+  names: string[];
+  // The number of naked return statements given the result values.
+  returns: number;
+  // The results declared as local variables of the body, since the body
+  // still uses them.
+  locals: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// The edits converting a function, and what they do.
+interface Conversion {
+  names: string[];
+  returns: number;
+  locals: string[];
+  edits: TextEdit[];
+}
+
+function label(file: GoSourceFile, func: FuncDecl | FuncLit): string {
+  if (func.type === 'FuncLit') {
+    return `the function literal at ${locationOf(file, func.pos)}`;
+  }
+  let recv = func.recv?.list[0]?.fieldType;
+  while (recv && recv.type !== 'Ident') {
+    if (recv.type === 'StarExpr' || recv.type === 'IndexExpr') recv = recv.x;
+    else if (recv.type === 'ParenExpr') recv = recv.x;
+    else break;
+  }
+  return recv?.type === 'Ident'
+    ? `method ${recv.name}.${func.name.name}`
+    : `func ${func.name.name}`;
+}
+
+// Returns the name that Go code conventionally gives a value of type t.
+function nameFor(t: Type): string {
+  switch (t.kind) {
+    case 'pointer':
+      return nameFor(t.elem);
+    case 'slice':
+      return t.elem.kind === 'named' || t.elem.kind === 'pointer'
+        ? `${nameFor(t.elem)}s`
+        : 'values';
+    case 'map':
+      return 'm';
+    case 'chan':
+      return 'ch';
+    case 'signature':
+      return 'fn';
+    case 'basic':
+      if (t.name === 'bool') return 'ok';
+      if (t.name === 'string') return 's';
+      if (t.name === 'byte') return 'b';
+      if (t.name === 'rune') return 'r';
+      if (/^float/.test(t.name)) return 'f';
+      if (/^complex/.test(t.name)) return 'c';
+      return 'n';
+    case 'named': {
+      const { name } = t.obj;
+      if (name === 'error' && t.obj.pos < 0) return 'err';
+      // URL becomes url and HTTPClient becomes httpClient.
+      const upper = /^\p{Lu}+/u.exec(name)?.[0] ?? '';
+      const lead =
+        upper.length > 1 && upper.length < name.length
+          ? upper.slice(0, -1)
+          : upper;
+      const result = lead.toLowerCase() + name.slice(lead.length);
+      return GO_KEYWORDS.has(result) || universe.lookup(result)
+        ? result[0]
+        : result;
+    }
+  }
+  return 'v';
+}
+
+// Returns the return statements of body that belong to it rather than to
+// function literals inside it.
+function returnsOf(body: BlockStmt): ReturnStmt[] {
+  const returns: ReturnStmt[] = [];
+  inspect(body, n => {
+    if (n.type === 'FuncLit') return false;
+    if (n.type === 'ReturnStmt') returns.push(n);
+  });
+  return returns;
+}
+
+// Returns the identifiers in body, including those of function literals,
+// that refer to obj.
+function usesOf(info: GoInfo, body: BlockStmt, obj: GoObject): Ident[] {
+  const uses: Ident[] = [];
+  inspect(body, n => {
+    if (n.type === 'Ident' && sameObject(info.uses.get(n), obj)) uses.push(n);
+  });
+  return uses;
+}
+
+// Returns the first use of name in body that refers to an object declared
+// outside the function, which a result of that name would hide.
+function outerUse(
+  info: GoInfo,
+  file: GoSourceFile,
+  func: FuncDecl | FuncLit,
+  body: BlockStmt,
+  name: string
+): { ident: Ident; obj: GoObject } | undefined {
+  let found: { ident: Ident; obj: GoObject } | undefined;
+  const visit = (n: Node): boolean | void => {
+    if (found) return false;
+    // Selected names are not looked up in scopes.
+    if (n.type === 'SelectorExpr') {
+      inspect(n.x, visit);
+      return false;
+    }
+    if (n.type !== 'Ident' || n.name !== name) return;
+    const obj = info.uses.get(n);
+    if (!obj || obj.isField || obj.kind === 'label') return;
+    const inside =
+      obj.file === file && obj.pos >= func.pos && obj.pos < func.end;
+    if (!inside) found = { ident: n, obj };
+  };
+  inspect(body, visit);
+  return found;
+}
+
+function nameResults(
+  info: GoInfo,
+  file: GoSourceFile,
+  func: FuncDecl | FuncLit,
+  fields: Field[],
+  functionName: string,
+  given: string[] | undefined
+): Conversion {
+  const body = func.body!;
+  const scope = info.scopes.get(body);
+  if (given && given.length !== fields.length) {
+    throw new ToolError(
+      'invalid_argument',
+      `Expected ${fields.length} names, one for each result of ${functionName}, got ${given.length}`
+    );
+  }
+  given?.forEach(checkIdentifier);
+
+  // Results sharing a derived name are numbered, as are names that are
+  // taken, from the first free number on.
+  const sig =
+    func.type === 'FuncDecl'
+      ? info.defs.get(func.name)?.type
+      : info.typeOf(func);
+  const derived = fields.map((_, i) =>
+    sig?.kind === 'signature' && sig.results[i]?.type
+      ? nameFor(sig.results[i].type!)
+      : 'v'
+  );
+  const names: string[] = [];
+  derived.forEach((base, i) => {
+    if (given) {
+      const name = given[i];
+      if (names.includes(name)) {
+        throw new ToolError(
+          'invalid_argument',
+          `'${name}' is given to more than one result`
+        );
+      }
+      const existing = scope?.lookup(name);
+      if (existing) {
+        throw new ToolError(
+          'name_conflict',
+          `'${name}' is already declared in ${functionName} at ${locationOf(file, existing.pos)}`,
+          errorLocation(file, existing.pos)
+        );
+      }
+      const outer = outerUse(info, file, func, body, name);
+      if (outer) {
+        throw new ToolError(
+          'name_conflict',
+          `A result named '${name}' would hide the ${objectKindLabel(outer.obj)} used at ${locationOf(file, outer.ident.pos)}`,
+          errorLocation(file, outer.ident.pos)
+        );
+      }
+      names.push(name);
+      return;
+    }
+    const shared = derived.filter(d => d === base).length > 1;
+    const taken = (name: string) =>
+      names.includes(name) ||
+      !!scope?.lookup(name) ||
+      !!outerUse(info, file, func, body, name);
+    let name = shared ? `${base}1` : base;
+    for (let k = shared ? 2 : 1; taken(name); k++) name = `${base}${k}`;
+    names.push(name);
+  });
+
+  // A single result without parentheses gets them.
+  const wrap = func.funcType.results!.opening < 0;
+  const edits: TextEdit[] = fields.map((f, i) => ({
+    pos: f.pos,
+    end: f.pos,
+    newText: `${wrap ? '(' : ''}${names[i]} `,
+  }));
+  if (wrap) {
+    const end = fields[0].end;
+    edits.push({ pos: end, end, newText: ')' });
+  }
+  return { names, returns: 0, locals: [], edits };
+}
+
+function unnameResults(
+  info: GoInfo,
+  file: GoSourceFile,
+  func: FuncDecl | FuncLit,
+  fields: Field[],
+  functionName: string
+): Conversion {
+  const body = func.body!;
+  const results = fields.flatMap(f =>
+    f.names.map(ident => ({
+      ident,
+      obj: info.defs.get(ident),
+      text: file.src.substring(f.fieldType.pos, f.fieldType.end),
+    }))
+  );
+
+  // A deferred call runs after the return statement has set the results,
+  // and may change them through a function literal or a pointer. Once the
+  // results are locals, those changes would be lost.
+  let defer: Node | undefined;
+  inspect(body, n => {
+    if (n.type === 'FuncLit') return false;
+    if (n.type === 'DeferStmt' && !defer) defer = n;
+  });
+  if (defer) {
+    for (const { ident, obj } of results) {
+      if (!obj) continue;
+      let escapes = false;
+      inspect(body, n => {
+        if (n.type === 'FuncLit' && usesOf(info, n.body, obj).length > 0) {
+          escapes = true;
+        }
+        if (
+          n.type === 'UnaryExpr' &&
+          n.op === '&' &&
+          n.x.type === 'Ident' &&
+          sameObject(info.uses.get(n.x), obj)
+        ) {
+          escapes = true;
+        }
+      });
+      if (escapes) {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot remove the result names of ${functionName}: the deferred call at ${locationOf(file, defer.pos)} may change '${ident.name}' after it is returned`,
+          errorLocation(file, defer.pos)
+        );
+      }
+    }
+  }
+
+  // The results keep holding the values to return as local variables,
+  // unless the body never uses them and they are always zero.
+  const naked = returnsOf(body).filter(r => r.results.length === 0);
+  const locals: typeof results = [];
+  const values = results.map(r => {
+    const used = r.obj && usesOf(info, body, r.obj).length > 0;
+    const zero = r.obj?.type && zeroOf(r.obj.type, r.text);
+    if (used || (r.ident.name !== '_' && !zero)) {
+      locals.push(r);
+      return r.ident.name;
+    }
+    return zero ?? `*new(${r.text})`;
+  });
+
+  const edits: TextEdit[] = [];
+  const types = results.map(r => r.text);
+  const list = func.funcType.results!;
+  edits.push({
+    pos: list.pos,
+    end: list.end,
+    newText: types.length === 1 ? types[0] : `(${types.join(', ')})`,
+  });
+  if (locals.length > 0) {
+    const [first] = body.list;
+    const multiline = first.pos > file.src.indexOf('\n', body.pos);
+    const indent = indentAt(file.src, first.pos);
+    const decls = locals.map(l => `var ${l.ident.name} ${l.text}`);
+    const start = lineStart(file.src, first.pos);
+    edits.push(
+      multiline
+        ? {
+            pos: start,
+            end: start,
+            newText: decls.map(d => `${indent}${d}\n`).join(''),
+          }
+        : {
+            pos: first.pos,
+            end: first.pos,
+            newText: decls.map(d => `${d}; `).join(''),
+          }
+    );
+  }
+  for (const r of naked) {
+    const newText = `return ${values.join(', ')}`;
+    edits.push({ pos: r.pos, end: r.end, newText });
+  }
+  return {
+    names: results.map(r => r.ident.name),
+    returns: naked.length,
+    locals: locals.map(l => l.ident.name),
+    edits,
+  };
+}
+
+export async function performConvertNamedReturns(
+  options: ConvertNamedReturnsOptions
+): Promise<ConvertNamedReturnsResult> {
+  const { mode, dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const index = resolveLocation(file, options);
+  const func = pathEnclosingInterval(file.ast, index)
+    .reverse()
+    .find(
+      (n): n is FuncDecl | FuncLit =>
+        n.type === 'FuncDecl' || n.type === 'FuncLit'
+    );
+  if (!func) {
+    throw new ToolError(
+      'invalid_location',
+      `No function at ${locationOf(file, index)}`
+    );
+  }
+  const functionName = label(file, func);
+  if (!func.body) {
+    throw new ToolError('unsupported_construct', `${functionName} has no body`);
+  }
+  const fields = func.funcType.results?.list ?? [];
+  if (fields.length === 0) {
+    throw new ToolError('invalid_argument', `${functionName} has no results`);
+  }
+  const named = fields[0].names.length > 0;
+  if (mode === 'name' && named) {
+    throw new ToolError(
+      'invalid_argument',
+      `The results of ${functionName} are already named`
+    );
+  }
+  if (mode === 'unname' && !named) {
+    throw new ToolError(
+      'invalid_argument',
+      `The results of ${functionName} are not named`
+    );
+  }
+
+  const converted =
+    mode === 'name'
+      ? nameResults(info, file, func, fields, functionName, options.names)
+      : unnameResults(info, file, func, fields, functionName);
+  const changes = await commitFileChanges(
+    [
+      {
+        filePath: file.filePath,
+        original: file.src,
+        updated: applyTextEdits(file.src, converted.edits),
+      },
+    ],
+    dryRun,
+    options
+  );
+
+  return {
+    functionName,
+    mode,
+    names: converted.names,
+    returns: converted.returns,
+    locals: converted.locals,
+    changes,
+    dryRun,
+  };
+}
+
+export function formatConvertNamedReturnsResults(
+  result: ConvertNamedReturnsResult
+): string {
+  const names = result.names.join(', ');
+  const output =
+    result.mode === 'name'
+      ? [`Named the results of ${result.functionName}: ${names}`]
+      : [`Removed the result names ${names} of ${result.functionName}`];
+  if (result.returns > 0) {
+    const returns =
+      result.returns === 1
+        ? '1 naked return'
+        : `${result.returns} naked returns`;
+    output[0] += `, giving ${returns} the result values`;
+  }
+  if (result.locals.length > 0) {
+    output.push(`Declared as local variables: ${result.locals.join(', ')}`);
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
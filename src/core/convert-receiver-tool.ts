@@ -0,0 +1,556 @@
+import type { Expr, FuncDecl, Ident, Node } from '../utils/go-ast.js';
+import {
+  inspect,
+  isExported,
+  pathEnclosingInterval,
+  unparen,
+} from '../utils/go-ast.js';
+import { collectWrites, isAddressable } from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import { fileQualifier, needsParens } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { errorLocation, locationOf } from '../utils/go-references.js';
+import {
+  identical,
+  interfaceMethods,
+  methodSet,
+  typeString,
+  under,
+} from '../utils/go-types.js';
+import type {
+  GoObject,
+  GoSourceFile,
+  SignatureType,
+  Type,
+} from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { step } from '../utils/task.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ConvertReceiverOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  // A type declared in the package of filePath.
+  typeName: string;
+  // The receiver all methods of the type get.
+  receiver: 'pointer' | 'value';
+  dryRun?: boolean;
+}
+
+export interface ConvertReceiverResult {
+  typeName: string;
+  receiver: 'pointer' | 'value';
+  // Methods whose receiver changed, in declaration order.
+  converted: string[];
+  // Uses of the methods outside them that were rewritten to keep
+  // compiling: method expressions and calls on composite literals.
+  callSites: number;
+  warnings: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// Types of package sync that must not be copied once used.
+const syncTypes = ['Cond', 'Mutex', 'Once', 'RWMutex', 'WaitGroup'];
+
+function addEdit(edits: Map<GoSourceFile, TextEdit[]>, file: GoSourceFile) {
+  return edits.get(file) ?? edits.set(file, []).get(file)!;
+}
+
+function isPointer(t: Type | undefined): boolean {
+  return !!t && under(t).kind === 'pointer';
+}
+
+// Returns the identifiers in node that refer to the receiver recv, each
+// with the node it is an operand of.
+function receiverUses(
+  info: GoInfo,
+  file: GoSourceFile,
+  node: Node,
+  recv: GoObject
+): { id: Ident; parent: Node }[] {
+  const uses: { id: Ident; parent: Node }[] = [];
+  inspect(node, n => {
+    if (n.type !== 'Ident' || info.uses.get(n) !== recv) return;
+    const path = pathEnclosingInterval(file.ast, n.pos, n.end);
+    uses.push({ id: n, parent: path[path.length - 2] });
+  });
+  return uses;
+}
+
+// Calls visit for each place in root where a value is implicitly converted
+// to the type of what it is assigned to, passed as or returned as, and for
+// each type a type assertion or type switch asserts, with the position, the
+// value's type and the type it must fit.
+function conversions(
+  info: GoInfo,
+  root: Node,
+  sig: SignatureType | undefined,
+  visit: (pos: number, value: Type, target: Type) => void
+): void {
+  const assign = (e: Expr | undefined, target: Type | undefined) => {
+    const t = e && info.typeOf(e);
+    if (e && t && target) visit(e.pos, t, target);
+  };
+  const body = (n: Node, t: Type | undefined) =>
+    conversions(info, n, t?.kind === 'signature' ? t : undefined, visit);
+  inspect(root, n => {
+    switch (n.type) {
+      case 'FuncDecl':
+        if (n.body) body(n.body, info.defs.get(n.name)?.type);
+        return false;
+      case 'FuncLit':
+        body(n.body, info.typeOf(n));
+        return false;
+      case 'AssignStmt':
+        if (n.tok === '=' && n.lhs.length === n.rhs.length) {
+          n.lhs.forEach((l, i) => assign(n.rhs[i], info.typeOf(l)));
+        }
+        break;
+      case 'ValueSpec': {
+        const target = n.valueType && info.typeOf(n.valueType);
+        if (n.names.length === n.values.length) {
+          n.values.forEach(v => assign(v, target));
+        }
+        break;
+      }
+      case 'ReturnStmt':
+        if (sig && n.results.length === sig.results.length) {
+          n.results.forEach((r, i) => assign(r, sig.results[i].type));
+        }
+        break;
+      case 'SendStmt': {
+        const t = info.typeOf(n.chan);
+        const u = t && under(t);
+        if (u?.kind === 'chan') assign(n.value, u.elem);
+        break;
+      }
+      case 'CallExpr': {
+        const fun = info.types.get(n.fun);
+        if (fun?.mode === 'type') {
+          assign(n.args[0], fun.type);
+          break;
+        }
+        const u = fun && under(fun.type);
+        if (u?.kind !== 'signature') break;
+        const last = u.params.length - 1;
+        n.args.forEach((a, i) => {
+          let t = u.params[Math.min(i, last)]?.type;
+          if (u.variadic && i >= last && !n.ellipsis && t?.kind === 'slice') {
+            t = t.elem;
+          }
+          assign(a, t);
+        });
+        break;
+      }
+      case 'CompositeLit': {
+        const t = info.typeOf(n);
+        const u = t && under(t);
+        n.elts.forEach((elt, i) => {
+          const kv = elt.type === 'KeyValueExpr' ? elt : undefined;
+          const v = kv ? kv.value : elt;
+          if (u?.kind === 'struct') {
+            const key = kv?.key;
+            const field =
+              key?.type === 'Ident'
+                ? u.fields.find(f => f.name === key.name)
+                : u.fields[i];
+            assign(v, field?.type);
+          } else if (u?.kind === 'map') {
+            if (kv) assign(kv.key, u.key);
+            assign(v, u.elem);
+          } else if (u?.kind === 'slice' || u?.kind === 'array') {
+            assign(v, u.elem);
+          }
+        });
+        break;
+      }
+      case 'TypeAssertExpr': {
+        const x = info.typeOf(n.x);
+        const t = n.assertType && info.typeOf(n.assertType);
+        if (n.assertType && x && t) visit(n.assertType.pos, t, x);
+        break;
+      }
+      case 'TypeSwitchStmt': {
+        const guard =
+          n.assign.type === 'AssignStmt'
+            ? n.assign.rhs[0]
+            : n.assign.type === 'ExprStmt'
+              ? n.assign.x
+              : undefined;
+        const g = guard && unparen(guard);
+        const x = g?.type === 'TypeAssertExpr' ? info.typeOf(g.x) : undefined;
+        if (!x) break;
+        for (const clause of n.body.list) {
+          if (clause.type !== 'CaseClause') continue;
+          for (const e of clause.list ?? []) {
+            const t = info.typeOf(e);
+            if (t) visit(e.pos, t, x);
+          }
+        }
+        break;
+      }
+    }
+  });
+}
+
+// Reports whether e denotes the variable the receiver recv points to or a
+// part of it, which a value receiver would only hold a copy of.
+function receiverPart(info: GoInfo, e: Expr, recv: GoObject): boolean {
+  e = unparen(e);
+  const isRecv = (x: Expr) => {
+    x = unparen(x);
+    return x.type === 'Ident' && info.uses.get(x) === recv;
+  };
+  switch (e.type) {
+    case 'StarExpr':
+      return isRecv(e.x);
+    case 'SelectorExpr': {
+      const sel = info.selections.get(e);
+      if (sel?.kind !== 'field' || sel.path.some(f => isPointer(f.type))) {
+        return false;
+      }
+      if (isRecv(e.x)) return true;
+      return !isPointer(info.typeOf(e.x)) && receiverPart(info, e.x, recv);
+    }
+    case 'IndexExpr': {
+      const t = info.typeOf(e.x);
+      if (!t) return false;
+      if (isRecv(e.x)) {
+        return t.kind === 'pointer' && under(t.elem).kind === 'array';
+      }
+      return under(t).kind === 'array' && receiverPart(info, e.x, recv);
+    }
+  }
+  return false;
+}
+
+// Returns where body modifies what the pointer receiver recv points to,
+// other than by calling the methods in converted.
+function receiverWrite(
+  info: GoInfo,
+  body: Node,
+  recv: GoObject,
+  converted: Set<GoObject>
+): Expr | undefined {
+  let found: Expr | undefined;
+  const write = (e: Expr | undefined) => {
+    if (!found && e && receiverPart(info, e, recv)) found = e;
+  };
+  inspect(body, n => {
+    switch (n.type) {
+      case 'AssignStmt':
+        if (n.tok !== ':=') n.lhs.forEach(write);
+        break;
+      case 'IncDecStmt':
+        write(n.x);
+        break;
+      case 'RangeStmt':
+        if (n.tok === '=') {
+          write(n.key);
+          write(n.value);
+        }
+        break;
+      case 'UnaryExpr':
+        if (n.op === '&') write(n.x);
+        break;
+      case 'SliceExpr': {
+        const t = info.typeOf(n.x);
+        if (t && under(t).kind === 'array') write(n.x);
+        break;
+      }
+      case 'SelectorExpr': {
+        // A pointer method called on the receiver's variable, or on a part
+        // of it, may modify it.
+        const sel = info.selections.get(n);
+        if (
+          !found &&
+          sel?.kind === 'method' &&
+          sel.obj.pointerRecv &&
+          !converted.has(sel.obj) &&
+          !sel.path.some(f => isPointer(f.type))
+        ) {
+          const x = unparen(n.x);
+          const direct = x.type === 'Ident' && info.uses.get(x) === recv;
+          if (
+            direct ||
+            (!isPointer(info.typeOf(x)) && receiverPart(info, x, recv))
+          ) {
+            found = n;
+          }
+        }
+        break;
+      }
+    }
+  });
+  return found;
+}
+
+export async function performConvertReceiver(
+  options: ConvertReceiverOptions
+): Promise<ConvertReceiverResult> {
+  const { receiver, dryRun = false } = options;
+  const pointer = receiver === 'pointer';
+  const { program, file: given } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const pkg = given.pkg;
+  const typeObj = pkg.scope?.lookup(options.typeName);
+  if (typeObj?.kind !== 'type' || typeObj.type?.kind !== 'named') {
+    throw new ToolError(
+      'symbol_not_found',
+      `'${options.typeName}' is not a type declared in package ${pkg.name}`
+    );
+  }
+  const name = typeObj.name;
+  const kind = under(typeObj.type).kind;
+  if (kind === 'interface' || kind === 'pointer') {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${name}' cannot have methods`,
+      typeObj.file ? errorLocation(typeObj.file, typeObj.pos) : undefined
+    );
+  }
+
+  const methods = (typeObj.methods ?? []).filter(
+    m => m.decl?.type === 'FuncDecl' && m.file
+  );
+  const todo = methods.filter(m => !!m.pointerRecv !== pointer);
+  const converted = new Set(todo);
+  const edits = new Map<GoSourceFile, TextEdit[]>();
+  const warnings: string[] = [];
+
+  for (const m of todo) {
+    const file = m.file!;
+    const decl = m.decl as FuncDecl;
+    const field = decl.recv!.list[0];
+    const recvType = field.fieldType;
+    const list = addEdit(edits, file);
+    const label = `${name}.${m.name}`;
+    if (pointer) {
+      list.push({ pos: recvType.pos, end: recvType.pos, newText: '*' });
+    } else if (recvType.type === 'StarExpr') {
+      list.push({ pos: recvType.pos, end: recvType.x.pos, newText: '' });
+    }
+    const id = field.names[0];
+    const recv = id && id.name !== '_' ? info.defs.get(id) : undefined;
+    if (!recv || !decl.body) continue;
+
+    if (pointer) {
+      // Modifying a value receiver changed a copy, while through the
+      // pointer it changes the caller's variable.
+      const writes = collectWrites(info, [decl.body]);
+      const written = [...writes.modified].find(
+        w => info.objectOf(w) === recv
+      );
+      if (written) {
+        warnings.push(
+          `${locationOf(file, written.pos)}: ${label} modifies its receiver, which now changes the caller's value`
+        );
+      }
+      // The receiver now holds a pointer, so uses of its value read it
+      // through the pointer; fields and methods are selected either way.
+      for (const { id: use, parent } of receiverUses(
+        info,
+        file,
+        decl.body,
+        recv
+      )) {
+        if (parent.type === 'SelectorExpr' && parent.x === use) continue;
+        const star: Expr = {
+          type: 'StarExpr',
+          x: use,
+          pos: use.pos,
+          end: use.end,
+        };
+        const text = needsParens(star, parent, use)
+          ? `(*${use.name})`
+          : `*${use.name}`;
+        list.push({ pos: use.pos, end: use.end, newText: text });
+      }
+      continue;
+    }
+
+    const write = receiverWrite(info, decl.body, recv, converted);
+    if (write) {
+      throw new ToolError(
+        'unsupported_construct',
+        `${label} modifies its receiver, so with a value receiver it would only modify a copy`,
+        errorLocation(file, write.pos)
+      );
+    }
+    for (const { id: use, parent } of receiverUses(
+      info,
+      file,
+      decl.body,
+      recv
+    )) {
+      if (parent.type === 'SelectorExpr' && parent.x === use) continue;
+      if (parent.type === 'StarExpr') {
+        list.push({ pos: parent.pos, end: use.pos, newText: '' });
+        continue;
+      }
+      throw new ToolError(
+        'unsupported_construct',
+        `${label} uses its receiver ${use.name} as a pointer, which a value receiver is not`,
+        errorLocation(file, use.pos)
+      );
+    }
+  }
+
+  // Callers only notice the change to pointer receivers: values that are
+  // not addressable can no longer call the methods, and T stops having
+  // them in its method set.
+  let callSites = 0;
+  if (pointer && todo.length > 0) {
+    await step(options, 'Checking uses of the methods');
+    const lostCache = new Map<Type, string[]>();
+    const lost = (t: Type) => {
+      let names = lostCache.get(t);
+      if (!names) {
+        names =
+          t.kind === 'pointer'
+            ? []
+            : methodSet(t)
+                .filter(
+                  e =>
+                    converted.has(e.obj) && !e.path.some(f => isPointer(f.type))
+                )
+                .map(e => e.obj.name);
+        lostCache.set(t, names);
+      }
+      return names;
+    };
+    for (const file of program.files) {
+      const qualifier = fileQualifier(file);
+      conversions(info, file.ast, undefined, (pos, value, target) => {
+        const u = under(target);
+        if (u.kind !== 'interface' || identical(value, target)) return;
+        const names = lost(value);
+        const needed = interfaceMethods(u).find(m => names.includes(m.name));
+        if (!needed) return;
+        const v = typeString(value, qualifier);
+        throw new ToolError(
+          'unsupported_construct',
+          `A ${v} value is used as ${typeString(target, qualifier)} here, which needs its method ${needed.name}; with a pointer receiver only *${v} has it`,
+          errorLocation(file, pos)
+        );
+      });
+
+      inspect(file.ast, n => {
+        if (n.type !== 'SelectorExpr') return;
+        const sel = info.selections.get(n);
+        if (sel?.kind !== 'method' || !converted.has(sel.obj)) return;
+        if (sel.indirect) return;
+        const list = addEdit(edits, file);
+        if (info.types.get(n.x)?.mode === 'type') {
+          // A method expression T.M becomes (*T).M, which takes the address
+          // of the receiver it is called with.
+          const path = pathEnclosingInterval(file.ast, n.pos, n.end);
+          const call = path[path.length - 2];
+          const arg =
+            call?.type === 'CallExpr' && call.fun === n && call.args[0];
+          if (!arg || !isAddressable(info, arg)) {
+            throw new ToolError(
+              'unsupported_construct',
+              `The method expression ${file.src.substring(n.pos, n.end)} would take a pointer once ${sel.obj.name} has a pointer receiver`,
+              errorLocation(file, n.pos)
+            );
+          }
+          list.push(
+            { pos: n.x.pos, end: n.x.pos, newText: '(*' },
+            { pos: n.x.end, end: n.x.end, newText: ')' },
+            { pos: arg.pos, end: arg.pos, newText: '&' }
+          );
+          callSites++;
+          return;
+        }
+        if (isAddressable(info, n.x)) return;
+        const x = unparen(n.x);
+        if (x.type === 'CompositeLit') {
+          const paren = x !== n.x;
+          list.push(
+            { pos: x.pos, end: x.pos, newText: paren ? '&' : '(&' },
+            ...(paren ? [] : [{ pos: x.end, end: x.end, newText: ')' }])
+          );
+          callSites++;
+          return;
+        }
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot take the address of ${file.src.substring(n.x.pos, n.x.end)} to call ${sel.obj.name} once it has a pointer receiver`,
+          errorLocation(file, n.x.pos)
+        );
+      });
+    }
+    if (isExported(name) && !pkg.isXTest && pkg.name !== 'main') {
+      warnings.push(
+        `${name} is exported, so code outside the module that uses ${name} values as interfaces or calls the methods on unaddressable values may break`
+      );
+    }
+  }
+
+  if (!pointer && todo.length > 0) {
+    const u = under(typeObj.type);
+    for (const f of u.kind === 'struct' ? u.fields : []) {
+      const t = f.type;
+      if (
+        t?.kind !== 'named' ||
+        t.obj.externalPath !== 'sync' ||
+        !syncTypes.includes(t.obj.name)
+      ) {
+        continue;
+      }
+      warnings.push(
+        `${name} has the field ${f.name} of type sync.${t.obj.name}, which value receivers copy`
+      );
+    }
+  }
+
+  const changes = [...edits]
+    .filter(([, list]) => list.length > 0)
+    .map(([file, list]) => ({
+      filePath: file.filePath,
+      original: file.src,
+      updated: applyTextEdits(file.src, list),
+    }));
+  return {
+    typeName: name,
+    receiver,
+    converted: todo.map(m => m.name),
+    callSites,
+    warnings,
+    changes: await commitFileChanges(changes, dryRun, options),
+    dryRun,
+  };
+}
+
+export function formatConvertReceiverResults(
+  result: ConvertReceiverResult
+): string {
+  const { typeName, receiver } = result;
+  if (result.converted.length === 0) {
+    return `All methods of '${typeName}' already have ${receiver} receivers`;
+  }
+  const count = result.converted.length;
+  const output = [
+    `Converted ${count} method${count === 1 ? '' : 's'} of '${typeName}' to ${receiver} receivers: ${result.converted.join(', ')}`,
+  ];
+  if (result.callSites > 0) {
+    const sites = result.callSites;
+    output.push(`Updated ${sites} call site${sites === 1 ? '' : 's'}`);
+  }
+  if (result.warnings.length > 0) {
+    output.push('Check these by hand:');
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,389 @@
+import type {
+  BlockStmt,
+  BranchStmt,
+  CaseClause,
+  Expr,
+  IfStmt,
+  Node,
+  Stmt,
+  SwitchStmt,
+  TypeSwitchStmt,
+} from '../utils/go-ast.js';
+import { inspect, pathEnclosingInterval, unparen } from '../utils/go-ast.js';
+import { isPure, scopeAt } from '../utils/go-analysis.js';
+import type { ConstValue } from '../utils/go-checker.js';
+import { indentAt } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { errorLocation, locationOf } from '../utils/go-references.js';
+import type { GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type { FileChange, WriteOptions } from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ConvertSwitchOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  // 1-based line of the if keyword of any if of the chain, or of the
+  // switch keyword.
+  line: number;
+  dryRun?: boolean;
+}
+
+export interface ConvertSwitchResult {
+  location: string;
+  // The statement written.
+  to: 'switch' | 'if';
+  // The expression switched on, which the conditions compare.
+  tag?: string;
+  // The number of cases, or of conditions.
+  cases: number;
+  // Whether the switch has a default, or the chain a final else.
+  hasDefault: boolean;
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// Finds the outermost if, or switch, statement whose keyword is on line,
+// returning it with the path of nodes enclosing it.
+function statementAt(
+  file: GoSourceFile,
+  line: number,
+  keyword: 'if' | 'switch'
+): { stmt: IfStmt | SwitchStmt | TypeSwitchStmt; path: Node[] } {
+  const { lineStarts } = file;
+  if (!Number.isInteger(line) || line < 1 || line > lineStarts.length) {
+    throw new ToolError('invalid_location', `Invalid line ${line}`);
+  }
+  const start = lineStarts[line - 1];
+  const end = line < lineStarts.length ? lineStarts[line] : file.src.length;
+  const types =
+    keyword === 'if' ? ['IfStmt'] : ['SwitchStmt', 'TypeSwitchStmt'];
+  let stmt: IfStmt | SwitchStmt | TypeSwitchStmt | undefined;
+  inspect(file.ast, n => {
+    if (stmt || n.end <= start || n.pos >= end) return false;
+    if (types.includes(n.type) && n.pos >= start) {
+      stmt = n as IfStmt | SwitchStmt | TypeSwitchStmt;
+    }
+  });
+  if (!stmt) {
+    throw new ToolError(
+      'invalid_location',
+      `No ${keyword} statement starts on line ${line} of ${file.filePath}`
+    );
+  }
+  return { stmt, path: pathEnclosingInterval(file.ast, stmt.pos, stmt.end) };
+}
+
+// Returns the first break in body that leaves the innermost for, switch or
+// select around body rather than a statement inside it. A body that is
+// one of those statements itself has none.
+function breakIn(body: Node): BranchStmt | undefined {
+  let found: BranchStmt | undefined;
+  inspect(body, n => {
+    if (found) return false;
+    switch (n.type) {
+      case 'ForStmt':
+      case 'RangeStmt':
+      case 'SwitchStmt':
+      case 'TypeSwitchStmt':
+      case 'SelectStmt':
+      case 'FuncLit':
+        return false;
+      case 'BranchStmt':
+        if (n.tok === 'break' && !n.label) found = n;
+    }
+  });
+  return found;
+}
+
+// Returns the statements between the braces of a block, or after the colon
+// of a clause, as they follow an opening line ending at pos: starting on
+// the next line, unless they start with a comment on that line, and
+// without the line break before the closing brace.
+function bodyText(
+  file: GoSourceFile,
+  pos: number,
+  end: number,
+  indent: string
+): string {
+  const text = file.src.substring(pos, end).trimEnd();
+  if (text.trim() === '') return '';
+  if (/^[ \t]*(\n|\/\/|\/\*)/.test(text) && text.includes('\n')) {
+    return text;
+  }
+  return `\n${indent}\t${text.trim()}`;
+}
+
+// Rewrites a chain of if and else if statements whose conditions all
+// compare the same expression with constants, possibly several joined by
+// ||, as a switch on that expression. The final else becomes the default.
+export async function performConvertIfElseToSwitch(
+  options: ConvertSwitchOptions
+): Promise<ConvertSwitchResult> {
+  const { dryRun = false } = options;
+  const { file, program } = await loadGoFile(options.filePath, options);
+  const checker = program.check();
+  const info = checker.info;
+  const found = statementAt(file, options.line, 'if');
+  // Start from the first if of the chain.
+  let head = found.stmt as IfStmt;
+  let path = found.path;
+  while (path.length > 1) {
+    const parent = path[path.length - 2];
+    if (parent.type !== 'IfStmt' || parent.else !== head) break;
+    head = parent;
+    path = path.slice(0, -1);
+  }
+  const location = locationOf(file, head.pos);
+  const where = `Cannot convert the if at ${location}`;
+  const fail = (reason: string, node: Node): never => {
+    throw new ToolError(
+      'unsupported_construct',
+      `${where}: ${reason}`,
+      errorLocation(file, node.pos)
+    );
+  };
+  const text = (n: Node) => file.src.substring(n.pos, n.end);
+  const scope = scopeAt(info, path);
+  const constant = (e: Expr): ConstValue | undefined => {
+    const v = scope && checker.constValue(e, scope, { file });
+    // 1 and 1.0 are the same case.
+    return typeof v === 'number' && Number.isInteger(v) ? BigInt(v) : v;
+  };
+  const terms = (e: Expr): Expr[] => {
+    e = unparen(e);
+    return e.type === 'BinaryExpr' && e.op === '||'
+      ? [...terms(e.x), ...terms(e.y)]
+      : [e];
+  };
+
+  let tag: Expr | undefined;
+  const seen = new Map<ConstValue, Expr>();
+  const branches: { values: Expr[]; body: BlockStmt }[] = [];
+  let defaultBody: BlockStmt | undefined;
+  for (let s: IfStmt = head; ; ) {
+    if (s !== head && s.init) {
+      fail(
+        `the else if at ${locationOf(file, s.pos)} has an init statement, which a case cannot have`,
+        s.init
+      );
+    }
+    const values: Expr[] = [];
+    for (const term of terms(s.cond)) {
+      if (term.type !== 'BinaryExpr' || term.op !== '==') {
+        return fail(
+          `its condition ${text(s.cond)} is not a comparison with == of ${tag ? text(tag) : 'an expression'} and constants, joined by ||`,
+          term
+        );
+      }
+      const xConst = constant(term.x) !== undefined;
+      const yConst = constant(term.y) !== undefined;
+      if (xConst === yConst) {
+        return fail(
+          `${text(term)} does not compare an expression with a constant`,
+          term
+        );
+      }
+      const [operand, value] = xConst ? [term.y, term.x] : [term.x, term.y];
+      const strip = (n: Node) => text(n).replace(/\s+/g, '');
+      if (!tag) {
+        if (!isPure(info, operand)) {
+          fail(
+            `${text(operand)} may have effects, and a switch would evaluate it once rather than in each condition`,
+            operand
+          );
+        }
+        tag = operand;
+      } else if (strip(operand) !== strip(tag)) {
+        return fail(
+          `${text(term)} compares ${text(operand)} rather than ${text(tag)}`,
+          term
+        );
+      }
+      const v = constant(value)!;
+      const previous = seen.get(v);
+      if (previous) {
+        fail(
+          `${text(value)} has the value of ${text(previous)} at ${locationOf(file, previous.pos)}, and a switch cannot have duplicate cases`,
+          value
+        );
+      }
+      seen.set(v, value);
+      values.push(value);
+    }
+    branches.push({ values, body: s.body });
+    if (!s.else) break;
+    if (s.else.type === 'BlockStmt') {
+      defaultBody = s.else;
+      break;
+    }
+    s = s.else as IfStmt;
+  }
+
+  const bodies = branches.map(b => b.body);
+  if (defaultBody) bodies.push(defaultBody);
+  for (const body of bodies) {
+    const brk = breakIn(body);
+    if (brk) {
+      fail(
+        `the break at ${locationOf(file, brk.pos)} leaves the enclosing loop, and would leave the switch instead`,
+        brk
+      );
+    }
+  }
+
+  const indent = indentAt(file.src, head.pos);
+  const block = (body: BlockStmt) =>
+    bodyText(file, body.lbrace + 1, body.rbrace, indent);
+  const init = head.init ? `${text(head.init)}; ` : '';
+  const lines = [`switch ${init}${text(tag!)} {`];
+  for (const { values, body } of branches) {
+    lines.push(`case ${values.map(text).join(', ')}:${block(body)}`);
+  }
+  if (defaultBody) lines.push(`default:${block(defaultBody)}`);
+  lines.push('}');
+  const updated = applyTextEdits(file.src, [
+    { pos: head.pos, end: head.end, newText: lines.join(`\n${indent}`) },
+  ]);
+  return {
+    location,
+    to: 'switch',
+    tag: text(tag!),
+    cases: branches.length,
+    hasDefault: !!defaultBody,
+    changes: await commitFileChanges(
+      [{ filePath: file.filePath, original: file.src, updated }],
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+// Rewrites an expression switch as a chain of if and else if statements,
+// each comparing the tag with the values of a case, and the default as the
+// final else. Switches whose cases fall through or break cannot be
+// rewritten.
+export async function performConvertSwitchToIfElse(
+  options: ConvertSwitchOptions
+): Promise<ConvertSwitchResult> {
+  const { dryRun = false } = options;
+  const { file, program } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const found = statementAt(file, options.line, 'switch');
+  const location = locationOf(file, found.stmt.pos);
+  const where = `Cannot convert the switch at ${location}`;
+  const fail = (reason: string, node: Node): never => {
+    throw new ToolError(
+      'unsupported_construct',
+      `${where}: ${reason}`,
+      errorLocation(file, node.pos)
+    );
+  };
+  if (found.stmt.type === 'TypeSwitchStmt') {
+    return fail(
+      'it is a type switch, whose cases match types rather than values',
+      found.stmt
+    );
+  }
+  const { path } = found;
+  const stmt = found.stmt as SwitchStmt;
+  const text = (n: Node) => file.src.substring(n.pos, n.end);
+  const parent = path[path.length - 2];
+  if (parent?.type === 'LabeledStmt') {
+    fail(
+      `it has the label ${parent.label.name}, which an if cannot be the target of`,
+      parent
+    );
+  }
+  const { tag } = stmt;
+  if (tag && !isPure(info, tag)) {
+    fail(
+      `its tag ${text(tag)} may have effects, and an if/else chain would evaluate it in each condition`,
+      tag
+    );
+  }
+
+  const clauses = stmt.body.list as CaseClause[];
+  const cases = clauses.filter(c => c.list);
+  const defaultClause = clauses.find(c => !c.list);
+  if (cases.length === 0) {
+    fail('it has no case to write as a condition', stmt);
+  }
+  for (const clause of clauses) {
+    const last: Stmt | undefined = clause.body[clause.body.length - 1];
+    if (last?.type === 'BranchStmt' && last.tok === 'fallthrough') {
+      fail(
+        `the case at ${locationOf(file, clause.pos)} falls through, which an if/else chain cannot express`,
+        last
+      );
+    }
+    for (const s of clause.body) {
+      const brk = breakIn(s);
+      if (brk) {
+        fail(
+          `the break at ${locationOf(file, brk.pos)} leaves the switch, and would leave the enclosing loop instead`,
+          brk
+        );
+      }
+    }
+  }
+
+  // Comparing with == binds tighter than every operator but the
+  // arithmetic ones, so operands using others need parentheses.
+  const operand = (e: Expr) =>
+    e.type === 'BinaryExpr' &&
+    ['==', '!=', '<', '<=', '>', '>=', '&&', '||'].includes(e.op)
+      ? `(${text(e)})`
+      : text(e);
+  const condition = (values: Expr[]) =>
+    values
+      .map(v => (tag ? `${operand(tag)} == ${operand(v)}` : text(v)))
+      .join(' || ');
+  const indent = indentAt(file.src, stmt.pos);
+  const clauseBody = (clause: CaseClause) => {
+    const next = clauses[clauses.indexOf(clause) + 1];
+    const end = next ? next.pos : stmt.body.rbrace;
+    return bodyText(file, clause.colon + 1, end, indent);
+  };
+  const init = stmt.init ? `${text(stmt.init)}; ` : '';
+  let result = '';
+  cases.forEach((clause, i) => {
+    const keyword = i === 0 ? `if ${init}` : ' else if ';
+    result += `${keyword}${condition(clause.list!)} {${clauseBody(clause)}\n${indent}}`;
+  });
+  const defaultText = defaultClause ? clauseBody(defaultClause) : '';
+  if (defaultText) result += ` else {${defaultText}\n${indent}}`;
+  const updated = applyTextEdits(file.src, [
+    { pos: stmt.pos, end: stmt.end, newText: result },
+  ]);
+  return {
+    location,
+    to: 'if',
+    tag: tag && text(tag),
+    cases: cases.length,
+    hasDefault: !!defaultText,
+    changes: await commitFileChanges(
+      [{ filePath: file.filePath, original: file.src, updated }],
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+export function formatConvertSwitchResults(
+  result: ConvertSwitchResult
+): string {
+  const plural = (n: number, word: string) =>
+    `${n} ${word}${n === 1 ? '' : 's'}`;
+  const summary =
+    result.to === 'switch'
+      ? `Converted the if/else chain at ${result.location} into a switch on ${result.tag} with ${plural(result.cases, 'case')}${result.hasDefault ? ' and a default' : ''}`
+      : `Converted the switch at ${result.location} into an if/else chain of ${plural(result.cases, 'condition')}${result.hasDefault ? ' and an else' : ''}`;
+  return `${summary}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
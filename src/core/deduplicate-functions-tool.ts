@@ -0,0 +1,546 @@
+import type { FieldList, FuncDecl, Ident, Node } from '../utils/go-ast.js';
+import { isExported, pathEnclosingInterval } from '../utils/go-ast.js';
+import { internalVisible, lookupAt } from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  addImportEdits,
+  declRemovalEdit,
+  fileQualifier,
+  importPathOf,
+  pruneImports,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import {
+  dirImportPath,
+  exclusionWarnings,
+  loadGoFile,
+} from '../utils/go-loader.js';
+import type { GoProgram, LoadOptions } from '../utils/go-loader.js';
+import {
+  findReferences,
+  functionName,
+  locationOf,
+} from '../utils/go-references.js';
+import type { GoObject, GoPackage, GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { step } from '../utils/task.js';
+import { ToolError } from '../utils/tool-error.js';
+
+// Where duplicates are looked for: the package of filePath, its test files
+// included, or every package of its module.
+export type DuplicateScope = 'package' | 'module';
+
+export interface DeduplicateFunctionsOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  scope?: DuplicateScope;
+  // Replace the duplicates of each group that can be merged with calls to
+  // the function kept, and delete them; otherwise they are only reported.
+  merge?: boolean;
+  // Functions to keep when their group is merged, such as Sum, util.Sum or
+  // example.com/app/util.Sum; by default the first that the callers of the
+  // others can refer to is kept, preferring the package that declares the
+  // most of the group.
+  keep?: string[];
+  // Merge exported duplicates too, although packages outside the module
+  // may use them.
+  force?: boolean;
+  dryRun?: boolean;
+}
+
+export interface DuplicateFunction {
+  // Methods as Type.Method.
+  name: string;
+  location: string;
+  // References other than the declaration.
+  references: number;
+}
+
+export interface DuplicateGroup {
+  // In the order of their packages, files and positions.
+  functions: DuplicateFunction[];
+  // The function the others are replaced with, when the group can be
+  // merged.
+  keep?: string;
+  // Why the group cannot be merged; undefined when it can.
+  reason?: string;
+  // Functions with the same body but another signature, which are left
+  // alone, with their signatures.
+  differing: string[];
+  merged: boolean;
+}
+
+export interface DeduplicateFunctionsResult {
+  scope: DuplicateScope;
+  // The number of functions compared.
+  functions: number;
+  groups: DuplicateGroup[];
+  // References replaced with the functions kept.
+  references: number;
+  // Files that build constraints kept from being checked for references.
+  warnings: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+interface Candidate {
+  obj: GoObject;
+  decl: FuncDecl;
+  file: GoSourceFile;
+  name: string;
+  // The structure of the body, and of the signature, with local names
+  // numbered in the order they are declared.
+  body: string;
+  signature: string;
+}
+
+type Shape = (id: Ident) => string;
+
+// Node fields that hold positions or comments rather than structure.
+const IGNORED_FIELDS = new Set(['pos', 'end', 'doc', 'comment']);
+
+// Writes the structure of an AST value, naming identifiers with ident.
+// Positions are left out, except that the ... of a call is kept.
+function shapeOf(value: unknown, ident: Shape): string {
+  if (Array.isArray(value)) {
+    return `[${value.map(v => shapeOf(v, ident)).join(' ')}]`;
+  }
+  if (typeof value !== 'object' || value === null) {
+    return JSON.stringify(value);
+  }
+  const node = value as Node;
+  if (node.type === 'Ident') return ident(node);
+  const parts: string[] = [node.type];
+  for (const [key, v] of Object.entries(node)) {
+    if (key === 'type' || IGNORED_FIELDS.has(key) || v === undefined) continue;
+    if (typeof v === 'number') {
+      if (key === 'ellipsis') parts.push('...');
+      if (key === 'iota') parts.push(`iota=${v}`);
+      continue;
+    }
+    parts.push(`${key}=${shapeOf(v, ident)}`);
+  }
+  return `(${parts.join(' ')})`;
+}
+
+// Returns the shapes of the body and the signature of decl. Names declared
+// in decl, its parameters included, are numbered, and the function itself
+// is self, so that functions differing only in those names match. Other
+// names are those of the objects they refer to, and fields are named as
+// written.
+function shapes(
+  info: GoInfo,
+  fn: GoObject,
+  decl: FuncDecl
+): { body: string; signature: string } {
+  const locals = new Map<GoObject, number>();
+  const local = (obj: GoObject) =>
+    obj.file === fn.file && decl.pos <= obj.pos && obj.pos < decl.end;
+  const ident: Shape = id => {
+    if (id.name === '_') return '_';
+    const obj = info.objectOf(id);
+    if (!obj) return `?${id.name}`;
+    if (obj === fn) return 'self';
+    if (obj.isField) return `.${id.name}`;
+    if (obj.kind === 'pkgname') return `pkg(${obj.imported})`;
+    if (local(obj)) {
+      if (!locals.has(obj)) locals.set(obj, locals.size);
+      return `$${locals.get(obj)}`;
+    }
+    return obj.pos < 0
+      ? `${obj.externalPath ?? ''}.${obj.kind}.${obj.name}`
+      : `${obj.file?.filePath}:${obj.pos}`;
+  };
+  // Parameters are numbered in order, and a list such as a, b int counts
+  // as a int, b int.
+  const fields = (list: FieldList | undefined) =>
+    (list?.list ?? [])
+      .flatMap(f => {
+        f.names.forEach(ident);
+        const type = shapeOf(f.fieldType, ident);
+        return Array<string>(Math.max(f.names.length, 1)).fill(type);
+      })
+      .join(', ');
+  const { typeParams, params, results } = decl.funcType;
+  decl.recv?.list.forEach(f => f.names.forEach(ident));
+  return {
+    body: shapeOf(decl.body, ident),
+    signature: `[${fields(typeParams)}](${fields(params)}) (${fields(results)})`,
+  };
+}
+
+// Reports whether pkg imports the package importPath, directly or through
+// the packages it imports.
+function importsPackage(
+  program: GoProgram,
+  pkg: GoPackage,
+  importPath: string,
+  seen = new Set<GoPackage>()
+): boolean {
+  seen.add(pkg);
+  const paths = new Set(
+    pkg.files.flatMap(f => f.ast.imports.map(importPathOf))
+  );
+  if (paths.has(importPath)) return true;
+  return [...paths].some(path => {
+    const next = program.packageByImportPath(path);
+    return (
+      !!next &&
+      !seen.has(next) &&
+      importsPackage(program, next, importPath, seen)
+    );
+  });
+}
+
+// A reference to a duplicate, and the text that refers to the function kept
+// instead.
+interface Replacement {
+  file: GoSourceFile;
+  pos: number;
+  end: number;
+  newText: string;
+  imports: ImportRequest[];
+}
+
+// Returns the replacements of the references to the duplicates with keep,
+// or why one of them cannot refer to keep.
+function replaceWith(
+  program: GoProgram,
+  info: GoInfo,
+  keep: Candidate,
+  duplicates: Candidate[]
+): Replacement[] | string {
+  const replacements: Replacement[] = [];
+  const target = keep.obj.pkg!;
+  const inTest = keep.file.filePath.endsWith('_test.go');
+  const removed = (file: GoSourceFile, pos: number) =>
+    duplicates.some(
+      d => d.file === file && d.decl.pos <= pos && pos < d.decl.end
+    );
+  for (const dup of duplicates) {
+    for (const ref of findReferences(program, dup.obj)) {
+      if (ref.isDeclaration || removed(ref.file, ref.pos)) continue;
+      const { file } = ref;
+      const at = locationOf(file, ref.pos);
+      if (inTest && !file.filePath.endsWith('_test.go')) {
+        return `${keep.name} is declared in a test file, and ${at} uses ${dup.name} outside of tests`;
+      }
+      // A qualified reference dup.Name is replaced as a whole.
+      const path = pathEnclosingInterval(file.ast, ref.pos, ref.end);
+      const parent = path[path.length - 2];
+      const qualified =
+        parent?.type === 'SelectorExpr' &&
+        parent.sel.pos === ref.pos &&
+        parent.x.type === 'Ident' &&
+        info.objectOf(parent.x)?.kind === 'pkgname';
+      const pos = qualified ? parent.pos : ref.pos;
+      const pkg = file.pkg;
+      if (pkg === target) {
+        if (lookupAt(info, file, pos, keep.obj.name) !== keep.obj) {
+          return `${keep.obj.name} refers to another declaration at ${at}, where ${dup.name} is used`;
+        }
+        replacements.push({
+          file,
+          pos,
+          end: ref.end,
+          newText: keep.obj.name,
+          imports: [],
+        });
+        continue;
+      }
+      if (!isExported(keep.obj.name)) {
+        return `${keep.name} is not exported, and ${at} in package ${pkg.name} uses ${dup.name}`;
+      }
+      if (target.name === 'main') {
+        return `${keep.name} is declared in package main, which ${at} in package ${pkg.name} cannot import`;
+      }
+      if (!internalVisible(dirImportPath(pkg), target.importPath)) {
+        return `${target.importPath} is internal, and ${at} in package ${pkg.name} cannot import it`;
+      }
+      const imports: ImportRequest[] = [];
+      const qualifier = fileQualifier(file, imports)({
+        path: target.importPath,
+        name: target.name,
+      });
+      if (imports.length > 0) {
+        if (!pkg.isXTest && importsPackage(program, target, pkg.importPath)) {
+          return `${target.importPath} imports ${pkg.importPath}, so ${at} cannot refer to ${keep.name} without an import cycle`;
+        }
+        if (lookupAt(info, file, pos, qualifier)) {
+          return `${qualifier} refers to another declaration at ${at}, where ${dup.name} is used`;
+        }
+      }
+      replacements.push({
+        file,
+        pos,
+        end: ref.end,
+        newText: qualifier ? `${qualifier}.${keep.obj.name}` : keep.obj.name,
+        imports,
+      });
+    }
+  }
+  return replacements;
+}
+
+// Reports whether name, as given in keep, names the function of c.
+function namedBy(c: Candidate, name: string): boolean {
+  const pkg = c.obj.pkg!;
+  const names = [
+    c.name,
+    `${pkg.name}.${c.name}`,
+    `${pkg.importPath}.${c.name}`,
+  ];
+  return names.includes(name);
+}
+
+// Finds the functions whose bodies have the same structure, not counting
+// the names of their parameters and locals, and reports them in groups. A
+// group of functions, not methods, that have the same signature can be
+// merged: the references to every function but one are replaced with that
+// one, and the others are deleted.
+export async function performDeduplicateFunctions(
+  options: DeduplicateFunctionsOptions
+): Promise<DeduplicateFunctionsResult> {
+  const {
+    scope = 'package',
+    merge = false,
+    keep = [],
+    force = false,
+    dryRun = false,
+  } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const module = program.moduleOf(file.filePath);
+  const packages = program.packages.filter(pkg =>
+    scope === 'package'
+      ? pkg === file.pkg
+      : program.moduleOf(pkg.dir) === module
+  );
+
+  await step(options, 'Comparing functions');
+  const candidates: Candidate[] = [];
+  for (const pkg of packages) {
+    for (const f of pkg.files) {
+      for (const decl of f.ast.decls) {
+        if (decl.type !== 'FuncDecl' || !decl.body?.list.length) continue;
+        const obj = info.defs.get(decl.name);
+        if (!obj || obj.name === '_') continue;
+        if (!decl.recv && ['init', 'main'].includes(obj.name)) continue;
+        candidates.push({
+          obj,
+          decl,
+          file: f,
+          name: functionName(obj),
+          ...shapes(info, obj, decl),
+        });
+      }
+    }
+  }
+  const byBody = new Map<string, Candidate[]>();
+  for (const c of candidates) {
+    (byBody.get(c.body) ?? byBody.set(c.body, []).get(c.body)!).push(c);
+  }
+  const duplicates = [...byBody.values()].filter(g => g.length > 1).flat();
+  for (const name of keep) {
+    if (!duplicates.some(c => namedBy(c, name))) {
+      throw new ToolError(
+        'invalid_argument',
+        `'${name}' is not one of the duplicate functions found`
+      );
+    }
+  }
+
+  const groups: DuplicateGroup[] = [];
+  const replacements: Replacement[] = [];
+  const removals: Candidate[] = [];
+  const describe = (c: Candidate) => ({
+    name: c.name,
+    location: locationOf(c.file, c.decl.name.pos),
+    references: findReferences(program, c.obj).filter(r => !r.isDeclaration)
+      .length,
+  });
+  const signatureOf = (c: Candidate) => {
+    const t = c.decl.funcType;
+    const start = t.typeParams?.pos ?? t.params.pos;
+    return `${c.name}${c.file.src.slice(start, t.end)}`;
+  };
+
+  // Returns the group of functions with the same signature, which can be
+  // merged into the function named in keep or else, trying the exported
+  // ones and those of the package that declares the most of them first,
+  // the first that the others can be replaced with.
+  const mergeable = (
+    set: Candidate[],
+    differing: Candidate[]
+  ): DuplicateGroup => {
+    const group = (reason?: string, kept?: Candidate): DuplicateGroup => ({
+      functions: [...set, ...differing].map(describe),
+      keep: kept?.name,
+      reason,
+      differing: differing.map(signatureOf),
+      merged: false,
+    });
+    const named = set.filter(c => keep.some(k => namedBy(c, k)));
+    const rank = (c: Candidate) =>
+      (isExported(c.obj.name) ? set.length : 0) +
+      set.filter(m => m.obj.pkg === c.obj.pkg).length;
+    const order =
+      named.length > 0 ? named : [...set].sort((a, b) => rank(b) - rank(a));
+    let reason = '';
+    for (const c of order) {
+      const others = set.filter(m => m !== c);
+      const api = others.find(
+        m =>
+          isExported(m.obj.name) &&
+          m.obj.pkg!.name !== 'main' &&
+          !m.file.filePath.endsWith('_test.go')
+      );
+      const outcome =
+        api && !force
+          ? `${api.name} is exported, so code outside the module may use it; set force to merge it anyway`
+          : replaceWith(program, info, c, others);
+      if (typeof outcome === 'string') {
+        reason ||= outcome;
+        continue;
+      }
+      if (merge) {
+        replacements.push(...outcome);
+        removals.push(...others);
+      }
+      return { ...group(undefined, c), merged: merge };
+    }
+    return group(reason);
+  };
+
+  if (merge) await step(options, 'Finding references');
+  for (const members of byBody.values()) {
+    if (members.length < 2) continue;
+    const methods = members.filter(c => c.obj.recv);
+    if (methods.length > 0) {
+      const receivers = new Set(
+        methods.map(c => `${c.obj.pointerRecv ? '*' : ''}${c.obj.recv!.name}`)
+      );
+      groups.push({
+        functions: members.map(describe),
+        reason:
+          methods.length < members.length
+            ? 'methods and functions are called differently'
+            : receivers.size > 1
+              ? `they are methods of the receiver types ${[...receivers].join(', ')}, which select them`
+              : `they are methods of ${[...receivers][0]}, which interfaces may need each of`,
+        differing: [],
+        merged: false,
+      });
+      continue;
+    }
+    // Functions of another signature are listed with the first group of
+    // the body, but left alone.
+    const bySignature = new Map<string, Candidate[]>();
+    for (const c of members) {
+      const set = bySignature.get(c.signature);
+      if (set) set.push(c);
+      else bySignature.set(c.signature, [c]);
+    }
+    const sets = [...bySignature.values()];
+    const differing = sets.filter(s => s.length === 1).map(s => s[0]);
+    const same = sets.filter(s => s.length > 1);
+    if (same.length === 0) {
+      groups.push({
+        functions: members.map(describe),
+        reason: `their signatures differ: ${members.map(signatureOf).join('; ')}`,
+        differing: [],
+        merged: false,
+      });
+      continue;
+    }
+    same.forEach((set, i) =>
+      groups.push(mergeable(set, i === 0 ? differing : []))
+    );
+  }
+
+  const edits = new Map<
+    GoSourceFile,
+    { edits: TextEdit[]; imports: ImportRequest[] }
+  >();
+  const entry = (f: GoSourceFile) =>
+    edits.get(f) ?? edits.set(f, { edits: [], imports: [] }).get(f)!;
+  for (const r of replacements) {
+    const e = entry(r.file);
+    e.edits.push({ pos: r.pos, end: r.end, newText: r.newText });
+    for (const request of r.imports) {
+      if (e.imports.some(i => i.path === request.path)) continue;
+      e.imports.push(request);
+    }
+  }
+  for (const d of removals) {
+    entry(d.file).edits.push(declRemovalEdit(d.file.src, d.decl));
+  }
+  const changes = [...edits].map(([f, e]) => ({
+    filePath: f.filePath,
+    original: f.src,
+    updated: pruneImports(
+      f,
+      info,
+      applyTextEdits(f.src, [...e.edits, ...addImportEdits(f, e.imports)])
+    ),
+  }));
+
+  return {
+    scope,
+    functions: candidates.length,
+    groups,
+    references: replacements.length,
+    warnings: merge
+      ? exclusionWarnings(program, new Set(removals.map(d => d.obj.pkg!)))
+      : [],
+    changes: await commitFileChanges(changes, dryRun, options),
+    dryRun,
+  };
+}
+
+export function formatDeduplicateFunctionsResults(
+  result: DeduplicateFunctionsResult
+): string {
+  const where = result.scope === 'package' ? 'the package' : 'the module';
+  const n = result.functions;
+  const compared = `${n} function${n === 1 ? '' : 's'}`;
+  if (result.groups.length === 0) {
+    return `No duplicate functions among the ${compared} of ${where}`;
+  }
+  const count = result.groups.length;
+  const output = [
+    `Found ${count} group${count === 1 ? '' : 's'} of duplicate functions among the ${compared} of ${where}:`,
+  ];
+  result.groups.forEach((g, i) => {
+    output.push(`${i + 1}.`);
+    for (const f of g.functions) {
+      const refs = `${f.references} reference${f.references === 1 ? '' : 's'}`;
+      output.push(`  ${f.name} (${f.location}, ${refs})`);
+    }
+    if (g.differing.length > 0) {
+      const signatures = g.differing.join('; ');
+      output.push(`  Left alone, with another signature: ${signatures}`);
+    }
+    if (g.reason) output.push(`  Not merged: ${g.reason}`);
+    else if (g.merged) output.push(`  Merged into ${g.keep}`);
+    else output.push(`  Can be merged into ${g.keep}; set merge to do so`);
+  });
+  if (result.warnings.length > 0) {
+    output.push('Not checked for references, check these by hand:');
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  if (!result.groups.some(g => g.merged)) return output.join('\n');
+  const refs = result.references;
+  output.push(
+    `Replaced ${refs} reference${refs === 1 ? '' : 's'} to the merged duplicates`
+  );
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
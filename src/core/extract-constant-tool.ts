@@ -0,0 +1,240 @@
+import type {
+  BasicLit,
+  BlockStmt,
+  Decl,
+  FuncDecl,
+  FuncLit,
+  Node,
+} from '../utils/go-ast.js';
+import { inspect, pathEnclosingInterval } from '../utils/go-ast.js';
+import {
+  checkCapture,
+  checkIdentifier,
+  checkShadowing,
+  indentAt,
+  isPackageLevelName,
+  lineStart,
+} from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  locationOf,
+  resolveLocation,
+} from '../utils/go-references.js';
+import type { GoLocationInput } from '../utils/go-references.js';
+import type { GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+// Where the constant is declared, and so which occurrences of the literal
+// it replaces: those in the package or those in the enclosing function.
+export type ConstantScope = 'package' | 'function';
+
+export interface ExtractConstantOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoLocationInput {
+  filePath: string;
+  constantName: string;
+  scope?: ConstantScope;
+  dryRun?: boolean;
+}
+
+export interface ExtractConstantResult {
+  constantName: string;
+  // The literal, as written at the given location.
+  value: string;
+  // The untyped kind of the constant, such as untyped int.
+  type: string;
+  // The package or function declaring the constant.
+  declaredIn: string;
+  occurrences: number;
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+interface Occurrence {
+  file: GoSourceFile;
+  node: BasicLit;
+}
+
+// Returns the literals in root that are expressions, leaving out import
+// paths and struct tags.
+function literalsIn(root: Node): BasicLit[] {
+  const tags = new Set<Node>();
+  const lits: BasicLit[] = [];
+  inspect(root, n => {
+    if (n.type === 'ImportSpec') return false;
+    if (n.type === 'Field' && n.tag) tags.add(n.tag);
+    if (n.type === 'BasicLit' && !tags.has(n)) lits.push(n);
+  });
+  return lits;
+}
+
+export async function performExtractConstant(
+  options: ExtractConstantOptions
+): Promise<ExtractConstantResult> {
+  const { constantName: name, scope = 'package', dryRun = false } = options;
+  checkIdentifier(name);
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const checker = program.check();
+  const index = resolveLocation(file, options);
+  const path = pathEnclosingInterval(file.ast, index);
+  const lit = path[path.length - 1];
+  const parent = path[path.length - 2];
+  if (lit.type !== 'BasicLit') {
+    throw new ToolError(
+      'invalid_location',
+      `No literal at ${locationOf(file, index)}`
+    );
+  }
+  if (
+    parent?.type === 'ImportSpec' ||
+    (parent?.type === 'Field' && parent.tag === lit)
+  ) {
+    throw new ToolError(
+      'unsupported_construct',
+      'Import paths and struct tags cannot be replaced by a constant'
+    );
+  }
+
+  const text = file.src.substring(lit.pos, lit.end);
+  const valueOf = (f: GoSourceFile, l: BasicLit) =>
+    checker.constValue(l, f.scope!, { file: f });
+  const value = valueOf(file, lit);
+  const type = checker.info.typeOf(lit);
+  if (value === undefined || !type || type.kind !== 'basic') {
+    throw new ToolError('compile_error', `Invalid literal ${text}`);
+  }
+  const matches = (f: GoSourceFile, l: BasicLit) =>
+    l.kind === lit.kind && valueOf(f, l) === value;
+
+  const declaration = `const ${name} = ${text}`;
+  const occurrences: Occurrence[] = [];
+  const edits = new Map<GoSourceFile, TextEdit[]>();
+  let declaredIn: string;
+  if (scope === 'function') {
+    const func = [...path]
+      .reverse()
+      .find(
+        (n): n is FuncDecl | FuncLit =>
+          n.type === 'FuncDecl' || n.type === 'FuncLit'
+      );
+    const body: BlockStmt | undefined = func?.body;
+    if (!func || !body || lit.pos < body.pos) {
+      throw new ToolError(
+        'unsupported_construct',
+        `The literal at ${locationOf(file, lit.pos)} is not in a function body`
+      );
+    }
+    declaredIn =
+      func.type === 'FuncDecl'
+        ? `func ${func.name.name}`
+        : `the function literal at ${locationOf(file, func.pos)}`;
+    for (const l of literalsIn(body)) {
+      if (matches(file, l)) occurrences.push({ file, node: l });
+    }
+    // Parameters and results share the scope of the body.
+    const funcScope = checker.info.scopes.get(body);
+    const existing = funcScope?.lookup(name);
+    if (existing) {
+      throw new ToolError(
+        'name_conflict',
+        `'${name}' is already declared in ${declaredIn} at ${locationOf(file, existing.pos)}`,
+        errorLocation(file, existing.pos)
+      );
+    }
+    checkShadowing(checker.info, occurrences, funcScope, name);
+    checkCapture(checker.info, [{ file, node: body }], name);
+
+    const [first] = body.list;
+    const start = lineStart(file.src, first.pos);
+    edits.set(file, [
+      first.pos > file.src.indexOf('\n', body.pos)
+        ? {
+            pos: start,
+            end: start,
+            newText: `${indentAt(file.src, first.pos)}${declaration}\n`,
+          }
+        : { pos: first.pos, end: first.pos, newText: `${declaration}; ` },
+    ]);
+  } else {
+    const pkg = file.pkg;
+    declaredIn = `package ${pkg.name}`;
+    for (const f of pkg.files) {
+      for (const l of literalsIn(f.ast)) {
+        if (matches(f, l)) occurrences.push({ file: f, node: l });
+      }
+    }
+    if (isPackageLevelName(pkg, name)) {
+      const existing =
+        pkg.scope?.lookup(name) ??
+        pkg.files.map(f => f.scope?.lookup(name)).find(Boolean)!;
+      const at = existing.file
+        ? ` at ${locationOf(existing.file, existing.pos)}`
+        : '';
+      throw new ToolError(
+        'name_conflict',
+        `'${name}' is already declared in ${declaredIn}${at}`,
+        existing.file && errorLocation(existing.file, existing.pos)
+      );
+    }
+    checkShadowing(checker.info, occurrences, pkg.scope, name);
+    checkCapture(
+      checker.info,
+      pkg.files.map(f => ({ file: f, node: f.ast })),
+      name
+    );
+
+    // The constant goes before the declaration using the literal.
+    const decl = file.ast.decls.find(
+      (d: Decl) => d.pos <= lit.pos && lit.end <= d.end
+    )!;
+    const pos = lineStart(file.src, decl.doc?.pos ?? decl.pos);
+    edits.set(file, [{ pos, end: pos, newText: `${declaration}\n\n` }]);
+  }
+
+  for (const { file: f, node: l } of occurrences) {
+    if (!edits.has(f)) edits.set(f, []);
+    edits.get(f)!.push({ pos: l.pos, end: l.end, newText: name });
+  }
+  const changes = await commitFileChanges(
+    [...edits].map(([f, fileEdits]) => ({
+      filePath: f.filePath,
+      original: f.src,
+      updated: applyTextEdits(f.src, fileEdits),
+    })),
+    dryRun,
+    options
+  );
+
+  return {
+    constantName: name,
+    value: text,
+    type: type.name,
+    declaredIn,
+    occurrences: occurrences.length,
+    changes,
+    dryRun,
+  };
+}
+
+export function formatExtractConstantResults(
+  result: ExtractConstantResult
+): string {
+  const occurrences =
+    result.occurrences === 1
+      ? '1 occurrence'
+      : `${result.occurrences} occurrences`;
+  return `Extracted constant '${result.constantName}' = ${result.value} (${result.type}) in ${result.declaredIn}, replacing ${occurrences}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,835 @@
+import type {
+  BranchStmt,
+  FuncDecl,
+  FuncLit,
+  Ident,
+  Node,
+  ReturnStmt,
+  Stmt,
+} from '../utils/go-ast.js';
+import {
+  children,
+  inspect,
+  isExported,
+  pathEnclosingInterval,
+  unparen,
+} from '../utils/go-ast.js';
+import {
+  collectWrites,
+  isLocal,
+  statementsOf,
+} from '../utils/go-analysis.js';
+import type { StmtList } from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  addImportEdits,
+  checkIdentifier,
+  fileQualifier,
+  indentAt,
+  isPackageLevelName,
+  lineEnd,
+  lineStart,
+  onlyComments,
+  reindent,
+  zeroOf,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import { errorLocation, locationOf } from '../utils/go-references.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import {
+  defaultType,
+  lookupFieldOrMethod,
+  typeContains,
+  typeString,
+} from '../utils/go-types.js';
+import type {
+  GoObject,
+  GoSourceFile,
+  Scope,
+  Type,
+} from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { displayPath } from '../utils/file-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ExtractFunctionOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  startLine: number;
+  endLine: number;
+  functionName: string;
+  dryRun?: boolean;
+}
+
+export interface ExtractFunctionResult {
+  filePath: string;
+  functionName: string;
+  signature: string;
+  parameters: string[];
+  results: string[];
+  // Why extract_method made a function rather than a method, if it did.
+  fallback?: string;
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+interface StatementSelection {
+  // The selected range without surrounding whitespace.
+  start: number;
+  end: number;
+  stmts: Stmt[];
+  container: StmtList;
+  // Enclosing nodes from the file down to the container.
+  path: Node[];
+  func: FuncDecl | FuncLit;
+  decl: Node;
+}
+
+const NOT_STATEMENTS =
+  'The selected lines must contain complete statements of a single block';
+
+// Returns where the comment on the lines just above pos starts, or pos if
+// there is none after floor. Such a comment documents the statement at pos
+// and moves with it.
+function docStart(file: GoSourceFile, pos: number, floor: number): number {
+  const doc = file.ast.comments.find(
+    g =>
+      g.pos >= floor &&
+      /^[ \t]*\n[ \t]*$/.test(file.src.substring(g.end, pos)) &&
+      file.src.substring(lineStart(file.src, g.pos), g.pos).trim() === ''
+  );
+  return doc ? doc.pos : pos;
+}
+
+// Finds the statements covered by [pos, end). The range may include
+// surrounding whitespace and comments but no partial statements. A comment
+// just above the first statement is included.
+function selectStatements(
+  file: GoSourceFile,
+  pos: number,
+  end: number
+): StatementSelection {
+  while (pos < end && /\s/.test(file.src[pos])) pos++;
+  while (end > pos && /\s/.test(file.src[end - 1])) end--;
+  if (pos >= end) {
+    throw new ToolError(
+      'invalid_location',
+      'The selected lines contain no statements'
+    );
+  }
+
+  const path = pathEnclosingInterval(file.ast, pos, end);
+  for (let i = path.length - 1; i >= 0; i--) {
+    const node = path[i];
+    if (
+      node.type !== 'BlockStmt' &&
+      node.type !== 'CaseClause' &&
+      node.type !== 'CommClause'
+    ) {
+      continue;
+    }
+    const list = statementsOf(node);
+    const stmts = list.filter(s => s.pos >= pos && s.end <= end);
+    if (
+      stmts.length === 0 ||
+      list.some(s => s.pos < end && s.end > pos && !stmts.includes(s)) ||
+      !onlyComments(file, pos, stmts[0].pos) ||
+      !onlyComments(file, stmts[stmts.length - 1].end, end)
+    ) {
+      continue;
+    }
+    const func = path
+      .slice(0, i)
+      .reverse()
+      .find(
+        (n): n is FuncDecl | FuncLit =>
+          n.type === 'FuncDecl' || n.type === 'FuncLit'
+      );
+    if (!func) break;
+    const opening = node.type === 'BlockStmt' ? node.lbrace : node.colon;
+    const previous = list[list.indexOf(stmts[0]) - 1];
+    return {
+      start: docStart(file, pos, previous ? previous.end : opening + 1),
+      end,
+      stmts,
+      container: node,
+      path: path.slice(0, i + 1),
+      func,
+      decl: path[1],
+    };
+  }
+  throw new ToolError('ambiguous_location', NOT_STATEMENTS);
+}
+
+const BRANCH_TARGETS: Partial<Record<Node['type'], string>> = {
+  ForStmt: 'for loop',
+  RangeStmt: 'for loop',
+  SwitchStmt: 'switch statement',
+  TypeSwitchStmt: 'switch statement',
+  SelectStmt: 'select statement',
+};
+
+// Rejects statements whose control flow would change once they are moved
+// into a function of their own. Returns the return statements, which the
+// new function hands on to the caller.
+function checkControlFlow(
+  info: GoInfo,
+  file: GoSourceFile,
+  selection: StatementSelection,
+  pos: number,
+  end: number
+): ReturnStmt[] {
+  interface Flow {
+    loop: boolean;
+    breakable: boolean;
+    inSwitch: boolean;
+  }
+  const lineOf = (at: number) => errorLocation(file, at).line;
+  const refuse = (n: BranchStmt, why: string): never => {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot extract the ${n.tok} at ${locationOf(file, n.pos)}, which ${why}`,
+      errorLocation(file, n.pos)
+    );
+  };
+  const returns: ReturnStmt[] = [];
+  const visit = (n: Node, flow: Flow): void => {
+    switch (n.type) {
+      case 'FuncLit':
+        return;
+      case 'ReturnStmt':
+        returns.push(n);
+        break;
+      case 'DeferStmt':
+        throw new ToolError(
+          'unsupported_construct',
+          'Cannot extract statements containing a defer statement, which would run when the new function returns'
+        );
+      case 'BranchStmt': {
+        if (n.label) {
+          const label = info.uses.get(n.label);
+          if (label && label.pos >= pos && label.pos < end) return;
+          const jump =
+            n.tok === 'goto'
+              ? 'jumps to the label'
+              : n.tok === 'break'
+                ? 'leaves the statement labeled'
+                : 'continues the loop labeled';
+          const where = label ? ` at line ${lineOf(label.pos)}` : '';
+          refuse(
+            n,
+            `${jump} '${n.label.name}'${where} outside the selection`
+          );
+        }
+        const ok =
+          n.tok === 'break'
+            ? flow.breakable
+            : n.tok === 'continue'
+              ? flow.loop
+              : flow.inSwitch;
+        if (ok) return;
+        if (n.tok === 'fallthrough') {
+          refuse(n, 'enters the next case outside the selection');
+        }
+        // The statement left is the innermost enclosing one outside.
+        const target = [...selection.path]
+          .reverse()
+          .find(t =>
+            n.tok === 'break'
+              ? BRANCH_TARGETS[t.type]
+              : t.type === 'ForStmt' || t.type === 'RangeStmt'
+          );
+        if (!target) refuse(n, 'leaves the selection');
+        const verb = n.tok === 'break' ? 'leaves' : 'continues';
+        refuse(
+          n,
+          `${verb} the ${BRANCH_TARGETS[target!.type]} at line ${lineOf(target!.pos)} outside the selection`
+        );
+      }
+      case 'ForStmt':
+      case 'RangeStmt':
+        flow = { ...flow, loop: true, breakable: true };
+        break;
+      case 'SwitchStmt':
+        flow = { ...flow, breakable: true, inSwitch: true };
+        break;
+      case 'TypeSwitchStmt':
+      case 'SelectStmt':
+        flow = { ...flow, breakable: true };
+        break;
+    }
+    for (const child of children(n)) visit(child, flow);
+  };
+  for (const s of selection.stmts) {
+    visit(s, { loop: false, breakable: false, inSwitch: false });
+  }
+
+  // Labels declared in the selection must not be targeted from outside.
+  inspect(selection.decl, n => {
+    if (n.type !== 'BranchStmt' || !n.label) return;
+    if (n.pos >= pos && n.pos < end) return;
+    const label = info.uses.get(n.label);
+    if (label && label.pos >= pos && label.pos < end) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot extract the label '${n.label.name}', which the ${n.tok} at ${locationOf(file, n.pos)} outside the selection refers to`,
+        errorLocation(file, n.pos)
+      );
+    }
+  });
+  return returns;
+}
+
+interface Reference {
+  ident: Ident;
+  isDef: boolean;
+}
+
+interface Variable {
+  obj: GoObject;
+  name: string;
+  inside: Reference[];
+  outside: Reference[];
+  declaredInside: boolean;
+}
+
+function checkTypeAccessible(
+  file: GoSourceFile,
+  name: string,
+  t: Type | undefined
+): void {
+  if (!t || typeContains(t, x => x.kind === 'invalid')) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Could not determine the type of '${name}'`
+    );
+  }
+  typeContains(t, x => {
+    if (x.kind !== 'named') return false;
+    if (isLocal(x.obj)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot extract code using '${name}', whose type ${x.obj.name} is declared inside the function`
+      );
+    }
+    if (x.obj.pkg && x.obj.pkg !== file.pkg && !isExported(x.obj.name)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot extract code using '${name}', whose type ${x.obj.name} is not exported by its package`
+      );
+    }
+    return false;
+  });
+}
+
+// Returns the results of the function the selection is in.
+function enclosingResults(
+  info: GoInfo,
+  selection: StatementSelection
+): GoObject[] {
+  const { func } = selection;
+  const t =
+    func.type === 'FuncDecl'
+      ? info.defs.get(func.name)?.type
+      : info.typeOf(func);
+  if (t?.kind !== 'signature') {
+    throw new ToolError(
+      'unsupported_construct',
+      'Could not determine the results of the enclosing function'
+    );
+  }
+  return t.results;
+}
+
+function isErrorType(t: Type): boolean {
+  return t.kind === 'named' && t.obj.name === 'error' && t.obj.pos < 0;
+}
+
+// Type parameters of the enclosing declaration, including those of a
+// generic receiver, which the new function has to redeclare.
+function typeParameters(
+  info: GoInfo,
+  file: GoSourceFile,
+  decl: Node
+): { names: string[]; text: string } | undefined {
+  if (decl.type !== 'FuncDecl') return undefined;
+  const names: string[] = [];
+  const parts: string[] = [];
+  const recv = decl.recv?.list[0];
+  if (recv) {
+    let t = unparen(recv.fieldType);
+    if (t.type === 'StarExpr') t = unparen(t.x);
+    if (t.type === 'IndexExpr') {
+      // Receiver type parameters take their constraints from the type
+      // declaration, matched by position.
+      const base = unparen(t.x);
+      const obj = base.type === 'Ident' ? info.uses.get(base) : undefined;
+      const constraints: string[] = [];
+      if (obj?.decl?.type === 'TypeSpec' && obj.file) {
+        for (const field of obj.decl.typeParams?.list ?? []) {
+          const text = obj.file.src.substring(
+            field.fieldType.pos,
+            field.fieldType.end
+          );
+          for (let k = 0; k < field.names.length; k++) constraints.push(text);
+        }
+      }
+      t.indices.forEach((index, k) => {
+        if (index.type !== 'Ident') return;
+        names.push(index.name);
+        parts.push(`${index.name} ${constraints[k] ?? 'any'}`);
+      });
+    }
+  }
+  for (const field of decl.funcType.typeParams?.list ?? []) {
+    names.push(...field.names.map(n => n.name));
+    parts.push(file.src.substring(field.pos, field.end));
+  }
+  if (names.length === 0) return undefined;
+  return { names, text: `[${parts.join(', ')}]` };
+}
+
+function isTypeParam(obj: GoObject): boolean {
+  return obj.kind === 'type' && obj.type?.kind === 'typeparam';
+}
+
+// Formats parameters, grouping consecutive ones of the same type.
+function formatParameters(params: { name: string; type: string }[]): string {
+  const groups: string[] = [];
+  params.forEach((p, i) => {
+    const next = params[i + 1];
+    groups.push(next && next.type === p.type ? p.name : `${p.name} ${p.type}`);
+  });
+  return groups.join(', ');
+}
+
+function formatResults(types: string[]): string {
+  if (types.length === 0) return '';
+  return types.length === 1 ? ` ${types[0]}` : ` (${types.join(', ')})`;
+}
+
+// Rejects names that a new top-level function cannot have or that a local
+// declaration would hide at the call site.
+function checkFunctionName(
+  file: GoSourceFile,
+  scope: Scope | undefined,
+  name: string
+): void {
+  if (isPackageLevelName(file.pkg, name)) {
+    throw new ToolError(
+      'name_conflict',
+      `'${name}' is already declared in package ${file.pkg.name}`
+    );
+  }
+  const shadow = scope?.lookupParent(name);
+  if (shadow && isLocal(shadow)) {
+    throw new ToolError(
+      'name_conflict',
+      `The local ${shadow.kind} '${name}' would shadow the new function at the call site`
+    );
+  }
+}
+
+// Returns the receiver of the method decl, if it is a named one.
+function receiverOf(
+  info: GoInfo,
+  file: GoSourceFile,
+  decl: Node
+): { obj: GoObject; typeText: string; method: string } | undefined {
+  if (decl.type !== 'FuncDecl') return undefined;
+  const field = decl.recv?.list[0];
+  const name = field?.names[0];
+  const obj = name && info.defs.get(name);
+  if (!field || !obj) return undefined;
+  return {
+    obj,
+    typeText: file.src.substring(field.fieldType.pos, field.fieldType.end),
+    method: decl.name.name,
+  };
+}
+
+export async function performExtractFunction(
+  options: ExtractFunctionOptions
+): Promise<ExtractFunctionResult> {
+  return extract(options, false);
+}
+
+// Extracts the statements into a method of the receiver of the enclosing
+// method when they use it, and into a function otherwise.
+export async function performExtractMethod(
+  options: ExtractFunctionOptions
+): Promise<ExtractFunctionResult> {
+  return extract(options, true);
+}
+
+async function extract(
+  options: ExtractFunctionOptions,
+  asMethod: boolean
+): Promise<ExtractFunctionResult> {
+  const { startLine, endLine, functionName, dryRun = false } = options;
+  checkIdentifier(functionName);
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const lineCount = file.lineStarts.length;
+  if (startLine < 1 || endLine < startLine || endLine > lineCount) {
+    throw new ToolError(
+      'invalid_location',
+      `Invalid line range ${startLine}-${endLine}`
+    );
+  }
+  const info = program.check().info;
+  const selection = selectStatements(
+    file,
+    file.lineStarts[startLine - 1],
+    endLine < lineCount ? file.lineStarts[endLine] : file.src.length
+  );
+  const { stmts, container, decl } = selection;
+  const pos = stmts[0].pos;
+  const end = stmts[stmts.length - 1].end;
+  const returns = checkControlFlow(info, file, selection, pos, end);
+  // Statements ending in a return leave the enclosing function, whose
+  // results the new function returns as they are. A return elsewhere makes
+  // the new function report whether it was taken, for the caller to check.
+  const alwaysReturns = stmts[stmts.length - 1].type === 'ReturnStmt';
+  const exits = returns.length > 0 && !alwaysReturns;
+  const exitResults =
+    returns.length > 0 ? enclosingResults(info, selection) : [];
+  for (const r of returns) {
+    if (r.results.length === 0 && exitResults.some(v => v.name !== '')) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot extract the return at ${locationOf(file, r.pos)}, which returns the named results of the enclosing function`,
+        errorLocation(file, r.pos)
+      );
+    }
+    if (exits && r.results.length === 1 && exitResults.length > 1) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot extract the return at ${locationOf(file, r.pos)}, which returns the results of a call; assign them to variables first`,
+        errorLocation(file, r.pos)
+      );
+    }
+  }
+
+  const scope = info.scopes.get(container);
+  if (!asMethod) checkFunctionName(file, scope, functionName);
+
+  // Gather every local variable referenced in the selection together with
+  // its references inside and outside of it.
+  const variables = new Map<GoObject, Variable>();
+  const topLevelNames = new Set<string>();
+  const usedNames = new Set<string>([functionName]);
+  const declNames = new Set<string>([functionName]);
+  let usesTypeParams = false;
+  inspect(decl, n => {
+    if (n.type !== 'Ident') return;
+    const isDef = info.defs.has(n);
+    const obj = info.defs.get(n) ?? info.uses.get(n);
+    const inside = n.pos >= pos && n.end <= end;
+    if (inside) usedNames.add(n.name);
+    declNames.add(n.name);
+    if (!obj || !isLocal(obj) || obj.file !== file) return;
+    const declaredInside = obj.pos >= pos && obj.pos < end;
+    if (inside && isDef && obj.parent === scope) topLevelNames.add(obj.name);
+    if (isTypeParam(obj)) {
+      if (inside) usesTypeParams = true;
+      return;
+    }
+    if (obj.kind !== 'var') {
+      if (inside && !declaredInside && obj.kind !== 'label') {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot extract code using the local ${obj.kind} '${obj.name}' declared outside the selection`
+        );
+      }
+      return;
+    }
+    let v = variables.get(obj);
+    if (!v) {
+      v = { obj, name: obj.name, inside: [], outside: [], declaredInside };
+      variables.set(obj, v);
+    }
+    (inside ? v.inside : v.outside).push({ ident: n, isDef });
+  });
+
+  // A variable is live after the selection if it is referenced later, or
+  // on the next iteration of a loop declared outside of.
+  const loops = selection.path.flatMap(n =>
+    n.type === 'ForStmt' || n.type === 'RangeStmt' ? [n] : []
+  );
+  const namedResults = new Set<GoObject>();
+  for (const n of selection.path) {
+    if (n.type !== 'FuncDecl' && n.type !== 'FuncLit') continue;
+    for (const field of n.funcType.results?.list ?? []) {
+      for (const name of field.names) {
+        const obj = info.defs.get(name);
+        if (obj) namedResults.add(obj);
+      }
+    }
+  }
+  const usedAfter = (v: Variable) =>
+    !alwaysReturns &&
+    (namedResults.has(v.obj) ||
+    v.outside.some(r => r.ident.pos >= end) ||
+    loops.some(
+      loop =>
+        v.obj.pos < loop.body.pos &&
+        v.outside.some(
+          r => r.ident.pos >= loop.pos && r.ident.pos < loop.end
+        )
+      ));
+
+  // Classify the variables: those flowing in become parameters, those
+  // flowing out become results. A variable that is overwritten before it
+  // is read only needs to be declared in the new function.
+  const writes = collectWrites(info, stmts);
+  const params: Variable[] = [];
+  const results: Variable[] = [];
+  const locals: Variable[] = [];
+  const ordered = [...variables.values()]
+    .filter(v => v.inside.length > 0)
+    .sort((a, b) => a.inside[0].ident.pos - b.inside[0].ident.pos);
+  for (const v of ordered) {
+    if (v.declaredInside) {
+      if (v.obj.parent === scope && usedAfter(v)) results.push(v);
+      continue;
+    }
+    const modified = v.inside.some(r => writes.modified.has(r.ident));
+    const live = modified && usedAfter(v);
+    if (live) results.push(v);
+    const first = v.inside[0].ident;
+    const firstStmt = stmts.find(s => s.pos <= first.pos && first.pos < s.end);
+    const assignedFirst =
+      firstStmt?.type === 'AssignStmt' &&
+      v.inside
+        .filter(r => r.ident.pos < firstStmt.end)
+        .every(r => writes.overwritten.has(r.ident));
+    if (live && assignedFirst) {
+      locals.push(v);
+    } else {
+      params.push(v);
+    }
+  }
+
+  // The receiver of the enclosing method becomes that of the new method if
+  // the statements read it; fields and methods reached through it need no
+  // parameters of their own.
+  const receiver = asMethod ? receiverOf(info, file, decl) : undefined;
+  const recv = receiver && variables.get(receiver.obj);
+  const isMethod = !!recv && params.includes(recv);
+  let fallback: string | undefined;
+  if (isMethod) {
+    params.splice(params.indexOf(recv), 1);
+    const clash = lookupFieldOrMethod(receiver.obj.type!, functionName);
+    if (clash) {
+      throw new ToolError(
+        'name_conflict',
+        `The receiver type ${receiver.typeText} already has a ${clash.kind} named ${functionName}`
+      );
+    }
+  } else if (asMethod) {
+    checkFunctionName(file, scope, functionName);
+    fallback = receiver
+      ? `The statements do not use the receiver ${receiver.obj.name} of ${receiver.method}, so ${functionName} is a function`
+      : `The statements are not in a method, so ${functionName} is a function`;
+  }
+
+  // Parameters may not collide with names the moved statements declare.
+  const renames: TextEdit[] = [];
+  for (const v of [...params, ...locals, ...(isMethod ? [recv] : [])]) {
+    if (!topLevelNames.has(v.name)) continue;
+    let k = 1;
+    while (usedNames.has(`${v.obj.name}${k}`)) k++;
+    v.name = `${v.obj.name}${k}`;
+    usedNames.add(v.name);
+    for (const r of v.inside) {
+      renames.push({ pos: r.ident.pos, end: r.ident.end, newText: v.name });
+    }
+  }
+
+  const missing: ImportRequest[] = [];
+  const qualifier = fileQualifier(file, missing);
+  const typeOf = (v: Variable): string => {
+    const t = v.obj.type && defaultType(v.obj.type);
+    checkTypeAccessible(file, v.obj.name, t);
+    if (typeContains(t!, x => x.kind === 'typeparam')) usesTypeParams = true;
+    return typeString(t!, qualifier);
+  };
+  const paramList = params.map(v => ({ name: v.name, type: typeOf(v) }));
+  const outTypes = results.map(typeOf);
+  const exitTypes = exitResults.map((v, i) => {
+    checkTypeAccessible(file, v.name || `result ${i + 1}`, v.type);
+    if (typeContains(v.type!, x => x.kind === 'typeparam')) {
+      usesTypeParams = true;
+    }
+    return typeString(v.type!, qualifier);
+  });
+  const zeros = (vars: GoObject[], types: string[]) =>
+    vars.map((v, i) => zeroOf(v.type!, types[i]) ?? `*new(${types[i]})`);
+  const resultTypes = alwaysReturns
+    ? exitTypes
+    : exits
+      ? [...outTypes, ...exitTypes, 'bool']
+      : outTypes;
+
+  // Returns hand on the results of the enclosing function after zero
+  // values for those of the statements, and report that they were taken.
+  const flowEdits: TextEdit[] = [];
+  if (exits) {
+    const outZeros = zeros(results.map(v => v.obj), outTypes);
+    for (const r of returns) {
+      const after = r.pos + 'return'.length;
+      if (r.results.length === 0) {
+        const values = [...outZeros, 'true'].join(', ');
+        flowEdits.push({ pos: after, end: after, newText: ` ${values}` });
+        continue;
+      }
+      if (outZeros.length > 0) {
+        const values = outZeros.join(', ');
+        flowEdits.push({ pos: after, end: after, newText: ` ${values},` });
+      }
+      const last = r.results[r.results.length - 1].end;
+      flowEdits.push({ pos: last, end: last, newText: ', true' });
+    }
+  }
+  const localDecls = locals.map(v => `\tvar ${v.name} ${typeOf(v)}\n`);
+
+  // A method takes the type parameters of a generic receiver with the
+  // receiver type as written.
+  const typeParams =
+    usesTypeParams && !isMethod ? typeParameters(info, file, decl) : undefined;
+  const head = isMethod
+    ? `(${recv.name} ${receiver!.typeText}) ${functionName}`
+    : `${functionName}${typeParams?.text ?? ''}`;
+  const signature =
+    `func ${head}` +
+    `(${formatParameters(paramList)})${formatResults(resultTypes)}`;
+
+  // The call replacing the statements. New variables can be declared with
+  // := unless an assigned variable lives in an enclosing scope, which :=
+  // would shadow.
+  const indent = indentAt(file.src, pos);
+  const callee = isMethod
+    ? `${recv.obj.name}.${functionName}`
+    : typeParams
+      ? `${functionName}[${typeParams.names.join(', ')}]`
+      : functionName;
+  let call = `${callee}(${params.map(v => v.obj.name).join(', ')})`;
+  let prelude = '';
+  let check = '';
+  // The caller keeps what a return taken in the new function hands on in
+  // temporaries named after nothing in the enclosing declaration.
+  const fresh = (base: string) => {
+    let name = base;
+    for (let k = 1; declNames.has(name); k++) name = `${base}${k}`;
+    declNames.add(name);
+    return name;
+  };
+  const temps = exits
+    ? exitResults.map(v => fresh(isErrorType(v.type!) ? 'err' : 'ret'))
+    : [];
+  const done = exits ? fresh('done') : undefined;
+  const exitValues = temps.join(', ');
+  const exitReturn = exitValues ? `return ${exitValues}` : 'return';
+  if (alwaysReturns) {
+    call =
+      exitResults.length > 0 ? `return ${call}` : `${call}\n${indent}return`;
+  } else if (done && results.length === 0) {
+    call =
+      temps.length > 0
+        ? `if ${exitValues}, ${done} := ${call}; ${done} {`
+        : `if ${call} {`;
+    check = `\n${indent}\t${exitReturn}\n${indent}}`;
+  } else if (results.length > 0) {
+    const temporaries = done
+      ? [
+          ...temps.map((name, i) => ({ name, type: exitTypes[i] })),
+          { name: done, type: 'bool' },
+        ]
+      : [];
+    const lhs = [
+      ...results.map(v => v.obj.name),
+      ...temporaries.map(t => t.name),
+    ].join(', ');
+    const declared = [
+      ...results
+        .filter(v => v.declaredInside)
+        .map(v => ({ name: v.obj.name, type: typeOf(v) })),
+      ...temporaries,
+    ];
+    if (declared.length === 0) {
+      call = `${lhs} = ${call}`;
+    } else if (results.every(v => v.declaredInside || v.obj.parent === scope)) {
+      call = `${lhs} := ${call}`;
+    } else {
+      prelude = declared
+        .map(v => `${indent}var ${v.name} ${v.type}\n`)
+        .join('');
+      call = `${lhs} = ${call}`;
+    }
+    if (done) {
+      check = `\n${indent}if ${done} {\n${indent}\t${exitReturn}\n${indent}}`;
+    }
+  }
+
+  const cutStart = lineStart(file.src, selection.start);
+  const cutEnd = lineEnd(file.src, selection.end - 1);
+  const body = reindent(file, cutStart, cutEnd, indent, '\t', [
+    ...renames,
+    ...flowEdits,
+  ]);
+  const values = [
+    ...results.map(v => v.name),
+    ...(exits ? [...zeros(exitResults, exitTypes), 'false'] : []),
+  ];
+  const ret = values.length > 0 ? `\treturn ${values.join(', ')}\n` : '';
+  const funcText = `${signature} {\n${localDecls.join('')}${body}${ret}}`;
+
+  // A comment after the closing brace of the enclosing declaration stays
+  // with it rather than following the new function.
+  const rest = lineEnd(file.src, decl.end);
+  const after =
+    file.src[rest - 1] === '\n' && onlyComments(file, decl.end, rest)
+      ? rest - 1
+      : decl.end;
+  const updated = applyTextEdits(file.src, [
+    ...addImportEdits(file, missing),
+    {
+      pos: cutStart,
+      end: cutEnd,
+      newText: `${prelude}${indent}${call}${check}\n`,
+    },
+    { pos: after, end: after, newText: `\n\n${funcText}` },
+  ]);
+  const changes = await commitFileChanges(
+    [{ filePath: file.filePath, original: file.src, updated }],
+    dryRun,
+    options
+  );
+
+  return {
+    filePath: displayPath(file.filePath),
+    functionName,
+    signature,
+    parameters: paramList.map(p => `${p.name} ${p.type}`),
+    results: resultTypes,
+    fallback,
+    changes,
+    dryRun,
+  };
+}
+
+export function formatExtractFunctionResults(
+  result: ExtractFunctionResult
+): string {
+  const fallback = result.fallback ? `\n${result.fallback}` : '';
+  return `Extracted ${result.signature} in ${result.filePath}${fallback}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,395 @@
+import type { Expr, Field, FuncType, GenDecl } from '../utils/go-ast.js';
+import { isExported, pathEnclosingInterval } from '../utils/go-ast.js';
+import {
+  addImportEdits,
+  checkIdentifier,
+  fileQualifier,
+  isPackageLevelName,
+  lineEnd,
+  transplant,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { GoProgram, LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  findReferences,
+  locationOf,
+} from '../utils/go-references.js';
+import { identical, methodSet, typeString, under } from '../utils/go-types.js';
+import type {
+  GoObject,
+  GoPackage,
+  GoSourceFile,
+  MethodSetEntry,
+  Qualifier,
+} from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ExtractInterfaceOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  // A type declared in the package of filePath.
+  typeName: string;
+  interfaceName: string;
+  // The methods to declare, in order. Defaults to every exported method,
+  // including those promoted from embedded fields. Unexported methods are
+  // only included when listed here.
+  methods?: string[];
+  // Parameters and struct fields of the same package whose type T or *T
+  // becomes the interface, written as Func.param, Type.Method.param or
+  // Struct.field.
+  replace?: string[];
+  dryRun?: boolean;
+}
+
+export interface ExtractInterfaceResult {
+  interfaceName: string;
+  // The type that implements the interface: T, or *T when some of the
+  // methods have pointer receivers.
+  implementedBy: string;
+  methods: string[];
+  replaced: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// A parameter or struct field to retype, with the field declaring it.
+interface Replacement {
+  name: string;
+  obj: GoObject;
+  field: Field;
+}
+
+function selectMethods(
+  typeObj: GoObject,
+  names: string[] | undefined
+): MethodSetEntry[] {
+  const all = methodSet(typeObj.type!);
+  if (!names) {
+    const exported = all.filter(m => isExported(m.obj.name));
+    if (exported.length === 0) {
+      throw new ToolError(
+        'unsupported_construct',
+        `'${typeObj.name}' has no exported methods`
+      );
+    }
+    return exported;
+  }
+  if (names.length === 0) {
+    throw new ToolError(
+      'invalid_argument',
+      'At least one method must be selected'
+    );
+  }
+  return names.map((name, i) => {
+    if (names.indexOf(name) !== i) {
+      throw new ToolError(
+        'invalid_argument',
+        `Method '${name}' is listed more than once`
+      );
+    }
+    const m = all.find(x => x.obj.name === name);
+    if (!m) {
+      throw new ToolError(
+        'symbol_not_found',
+        `'${typeObj.name}' has no method '${name}'`
+      );
+    }
+    return m;
+  });
+}
+
+function methodFuncType(m: GoObject): FuncType {
+  const decl = m.decl;
+  if (decl?.type === 'FuncDecl') return decl.funcType;
+  if (decl?.type === 'Field' && decl.fieldType.type === 'FuncType') {
+    return decl.fieldType;
+  }
+  throw new ToolError(
+    'symbol_not_found',
+    `Cannot find the declaration of method '${m.name}'`
+  );
+}
+
+// Returns the interface method spec for method obj with its doc comment,
+// as written in the method declaration but qualified for file.
+function methodSpec(
+  program: GoProgram,
+  file: GoSourceFile,
+  obj: GoObject,
+  qualifier: Qualifier
+): string {
+  const origin = obj.file;
+  if (!origin) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Method '${obj.name}' is declared outside the module`
+    );
+  }
+  if (!isExported(obj.name) && origin.pkg !== file.pkg) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Method '${obj.name}' is promoted from package ${origin.pkg.name} and unexported, so an interface in package ${file.pkg.name} cannot declare it`
+    );
+  }
+  if (obj.recv?.typeParams?.length) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Method '${obj.name}' is promoted from the generic type ${obj.recv.name}, which is not supported`
+    );
+  }
+  const ft = methodFuncType(obj);
+  const text = origin.src.substring(ft.params.pos, ft.end);
+  let sig = text;
+  if (origin !== file) {
+    sig = transplant(
+      program,
+      new Map(),
+      `func${text}`,
+      origin,
+      file,
+      undefined,
+      qualifier
+    ).substring('func'.length);
+  }
+  const doc = obj.decl && 'doc' in obj.decl ? obj.decl.doc : undefined;
+  const lines = doc ? doc.list.map(c => `\t${c.text}\n`) : [];
+  lines.push(`\t${obj.name}${sig.replace(/\n/g, '\n\t')}\n`);
+  return lines.join('');
+}
+
+function typeDecl(file: GoSourceFile, obj: GoObject): GenDecl {
+  const decl = file.ast.decls.find(
+    (d): d is GenDecl =>
+      d.type === 'GenDecl' && d.pos <= obj.pos && obj.pos < d.end
+  );
+  if (!decl) throw new ToolError(
+    'symbol_not_found',
+    `Cannot find the declaration of '${obj.name}'`
+  );
+  return decl;
+}
+
+function fieldOf(fields: Field[], name: string): Field | undefined {
+  return fields.find(f => f.names.some(id => id.name === name));
+}
+
+// Resolves a replacement entry to the declaration of the parameter or
+// field it names.
+function resolveReplacement(
+  program: GoProgram,
+  pkg: GoPackage,
+  entry: string
+): Replacement {
+  const info = program.check().info;
+  const parts = entry.split('.');
+  const owner = pkg.scope?.lookup(parts[0]);
+  let field: Field | undefined;
+  const name = parts[parts.length - 1];
+  if (parts.length === 2 && owner?.kind === 'func') {
+    if (owner.decl?.type === 'FuncDecl') {
+      field = fieldOf(owner.decl.funcType.params.list, name);
+    }
+  } else if (parts.length === 2 && owner?.kind === 'type') {
+    const spec = owner.decl;
+    if (spec?.type === 'TypeSpec' && spec.specType.type === 'StructType') {
+      field = fieldOf(spec.specType.fields.list, name);
+    }
+  } else if (parts.length === 3 && owner?.kind === 'type') {
+    const method = owner.methods?.find(m => m.name === parts[1]);
+    if (method?.decl?.type === 'FuncDecl') {
+      field = fieldOf(method.decl.funcType.params.list, name);
+    }
+  }
+  const id = field?.names.find(n => n.name === name);
+  const obj = id ? info.defs.get(id) : undefined;
+  if (!field || !obj) {
+    throw new ToolError(
+      'symbol_not_found',
+      `Cannot find '${entry}' in package ${pkg.name}; expected Func.param, Type.Method.param or Struct.field`
+    );
+  }
+  return { name: entry, obj, field };
+}
+
+// Checks that every use of the variable or field obj other than assigning
+// to it calls one of the interface's methods, so that retyping it keeps the
+// code compiling.
+function checkUses(
+  program: GoProgram,
+  r: Replacement,
+  methods: Set<string>,
+  interfaceName: string
+): void {
+  for (const ref of findReferences(program, r.obj)) {
+    if (ref.isDeclaration) continue;
+    const path = pathEnclosingInterval(ref.file.ast, ref.pos, ref.end);
+    let i = path.length - 1;
+    let parent = path[i - 1];
+    if (parent?.type === 'KeyValueExpr' && parent.key === path[i]) continue;
+    if (parent?.type === 'SelectorExpr' && parent.sel === path[i]) {
+      parent = path[--i - 1];
+    }
+    const node = path[i];
+    if (parent?.type === 'AssignStmt' && parent.lhs.includes(node as Expr)) {
+      continue;
+    }
+    if (
+      parent?.type === 'SelectorExpr' &&
+      parent.x === node &&
+      methods.has(parent.sel.name)
+    ) {
+      continue;
+    }
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot change '${r.name}' to ${interfaceName}: it is used at ${locationOf(ref.file, ref.pos)} other than to call a method of ${interfaceName}`,
+      errorLocation(ref.file, ref.pos)
+    );
+  }
+}
+
+export async function performExtractInterface(
+  options: ExtractInterfaceOptions
+): Promise<ExtractInterfaceResult> {
+  const { dryRun = false, interfaceName, replace = [] } = options;
+  const { program, file: given } = await loadGoFile(options.filePath, options);
+  program.check();
+  const pkg = given.pkg;
+  const typeObj = pkg.scope?.lookup(options.typeName);
+  if (typeObj?.kind !== 'type' || typeObj.type?.kind !== 'named') {
+    throw new ToolError(
+      'symbol_not_found',
+      `'${options.typeName}' is not a type declared in package ${pkg.name}`
+    );
+  }
+  if (typeObj.typeParams?.length) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot extract an interface from the generic type '${typeObj.name}'`
+    );
+  }
+  if (under(typeObj.type).kind === 'interface') {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${typeObj.name}' is already an interface`
+    );
+  }
+  checkIdentifier(interfaceName);
+  if (isPackageLevelName(pkg, interfaceName)) {
+    throw new ToolError(
+      'name_conflict',
+      `'${interfaceName}' is already declared in package ${pkg.name}`
+    );
+  }
+
+  const selected = selectMethods(typeObj, options.methods);
+  const file = typeObj.file!;
+  const missing: ImportRequest[] = [];
+  const qualifier = fileQualifier(file, missing);
+  const specs = selected.map(m =>
+    methodSpec(program, file, m.obj, qualifier)
+  );
+  const pointer = selected.some(m => m.pointerOnly);
+  const value = typeObj.type;
+  const implementedBy = `${pointer ? '*' : ''}${typeObj.name}`;
+
+  const decl = typeDecl(file, typeObj);
+  const pos = lineEnd(file.src, decl.end);
+  const sep = file.src[pos - 1] === '\n' ? '' : '\n';
+  const edits = new Map<GoSourceFile, TextEdit[]>([
+    [
+      file,
+      [
+        ...addImportEdits(file, missing),
+        {
+          pos,
+          end: pos,
+          newText: `${sep}\n// ${interfaceName} describes the methods of ${implementedBy}.\ntype ${interfaceName} interface {\n${specs.join('')}}\n`,
+        },
+      ],
+    ],
+  ]);
+
+  const replacements = replace.map(entry =>
+    resolveReplacement(program, pkg, entry)
+  );
+  const methods = new Set(selected.map(m => m.obj.name));
+  const retyped = new Set<Field>();
+  for (const r of replacements) {
+    const t = r.obj.type;
+    const isValue = !!t && identical(t, value);
+    const isPointer = t?.kind === 'pointer' && identical(t.elem, value);
+    if (!isValue && !isPointer) {
+      throw new ToolError(
+        'unsupported_construct',
+        `'${r.name}' has type ${typeString(t!, fileQualifier(r.obj.file!))}, not ${typeObj.name} or *${typeObj.name}`
+      );
+    }
+    if (isValue && pointer) {
+      throw new ToolError(
+        'unsupported_construct',
+        `'${r.name}' has type ${typeObj.name}, but only *${typeObj.name} implements ${interfaceName}`
+      );
+    }
+    const others = r.field.names.filter(
+      id => !replacements.some(x => x.field === r.field && x.obj.pos === id.pos)
+    );
+    if (others.length > 0) {
+      throw new ToolError(
+        'unsupported_construct',
+        `'${r.name}' is declared together with ${others.map(id => id.name).join(', ')}; replace all of them or none`
+      );
+    }
+    checkUses(program, r, methods, interfaceName);
+    if (retyped.has(r.field)) continue;
+    retyped.add(r.field);
+    const f = r.obj.file!;
+    const list = edits.get(f) ?? edits.set(f, []).get(f)!;
+    list.push({
+      pos: r.field.fieldType.pos,
+      end: r.field.fieldType.end,
+      newText: interfaceName,
+    });
+  }
+
+  const changes = [...edits].map(([f, list]) => ({
+    filePath: f.filePath,
+    original: f.src,
+    updated: applyTextEdits(f.src, list),
+  }));
+  return {
+    interfaceName,
+    implementedBy,
+    methods: selected.map(m => m.obj.name),
+    replaced: replacements.map(r => r.name),
+    changes: await commitFileChanges(changes, dryRun, options),
+    dryRun,
+  };
+}
+
+export function formatExtractInterfaceResults(
+  result: ExtractInterfaceResult
+): string {
+  const count = result.methods.length;
+  const lines = [
+    `Extracted interface '${result.interfaceName}' with ${count} method${count === 1 ? '' : 's'} implemented by ${result.implementedBy}: ${result.methods.join(', ')}`,
+  ];
+  if (result.replaced.length > 0) {
+    lines.push(
+      `Changed to ${result.interfaceName}:`,
+      ...result.replaced.map(r => `  ${r}`)
+    );
+  }
+  return `${lines.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
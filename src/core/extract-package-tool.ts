@@ -0,0 +1,611 @@
+import { existsSync, mkdirSync, readdirSync, rmSync } from 'fs';
+import { basename, dirname, join, relative, resolve, sep } from 'path';
+import type { Ident, Node } from '../utils/go-ast.js';
+import {
+  inspect,
+  isExported,
+  pathEnclosingInterval,
+} from '../utils/go-ast.js';
+import { internalVisible, lookupAt } from '../utils/go-analysis.js';
+import {
+  addImportEdits,
+  checkIdentifier,
+  fileQualifier,
+  importPathOf,
+  isPackageLevelName,
+  newGoFile,
+  pruneImports,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import {
+  dirImportPath,
+  exclusionWarnings,
+  loadGoFile,
+} from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import {
+  appendTo,
+  buildConstraint,
+  mergeRemovals,
+  movableDecls,
+  movedText,
+  namesOf,
+} from '../utils/go-move.js';
+import type { Moved } from '../utils/go-move.js';
+import {
+  errorLocation,
+  findReferences,
+  locationOf,
+  objectKindLabel,
+} from '../utils/go-references.js';
+import { defaultPackageName, under } from '../utils/go-types.js';
+import type { GoObject, GoPackage, GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { displayPath } from '../utils/file-utils.js';
+import { step } from '../utils/task.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ExtractPackageOptions extends LoadOptions, WriteOptions {
+  // A Go file of the package declaring the declarations.
+  filePath: string;
+  // Names of top-level declarations of the package, methods as
+  // Type.Method. The methods of the types moved go with them.
+  declarations: string[];
+  // The directory of the new package, in the module, which must not hold
+  // Go files yet.
+  destination: string;
+  // The name of the new package, by default the last element of its
+  // import path.
+  packageName?: string;
+  dryRun?: boolean;
+}
+
+export interface ExportedName {
+  // The package declaring the name after the extraction.
+  packageName: string;
+  from: string;
+  to: string;
+}
+
+export interface ExtractPackageResult {
+  importPath: string;
+  packageName: string;
+  dir: string;
+  // The names moved, methods as Type.Method, in the order of the files.
+  names: string[];
+  // Unexported names that code on the other side of the new package
+  // boundary uses, and that were exported for it.
+  exported: ExportedName[];
+  // References to the moved declarations updated outside of them.
+  references: number;
+  // Files that build constraints kept from being checked for references.
+  warnings: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// A declaration to move, with the file declaring it.
+interface Move {
+  file: GoSourceFile;
+  moved: Moved;
+}
+
+// A reference by ident in file to the package-level object obj.
+interface Use {
+  file: GoSourceFile;
+  id: Ident;
+  obj: GoObject;
+}
+
+function exportedName(obj: GoObject): string {
+  if (!/^\p{Ll}/u.test(obj.name)) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' cannot be exported, since it does not start with a lower-case letter`,
+      obj.file && errorLocation(obj.file, obj.pos)
+    );
+  }
+  return obj.name[0].toUpperCase() + obj.name.slice(1);
+}
+
+// Returns a path from start back to itself in the import graph, if any.
+function importCycle(
+  graph: Map<string, Set<string>>,
+  start: string
+): string[] | undefined {
+  const seen = new Set<string>();
+  const visit = (path: string, trail: string[]): string[] | undefined => {
+    for (const next of graph.get(path) ?? []) {
+      if (next === start) return [...trail, next];
+      if (seen.has(next)) continue;
+      seen.add(next);
+      const found = visit(next, [...trail, next]);
+      if (found) return found;
+    }
+    return undefined;
+  };
+  return visit(start, [start]);
+}
+
+// Moves top-level declarations of a package into a new package in a
+// directory of the module, one file for each file they come from. Code
+// that stays refers to the moved declarations through an import of the
+// new package, and the moved code to what stays through an import of the
+// old one, so that both are only possible when the new package is used
+// in one direction; an import cycle is refused. Unexported names used
+// across the new boundary are exported.
+export async function performExtractPackage(
+  options: ExtractPackageOptions
+): Promise<ExtractPackageResult> {
+  const { dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const pkg = file.pkg;
+  if (pkg.isXTest) {
+    throw new ToolError(
+      'unsupported_construct',
+      'Declarations of external test packages cannot be extracted'
+    );
+  }
+
+  const dir = resolve(options.destination);
+  const module = program.moduleOf(dir);
+  if (!module || dir === pkg.dir) {
+    const root = displayPath(program.moduleOf(pkg.dir)!.root);
+    throw new ToolError(
+      'invalid_argument',
+      `The destination must be a new directory in the module at ${root}`
+    );
+  }
+  if (existsSync(dir) && readdirSync(dir).some(n => n.endsWith('.go'))) {
+    throw new ToolError(
+      'invalid_argument',
+      `${displayPath(dir)} already holds Go files`
+    );
+  }
+  const rel = relative(module.root, dir).split(sep).join('/');
+  const importPath = `${module.path}/${rel}`;
+  const packageName = options.packageName ?? defaultPackageName(importPath);
+  checkIdentifier(packageName);
+  const target: GoPackage = {
+    importPath,
+    name: packageName,
+    dir,
+    files: [],
+    isXTest: false,
+  };
+
+  // The declarations to move, with the methods of the types among them.
+  const isTest = (f: GoSourceFile) => f.filePath.endsWith('_test.go');
+  const movable: Move[] = pkg.files
+    .filter(f => !isTest(f))
+    .flatMap(f => movableDecls(f).map(moved => ({ file: f, moved })));
+  const chosen = new Set<Move>();
+  for (const name of options.declarations) {
+    const matching = movable.filter(m => namesOf(m.moved).includes(name));
+    if (matching.length === 0) {
+      throw new ToolError(
+        'symbol_not_found',
+        `'${name}' is not a top-level declaration of package ${pkg.name} outside its tests`
+      );
+    }
+    matching.forEach(m => chosen.add(m));
+  }
+  const types = new Set(
+    [...chosen]
+      .filter(m => m.moved.decl.type === 'GenDecl' && m.moved.decl.tok === 'type')
+      .flatMap(m => namesOf(m.moved))
+  );
+  const receiverOf = (m: Move) => {
+    if (m.moved.decl.type !== 'FuncDecl' || !m.moved.decl.recv) return;
+    return namesOf(m.moved)[0].split('.')[0];
+  };
+  for (const m of movable) {
+    const recv = receiverOf(m);
+    if (recv && types.has(recv)) chosen.add(m);
+  }
+  for (const m of chosen) {
+    const recv = receiverOf(m);
+    const name = namesOf(m.moved)[0];
+    if (recv && !types.has(recv)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `'${name}' cannot be moved without its type ${recv}`
+      );
+    }
+    if (m.moved.decl.type === 'FuncDecl' && !recv) {
+      if (name === 'init' || (name === 'main' && pkg.name === 'main')) {
+        throw new ToolError(
+          'unsupported_construct',
+          `The ${name} function of package ${pkg.name} cannot be moved into another package`
+        );
+      }
+    }
+  }
+  for (const f of pkg.files.filter(isTest)) {
+    for (const moved of movableDecls(f)) {
+      const recv = receiverOf({ file: f, moved });
+      if (recv && types.has(recv)) {
+        throw new ToolError(
+          'unsupported_construct',
+          `The method ${namesOf(moved)[0]} is declared in ${displayPath(f.filePath)}, a test file that stays in package ${pkg.name}`
+        );
+      }
+    }
+  }
+  // A grouped declaration whose specs all move goes as a whole.
+  const moves: Move[] = [];
+  for (const m of movable) {
+    if (!chosen.has(m)) continue;
+    if (m.moved.spec) {
+      const group = movable.filter(o => o.moved.decl === m.moved.decl);
+      if (group.every(o => chosen.has(o))) {
+        if (group[0] === m) {
+          moves.push({ file: m.file, moved: { decl: m.moved.decl } });
+        }
+        continue;
+      }
+    }
+    moves.push(m);
+  }
+
+  const nodeOf = (m: Move): Node => m.moved.spec ?? m.moved.decl;
+  const inside = (f: GoSourceFile | undefined, pos: number) =>
+    moves.some(
+      m => m.file === f && nodeOf(m).pos <= pos && pos < nodeOf(m).end
+    );
+  const movedObj = (obj: GoObject) => inside(obj.file, obj.pos);
+  const isPackageLevel = (obj: GoObject) =>
+    obj.parent?.kind === 'package' && obj.pkg === pkg;
+  const movedObjects = [...(pkg.scope?.names.values() ?? [])].filter(movedObj);
+  const label = (obj: GoObject) => `${objectKindLabel(obj)} ${obj.name}`;
+
+  // What the moved code uses of the package, and the fields and methods
+  // that neither side can use unexported across the boundary.
+  await step(options, 'Finding references');
+  const outward: Use[] = [];
+  for (const m of moves) {
+    inspect(nodeOf(m), n => {
+      if (n.type !== 'Ident') return;
+      const obj = info.uses.get(n);
+      if (!obj || obj.kind === 'pkgname' || movedObj(obj)) return;
+      if (isPackageLevel(obj)) {
+        outward.push({ file: m.file, id: n, obj });
+      } else if (obj.file?.pkg === pkg && !isExported(obj.name)) {
+        throw new ToolError(
+          'unsupported_construct',
+          `The moved code uses the unexported ${label(obj)} at ${locationOf(m.file, n.pos)}, which stays in package ${pkg.name}`,
+          errorLocation(m.file, n.pos)
+        );
+      }
+    });
+  }
+  const unexportedFields = (n: Node) => {
+    if (n.type !== 'CompositeLit' || n.elts.length === 0) return;
+    if (n.elts[0].type === 'KeyValueExpr') return;
+    const t = info.typeOf(n);
+    if (t?.kind !== 'named') return;
+    const u = under(t);
+    if (u.kind !== 'struct' || u.fields.every(f => isExported(f.name))) return;
+    return t.obj;
+  };
+  for (const f of pkg.files) {
+    inspect(f.ast, n => {
+      const struct = unexportedFields(n);
+      if (struct && movedObj(struct) !== inside(f, n.pos)) {
+        throw new ToolError(
+          'unsupported_construct',
+          `The composite literal at ${locationOf(f, n.pos)} sets the unexported fields of ${struct.name} without their names, which it cannot do from another package`,
+          errorLocation(f, n.pos)
+        );
+      }
+      if (n.type !== 'Ident' || inside(f, n.pos)) return;
+      const obj = info.uses.get(n);
+      if (!obj || !movedObj(obj) || isPackageLevel(obj)) return;
+      if (!isExported(obj.name)) {
+        throw new ToolError(
+          'unsupported_construct',
+          `${locationOf(f, n.pos)} uses the unexported ${label(obj)}, which would be declared in package ${packageName}`,
+          errorLocation(f, n.pos)
+        );
+      }
+    });
+  }
+  // The references to the moved declarations from the rest of the
+  // package, and from other packages.
+  const inward: Use[] = [];
+  const external: Use[] = [];
+  const movedRefs: Use[] = [];
+  for (const obj of movedObjects) {
+    for (const ref of findReferences(program, obj)) {
+      const id = pathEnclosingInterval(ref.file.ast, ref.pos, ref.end).at(-1);
+      if (id?.type !== 'Ident') continue;
+      const use = { file: ref.file, id, obj };
+      if (inside(ref.file, ref.pos)) movedRefs.push(use);
+      else if (ref.file.pkg === pkg) inward.push(use);
+      else external.push(use);
+    }
+  }
+
+  // Names used across the boundary are exported, unless that would make
+  // them clash with others.
+  const exports = new Map<GoObject, string>();
+  for (const use of [...outward, ...inward]) {
+    if (!exports.has(use.obj) && !isExported(use.obj.name)) {
+      exports.set(use.obj, exportedName(use.obj));
+    }
+  }
+  const nameOf = (obj: GoObject) => exports.get(obj) ?? obj.name;
+  for (const [obj, name] of exports) {
+    const clash = (at: string) =>
+      new ToolError(
+        'name_conflict',
+        `Cannot export '${obj.name}' as '${name}', which ${at}`
+      );
+    if (movedObj(obj)) {
+      const other = movedObjects.find(o => o !== obj && nameOf(o) === name);
+      if (other) {
+        throw clash(
+          `is declared at ${locationOf(other.file!, other.pos)} too`
+        );
+      }
+      for (const use of movedRefs.filter(u => u.obj === obj)) {
+        const found = lookupAt(info, use.file, use.id.pos, name);
+        if (found && found.parent?.kind !== 'package') {
+          throw clash(
+            `refers to another declaration at ${locationOf(use.file, use.id.pos)}`
+          );
+        }
+      }
+      continue;
+    }
+    if (isPackageLevelName(pkg, name)) {
+      throw clash(`package ${pkg.name} already declares`);
+    }
+    for (const ref of findReferences(program, obj)) {
+      if (inside(ref.file, ref.pos)) continue;
+      const found = lookupAt(info, ref.file, ref.pos, name);
+      if (found) {
+        throw clash(
+          `refers to another declaration at ${locationOf(ref.file, ref.pos)}`
+        );
+      }
+    }
+  }
+
+  // The files of the new package take the moved declarations, with the
+  // references to the rest of the package qualified.
+  const dests = new Map<
+    GoSourceFile,
+    { dest: GoSourceFile; missing: ImportRequest[]; texts: string[] }
+  >();
+  const removals = new Map<GoSourceFile, TextEdit[]>();
+  const movedEdits: TextEdit[] = [];
+  for (const use of movedRefs) {
+    if (exports.has(use.obj)) {
+      movedEdits.push({
+        pos: use.id.pos,
+        end: use.id.end,
+        newText: nameOf(use.obj),
+      });
+    }
+  }
+  for (const m of moves) {
+    if (!dests.has(m.file)) {
+      const destPath = join(dir, basename(m.file.filePath));
+      const dest = newGoFile(destPath, target, buildConstraint(m.file));
+      dests.set(m.file, { dest, missing: [], texts: [] });
+    }
+    const d = dests.get(m.file)!;
+    const qualifier = fileQualifier(d.dest, d.missing);
+    const node = nodeOf(m);
+    const extra = movedEdits.filter(
+      e => e.pos >= node.pos && e.end <= node.end
+    );
+    for (const use of outward.filter(u => u.file === m.file)) {
+      if (use.id.pos < node.pos || use.id.end > node.end) continue;
+      const q = qualifier({ path: pkg.importPath, name: pkg.name });
+      const found = lookupAt(info, m.file, use.id.pos, q);
+      if (found && !(isPackageLevel(found) && !movedObj(found))) {
+        throw new ToolError(
+          'name_conflict',
+          `'${q}' refers to another declaration at ${locationOf(m.file, use.id.pos)}, where the moved code uses ${use.obj.name} of package ${pkg.name}`,
+          errorLocation(m.file, use.id.pos)
+        );
+      }
+      extra.push({
+        pos: use.id.pos,
+        end: use.id.end,
+        newText: `${q}.${nameOf(use.obj)}`,
+      });
+    }
+    const { text, removal } = movedText(
+      program,
+      info,
+      m.file,
+      m.moved,
+      d.dest,
+      d.missing,
+      extra
+    );
+    d.texts.push(text);
+    const list = removals.get(m.file) ?? removals.set(m.file, []).get(m.file)!;
+    list.push(removal);
+  }
+  // The rest of the package and the other packages refer to the moved
+  // declarations through the new package.
+  const edits = new Map<
+    GoSourceFile,
+    { edits: TextEdit[]; missing: ImportRequest[] }
+  >();
+  const entry = (f: GoSourceFile) =>
+    edits.get(f) ?? edits.set(f, { edits: [], missing: [] }).get(f)!;
+  for (const use of [...inward, ...external]) {
+    const { file: f, id } = use;
+    const at = locationOf(f, id.pos);
+    if (!internalVisible(dirImportPath(f.pkg), importPath)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `${importPath} is internal, and ${at} in package ${f.pkg.name} cannot import it`,
+        errorLocation(f, id.pos)
+      );
+    }
+    const e = entry(f);
+    const q = fileQualifier(f, e.missing)({
+      path: importPath,
+      name: packageName,
+    });
+    const path = pathEnclosingInterval(f.ast, id.pos, id.end);
+    const parent = path[path.length - 2];
+    const qualified =
+      parent?.type === 'SelectorExpr' &&
+      parent.sel === id &&
+      parent.x.type === 'Ident' &&
+      info.uses.get(parent.x)?.kind === 'pkgname';
+    const pos = qualified ? parent.pos : id.pos;
+    if (lookupAt(info, f, pos, q)) {
+      throw new ToolError(
+        'name_conflict',
+        `'${q}' refers to another declaration at ${at}, where ${use.obj.name} is used; choose another package name`,
+        errorLocation(f, id.pos)
+      );
+    }
+    e.edits.push({ pos, end: id.end, newText: `${q}.${nameOf(use.obj)}` });
+  }
+  for (const [obj, name] of exports) {
+    if (movedObj(obj)) continue;
+    for (const ref of findReferences(program, obj)) {
+      if (inside(ref.file, ref.pos)) continue;
+      entry(ref.file).edits.push({
+        pos: ref.pos,
+        end: ref.end,
+        newText: name,
+      });
+    }
+  }
+  for (const [f, list] of removals) {
+    entry(f).edits.push(...mergeRemovals(f.src, list));
+  }
+
+  // The new package imports what the moved code uses, and is imported by
+  // the packages that use it: none of them may import it back.
+  const graph = new Map<string, Set<string>>();
+  for (const p of program.packages) {
+    const paths = p.files.flatMap(f => f.ast.imports.map(importPathOf));
+    graph.set(p.importPath, new Set(paths));
+  }
+  graph.set(
+    importPath,
+    new Set([...dests.values()].flatMap(d => d.missing.map(r => r.path)))
+  );
+  for (const f of edits.keys()) {
+    if (edits.get(f)!.missing.length > 0) {
+      graph.get(f.pkg.importPath)?.add(importPath);
+    }
+  }
+  const cycle = importCycle(graph, importPath);
+  if (cycle) {
+    const reasons: string[] = [];
+    if (cycle[1] === pkg.importPath && outward.length > 0) {
+      const use = outward[0];
+      reasons.push(
+        `the moved code uses ${use.obj.name} at ${locationOf(use.file, use.id.pos)}`
+      );
+    }
+    if (cycle[cycle.length - 2] === pkg.importPath && inward.length > 0) {
+      const use = inward[0];
+      reasons.push(
+        `${locationOf(use.file, use.id.pos)} uses ${use.obj.name}, which is moved`
+      );
+    }
+    throw new ToolError(
+      'unsupported_construct',
+      `Extracting the declarations would create the import cycle ${cycle.join(' -> ')}${reasons.length > 0 ? `: ${reasons.join(', and ')}` : ''}`
+    );
+  }
+
+  const changes: FileChange[] = [...edits].map(([f, e]) => ({
+    filePath: f.filePath,
+    original: f.src,
+    updated: pruneImports(
+      f,
+      info,
+      applyTextEdits(f.src, [...e.edits, ...addImportEdits(f, e.missing)])
+    ),
+  }));
+  for (const d of dests.values()) {
+    changes.push({
+      filePath: d.dest.filePath,
+      original: '',
+      updated: appendTo(d.dest, d.missing, d.texts),
+    });
+  }
+
+  // The directory is created for the new files, and removed again with
+  // the parents created for it if they cannot be written. Undoing the call
+  // deletes them too, from the innermost.
+  const created =
+    !dryRun && !existsSync(dir)
+      ? mkdirSync(dir, { recursive: true })
+      : undefined;
+  const createdDirs: string[] = [];
+  for (let d = resolve(dir); created; d = dirname(d)) {
+    createdDirs.push(d);
+    if (d === resolve(created) || dirname(d) === d) break;
+  }
+  let committed: FileChange[];
+  try {
+    committed = await commitFileChanges(changes, dryRun, {
+      ...options,
+      createdDirs,
+    });
+  } catch (error) {
+    if (created) rmSync(created, { recursive: true, force: true });
+    throw error;
+  }
+
+  return {
+    importPath,
+    packageName,
+    dir: displayPath(dir),
+    names: moves.flatMap(m => namesOf(m.moved)),
+    exported: [...exports].map(([obj, to]) => ({
+      packageName: movedObj(obj) ? packageName : pkg.name,
+      from: obj.name,
+      to,
+    })),
+    references: inward.length + external.length,
+    warnings: exclusionWarnings(program, [pkg]),
+    changes: committed,
+    dryRun,
+  };
+}
+
+export function formatExtractPackageResults(
+  result: ExtractPackageResult
+): string {
+  const count = result.names.length;
+  const declarations = count === 1 ? '1 declaration' : `${count} declarations`;
+  const output = [
+    `Extracted ${declarations} into package ${result.packageName} (${result.importPath}) in ${result.dir}: ${result.names.join(', ')}`,
+  ];
+  for (const e of result.exported) {
+    output.push(`Exported ${e.from} of package ${e.packageName} as ${e.to}`);
+  }
+  const refs = result.references;
+  output.push(`Updated ${refs} reference${refs === 1 ? '' : 's'}`);
+  if (result.warnings.length > 0) {
+    output.push('Not checked for references, check these by hand:');
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
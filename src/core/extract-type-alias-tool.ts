@@ -0,0 +1,399 @@
+import type {
+  BlockStmt,
+  Decl,
+  Expr,
+  FuncDecl,
+  FuncLit,
+  Ident,
+  Node,
+} from '../utils/go-ast.js';
+import {
+  children,
+  inspect,
+  pathEnclosingInterval,
+  unparen,
+} from '../utils/go-ast.js';
+import { isLocal } from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  checkCapture,
+  checkIdentifier,
+  checkShadowing,
+  indentAt,
+  isPackageLevelName,
+  lineStart,
+  pruneImports,
+} from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  locationOf,
+  resolveLocation,
+} from '../utils/go-references.js';
+import type { GoLocationInput } from '../utils/go-references.js';
+import {
+  deref,
+  identical,
+  isExternal,
+  methodSet,
+  sameObject,
+  typeContains,
+} from '../utils/go-types.js';
+import type { GoSourceFile, Type } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+// Whether the new name is an alias, denoting the very same type, or a
+// defined type of its own with the expression as its underlying type.
+export type TypeNameKind = 'alias' | 'defined';
+
+// Where the type is declared, and so which occurrences it replaces.
+export type TypeNameScope = 'package' | 'function';
+
+export interface ExtractTypeAliasOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoLocationInput {
+  filePath: string;
+  typeName: string;
+  kind?: TypeNameKind;
+  scope?: TypeNameScope;
+  dryRun?: boolean;
+}
+
+export interface ExtractTypeAliasResult {
+  typeName: string;
+  kind: TypeNameKind;
+  // The type expression, as written at the given location.
+  type: string;
+  // The package or function declaring the type.
+  declaredIn: string;
+  occurrences: number;
+  // Occurrences left as written because a defined type would change the
+  // identity of the types around them, as locations.
+  kept: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+interface Occurrence {
+  file: GoSourceFile;
+  node: Expr;
+  // Whether a defined type in its place would change the identity of
+  // another type.
+  identity: boolean;
+}
+
+// Reports whether e is a type expression other than a name.
+function isTypeLiteral(info: GoInfo, e: Node): e is Expr {
+  if (info.types.get(e as Expr)?.mode !== 'type') return false;
+  if (e.type === 'ArrayType') return e.len?.type !== 'Ellipsis';
+  return (
+    e.type !== 'Ident' && e.type !== 'SelectorExpr' && e.type !== 'ParenExpr'
+  );
+}
+
+// Reports whether the function declared by decl is only ever called, so
+// that its signature is not the type of any value.
+function onlyCalled(
+  info: GoInfo,
+  files: GoSourceFile[],
+  decl: FuncDecl
+): boolean {
+  const obj = info.defs.get(decl.name);
+  const callees = new Set<Node>();
+  const uses: Ident[] = [];
+  for (const f of files) {
+    inspect(f.ast, n => {
+      if (n.type === 'CallExpr') {
+        const fun = unparen(n.fun);
+        callees.add(fun.type === 'SelectorExpr' ? fun.sel : fun);
+      }
+      if (n.type === 'Ident' && sameObject(info.uses.get(n), obj)) {
+        uses.push(n);
+      }
+    });
+  }
+  return uses.every(u => callees.has(u));
+}
+
+// Finds the type literals of root identical to t, outermost first, and
+// marks those whose replacement by a defined type would change the
+// identity of another type: occurrences inside other type literals, in
+// signatures of methods and of functions used as values, and in type
+// assertions and switches, which would tell the two types apart.
+function occurrencesIn(
+  info: GoInfo,
+  files: GoSourceFile[],
+  file: GoSourceFile,
+  root: Node,
+  t: Type
+): Occurrence[] {
+  const found: Occurrence[] = [];
+  const visit = (n: Node, path: Node[]): void => {
+    if (isTypeLiteral(info, n) && identical(info.typeOf(n)!, t)) {
+      found.push({ file, node: n, identity: changesIdentity(path, n) });
+      return;
+    }
+    for (const child of children(n)) visit(child, [...path, n]);
+  };
+  const changesIdentity = (path: Node[], n: Node): boolean => {
+    const parent = path[path.length - 1];
+    if (parent?.type === 'TypeAssertExpr') return true;
+    if (parent?.type === 'CaseClause') {
+      const sw = path[path.length - 3];
+      if (sw?.type === 'TypeSwitchStmt') return true;
+    }
+    for (let i = path.length - 1; i >= 0; i--) {
+      const p = path[i];
+      if (p.type === 'FuncDecl') {
+        const inSignature = n.pos < (p.body?.pos ?? p.end);
+        return inSignature && (!!p.recv || !onlyCalled(info, files, p));
+      }
+      if (p.type === 'StructType' && path[i - 1]?.type === 'TypeSpec') {
+        // Fields of a defined struct type do not make its identity.
+        const spec = path[i - 1];
+        if (spec.type === 'TypeSpec' && !spec.assign) return false;
+      }
+      if (isTypeLiteral(info, p)) return true;
+    }
+    return false;
+  };
+  visit(root, []);
+  return found;
+}
+
+// Rejects occurrences that cannot become a name: receivers, which must
+// name a defined type, and embedded fields, whose name would change.
+function replaceable(o: Occurrence): boolean {
+  const path = pathEnclosingInterval(o.file.ast, o.node.pos, o.node.end);
+  while (path.length > 0 && path[path.length - 1] !== o.node) path.pop();
+  const parent = path[path.length - 2];
+  if (parent?.type !== 'Field') return true;
+  const decl = path.find((p): p is FuncDecl => p.type === 'FuncDecl');
+  if (decl?.recv?.list.includes(parent)) return false;
+  const embedded = parent.names.length === 0;
+  return !embedded || path[path.length - 4]?.type !== 'StructType';
+}
+
+export async function performExtractTypeAlias(
+  options: ExtractTypeAliasOptions
+): Promise<ExtractTypeAliasResult> {
+  const {
+    typeName: name,
+    kind = 'alias',
+    scope = 'package',
+    dryRun = false,
+  } = options;
+  checkIdentifier(name);
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const index = resolveLocation(file, options);
+  const path = pathEnclosingInterval(file.ast, index);
+  const expr = [...path].reverse().find(n => isTypeLiteral(info, n)) as
+    | Expr
+    | undefined;
+  if (!expr) {
+    throw new ToolError(
+      'invalid_location',
+      `No type expression at ${locationOf(file, index)}`
+    );
+  }
+  const text = file.src.substring(expr.pos, expr.end);
+  const t = info.typeOf(expr)!;
+  if (typeContains(t, x => x.kind === 'invalid')) {
+    throw new ToolError('compile_error', `Invalid type ${text}`);
+  }
+  if (typeContains(t, x => x.kind === 'typeparam')) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot extract ${text}, which uses type parameters`
+    );
+  }
+  inspect(expr, n => {
+    const obj = n.type === 'Ident' ? info.uses.get(n) : undefined;
+    if (obj?.kind === 'type' && isLocal(obj)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot extract ${text}, which uses the local type ${obj.name} declared at ${locationOf(file, obj.pos)}`
+      );
+    }
+  });
+  // A defined type only has the methods of its underlying type's fields
+  // and interface, not those declared on a named type.
+  const named = deref(t).type;
+  if (kind === 'defined' && named.kind === 'named') {
+    const methods = isExternal(named) ? undefined : methodSet(t);
+    if (!methods || methods.length > 0) {
+      throw new ToolError(
+        'unsupported_construct',
+        `A defined type of ${text} would not have the methods of ${named.obj.name}; extract an alias instead`
+      );
+    }
+  }
+
+  const keyword = kind === 'alias' ? `type ${name} =` : `type ${name}`;
+  const declaration = `${keyword} ${text}`;
+  let occurrences: Occurrence[] = [];
+  const edits = new Map<GoSourceFile, TextEdit[]>();
+  let declaredIn: string;
+  if (scope === 'function') {
+    const func = [...path]
+      .reverse()
+      .find(
+        (n): n is FuncDecl | FuncLit =>
+          n.type === 'FuncDecl' || n.type === 'FuncLit'
+      );
+    const body: BlockStmt | undefined = func?.body;
+    if (!func || !body || expr.pos < body.pos) {
+      throw new ToolError(
+        'unsupported_construct',
+        `The type at ${locationOf(file, expr.pos)} is not in a function body`
+      );
+    }
+    declaredIn =
+      func.type === 'FuncDecl'
+        ? `func ${func.name.name}`
+        : `the function literal at ${locationOf(file, func.pos)}`;
+    // Go does not allow type declarations inside generic functions.
+    const generic = path.some(
+      n => n.type === 'FuncDecl' && n.funcType.typeParams
+    );
+    if (generic) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot declare a type in ${declaredIn}, which is generic`
+      );
+    }
+    occurrences = occurrencesIn(info, [file], file, body, t);
+    const funcScope = info.scopes.get(body);
+    const existing = funcScope?.lookup(name);
+    if (existing) {
+      throw new ToolError(
+        'name_conflict',
+        `'${name}' is already declared in ${declaredIn} at ${locationOf(file, existing.pos)}`,
+        errorLocation(file, existing.pos)
+      );
+    }
+    checkShadowing(info, occurrences, funcScope, name);
+    checkCapture(info, [{ file, node: body }], name);
+
+    const [first] = body.list;
+    const start = lineStart(file.src, first.pos);
+    edits.set(file, [
+      first.pos > file.src.indexOf('\n', body.pos)
+        ? {
+            pos: start,
+            end: start,
+            newText: `${indentAt(file.src, first.pos)}${declaration}\n`,
+          }
+        : { pos: first.pos, end: first.pos, newText: `${declaration}; ` },
+    ]);
+  } else {
+    const pkg = file.pkg;
+    declaredIn = `package ${pkg.name}`;
+    for (const f of pkg.files) {
+      occurrences.push(...occurrencesIn(info, program.files, f, f.ast, t));
+    }
+    if (isPackageLevelName(pkg, name)) {
+      const existing =
+        pkg.scope?.lookup(name) ??
+        pkg.files.map(f => f.scope?.lookup(name)).find(Boolean)!;
+      const at = existing.file
+        ? ` at ${locationOf(existing.file, existing.pos)}`
+        : '';
+      throw new ToolError(
+        'name_conflict',
+        `'${name}' is already declared in ${declaredIn}${at}`,
+        existing.file && errorLocation(existing.file, existing.pos)
+      );
+    }
+    checkShadowing(info, occurrences, pkg.scope, name);
+    checkCapture(
+      info,
+      pkg.files.map(f => ({ file: f, node: f.ast })),
+      name
+    );
+
+    // The type goes before the declaration using the expression.
+    const decl = file.ast.decls.find(
+      (d: Decl) => d.pos <= expr.pos && expr.end <= d.end
+    )!;
+    const pos = lineStart(file.src, decl.doc?.pos ?? decl.pos);
+    edits.set(file, [{ pos, end: pos, newText: `${declaration}\n\n` }]);
+  }
+
+  // The selected occurrence is replaced even where a defined type changes
+  // identities, since that is what was asked for.
+  const kept: string[] = [];
+  let replaced = 0;
+  for (const o of occurrences.filter(replaceable)) {
+    if (kind === 'defined' && o.identity && o.node !== expr) {
+      kept.push(locationOf(o.file, o.node.pos));
+      continue;
+    }
+    if (!edits.has(o.file)) edits.set(o.file, []);
+    const { pos, end } = o.node;
+    edits.get(o.file)!.push({ pos, end, newText: name });
+    replaced++;
+  }
+  if (!occurrences.some(o => o.node === expr && replaceable(o))) {
+    throw new ToolError(
+      'unsupported_construct',
+      `The type at ${locationOf(file, expr.pos)} cannot be replaced by a name, being a receiver or an embedded field`
+    );
+  }
+  const changes = await commitFileChanges(
+    [...edits].map(([f, fileEdits]) => ({
+      filePath: f.filePath,
+      original: f.src,
+      updated: pruneImports(f, info, applyTextEdits(f.src, fileEdits)),
+    })),
+    dryRun,
+    options
+  );
+
+  return {
+    typeName: name,
+    kind,
+    type: text,
+    declaredIn,
+    occurrences: replaced,
+    kept,
+    changes,
+    dryRun,
+  };
+}
+
+export function formatExtractTypeAliasResults(
+  result: ExtractTypeAliasResult
+): string {
+  const occurrences =
+    result.occurrences === 1
+      ? '1 occurrence'
+      : `${result.occurrences} occurrences`;
+  const what =
+    result.kind === 'alias'
+      ? `type alias '${result.typeName}' = ${result.type}`
+      : `type '${result.typeName}' ${result.type}`;
+  const output = [
+    `Extracted ${what} in ${result.declaredIn}, replacing ${occurrences}`,
+  ];
+  if (result.kept.length > 0) {
+    output.push(
+      `Kept ${result.kept.length === 1 ? 'this occurrence' : 'these occurrences'}, where a defined type would change the identity of other types or what type assertions match:`,
+      ...result.kept.map(k => `  ${k}`)
+    );
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
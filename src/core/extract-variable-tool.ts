@@ -0,0 +1,512 @@
+import type { Expr, Ident, Node, Stmt } from '../utils/go-ast.js';
+import { inspect, pathEnclosingInterval, unparen } from '../utils/go-ast.js';
+import {
+  collectWrites,
+  declaredAt,
+  isPure,
+  scopeAt,
+  statementsOf,
+} from '../utils/go-analysis.js';
+import type { StmtList } from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  checkIdentifier,
+  fileQualifier,
+  indentAt,
+  lineStart,
+} from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { errorLocation, locationOf } from '../utils/go-references.js';
+import { scanGo } from '../utils/go-scanner.js';
+import {
+  defaultType,
+  isUntyped,
+  sameObject,
+  typeString,
+  under,
+} from '../utils/go-types.js';
+import type { GoObject, GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { displayPath } from '../utils/file-utils.js';
+import { positionToIndex } from '../utils/line-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ExtractVariableOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  startLine: number;
+  startColumn: number;
+  endLine: number;
+  endColumn: number;
+  variableName: string;
+  replaceAll?: boolean;
+  dryRun?: boolean;
+}
+
+export interface ExtractVariableResult {
+  filePath: string;
+  variableName: string;
+  // Undefined if the expression uses packages outside the module.
+  type?: string;
+  occurrences: number;
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+interface Placement {
+  // The statement the declaration is inserted before.
+  stmt: Stmt;
+  container: StmtList;
+}
+
+const NOT_EXPRESSION = 'The selected range must cover a complete expression';
+
+// Finds the statement before which the expression at the end of path can
+// be evaluated instead, rejecting positions where moving it would change
+// whether, how often or on what it is evaluated.
+function placementOf(info: GoInfo, path: Node[]): Placement {
+  const e = path[path.length - 1];
+  // Whether child still denotes the variable the expression does, so that
+  // assigning to it or taking its address would affect that variable
+  // rather than a copy.
+  let addressable = true;
+  for (let i = path.length - 2; i >= 0; i--) {
+    const parent = path[i];
+    const child = path[i + 1];
+    let selects = false;
+    switch (parent.type) {
+      case 'File':
+      case 'FuncDecl':
+        throw new ToolError(
+          'unsupported_construct',
+          'Only expressions inside function bodies can be extracted'
+        );
+      case 'GenDecl':
+        if (parent.tok === 'const') {
+          throw new ToolError(
+            'unsupported_construct',
+            'Cannot extract an expression from a constant declaration'
+          );
+        }
+        break;
+      case 'ArrayType':
+        throw new ToolError(
+          'unsupported_construct',
+          'Cannot extract an array length, which is constant'
+        );
+      case 'BlockStmt':
+        if (child.type === 'CaseClause' || child.type === 'CommClause') break;
+        return { stmt: child as Stmt, container: parent };
+      case 'CaseClause':
+        if (parent.body.includes(child as Stmt)) {
+          return { stmt: child as Stmt, container: parent };
+        }
+        throw new ToolError(
+          'unsupported_construct',
+          'Cannot extract a case expression, which is only evaluated when the earlier cases do not match'
+        );
+      case 'CommClause': {
+        if (parent.body.includes(child as Stmt)) {
+          return { stmt: child as Stmt, container: parent };
+        }
+        const comm = parent.comm;
+        const recv =
+          comm?.type === 'ExprStmt'
+            ? comm.x
+            : comm?.type === 'AssignStmt'
+              ? comm.rhs[0]
+              : undefined;
+        if (recv && unparen(recv) === e) {
+          throw new ToolError(
+            'unsupported_construct',
+            'Cannot extract the receive operation of a select case'
+          );
+        }
+        break;
+      }
+      case 'ForStmt':
+        if (child === parent.cond || child === parent.post) {
+          throw new ToolError(
+            'unsupported_construct',
+            'Cannot extract an expression from a loop condition or post statement, which run on every iteration'
+          );
+        }
+        break;
+      case 'IfStmt':
+        if (child === parent.else) {
+          throw new ToolError(
+            'unsupported_construct',
+            'Cannot extract an expression from an else if statement, which only runs when the earlier conditions fail'
+          );
+        }
+        break;
+      case 'BinaryExpr':
+        if ((parent.op === '&&' || parent.op === '||') && child === parent.y) {
+          throw new ToolError(
+            'unsupported_construct',
+            `Cannot extract the right operand of ${parent.op}, which is only evaluated depending on the left one`
+          );
+        }
+        break;
+      case 'ExprStmt':
+      case 'GoStmt':
+      case 'DeferStmt':
+        if (child === e) {
+          throw new ToolError(
+            'unsupported_construct',
+            'Cannot extract an expression used as a statement'
+          );
+        }
+        break;
+      case 'UnaryExpr':
+        if (addressable && parent.op === '&') {
+          throw new ToolError(
+            'unsupported_construct',
+            'Cannot extract an expression whose address is taken'
+          );
+        }
+        break;
+      case 'AssignStmt':
+        if (addressable && parent.lhs.includes(child as Expr)) {
+          throw new ToolError(
+            'unsupported_construct',
+            'Cannot extract an expression that is assigned to'
+          );
+        }
+        break;
+      case 'IncDecStmt':
+        if (addressable) {
+          throw new ToolError(
+            'unsupported_construct',
+            'Cannot extract an expression that is assigned to'
+          );
+        }
+        break;
+      case 'RangeStmt':
+        if (addressable && (child === parent.key || child === parent.value)) {
+          throw new ToolError(
+            'unsupported_construct',
+            'Cannot extract an expression that is assigned to'
+          );
+        }
+        break;
+      case 'SelectorExpr': {
+        const sel = info.selections.get(parent);
+        const t = info.typeOf(parent.x);
+        if (child !== parent.x || !sel || !t) break;
+        if (sel.kind === 'field') {
+          selects = under(t).kind !== 'pointer';
+        } else if (
+          addressable &&
+          sel.obj.pointerRecv &&
+          t.kind !== 'pointer'
+        ) {
+          throw new ToolError(
+            'unsupported_construct',
+            `Cannot extract an expression whose pointer method ${parent.sel.name} would be called on a copy`
+          );
+        }
+        break;
+      }
+      case 'IndexExpr': {
+        const t = info.typeOf(parent.x);
+        selects = child === parent.x && !!t && under(t).kind === 'array';
+        break;
+      }
+      case 'ParenExpr':
+        selects = true;
+        break;
+    }
+    addressable = addressable && selects;
+  }
+  throw new ToolError('ambiguous_location', NOT_EXPRESSION);
+}
+
+// Reports whether a and b are written alike and refer to the same objects.
+function sameExpr(
+  info: GoInfo,
+  file: GoSourceFile,
+  a: Expr,
+  b: Expr
+): boolean {
+  a = unparen(a);
+  b = unparen(b);
+  if (a.type !== b.type) return false;
+  const text = (e: Expr) => file.src.substring(e.pos, e.end);
+  const compact = (e: Expr) => text(e).replace(/\s+/g, '');
+  if (compact(a) !== compact(b)) return false;
+  const ta = scanGo(text(a)).tokens;
+  const tb = scanGo(text(b)).tokens;
+  if (
+    ta.length !== tb.length ||
+    ta.some((t, k) => t.tok !== tb[k].tok || t.lit !== tb[k].lit)
+  ) {
+    return false;
+  }
+  const ia = identsOf(a);
+  const ib = identsOf(b);
+  return ia.every((id, k) => {
+    const x = info.uses.get(id);
+    const y = info.uses.get(ib[k]);
+    return x === y || (!!x && !!y && sameObject(x, y));
+  });
+}
+
+function identsOf(e: Expr): Ident[] {
+  const idents: Ident[] = [];
+  inspect(e, n => {
+    if (n.type === 'Ident') idents.push(n);
+  });
+  return idents;
+}
+
+export async function performExtractVariable(
+  options: ExtractVariableOptions
+): Promise<ExtractVariableResult> {
+  const { variableName: name, replaceAll = false, dryRun = false } = options;
+  checkIdentifier(name);
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  let pos = positionToIndex(
+    file.src,
+    { line: options.startLine, column: options.startColumn },
+    file.lineStarts
+  );
+  let end = positionToIndex(
+    file.src,
+    { line: options.endLine, column: options.endColumn },
+    file.lineStarts
+  );
+  while (pos < end && /\s/.test(file.src[pos])) pos++;
+  while (end > pos && /\s/.test(file.src[end - 1])) end--;
+  if (pos >= end) throw new ToolError(
+    'invalid_location',
+    'The selected range is empty'
+  );
+
+  const path = pathEnclosingInterval(file.ast, pos, end);
+  const e = path[path.length - 1] as Expr;
+  const operand = info.types.get(e);
+  if (e.pos !== pos || e.end !== end || !operand) {
+    throw new ToolError('ambiguous_location', NOT_EXPRESSION);
+  }
+  const text = file.src.substring(unparen(e).pos, unparen(e).end);
+  // Expressions using packages outside the module have no known type but
+  // can still be declared with :=.
+  if (operand.mode !== 'value' && operand.mode !== 'invalid') {
+    throw new ToolError('unsupported_construct', `'${text}' is not a value`);
+  }
+  const t = operand.type;
+  if (t.kind === 'tuple') {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${text}' has ${t.types.length} values`
+    );
+  }
+  if (isUntyped(t) && t.name === 'untyped nil') {
+    throw new ToolError(
+      'unsupported_construct',
+      'Cannot extract nil, which has no type'
+    );
+  }
+  const { stmt, container } = placementOf(info, path);
+  const list = statementsOf(container);
+
+  const reads = new Set<GoObject>();
+  let constant = true;
+  for (const id of identsOf(e)) {
+    const obj = info.uses.get(id);
+    if (!obj) continue;
+    if (obj.kind !== 'const') constant = false;
+    if (obj.kind === 'var') reads.add(obj);
+    if (obj.file === file && obj.pos >= stmt.pos && obj.pos < e.pos) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot extract an expression using '${obj.name}', which is declared in the enclosing statement`
+      );
+    }
+  }
+  // Untyped constants keep their type as constants, which lets them be used
+  // wherever the original expression was.
+  constant = constant && isUntyped(t);
+
+  if (!isPure(info, e)) {
+    let call: Node | undefined;
+    inspect(stmt, n => {
+      if (call || n.type === 'FuncLit' || n.pos >= e.pos) return false;
+      if (
+        n.end <= e.pos &&
+        ((n.type === 'CallExpr' && !isPure(info, n)) ||
+          (n.type === 'UnaryExpr' && n.op === '<-'))
+      ) {
+        call = n;
+      }
+    });
+    if (call) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot extract '${text}', which would then be evaluated before ${locationOf(file, call.pos)}`,
+        errorLocation(file, call.pos)
+      );
+    }
+  }
+
+  // Other occurrences in the block, outside function literals, which may
+  // run at another time than the declaration.
+  const occurrences: Expr[] = [e];
+  let declStmt = stmt;
+  let regionEnd = e.end;
+  if (replaceAll) {
+    inspect(container, n => {
+      if (n.type === 'FuncLit') return false;
+      if (n === e) return false;
+      if (!info.types.has(n as Expr)) return;
+      if (!sameExpr(info, file, n as Expr, e)) return;
+      const nPath = pathEnclosingInterval(file.ast, n.pos, n.end);
+      if (nPath[nPath.length - 1] !== n) return;
+      try {
+        placementOf(info, nPath);
+      } catch {
+        return;
+      }
+      occurrences.push(n as Expr);
+      for (const m of nPath) {
+        if (m.type === 'ForStmt' || m.type === 'RangeStmt') {
+          if (m.pos >= container.pos) regionEnd = Math.max(regionEnd, m.end);
+        }
+      }
+      return false;
+    });
+    occurrences.sort((a, b) => a.pos - b.pos);
+    if (occurrences.length > 1 && !isPure(info, e)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot replace every occurrence of '${text}', which may have side effects`
+      );
+    }
+    const first = occurrences[0];
+    declStmt = list.find(s => s.pos <= first.pos && first.end <= s.end)!;
+    regionEnd = Math.max(regionEnd, occurrences[occurrences.length - 1].end);
+    const region = list.filter(
+      s => s.end > declStmt.pos && s.pos < regionEnd
+    );
+    for (const id of collectWrites(info, region).modified) {
+      const obj = info.objectOf(id);
+      if (obj && reads.has(obj) && id.pos >= declStmt.pos) {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot replace every occurrence of '${text}': '${id.name}' is modified at ${locationOf(file, id.pos)}`,
+          errorLocation(file, id.pos)
+        );
+      }
+    }
+  }
+
+  // The new variable must neither clash with a name of the block, capture
+  // later uses of an outer name nor be shadowed where it replaces the
+  // expression.
+  const scope = info.scopes.get(container);
+  const existing = scope?.lookup(name);
+  if (existing) {
+    const at = existing.file
+      ? ` at ${locationOf(existing.file, existing.pos)}`
+      : '';
+    throw new ToolError(
+      'name_conflict',
+      `'${name}' is already declared in this block${at}`,
+      existing.file && errorLocation(existing.file, existing.pos)
+    );
+  }
+  const replaced = (n: Node) =>
+    occurrences.some(o => o.pos <= n.pos && n.end <= o.end);
+  inspect(container, n => {
+    if (n.end <= declStmt.pos || replaced(n)) return false;
+    if (n.type === 'SelectorExpr') {
+      inspect(n.x, visit);
+      return false;
+    }
+    return visit(n);
+
+    function visit(m: Node): boolean | void {
+      if (m.type !== 'Ident' || m.name !== name || m.pos < declStmt.pos) {
+        return;
+      }
+      const obj = info.uses.get(m);
+      if (obj && !(obj.pos >= container.pos && obj.pos < container.end)) {
+        throw new ToolError(
+          'name_conflict',
+          `Declaring '${name}' would shadow the ${obj.kind} used at ${locationOf(file, m.pos)}`,
+          errorLocation(file, m.pos)
+        );
+      }
+    }
+  });
+  for (const o of occurrences) {
+    const oPath = pathEnclosingInterval(file.ast, o.pos, o.end);
+    for (let s = scopeAt(info, oPath); s && s !== scope; s = s.parent) {
+      const other = declaredAt(s, name, o.pos);
+      if (other) {
+        throw new ToolError(
+          'name_conflict',
+          `'${name}' at ${locationOf(file, o.pos)} would refer to the ${other.kind} declared at ${locationOf(file, other.pos)}`,
+          errorLocation(file, o.pos)
+        );
+      }
+    }
+  }
+
+  const decl = constant ? `const ${name} = ${text}` : `${name} := ${text}`;
+  const start = lineStart(file.src, declStmt.pos);
+  const insertion: TextEdit = /^[ \t]*$/.test(
+    file.src.substring(start, declStmt.pos)
+  )
+    ? {
+        pos: start,
+        end: start,
+        newText: `${indentAt(file.src, declStmt.pos)}${decl}\n`,
+      }
+    : { pos: declStmt.pos, end: declStmt.pos, newText: `${decl}; ` };
+  const updated = applyTextEdits(file.src, [
+    insertion,
+    ...occurrences.map(o => ({ pos: o.pos, end: o.end, newText: name })),
+  ]);
+  const changes = await commitFileChanges(
+    [{ filePath: file.filePath, original: file.src, updated }],
+    dryRun,
+    options
+  );
+
+  return {
+    filePath: displayPath(file.filePath),
+    variableName: name,
+    type:
+      t.kind === 'invalid'
+        ? undefined
+        : constant
+          ? typeString(t)
+          : typeString(defaultType(t), fileQualifier(file)),
+    occurrences: occurrences.length,
+    changes,
+    dryRun,
+  };
+}
+
+export function formatExtractVariableResults(
+  result: ExtractVariableResult
+): string {
+  const occurrences =
+    result.occurrences === 1
+      ? '1 occurrence'
+      : `${result.occurrences} occurrences`;
+  const type = result.type ? ` of type ${result.type}` : '';
+  return `Extracted variable '${result.variableName}'${type} in ${result.filePath}, replacing ${occurrences}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,160 @@
+import { displayPath } from '../utils/file-utils.js';
+import { isExported } from '../utils/go-ast.js';
+import { namedTypes } from '../utils/go-analysis.js';
+import { exclusionWarnings, loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { resolveSymbol } from '../utils/go-references.js';
+import type { GoSymbolInput } from '../utils/go-references.js';
+import {
+  implementsInterface,
+  interfaceMethods,
+  isExternal,
+  sameObject,
+  typeString,
+  under,
+} from '../utils/go-types.js';
+import type { InterfaceTypeT, Type } from '../utils/go-types.js';
+import { indexToPosition } from '../utils/line-utils.js';
+import { step } from '../utils/task.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface FindImplementationsOptions
+  extends LoadOptions,
+    GoSymbolInput {
+  filePath: string;
+}
+
+export interface Implementation {
+  // The type name, qualified by its package name when it is declared in
+  // another package than the interface.
+  name: string;
+  filePath: string;
+  line: number;
+  column: number;
+  // Whether values of the type implement the interface, or only pointers
+  // to them because some of the methods have pointer receivers.
+  receiver: 'value' | 'pointer';
+}
+
+export interface FindImplementationsResult {
+  interfaceName: string;
+  implementations: Implementation[];
+  // Embedded interfaces declared outside the module, whose methods the
+  // implementations were not checked for.
+  unchecked: string[];
+  // Files that build constraints excluded from the search.
+  warnings: string[];
+}
+
+// Returns the interfaces of packages outside the module that t embeds,
+// directly or through other embedded interfaces.
+function externalEmbeds(t: InterfaceTypeT, seen = new Set<Type>()): Type[] {
+  if (seen.has(t)) return [];
+  seen.add(t);
+  return t.embeddeds.flatMap(e => {
+    if (isExternal(e)) return [e];
+    const u = under(e);
+    return u.kind === 'interface' ? externalEmbeds(u, seen) : [];
+  });
+}
+
+export async function performFindImplementations(
+  options: FindImplementationsOptions
+): Promise<FindImplementationsResult> {
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const { obj } = resolveSymbol(program, file, options);
+  if (obj.externalPath) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is declared in ${obj.externalPath}, outside the module, whose types are not loaded`
+    );
+  }
+  const iface = obj.kind === 'type' ? obj.type : undefined;
+  const u = iface && under(iface);
+  if (!iface || u?.kind !== 'interface') {
+    throw new ToolError(
+      'invalid_argument',
+      `'${obj.name}' is not an interface type`
+    );
+  }
+  if (u.isConstraint) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' has type terms and can only be used as a constraint`
+    );
+  }
+  const methods = interfaceMethods(u);
+
+  await step(options, 'Finding implementations');
+  const implementations: Implementation[] = [];
+  for (const t of namedTypes(program)) {
+    const decl = t.obj;
+    if (sameObject(decl, obj) || !decl.file || under(t).kind === 'interface') {
+      continue;
+    }
+    // Generic types implement interfaces only once instantiated.
+    if (decl.typeParams?.length) continue;
+    // Unexported methods can only be implemented in their own package.
+    if (methods.some(m => !isExported(m.name) && m.pkg !== decl.pkg)) {
+      continue;
+    }
+    let receiver: Implementation['receiver'];
+    if (implementsInterface(t, iface, false).ok) receiver = 'value';
+    else if (implementsInterface(t, iface, true).ok) receiver = 'pointer';
+    else continue;
+    const position = indexToPosition(
+      decl.file.src,
+      decl.pos,
+      decl.file.lineStarts
+    );
+    implementations.push({
+      name:
+        decl.pkg === obj.pkg ? decl.name : `${decl.pkg!.name}.${decl.name}`,
+      filePath: displayPath(decl.file.filePath),
+      line: position.line,
+      column: position.column,
+      receiver,
+    });
+  }
+  implementations.sort(
+    (a, b) =>
+      a.filePath.localeCompare(b.filePath) ||
+      a.line - b.line ||
+      a.column - b.column
+  );
+
+  return {
+    interfaceName: obj.name,
+    implementations,
+    unchecked: externalEmbeds(u).map(e => typeString(e)),
+    warnings: exclusionWarnings(program, program.packages),
+  };
+}
+
+export function formatFindImplementationsResults(
+  result: FindImplementationsResult
+): string {
+  const excluded =
+    result.warnings.length > 0
+      ? `\n\nNot searched:\n${result.warnings.map(w => `  ${w}`).join('\n')}`
+      : '';
+  const unchecked =
+    result.unchecked.length > 0
+      ? `\n\nNot checked, since they are declared outside the module: the methods of ${result.unchecked.join(', ')}`
+      : '';
+  if (result.implementations.length === 0) {
+    return `No types in the module implement ${result.interfaceName}${unchecked}${excluded}`;
+  }
+
+  const output = [`Implementations of interface ${result.interfaceName}:`];
+  for (const impl of result.implementations) {
+    const how =
+      impl.receiver === 'value'
+        ? `${impl.name} (value and pointer)`
+        : `*${impl.name} (pointer only)`;
+    output.push(`  ${impl.filePath}:${impl.line}:${impl.column}: ${how}`);
+  }
+  const count = result.implementations.length;
+  output.push(`\nTotal: ${count} ${count === 1 ? 'type' : 'types'}`);
+  return output.join('\n') + unchecked + excluded;
+}
@@ -0,0 +1,90 @@
+import { displayPath } from '../utils/file-utils.js';
+import { exclusionWarnings, loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import {
+  findReferences,
+  objectKindLabel,
+  resolveSymbol,
+} from '../utils/go-references.js';
+import type { GoSymbolInput } from '../utils/go-references.js';
+import { indexToPosition, lineTextAt } from '../utils/line-utils.js';
+import { step } from '../utils/task.js';
+
+export interface FindReferencesOptions extends LoadOptions, GoSymbolInput {
+  filePath: string;
+}
+
+export interface ReferenceLocation {
+  filePath: string;
+  line: number;
+  column: number;
+  snippet: string;
+  isDeclaration: boolean;
+}
+
+export interface FindReferencesResult {
+  symbol: string;
+  kind: string;
+  references: ReferenceLocation[];
+  // Files that build constraints excluded from the search.
+  warnings: string[];
+}
+
+export async function performFindReferences(
+  options: FindReferencesOptions
+): Promise<FindReferencesResult> {
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const { obj } = resolveSymbol(program, file, options);
+
+  await step(options, 'Finding references');
+  const references = findReferences(program, obj).map(ref => {
+    const position = indexToPosition(
+      ref.file.src,
+      ref.pos,
+      ref.file.lineStarts
+    );
+    return {
+      filePath: displayPath(ref.file.filePath),
+      line: position.line,
+      column: position.column,
+      snippet: lineTextAt(ref.file.src, ref.pos, ref.file.lineStarts).trim(),
+      isDeclaration: ref.isDeclaration,
+    };
+  });
+
+  const warnings =
+    obj.pkg && obj.file ? exclusionWarnings(program, [obj.pkg]) : [];
+  return {
+    symbol: obj.name,
+    kind: objectKindLabel(obj),
+    references,
+    warnings,
+  };
+}
+
+export function formatFindReferencesResults(
+  result: FindReferencesResult
+): string {
+  const excluded =
+    result.warnings.length > 0
+      ? `\n\nNot searched:\n${result.warnings.map(w => `  ${w}`).join('\n')}`
+      : '';
+  if (result.references.length === 0) {
+    return `No references found for ${result.symbol}${excluded}`;
+  }
+
+  const output: string[] = [
+    `References to ${result.kind} ${result.symbol}:`,
+  ];
+  for (const ref of result.references) {
+    output.push(
+      `  ${ref.filePath}:${ref.line}:${ref.column}: ${ref.snippet}${ref.isDeclaration ? ' (declaration)' : ''}`
+    );
+  }
+
+  const files = new Set(result.references.map(ref => ref.filePath));
+  output.push(
+    `\nTotal: ${result.references.length} references in ${files.size} files`
+  );
+  return output.join('\n') + excluded;
+}
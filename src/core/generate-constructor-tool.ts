@@ -0,0 +1,269 @@
+import type { Expr, FuncDecl, GenDecl } from '../utils/go-ast.js';
+import { isExported } from '../utils/go-ast.js';
+import {
+  alignCells,
+  declRemovalEdit,
+  lineEnd,
+  pruneImports,
+} from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { errorLocation, locationOf } from '../utils/go-references.js';
+import { GO_KEYWORDS } from '../utils/go-scanner.js';
+import { universe } from '../utils/go-types.js';
+import type { GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+// Whether the constructor returns a pointer to the struct or the struct.
+export type ConstructorForm = 'pointer' | 'value';
+
+export interface GenerateConstructorOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  // A struct type declared in the package of filePath.
+  typeName: string;
+  // The fields the constructor takes as parameters, all of them by
+  // default; the others are left zero.
+  fields?: string[];
+  form?: ConstructorForm;
+  dryRun?: boolean;
+}
+
+export interface GenerateConstructorResult {
+  typeName: string;
+  // NewT for an exported type, newT otherwise.
+  constructorName: string;
+  form: ConstructorForm;
+  // The fields set from parameters and those left zero, in the order of
+  // the struct.
+  parameters: string[];
+  zero: string[];
+  // Whether an existing function of the same name was replaced.
+  replaced: boolean;
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+interface StructField {
+  name: string;
+  type: string;
+  // The index of the field declaration, shared by names declared together.
+  group: number;
+}
+
+// Returns the name an embedded field of type t has.
+function embeddedName(t: Expr): string {
+  switch (t.type) {
+    case 'StarExpr':
+      return embeddedName(t.x);
+    case 'SelectorExpr':
+      return t.sel.name;
+    case 'IndexExpr':
+    case 'IndexListExpr':
+      return embeddedName(t.x);
+    case 'Ident':
+      return t.name;
+  }
+  return '';
+}
+
+// Names the parameter for a field: Name becomes name, URL url and
+// HTTPClient httpClient. Keywords and predeclared names become their
+// initial.
+function parameterName(field: string): string {
+  const upper = /^\p{Lu}+/u.exec(field)?.[0] ?? '';
+  const lead =
+    upper.length > 1 && upper.length < field.length
+      ? upper.slice(0, -1)
+      : upper;
+  const result = lead.toLowerCase() + field.slice(lead.length);
+  return GO_KEYWORDS.has(result) || universe.lookup(result)
+    ? result[0]
+    : result;
+}
+
+// Writes the parameter list, joining the names of consecutive parameters
+// that come from the same field declaration as in x, y int.
+function parameterList(fields: StructField[], names: string[]): string {
+  const parts: string[] = [];
+  fields.forEach((f, i) => {
+    const last = i === fields.length - 1 || fields[i + 1].group !== f.group;
+    parts.push(last ? `${names[i]} ${f.type}` : names[i]);
+  });
+  return parts.join(', ');
+}
+
+// Generates a constructor for a struct type that takes the chosen fields
+// as parameters, in the order of the struct, and returns the struct or a
+// pointer to it. A function of the same name already declared in the
+// package is replaced, keeping its doc comment; otherwise the constructor
+// goes right after the type declaration.
+export async function performGenerateConstructor(
+  options: GenerateConstructorOptions
+): Promise<GenerateConstructorResult> {
+  const { form = 'pointer', dryRun = false } = options;
+  const { program, file: given } = await loadGoFile(options.filePath, options);
+  const checker = program.check();
+  const pkg = given.pkg;
+  const typeObj = pkg.scope?.lookup(options.typeName);
+  const spec = typeObj?.decl;
+  if (typeObj?.kind !== 'type' || spec?.type !== 'TypeSpec' || !typeObj.file) {
+    throw new ToolError(
+      'symbol_not_found',
+      `'${options.typeName}' is not a type declared in package ${pkg.name}`
+    );
+  }
+  const file = typeObj.file;
+  if (spec.specType.type !== 'StructType') {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${typeObj.name}' is not declared as a struct type`,
+      errorLocation(file, typeObj.pos)
+    );
+  }
+
+  const fields: StructField[] = [];
+  spec.specType.fields.list.forEach((field, group) => {
+    const type = file.src.slice(field.fieldType.pos, field.fieldType.end);
+    const names =
+      field.names.length > 0
+        ? field.names.map(n => n.name)
+        : [embeddedName(field.fieldType)];
+    for (const name of names) {
+      if (name !== '_') fields.push({ name, type, group });
+    }
+  });
+  const chosen = options.fields ?? fields.map(f => f.name);
+  for (const name of chosen) {
+    if (!fields.some(f => f.name === name)) {
+      const known = fields.map(f => f.name).join(', ') || 'none';
+      throw new ToolError(
+        'invalid_argument',
+        `'${typeObj.name}' has no field '${name}'; its fields are ${known}`
+      );
+    }
+  }
+  const params = fields.filter(f => chosen.includes(f.name));
+  const zero = fields.filter(f => !chosen.includes(f.name));
+
+  // The parameters must not hide the type or its type parameters, which
+  // the body names, nor each other.
+  const typeParams = (spec.typeParams?.list ?? []).flatMap(f =>
+    f.names.map(n => n.name)
+  );
+  const taken = new Set([typeObj.name, ...typeParams]);
+  const names = params.map(f => {
+    const base = parameterName(f.name);
+    let name = base;
+    for (let n = 2; taken.has(name); n++) name = `${base}${n}`;
+    taken.add(name);
+    return name;
+  });
+
+  const exported = isExported(typeObj.name);
+  const suffix = typeObj.name[0].toUpperCase() + typeObj.name.slice(1);
+  const constructorName = `${exported ? 'New' : 'new'}${suffix}`;
+  const existingObj = pkg.scope?.lookup(constructorName);
+  const existing = existingObj?.decl;
+  if (existingObj && existing?.type !== 'FuncDecl') {
+    throw new ToolError(
+      'name_conflict',
+      `Package ${pkg.name} already declares ${constructorName} at ${locationOf(existingObj.file!, existingObj.pos)}, which is not a function`
+    );
+  }
+
+  const generics = spec.typeParams
+    ? file.src.slice(spec.typeParams.pos, spec.typeParams.end)
+    : '';
+  const instance =
+    typeParams.length > 0
+      ? `${typeObj.name}[${typeParams.join(', ')}]`
+      : typeObj.name;
+  // gofmt aligns the values of the keyed elements.
+  const elements = alignCells(
+    params.map((f, i) => [`${f.name}:`, `${names[i]},`])
+  ).map(line => `\t\t${line}\n`);
+  const literal =
+    elements.length > 0
+      ? `${instance}{\n${elements.join('')}\t}`
+      : `${instance}{}`;
+  const [result, value] =
+    form === 'pointer' ? [`*${instance}`, `&${literal}`] : [instance, literal];
+  const signature = `func ${constructorName}${generics}(${parameterList(params, names)}) ${result} {\n\treturn ${value}\n}`;
+  const doc = `// ${constructorName} returns a new ${typeObj.name}.\n`;
+
+  const changed: FileChange[] = [];
+  const edits: TextEdit[] = [];
+  const decl = existing as FuncDecl | undefined;
+  if (decl && existingObj!.file === file) {
+    edits.push({
+      pos: decl.pos,
+      end: decl.end,
+      newText: decl.doc ? signature : `${doc}${signature}`,
+    });
+  } else {
+    // A constructor declared in another file moves after the type.
+    const keptDoc = decl?.doc
+      ? `${existingObj!.file!.src.slice(decl.doc.pos, decl.doc.end)}\n`
+      : doc;
+    const typeDecl = file.ast.decls.find(
+      (d): d is GenDecl =>
+        d.type === 'GenDecl' && d.pos <= spec.pos && spec.end <= d.end
+    )!;
+    const pos = lineEnd(file.src, typeDecl.end);
+    const sep = file.src[pos - 1] === '\n' ? '' : '\n';
+    edits.push({ pos, end: pos, newText: `${sep}\n${keptDoc}${signature}\n` });
+    if (decl) {
+      const other = existingObj!.file as GoSourceFile;
+      const updated = pruneImports(
+        other,
+        checker.info,
+        applyTextEdits(other.src, [declRemovalEdit(other.src, decl)])
+      );
+      changed.push({ filePath: other.filePath, original: other.src, updated });
+    }
+  }
+  changed.unshift({
+    filePath: file.filePath,
+    original: file.src,
+    updated: applyTextEdits(file.src, edits),
+  });
+
+  return {
+    typeName: typeObj.name,
+    constructorName,
+    form,
+    parameters: params.map(f => f.name),
+    zero: zero.map(f => f.name),
+    replaced: !!decl,
+    changes: await commitFileChanges(changed, dryRun, options),
+    dryRun,
+  };
+}
+
+export function formatGenerateConstructorResults(
+  result: GenerateConstructorResult
+): string {
+  const { typeName, constructorName } = result;
+  if (result.changes.length === 0) {
+    return `The constructor ${constructorName} of '${typeName}' is up to date`;
+  }
+  const returns = result.form === 'pointer' ? `*${typeName}` : typeName;
+  const count = result.parameters.length;
+  const output = [
+    `${result.replaced ? 'Regenerated' : 'Generated'} ${constructorName} returning ${returns}, with ${count} parameter${count === 1 ? '' : 's'}${count > 0 ? ` for ${result.parameters.join(', ')}` : ''}`,
+  ];
+  if (result.zero.length > 0) {
+    output.push(`Left zero: ${result.zero.join(', ')}`);
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,296 @@
+import type { GenDecl } from '../utils/go-ast.js';
+import {
+  addImportEdits,
+  fileQualifier,
+  lineEnd,
+  lineStart,
+  pruneImports,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { sameObject, under } from '../utils/go-types.js';
+import type { GoObject, GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface GenerateStringerOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  // A defined integer type declared in the package of filePath.
+  typeName: string;
+  dryRun?: boolean;
+}
+
+export interface GenerateStringerResult {
+  typeName: string;
+  // The constants String names, in the order of their values.
+  constants: string[];
+  // Constants left out because an earlier one has the same value.
+  duplicates: string[];
+  // How String finds the name: by slicing a string of all names at the
+  // offsets for contiguous values, or with a switch.
+  strategy: 'table' | 'switch';
+  // Whether an existing String method was replaced.
+  replaced: boolean;
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+const SIGNED = ['int', 'int8', 'int16', 'int32', 'int64', 'rune'];
+const UNSIGNED = ['uint', 'uint8', 'uint16', 'uint32', 'uint64', 'uintptr'];
+
+// Names the generated body declares, which the receiver must not shadow.
+const LOCALS = ['names', 'offsets', 'i'];
+
+interface Constant {
+  obj: GoObject;
+  value: bigint;
+}
+
+// Returns the package-level constants of type typeObj in the order they
+// are declared, together with their values.
+function constantsOf(
+  typeObj: GoObject,
+  valueOf: (obj: GoObject) => unknown
+): Constant[] {
+  const pkg = typeObj.pkg!;
+  const constants: Constant[] = [];
+  for (const obj of pkg.scope?.names.values() ?? []) {
+    if (obj.kind !== 'const' || obj.name === '_') continue;
+    if (obj.type?.kind !== 'named' || !sameObject(obj.type.obj, typeObj)) {
+      continue;
+    }
+    const value = valueOf(obj);
+    if (typeof value !== 'bigint') {
+      throw new ToolError(
+        'compile_error',
+        `Cannot determine the value of constant ${obj.name}`
+      );
+    }
+    constants.push({ obj, value });
+  }
+  const order = (obj: GoObject) => pkg.files.indexOf(obj.file!);
+  return constants.sort(
+    (a, b) => order(a.obj) - order(b.obj) || a.obj.pos - b.obj.pos
+  );
+}
+
+// Picks the receiver name used by the existing methods, or the initial of
+// the type name, so long as the generated body does not declare it too.
+function receiverName(typeObj: GoObject): string {
+  const names = (typeObj.methods ?? []).flatMap(m =>
+    m.decl?.type === 'FuncDecl' && m.decl.recv?.list[0]?.names[0]
+      ? [m.decl.recv.list[0].names[0].name]
+      : []
+  );
+  const initial = /\p{L}/u.exec(typeObj.name)?.[0].toLowerCase();
+  const candidates = [...names, initial, 'v', 'x'];
+  return candidates.find(
+    (n): n is string => !!n && n !== '_' && !LOCALS.includes(n)
+  )!;
+}
+
+function tableBody(
+  typeName: string,
+  recv: string,
+  constants: Constant[],
+  unsigned: boolean,
+  fallback: string
+): string {
+  const starts: number[] = [0];
+  let names = '';
+  for (const { obj } of constants) {
+    names += obj.name;
+    starts.push(Buffer.byteLength(names));
+  }
+  const total = starts[starts.length - 1];
+  const offset =
+    total < 1 << 8 ? 'uint8' : total < 1 << 16 ? 'uint16' : 'uint32';
+  const start = constants[0].value;
+  let index = recv;
+  if (start > 0n) index = `${recv} - ${start}`;
+  if (start < 0n) index = `${recv} + ${-start}`;
+  const tooSmall = unsigned ? '' : 'i < 0 || ';
+  return [
+    `\tconst names = "${names}"`,
+    `\toffsets := [...]${offset}{${starts.join(', ')}}`,
+    `\ti := ${index}`,
+    `\tif ${tooSmall}i >= ${typeName}(len(offsets)-1) {`,
+    `\t\treturn ${fallback}`,
+    '\t}',
+    '\treturn names[offsets[i]:offsets[i+1]]',
+  ].join('\n');
+}
+
+function switchBody(recv: string, constants: Constant[], fallback: string) {
+  return [
+    `\tswitch ${recv} {`,
+    ...constants.map(
+      ({ obj }) => `\tcase ${obj.name}:\n\t\treturn "${obj.name}"`
+    ),
+    '\t}',
+    `\treturn ${fallback}`,
+  ].join('\n');
+}
+
+// Returns where a new String method goes in file: after the type and the
+// declarations of its constants in that file, whichever comes last.
+function insertionPoint(
+  file: GoSourceFile,
+  typeObj: GoObject,
+  constants: Constant[]
+): number {
+  const ends = [typeObj, ...constants.map(c => c.obj)]
+    .filter(obj => obj.file === file)
+    .map(
+      obj =>
+        file.ast.decls.find(
+          (d): d is GenDecl =>
+            d.type === 'GenDecl' && d.pos <= obj.pos && obj.pos < d.end
+        )?.end ?? 0
+    );
+  return lineEnd(file.src, Math.max(...ends));
+}
+
+export async function performGenerateStringer(
+  options: GenerateStringerOptions
+): Promise<GenerateStringerResult> {
+  const { dryRun = false } = options;
+  const { program, file: given } = await loadGoFile(options.filePath, options);
+  const checker = program.check();
+  const pkg = given.pkg;
+  const typeObj = pkg.scope?.lookup(options.typeName);
+  if (
+    typeObj?.kind !== 'type' ||
+    typeObj.isAlias ||
+    typeObj.type?.kind !== 'named' ||
+    !typeObj.file
+  ) {
+    throw new ToolError(
+      'symbol_not_found',
+      `'${options.typeName}' is not a type declared in package ${pkg.name}`
+    );
+  }
+  const u = under(typeObj.type);
+  const basic = u.kind === 'basic' ? u.name : '';
+  const unsigned = UNSIGNED.includes(basic) || basic === 'byte';
+  if (!unsigned && !SIGNED.includes(basic)) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${typeObj.name}' is not an integer type`
+    );
+  }
+  if (typeObj.typeParams?.length) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot generate String for the generic type '${typeObj.name}'`
+    );
+  }
+
+  const declared = constantsOf(typeObj, obj => checker.objectConstValue(obj));
+  const constants: Constant[] = [];
+  const duplicates: string[] = [];
+  for (const c of declared) {
+    if (constants.some(d => d.value === c.value)) {
+      duplicates.push(c.obj.name);
+    } else {
+      constants.push(c);
+    }
+  }
+  if (constants.length === 0) {
+    throw new ToolError(
+      'symbol_not_found',
+      `Package ${pkg.name} declares no constants of type '${typeObj.name}'`
+    );
+  }
+  constants.sort((a, b) => (a.value < b.value ? -1 : 1));
+
+  // A String method declared before is regenerated where it is.
+  const stringObj = typeObj.methods?.find(m => m.name === 'String');
+  const existing =
+    stringObj?.decl?.type === 'FuncDecl' ? stringObj.decl : undefined;
+  const file = (existing && stringObj!.file) || typeObj.file;
+  const missing: ImportRequest[] = [];
+  const strconv = fileQualifier(file, missing)({
+    path: 'strconv',
+    name: 'strconv',
+  });
+  if (missing.length > 0 && pkg.scope?.lookup('strconv')) {
+    throw new ToolError(
+      'name_conflict',
+      `Package ${pkg.name} declares strconv, which hides the strconv import String needs`
+    );
+  }
+
+  const recv = receiverName(typeObj);
+  const format = unsigned
+    ? `${strconv}.FormatUint(uint64(${recv}), 10)`
+    : `${strconv}.FormatInt(int64(${recv}), 10)`;
+  const fallback = `"${typeObj.name}(" + ${format} + ")"`;
+  const contiguous = constants.every(
+    (c, i) => i === 0 || c.value === constants[i - 1].value + 1n
+  );
+  const strategy = contiguous && constants.length > 1 ? 'table' : 'switch';
+  const body =
+    strategy === 'table'
+      ? tableBody(typeObj.name, recv, constants, unsigned, fallback)
+      : switchBody(recv, constants, fallback);
+  const method = `// String returns the name of the ${typeObj.name} constant equal to ${recv}.\nfunc (${recv} ${typeObj.name}) String() string {\n${body}\n}`;
+
+  const edits: TextEdit[] = [...addImportEdits(file, missing)];
+  if (existing) {
+    const pos = lineStart(file.src, existing.doc?.pos ?? existing.pos);
+    edits.push({ pos, end: existing.end, newText: method });
+  } else {
+    const pos = insertionPoint(file, typeObj, constants);
+    const sep = file.src[pos - 1] === '\n' ? '' : '\n';
+    edits.push({ pos, end: pos, newText: `${sep}\n${method}\n` });
+  }
+  const updated = pruneImports(
+    file,
+    checker.info,
+    applyTextEdits(file.src, edits)
+  );
+  return {
+    typeName: typeObj.name,
+    constants: constants.map(c => c.obj.name),
+    duplicates,
+    strategy,
+    replaced: !!existing,
+    changes: await commitFileChanges(
+      [{ filePath: file.filePath, original: file.src, updated }],
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+export function formatGenerateStringerResults(
+  result: GenerateStringerResult
+): string {
+  const { typeName } = result;
+  if (result.changes.length === 0) {
+    return `The String method of '${typeName}' is up to date`;
+  }
+  const count = result.constants.length;
+  const how = result.strategy === 'table' ? 'from a table' : 'in a switch';
+  const output = [
+    `${result.replaced ? 'Regenerated' : 'Generated'} String for '${typeName}', naming ${count} constant${count === 1 ? '' : 's'} ${how}: ${result.constants.join(', ')}`,
+  ];
+  if (result.duplicates.length > 0) {
+    output.push(
+      `Left out, since an earlier constant has the same value: ${result.duplicates.join(', ')}`
+    );
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,295 @@
+import { basename, dirname, join } from 'path';
+import { isExported } from '../utils/go-ast.js';
+import {
+  addImportEdits,
+  fileQualifier,
+  newGoFile,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { GoProgram, LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  resolveLocation,
+  symbolAt,
+} from '../utils/go-references.js';
+import {
+  errorType,
+  identical,
+  typeContains,
+  typeString,
+  under,
+} from '../utils/go-types.js';
+import type {
+  GoPackage,
+  GoSourceFile,
+  SignatureType,
+  Type,
+} from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type { FileChange, WriteOptions } from '../utils/edit-utils.js';
+import { displayPath } from '../utils/file-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface GenerateTestsOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  offset?: number;
+  line?: number;
+  column?: number;
+  dryRun?: boolean;
+}
+
+export interface GenerateTestsResult {
+  // The tested function; methods as Type.Method.
+  functionName: string;
+  testName: string;
+  testFile: string;
+  // Package clause of the test file: the package itself or its external
+  // test package.
+  packageName: string;
+  created: boolean;
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// Returns name with its first letter upper-cased, since go test only runs
+// functions whose name continues with something other than a lower-case
+// letter after Test.
+function capitalize(name: string): string {
+  return name.charAt(0).toUpperCase() + name.slice(1);
+}
+
+// Picks the package of the test file: the one it declares if it exists,
+// otherwise the external test package when the other tests of the
+// directory all use it and can reach the function.
+function testPackage(
+  program: GoProgram,
+  pkg: GoPackage,
+  existing: GoSourceFile | undefined,
+  reachable: boolean
+): GoPackage {
+  if (existing) return existing.pkg;
+  const tests = program.files.filter(
+    f => f.pkg.dir === pkg.dir && f.filePath.endsWith('_test.go')
+  );
+  const xtest = program.packages.find(p => p.dir === pkg.dir && p.isXTest);
+  if (reachable && xtest && tests.every(f => f.pkg === xtest)) return xtest;
+  return pkg;
+}
+
+// Reports whether values of t can be compared with != without risking a
+// panic; other values are compared with reflect.DeepEqual.
+function isComparable(t: Type): boolean {
+  const u = under(t);
+  return u.kind === 'basic' && u.name !== 'untyped nil';
+}
+
+export async function performGenerateTests(
+  options: GenerateTestsOptions
+): Promise<GenerateTestsResult> {
+  const { dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const index = resolveLocation(file, options);
+  const { obj } = symbolAt(program, file, index);
+  const decl = obj.decl;
+  if (obj.kind !== 'func' || decl?.type !== 'FuncDecl' || !obj.file) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is not a function or method declared in the module`
+    );
+  }
+  const source = obj.file;
+  const where = errorLocation(source, obj.pos);
+  if (source.filePath.endsWith('_test.go')) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is declared in a test file`,
+      where
+    );
+  }
+  if (!decl.recv && (obj.name === 'init' || obj.name === 'main')) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Function '${obj.name}' cannot be called by a test`,
+      where
+    );
+  }
+  const sig = obj.type as SignatureType;
+  if (sig.typeParams?.length || obj.recv?.typeParams?.length) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot generate tests for the generic ${decl.recv ? 'method' : 'function'} '${obj.name}'`,
+      where
+    );
+  }
+
+  // Whether an external test package could call the function: it and every
+  // type of its signature declared in the package must be exported.
+  const pkg = source.pkg;
+  const unexported = (t: Type) =>
+    typeContains(
+      t,
+      x => x.kind === 'named' && x.obj.pkg === pkg && !isExported(x.obj.name)
+    );
+  const types = [...sig.params, ...sig.results].map(v => v.type!);
+  if (obj.recv) types.push(obj.recv.type!);
+  const reachable =
+    isExported(obj.name) &&
+    (!obj.recv || isExported(obj.recv.name)) &&
+    !types.some(unexported);
+
+  const testPath = join(
+    dirname(source.filePath),
+    `${basename(source.filePath, '.go')}_test.go`
+  );
+  const existing = program.file(testPath);
+  const testPkg = testPackage(program, pkg, existing, reachable);
+  if (testPkg.isXTest && !reachable) {
+    throw new ToolError(
+      'unsupported_construct',
+      `${displayPath(testPath)} belongs to the external test package ${testPkg.name}, which cannot refer to '${obj.name}' and the types of its signature unless they are all exported`,
+      where
+    );
+  }
+  const dest = existing ?? newGoFile(testPath, testPkg);
+
+  const functionName = obj.recv ? `${obj.recv.name}.${obj.name}` : obj.name;
+  const testName = `Test${capitalize(functionName.replace('.', '_'))}`;
+  const taken = testPkg.scope?.lookup(testName);
+  if (taken) {
+    throw new ToolError(
+      'name_conflict',
+      `'${testName}' is already declared in package ${testPkg.name}`,
+      taken.file ? errorLocation(taken.file, taken.pos) : undefined
+    );
+  }
+
+  const missing: ImportRequest[] = [{ path: 'testing', name: 'testing' }];
+  const qualifier = fileQualifier(dest, missing);
+  const typeText = (t: Type) => typeString(t, qualifier);
+
+  // Fields of the test cases: the receiver, the parameters and the
+  // expected results, with an error result reduced to wantErr.
+  const fields: [string, string][] = [['name', 'string']];
+  const used = new Set(['name']);
+  const field = (name: string, type: string) => {
+    let f = name;
+    for (let i = 1; used.has(f); i++) f = `${name}${i}`;
+    used.add(f);
+    fields.push([f, type]);
+    return f;
+  };
+  const recvField = obj.recv
+    ? field(
+        'receiver',
+        `${obj.pointerRecv ? '*' : ''}${typeText(obj.recv.type!)}`
+      )
+    : undefined;
+  const args = sig.params.map((p, i) => {
+    const name = p.name && p.name !== '_' ? p.name : `arg${i}`;
+    const f = field(name, typeText(p.type!));
+    return sig.variadic && i === sig.params.length - 1
+      ? `tt.${f}...`
+      : `tt.${f}`;
+  });
+  const last = sig.results[sig.results.length - 1];
+  const returnsError = !!last && identical(last.type!, errorType());
+  const values = returnsError ? sig.results.slice(0, -1) : sig.results;
+  const wants = values.map((r, i) =>
+    field(i === 0 ? 'want' : `want${i}`, typeText(r.type!))
+  );
+  const wantErr = returnsError ? field('wantErr', 'bool') : undefined;
+
+  const callee = recvField
+    ? `tt.${recvField}.${obj.name}`
+    : testPkg.isXTest
+      ? `${qualifier({ path: pkg.importPath, name: pkg.name })}.${obj.name}`
+      : obj.name;
+  const call = `${callee}(${args.join(', ')})`;
+  const label = `${functionName}()`;
+  const gots = values.map((_, i) => (i === 0 ? 'got' : `got${i}`));
+
+  const body: string[] = [];
+  const errorCheck = `\t\t\t\tt.Errorf("${label} error = %v, wantErr %v", err, tt.${wantErr})`;
+  if (gots.length === 0 && wantErr) {
+    body.push(
+      `\t\t\tif err := ${call}; (err != nil) != tt.${wantErr} {`,
+      errorCheck,
+      '\t\t\t}'
+    );
+  } else {
+    const lhs = [...gots, ...(wantErr ? ['err'] : [])];
+    body.push(`\t\t\t${lhs.length > 0 ? `${lhs.join(', ')} := ` : ''}${call}`);
+    if (wantErr) {
+      body.push(
+        `\t\t\tif (err != nil) != tt.${wantErr} {`,
+        errorCheck,
+        '\t\t\t\treturn',
+        '\t\t\t}'
+      );
+    }
+    values.forEach((r, i) => {
+      const got = gots[i];
+      const want = `tt.${wants[i]}`;
+      let differs = `${got} != ${want}`;
+      if (!isComparable(r.type!)) {
+        const reflect = qualifier({ path: 'reflect', name: 'reflect' });
+        differs = `!${reflect}.DeepEqual(${got}, ${want})`;
+      }
+      const what = values.length === 1 ? '' : ` ${got}`;
+      body.push(
+        `\t\t\tif ${differs} {`,
+        `\t\t\t\tt.Errorf("${label}${what} = %v, want %v", ${got}, ${want})`,
+        '\t\t\t}'
+      );
+    });
+  }
+
+  const width = Math.max(...fields.map(([name]) => name.length));
+  const text = [
+    `func ${testName}(t *testing.T) {`,
+    '\ttests := []struct {',
+    ...fields.map(([name, type]) => `\t\t${name.padEnd(width)} ${type}`),
+    '\t}{',
+    '\t\t// TODO: Add test cases.',
+    '\t}',
+    '\tfor _, tt := range tests {',
+    '\t\tt.Run(tt.name, func(t *testing.T) {',
+    ...body,
+    '\t\t})',
+    '\t}',
+    '}',
+    '',
+  ].join('\n');
+
+  const tail = dest.src.endsWith('\n') ? '\n' : '\n\n';
+  const updated = applyTextEdits(dest.src, [
+    ...addImportEdits(dest, missing),
+    { pos: dest.src.length, end: dest.src.length, newText: tail + text },
+  ]);
+
+  return {
+    functionName,
+    testName,
+    testFile: displayPath(testPath),
+    packageName: testPkg.name,
+    created: !existing,
+    changes: await commitFileChanges(
+      [{ filePath: testPath, original: existing?.src ?? '', updated }],
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+export function formatGenerateTestsResults(
+  result: GenerateTestsResult
+): string {
+  const created = result.created ? ' (new file)' : '';
+  return `Generated ${result.testName} for '${result.functionName}' in ${result.testFile}${created}, package ${result.packageName}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,341 @@
+import type {
+  CommentGroup,
+  GenDecl,
+  ImportSpec,
+  Node,
+  Spec,
+  ValueSpec,
+} from '../utils/go-ast.js';
+import { inspect } from '../utils/go-ast.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  importPathOf,
+  indentAt,
+  layoutGroup,
+  lineEnd,
+  reindent,
+} from '../utils/go-edit.js';
+import type { GroupLine } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { locationOf } from '../utils/go-references.js';
+import type { GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { displayPath } from '../utils/file-utils.js';
+
+export interface GroupDeclarationsOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  dryRun?: boolean;
+}
+
+export interface DeclarationGroup {
+  keyword: 'import' | 'const' | 'var';
+  // Where the first of the merged declarations was, as path:line:column.
+  location: string;
+  // The number of declarations merged into the group.
+  declarations: number;
+}
+
+export interface GroupDeclarationsResult {
+  filePath: string;
+  groups: DeclarationGroup[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+type Keyword = DeclarationGroup['keyword'];
+
+// A spec, comment or empty line of a merged group, in source order.
+type Item =
+  | { kind: 'spec'; spec: Spec; decl: GenDecl }
+  | { kind: 'comment'; group: CommentGroup; decl: GenDecl }
+  | { kind: 'blank' };
+
+// Returns the ranges of spec that are written into the group as they are.
+function partsOf(spec: Spec): Node[] {
+  if (spec.type === 'ImportSpec') {
+    return spec.name ? [spec.name, spec.path] : [spec.path];
+  }
+  if (spec.type !== 'ValueSpec') return [];
+  const { names, valueType, values } = spec;
+  const parts: Node[] = [{ pos: names[0].pos, end: names.at(-1)!.end }];
+  if (valueType) parts.push(valueType);
+  if (values.length > 0) {
+    parts.push({ pos: values[0].pos, end: values.at(-1)!.end });
+  }
+  return parts;
+}
+
+// Returns where decl ends, together with the line comment of an ungrouped
+// declaration.
+function endOf(decl: GenDecl): number {
+  if (decl.lparen >= 0) return decl.end;
+  return decl.specs[0].comment?.end ?? decl.end;
+}
+
+// Reports whether decl uses the predeclared iota, rather than a
+// declaration of that name.
+function usesIota(info: GoInfo, decl: GenDecl): boolean {
+  let found = false;
+  inspect(decl, n => {
+    const used = n.type === 'Ident' ? info.uses.get(n) : undefined;
+    if (used?.name === 'iota' && used.pos < 0) found = true;
+  });
+  return found;
+}
+
+// Reports whether decl can be merged with others without losing a comment
+// or the meaning of a spec: cgo imports must stay next to their preamble,
+// nothing but a line comment may follow it on its last line, and every
+// comment must be a doc or line comment, lie between the specs of a group,
+// or lie within a part of a spec that is kept as written.
+function mergeable(file: GoSourceFile, decl: GenDecl): boolean {
+  if (decl.tok === 'type') return false;
+  if (
+    decl.tok === 'import' &&
+    (decl.specs as ImportSpec[]).some(s => importPathOf(s) === 'C')
+  ) {
+    return false;
+  }
+  const { src } = file;
+  const end = endOf(decl);
+  if (src.substring(end, lineEnd(src, end)).trim() !== '') return false;
+  const parts = decl.specs.flatMap(partsOf);
+  return file.ast.comments.every(
+    g =>
+      g.end <= decl.pos ||
+      g.pos >= end ||
+      decl.specs.some(s => s.doc === g || s.comment === g) ||
+      (decl.lparen >= 0 &&
+        g.pos > decl.lparen &&
+        g.end <= decl.rparen &&
+        !decl.specs.some(s => s.pos < g.pos && g.end <= s.end)) ||
+      parts.some(p => p.pos <= g.pos && g.end <= p.end)
+  );
+}
+
+// Returns where decl starts, together with its doc comment.
+function startOf(decl: GenDecl): number {
+  return decl.doc?.pos ?? decl.pos;
+}
+
+// Splits decls into runs that can be merged: declarations of the same
+// keyword with nothing but white space between them. A const declaration
+// using iota starts a run, as iota counts the specs of its group.
+function runsOf(info: GoInfo, file: GoSourceFile): GenDecl[][] {
+  const runs: GenDecl[][] = [];
+  let run: GenDecl[] = [];
+  for (const decl of file.ast.decls) {
+    const prev = run[run.length - 1];
+    const ok = decl.type === 'GenDecl' && mergeable(file, decl);
+    if (
+      !ok ||
+      !prev ||
+      prev.tok !== decl.tok ||
+      file.src.substring(endOf(prev), startOf(decl)).trim() !== '' ||
+      (decl.tok === 'const' && usesIota(info, decl))
+    ) {
+      if (run.length > 1) runs.push(run);
+      run = ok ? [decl] : [];
+      continue;
+    }
+    run.push(decl);
+  }
+  if (run.length > 1) runs.push(run);
+  return runs;
+}
+
+function newlines(text: string): number {
+  return text.split('\n').length - 1;
+}
+
+// Lists the items of run in source order. The doc comment of an ungrouped
+// declaration documents its spec and goes with it, as does the doc comment
+// of a group merged into the first one. That of the first group stays
+// above the new group.
+function itemsOf(file: GoSourceFile, run: GenDecl[]): Item[] {
+  const { src } = file;
+  const items: Item[] = [];
+  let last = -1;
+  const add = (item: Item, pos: number, end: number) => {
+    if (last >= 0 && newlines(src.substring(last, pos)) > 1) {
+      items.push({ kind: 'blank' });
+    }
+    items.push(item);
+    last = end;
+  };
+  for (const decl of run) {
+    if (decl !== run[0]) {
+      const between = src.substring(last, startOf(decl));
+      if (newlines(between) > 1) items.push({ kind: 'blank' });
+    }
+    last = -1;
+    if (decl.doc && (decl.lparen < 0 || decl !== run[0])) {
+      const group = decl.doc;
+      add({ kind: 'comment', group, decl }, group.pos, group.end);
+    }
+    if (decl.lparen < 0) {
+      const spec = decl.specs[0];
+      add({ kind: 'spec', spec, decl }, decl.pos, endOf(decl));
+      continue;
+    }
+    // The items of a group are only compared with each other, the doc
+    // comment of the group lying right above it.
+    last = -1;
+    const lines = file.ast.comments.filter(
+      g =>
+        g.pos > decl.lparen &&
+        g.end <= decl.rparen &&
+        !decl.specs.some(s => s.comment === g)
+    );
+    const nodes = [...decl.specs, ...lines].sort((a, b) => a.pos - b.pos);
+    for (const node of nodes) {
+      if ('list' in node) {
+        add({ kind: 'comment', group: node, decl }, node.pos, node.end);
+      } else {
+        const end = node.comment?.end ?? node.end;
+        add({ kind: 'spec', spec: node, decl }, node.pos, end);
+      }
+    }
+    last = decl.end;
+  }
+  return items;
+}
+
+// Sorts the imports of each run of consecutive lines by path, as gofmt
+// does, and drops repeated ones. Comments directly above an import move
+// with it.
+function sortImports(items: Item[]): Item[] {
+  const sorted: Item[] = [];
+  let units: Item[][] = [];
+  let pending: Item[] = [];
+  const flush = () => {
+    const seen = new Set<string>();
+    const key = (unit: Item[]) => {
+      const item = unit[unit.length - 1];
+      if (item.kind !== 'spec') return '';
+      const spec = item.spec as ImportSpec;
+      return `${importPathOf(spec)} ${spec.name?.name ?? ''}`;
+    };
+    units = units.filter(u => {
+      const k = key(u);
+      if (seen.has(k)) return false;
+      seen.add(k);
+      return true;
+    });
+    units.sort((a, b) => (key(a) < key(b) ? -1 : key(a) > key(b) ? 1 : 0));
+    sorted.push(...units.flat(), ...pending);
+    units = [];
+    pending = [];
+  };
+  for (const item of items) {
+    if (item.kind === 'blank') {
+      flush();
+      sorted.push(item);
+    } else if (item.kind === 'comment') {
+      pending.push(item);
+    } else {
+      units.push([...pending, item]);
+      pending = [];
+    }
+  }
+  flush();
+  return sorted;
+}
+
+// Returns the text of node as written in the group, re-indented from the
+// declaration it comes from.
+function textOf(file: GoSourceFile, decl: GenDecl, node: Node): string {
+  const from = indentAt(file.src, decl.lparen >= 0 ? node.pos : decl.pos);
+  return reindent(file, node.pos, node.end, from, '\t').substring(1);
+}
+
+function lineOf(file: GoSourceFile, item: Item): GroupLine {
+  if (item.kind === 'blank') return item;
+  if (item.kind === 'comment') {
+    return { kind: 'comment', text: textOf(file, item.decl, item.group) };
+  }
+  const { spec, decl } = item;
+  const text = (node: Node) => textOf(file, decl, node);
+  const parts = partsOf(spec);
+  const comment = spec.comment && text(spec.comment);
+  if (spec.type === 'ImportSpec') {
+    return { kind: 'spec', names: parts.map(text).join(' '), comment };
+  }
+  const value = spec as ValueSpec;
+  return {
+    kind: 'spec',
+    names: text(parts[0]),
+    type: value.valueType && text(value.valueType),
+    values: value.values.length > 0 ? text(parts[parts.length - 1]) : undefined,
+    comment,
+  };
+}
+
+export async function performGroupDeclarations(
+  options: GroupDeclarationsOptions
+): Promise<GroupDeclarationsResult> {
+  const { dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+
+  const groups: DeclarationGroup[] = [];
+  const edits: TextEdit[] = [];
+  for (const run of runsOf(info, file)) {
+    const first = run[0];
+    const keyword = first.tok as Keyword;
+    let items = itemsOf(file, run);
+    if (keyword === 'import') items = sortImports(items);
+    const pos = first.lparen < 0 ? startOf(first) : first.pos;
+    edits.push({
+      pos,
+      end: endOf(run[run.length - 1]),
+      newText: layoutGroup(
+        keyword,
+        items.map(item => lineOf(file, item))
+      ),
+    });
+    groups.push({
+      keyword,
+      location: locationOf(file, first.pos),
+      declarations: run.length,
+    });
+  }
+
+  const changes: FileChange[] = [];
+  if (edits.length > 0) {
+    changes.push({
+      filePath: file.filePath,
+      original: file.src,
+      updated: applyTextEdits(file.src, edits),
+    });
+  }
+  return {
+    filePath: displayPath(file.filePath),
+    groups,
+    changes: await commitFileChanges(changes, dryRun, options),
+    dryRun,
+  };
+}
+
+export function formatGroupDeclarationsResults(
+  result: GroupDeclarationsResult
+): string {
+  if (result.groups.length === 0) {
+    return `No adjacent declarations to group in ${result.filePath}`;
+  }
+  const count = result.groups.length;
+  const lines = result.groups.map(
+    g => `  ${g.keyword} at ${g.location}: ${g.declarations} declarations`
+  );
+  return `Grouped declarations into ${count} block${count === 1 ? '' : 's'}:\n${lines.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
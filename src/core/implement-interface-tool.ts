@@ -0,0 +1,278 @@
+import type { FuncDecl, FuncType, GenDecl } from '../utils/go-ast.js';
+import { isExported } from '../utils/go-ast.js';
+import {
+  addImportEdits,
+  fileQualifier,
+  lineEnd,
+  packageNamed,
+  transplant,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { GoProgram, LoadOptions } from '../utils/go-loader.js';
+import { implementsInterface, typeString, under } from '../utils/go-types.js';
+import type { GoObject, GoSourceFile, Qualifier } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type { FileChange, WriteOptions } from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ImplementInterfaceOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  // A type declared in the package of filePath.
+  typeName: string;
+  // An interface of the module, qualified by its package name when it is
+  // declared in another package, as in store.Store.
+  interfaceName: string;
+  dryRun?: boolean;
+}
+
+export interface ImplementInterfaceResult {
+  // The interface as qualified in the file declaring the type.
+  interfaceName: string;
+  // The type that implements the interface: T, or *T when the methods have
+  // pointer receivers.
+  implementedBy: string;
+  // Names of the stubbed methods, empty when nothing was missing.
+  added: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// Resolves name, possibly qualified by a package name as seen from file, to
+// an interface type declared in the module.
+function resolveInterface(
+  program: GoProgram,
+  file: GoSourceFile,
+  name: string
+): GoObject {
+  const dot = name.indexOf('.');
+  let obj: GoObject | undefined;
+  if (dot < 0) {
+    obj = file.pkg.scope?.lookup(name);
+  } else {
+    const qualifier = name.substring(0, dot);
+    const pkg = packageNamed(program, file, new Map(), qualifier);
+    if (pkg && !program.packageByImportPath(pkg.path)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Package ${pkg.path} is outside the module, so the methods of ${name} are unknown`
+      );
+    }
+    const scope = pkg && program.packageByImportPath(pkg.path)?.scope;
+    obj = scope?.lookup(name.substring(dot + 1));
+  }
+  if (
+    obj?.kind !== 'type' ||
+    !obj.type ||
+    under(obj.type).kind !== 'interface'
+  ) {
+    throw new ToolError(
+      'symbol_not_found',
+      `'${name}' is not an interface declared in the module`
+    );
+  }
+  if (obj.typeParams?.length) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot implement the generic interface '${name}'`
+    );
+  }
+  return obj;
+}
+
+function declsOf(typeObj: GoObject): FuncDecl[] {
+  return (typeObj.methods ?? []).flatMap(m =>
+    m.decl?.type === 'FuncDecl' ? [m.decl] : []
+  );
+}
+
+// Picks the receiver name used most often by the existing methods, or the
+// initial of the type name when there are none.
+function receiverName(typeObj: GoObject, decls: FuncDecl[]): string {
+  const counts = new Map<string, number>();
+  for (const decl of decls) {
+    const name = decl.recv?.list[0]?.names[0]?.name;
+    if (name && name !== '_') counts.set(name, (counts.get(name) ?? 0) + 1);
+  }
+  let best = '';
+  for (const [name, count] of counts) {
+    if (!best || count > counts.get(best)!) best = name;
+  }
+  if (best) return best;
+  return /\p{L}/u.exec(typeObj.name)?.[0].toLowerCase() ?? 'r';
+}
+
+function funcTypeOf(m: GoObject): FuncType {
+  if (m.decl?.type === 'Field' && m.decl.fieldType.type === 'FuncType') {
+    return m.decl.fieldType;
+  }
+  throw new ToolError(
+    'symbol_not_found',
+    `Cannot find the declaration of method '${m.name}'`
+  );
+}
+
+// Returns the stub declaration of interface method m on the receiver.
+function stub(
+  program: GoProgram,
+  file: GoSourceFile,
+  m: GoObject,
+  recvName: string,
+  recvType: string,
+  label: string,
+  qualifier: Qualifier
+): string {
+  const origin = m.file;
+  if (!origin) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Method '${m.name}' is declared outside the module`
+    );
+  }
+  if (!isExported(m.name) && origin.pkg !== file.pkg) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Method '${m.name}' of ${label} is unexported, so types outside package ${origin.pkg.name} cannot implement it`
+    );
+  }
+  const ft = funcTypeOf(m);
+  const sig = transplant(
+    program,
+    new Map(),
+    `func${origin.src.substring(ft.params.pos, ft.end)}`,
+    origin,
+    file,
+    undefined,
+    qualifier
+  ).substring('func'.length);
+  // A receiver named like a parameter would clash with it.
+  const params = [...ft.params.list, ...(ft.results?.list ?? [])];
+  const clash = params.some(f => f.names.some(id => id.name === recvName));
+  const recv = clash ? recvType : `${recvName} ${recvType}`;
+  return `// ${m.name} implements ${label}.\nfunc (${recv}) ${m.name}${sig} {\n\tpanic("not implemented")\n}\n`;
+}
+
+export async function performImplementInterface(
+  options: ImplementInterfaceOptions
+): Promise<ImplementInterfaceResult> {
+  const { dryRun = false } = options;
+  const { program, file: given } = await loadGoFile(options.filePath, options);
+  program.check();
+  const pkg = given.pkg;
+  const typeObj = pkg.scope?.lookup(options.typeName);
+  if (
+    typeObj?.kind !== 'type' ||
+    typeObj.type?.kind !== 'named' ||
+    !typeObj.file
+  ) {
+    throw new ToolError(
+      'symbol_not_found',
+      `'${options.typeName}' is not a type declared in package ${pkg.name}`
+    );
+  }
+  const kind = under(typeObj.type).kind;
+  if (kind === 'interface' || kind === 'pointer') {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot declare methods on '${typeObj.name}'`
+    );
+  }
+  const file = typeObj.file;
+  const ifaceObj = resolveInterface(program, given, options.interfaceName);
+  const missing: ImportRequest[] = [];
+  const qualifier = fileQualifier(file, missing);
+  const label = typeString(ifaceObj.type!, fileQualifier(file));
+
+  const decls = declsOf(typeObj);
+  // Stubs follow the receivers of the existing methods, and a pointer
+  // receiver when there are none.
+  const pointer =
+    decls.length === 0 ||
+    decls.some(d => d.recv?.list[0]?.fieldType.type === 'StarExpr');
+  const implementedBy = `${pointer ? '*' : ''}${typeObj.name}`;
+
+  const result = implementsInterface(typeObj.type, ifaceObj.type!, pointer);
+  const struct = under(typeObj.type);
+  for (const m of result.missing) {
+    if (typeObj.methods?.some(x => x.name === m.name)) {
+      throw new ToolError(
+        'name_conflict',
+        `'${typeObj.name}' already has a method ${m.name}, but its signature differs from the one in ${label}`
+      );
+    }
+    if (
+      struct.kind === 'struct' &&
+      struct.fields.some(f => f.name === m.name)
+    ) {
+      throw new ToolError(
+        'name_conflict',
+        `'${typeObj.name}' has a field ${m.name}, so it cannot have a method of that name`
+      );
+    }
+  }
+  if (!pointer && result.pointerOnly.length > 0) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Methods ${result.pointerOnly.map(m => m.name).join(', ')} of '${typeObj.name}' have pointer receivers, so only *${typeObj.name} can implement ${label}`
+    );
+  }
+  const absent = result.missing;
+  if (absent.length === 0) {
+    return {
+      interfaceName: label,
+      implementedBy,
+      added: [],
+      changes: [],
+      dryRun,
+    };
+  }
+
+  const typeDecl = file.ast.decls.find(
+    (d): d is GenDecl =>
+      d.type === 'GenDecl' && d.pos <= typeObj.pos && typeObj.pos < d.end
+  );
+  const typeParams = (typeObj.typeParams ?? []).map(p => p.name);
+  const args = typeParams.length > 0 ? `[${typeParams.join(', ')}]` : '';
+  const recvType = `${pointer ? '*' : ''}${typeObj.name}${args}`;
+  const recvName = receiverName(typeObj, decls);
+  const stubs = absent.map(m =>
+    stub(program, file, m, recvName, recvType, label, qualifier)
+  );
+
+  // Stubs go after the last method declared in the type's file, or after
+  // the type itself.
+  const ends = decls
+    .filter(d => file.ast.decls.includes(d))
+    .map(d => d.end);
+  const pos = lineEnd(file.src, Math.max(typeDecl?.end ?? 0, ...ends));
+  const sep = file.src[pos - 1] === '\n' ? '' : '\n';
+  const updated = applyTextEdits(file.src, [
+    ...addImportEdits(file, missing),
+    { pos, end: pos, newText: `${sep}\n${stubs.join('\n')}` },
+  ]);
+  return {
+    interfaceName: label,
+    implementedBy,
+    added: absent.map(m => m.name),
+    changes: await commitFileChanges(
+      [{ filePath: file.filePath, original: file.src, updated }],
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+export function formatImplementInterfaceResults(
+  result: ImplementInterfaceResult
+): string {
+  if (result.added.length === 0) {
+    return `${result.implementedBy} already implements ${result.interfaceName}`;
+  }
+  const count = result.added.length;
+  return `Added ${count} method${count === 1 ? '' : 's'} so that ${result.implementedBy} implements ${result.interfaceName}: ${result.added.join(', ')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,306 @@
+import type {
+  Expr,
+  GenDecl,
+  Ident,
+  Node,
+  SelectorExpr,
+  ValueSpec,
+} from '../utils/go-ast.js';
+import { inspect, isExported, pathEnclosingInterval } from '../utils/go-ast.js';
+import {
+  freeIdents,
+  isLocal,
+  resolveAt,
+  scopeAt,
+} from '../utils/go-analysis.js';
+import type { ConstValue } from '../utils/go-checker.js';
+import {
+  addImportEdits,
+  conversion,
+  declRemovalEdit,
+  fileQualifier,
+  needsParens,
+  specRemovalEdit,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { exclusionWarnings, loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  locationOf,
+  resolveSymbol,
+} from '../utils/go-references.js';
+import type { GoSymbolInput } from '../utils/go-references.js';
+import {
+  identical,
+  isUntyped,
+  sameObject,
+  typeString,
+} from '../utils/go-types.js';
+import type { GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface InlineConstantOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoSymbolInput {
+  filePath: string;
+  dryRun?: boolean;
+}
+
+export interface InlineConstantResult {
+  name: string;
+  // The expression of the declaration, or the value of the constant where
+  // the declaration has no expression of its own.
+  value: string;
+  uses: number;
+  // What happened to the declaration: removed, kept as _ so that the
+  // constants after it keep their values, or kept because files excluded
+  // by build constraints may still use it.
+  declaration: 'removed' | 'blank' | 'kept';
+  warnings: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+interface Use {
+  file: GoSourceFile;
+  // The identifier, or the qualified identifier in other packages.
+  node: Ident | SelectorExpr;
+}
+
+// The kinds of untyped constants whose values literalOf writes.
+const UNTYPED_KINDS: Record<string, string> = {
+  bigint: 'untyped int',
+  boolean: 'untyped bool',
+  string: 'untyped string',
+};
+
+// Writes a constant value as a Go literal, if it has a kind that can be
+// written exactly.
+function literalOf(value: ConstValue | undefined): string | undefined {
+  if (typeof value === 'bigint' || typeof value === 'boolean') {
+    return String(value);
+  }
+  if (typeof value === 'string') return JSON.stringify(value);
+  return undefined;
+}
+
+// Returns the edit deleting the constant's declaration, or replacing its
+// name by _ where later constants of the group repeat its expression or
+// use iota, whose values would otherwise change.
+function declarationEdit(
+  file: GoSourceFile,
+  gen: GenDecl,
+  spec: ValueSpec,
+  name: Ident
+): { edit: TextEdit; blank: boolean } {
+  const later = gen.specs.slice(gen.specs.indexOf(spec) + 1) as ValueSpec[];
+  const iota = (s: ValueSpec) =>
+    s.values.length === 0 ||
+    s.values.some(v => {
+      let found = false;
+      inspect(v, n => {
+        if (n.type === 'Ident' && n.name === 'iota') found = true;
+      });
+      return found;
+    });
+  if (spec.names.length > 1 || later.some(iota)) {
+    const edit = { pos: name.pos, end: name.end, newText: '_' };
+    return { edit, blank: true };
+  }
+  return {
+    edit:
+      gen.specs.length > 1
+        ? specRemovalEdit(file.src, spec)
+        : declRemovalEdit(file.src, gen),
+    blank: false,
+  };
+}
+
+export async function performInlineConstant(
+  options: InlineConstantOptions
+): Promise<InlineConstantResult> {
+  const { dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const checker = program.check();
+  const info = checker.info;
+  const { obj } = resolveSymbol(program, file, options);
+  const { name } = obj;
+  const spec = obj.decl;
+  if (obj.kind !== 'const' || spec?.type !== 'ValueSpec' || !obj.file) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${name}' is not a constant declared in the module`
+    );
+  }
+  const declFile = obj.file;
+  const index = spec.names.findIndex(n => n.pos === obj.pos);
+  const gen = pathEnclosingInterval(declFile.ast, spec.pos, spec.end).find(
+    (n): n is GenDecl => n.type === 'GenDecl' && n.specs.includes(spec)
+  )!;
+  const t = obj.type!;
+
+  // The expression is used as written unless it is repeated from an
+  // earlier spec or depends on iota, in which case the value is.
+  const expr = spec.values[index] as Expr | undefined;
+  const usesIota =
+    !!expr &&
+    freeIdents(info, expr).some(id => info.uses.get(id)?.name === 'iota');
+  const own = expr && !usesIota ? expr : undefined;
+  const ownText = own && declFile.src.substring(own.pos, own.end);
+  const value = checker.objectConstValue(obj);
+  const valueText = literalOf(value);
+  // A constant of an untyped kind other than the value's, such as an
+  // untyped rune, is only written exactly by its expression.
+  const valueFits =
+    !!valueText &&
+    (!isUntyped(t) ||
+      (t.kind === 'basic' && UNTYPED_KINDS[typeof value] === t.name));
+
+  const uses: Use[] = [];
+  for (const f of program.files) {
+    const visit = (n: Node): boolean | void => {
+      if (n.type === 'SelectorExpr') {
+        if (sameObject(info.uses.get(n.sel), obj)) {
+          uses.push({ file: f, node: n });
+          return false;
+        }
+        inspect(n.x, visit);
+        return false;
+      }
+      if (n.type === 'Ident' && sameObject(info.uses.get(n), obj)) {
+        uses.push({ file: f, node: n });
+      }
+    };
+    inspect(f.ast, visit);
+  }
+  if (uses.length === 0) {
+    throw new ToolError('unsupported_construct', `'${name}' is never used`);
+  }
+
+  const free = own ? freeIdents(info, own) : [];
+  const edits = new Map<GoSourceFile, TextEdit[]>();
+  const missing = new Map<GoSourceFile, ImportRequest[]>();
+  const editsOf = (f: GoSourceFile) => {
+    if (!edits.has(f)) edits.set(f, []);
+    return edits.get(f)!;
+  };
+  for (const use of uses) {
+    const { file: f, node } = use;
+    const at = locationOf(f, node.pos);
+    const path = pathEnclosingInterval(f.ast, node.pos, node.end);
+    while (path[path.length - 1] !== node) path.pop();
+    const parent = path[path.length - 2];
+    const scope = scopeAt(info, path);
+    // The expression can be used where its names mean the same.
+    const asWritten =
+      !!own &&
+      free.every(id =>
+        sameObject(resolveAt(scope, id.name, node.pos), info.uses.get(id))
+      );
+    if (!asWritten && !valueFits) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot inline '${name}' at ${at}, where the names in its expression do not refer to the same declarations`,
+        errorLocation(f, node.pos)
+      );
+    }
+
+    let replacement = asWritten ? ownText! : valueText!;
+    const replacementType = asWritten ? info.typeOf(own!) : undefined;
+    if (!isUntyped(t) && !(replacementType && identical(replacementType, t))) {
+      // Typed constants are converted so that expressions keep their type.
+      if (
+        t.kind === 'named' &&
+        !isExported(t.obj.name) &&
+        t.obj.pkg !== f.pkg
+      ) {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot inline '${name}' at ${at}, where its type ${t.obj.name} cannot be named`,
+          errorLocation(f, node.pos)
+        );
+      }
+      if (!missing.has(f)) missing.set(f, []);
+      const typeText = typeString(t, fileQualifier(f, missing.get(f)));
+      replacement = conversion(typeText, replacement);
+    } else if (
+      (asWritten && needsParens(own!, parent, node)) ||
+      // Keeps -C from becoming --4.
+      (parent.type === 'UnaryExpr' && /^[-+^!]/.test(replacement))
+    ) {
+      replacement = `(${replacement})`;
+    }
+    editsOf(f).push({ pos: node.pos, end: node.end, newText: replacement });
+  }
+
+  // Files left out by build constraints may use the constant too.
+  const warnings = isLocal(obj)
+    ? []
+    : exclusionWarnings(program, [declFile.pkg]);
+  let declaration: InlineConstantResult['declaration'] = 'kept';
+  if (warnings.length === 0) {
+    const { edit, blank } = declarationEdit(
+      declFile,
+      gen,
+      spec,
+      spec.names[index]
+    );
+    editsOf(declFile).push(edit);
+    declaration = blank ? 'blank' : 'removed';
+  }
+
+  const changes = await commitFileChanges(
+    [...edits].map(([f, fileEdits]) => ({
+      filePath: f.filePath,
+      original: f.src,
+      updated: applyTextEdits(f.src, [
+        ...addImportEdits(f, missing.get(f) ?? []),
+        ...fileEdits,
+      ]),
+    })),
+    dryRun,
+    options
+  );
+
+  return {
+    name,
+    value: ownText ?? valueText ?? '',
+    uses: uses.length,
+    declaration,
+    warnings,
+    changes,
+    dryRun,
+  };
+}
+
+export function formatInlineConstantResults(
+  result: InlineConstantResult
+): string {
+  const uses = result.uses === 1 ? '1 use' : `${result.uses} uses`;
+  const output = [
+    `Inlined constant '${result.name}' (${result.value}) at ${uses}`,
+  ];
+  if (result.declaration === 'removed') {
+    output[0] += ' and removed its declaration';
+  } else if (result.declaration === 'blank') {
+    output[0] +=
+      ', renaming its declaration to _ so that the constants after it keep their values';
+  } else {
+    output[0] +=
+      ', keeping its declaration for the files excluded by build constraints:';
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,1077 @@
+import type {
+  BlockStmt,
+  CallExpr,
+  Expr,
+  FuncDecl,
+  IfStmt,
+  Node,
+  ReturnStmt,
+  Stmt,
+} from '../utils/go-ast.js';
+import {
+  inspect,
+  isExported,
+  pathEnclosingInterval,
+  unparen,
+} from '../utils/go-ast.js';
+import {
+  collectWrites,
+  isLocal,
+  isPure,
+  scopeAt,
+} from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  addImportEdits,
+  conversion,
+  declRemovalEdit,
+  fileQualifier,
+  indentAt,
+  lineEnd,
+  lineStart,
+  needsParens,
+  onlyComments,
+  pruneImports,
+  reindent,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  findReferences,
+  locationOf,
+  resolveLocation,
+  symbolAt,
+} from '../utils/go-references.js';
+import type { GoReference } from '../utils/go-references.js';
+import { defaultType, identical, typeString } from '../utils/go-types.js';
+import type {
+  GoObject,
+  GoSourceFile,
+  Qualifier,
+  SignatureType,
+  Type,
+} from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { step } from '../utils/task.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface InlineFunctionOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  offset?: number;
+  line?: number;
+  column?: number;
+  dryRun?: boolean;
+}
+
+export interface InlineFunctionResult {
+  functionName: string;
+  // Locations of the inlined calls, as path:line:column.
+  callSites: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+interface Callee {
+  obj: GoObject;
+  decl: FuncDecl;
+  body: BlockStmt;
+  file: GoSourceFile;
+  sig: SignatureType;
+  // The object of each parameter, undefined for unnamed ones.
+  params: (GoObject | undefined)[];
+  namedResults: GoObject[];
+  // Whether some return statement is not the last statement of the body,
+  // so that the if statements around it have to be restructured.
+  earlyReturns: boolean;
+  // Parameters that are assigned or captured by closures in the body and
+  // so must be bound to variables of their own.
+  rebound: Set<GoObject>;
+  // Package-level and predeclared names the body refers to unqualified.
+  freeNames: Map<string, GoObject>;
+}
+
+interface CallSite {
+  file: GoSourceFile;
+  call: CallExpr;
+  // Enclosing nodes from the file down to the call.
+  path: Node[];
+  location: string;
+}
+
+// Where the values of a translated return statement go: nowhere for a call
+// used as a statement, into variables, or out of the calling function.
+// Typed receivers convert untyped values implicitly.
+type Receiver =
+  | { kind: 'discard' }
+  | { kind: 'assign'; lhs: string; tok: string; typed: boolean }
+  | { kind: 'return'; typed: boolean };
+
+interface FileEdits {
+  edits: TextEdit[];
+  missing: ImportRequest[];
+  qualifier: Qualifier;
+}
+
+function containsReturn(n: Node): boolean {
+  let found = false;
+  inspect(n, node => {
+    if (found || node.type === 'FuncLit') return false;
+    if (node.type === 'ReturnStmt') found = true;
+  });
+  return found;
+}
+
+// Checks that every return statement in stmts can be translated in place:
+// it must end the list, or end a branch of an if statement whose remaining
+// statements can become the else branch. Returns whether stmts always end
+// in a return.
+function checkReturns(name: string, stmts: Stmt[]): boolean {
+  for (let i = 0; i < stmts.length; i++) {
+    const s = stmts[i];
+    const last = i === stmts.length - 1;
+    if (s.type === 'ReturnStmt') {
+      if (!last) {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot inline '${name}', which has unreachable code after a return statement`
+        );
+      }
+      return true;
+    }
+    if (!containsReturn(s)) continue;
+    if (s.type !== 'IfStmt') {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot inline '${name}', which returns from inside a ${s.type.replace(/Stmt$/, '').toLowerCase()} statement`
+      );
+    }
+    if (!s.else) {
+      if (!checkReturns(name, s.body.list)) {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot inline '${name}', which has an if statement that only returns on some paths`
+        );
+      }
+      return checkReturns(name, stmts.slice(i + 1));
+    }
+    if (!last) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot inline '${name}', which has an if-else statement with returns followed by more statements`
+      );
+    }
+    const thenEnds = checkReturns(name, s.body.list);
+    const elseEnds =
+      s.else.type === 'BlockStmt'
+        ? checkReturns(name, s.else.list)
+        : checkReturns(name, [s.else]);
+    return thenEnds && elseEnds;
+  }
+  return false;
+}
+
+function analyzeCallee(info: GoInfo, obj: GoObject): Callee {
+  const decl = obj.decl;
+  if (obj.kind !== 'func' || decl?.type !== 'FuncDecl' || !obj.file) {
+    throw new ToolError(
+      'symbol_not_found',
+      `'${obj.name}' is not a function declared in the module`
+    );
+  }
+  if (decl.recv) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is a method; only functions can be inlined`
+    );
+  }
+  if (!decl.body) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' has no body to inline`
+    );
+  }
+  if (decl.funcType.typeParams) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot inline the generic function '${obj.name}'`
+    );
+  }
+  const body = decl.body;
+
+  inspect(body, n => {
+    if (n.type === 'FuncLit') return false;
+    if (n.type === 'DeferStmt') {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot inline '${obj.name}', whose defer statements would run when the caller returns`
+      );
+    }
+    if (n.type === 'LabeledStmt') {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot inline '${obj.name}', which declares labels`
+      );
+    }
+    if (n.type === 'CallExpr' && n.fun.type === 'Ident') {
+      const fn = info.uses.get(n.fun);
+      if (fn?.kind === 'builtin' && fn.name === 'recover') {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot inline '${obj.name}', which calls recover`
+        );
+      }
+    }
+  });
+  checkReturns(obj.name, body.list);
+
+  let returns = 0;
+  inspect(body, n => {
+    if (n.type === 'FuncLit') return false;
+    if (n.type === 'ReturnStmt') returns++;
+  });
+  const lastStmt = body.list[body.list.length - 1];
+  const earlyReturns =
+    returns > 1 || (returns === 1 && lastStmt?.type !== 'ReturnStmt');
+
+  const params: (GoObject | undefined)[] = [];
+  for (const field of decl.funcType.params.list) {
+    if (field.names.length === 0) params.push(undefined);
+    for (const name of field.names) params.push(info.defs.get(name));
+  }
+  const namedResults: GoObject[] = [];
+  for (const field of decl.funcType.results?.list ?? []) {
+    for (const name of field.names) {
+      const result = info.defs.get(name);
+      if (result) namedResults.push(result);
+    }
+  }
+
+  // A parameter bound to the argument expression itself must not be
+  // assigned, and closures must not capture it in place of a copy.
+  const rebound = new Set<GoObject>();
+  for (const id of collectWrites(info, [body]).modified) {
+    const v = info.objectOf(id);
+    if (v) rebound.add(v);
+  }
+  inspect(body, n => {
+    if (n.type !== 'FuncLit') return;
+    inspect(n, m => {
+      const v = m.type === 'Ident' ? info.uses.get(m) : undefined;
+      if (v) rebound.add(v);
+    });
+    return false;
+  });
+
+  const freeNames = new Map<string, GoObject>();
+  const collectFree = (n: Node) => {
+    // Selectors name fields, methods and members of imported packages,
+    // which are resolved through their operand.
+    if (n.type === 'SelectorExpr') {
+      inspect(n.x, collectFree);
+      return false;
+    }
+    const v = n.type === 'Ident' ? info.uses.get(n) : undefined;
+    if (v && (v.parent?.kind === 'package' || v.parent?.kind === 'universe')) {
+      freeNames.set(v.name, v);
+    }
+  };
+  inspect(body, collectFree);
+
+  return {
+    obj,
+    decl,
+    body,
+    file: obj.file,
+    sig: obj.type as SignatureType,
+    params,
+    namedResults,
+    earlyReturns,
+    rebound,
+    freeNames,
+  };
+}
+
+// Finds the calls to callee. Any other use, such as taking the function as
+// a value, makes inlining impossible without keeping the declaration.
+function findCallSites(
+  callee: Callee,
+  refs: GoReference[]
+): CallSite[] {
+  const sites: CallSite[] = [];
+  for (const ref of refs) {
+    if (ref.isDeclaration) continue;
+    const location = locationOf(ref.file, ref.pos);
+    if (
+      ref.file === callee.file &&
+      ref.pos >= callee.decl.pos &&
+      ref.pos < callee.decl.end
+    ) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot inline the recursive function '${callee.obj.name}'`
+      );
+    }
+    const path = pathEnclosingInterval(ref.file.ast, ref.pos, ref.end);
+    let i = path.length - 1;
+    const parent = path[i - 1];
+    if (parent?.type === 'SelectorExpr' && parent.sel === path[i]) i--;
+    while (path[i - 1]?.type === 'ParenExpr') i--;
+    const call = path[i - 1];
+    if (call?.type !== 'CallExpr' || call.fun !== path[i]) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot inline '${callee.obj.name}', which is used as a value at ${location}`,
+        errorLocation(ref.file, ref.pos)
+      );
+    }
+    const stmt = path[i - 2];
+    if (
+      (stmt?.type === 'GoStmt' || stmt?.type === 'DeferStmt') &&
+      unparen(stmt.call) === call
+    ) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot inline the call in a ${stmt.type === 'GoStmt' ? 'go' : 'defer'} statement at ${location}`,
+        errorLocation(ref.file, ref.pos)
+      );
+    }
+    sites.push({ file: ref.file, call, path: path.slice(0, i), location });
+  }
+  for (const site of sites) {
+    const outer = sites.find(
+      s =>
+        s !== site &&
+        s.file === site.file &&
+        s.call.pos <= site.call.pos &&
+        site.call.end <= s.call.end
+    );
+    if (outer) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot inline the call at ${site.location}, which is an argument of another call to '${callee.obj.name}'`,
+        errorLocation(site.file, site.call.pos)
+      );
+    }
+  }
+  return sites;
+}
+
+// Reports whether e may be used as an expression statement.
+function isCallStatement(info: GoInfo, e: Expr): boolean {
+  e = unparen(e);
+  if (e.type !== 'CallExpr') return false;
+  const mode = info.types.get(e.fun)?.mode;
+  if (mode === 'type') return false;
+  if (mode !== 'builtin') return true;
+  const fun = unparen(e.fun);
+  return (
+    fun.type === 'Ident' &&
+    ['clear', 'close', 'copy', 'delete', 'panic', 'print', 'println'].includes(
+      fun.name
+    )
+  );
+}
+
+// Returns the negation of cond, rendering expressions with text.
+function negate(cond: Expr, text: (e: Expr) => string): string {
+  if (cond.type === 'UnaryExpr' && cond.op === '!') return text(cond.x);
+  if (cond.type === 'BinaryExpr' && (cond.op === '==' || cond.op === '!=')) {
+    const op = cond.op === '==' ? '!=' : '==';
+    return `${text(cond.x)} ${op} ${text(cond.y)}`;
+  }
+  const primary = ['Ident', 'CallExpr', 'SelectorExpr', 'ParenExpr'];
+  return primary.includes(cond.type) ? `!${text(cond)}` : `!(${text(cond)})`;
+}
+
+function isStmtList(n: Node | undefined, stmt: Node): boolean {
+  if (n?.type === 'BlockStmt') return n.list.includes(stmt as Stmt);
+  if (n?.type === 'CaseClause' || n?.type === 'CommClause') {
+    return n.body.includes(stmt as Stmt);
+  }
+  return false;
+}
+
+// Finds the statement before which code evaluating the call at the end of
+// path can be placed without changing the order of evaluation, or explains
+// why there is none.
+function hoistTarget(
+  info: GoInfo,
+  path: Node[],
+  call: CallExpr,
+  location: string
+): Stmt {
+  let j = path.length - 1;
+  while (j > 0 && !isStmtList(path[j - 1], path[j])) j--;
+  const fail = (reason: string) =>
+    new ToolError(
+      'unsupported_construct',
+      `Cannot inline the call at ${location}, which is ${reason}`
+    );
+  if (j === 0) throw fail('not inside a function body');
+  for (let m = j; m < path.length - 1; m++) {
+    const parent = path[m];
+    const child = path[m + 1];
+    switch (parent.type) {
+      case 'BinaryExpr':
+        if ((parent.op === '&&' || parent.op === '||') && child === parent.y) {
+          throw fail(`evaluated conditionally by ${parent.op}`);
+        }
+        break;
+      case 'IfStmt':
+        if (child === parent.else) throw fail('part of an else-if condition');
+        if (child === parent.cond && parent.init) {
+          throw fail('evaluated after the initializer of its if statement');
+        }
+        break;
+      case 'SwitchStmt':
+      case 'TypeSwitchStmt':
+        if (child !== parent.init && parent.init) {
+          throw fail('evaluated after the initializer of its switch statement');
+        }
+        break;
+      case 'ForStmt':
+        if (child !== parent.init) throw fail('evaluated on every iteration');
+        break;
+      case 'CaseClause':
+      case 'CommClause':
+      case 'SelectStmt':
+        throw fail('evaluated only when its case is reached');
+    }
+  }
+  const stmt = path[j] as Stmt;
+  let earlier = false;
+  inspect(stmt, n => {
+    if (earlier || n.pos >= call.pos) return false;
+    if (n.end > call.pos) return;
+    if (n.type === 'UnaryExpr' && n.op === '<-') earlier = true;
+    if (n.type === 'CallExpr' && info.types.get(n.fun)?.mode !== 'type') {
+      earlier = true;
+    }
+    if (n.type === 'FuncLit') return false;
+  });
+  if (earlier) {
+    throw fail('preceded by other calls in the same statement');
+  }
+  return stmt;
+}
+
+function identNames(n: Node): Set<string> {
+  const names = new Set<string>();
+  inspect(n, m => {
+    if (m.type === 'Ident') names.add(m.name);
+  });
+  return names;
+}
+
+interface Argument {
+  text: string;
+  expr?: Expr;
+  type?: Type;
+  pure: boolean;
+}
+
+// Plans the edits replacing one call by the body of callee.
+function inlineCall(
+  info: GoInfo,
+  callee: Callee,
+  site: CallSite,
+  fileEdits: FileEdits,
+  taken: Set<string>
+): TextEdit[] {
+  const { sig, body } = callee;
+  const fnFile = callee.file;
+  const { file, call, path, location } = site;
+  const q = fileEdits.qualifier;
+  const scope = scopeAt(info, path);
+  const samePackage = file.pkg === fnFile.pkg;
+  const typeText = (t: Type) => typeString(t, q);
+  const fail = (reason: string) =>
+    new ToolError(
+      'unsupported_construct',
+      `Cannot inline the call at ${location}: ${reason}`,
+      errorLocation(file, call.pos)
+    );
+
+  // Names introduced by the inlined code must not collide with any name
+  // the caller uses, nor with the free names of the body.
+  const avoid = new Set([...taken, ...callee.freeNames.keys()]);
+  const introduced = new Set<string>();
+  const fresh = (name: string): string => {
+    if (name === '_') return name;
+    let result = name;
+    for (let k = 1; avoid.has(result) || introduced.has(result); k++) {
+      result = `${name}${k}`;
+    }
+    introduced.add(result);
+    return result;
+  };
+
+  for (const [name, obj] of callee.freeNames) {
+    if (!samePackage && obj.parent?.kind === 'package') continue;
+    const visible = scope?.lookupParent(name);
+    if (visible && visible !== obj) {
+      throw fail(
+        `the ${visible.kind} '${name}' declared there shadows the one '${callee.obj.name}' uses`
+      );
+    }
+  }
+
+  // Arguments, with variadic ones packed into a slice.
+  const args: Argument[] = call.args.map(e => ({
+    text: file.src.substring(e.pos, e.end),
+    expr: e,
+    type: info.typeOf(e),
+    pure: isPure(info, e),
+  }));
+  const replacements = new Map<GoObject, string>();
+  const prep: string[] = [];
+  const paramCount = sig.params.length;
+  const tuple =
+    call.args.length === 1 ? info.typeOf(call.args[0]) : undefined;
+  if (tuple?.kind === 'tuple') {
+    const names = callee.params.map((p, i) => {
+      if (!p || p.name === '_') return '_';
+      if (!identical(tuple.types[i], sig.params[i].type!)) {
+        throw fail('the argument types differ from the parameter types');
+      }
+      const name = fresh(p.name);
+      replacements.set(p, name);
+      return name;
+    });
+    const tok = names.every(n => n === '_') ? '=' : ':=';
+    prep.push(`${names.join(', ')} ${tok} ${args[0].text}`);
+    args.length = 0;
+  } else if (
+    call.args.length < paramCount - (sig.variadic ? 1 : 0) ||
+    (!sig.variadic && call.args.length > paramCount)
+  ) {
+    throw fail('its arguments could not be matched with the parameters');
+  } else if (sig.variadic && call.ellipsis === undefined) {
+    const extra = args.splice(paramCount - 1);
+    const sliceType = typeText(sig.params[paramCount - 1].type!);
+    args.push(
+      extra.length === 0
+        ? { text: '', pure: true }
+        : {
+            text: `${sliceType}{${extra.map(a => a.text).join(', ')}}`,
+            type: sig.params[paramCount - 1].type,
+            pure: extra.every(a => a.pure),
+          }
+    );
+  }
+
+  // Parameters are replaced by their arguments when those are constants
+  // or local variables that nothing can modify while the body runs, and
+  // bound to new variables otherwise.
+  const callerDecl = path[1];
+  const callerWrites = collectWrites(info, [callerDecl]);
+  const closureWrites = new Set<GoObject>();
+  inspect(callerDecl, n => {
+    if (n.type !== 'FuncLit') return;
+    for (const id of collectWrites(info, [n]).modified) {
+      const v = info.objectOf(id);
+      if (v) closureWrites.add(v);
+    }
+    return false;
+  });
+  const addressed = new Set(
+    [...callerWrites.addressed].map(id => info.objectOf(id))
+  );
+  const uses = new Map<GoObject, number>();
+  inspect(body, n => {
+    if (n.type !== 'Ident') return;
+    const v = info.uses.get(n);
+    if (v) uses.set(v, (uses.get(v) ?? 0) + 1);
+  });
+  args.forEach((arg, i) => {
+    const p = callee.params[i];
+    const pt = sig.params[i].type!;
+    if (!p || p.name === '_' || !uses.get(p)) {
+      if (!arg.pure) prep.push(`_ = ${arg.text}`);
+      return;
+    }
+    const e = arg.expr && unparen(arg.expr);
+    const v = e?.type === 'Ident' ? info.uses.get(e) : undefined;
+    const stable =
+      (v?.kind === 'var' &&
+        isLocal(v) &&
+        !addressed.has(v) &&
+        !closureWrites.has(v) &&
+        !!arg.type &&
+        identical(arg.type, pt)) ||
+      ((v?.kind === 'const' || e?.type === 'BasicLit') &&
+        !!arg.type &&
+        identical(defaultType(arg.type), pt));
+    if (stable && !callee.rebound.has(p)) {
+      replacements.set(p, arg.text);
+      return;
+    }
+    const name = fresh(p.name);
+    replacements.set(p, name);
+    if (!arg.text) {
+      prep.push(`var ${name} ${typeText(pt)}`);
+    } else if (arg.type && identical(defaultType(arg.type), pt)) {
+      prep.push(`${name} := ${arg.text}`);
+    } else {
+      prep.push(`var ${name} ${typeText(pt)} = ${arg.text}`);
+    }
+  });
+  for (const r of callee.namedResults) {
+    if (r.name === '_') continue;
+    const name = fresh(r.name);
+    replacements.set(r, name);
+    prep.push(`var ${name} ${typeText(r.type!)}`);
+  }
+
+  // Rewrite identifiers of the body for their new location: locals may be
+  // renamed, and package members need qualifying from another package.
+  const edits: TextEdit[] = [];
+  const localNames = new Map<string, string>();
+  const isBodyLocal = (v: GoObject) =>
+    isLocal(v) && v.file === fnFile && v.pos >= body.pos && v.pos < body.end;
+  const qualify = (pkgPath: string, pkgName: string): string => {
+    const name = q({ path: pkgPath, name: pkgName });
+    const visible = name ? scope?.lookupParent(name) : undefined;
+    if (visible && visible.kind !== 'pkgname') {
+      throw fail(`the package name '${name}' is shadowed there`);
+    }
+    return name;
+  };
+  inspect(body, n => {
+    if (n.type === 'SelectorExpr' && n.x.type === 'Ident') {
+      const pkg = info.uses.get(n.x);
+      if (pkg?.kind === 'pkgname' && pkg.imported) {
+        const member = info.uses.get(n.sel);
+        const name = qualify(pkg.imported, member?.pkg?.name ?? pkg.name);
+        if (!name) {
+          edits.push({ pos: n.x.pos, end: n.sel.pos, newText: '' });
+        } else if (name !== n.x.name) {
+          edits.push({ pos: n.x.pos, end: n.x.end, newText: name });
+        }
+        return false;
+      }
+    }
+    if (n.type !== 'Ident' || n.name === '_') return;
+    const v = info.objectOf(n);
+    if (!v) return;
+    const replacement = replacements.get(v);
+    if (replacement !== undefined) {
+      if (replacement !== n.name) {
+        edits.push({ pos: n.pos, end: n.end, newText: replacement });
+      }
+      return;
+    }
+    if (isBodyLocal(v)) {
+      let name = localNames.get(v.name);
+      if (name === undefined) {
+        name = fresh(v.name);
+        localNames.set(v.name, name);
+      }
+      if (name !== n.name) {
+        edits.push({ pos: n.pos, end: n.end, newText: name });
+      }
+      return;
+    }
+    if (samePackage || v.pkg !== fnFile.pkg || v.kind === 'pkgname') return;
+    if (isLocal(v)) return;
+    if (!isExported(v.name)) {
+      throw fail(
+        `'${callee.obj.name}' uses '${v.name}', which is not exported by package ${fnFile.pkg.name}`
+      );
+    }
+    if (v.parent?.kind === 'package') {
+      const name = qualify(fnFile.pkg.importPath, fnFile.pkg.name);
+      edits.push({ pos: n.pos, end: n.pos, newText: name ? `${name}.` : '' });
+    }
+  });
+  for (const name of introduced) taken.add(name);
+
+  // Text of the body with the edits applied, re-indented to indent. The
+  // indentation replaced is that of the first line with text, since the
+  // range may start with empty lines.
+  const textOf = (pos: number, end: number, indent: string): string => {
+    const inside = edits.filter(e => e.pos >= pos && e.end <= end);
+    let first = pos;
+    while (first < end && /\s/.test(fnFile.src[first])) first++;
+    const from = indentAt(fnFile.src, first);
+    return reindent(fnFile, pos, end, from, indent, inside);
+  };
+  const exprText = (e: Expr, indent: string) =>
+    textOf(e.pos, e.end, indent).substring(indent.length);
+
+  const valueTexts = (
+    r: ReturnStmt,
+    receiver: Receiver,
+    indent: string
+  ): string[] => {
+    if (r.results.length === 0) {
+      return callee.namedResults.map(v => replacements.get(v) ?? v.name);
+    }
+    const typed =
+      receiver.kind === 'discard' ||
+      receiver.typed ||
+      r.results.length !== sig.results.length;
+    return r.results.map((e, i) => {
+      const text = exprText(e, indent);
+      const t = info.typeOf(e);
+      const rt = sig.results[i].type!;
+      if (typed || !t || t.kind === 'invalid') return text;
+      if (identical(defaultType(t), rt)) return text;
+      return conversion(typeText(rt), text);
+    });
+  };
+
+  const renderReturn = (
+    r: ReturnStmt,
+    receiver: Receiver,
+    indent: string
+  ): string => {
+    const values = valueTexts(r, receiver, indent);
+    switch (receiver.kind) {
+      case 'discard': {
+        if (r.results.every(e => isPure(info, e))) return '';
+        if (r.results.length === 1 && isCallStatement(info, r.results[0])) {
+          return `${indent}${values[0]}\n`;
+        }
+        const blanks = sig.results.map(() => '_').join(', ');
+        return `${indent}${blanks} = ${values.join(', ')}\n`;
+      }
+      case 'assign':
+        return `${indent}${receiver.lhs} ${receiver.tok} ${values.join(', ')}\n`;
+      case 'return':
+        return `${indent}return${values.length > 0 ? ' ' : ''}${values.join(', ')}\n`;
+    }
+  };
+
+  // Renders stmts, which follow position from in the body, so that each
+  // return statement hands its values to receiver. Statements following
+  // an if statement that returns become its else branch.
+  const renderList = (
+    stmts: Stmt[],
+    from: number,
+    indent: string,
+    receiver: Receiver
+  ): string => {
+    let out = '';
+    let prev = from;
+    for (let i = 0; i < stmts.length; i++) {
+      const s = stmts[i];
+      const start = Math.min(lineEnd(fnFile.src, prev - 1), s.pos);
+      if (s.type === 'ReturnStmt') {
+        return out + renderReturn(s, receiver, indent);
+      }
+      let end = lineEnd(fnFile.src, s.end - 1);
+      if (s.type === 'IfStmt' && containsReturn(s)) {
+        const lineOfIf = lineStart(fnFile.src, s.pos);
+        if (start < lineOfIf) out += textOf(start, lineOfIf, indent);
+        // Returning from the caller needs no restructuring.
+        if (receiver.kind === 'return') {
+          out += renderIf(s, indent, receiver, [], end);
+          prev = end;
+          continue;
+        }
+        return out + renderIf(s, indent, receiver, stmts.slice(i + 1), end);
+      }
+      if (!onlyComments(fnFile, s.end, end)) end = s.end;
+      const text = textOf(start, end, indent);
+      out += text.endsWith('\n') ? text : `${text}\n`;
+      prev = end;
+    }
+    return out;
+  };
+
+  const renderIf = (
+    s: IfStmt,
+    indent: string,
+    receiver: Receiver,
+    rest: Stmt[],
+    restFrom: number
+  ): string => {
+    const inner = `${indent}\t`;
+    const thenText = renderList(
+      s.body.list,
+      s.body.lbrace + 1,
+      inner,
+      receiver
+    );
+    let elseText = '';
+    if (s.else?.type === 'IfStmt') {
+      elseText = renderIf(s.else, indent, receiver, [], s.else.end).trimStart();
+    } else if (s.else) {
+      const list = renderList(s.else.list, s.else.lbrace + 1, inner, receiver);
+      elseText = `{\n${list}${indent}}\n`;
+    } else if (rest.length > 0) {
+      const restText = renderList(rest, restFrom, inner, receiver);
+      if (restText) elseText = `{\n${restText}${indent}}\n`;
+    }
+    let header = textOf(s.pos, s.body.lbrace + 1, indent);
+    if (!thenText && elseText && !s.else && !s.init) {
+      const cond = negate(unparen(s.cond), e => exprText(e, indent));
+      header = `${indent}if ${cond} {`;
+      return `${header}\n${elseText.substring(2)}`;
+    }
+    if (!thenText && !elseText && isPure(info, s.cond) && !s.init) return '';
+    const tail = elseText ? ` else ${elseText}` : '\n';
+    return `${header}\n${thenText}${indent}}${tail}`;
+  };
+
+  // Find how the call is used. Calls forming a whole statement are replaced
+  // by the body; calls inside expressions are replaced by the value of the
+  // body, with any statements it needs placed before the statement.
+  let k = path.length - 1;
+  while (path[k - 1]?.type === 'ParenExpr') k--;
+  const node = path[k];
+  const parent = path[k - 1];
+  let stmt: Stmt | undefined;
+  let receiver: Receiver | undefined;
+  let predeclare: string[] = [];
+  const declareLater = (names: GoObject[]) =>
+    names.map(v => `var ${v.name} ${typeText(v.type!)}`);
+  const callerResults = (): Type[] | undefined => {
+    for (let i = path.length - 1; i >= 0; i--) {
+      const n = path[i];
+      if (n.type === 'FuncLit') {
+        return (info.typeOf(n) as SignatureType | undefined)?.results.map(
+          r => r.type!
+        );
+      }
+      if (n.type === 'FuncDecl') {
+        const fn = info.defs.get(n.name)?.type as SignatureType | undefined;
+        return fn?.results.map(r => r.type!);
+      }
+    }
+    return undefined;
+  };
+  if (parent?.type === 'ExprStmt') {
+    stmt = parent;
+    receiver = { kind: 'discard' };
+  } else if (
+    parent?.type === 'AssignStmt' &&
+    parent.rhs.length === 1 &&
+    parent.rhs[0] === node
+  ) {
+    stmt = parent;
+    const lhs = file.src.substring(
+      parent.lhs[0].pos,
+      parent.lhs[parent.lhs.length - 1].end
+    );
+    const lhsCalls = parent.lhs.some(e => !isPure(info, e));
+    if (lhsCalls) {
+      throw fail('the assignment evaluates calls on its left-hand side first');
+    }
+    if (parent.tok === ':=' && callee.earlyReturns) {
+      const defined = parent.lhs.flatMap(e =>
+        e.type === 'Ident' && e.name !== '_' && info.defs.has(e)
+          ? [info.defs.get(e)!]
+          : []
+      );
+      predeclare = declareLater(defined);
+      receiver = { kind: 'assign', lhs, tok: '=', typed: true };
+    } else {
+      receiver = {
+        kind: 'assign',
+        lhs,
+        tok: parent.tok,
+        typed: parent.tok !== ':=',
+      };
+    }
+  } else if (
+    parent?.type === 'ValueSpec' &&
+    parent.values.length === 1 &&
+    parent.values[0] === node &&
+    path[k - 2]?.type === 'GenDecl' &&
+    (path[k - 2] as { specs: unknown[] }).specs.length === 1 &&
+    path[k - 3]?.type === 'DeclStmt'
+  ) {
+    stmt = path[k - 3] as Stmt;
+    const names = parent.names.map(n => n.name).join(', ');
+    const typeExpr = parent.valueType
+      ? file.src.substring(parent.valueType.pos, parent.valueType.end)
+      : undefined;
+    if (callee.earlyReturns) {
+      predeclare = typeExpr
+        ? [`var ${names} ${typeExpr}`]
+        : declareLater(parent.names.map(n => info.defs.get(n)!));
+      receiver = { kind: 'assign', lhs: names, tok: '=', typed: true };
+    } else {
+      receiver = {
+        kind: 'assign',
+        lhs: `var ${names}${typeExpr ? ` ${typeExpr}` : ''}`,
+        tok: '=',
+        typed: typeExpr !== undefined,
+      };
+    }
+  } else if (
+    parent?.type === 'ReturnStmt' &&
+    parent.results.length === 1 &&
+    parent.results[0] === node
+  ) {
+    stmt = parent;
+    const results = callerResults();
+    const typed =
+      !!results &&
+      results.length === sig.results.length &&
+      results.every((t, i) => identical(t, sig.results[i].type!));
+    receiver = { kind: 'return', typed };
+  }
+
+  const single =
+    body.list.length === 1 &&
+    body.list[0].type === 'ReturnStmt' &&
+    body.list[0].results.length === 1 &&
+    sig.results.length === 1;
+  if (stmt && receiver && isStmtList(path[path.indexOf(stmt) - 1], stmt)) {
+    const indent = indentAt(file.src, stmt.pos);
+    const text =
+      [...prep, ...predeclare].map(l => `${indent}${l}\n`).join('') +
+      renderList(body.list, body.lbrace + 1, indent, receiver);
+    if (!text) {
+      const start = lineStart(file.src, stmt.pos);
+      const end = lineEnd(file.src, stmt.end - 1);
+      const alone =
+        file.src.substring(start, stmt.pos).trim() === '' &&
+        onlyComments(file, stmt.end, end);
+      return [
+        alone
+          ? { pos: start, end, newText: '' }
+          : { pos: stmt.pos, end: stmt.end, newText: '' },
+      ];
+    }
+    return [
+      {
+        pos: stmt.pos,
+        end: stmt.end,
+        newText: text.substring(indent.length).replace(/\n$/, ''),
+      },
+    ];
+  }
+
+  // The call is part of an expression.
+  if (sig.results.length !== 1) {
+    throw fail(
+      sig.results.length === 0
+        ? 'it is not used as a statement'
+        : 'its results are used in an expression'
+    );
+  }
+  const target =
+    prep.length > 0 || !single
+      ? hoistTarget(info, path, call, location)
+      : undefined;
+  const indent = target ? indentAt(file.src, target.pos) : '';
+  let hoisted = prep.map(l => `${indent}${l}\n`).join('');
+  let value: string;
+  if (single) {
+    const r = body.list[0] as ReturnStmt;
+    const raw = exprText(r.results[0], indent);
+    const [text] = valueTexts(
+      r,
+      { kind: 'assign', lhs: '', tok: '=', typed: false },
+      indent
+    );
+    value =
+      text === raw && needsParens(r.results[0], parent, node)
+        ? `(${text})`
+        : text;
+  } else {
+    const temp = fresh('result');
+    taken.add(temp);
+    if (callee.earlyReturns) {
+      hoisted += `${indent}var ${temp} ${typeText(sig.results[0].type!)}\n`;
+    }
+    hoisted += renderList(
+      body.list,
+      body.lbrace + 1,
+      indent,
+      callee.earlyReturns
+        ? { kind: 'assign', lhs: temp, tok: '=', typed: true }
+        : { kind: 'assign', lhs: temp, tok: ':=', typed: false }
+    );
+    value = temp;
+  }
+  const result: TextEdit[] = [{ pos: node.pos, end: node.end, newText: value }];
+  if (target && hoisted) {
+    result.push({
+      pos: target.pos,
+      end: target.pos,
+      newText: `${hoisted.substring(indent.length)}${indent}`,
+    });
+  }
+  return result;
+}
+
+export async function performInlineFunction(
+  options: InlineFunctionOptions
+): Promise<InlineFunctionResult> {
+  const { dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const { obj } = symbolAt(program, file, resolveLocation(file, options));
+  const info = program.check().info;
+  const callee = analyzeCallee(info, obj);
+  await step(options, 'Finding references');
+  const sites = findCallSites(callee, findReferences(program, obj));
+
+  const byFile = new Map<GoSourceFile, FileEdits>();
+  const editsFor = (f: GoSourceFile): FileEdits => {
+    let entry = byFile.get(f);
+    if (!entry) {
+      const missing: ImportRequest[] = [];
+      entry = { edits: [], missing, qualifier: fileQualifier(f, missing) };
+      byFile.set(f, entry);
+    }
+    return entry;
+  };
+  const takenByDecl = new Map<Node, Set<string>>();
+  for (const site of sites) {
+    const decl = site.path[1];
+    let taken = takenByDecl.get(decl);
+    if (!taken) {
+      taken = identNames(decl);
+      takenByDecl.set(decl, taken);
+    }
+    const entry = editsFor(site.file);
+    entry.edits.push(...inlineCall(info, callee, site, entry, taken));
+  }
+  editsFor(callee.file).edits.push(
+    declRemovalEdit(callee.file.src, callee.decl)
+  );
+
+  const changes: FileChange[] = [];
+  for (const [f, entry] of byFile) {
+    let updated = applyTextEdits(f.src, [
+      ...addImportEdits(f, entry.missing),
+      ...entry.edits,
+    ]);
+    updated = pruneImports(f, info, updated);
+    changes.push({ filePath: f.filePath, original: f.src, updated });
+  }
+
+  return {
+    functionName: obj.name,
+    callSites: sites.map(s => s.location),
+    changes: await commitFileChanges(changes, dryRun, options),
+    dryRun,
+  };
+}
+
+export function formatInlineFunctionResults(
+  result: InlineFunctionResult
+): string {
+  const count = result.callSites.length;
+  const header =
+    count === 0
+      ? `Removed '${result.functionName}', which had no calls`
+      : `Inlined '${result.functionName}' at ${count} call site${count === 1 ? '' : 's'}:\n${result.callSites.map(s => `  ${s}`).join('\n')}`;
+  return `${header}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,310 @@
+import type {
+  Expr,
+  GenDecl,
+  Ident,
+  Node,
+  SelectorExpr,
+} from '../utils/go-ast.js';
+import { inspect, isExported, pathEnclosingInterval } from '../utils/go-ast.js';
+import {
+  freeIdents,
+  isLocal,
+  resolveAt,
+  scopeAt,
+} from '../utils/go-analysis.js';
+import {
+  addImportEdits,
+  declRemovalEdit,
+  fileQualifier,
+  pruneImports,
+  specRemovalEdit,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { exclusionWarnings, loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  locationOf,
+  resolveSymbol,
+} from '../utils/go-references.js';
+import type { GoSymbolInput } from '../utils/go-references.js';
+import {
+  deref,
+  isExternal,
+  methodSet,
+  sameObject,
+  typeContains,
+  typeString,
+} from '../utils/go-types.js';
+import type { GoObject, GoSourceFile, Type } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface InlineTypeAliasOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoSymbolInput {
+  filePath: string;
+  dryRun?: boolean;
+}
+
+export interface InlineTypeAliasResult {
+  name: string;
+  // Whether the declaration was an alias or a defined type.
+  kind: 'alias' | 'defined';
+  // The type expression of the declaration, as written.
+  type: string;
+  uses: number;
+  // What happened to the declaration: removed, or kept because files
+  // excluded by build constraints may still use it.
+  declaration: 'removed' | 'kept';
+  warnings: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+interface Use {
+  file: GoSourceFile;
+  // The identifier, or the qualified identifier in other packages.
+  node: Ident | SelectorExpr;
+}
+
+function methodNames(t: Type): string[] {
+  return methodSet(t)
+    .map(m => m.obj.name)
+    .sort();
+}
+
+// Rejects inlining a defined type where its values would behave
+// differently as values of the type it is defined as: with methods of
+// their own or of that type, which decide what interfaces they implement.
+function checkMethods(obj: GoObject, text: string, t: Type): void {
+  const { name } = obj;
+  const own = obj.methods ?? [];
+  if (own.length > 0) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot inline the defined type '${name}', which has the methods ${own.map(m => m.name).join(', ')} that ${text} does not have`
+    );
+  }
+  const named = deref(t).type;
+  if (named.kind === 'named' && isExternal(named)) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot inline the defined type '${name}': the methods of ${text}, which its values would gain, are not known`
+    );
+  }
+  const before = methodNames(obj.type!);
+  const gained = methodNames(t).filter(m => !before.includes(m));
+  if (gained.length > 0) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot inline the defined type '${name}', whose values would gain the methods ${gained.join(', ')} of ${text}`
+    );
+  }
+}
+
+export async function performInlineTypeAlias(
+  options: InlineTypeAliasOptions
+): Promise<InlineTypeAliasResult> {
+  const { dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const { obj } = resolveSymbol(program, file, options);
+  const { name } = obj;
+  const spec = obj.decl;
+  if (obj.kind !== 'type' || spec?.type !== 'TypeSpec' || !obj.file) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${name}' is not a type declared in the module`
+    );
+  }
+  if (spec.typeParams) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot inline the generic type '${name}'`
+    );
+  }
+  const declFile = obj.file;
+  const kind = spec.assign ? 'alias' : 'defined';
+  const expr = spec.specType;
+  const text = declFile.src.substring(expr.pos, expr.end);
+  const t = info.typeOf(expr);
+  if (!t || typeContains(t, x => x.kind === 'invalid')) {
+    throw new ToolError('compile_error', `Invalid type ${text}`);
+  }
+  if (kind === 'defined') checkMethods(obj, text, t);
+
+  const uses: Use[] = [];
+  for (const f of program.files) {
+    const visit = (n: Node): boolean | void => {
+      if (n.type === 'SelectorExpr') {
+        if (sameObject(info.uses.get(n.sel), obj)) {
+          uses.push({ file: f, node: n });
+          return false;
+        }
+        inspect(n.x, visit);
+        return false;
+      }
+      if (n.type === 'Ident' && sameObject(info.uses.get(n), obj)) {
+        uses.push({ file: f, node: n });
+      }
+    };
+    inspect(f.ast, visit);
+  }
+  if (uses.length === 0) {
+    throw new ToolError('unsupported_construct', `'${name}' is never used`);
+  }
+
+  const free = freeIdents(info, expr);
+  const edits = new Map<GoSourceFile, TextEdit[]>();
+  const missing = new Map<GoSourceFile, ImportRequest[]>();
+  const editsOf = (f: GoSourceFile) => {
+    if (!edits.has(f)) edits.set(f, []);
+    return edits.get(f)!;
+  };
+  for (const { file: f, node } of uses) {
+    const at = locationOf(f, node.pos);
+    const refuse = (why: string): never => {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot inline '${name}' at ${at}, ${why}`,
+        errorLocation(f, node.pos)
+      );
+    };
+    const path = pathEnclosingInterval(f.ast, node.pos, node.end);
+    while (path[path.length - 1] !== node) path.pop();
+    const parent = path[path.length - 2];
+    const field =
+      parent.type === 'StarExpr' ? path[path.length - 3] : parent;
+    if (
+      field?.type === 'Field' &&
+      field.names.length === 0 &&
+      path[path.length - (parent === field ? 4 : 5)]?.type === 'StructType'
+    ) {
+      refuse('where it names an embedded field');
+    }
+    // Assertions tell a defined type from the type it is defined as.
+    if (kind === 'defined') {
+      for (let i = path.length - 2; i >= 0; i--) {
+        const p = path[i];
+        const asserted =
+          (p.type === 'TypeAssertExpr' && p.assertType === path[i + 1]) ||
+          (p.type === 'CaseClause' &&
+            path[i - 2]?.type === 'TypeSwitchStmt' &&
+            p.list?.includes(path[i + 1] as Expr));
+        if (asserted) {
+          refuse(
+            `where a type assertion tells its values from other values of ${text}`
+          );
+        }
+      }
+    }
+
+    // The expression can be used as written where its names mean the
+    // same; elsewhere the type is written anew from the file's imports.
+    const scope = scopeAt(info, path);
+    const asWritten = free.every(id =>
+      sameObject(resolveAt(scope, id.name, node.pos), info.uses.get(id))
+    );
+    let replacement = text;
+    if (!asWritten) {
+      typeContains(t, x => {
+        if (x.kind !== 'named') return false;
+        if (isLocal(x.obj)) {
+          refuse(`where the local type ${x.obj.name} is not in scope`);
+        }
+        if (x.obj.pkg && x.obj.pkg !== f.pkg && !isExported(x.obj.name)) {
+          refuse(`where the type ${x.obj.name} cannot be named`);
+        }
+        return false;
+      });
+      if (!missing.has(f)) missing.set(f, []);
+      replacement = typeString(t, fileQualifier(f, missing.get(f)));
+    }
+    // Conversions, method expressions and channel element types need
+    // parentheses around some type literals.
+    const operand =
+      (parent.type === 'CallExpr' && parent.fun === node) ||
+      (parent.type === 'SelectorExpr' && parent.x === node);
+    if (
+      (operand && /^(\*|<-|func\b|chan\b)/.test(replacement)) ||
+      (parent.type === 'ChanType' && replacement.startsWith('<-'))
+    ) {
+      replacement = `(${replacement})`;
+    }
+    editsOf(f).push({ pos: node.pos, end: node.end, newText: replacement });
+  }
+
+  // Files left out by build constraints may use the type too.
+  const warnings = isLocal(obj)
+    ? []
+    : exclusionWarnings(program, [declFile.pkg]);
+  let declaration: InlineTypeAliasResult['declaration'] = 'kept';
+  if (warnings.length === 0) {
+    const gen = pathEnclosingInterval(declFile.ast, spec.pos, spec.end).find(
+      (n): n is GenDecl => n.type === 'GenDecl' && n.specs.includes(spec)
+    )!;
+    editsOf(declFile).push(
+      gen.specs.length > 1
+        ? specRemovalEdit(declFile.src, spec)
+        : declRemovalEdit(declFile.src, gen)
+    );
+    declaration = 'removed';
+  }
+
+  const changes = await commitFileChanges(
+    [...edits].map(([f, fileEdits]) => ({
+      filePath: f.filePath,
+      original: f.src,
+      updated: pruneImports(
+        f,
+        info,
+        applyTextEdits(f.src, [
+          ...addImportEdits(f, missing.get(f) ?? []),
+          ...fileEdits,
+        ])
+      ),
+    })),
+    dryRun,
+    options
+  );
+
+  return {
+    name,
+    kind,
+    type: text,
+    uses: uses.length,
+    declaration,
+    warnings,
+    changes,
+    dryRun,
+  };
+}
+
+export function formatInlineTypeAliasResults(
+  result: InlineTypeAliasResult
+): string {
+  const uses = result.uses === 1 ? '1 use' : `${result.uses} uses`;
+  const what = result.kind === 'alias' ? 'type alias' : 'type';
+  const output = [
+    `Inlined ${what} '${result.name}' (${result.type}) at ${uses}`,
+  ];
+  if (result.declaration === 'removed') {
+    output[0] += ' and removed its declaration';
+  } else {
+    output[0] +=
+      ', keeping its declaration for the files excluded by build constraints:';
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
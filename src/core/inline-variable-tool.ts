@@ -0,0 +1,518 @@
+import type {
+  AssignStmt,
+  Expr,
+  FuncDecl,
+  FuncLit,
+  Ident,
+  Node,
+  Stmt,
+  ValueSpec,
+} from '../utils/go-ast.js';
+import { inspect, pathEnclosingInterval, unparen } from '../utils/go-ast.js';
+import {
+  collectWrites,
+  isLocal,
+  isPure,
+  resolveAt,
+  scopeAt,
+  statementsOf,
+} from '../utils/go-analysis.js';
+import type { StmtList } from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  conversion,
+  fileQualifier,
+  listItemRemoval,
+  needsParens,
+  specRemovalEdit,
+  stmtRemovalEdit,
+} from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  locationOf,
+  resolveLocation,
+  symbolAt,
+} from '../utils/go-references.js';
+import {
+  defaultType,
+  identical,
+  isUntyped,
+  sameObject,
+  typeString,
+  under,
+} from '../utils/go-types.js';
+import type { GoObject, GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { displayPath } from '../utils/file-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface InlineVariableOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  offset?: number;
+  line?: number;
+  column?: number;
+  dryRun?: boolean;
+}
+
+export interface InlineVariableResult {
+  filePath: string;
+  name: string;
+  expression: string;
+  uses: number;
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+interface Declaration {
+  // The AssignStmt or ValueSpec declaring the variable, with the index of
+  // the variable among its names.
+  node: AssignStmt | ValueSpec;
+  index: number;
+  value: Expr;
+  // Enclosing nodes from the file down to node.
+  path: Node[];
+}
+
+function declarationOf(info: GoInfo, obj: GoObject): Declaration {
+  const decl = obj.decl;
+  const file = obj.file!;
+  let index = -1;
+  let value: Expr | undefined;
+  if (decl?.type === 'AssignStmt' && decl.tok === ':=') {
+    index = decl.lhs.findIndex(l => l.type === 'Ident' && l.pos === obj.pos);
+    if (decl.rhs.length === decl.lhs.length) value = decl.rhs[index];
+  } else if (decl?.type === 'ValueSpec') {
+    index = decl.names.findIndex(n => n.pos === obj.pos);
+    if (decl.values.length === decl.names.length) value = decl.values[index];
+  } else {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is not declared with := or a var declaration`
+    );
+  }
+  if (!value) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is not initialized by an expression of its own`
+    );
+  }
+  const path = pathEnclosingInterval(file.ast, decl.pos, decl.end);
+  while (path.length > 0 && path[path.length - 1] !== decl) path.pop();
+  const parent = path[path.length - 2];
+  if (parent?.type === 'ForStmt' || parent?.type === 'RangeStmt') {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot inline '${obj.name}', a variable of a for loop`
+    );
+  }
+  if (parent?.type === 'CommClause' || parent?.type === 'TypeSwitchStmt') {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot inline '${obj.name}', which a case declares`
+    );
+  }
+  return { node: decl, index, value, path };
+}
+
+// Reports whether e reads memory that other code could change without
+// assigning to a local variable: package variables, pointers, slices and
+// maps.
+function readsIndirectly(info: GoInfo, e: Expr): boolean {
+  let indirect = false;
+  inspect(e, n => {
+    if (indirect) return false;
+    if (n.type === 'StarExpr') indirect = true;
+    if (n.type === 'IndexExpr' || n.type === 'SelectorExpr') {
+      const t = info.typeOf(n.x);
+      const kind = t && under(t).kind;
+      if (n.type === 'IndexExpr' ? kind !== 'array' : kind === 'pointer') {
+        indirect = true;
+      }
+    }
+    if (n.type === 'Ident') {
+      const obj = info.uses.get(n);
+      if (obj?.kind === 'var' && !isLocal(obj) && !obj.isField) {
+        indirect = true;
+      }
+    }
+  });
+  return indirect;
+}
+
+// Returns the edits deleting the declaration of the variable.
+function declarationRemoval(
+  info: GoInfo,
+  file: GoSourceFile,
+  decl: Declaration
+): TextEdit[] {
+  const { node, index } = decl;
+  if (node.type === 'AssignStmt' && node.lhs.length > 1) {
+    const edits = [
+      listItemRemoval(node.lhs, index),
+      listItemRemoval(node.rhs, index),
+    ];
+    const declares = node.lhs.some(
+      (l, k) =>
+        k !== index && l.type === 'Ident' && info.defs.get(l)?.pos === l.pos
+    );
+    if (!declares) {
+      edits.push({ pos: node.tokPos, end: node.tokPos + 2, newText: '=' });
+    }
+    return edits;
+  }
+  if (node.type === 'ValueSpec' && node.names.length > 1) {
+    return [
+      listItemRemoval(node.names, index),
+      listItemRemoval(node.values, index),
+    ];
+  }
+
+  // The whole statement goes, or an if or switch initializer up to the
+  // condition following it.
+  let stmt: Node = node;
+  if (node.type === 'ValueSpec') {
+    const gen = decl.path[decl.path.length - 2];
+    if (gen.type === 'GenDecl' && gen.specs.length > 1) {
+      return [specRemovalEdit(file.src, node)];
+    }
+    stmt = decl.path[decl.path.length - 3];
+  }
+  const parent = decl.path[decl.path.indexOf(stmt) - 1];
+  return [stmtRemovalEdit(file, stmt, parent)];
+}
+
+function isStmtList(n: Node | undefined): n is StmtList {
+  return (
+    n?.type === 'BlockStmt' ||
+    n?.type === 'CaseClause' ||
+    n?.type === 'CommClause'
+  );
+}
+
+// Returns the first call or receive operation in func that starts inside
+// [pos, end), and with assignments set also the first assignment to
+// anything but a local variable. Function literals are skipped.
+function firstEffect(
+  info: GoInfo,
+  func: Node,
+  pos: number,
+  end: number,
+  assignments: boolean
+): Node | undefined {
+  let found: Node | undefined;
+  const local = (e: Expr) => {
+    const x = unparen(e);
+    if (x.type !== 'Ident') return false;
+    const obj = info.objectOf(x);
+    return x.name === '_' || (!!obj && isLocal(obj));
+  };
+  inspect(func, n => {
+    if (found || n.end <= pos || n.pos >= end) return false;
+    if (n.type === 'FuncLit') return false;
+    if (n.pos < pos) return;
+    if (
+      (n.type === 'CallExpr' && !isPure(info, n)) ||
+      (n.type === 'UnaryExpr' && n.op === '<-') ||
+      (assignments &&
+        ((n.type === 'AssignStmt' && !n.lhs.every(local)) ||
+          (n.type === 'IncDecStmt' && !local(n.x))))
+    ) {
+      found = n;
+      return false;
+    }
+  });
+  return found;
+}
+
+// Rejects moving the side effects of the expression to the use at the end
+// of path, unless the use is evaluated right where the declaration was: in
+// the statement after it or the condition of its if or switch statement,
+// unconditionally, and before any other call, including those of the other
+// values the declaration evaluates.
+function checkEvaluation(
+  info: GoInfo,
+  file: GoSourceFile,
+  func: Node,
+  decl: Declaration,
+  path: Node[],
+  next: Stmt | undefined,
+  text: string,
+  at: string
+): void {
+  const use = path[path.length - 1];
+  const fail = (reason: string) =>
+    new ToolError(
+      'unsupported_construct',
+      `Cannot inline the variable at ${at}: '${text}' has side effects and would then run ${reason}`,
+      errorLocation(file, use.pos)
+    );
+  // The other values of a multiple declaration would then run first.
+  const { node, index } = decl;
+  const values = node.type === 'AssignStmt' ? node.rhs : node.values;
+  const other = values.find((v, k) => k !== index && !isPure(info, v));
+  if (other) {
+    throw fail(
+      `after '${file.src.substring(other.pos, other.end)}', which its declaration evaluates with it`
+    );
+  }
+  for (let k = path.length - 1; k > 0; k--) {
+    const parent = path[k - 1];
+    const child = path[k];
+    if (
+      (parent.type === 'IfStmt' || parent.type === 'SwitchStmt') &&
+      parent.init === decl.node
+    ) {
+      if (child === parent.init) continue;
+      if (child === parent.body || child === parent.else) {
+        throw fail('conditionally');
+      }
+      break;
+    }
+    if (isStmtList(parent)) {
+      if (child !== next) throw fail('at another time');
+      break;
+    }
+    if (
+      (parent.type === 'BinaryExpr' &&
+        (parent.op === '&&' || parent.op === '||') &&
+        child === parent.y) ||
+      (parent.type === 'IfStmt' && child === parent.else) ||
+      (parent.type === 'CaseClause' && parent.list?.includes(child as Expr))
+    ) {
+      throw fail('conditionally');
+    }
+    if (parent.type === 'ForStmt' && child !== parent.init) {
+      throw fail('on every iteration');
+    }
+  }
+  const call = firstEffect(info, func, decl.node.end, use.pos, false);
+  if (call) {
+    throw fail(`after the call at ${locationOf(file, call.pos)}`);
+  }
+}
+
+export async function performInlineVariable(
+  options: InlineVariableOptions
+): Promise<InlineVariableResult> {
+  const { dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const { obj } = symbolAt(program, file, resolveLocation(file, options));
+  const name = obj.name;
+  if (obj.kind !== 'var' || !isLocal(obj) || obj.isParam || !obj.file) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${name}' is not a local variable`
+    );
+  }
+  const decl = declarationOf(info, obj);
+  const { value } = decl;
+  const text = obj.file.src.substring(value.pos, value.end);
+  const func = [...decl.path]
+    .reverse()
+    .find(
+      (n): n is FuncDecl | FuncLit =>
+        n.type === 'FuncDecl' || n.type === 'FuncLit'
+    )!;
+
+  const uses: Ident[] = [];
+  inspect(func, n => {
+    if (n.type === 'Ident' && info.uses.get(n) === obj) uses.push(n);
+  });
+  if (uses.length === 0) {
+    throw new ToolError('unsupported_construct', `'${name}' is never used`);
+  }
+
+  const writes = collectWrites(info, [func]);
+  for (const id of writes.modified) {
+    const target = info.objectOf(id);
+    if (id.pos === obj.pos || target !== obj) continue;
+    throw new ToolError(
+      'unsupported_construct',
+      writes.addressed.has(id)
+        ? `Cannot inline '${name}', whose address is taken at ${locationOf(file, id.pos)}`
+        : `Cannot inline '${name}', which is assigned again at ${locationOf(file, id.pos)}`,
+      errorLocation(file, id.pos)
+    );
+  }
+
+  // Identifiers of the expression that must still refer to the same
+  // objects at every use, and the variables whose changes would change
+  // its value.
+  const free: Ident[] = [];
+  const reads = new Set<GoObject>();
+  inspect(value, n => {
+    if (n.type === 'FuncLit') return false;
+    if (n.type === 'SelectorExpr') {
+      inspect(n.x, m => {
+        if (m.type === 'Ident') free.push(m);
+      });
+      return false;
+    }
+    if (n.type !== 'Ident') return;
+    const o = info.uses.get(n);
+    if (!o || o.isField || o.recv) return;
+    free.push(n);
+    if (o.kind === 'var') reads.add(o);
+  });
+  const pure = isPure(info, value);
+  const changed = [...writes.modified].filter(id => {
+    const o = info.objectOf(id);
+    return !!o && reads.has(o) && id.pos !== o.pos && id.pos > value.end;
+  });
+  const stable = pure && changed.length === 0 && !readsIndirectly(info, value);
+  if (uses.length > 1 && !pure) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot inline '${name}', which is used ${uses.length} times: evaluating '${text}' more than once could change the behavior`
+    );
+  }
+
+  let declStmt: Node = decl.node;
+  for (let k = decl.path.length - 1; k > 0; k--) {
+    if (isStmtList(decl.path[k - 1])) {
+      declStmt = decl.path[k];
+      break;
+    }
+  }
+  const container = decl.path[decl.path.indexOf(declStmt) - 1];
+  const list = statementsOf(container as StmtList);
+  const next = list[list.indexOf(declStmt as Stmt) + 1];
+
+  const edits = declarationRemoval(info, file, decl);
+  for (const use of uses) {
+    const at = locationOf(file, use.pos);
+    const path = pathEnclosingInterval(file.ast, use.pos, use.end);
+    const scope = scopeAt(info, path);
+    for (const id of free) {
+      const other = resolveAt(scope, id.name, use.pos);
+      if (!other || !sameObject(other, info.uses.get(id)!)) {
+        throw new ToolError(
+          'name_conflict',
+          `Cannot inline '${name}' at ${at}, where '${id.name}' refers to a different declaration`,
+          errorLocation(file, use.pos)
+        );
+      }
+    }
+
+    // Loops and function literals entered after the declaration may
+    // evaluate the expression later, or more than once.
+    const entered = path.filter(n => n.pos > decl.node.end);
+    for (const n of entered) {
+      if (n.type === 'FuncLit' && !stable) {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot inline '${name}' into the function literal at ${locationOf(file, n.pos)}, which could run after the value of '${text}' changes`,
+          errorLocation(file, n.pos)
+        );
+      }
+    }
+    const loops = entered.filter(
+      n => n.type === 'ForStmt' || n.type === 'RangeStmt'
+    );
+    if (loops.length > 0 && !pure) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot inline '${name}' into the loop at ${locationOf(file, loops[0].pos)}, which would evaluate '${text}' on every iteration`,
+        errorLocation(file, loops[0].pos)
+      );
+    }
+    const end = Math.max(use.pos, ...loops.map(l => l.end));
+    for (const id of changed) {
+      if (id.pos < end) {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot inline '${name}' at ${at}: '${id.name}' changes at ${locationOf(file, id.pos)}`,
+          errorLocation(file, id.pos)
+        );
+      }
+    }
+    if (pure && readsIndirectly(info, value)) {
+      const effect = firstEffect(info, func, decl.node.end, end, true);
+      if (effect) {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot inline '${name}' at ${at}: the value of '${text}' may change at ${locationOf(file, effect.pos)}`,
+          errorLocation(file, effect.pos)
+        );
+      }
+    }
+    if (!pure) checkEvaluation(info, file, func, decl, path, next, text, at);
+
+    const header = path.some(
+      n =>
+        (n.type === 'IfStmt' ||
+          n.type === 'ForStmt' ||
+          n.type === 'SwitchStmt' ||
+          n.type === 'RangeStmt') &&
+        use.pos < n.body.pos
+    );
+    let replacement = text;
+    if (decl.node.type === 'ValueSpec' && decl.node.valueType) {
+      const t = info.typeOf(value);
+      if (!t || !obj.type || !identical(t, obj.type)) {
+        const typeText = file.src.substring(
+          decl.node.valueType.pos,
+          decl.node.valueType.end
+        );
+        replacement = conversion(typeText, text);
+      }
+    } else {
+      const t = info.typeOf(value);
+      if (
+        t?.kind === 'basic' &&
+        isUntyped(t) &&
+        t.name !== 'untyped bool' &&
+        t.name !== 'untyped string'
+      ) {
+        replacement = conversion(
+          typeString(defaultType(t), fileQualifier(file)),
+          text
+        );
+      }
+    }
+    if (
+      replacement === text &&
+      value.type !== 'ParenExpr' &&
+      (needsParens(value, path[path.length - 2], use) ||
+        (header && unparen(value).type === 'CompositeLit'))
+    ) {
+      replacement = `(${text})`;
+    }
+    edits.push({ pos: use.pos, end: use.end, newText: replacement });
+  }
+
+  const updated = applyTextEdits(file.src, edits);
+  const changes = await commitFileChanges(
+    [{ filePath: file.filePath, original: file.src, updated }],
+    dryRun,
+    options
+  );
+
+  return {
+    filePath: displayPath(file.filePath),
+    name,
+    expression: text,
+    uses: uses.length,
+    changes,
+    dryRun,
+  };
+}
+
+export function formatInlineVariableResults(
+  result: InlineVariableResult
+): string {
+  const uses = result.uses === 1 ? '1 use' : `${result.uses} uses`;
+  return `Inlined variable '${result.name}' (${result.expression}) at ${uses} in ${result.filePath}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
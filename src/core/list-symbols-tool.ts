@@ -0,0 +1,207 @@
+import { existsSync, statSync } from 'fs';
+import { dirname, resolve } from 'path';
+import { displayPath } from '../utils/file-utils.js';
+import type { FuncDecl } from '../utils/go-ast.js';
+import { isExported } from '../utils/go-ast.js';
+import { GoProgram } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { signatureString, typeString, under } from '../utils/go-types.js';
+import type {
+  GoObject,
+  GoPackage,
+  GoSourceFile,
+  Qualifier,
+  Type,
+} from '../utils/go-types.js';
+import { indexToPosition } from '../utils/line-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ListSymbolsOptions extends LoadOptions {
+  // A package directory, or a Go file of the package.
+  filePath: string;
+  // Also list the declarations of the package's _test.go files.
+  includeTests?: boolean;
+}
+
+export type SymbolKind = 'func' | 'method' | 'type' | 'var' | 'const';
+
+export interface SymbolInfo {
+  kind: SymbolKind;
+  name: string;
+  exported: boolean;
+  // The receiver type of a method as written, such as *Store.
+  receiver?: string;
+  filePath: string;
+  line: number;
+  column: number;
+  // String index of the name, for the tools that take an offset.
+  offset: number;
+  signature: string;
+}
+
+export interface ListSymbolsResult {
+  packageName: string;
+  importPath: string;
+  symbols: SymbolInfo[];
+  // Files of the package that build constraints excluded.
+  warnings: string[];
+}
+
+// Returns the package at path, a package directory or one of its files.
+function packageAt(program: GoProgram, path: string): GoPackage {
+  const target = resolve(path);
+  const isDir = existsSync(target) && statSync(target).isDirectory();
+  const pkg = isDir
+    ? program.packages.find(p => p.dir === target && !p.isXTest)
+    : program.file(target)?.pkg;
+  if (pkg) return pkg;
+  const error = program.errors.find(e =>
+    isDir ? e.filePath.startsWith(target) : e.filePath === target
+  );
+  if (error) {
+    throw new ToolError('compile_error', error.message, error.location);
+  }
+  throw new ToolError(
+    'invalid_location',
+    isDir
+      ? `No Go package found in ${path}`
+      : `Not a Go source file in the module: ${path}`
+  );
+}
+
+// Writes a type parameter list, if there are type parameters.
+function typeParamList(typeParams: GoObject[] | undefined, q: Qualifier) {
+  if (!typeParams?.length) return '';
+  const params = typeParams.map(
+    p => `${p.name} ${p.constraint ? typeString(p.constraint, q) : 'any'}`
+  );
+  return `[${params.join(', ')}]`;
+}
+
+// Describes a type declaration the way it reads in source, leaving out the
+// members of struct and interface types.
+function typeSignature(obj: GoObject, q: Qualifier): string {
+  const head = `type ${obj.name}${typeParamList(obj.typeParams, q)}`;
+  if (obj.isAlias) return `${head} = ${typeString(obj.type!, q)}`;
+  const u: Type = obj.underlying ?? under(obj.type!);
+  if (u.kind === 'struct' && u.fields.length > 0) return `${head} struct{...}`;
+  if (u.kind === 'interface' && typeString(u, q) !== 'interface{}') {
+    return `${head} interface{...}`;
+  }
+  return `${head} ${typeString(u, q)}`;
+}
+
+function funcSymbol(
+  file: GoSourceFile,
+  decl: FuncDecl,
+  obj: GoObject,
+  q: Qualifier
+): Pick<SymbolInfo, 'kind' | 'receiver' | 'signature'> {
+  const t = obj.type?.kind === 'signature' ? obj.type : undefined;
+  const sig = t ? signatureString(t, q) : '()';
+  const field = decl.recv?.list[0];
+  if (!field) {
+    const typeParams = typeParamList(t?.typeParams, q);
+    return { kind: 'func', signature: `func ${obj.name}${typeParams}${sig}` };
+  }
+  const receiver = file.src.slice(field.fieldType.pos, field.fieldType.end);
+  const recvName = field.names[0] ? `${field.names[0].name} ` : '';
+  return {
+    kind: 'method',
+    receiver,
+    signature: `func (${recvName}${receiver}) ${obj.name}${sig}`,
+  };
+}
+
+export async function performListSymbols(
+  options: ListSymbolsOptions
+): Promise<ListSymbolsResult> {
+  const program = await GoProgram.load(resolve(options.filePath), options);
+  const pkg = packageAt(program, options.filePath);
+  const info = (await program.checkAsync(options)).info;
+  const q: Qualifier = p => (p.path === pkg.importPath ? '' : p.name);
+
+  const symbols: SymbolInfo[] = [];
+  const files = pkg.files.filter(
+    f => options.includeTests || !f.filePath.endsWith('_test.go')
+  );
+  for (const file of files) {
+    const add = (
+      obj: GoObject | undefined,
+      symbol: Pick<SymbolInfo, 'kind' | 'receiver' | 'signature'>
+    ) => {
+      if (!obj || obj.name === '_') return;
+      const position = indexToPosition(file.src, obj.pos, file.lineStarts);
+      symbols.push({
+        kind: symbol.kind,
+        name: obj.name,
+        exported: isExported(obj.name),
+        ...(symbol.receiver !== undefined && { receiver: symbol.receiver }),
+        filePath: displayPath(file.filePath),
+        line: position.line,
+        column: position.column,
+        offset: obj.pos,
+        signature: symbol.signature,
+      });
+    };
+
+    for (const decl of file.ast.decls) {
+      if (decl.type === 'FuncDecl') {
+        const obj = info.defs.get(decl.name);
+        if (obj) add(obj, funcSymbol(file, decl, obj, q));
+        continue;
+      }
+      if (decl.type !== 'GenDecl') continue;
+      for (const spec of decl.specs) {
+        if (spec.type === 'TypeSpec') {
+          const obj = info.defs.get(spec.name);
+          if (obj) add(obj, { kind: 'type', signature: typeSignature(obj, q) });
+        } else if (spec.type === 'ValueSpec') {
+          const kind = decl.tok === 'const' ? 'const' : 'var';
+          for (const name of spec.names) {
+            const obj = info.defs.get(name);
+            const t = obj?.type ? ` ${typeString(obj.type, q)}` : '';
+            add(obj, { kind, signature: `${kind} ${name.name}${t}` });
+          }
+        }
+      }
+    }
+  }
+
+  return {
+    packageName: pkg.name,
+    importPath: pkg.importPath,
+    symbols,
+    warnings: program.excluded
+      .filter(
+        f =>
+          dirname(f.filePath) === pkg.dir &&
+          (options.includeTests || !f.filePath.endsWith('_test.go'))
+      )
+      .map(
+        f =>
+          `${displayPath(f.filePath)} is excluded by build constraints (${f.constraint})`
+      ),
+  };
+}
+
+export function formatListSymbolsResults(result: ListSymbolsResult): string {
+  const excluded =
+    result.warnings.length > 0
+      ? `\n\nNot listed:\n${result.warnings.map(w => `  ${w}`).join('\n')}`
+      : '';
+  if (result.symbols.length === 0) {
+    return `Package ${result.packageName} (${result.importPath}) declares nothing at the top level${excluded}`;
+  }
+
+  const count = result.symbols.length;
+  const output = [
+    `Package ${result.packageName} (${result.importPath}), ${count} ${count === 1 ? 'symbol' : 'symbols'}:`,
+  ];
+  for (const s of result.symbols) {
+    output.push(
+      `  ${s.filePath}:${s.line}:${s.column} (offset ${s.offset}): ${s.signature}`
+    );
+  }
+  return output.join('\n') + excluded;
+}
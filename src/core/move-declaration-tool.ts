@@ -0,0 +1,333 @@
+import { existsSync } from 'fs';
+import { basename, dirname, resolve } from 'path';
+import type { GenDecl } from '../utils/go-ast.js';
+import { declRemovalEdit, newGoFile, pruneImports } from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { GoProgram, LoadOptions } from '../utils/go-loader.js';
+import {
+  appendTo,
+  buildConstraint,
+  mergeRemovals,
+  movableDecls,
+  movedText,
+  namesOf,
+} from '../utils/go-move.js';
+import type { Moved } from '../utils/go-move.js';
+import { resolveLocation } from '../utils/go-references.js';
+import type { GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { displayPath } from '../utils/file-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface MoveDeclarationOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  offset?: number;
+  line?: number;
+  column?: number;
+  // A Go file of the same package, created when it does not exist.
+  destination: string;
+  dryRun?: boolean;
+}
+
+export interface MoveDeclarationResult {
+  // Names declared by the moved declaration; methods as Type.Method.
+  names: string[];
+  from: string;
+  to: string;
+  created: boolean;
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+export interface SplitFileOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  // Names of top-level declarations, methods as Type.Method, mapped to the
+  // file of the package each one is moved to. File names are resolved in
+  // the directory of the package.
+  targets: Record<string, string>;
+  dryRun?: boolean;
+}
+
+export interface SplitFileResult {
+  from: string;
+  // The files declarations were moved to, in the order they appear in the
+  // original file.
+  moves: { to: string; names: string[]; created: boolean }[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+function movedAt(file: GoSourceFile, index: number): Moved {
+  const decl = file.ast.decls.find(d => {
+    const pos = (d.type !== 'BadDecl' && d.doc?.pos) || d.pos;
+    return pos <= index && index <= d.end;
+  });
+  if (!decl || decl.type === 'BadDecl') {
+    throw new ToolError(
+      'symbol_not_found',
+      'No top-level declaration found at the given position'
+    );
+  }
+  if (decl.type === 'GenDecl' && decl.tok === 'import') {
+    throw new ToolError(
+      'unsupported_construct',
+      'Import declarations cannot be moved'
+    );
+  }
+  if (
+    decl.type === 'GenDecl' &&
+    decl.lparen >= 0 &&
+    decl.specs.length > 1 &&
+    decl.tok !== 'const'
+  ) {
+    const spec = decl.specs.find(
+      s => (s.doc?.pos ?? s.pos) <= index && index <= s.end
+    );
+    if (spec) return { decl, spec };
+  }
+  return { decl };
+}
+
+// Returns the existing file at destPath, after checking that declarations
+// of file can be moved there.
+function checkDestination(
+  program: GoProgram,
+  file: GoSourceFile,
+  destPath: string
+): GoSourceFile | undefined {
+  if (!destPath.endsWith('.go') || dirname(destPath) !== file.pkg.dir) {
+    throw new ToolError(
+      'invalid_argument',
+      `The destination must be a Go file in ${displayPath(file.pkg.dir)}, the directory of package ${file.pkg.name}`
+    );
+  }
+  const existing = program.file(destPath);
+  if (existsSync(destPath) && !existing) {
+    throw new ToolError(
+      'invalid_argument',
+      `${displayPath(destPath)} is not a Go source file of package ${file.pkg.name}`
+    );
+  }
+  if (existing && existing.pkg !== file.pkg) {
+    throw new ToolError(
+      'invalid_argument',
+      `${displayPath(destPath)} belongs to package ${existing.pkg.name}, not ${file.pkg.name}`
+    );
+  }
+  const isTest = (path: string) => path.endsWith('_test.go');
+  if (isTest(destPath) && !isTest(file.filePath)) {
+    throw new ToolError(
+      'invalid_argument',
+      `Moving into ${basename(destPath)} would make the declaration visible to tests only`
+    );
+  }
+  if (existing && buildConstraint(existing) !== buildConstraint(file)) {
+    throw new ToolError(
+      'invalid_argument',
+      `${displayPath(destPath)} and ${displayPath(file.filePath)} have different build constraints`
+    );
+  }
+  return existing;
+}
+
+export async function performMoveDeclaration(
+  options: MoveDeclarationOptions
+): Promise<MoveDeclarationResult> {
+  const { dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const moved = movedAt(file, resolveLocation(file, options));
+
+  const destPath = resolve(options.destination);
+  if (destPath === file.filePath) {
+    throw new ToolError(
+      'invalid_argument',
+      'The destination is the file declaring the declaration'
+    );
+  }
+  const existing = checkDestination(program, file, destPath);
+  const dest = existing ?? newGoFile(destPath, file.pkg);
+  const missing: ImportRequest[] = [];
+  const { text, removal } = movedText(
+    program,
+    info,
+    file,
+    moved,
+    dest,
+    missing
+  );
+  const source = pruneImports(file, info, applyTextEdits(file.src, [removal]));
+  const updated = appendTo(dest, missing, [text]);
+
+  return {
+    names: namesOf(moved),
+    from: displayPath(file.filePath),
+    to: displayPath(destPath),
+    created: !existing,
+    changes: await commitFileChanges(
+      [
+        { filePath: file.filePath, original: file.src, updated: source },
+        { filePath: destPath, original: existing?.src ?? '', updated },
+      ],
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+export function formatMoveDeclarationResults(
+  result: MoveDeclarationResult
+): string {
+  const names = result.names.map(n => `'${n}'`).join(', ');
+  const created = result.created ? ' (new file)' : '';
+  return `Moved ${names} from ${result.from} to ${result.to}${created}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
+
+export async function performSplitFile(
+  options: SplitFileOptions
+): Promise<SplitFileResult> {
+  const { dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const targets = Object.entries(options.targets);
+  if (targets.length === 0) {
+    throw new ToolError('invalid_argument', 'No declarations to move');
+  }
+
+  const movable = movableDecls(file);
+  const destOf = new Map<Moved, string>();
+  for (const [name, target] of targets) {
+    const matching = movable.filter(m => namesOf(m).includes(name));
+    if (matching.length === 0) {
+      throw new ToolError(
+        'symbol_not_found',
+        `'${name}' is not a top-level declaration of ${displayPath(file.filePath)}`
+      );
+    }
+    const destPath = resolve(file.pkg.dir, target);
+    for (const m of matching) {
+      const other = destOf.get(m);
+      if (other !== undefined && other !== destPath) {
+        throw new ToolError(
+          'invalid_argument',
+          `${namesOf(m)
+            .map(n => `'${n}'`)
+            .join(', ')} are declared together and cannot be moved to different files`
+        );
+      }
+      destOf.set(m, destPath);
+    }
+  }
+  // Declarations mapped to their own file stay.
+  for (const [m, destPath] of destOf) {
+    if (destPath === file.filePath) destOf.delete(m);
+  }
+  // A grouped declaration whose specs all go to one file moves as a whole.
+  const moves: { moved: Moved; destPath: string }[] = [];
+  for (const m of movable) {
+    const destPath = destOf.get(m);
+    if (destPath === undefined) continue;
+    if (m.spec) {
+      const group = movable.filter(o => o.decl === m.decl);
+      if (group.every(o => destOf.get(o) === destPath)) {
+        if (group[0] === m) moves.push({ moved: { decl: m.decl }, destPath });
+        continue;
+      }
+    }
+    moves.push({ moved: m, destPath });
+  }
+
+  const dests = new Map<
+    string,
+    {
+      dest: GoSourceFile;
+      existing?: GoSourceFile;
+      missing: ImportRequest[];
+      texts: string[];
+      names: string[];
+    }
+  >();
+  const removals: TextEdit[] = [];
+  for (const { moved, destPath } of moves) {
+    if (!dests.has(destPath)) {
+      const existing = checkDestination(program, file, destPath);
+      dests.set(destPath, {
+        dest: existing ?? newGoFile(destPath, file.pkg),
+        existing,
+        missing: [],
+        texts: [],
+        names: [],
+      });
+    }
+    const d = dests.get(destPath)!;
+    const { text, removal } = movedText(
+      program,
+      info,
+      file,
+      moved,
+      d.dest,
+      d.missing
+    );
+    d.texts.push(text);
+    d.names.push(...namesOf(moved));
+    removals.push(removal);
+  }
+  // A grouped declaration losing all of its specs is removed as a whole.
+  const emptied = new Set(
+    moves
+      .filter(({ moved }) => moved.spec)
+      .map(({ moved }) => moved.decl as GenDecl)
+      .filter(decl =>
+        decl.specs.every(s => moves.some(({ moved }) => moved.spec === s))
+      )
+  );
+  for (const decl of emptied) removals.push(declRemovalEdit(file.src, decl));
+
+  const source = pruneImports(
+    file,
+    info,
+    applyTextEdits(file.src, mergeRemovals(file.src, removals))
+  );
+  const changes: FileChange[] = [
+    { filePath: file.filePath, original: file.src, updated: source },
+    ...[...dests].map(([destPath, d]) => ({
+      filePath: destPath,
+      original: d.existing?.src ?? '',
+      updated: appendTo(d.dest, d.missing, d.texts),
+    })),
+  ];
+
+  return {
+    from: displayPath(file.filePath),
+    moves: [...dests].map(([destPath, d]) => ({
+      to: displayPath(destPath),
+      names: d.names,
+      created: !d.existing,
+    })),
+    changes: await commitFileChanges(changes, dryRun, options),
+    dryRun,
+  };
+}
+
+export function formatSplitFileResults(result: SplitFileResult): string {
+  const count = result.moves.reduce((n, m) => n + m.names.length, 0);
+  const declarations = count === 1 ? '1 declaration' : `${count} declarations`;
+  const output = [`Moved ${declarations} out of ${result.from}:`];
+  for (const move of result.moves) {
+    const created = move.created ? ' (new file)' : '';
+    const names = move.names.map(n => `'${n}'`).join(', ');
+    output.push(`  ${move.to}${created}: ${names}`);
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,451 @@
+import { existsSync, readFileSync, readdirSync, statSync } from 'fs';
+import { homedir } from 'os';
+import { delimiter, join, relative, resolve, sep } from 'path';
+import type { GenDecl, ImportSpec } from '../utils/go-ast.js';
+import { isExported, pathEnclosingInterval } from '../utils/go-ast.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  declRemovalEdit,
+  importLine,
+  importPathOf,
+  lineEnd,
+  lineStart,
+} from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { GoProgram } from '../utils/go-loader.js';
+import type { GoModule, LoadOptions } from '../utils/go-loader.js';
+import { locationOf } from '../utils/go-references.js';
+import {
+  PREFERRED_STANDARD_PACKAGES,
+  STANDARD_PACKAGES,
+} from '../utils/go-stdlib.js';
+import { defaultPackageName } from '../utils/go-types.js';
+import type { GoObject, GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { displayPath } from '../utils/file-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface OrganizeImportsOptions extends LoadOptions, WriteOptions {
+  // A Go file, or a package directory to organize every file of.
+  filePath: string;
+  dryRun?: boolean;
+}
+
+export interface OrganizedFile {
+  filePath: string;
+  added: string[];
+  removed: string[];
+}
+
+export interface OrganizeImportsResult {
+  // The files whose imports changed.
+  files: OrganizedFile[];
+  // Package names used without an import that could not be resolved, as
+  // name (path:line:column).
+  unresolved: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// An import of the organized declaration, with the comments that go with
+// it.
+interface Entry {
+  path: string;
+  name: string;
+  // The spec as it will be written, comment lines included, one per line
+  // and without indentation.
+  lines: string[];
+}
+
+type Section = 'std' | 'third-party' | 'module';
+
+// Sorts path into a section for a file of module. Other modules of a
+// workspace are third-party, as they are for the go command.
+function sectionOf(module: GoModule | undefined, path: string): Section {
+  const modulePath = module?.path ?? '';
+  const local = path === modulePath || path.startsWith(`${modulePath}/`);
+  if (modulePath && local) return 'module';
+  return path.split('/')[0].includes('.') ? 'third-party' : 'std';
+}
+
+const SECTIONS: Section[] = ['std', 'third-party', 'module'];
+
+// Returns the module cache directory of the go command.
+function moduleCache(): string {
+  if (process.env.GOMODCACHE) return process.env.GOMODCACHE;
+  const gopath =
+    process.env.GOPATH?.split(delimiter)[0] || join(homedir(), 'go');
+  return join(gopath, 'pkg', 'mod');
+}
+
+// Escapes a module path the way the module cache does: upper-case letters
+// become '!' followed by the lower-case letter.
+function escapeModulePath(path: string): string {
+  return path.replace(/\p{Lu}/gu, c => `!${c.toLowerCase()}`);
+}
+
+// Lists the modules required by the go.mod of module.
+function requiredModules(
+  module: GoModule
+): { path: string; version: string }[] {
+  const modFile = join(module.root, 'go.mod');
+  const content = readFileSync(modFile, 'utf-8');
+  const required: { path: string; version: string }[] = [];
+  let inBlock = false;
+  for (const raw of content.split('\n')) {
+    const line = raw.replace(/\/\/.*$/, '').trim();
+    if (inBlock) {
+      if (line === ')') inBlock = false;
+      else {
+        const m = line.match(/^("?)([^\s"]+)\1\s+(\S+)$/);
+        if (m) required.push({ path: m[2], version: m[3] });
+      }
+      continue;
+    }
+    if (/^require\s*\($/.test(line)) {
+      inBlock = true;
+      continue;
+    }
+    const m = line.match(/^require\s+("?)([^\s"]+)\1\s+(\S+)$/);
+    if (m) required.push({ path: m[2], version: m[3] });
+  }
+  return required;
+}
+
+// Lists the importable packages of the required modules found in the
+// module cache, by package name. Modules of the workspace are loaded with
+// the program instead, and a module required by several of them is listed
+// once.
+function cachedPackages(program: GoProgram): Map<string, string[]> {
+  const byName = new Map<string, string[]>();
+  const cache = moduleCache();
+  const seen = new Set(program.modules.map(m => m.path));
+  for (const mod of program.modules.flatMap(m => requiredModules(m))) {
+    if (seen.has(mod.path)) continue;
+    seen.add(mod.path);
+    const root = join(cache, `${escapeModulePath(mod.path)}@${mod.version}`);
+    if (!existsSync(root)) continue;
+    const visit = (dir: string) => {
+      const entries = readdirSync(dir, { withFileTypes: true });
+      const source = entries.find(
+        e =>
+          e.isFile() && e.name.endsWith('.go') && !e.name.endsWith('_test.go')
+      );
+      if (source) {
+        const src = readFileSync(join(dir, source.name), 'utf-8');
+        const name = src.match(/^package\s+(\w+)/m)?.[1];
+        if (name && name !== 'main') {
+          const rel = relative(root, dir).split(sep).join('/');
+          const path = rel ? `${mod.path}/${rel}` : mod.path;
+          (byName.get(name) ?? byName.set(name, []).get(name)!).push(path);
+        }
+      }
+      for (const e of entries) {
+        if (!e.isDirectory() || /^[._]/.test(e.name)) continue;
+        // Internal packages of other modules cannot be imported.
+        if (['testdata', 'vendor', 'internal'].includes(e.name)) continue;
+        const sub = join(dir, e.name);
+        if (!existsSync(join(sub, 'go.mod'))) visit(sub);
+      }
+    };
+    visit(root);
+  }
+  return byName;
+}
+
+// Resolves the package a file refers to as name, selecting the given
+// members, to an import. Packages of the module that declare every member
+// come first, then the standard library, then the packages of required
+// modules in the module cache, preferring the shortest import path.
+function resolveImport(
+  program: GoProgram,
+  file: GoSourceFile,
+  name: string,
+  members: Set<string>,
+  cached: () => Map<string, string[]>
+): ImportRequest | undefined {
+  const local = program.packages.filter(
+    pkg =>
+      pkg.name === name &&
+      !pkg.isXTest &&
+      pkg.name !== 'main' &&
+      pkg !== file.pkg &&
+      [...members].every(m => isExported(m) && pkg.scope?.lookup(m))
+  );
+  if (local.length > 0) {
+    const path = local.map(pkg => pkg.importPath).sort(byLength)[0];
+    return { path, name };
+  }
+  const std =
+    PREFERRED_STANDARD_PACKAGES[name] ??
+    STANDARD_PACKAGES.find(p => defaultPackageName(p) === name);
+  if (std) return { path: std, name };
+  const paths = cached().get(name);
+  if (paths) return { path: [...paths].sort(byLength)[0], name };
+  return undefined;
+}
+
+function byLength(a: string, b: string): number {
+  return a.length - b.length || (a < b ? -1 : a > b ? 1 : 0);
+}
+
+// Returns the names file selects members of without declaring or importing
+// them, with the selected members and the first place each is used.
+function missingNames(
+  info: GoInfo,
+  file: GoSourceFile
+): Map<string, { members: Set<string>; pos: number }> {
+  const names = new Map<string, { members: Set<string>; pos: number }>();
+  for (const u of info.unresolved) {
+    if (u.file !== file || u.selector) continue;
+    const path = pathEnclosingInterval(file.ast, u.ident.pos, u.ident.end);
+    const parent = path[path.length - 2];
+    if (parent?.type !== 'SelectorExpr' || parent.x !== u.ident) continue;
+    const entry = names.get(u.ident.name);
+    if (entry) entry.members.add(parent.sel.name);
+    else {
+      names.set(u.ident.name, {
+        members: new Set([parent.sel.name]),
+        pos: u.ident.pos,
+      });
+    }
+  }
+  return names;
+}
+
+// Returns the lines of spec, together with its doc comment and trailing
+// comment. Comments are those between from and the spec.
+function specLines(src: string, spec: ImportSpec, from: number): string[] {
+  const lead = src.substring(from, lineStart(src, spec.pos));
+  const rest = src.substring(spec.end, lineEnd(src, spec.end)).trimEnd();
+  const trailing = rest.trim().startsWith('//') ? rest : '';
+  return [
+    ...lead
+      .split('\n')
+      .map(l => l.trim())
+      .filter(l => l !== ''),
+    src.substring(spec.pos, spec.end) + trailing,
+  ];
+}
+
+interface FileResult {
+  updated: string;
+  added: string[];
+  removed: string[];
+  unresolved: string[];
+}
+
+function organizeFile(
+  program: GoProgram,
+  info: GoInfo,
+  file: GoSourceFile,
+  cached: () => Map<string, string[]>
+): FileResult {
+  const { src } = file;
+  const module = program.moduleOf(file.filePath);
+  const decls = file.ast.decls.filter(
+    (d): d is GenDecl => d.type === 'GenDecl' && d.tok === 'import'
+  );
+  // import "C" must stay right after its preamble comment, so declarations
+  // importing it are left alone.
+  const isCgo = (d: GenDecl) =>
+    (d.specs as ImportSpec[]).some(s => importPathOf(s) === 'C');
+  const merged = decls.filter(d => !isCgo(d));
+
+  const used = new Set<GoObject>();
+  for (const obj of info.uses.values()) {
+    if (obj.kind === 'pkgname' && obj.file === file) used.add(obj);
+  }
+
+  const entries: Entry[] = [];
+  const removed: string[] = [];
+  const unused: Entry[] = [];
+  let tail: string[] = [];
+  for (const decl of merged) {
+    const specs = decl.specs as ImportSpec[];
+    let from =
+      decl.lparen >= 0
+        ? lineEnd(src, decl.lparen)
+        : decl === merged[0]
+          ? lineStart(src, decl.pos)
+          : lineStart(src, decl.doc?.pos ?? decl.pos);
+    for (const spec of specs) {
+      const path = importPathOf(spec);
+      const name = spec.name?.name ?? '';
+      const entry = { path, name, lines: specLines(src, spec, from) };
+      from = lineEnd(src, spec.end);
+      if (entries.some(e => e.path === path && e.name === name)) continue;
+      const obj = info.implicits.get(spec);
+      if (name === '_' || name === '.' || !obj || used.has(obj)) {
+        entries.push(entry);
+      } else if (!name && sectionOf(module, path) === 'third-party') {
+        // The package name of a dependency outside the module is only
+        // guessed from its path, so it may be used under another name.
+        unused.push(entry);
+      } else {
+        removed.push(path);
+      }
+    }
+    if (decl.lparen >= 0) {
+      const rest = src.substring(from, lineStart(src, decl.rparen));
+      tail = [...tail, ...rest.split('\n').map(l => l.trim())].filter(
+        l => l !== ''
+      );
+    }
+  }
+
+  const added: string[] = [];
+  const unresolved: string[] = [];
+  for (const [name, { members, pos }] of missingNames(info, file)) {
+    const request = resolveImport(program, file, name, members, cached);
+    if (!request) {
+      unresolved.push(`${name} (${locationOf(file, pos)})`);
+      continue;
+    }
+    if (entries.some(e => e.path === request.path)) continue;
+    entries.push({ ...request, name: '', lines: [importLine(request)] });
+    added.push(request.path);
+  }
+  // Unused imports are only removed when every name is accounted for.
+  for (const entry of unused) {
+    if (unresolved.length > 0) entries.push(entry);
+    else removed.push(entry.path);
+  }
+
+  const groups = SECTIONS.map(section =>
+    entries
+      .filter(e => sectionOf(module, e.path) === section)
+      .sort((a, b) =>
+        a.path !== b.path
+          ? a.path < b.path
+            ? -1
+            : 1
+          : a.name < b.name
+            ? -1
+            : a.name > b.name
+              ? 1
+              : 0
+      )
+  ).filter(g => g.length > 0);
+
+  const first = merged[0];
+  const single =
+    entries.length === 1 &&
+    entries[0].lines.length === 1 &&
+    tail.length === 0 &&
+    (!first || first.lparen < 0);
+  const block = single
+    ? `import ${entries[0].lines[0]}`
+    : `import (\n${groups
+        .map(g => g.flatMap(e => e.lines.map(l => `\t${l}\n`)).join(''))
+        .join('\n')}${tail.map(l => `\t${l}\n`).join('')})`;
+
+  const edits: TextEdit[] = [];
+  if (entries.length === 0) {
+    for (const decl of merged) edits.push(declRemovalEdit(src, decl));
+  } else if (first) {
+    edits.push({ pos: first.pos, end: first.end, newText: block });
+    for (const decl of merged.slice(1)) {
+      edits.push(declRemovalEdit(src, decl));
+    }
+  } else {
+    const after = decls[decls.length - 1]?.end ?? file.ast.name.end;
+    edits.push({ pos: after, end: after, newText: `\n\n${block}` });
+  }
+  return {
+    updated: applyTextEdits(src, edits),
+    added,
+    removed,
+    unresolved,
+  };
+}
+
+export async function performOrganizeImports(
+  options: OrganizeImportsOptions
+): Promise<OrganizeImportsResult> {
+  const { dryRun = false } = options;
+  const target = resolve(options.filePath);
+  const program = await GoProgram.load(target, options);
+  const isDir = existsSync(target) && statSync(target).isDirectory();
+  const files = isDir
+    ? program.packages.filter(p => p.dir === target).flatMap(p => p.files)
+    : program.files.filter(f => f.filePath === target);
+  if (files.length === 0) {
+    const error = program.errors.find(e => e.filePath === target);
+    if (error) {
+      throw new ToolError('compile_error', error.message, error.location);
+    }
+    throw new ToolError(
+      'invalid_location',
+      isDir
+        ? `No Go package found in ${options.filePath}`
+        : `Not a Go source file in the module: ${options.filePath}`
+    );
+  }
+
+  const info = (await program.checkAsync(options)).info;
+  let packages: Map<string, string[]> | undefined;
+  const cached = () => (packages ??= cachedPackages(program));
+  const organized: OrganizedFile[] = [];
+  const unresolved: string[] = [];
+  const changes: FileChange[] = [];
+  for (const file of files) {
+    const result = organizeFile(program, info, file, cached);
+    unresolved.push(...result.unresolved);
+    if (result.updated === file.src) continue;
+    organized.push({
+      filePath: displayPath(file.filePath),
+      added: result.added,
+      removed: result.removed,
+    });
+    changes.push({
+      filePath: file.filePath,
+      original: file.src,
+      updated: result.updated,
+    });
+  }
+
+  return {
+    files: organized,
+    unresolved,
+    changes: await commitFileChanges(changes, dryRun, options),
+    dryRun,
+  };
+}
+
+export function formatOrganizeImportsResults(
+  result: OrganizeImportsResult
+): string {
+  const output: string[] = [];
+  if (result.files.length === 0) {
+    output.push('Imports are already organized');
+  } else {
+    const count = result.files.length;
+    output.push(
+      `Organized the imports of ${count} file${count === 1 ? '' : 's'}:`
+    );
+    for (const file of result.files) {
+      const details = [
+        ...file.added.map(p => `+${p}`),
+        ...file.removed.map(p => `-${p}`),
+      ];
+      const suffix = details.length > 0 ? `: ${details.join(', ')}` : '';
+      output.push(`  ${file.filePath}${suffix}`);
+    }
+  }
+  if (result.unresolved.length > 0) {
+    output.push('Could not find packages for:');
+    output.push(...result.unresolved.map(u => `  ${u}`));
+  }
+  if (result.files.length === 0) return output.join('\n');
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,227 @@
+import { existsSync, readFileSync } from 'fs';
+import { basename, dirname, join, relative, sep } from 'path';
+import { displayPath } from '../utils/file-utils.js';
+import type { FileEvent } from '../utils/file-utils.js';
+import {
+  GoProgram,
+  dirImportPath,
+  findGoModule,
+} from '../utils/go-loader.js';
+import { unquoteGoString } from '../utils/go-scanner.js';
+import type { GoPackage } from '../utils/go-types.js';
+import { ToolError } from '../utils/tool-error.js';
+
+// The MCP resources browse the Go module the server runs in: gomod://packages
+// lists its packages, gopkg://<import path> describes a package and its
+// files, and gofile://<import path>/<name> is the source of a file. The
+// import path in the URI of a file is that of its directory, so the files of
+// an external test package are named like those of the package beside it.
+
+export const PACKAGES_URI = 'gomod://packages';
+
+export function packageUri(importPath: string): string {
+  return `gopkg://${importPath}`;
+}
+
+export function fileUri(dirImportPath: string, name: string): string {
+  return `gofile://${dirImportPath}/${name}`;
+}
+
+// The directory whose module, or workspace, the resources expose:
+// $REFACTOR_MCP_ROOT, or the working directory of the server.
+export function resourceRoot(): string {
+  return process.env.REFACTOR_MCP_ROOT || process.cwd();
+}
+
+export interface ModuleSummary {
+  path: string;
+  root: string;
+}
+
+export interface PackageSummary {
+  importPath: string;
+  name: string;
+  dir: string;
+  uri: string;
+  // The number of files the build constraints include.
+  files: number;
+}
+
+export interface PackageList {
+  // The modules of the workspace, or the module alone.
+  modules: ModuleSummary[];
+  packages: PackageSummary[];
+}
+
+export interface PackageFile {
+  name: string;
+  uri: string;
+  // The constraint that leaves the file out of the package, such as its
+  // //go:build line.
+  excludedBy?: string;
+}
+
+export interface PackageDetail {
+  importPath: string;
+  name: string;
+  dir: string;
+  uri: string;
+  // True for an external test package (package foo_test).
+  isXTest: boolean;
+  files: PackageFile[];
+  // The import paths the files of the package import, sorted.
+  imports: string[];
+}
+
+// A resource a client can read, as listed by resources/list.
+export interface ResourceEntry {
+  uri: string;
+  name: string;
+  mimeType: string;
+}
+
+function summary(pkg: GoPackage): PackageSummary {
+  return {
+    importPath: pkg.importPath,
+    name: pkg.name,
+    dir: displayPath(pkg.dir),
+    uri: packageUri(pkg.importPath),
+    files: pkg.files.length,
+  };
+}
+
+function sortedPackages(program: GoProgram): GoPackage[] {
+  return [...program.packages].sort((a, b) =>
+    a.importPath < b.importPath ? -1 : 1
+  );
+}
+
+export function listPackages(root = resourceRoot()): PackageList {
+  const program = GoProgram.forPath(root);
+  return {
+    modules: program.modules.map(m => ({
+      path: m.path,
+      root: displayPath(m.root),
+    })),
+    packages: sortedPackages(program).map(summary),
+  };
+}
+
+function findPackage(program: GoProgram, importPath: string): GoPackage {
+  const pkg = program.packages.find(p => p.importPath === importPath);
+  if (!pkg) {
+    throw new ToolError(
+      'symbol_not_found',
+      `No package ${importPath} in the module at ${displayPath(program.modules[0].root)}`
+    );
+  }
+  return pkg;
+}
+
+export function readPackage(
+  importPath: string,
+  root = resourceRoot()
+): PackageDetail {
+  const program = GoProgram.forPath(root);
+  const pkg = findPackage(program, importPath);
+  const dirPath = dirImportPath(pkg);
+  const files: PackageFile[] = pkg.files.map(f => ({
+    name: basename(f.filePath),
+    uri: fileUri(dirPath, basename(f.filePath)),
+  }));
+  // Files left out by build constraints are listed with the package proper,
+  // since which package they declare is not known.
+  if (!pkg.isXTest) {
+    for (const file of program.excluded) {
+      if (dirname(file.filePath) !== pkg.dir) continue;
+      const name = basename(file.filePath);
+      files.push({
+        name,
+        uri: fileUri(dirPath, name),
+        excludedBy: file.constraint,
+      });
+    }
+    files.sort((a, b) => (a.name < b.name ? -1 : 1));
+  }
+  const imports = new Set(
+    pkg.files.flatMap(f =>
+      f.ast.imports.map(spec => unquoteGoString(spec.path.value))
+    )
+  );
+  return {
+    importPath: pkg.importPath,
+    name: pkg.name,
+    dir: displayPath(pkg.dir),
+    uri: packageUri(pkg.importPath),
+    isXTest: pkg.isXTest,
+    files,
+    imports: [...imports].sort(),
+  };
+}
+
+// Returns the source of the file name in the directory of the package
+// dirImportPath, which may be left out by build constraints.
+export function readGoFile(
+  dirImportPath: string,
+  name: string,
+  root = resourceRoot()
+): string {
+  const program = GoProgram.forPath(root);
+  const pkg =
+    program.packageByImportPath(dirImportPath) ??
+    program.packages.find(p => p.importPath === `${dirImportPath}_test`);
+  const filePath = pkg && join(pkg.dir, name);
+  const known =
+    filePath !== undefined &&
+    (program.file(filePath) !== undefined ||
+      program.excluded.some(f => f.filePath === filePath));
+  if (!known || !existsSync(filePath)) {
+    throw new ToolError(
+      'file_not_found',
+      `No Go file ${name} in package ${dirImportPath}`
+    );
+  }
+  return program.file(filePath)?.src ?? readFileSync(filePath, 'utf-8');
+}
+
+// Lists every package as a resource, or none when root is not in a module.
+export function packageResources(root = resourceRoot()): ResourceEntry[] {
+  if (!findGoModule(root)) return [];
+  return sortedPackages(GoProgram.forPath(root)).map(pkg => ({
+    uri: packageUri(pkg.importPath),
+    name: pkg.importPath,
+    mimeType: 'application/json',
+  }));
+}
+
+// Lists every Go file of the packages as a resource, or none when root is
+// not in a module.
+export function fileResources(root = resourceRoot()): ResourceEntry[] {
+  if (!findGoModule(root)) return [];
+  return sortedPackages(GoProgram.forPath(root)).flatMap(pkg =>
+    pkg.files.map(f => ({
+      uri: fileUri(dirImportPath(pkg), basename(f.filePath)),
+      name: `${dirImportPath(pkg)}/${basename(f.filePath)}`,
+      mimeType: 'text/x-go',
+    }))
+  );
+}
+
+// Returns the URIs of the resources whose content the event changes: the
+// file, its package and, when a file is created or removed, the list of
+// packages. Files outside of modules have none.
+export function affectedResources(event: FileEvent): string[] {
+  const { filePath, kind } = event;
+  if (!filePath.endsWith('.go')) return [];
+  const dir = dirname(filePath);
+  const module = findGoModule(dir);
+  if (!module) return [];
+  const rel = relative(module.root, dir).split(sep).join('/');
+  const importPath = rel ? `${module.path}/${rel}` : module.path;
+  const uris = [
+    fileUri(importPath, basename(filePath)),
+    packageUri(importPath),
+    packageUri(`${importPath}_test`),
+  ];
+  return kind === 'changed' ? uris : [...uris, PACKAGES_URI];
+}
@@ -1,9 +1,14 @@
 import { existsSync } from 'fs';
+import { resolve } from 'path';
 import {
   searchFiles,
   readFileContent,
-  writeFileContent,
+  writeFilesAtomically,
 } from '../utils/file-utils.js';
+import type { FileWrite } from '../utils/file-utils.js';
+import { createUnifiedDiff } from '../utils/diff-utils.js';
+import { recordOperation } from '../utils/undo-history.js';
+import type { FileSnapshot } from '../utils/undo-history.js';
 
 export interface RefactorOptions {
   searchPattern: string;
@@ -26,6 +31,8 @@ export interface RefactorResult {
   replacements: number;
   matches: RefactorMatch[];
   modified: boolean;
+  // Unified diff of the change, present for dry runs.
+  diff?: string;
 }
 
 export async function performRefactor(
@@ -33,6 +40,10 @@ export async function performRefactor(
 ): Promise<RefactorResult[]> {
   const files = await searchFiles(options.filePattern);
   const results: RefactorResult[] = [];
+  // Every replacement is computed before anything is written, so that a
+  // failure leaves all files untouched.
+  const writes: FileWrite[] = [];
+  const snapshots: FileSnapshot[] = [];
 
   for (const filePath of files) {
     if (!existsSync(filePath)) continue;
@@ -130,7 +141,12 @@ export async function performRefactor(
 
     if (modified) {
       if (!options.dryRun) {
-        writeFileContent(filePath, newContent);
+        writes.push({ filePath, content: newContent });
+        snapshots.push({
+          filePath: resolve(filePath),
+          before: content,
+          after: newContent,
+        });
       }
 
       results.push({
@@ -138,10 +154,15 @@ export async function performRefactor(
         replacements: fileReplacements,
         matches: matchedLines,
         modified: true,
+        diff: options.dryRun
+          ? createUnifiedDiff(filePath, content, newContent)
+          : undefined,
       });
     }
   }
 
+  writeFilesAtomically(writes);
+  recordOperation(snapshots);
   return results;
 }
 
@@ -163,7 +184,10 @@ export function formatRefactorResults(
   }
 
   if (formatOptions.includeCaptureGroups || formatOptions.includeMatchedText) {
-    return formatDetailedRefactorResults(results, formatOptions);
+    return (
+      formatDetailedRefactorResults(results, formatOptions) +
+      formatDiffs(results)
+    );
   }
 
   const formattedResults = results.map(
@@ -176,7 +200,15 @@ export function formatRefactorResults(
     0
   );
 
-  return `Refactoring completed:\n${formattedResults.join('\n')}\n\nTotal: ${totalReplacements} replacements in ${results.length} files`;
+  return (
+    `Refactoring completed:\n${formattedResults.join('\n')}\n\nTotal: ${totalReplacements} replacements in ${results.length} files${formatOptions.dryRun ? ' (dry run)' : ''}` +
+    formatDiffs(results)
+  );
+}
+
+function formatDiffs(results: RefactorResult[]): string {
+  const diffs = results.filter(result => result.diff).map(result => result.diff);
+  return diffs.length > 0 ? `\n\n${diffs.join('')}` : '';
 }
 
 function formatDetailedRefactorResults(
@@ -0,0 +1,48 @@
+import { existsSync, statSync } from 'fs';
+import { dirname, resolve } from 'path';
+import { displayPath } from '../utils/file-utils.js';
+import { clearGoCache, findGoModule } from '../utils/go-loader.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ReloadOptions {
+  // A file or directory of the module to reload; every cached module is
+  // dropped when omitted.
+  filePath?: string;
+}
+
+export interface ReloadResult {
+  // Root of the reloaded module, when one was given.
+  root?: string;
+  // Number of modules whose cached packages were dropped.
+  cleared: number;
+}
+
+export async function performReload(
+  options: ReloadOptions
+): Promise<ReloadResult> {
+  if (options.filePath === undefined) {
+    return { cleared: clearGoCache() };
+  }
+  const abs = resolve(options.filePath);
+  const dir =
+    existsSync(abs) && statSync(abs).isDirectory() ? abs : dirname(abs);
+  const module = findGoModule(dir);
+  if (!module) {
+    throw new ToolError(
+      'invalid_location',
+      `No go.mod found for ${options.filePath}`
+    );
+  }
+  return { root: module.root, cleared: clearGoCache(module.root) };
+}
+
+export function formatReloadResults(result: ReloadResult): string {
+  if (result.root !== undefined) {
+    const root = displayPath(result.root);
+    return result.cleared > 0
+      ? `Cleared the cached packages of ${root}; the next call loads them from disk`
+      : `No packages of ${root} were cached`;
+  }
+  const count = result.cleared;
+  return `Cleared the cached packages of ${count} module${count === 1 ? '' : 's'}`;
+}
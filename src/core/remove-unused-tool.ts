@@ -0,0 +1,507 @@
+import type {
+  AssignStmt,
+  Expr,
+  FuncDecl,
+  GenDecl,
+  Ident,
+  IncDecStmt,
+  Node,
+  ValueSpec,
+} from '../utils/go-ast.js';
+import {
+  children,
+  inspect,
+  pathEnclosingInterval,
+  unparen,
+} from '../utils/go-ast.js';
+import { isPure, relatedMethods } from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  importPathOf,
+  pruneImports,
+  specRemovalEdit,
+  stmtRemovalEdit,
+} from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { GoProgram, LoadOptions } from '../utils/go-loader.js';
+import { parseGoFile } from '../utils/go-parser.js';
+import {
+  findReferences,
+  locationOf,
+  resolveLocation,
+  resolveSymbol,
+} from '../utils/go-references.js';
+import type { GoSymbolInput } from '../utils/go-references.js';
+import { applySignatureEdits, signatureEdits } from '../utils/go-signature.js';
+import type { FileEdits, ParameterChange } from '../utils/go-signature.js';
+import type { GoObject, GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface RemoveUnusedOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoSymbolInput {
+  // The file of the function, located anywhere inside it or by symbol.
+  filePath: string;
+  // Whether to also drop the parameters the function does not use, from
+  // its declaration and every call.
+  removeParameters?: boolean;
+  dryRun?: boolean;
+}
+
+export interface RemoveUnusedResult {
+  // The function, as F or T.M.
+  functionName: string;
+  // The variables and parameters removed, as name (path:line:column).
+  variables: string[];
+  parameters: string[];
+  // The paths of the imports removed.
+  imports: string[];
+  // The unused parameters kept, and why.
+  keptParameters: string[];
+  keptReason?: string;
+  // Locations of the calls whose arguments were dropped.
+  callSites: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// A statement or var spec declaring or writing variables.
+type Site = AssignStmt | IncDecStmt | ValueSpec;
+
+// Reports whether e is a receive, which may stand as a statement. Calls
+// returning values are rather assigned to _, as vet flags some of them
+// otherwise.
+function isReceive(e: Expr): boolean {
+  e = unparen(e);
+  return e.type === 'UnaryExpr' && e.op === '<-';
+}
+
+// Returns the edits deleting the items of a comma-separated list at the
+// indexes dropped, some of which are kept.
+function itemsRemoval(items: Node[], dropped: Set<number>): TextEdit[] {
+  const edits: TextEdit[] = [];
+  let lead = 0;
+  while (dropped.has(lead)) lead++;
+  if (lead > 0) {
+    edits.push({ pos: items[0].pos, end: items[lead].pos, newText: '' });
+  }
+  for (let k = lead + 1; k < items.length; k++) {
+    if (dropped.has(k)) {
+      edits.push({ pos: items[k - 1].end, end: items[k].end, newText: '' });
+    }
+  }
+  return edits;
+}
+
+// Reports whether an identifier is only written: assigned, incremented or
+// decremented. A redeclaration by := assigns too.
+function isWrite(parents: Map<Node, Node>, id: Ident): boolean {
+  const p = parents.get(id);
+  return (
+    (p?.type === 'AssignStmt' && p.lhs.includes(id)) ||
+    (p?.type === 'IncDecStmt' && p.x === id)
+  );
+}
+
+// Returns the statement a variable of an assignment or a var spec is
+// declared or assigned by.
+function statementOf(parents: Map<Node, Node>, site: Node): Node {
+  if (site.type !== 'ValueSpec') return site;
+  return parents.get(parents.get(site)!)!;
+}
+
+// Reports whether the statement that a site belongs to may be deleted or
+// rewritten: it is in a list of statements or initializes an if or switch.
+function isRewritable(parents: Map<Node, Node>, site: Node): boolean {
+  const stmt = statementOf(parents, site);
+  const p = parents.get(stmt);
+  switch (p?.type) {
+    case 'BlockStmt':
+    case 'CaseClause':
+    case 'CommClause':
+      return true;
+    case 'IfStmt':
+    case 'SwitchStmt':
+      return p.init === stmt;
+  }
+  return false;
+}
+
+// Reports whether the reference at [pos, end) is the function of a call.
+function isCalled(file: GoSourceFile, pos: number, end: number): boolean {
+  const path = pathEnclosingInterval(file.ast, pos, end);
+  let i = path.length - 1;
+  const parent = () => path[i - 1];
+  let p = parent();
+  if (p?.type === 'SelectorExpr' && p.sel === path[i]) p = path[--i - 1];
+  while (
+    (p?.type === 'IndexExpr' && p.x === path[i]) ||
+    p?.type === 'ParenExpr'
+  ) {
+    p = path[--i - 1];
+  }
+  return p?.type === 'CallExpr' && p.fun === path[i];
+}
+
+function functionName(decl: FuncDecl): string {
+  let recv = decl.recv?.list[0]?.fieldType;
+  while (
+    recv?.type === 'StarExpr' ||
+    recv?.type === 'IndexExpr' ||
+    recv?.type === 'ParenExpr'
+  ) {
+    recv = recv.x;
+  }
+  return recv?.type === 'Ident'
+    ? `${recv.name}.${decl.name.name}`
+    : decl.name.name;
+}
+
+// Finds the function declaration given by symbol or enclosing the
+// location.
+function functionOf(
+  program: GoProgram,
+  file: GoSourceFile,
+  options: RemoveUnusedOptions
+): { decl: FuncDecl; file: GoSourceFile } {
+  if (options.symbol !== undefined) {
+    const { obj } = resolveSymbol(program, file, options);
+    if (obj.kind !== 'func' || obj.decl?.type !== 'FuncDecl' || !obj.file) {
+      throw new ToolError(
+        'unsupported_construct',
+        `'${options.symbol}' is not a function or method declared in the module`
+      );
+    }
+    return { decl: obj.decl, file: obj.file };
+  }
+  const index = resolveLocation(file, options);
+  const decl = pathEnclosingInterval(file.ast, index).find(
+    (n): n is FuncDecl => n.type === 'FuncDecl'
+  );
+  if (!decl) {
+    throw new ToolError(
+      'invalid_location',
+      `No function at ${locationOf(file, index)}`
+    );
+  }
+  return { decl, file };
+}
+
+function plural(n: number, word: string): string {
+  return `${n} ${word}${n === 1 ? '' : 's'}`;
+}
+
+// Deletes the local variables of a function that are assigned but never
+// read, and the imports its file no longer uses. Assigning an expression
+// that may have effects keeps it as a statement of its own, or as _ = x.
+// Removing a variable can leave others unused, which go too. Parameters
+// the function does not use are dropped, along with the arguments of
+// every call, when removeParameters is set. Those of methods that declare
+// or implement interface methods, and of functions used as values, must
+// keep the signature and are reported instead.
+export async function performRemoveUnused(
+  options: RemoveUnusedOptions
+): Promise<RemoveUnusedResult> {
+  const { dryRun = false, removeParameters = false } = options;
+  const loaded = await loadGoFile(options.filePath, options);
+  const { program } = loaded;
+  const info = program.check().info;
+  const { decl, file } = functionOf(program, loaded.file, options);
+  const obj = info.defs.get(decl.name);
+  if (!decl.body || !obj) {
+    throw new ToolError(
+      'unsupported_construct',
+      `${functionName(decl)} has no body`
+    );
+  }
+  const name = functionName(decl);
+
+  const parents = new Map<Node, Node>();
+  inspect(decl, n => {
+    for (const child of children(n)) parents.set(child, n);
+  });
+  const uses = new Map<GoObject, Ident[]>();
+  const sites = new Map<GoObject, Site[]>();
+  const locals: GoObject[] = [];
+  inspect(decl, n => {
+    if (n.type !== 'Ident' || n.name === '_') return;
+    const p = parents.get(n)!;
+    const def = info.defs.get(n);
+    if (def?.kind === 'var' && n.pos >= decl.body!.pos) {
+      const declared =
+        (p.type === 'AssignStmt' && p.tok === ':=') ||
+        (p.type === 'ValueSpec' && p.names.includes(n));
+      if (declared) {
+        locals.push(def);
+        sites.set(def, [p as Site]);
+      }
+      return;
+    }
+    const use = info.uses.get(n);
+    if (!use) return;
+    uses.set(use, [...(uses.get(use) ?? []), n]);
+    if (isWrite(parents, n)) {
+      sites.set(use, [...(sites.get(use) ?? []), p as Site]);
+    }
+  });
+
+  // The parameters in order, undefined for those without a name.
+  const params = decl.funcType.params.list.flatMap(field =>
+    field.names.length === 0
+      ? [undefined]
+      : field.names.map(id => (id.name === '_' ? undefined : info.defs.get(id)))
+  );
+  let keptReason: string | undefined;
+  if (!removeParameters) {
+    keptReason =
+      'set remove_parameters to drop them from the signature and the calls';
+  } else {
+    const related = relatedMethods(program, obj).filter(m => m !== obj);
+    if (related.length > 0) {
+      const m = related[0];
+      const at = m.file ? locationOf(m.file, m.pos) : m.name;
+      keptReason = `${name} declares or implements the interface method at ${at}, whose signature it must keep`;
+    }
+    for (const ref of keptReason ? [] : findReferences(program, obj)) {
+      if (ref.isDeclaration || isCalled(ref.file, ref.pos, ref.end)) continue;
+      keptReason = `${name} is used as a value at ${locationOf(ref.file, ref.pos)}, which needs its signature`;
+      break;
+    }
+  }
+
+  // Every candidate starts out removed, and those still read outside of
+  // the code deleted with the others are put back until none is.
+  const unused = (candidates: GoObject[]) => {
+    const removed = new Set(
+      candidates.filter(v =>
+        (sites.get(v) ?? []).every(site => isRewritable(parents, site))
+      )
+    );
+    for (;;) {
+      const plan = planRemoval(info, file, parents, sites, removed);
+      const read = (id: Ident) =>
+        !isWrite(parents, id) &&
+        !plan.deleted.some(d => d.pos <= id.pos && id.end <= d.end);
+      const back = [...removed].filter(v => (uses.get(v) ?? []).some(read));
+      if (back.length === 0) return { removed, plan };
+      for (const v of back) removed.delete(v);
+    }
+  };
+  const named = params.filter((p): p is GoObject => !!p);
+  let { removed, plan } = unused([...locals, ...named]);
+  const dropped = named.filter(p => removed.has(p));
+  const keptParameters: string[] = [];
+  if (keptReason && dropped.length > 0) {
+    keptParameters.push(...dropped.map(p => p.name));
+    ({ removed, plan } = unused(locals));
+    dropped.length = 0;
+  }
+  const describe = (v: GoObject) => `${v.name} (${locationOf(file, v.pos)})`;
+
+  let files = new Map<GoSourceFile, FileEdits>();
+  let callSites: string[] = [];
+  if (dropped.length > 0) {
+    const changes: ParameterChange[] = params.map((p, index) =>
+      p && removed.has(p)
+        ? { action: 'drop', index }
+        : { action: 'keep', index }
+    );
+    const edits = await signatureEdits(program, obj, changes, options, id =>
+      removed.has(info.uses.get(id)!)
+    );
+    files = edits.files;
+    callSites = edits.callSites;
+  }
+
+  // Edits inside code that is deleted anyway are left out.
+  const own = [...(files.get(file)?.edits ?? []), ...plan.edits];
+  files.delete(file);
+  const inside = (e: TextEdit, d: TextEdit) =>
+    e !== d && d.newText === '' && d.pos <= e.pos && e.end <= d.end;
+  const edits = own.filter(e => !own.some(d => inside(e, d)));
+  const updated = pruneImports(
+    file,
+    info,
+    applyTextEdits(file.src, edits),
+    true
+  );
+  const remaining = new Set(
+    parseGoFile(file.filePath, updated).imports.map(importPathOf)
+  );
+  const imports = file.ast.imports
+    .map(importPathOf)
+    .filter(path => !remaining.has(path));
+
+  const changed = [
+    { filePath: file.filePath, original: file.src, updated },
+    ...applySignatureEdits(info, files),
+  ];
+  return {
+    functionName: name,
+    variables: locals.filter(v => removed.has(v)).map(describe),
+    parameters: dropped.map(describe),
+    imports,
+    keptParameters,
+    keptReason: keptParameters.length > 0 ? keptReason : undefined,
+    callSites,
+    changes: await commitFileChanges(changed, dryRun, options),
+    dryRun,
+  };
+}
+
+// Returns the edits deleting the variables removed from the statements
+// that declare or assign them, with the expressions deleted with them.
+function planRemoval(
+  info: GoInfo,
+  file: GoSourceFile,
+  parents: Map<Node, Node>,
+  sites: Map<GoObject, Site[]>,
+  removed: Set<GoObject>
+): { edits: TextEdit[]; deleted: Node[] } {
+  const edits: TextEdit[] = [];
+  const deleted: Node[] = [];
+  const isRemoved = (e: Expr) => {
+    if (e.type !== 'Ident') return false;
+    const v = info.objectOf(e);
+    return !!v && removed.has(v);
+  };
+  const gone = (e: Expr) =>
+    isRemoved(e) || (e.type === 'Ident' && e.name === '_');
+  const deleteStmt = (stmt: Node) => {
+    edits.push(stmtRemovalEdit(file, stmt, parents.get(stmt)));
+    deleted.push(stmt);
+  };
+  // Keeps the values of a statement whose targets all go that may have
+  // effects, as a statement of their own or assigned to _.
+  const keepValues = (stmt: Node, count: number, values: Expr[]) => {
+    let kept = values;
+    if (count === values.length) {
+      const pure = new Set<number>();
+      values.forEach((e, k) => {
+        if (isPure(info, e)) pure.add(k);
+      });
+      edits.push(...itemsRemoval(values, pure));
+      deleted.push(...values.filter((_, k) => pure.has(k)));
+      kept = values.filter((_, k) => !pure.has(k));
+      count = kept.length;
+    }
+    const blanks = Array<string>(count).fill('_').join(', ');
+    const newText =
+      kept.length === 1 && isReceive(kept[0]) ? '' : `${blanks} = `;
+    edits.push({ pos: stmt.pos, end: values[0].pos, newText });
+  };
+  // Drops the targets removed from a list with values, and their values
+  // when the lists pair up and those have no effects, or else replaces
+  // the targets with _.
+  const dropTargets = (targets: Ident[] | Expr[], values: Expr[]) => {
+    const paired = targets.length === values.length;
+    const drop = new Set<number>();
+    targets.forEach((t, k) => {
+      if (!isRemoved(t)) return;
+      if (values.length === 0 || (paired && isPure(info, values[k]))) {
+        drop.add(k);
+        if (paired) deleted.push(values[k]);
+      } else {
+        edits.push({ pos: t.pos, end: t.end, newText: '_' });
+      }
+    });
+    if (drop.size === 0) return;
+    edits.push(...itemsRemoval(targets, drop));
+    if (values.length > 0) edits.push(...itemsRemoval(values, drop));
+  };
+
+  const seen = new Set<Node>();
+  for (const v of removed) {
+    for (const site of sites.get(v) ?? []) {
+      if (seen.has(site)) continue;
+      seen.add(site);
+      if (site.type === 'IncDecStmt') {
+        deleteStmt(site);
+      } else if (site.type === 'AssignStmt') {
+        planAssign(site);
+      } else {
+        planSpec(site);
+      }
+    }
+  }
+  return { edits, deleted };
+
+  function planAssign(s: AssignStmt) {
+    if (!s.lhs.every(gone)) {
+      dropTargets(s.lhs, s.rhs);
+      const declares = s.lhs.some(
+        e => e.type === 'Ident' && !isRemoved(e) && info.defs.get(e)
+      );
+      if (s.tok === ':=' && !declares) {
+        edits.push({ pos: s.tokPos, end: s.tokPos + 2, newText: '=' });
+      }
+    } else if (s.rhs.every(e => isPure(info, e))) {
+      deleteStmt(s);
+    } else if (s.tok === ':=' || s.tok === '=') {
+      keepValues(s, s.lhs.length, s.rhs);
+    } else {
+      // An assignment operation such as x += f().
+      edits.push({ pos: s.pos, end: s.rhs[0].pos, newText: '_ = ' });
+    }
+  }
+
+  function planSpec(spec: ValueSpec) {
+    const gen = parents.get(spec) as GenDecl;
+    if (!spec.names.every(gone)) {
+      dropTargets(spec.names, spec.values);
+    } else if (spec.values.every(e => isPure(info, e))) {
+      if (gen.specs.length > 1) {
+        edits.push(specRemovalEdit(file.src, spec));
+        deleted.push(spec);
+      } else {
+        deleteStmt(parents.get(gen)!);
+      }
+    } else if (gen.specs.length > 1) {
+      for (const id of spec.names) {
+        edits.push({ pos: id.pos, end: id.end, newText: '_' });
+      }
+    } else {
+      keepValues(parents.get(gen)!, spec.names.length, spec.values);
+    }
+  }
+}
+
+export function formatRemoveUnusedResults(result: RemoveUnusedResult): string {
+  const lines: string[] = [];
+  const list = (title: string, items: string[]) => {
+    if (items.length > 0) lines.push(title, ...items.map(i => `  ${i}`));
+  };
+  list(
+    `Removed ${plural(result.variables.length, 'variable')}:`,
+    result.variables
+  );
+  list(
+    `Removed ${plural(result.parameters.length, 'parameter')}:`,
+    result.parameters
+  );
+  list(
+    `Updated ${plural(result.callSites.length, 'call site')}:`,
+    result.callSites
+  );
+  list(`Removed ${plural(result.imports.length, 'import')}:`, result.imports);
+  if (result.keptParameters.length > 0) {
+    lines.push(
+      `Kept the unused ${result.keptParameters.length === 1 ? 'parameter' : 'parameters'} ${result.keptParameters.join(', ')}: ${result.keptReason}`
+    );
+  }
+  if (lines.length === 0) {
+    lines.push(`Nothing unused in ${result.functionName}`);
+  }
+  return `${lines.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,222 @@
+import { inspect, pathEnclosingInterval } from '../utils/go-ast.js';
+import type { File, Ident } from '../utils/go-ast.js';
+import { declaredAt, scopeAt } from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import { checkIdentifier } from '../utils/go-edit.js';
+import { GoProgram, exclusionWarnings } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { unquoteGoString } from '../utils/go-scanner.js';
+import type { GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { displayPath } from '../utils/file-utils.js';
+import { step } from '../utils/task.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface RenamePackageOptions extends LoadOptions, WriteOptions {
+  // A file or directory of the module, to find it by.
+  filePath: string;
+  // The package to rename, which keeps its directory and import path.
+  importPath: string;
+  newName: string;
+  dryRun?: boolean;
+}
+
+export interface RenamePackageResult {
+  importPath: string;
+  oldName: string;
+  newName: string;
+  // Files of the package and its external tests whose package clause
+  // changed.
+  packageFiles: number;
+  // Importing files whose qualifiers now use the new name.
+  importers: number;
+  // Importing files where the new name would conflict, which keep the old
+  // one by naming the import explicitly.
+  aliased: string[];
+  warnings: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+function addEdit(edits: Map<GoSourceFile, TextEdit[]>, file: GoSourceFile) {
+  return edits.get(file) ?? edits.set(file, []).get(file)!;
+}
+
+// Returns the edit renaming the package in a package comment starting with
+// "Package <name>", the form godoc expects.
+function packageDocEdit(
+  ast: File,
+  oldName: string,
+  newName: string
+): TextEdit | undefined {
+  const comment = ast.doc?.list[0];
+  const match = comment?.text.match(/^(\/\/|\/\*)\s*Package\s+/);
+  if (!comment || !match) return undefined;
+  const pos = comment.pos + match[0].length;
+  const rest = comment.text.slice(match[0].length);
+  if (!new RegExp(`^${oldName}(?![\\p{L}\\p{Nd}_])`, 'u').test(rest)) {
+    return undefined;
+  }
+  return { pos, end: pos + oldName.length, newText: newName };
+}
+
+// Reports whether file could not refer to the imported package as newName:
+// the name is taken at package or file level, the file uses a predeclared
+// name it would shadow, or a local declaration would capture a qualifier.
+function conflicts(
+  info: GoInfo,
+  file: GoSourceFile,
+  uses: Ident[],
+  newName: string
+): boolean {
+  if (file.pkg.scope?.lookup(newName) || file.scope?.lookup(newName)) {
+    return true;
+  }
+  let shadowed = false;
+  inspect(file.ast, n => {
+    if (n.type !== 'Ident' || n.name !== newName) return;
+    if (info.uses.get(n)?.parent?.kind === 'universe') shadowed = true;
+  });
+  if (shadowed) return true;
+  return uses.some(id => {
+    const path = pathEnclosingInterval(file.ast, id.pos, id.end);
+    for (let s = scopeAt(info, path); s && s.kind !== 'file'; s = s.parent) {
+      if (declaredAt(s, newName, id.pos)) return true;
+    }
+    return false;
+  });
+}
+
+export async function performRenamePackage(
+  options: RenamePackageOptions
+): Promise<RenamePackageResult> {
+  const { importPath, newName, dryRun = false } = options;
+  checkIdentifier(newName);
+  const program = await GoProgram.load(options.filePath, options);
+  const pkg = program.packageByImportPath(importPath);
+  if (!pkg) {
+    throw new ToolError(
+      'symbol_not_found',
+      `No package with import path ${importPath} in the module`
+    );
+  }
+  const oldName = pkg.name;
+  if (oldName === 'main') {
+    throw new ToolError(
+      'unsupported_construct',
+      `${importPath} is a command, whose package must stay main`
+    );
+  }
+  if (newName === oldName) {
+    throw new ToolError(
+      'invalid_argument',
+      `Package ${importPath} is already named '${newName}'`
+    );
+  }
+  if (newName === 'main') {
+    throw new ToolError(
+      'invalid_argument',
+      'Renaming the package to main would turn it into a command'
+    );
+  }
+  const info = (await program.checkAsync(options)).info;
+
+  // The package clauses, including those of the external test package,
+  // which must stay the package name followed by _test.
+  const edits = new Map<GoSourceFile, TextEdit[]>();
+  const own = program.packages.filter(p => p.dir === pkg.dir);
+  for (const p of own) {
+    const name = p.isXTest ? `${newName}_test` : newName;
+    for (const file of p.files) {
+      const clause = file.ast.name;
+      const list = addEdit(edits, file);
+      list.push({ pos: clause.pos, end: clause.end, newText: name });
+      const doc = p.isXTest
+        ? undefined
+        : packageDocEdit(file.ast, oldName, newName);
+      if (doc) list.push(doc);
+    }
+  }
+  const packageFiles = own.reduce((n, p) => n + p.files.length, 0);
+
+  // Imports that name the package explicitly are left alone; files that
+  // rely on its default name switch to the new one unless it conflicts.
+  await step(options, 'Updating importing files');
+  let importers = 0;
+  const aliased: string[] = [];
+  for (const file of program.files) {
+    if (file.pkg === pkg) continue;
+    const specs = file.ast.imports.filter(
+      s => !s.name && unquoteGoString(s.path.value) === importPath
+    );
+    for (const spec of specs) {
+      const obj = info.implicits.get(spec);
+      const uses: Ident[] = [];
+      inspect(file.ast, n => {
+        if (n.type === 'Ident' && obj && info.uses.get(n) === obj) {
+          uses.push(n);
+        }
+      });
+      const list = addEdit(edits, file);
+      if (conflicts(info, file, uses, newName)) {
+        list.push({
+          pos: spec.path.pos,
+          end: spec.path.pos,
+          newText: `${oldName} `,
+        });
+        aliased.push(displayPath(file.filePath));
+        continue;
+      }
+      for (const id of uses) {
+        list.push({ pos: id.pos, end: id.end, newText: newName });
+      }
+      importers++;
+    }
+  }
+
+  const changes = [...edits].map(([file, list]) => ({
+    filePath: file.filePath,
+    original: file.src,
+    updated: applyTextEdits(file.src, list),
+  }));
+  return {
+    importPath,
+    oldName,
+    newName,
+    packageFiles,
+    importers,
+    aliased,
+    warnings: exclusionWarnings(program, [pkg]),
+    changes: await commitFileChanges(changes, dryRun, options),
+    dryRun,
+  };
+}
+
+export function formatRenamePackageResults(
+  result: RenamePackageResult
+): string {
+  const files = (n: number) => `${n} file${n === 1 ? '' : 's'}`;
+  const output = [
+    `Renamed package ${result.oldName} (${result.importPath}) to ${result.newName} in ${files(result.packageFiles)} and ${files(result.importers)} importing it`,
+  ];
+  if (result.aliased.length > 0) {
+    output.push(
+      `Kept the name ${result.oldName} as an explicit import name, since ${result.newName} is taken there:`
+    );
+    output.push(...result.aliased.map(f => `  ${f}`));
+  }
+  if (result.warnings.length > 0) {
+    output.push('Not updated, check these by hand:');
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
@@ -0,0 +1,575 @@
+import type {
+  BasicLit,
+  CommentGroup,
+  Node,
+  SelectorExpr,
+} from '../utils/go-ast.js';
+import { inspect, isExported, pathEnclosingInterval } from '../utils/go-ast.js';
+import {
+  declaredAt,
+  namedTypes,
+  relatedMethods,
+  scopeAt,
+  scopeStart,
+} from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import { embeddedFieldName } from '../utils/go-checker.js';
+import { checkIdentifier, isPackageLevelName } from '../utils/go-edit.js';
+import { exclusionWarnings, loadGoFile } from '../utils/go-loader.js';
+import type { GoProgram, LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  findReferences,
+  locationOf,
+  objectKindLabel,
+  resolveSymbol,
+} from '../utils/go-references.js';
+import type { GoReference, GoSymbolInput } from '../utils/go-references.js';
+import {
+  interfaceMethods,
+  lookupFieldOrMethod,
+  sameObject,
+  typeContains,
+  under,
+} from '../utils/go-types.js';
+import type { GoObject, GoSourceFile, Scope } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { indexToPosition, lineTextAt } from '../utils/line-utils.js';
+import { step } from '../utils/task.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface RenameSymbolOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoSymbolInput {
+  filePath: string;
+  newName: string;
+  // Also replace the old name, as a whole word, in the comments next to
+  // the renamed declarations.
+  updateComments?: boolean;
+  // Also replace string literals that spell exactly the old name.
+  updateStrings?: boolean;
+  dryRun?: boolean;
+}
+
+export interface RenameSymbolResult {
+  oldName: string;
+  newName: string;
+  kind: string;
+  // Number of identifiers rewritten, declarations included.
+  references: number;
+  // Methods renamed along with the symbol because they implement, or are
+  // implemented by, the same interfaces; as Type.Method.
+  related: string[];
+  // Occurrences of the old name replaced in comments, and string literals
+  // replaced, when asked to.
+  comments: number;
+  strings: number;
+  // Usages the rename cannot update, such as names spelled in strings.
+  warnings: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// Returns the selector expression that selects the identifier at ref.
+function selectorOf(ref: GoReference): SelectorExpr | undefined {
+  const path = pathEnclosingInterval(ref.file.ast, ref.pos, ref.end);
+  const parent = path[path.length - 2];
+  return parent?.type === 'SelectorExpr' && parent.sel === path.at(-1)
+    ? parent
+    : undefined;
+}
+
+function scopeOf(
+  info: GoInfo,
+  file: GoSourceFile,
+  pos: number,
+  end: number
+): Scope | undefined {
+  return scopeAt(info, pathEnclosingInterval(file.ast, pos, end));
+}
+
+function located(obj: GoObject): string {
+  return obj.file ? ` declared at ${locationOf(obj.file, obj.pos)}` : '';
+}
+
+// Rejects renames of obj, declared in scope, that change what identifiers
+// resolve to: references of obj that a declaration of the new name would
+// shadow, and uses of an outer declaration of the new name that obj would
+// capture.
+function checkScopes(
+  info: GoInfo,
+  obj: GoObject,
+  scope: Scope,
+  refs: GoReference[],
+  newName: string
+): void {
+  if (scope.kind === 'package') {
+    if (isPackageLevelName(obj.pkg!, newName)) {
+      throw new ToolError(
+        'name_conflict',
+        `'${newName}' is already declared in package ${obj.pkg!.name}`
+      );
+    }
+  } else {
+    const existing = scope.lookup(newName);
+    if (existing) {
+      throw new ToolError(
+        'name_conflict',
+        `'${newName}' is already declared in the same scope at ${locationOf(existing.file!, existing.pos)}`,
+        errorLocation(existing.file!, existing.pos)
+      );
+    }
+  }
+  // Labels have a scope of their own and cannot be shadowed.
+  if (obj.kind === 'label') return;
+
+  for (const ref of refs) {
+    if (ref.isDeclaration) continue;
+    if (selectorOf(ref)) continue;
+    for (
+      let s = scopeOf(info, ref.file, ref.pos, ref.end);
+      s && s !== scope && s.kind !== 'universe';
+      s = s.parent
+    ) {
+      const other = declaredAt(s, newName, ref.pos);
+      if (other) {
+        throw new ToolError(
+          'name_conflict',
+          `Renaming would make the reference at ${locationOf(ref.file, ref.pos)} refer to '${newName}'${located(other)}`,
+          errorLocation(ref.file, ref.pos)
+        );
+      }
+    }
+  }
+
+  const files =
+    scope.kind === 'package' ? obj.pkg!.files : obj.file ? [obj.file] : [];
+  for (const file of files) {
+    inspect(file.ast, n => {
+      if (n.type === 'SelectorExpr') {
+        inspect(n.x, visit);
+        return false;
+      }
+      return visit(n);
+    });
+
+    function visit(n: Node): boolean | void {
+      if (n.type !== 'Ident' || n.name !== newName) return;
+      const other = info.uses.get(n);
+      if (!other?.parent) return;
+      for (let s = scopeOf(info, file, n.pos, n.end); s; s = s.parent) {
+        if (s === other.parent) return;
+        if (s === scope && (scope.kind === 'package' || scopeStart(obj) <= n.pos)) {
+          throw new ToolError(
+            'name_conflict',
+            `Renaming would make '${newName}' at ${locationOf(file, n.pos)} refer to the renamed ${objectKindLabel(obj)}`,
+            errorLocation(file, n.pos)
+          );
+        }
+      }
+    }
+  }
+}
+
+// Describes the field or method that obj, a field or method, would clash
+// with once renamed to newName.
+function memberClash(
+  program: GoProgram,
+  obj: GoObject,
+  newName: string
+): string | undefined {
+  if (obj.kind === 'func') {
+    const recv = obj.recv;
+    if (!recv?.type) return undefined;
+    const u = under(recv.type);
+    if (u.kind === 'interface') {
+      return interfaceMethods(u).some(m => m.name === newName)
+        ? `interface ${recv.name} already has a method ${newName}`
+        : undefined;
+    }
+    if (recv.methods?.some(m => m.name === newName)) {
+      return `'${recv.name}' already has a method ${newName}`;
+    }
+    if (u.kind === 'struct' && u.fields.some(f => f.name === newName)) {
+      return `'${recv.name}' has a field ${newName}`;
+    }
+    return undefined;
+  }
+
+  const file = obj.file!;
+  const path = pathEnclosingInterval(file.ast, obj.pos, obj.pos);
+  const struct = [...path].reverse().find(n => n.type === 'StructType');
+  if (struct?.type === 'StructType') {
+    const clash = struct.fields.list.some(f =>
+      f.names.length > 0
+        ? f.names.some(id => id.name === newName)
+        : embeddedFieldName(f.fieldType)?.name === newName
+    );
+    if (clash) return `the struct already has a field ${newName}`;
+  }
+  for (const t of namedTypes(program)) {
+    const u = under(t);
+    if (
+      u.kind === 'struct' &&
+      u.fields.some(f => sameObject(f, obj)) &&
+      t.obj.methods?.some(m => m.name === newName)
+    ) {
+      return `'${t.obj.name}' has a method ${newName}`;
+    }
+  }
+  return undefined;
+}
+
+// Rejects renames of fields and methods that change what selectors
+// resolve to: selections of the renamed members that another member of
+// the new name would win, and selections of the new name that a renamed
+// member would take over.
+function checkSelections(
+  program: GoProgram,
+  info: GoInfo,
+  renamed: GoObject[],
+  refs: GoReference[],
+  newName: string
+): void {
+  const isRenamed = (o: GoObject) => renamed.some(r => sameObject(r, o));
+  for (const ref of refs) {
+    const sel = selectorOf(ref);
+    const t = sel && info.typeOf(sel.x);
+    if (!t) continue;
+    const other = lookupFieldOrMethod(t, newName);
+    if (other && !isRenamed(other.obj)) {
+      throw new ToolError(
+        'name_conflict',
+        `Renaming would make the selector at ${locationOf(ref.file, ref.pos)} select ${objectKindLabel(other.obj)} ${newName}${located(other.obj)}`,
+        errorLocation(ref.file, ref.pos)
+      );
+    }
+  }
+
+  const oldName = renamed[0].name;
+  for (const file of program.files) {
+    inspect(file.ast, n => {
+      if (n.type !== 'SelectorExpr' || n.sel.name !== newName) return;
+      const selection = info.selections.get(n);
+      const t = info.typeOf(n.x);
+      if (!selection || !t) return;
+      const mine = lookupFieldOrMethod(t, oldName);
+      if (
+        mine &&
+        isRenamed(mine.obj) &&
+        mine.path.length <= selection.path.length
+      ) {
+        throw new ToolError(
+          'name_conflict',
+          `Renaming would make the selector at ${locationOf(file, n.sel.pos)} select the renamed ${objectKindLabel(mine.obj)}`,
+          errorLocation(file, n.sel.pos)
+        );
+      }
+    });
+  }
+}
+
+// Rejects renames of fields and methods named by a selector the checker
+// could not resolve because its operand has the type of a type parameter
+// of a generic function, whose type argument was not inferred at the call:
+// the selector may select the renamed member, and would be left behind.
+function checkInferred(info: GoInfo, name: string): void {
+  // A type parameter of a function decl is only its own outside of it.
+  const foreign = (tp: GoObject, file: GoSourceFile, pos: number) => {
+    const decl = tp.file?.ast.decls.find(
+      d => d.pos <= tp.pos && tp.pos < d.end
+    );
+    return (
+      decl?.type === 'FuncDecl' &&
+      !(tp.file === file && decl.pos <= pos && pos < decl.end)
+    );
+  };
+  for (const u of info.unresolved) {
+    if (!u.selector || u.ident.name !== name) continue;
+    const t = info.typeOf(u.selector.x);
+    const uninferred =
+      t &&
+      typeContains(
+        t,
+        x => x.kind === 'typeparam' && foreign(x.obj, u.file, u.ident.pos)
+      );
+    if (uninferred) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot rename '${name}': the selector at ${locationOf(u.file, u.ident.pos)} may select it, but the type of its operand depends on a type argument of a generic call that cannot be inferred`,
+        errorLocation(u.file, u.ident.pos)
+      );
+    }
+  }
+}
+
+function memberLabel(m: GoObject): string {
+  return m.recv ? `${m.recv.name}.${m.name}` : m.name;
+}
+
+// Returns the string literals of the module that spell name as a word,
+// which reflection, templates and the like may resolve at run time.
+function stringMentions(
+  program: GoProgram,
+  name: string
+): { file: GoSourceFile; lit: BasicLit }[] {
+  const word = new RegExp(
+    `(^|[^\\p{L}\\p{Nd}_])${name}($|[^\\p{L}\\p{Nd}_])`,
+    'u'
+  );
+  const found: { file: GoSourceFile; lit: BasicLit }[] = [];
+  for (const file of program.files) {
+    inspect(file.ast, n => {
+      if (n.type === 'ImportSpec') return false;
+      if (n.type !== 'BasicLit' || n.kind !== 'STRING') return;
+      if (word.test(n.value)) found.push({ file, lit: n });
+    });
+  }
+  return found;
+}
+
+// Returns the comment groups next to the declaration of obj: those that
+// end on the line above the declaring field, spec, function or statement,
+// and those that start on the line of its name.
+function adjacentComments(obj: GoObject): CommentGroup[] {
+  const file = obj.file!;
+  const lineOf = (pos: number) =>
+    indexToPosition(file.src, pos, file.lineStarts).line;
+  const path = pathEnclosingInterval(file.ast, obj.pos, obj.pos);
+  const decl = [...path]
+    .reverse()
+    .find(
+      n =>
+        n.type === 'Field' ||
+        n.type === 'ValueSpec' ||
+        n.type === 'TypeSpec' ||
+        n.type === 'FuncDecl' ||
+        n.type.endsWith('Stmt')
+    );
+  const above = lineOf(decl?.pos ?? obj.pos) - 1;
+  const line = lineOf(obj.pos);
+  return file.ast.comments.filter(
+    g =>
+      lineOf(g.end) === above || (g.pos > obj.pos && lineOf(g.pos) === line)
+  );
+}
+
+// Returns edits replacing the whole-word occurrences of oldName in the
+// comments of group.
+function commentEdits(
+  group: CommentGroup,
+  oldName: string,
+  newName: string
+): TextEdit[] {
+  const word = new RegExp(
+    `(?<![\\p{L}\\p{Nd}_])${oldName}(?![\\p{L}\\p{Nd}_])`,
+    'gu'
+  );
+  return group.list.flatMap(c =>
+    [...c.text.matchAll(word)].map(m => ({
+      pos: c.pos + m.index,
+      end: c.pos + m.index + oldName.length,
+      newText: newName,
+    }))
+  );
+}
+
+export async function performRenameSymbol(
+  options: RenameSymbolOptions
+): Promise<RenameSymbolResult> {
+  const { dryRun = false, newName } = options;
+  checkIdentifier(newName);
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const { obj } = resolveSymbol(program, file, options);
+  const kind = objectKindLabel(obj);
+  if (obj.kind === 'pkgname') {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is a package name, which cannot be renamed`
+    );
+  }
+  if (!obj.file) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is declared outside the module`
+    );
+  }
+  if (obj.embedded) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is an embedded field; rename its type instead`
+    );
+  }
+  if (obj.name === newName) {
+    throw new ToolError(
+      'invalid_argument',
+      `The ${kind} is already named '${newName}'`
+    );
+  }
+  const scope = obj.parent;
+  if (scope?.kind === 'package') {
+    const entry =
+      obj.name === 'init' || (obj.name === 'main' && obj.pkg?.name === 'main');
+    if (obj.kind === 'func' && entry) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Function '${obj.name}' cannot be renamed`
+      );
+    }
+    if (newName === 'init') {
+      throw new ToolError(
+        'invalid_argument',
+        "'init' is reserved for package initializers"
+      );
+    }
+  }
+
+  await step(options, 'Finding references');
+  const renamed = relatedMethods(program, obj);
+  for (const m of renamed) {
+    if (!m.file) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Method '${memberLabel(m)}' is declared outside the module, so '${obj.name}' cannot be renamed`
+      );
+    }
+  }
+  const refs = renamed.flatMap(m => findReferences(program, m));
+
+  if (isExported(obj.name) && !isExported(newName)) {
+    const outside = refs.find(r => r.file.pkg !== obj.pkg);
+    if (outside) {
+      throw new ToolError(
+        'invalid_argument',
+        `'${newName}' would be unexported, but '${obj.name}' is used outside package ${obj.pkg!.name} at ${locationOf(outside.file, outside.pos)}`,
+        errorLocation(outside.file, outside.pos)
+      );
+    }
+  }
+  if (obj.isField || obj.recv) {
+    for (const m of renamed) {
+      const clash = memberClash(program, m, newName);
+      if (clash) throw new ToolError(
+        'name_conflict',
+        `Cannot rename to '${newName}': ${clash}`
+      );
+    }
+    checkSelections(program, info, renamed, refs, newName);
+    checkInferred(info, obj.name);
+  } else if (scope) {
+    checkScopes(info, obj, scope, refs, newName);
+  }
+
+  const edits = new Map<GoSourceFile, TextEdit[]>();
+  for (const ref of refs) {
+    const list = edits.get(ref.file) ?? [];
+    list.push({ pos: ref.pos, end: ref.end, newText: newName });
+    edits.set(ref.file, list);
+  }
+
+  const add = (file: GoSourceFile, list: TextEdit[]) =>
+    edits.set(file, [...(edits.get(file) ?? []), ...list]);
+  let comments = 0;
+  if (options.updateComments) {
+    const seen = new Set<CommentGroup>();
+    for (const m of renamed) {
+      for (const g of adjacentComments(m)) {
+        if (seen.has(g)) continue;
+        seen.add(g);
+        const list = commentEdits(g, obj.name, newName);
+        comments += list.length;
+        add(m.file!, list);
+      }
+    }
+  }
+
+  const visible = scope?.kind === 'package' || obj.isField || obj.recv;
+  const mentions = visible ? stringMentions(program, obj.name) : [];
+  let strings = 0;
+  const unchanged = mentions.filter(({ file, lit }) => {
+    const exact = lit.value.slice(1, -1) === obj.name;
+    if (!options.updateStrings || !exact) return true;
+    const quote = lit.value[0];
+    add(file, [
+      { pos: lit.pos, end: lit.end, newText: `${quote}${newName}${quote}` },
+    ]);
+    strings++;
+    return false;
+  });
+  const warnings = visible
+    ? [
+        ...unchanged.map(
+          ({ file, lit }) =>
+            `${locationOf(file, lit.pos)}: ${lineTextAt(file.src, lit.pos, file.lineStarts).trim()}`
+        ),
+        ...exclusionWarnings(
+          program,
+          renamed.flatMap(m => (m.pkg ? [m.pkg] : []))
+        ),
+      ]
+    : [];
+  if (obj.recv && renamed.length === 1 && isExported(obj.name)) {
+    warnings.push(
+      `'${memberLabel(obj)}' may implement interfaces declared outside the module, which are not updated`
+    );
+  }
+
+  return {
+    oldName: obj.name,
+    newName,
+    kind,
+    references: refs.length,
+    related: renamed.slice(1).map(memberLabel),
+    comments,
+    strings,
+    warnings,
+    changes: await commitFileChanges(
+      [...edits].map(([f, list]) => ({
+        filePath: f.filePath,
+        original: f.src,
+        updated: applyTextEdits(f.src, list),
+      })),
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+export function formatRenameSymbolResults(result: RenameSymbolResult): string {
+  const files = result.changes.length;
+  const output = [
+    `Renamed ${result.kind} '${result.oldName}' to '${result.newName}' at ${result.references} location${result.references === 1 ? '' : 's'} in ${files} file${files === 1 ? '' : 's'}`,
+  ];
+  const updated = [
+    ...(result.comments > 0
+      ? [`${result.comments} mention${result.comments === 1 ? '' : 's'} in comments`]
+      : []),
+    ...(result.strings > 0
+      ? [`${result.strings} string literal${result.strings === 1 ? '' : 's'}`]
+      : []),
+  ];
+  if (updated.length > 0) {
+    output.push(`Also updated ${updated.join(' and ')}`);
+  }
+  if (result.related.length > 0) {
+    output.push('Also renamed the related methods:');
+    output.push(...result.related.map(r => `  ${r}`));
+  }
+  if (result.warnings.length > 0) {
+    output.push('Not updated, check these by hand:');
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
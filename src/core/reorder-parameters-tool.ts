@@ -0,0 +1,218 @@
+import { relatedMethods } from '../utils/go-analysis.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { functionName, locationOf } from '../utils/go-references.js';
+import {
+  applySignatureEdits,
+  batchSignatureEdits,
+  signatureEdits,
+} from '../utils/go-signature.js';
+import type {
+  ParameterChange,
+  SignatureChange,
+} from '../utils/go-signature.js';
+import { errorType, identical, sameObject, under } from '../utils/go-types.js';
+import type { GoObject, SignatureType, Type } from '../utils/go-types.js';
+import { commitFileChanges, formatFileChanges } from '../utils/edit-utils.js';
+import type { FileChange, WriteOptions } from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface ReorderParametersOptions extends LoadOptions, WriteOptions {
+  // A Go file of the package whose functions are reordered.
+  filePath: string;
+  // Also move the parameters that handle errors, such as onErr func(error),
+  // to the end, before a variadic parameter.
+  errorHandlersLast?: boolean;
+  dryRun?: boolean;
+}
+
+export interface ReorderedFunction {
+  // Methods as Type.Method.
+  name: string;
+  location: string;
+  // The new signature as it appears in the declaration.
+  signature: string;
+  // Declarations of the same interface method changed along with it, as
+  // path:line:column.
+  related: string[];
+  callSites: number;
+}
+
+export interface SkippedFunction {
+  name: string;
+  location: string;
+  // Why its parameters cannot be reordered.
+  reason: string;
+}
+
+export interface ReorderParametersResult {
+  packageName: string;
+  functions: ReorderedFunction[];
+  skipped: SkippedFunction[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+function isContext(t: Type | undefined): boolean {
+  return (
+    t?.kind === 'named' &&
+    t.obj.name === 'Context' &&
+    t.obj.externalPath === 'context'
+  );
+}
+
+// Reports whether t is a function taking an error, which a function calls
+// to report errors.
+function isErrorHandler(t: Type | undefined): boolean {
+  const u = t && under(t);
+  return (
+    u?.kind === 'signature' &&
+    u.params.some(p => !!p.type && identical(p.type, errorType()))
+  );
+}
+
+// Returns the new order of the parameters of sig as indices into them, or
+// why the convention cannot be applied: the context first, then the other
+// parameters in order, then the error handlers if they go last, and then a
+// variadic parameter.
+function conventionalOrder(
+  sig: SignatureType,
+  errorHandlersLast: boolean
+): number[] | string {
+  const indices = sig.params.map((_, i) => i);
+  const variadic = sig.variadic ? [indices.pop()!] : [];
+  const contexts = indices.filter(i => isContext(sig.params[i].type));
+  if (contexts.length > 1) {
+    return `it takes ${contexts.length} context.Context parameters`;
+  }
+  const handlers = errorHandlersLast
+    ? indices.filter(
+        i => !contexts.includes(i) && isErrorHandler(sig.params[i].type)
+      )
+    : [];
+  const others = indices.filter(
+    i => !contexts.includes(i) && !handlers.includes(i)
+  );
+  return [...contexts, ...others, ...handlers, ...variadic];
+}
+
+// Moves the context.Context parameter of every function, method and
+// interface method declared in the package to the front, and optionally
+// the error handlers to the end, updating every call. The changes of all
+// the functions are written together, or not at all; functions whose calls
+// cannot be updated, or that are used as values, are left alone and
+// reported.
+export async function performReorderParameters(
+  options: ReorderParametersOptions
+): Promise<ReorderParametersResult> {
+  const { errorHandlersLast = false, dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const pkg = file.pkg;
+
+  const objects: GoObject[] = [];
+  for (const f of pkg.files) {
+    for (const decl of f.ast.decls) {
+      const obj = decl.type === 'FuncDecl' && info.defs.get(decl.name);
+      if (obj) objects.push(obj);
+    }
+  }
+  for (const obj of pkg.scope?.names.values() ?? []) {
+    if (obj.kind !== 'type' || obj.isAlias || !obj.type) continue;
+    const u = under(obj.type);
+    if (u.kind === 'interface') {
+      objects.push(...u.methods.filter(m => m.decl?.type === 'Field'));
+    }
+  }
+  objects.sort((a, b) =>
+    a.file === b.file
+      ? a.pos - b.pos
+      : a.file!.filePath < b.file!.filePath
+        ? -1
+        : 1
+  );
+
+  const list: SignatureChange[] = [];
+  const skipped: SkippedFunction[] = [];
+  const covered: GoObject[] = [];
+  for (const obj of objects) {
+    const location = locationOf(obj.file!, obj.pos);
+    const name = functionName(obj);
+    const order = conventionalOrder(
+      obj.type as SignatureType,
+      errorHandlersLast
+    );
+    if (typeof order !== 'string' && order.every((index, i) => index === i)) {
+      continue;
+    }
+    if (covered.some(c => sameObject(c, obj))) continue;
+    if (typeof order === 'string') {
+      skipped.push({ name, location, reason: order });
+      continue;
+    }
+    const changes: ParameterChange[] = order.map(index => ({
+      action: 'keep',
+      index,
+    }));
+    // Each function is tried alone first, so that one whose calls cannot
+    // be updated is left out rather than failing the others.
+    try {
+      await signatureEdits(program, obj, changes);
+    } catch (error) {
+      if (!(error instanceof ToolError)) throw error;
+      skipped.push({ name, location, reason: error.message });
+      continue;
+    }
+    covered.push(...relatedMethods(program, obj));
+    list.push({ obj, changes });
+  }
+
+  const { summaries, files } = await batchSignatureEdits(
+    program,
+    list,
+    options
+  );
+  const changed = applySignatureEdits(info, files);
+  return {
+    packageName: pkg.name,
+    functions: list.map(({ obj }, i) => ({
+      name: functionName(obj),
+      location: locationOf(obj.file!, obj.pos),
+      signature: summaries[i].signature,
+      related: summaries[i].related,
+      callSites: summaries[i].callSites.length,
+    })),
+    skipped,
+    changes: await commitFileChanges(changed, dryRun, options),
+    dryRun,
+  };
+}
+
+export function formatReorderParametersResults(
+  result: ReorderParametersResult
+): string {
+  const output: string[] = [];
+  const count = result.functions.length;
+  if (count === 0) {
+    output.push(
+      `The parameters of the functions of package ${result.packageName} already follow the convention`
+    );
+  } else {
+    output.push(
+      `Reordered the parameters of ${count} function${count === 1 ? '' : 's'}:`
+    );
+    for (const f of result.functions) {
+      const calls = `${f.callSites} call site${f.callSites === 1 ? '' : 's'}`;
+      output.push(`  ${f.name} (${f.location}): ${f.signature}, ${calls}`);
+      output.push(...f.related.map(r => `    also ${r}`));
+    }
+  }
+  if (result.skipped.length > 0) {
+    output.push('Left alone:');
+    output.push(
+      ...result.skipped.map(s => `  ${s.name} (${s.location}): ${s.reason}`)
+    );
+  }
+  if (count === 0) return output.join('\n');
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
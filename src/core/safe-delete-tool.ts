@@ -0,0 +1,307 @@
+import type { Decl, Expr, GenDecl, Spec } from '../utils/go-ast.js';
+import { inspect, isExported } from '../utils/go-ast.js';
+import { isPure, relatedMethods } from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import {
+  declRemovalEdit,
+  pruneImports,
+  specRemovalEdit,
+} from '../utils/go-edit.js';
+import { exclusionWarnings, loadGoFile } from '../utils/go-loader.js';
+import type { GoProgram, LoadOptions } from '../utils/go-loader.js';
+import {
+  findReferences,
+  objectKindLabel,
+  resolveSymbol,
+} from '../utils/go-references.js';
+import type { GoSymbolInput } from '../utils/go-references.js';
+import { sameObject } from '../utils/go-types.js';
+import type { GoObject, GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { displayPath } from '../utils/file-utils.js';
+import { indexToPosition, lineTextAt } from '../utils/line-utils.js';
+import { step } from '../utils/task.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface SafeDeleteOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoSymbolInput {
+  filePath: string;
+  // Delete exported symbols too, although packages outside the module may
+  // use them.
+  force?: boolean;
+  dryRun?: boolean;
+}
+
+export interface BlockingReference {
+  filePath: string;
+  line: number;
+  column: number;
+  snippet: string;
+  // Set for interface methods the deleted method may be needed to
+  // implement, rather than references to it.
+  viaInterface: boolean;
+}
+
+export interface SafeDeleteResult {
+  // The deleted symbol; methods as Type.Method.
+  symbol: string;
+  kind: string;
+  filePath: string;
+  deleted: boolean;
+  // Why the symbol was not deleted; empty when it was.
+  blockers: BlockingReference[];
+  // Methods deleted together with a type.
+  methods: string[];
+  // Files that build constraints kept from being checked for references.
+  warnings: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// A declaration to delete, or a spec of a grouped one.
+interface Removal {
+  file: GoSourceFile;
+  decl: Decl;
+  spec?: Spec;
+}
+
+function qualifiedName(obj: GoObject): string {
+  return obj.recv ? `${obj.recv.name}.${obj.name}` : obj.name;
+}
+
+function declarationOf(obj: GoObject): Removal {
+  const file = obj.file!;
+  if (obj.decl?.type === 'FuncDecl') {
+    return { file, decl: obj.decl };
+  }
+  const spec = obj.decl;
+  const decl = file.ast.decls.find(
+    (d): d is GenDecl =>
+      d.type === 'GenDecl' && d.specs.some(s => s === spec)
+  );
+  if (!decl || (spec?.type !== 'ValueSpec' && spec?.type !== 'TypeSpec')) {
+    throw new ToolError(
+      'symbol_not_found',
+      `Cannot find the declaration of '${obj.name}'`
+    );
+  }
+  return decl.specs.length === 1 ? { file, decl } : { file, decl, spec };
+}
+
+function usesIota(info: GoInfo, e: Expr): boolean {
+  let found = false;
+  inspect(e, n => {
+    const used = n.type === 'Ident' ? info.uses.get(n) : undefined;
+    if (used?.name === 'iota' && used.pos < 0) found = true;
+  });
+  return found;
+}
+
+// Rejects declarations whose deletion could change the program even though
+// nothing refers to them.
+function checkDeletable(info: GoInfo, obj: GoObject, removal: Removal): void {
+  const name = qualifiedName(obj);
+  if (
+    obj.kind === 'func' &&
+    !obj.recv &&
+    (obj.name === 'init' || (obj.name === 'main' && obj.pkg?.name === 'main'))
+  ) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Function '${obj.name}' runs without being referenced`
+    );
+  }
+
+  const spec = obj.decl;
+  if (spec?.type !== 'ValueSpec') return;
+  if (spec.names.length > 1) {
+    const others = spec.names.filter(id => id.pos !== obj.pos);
+    throw new ToolError(
+      'unsupported_construct',
+      `'${name}' is declared together with ${others.map(id => id.name).join(', ')}`
+    );
+  }
+  const impure = spec.values.find(v => !isPure(info, v));
+  if (impure) {
+    throw new ToolError(
+      'unsupported_construct',
+      `The initializer of '${name}' may have side effects, which deleting it would drop`
+    );
+  }
+  // Constants of a group take their values and iota from the specs before
+  // them, so removing one changes the meaning of the specs after it.
+  const group = removal.decl as GenDecl;
+  if (removal.spec && group.tok === 'const') {
+    const after = group.specs.slice(group.specs.indexOf(spec) + 1);
+    const changed = after.some(
+      s =>
+        s.type === 'ValueSpec' &&
+        (s.values.length === 0 || s.values.some(v => usesIota(info, v)))
+    );
+    if (changed) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Deleting '${name}' would change the values of the constants declared after it`
+      );
+    }
+  }
+}
+
+function isInside(file: GoSourceFile, pos: number, removals: Removal[]) {
+  return removals.some(r => {
+    const n = r.spec ?? r.decl;
+    return r.file === file && n.pos <= pos && pos < n.end;
+  });
+}
+
+function blockerAt(
+  file: GoSourceFile,
+  pos: number,
+  viaInterface: boolean
+): BlockingReference {
+  const { line, column } = indexToPosition(file.src, pos, file.lineStarts);
+  return {
+    filePath: displayPath(file.filePath),
+    line,
+    column,
+    snippet: lineTextAt(file.src, pos, file.lineStarts).trim(),
+    viaInterface,
+  };
+}
+
+// Returns what keeps the deleted symbols in use: references from outside
+// the removed declarations and, for methods deleted on their own, the
+// methods of interfaces in the module that they may implement.
+function blockersOf(
+  program: GoProgram,
+  deleted: GoObject[],
+  removals: Removal[],
+  standalone: boolean
+): BlockingReference[] {
+  const blockers: BlockingReference[] = [];
+  for (const obj of deleted) {
+    for (const ref of findReferences(program, obj)) {
+      if (ref.isDeclaration || isInside(ref.file, ref.pos, removals)) continue;
+      blockers.push(blockerAt(ref.file, ref.pos, false));
+    }
+  }
+  if (standalone && deleted[0].recv) {
+    for (const m of relatedMethods(program, deleted[0])) {
+      if (m.decl?.type !== 'Field' || !m.file) continue;
+      if (sameObject(m, deleted[0])) continue;
+      blockers.push(blockerAt(m.file, m.pos, true));
+    }
+  }
+  return blockers;
+}
+
+export async function performSafeDelete(
+  options: SafeDeleteOptions
+): Promise<SafeDeleteResult> {
+  const { force = false, dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const { obj } = resolveSymbol(program, file, options);
+  if (!obj.file) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is declared outside the module`
+    );
+  }
+  const method = obj.kind === 'func' && obj.decl?.type === 'FuncDecl';
+  if (obj.parent?.kind !== 'package' && !method) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${obj.name}' is a ${objectKindLabel(obj)} that is not declared at package level`
+    );
+  }
+
+  const removal = declarationOf(obj);
+  checkDeletable(info, obj, removal);
+  const name = qualifiedName(obj);
+  const visible =
+    obj.pkg?.name !== 'main' && !obj.file.filePath.endsWith('_test.go');
+  if (isExported(obj.name) && visible && !force) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${name}' is exported, so code outside the module may use it; set force to delete it anyway`
+    );
+  }
+
+  // A type goes together with its methods, which may be declared in other
+  // files of the package.
+  const methods = obj.kind === 'type' ? (obj.methods ?? []) : [];
+  const removals = [removal, ...methods.map(m => declarationOf(m))];
+  const deleted = [obj, ...methods];
+  await step(options, 'Finding references');
+  const blockers = blockersOf(program, deleted, removals, methods.length === 0);
+
+  const result = {
+    symbol: name,
+    kind: objectKindLabel(obj),
+    filePath: displayPath(obj.file.filePath),
+    methods: methods.map(qualifiedName),
+    warnings: exclusionWarnings(program, [obj.file.pkg]),
+    dryRun,
+  };
+  if (blockers.length > 0) {
+    return { ...result, deleted: false, blockers, changes: [] };
+  }
+
+  const edits = new Map<GoSourceFile, TextEdit[]>();
+  for (const r of removals) {
+    const edit = r.spec
+      ? specRemovalEdit(r.file.src, r.spec)
+      : declRemovalEdit(r.file.src, r.decl);
+    (edits.get(r.file) ?? edits.set(r.file, []).get(r.file)!).push(edit);
+  }
+  const changes = [...edits].map(([f, fileEdits]) => ({
+    filePath: f.filePath,
+    original: f.src,
+    updated: pruneImports(f, info, applyTextEdits(f.src, fileEdits)),
+  }));
+
+  return {
+    ...result,
+    deleted: true,
+    blockers: [],
+    changes: await commitFileChanges(changes, dryRun, options),
+  };
+}
+
+export function formatSafeDeleteResults(result: SafeDeleteResult): string {
+  const symbol = `${result.kind} '${result.symbol}'`;
+  if (!result.deleted) {
+    const count = result.blockers.length;
+    const output = [
+      `Cannot delete ${symbol}, which is still used at ${count} location${count === 1 ? '' : 's'}:`,
+    ];
+    for (const b of result.blockers) {
+      const via = b.viaInterface ? ' (interface method it may implement)' : '';
+      output.push(`  ${b.filePath}:${b.line}:${b.column}: ${b.snippet}${via}`);
+    }
+    output.push('\nNo files were changed');
+    return output.join('\n');
+  }
+  const methods =
+    result.methods.length > 0
+      ? ` together with its methods ${result.methods.map(m => `'${m}'`).join(', ')}`
+      : '';
+  const output = [`Deleted ${symbol} from ${result.filePath}${methods}`];
+  if (result.warnings.length > 0) {
+    output.push('Not checked for references, check these by hand:');
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
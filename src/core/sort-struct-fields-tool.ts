@@ -0,0 +1,407 @@
+import type { CommentGroup, Field, Node } from '../utils/go-ast.js';
+import { inspect, isExported, unparen } from '../utils/go-ast.js';
+import { wordSize } from '../utils/go-build.js';
+import {
+  alignCells,
+  importPathOf,
+  indentAt,
+  reindent,
+} from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import { errorLocation, locationOf } from '../utils/go-references.js';
+import { GoSizes, sameObject, typeString } from '../utils/go-types.js';
+import type { GoObject, GoSourceFile, Type } from '../utils/go-types.js';
+import { commitFileChanges, formatFileChanges } from '../utils/edit-utils.js';
+import type { FileChange, WriteOptions } from '../utils/edit-utils.js';
+import { displayPath } from '../utils/file-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+// How the fields are ordered: by name, exported ones first, or from the
+// largest alignment to the smallest so that the struct needs the least
+// padding.
+export const FIELD_ORDERS = ['alphabetical', 'visibility', 'size'] as const;
+
+export type FieldOrder = (typeof FIELD_ORDERS)[number];
+
+export interface SortStructFieldsOptions extends LoadOptions, WriteOptions {
+  filePath: string;
+  // A struct type declared in the package of filePath.
+  typeName: string;
+  strategy: FieldOrder;
+  dryRun?: boolean;
+}
+
+export interface SortStructFieldsResult {
+  typeName: string;
+  strategy: FieldOrder;
+  // The names of the fields in their new order, embedded ones by their
+  // type name.
+  fields: string[];
+  // The size of the struct before and after, for the size strategy.
+  sizes?: { before: number; after: number };
+  warnings: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// Packages that see the fields of a struct in declaration order, so that
+// their results change with it.
+const ORDER_SENSITIVE = [
+  'encoding/binary',
+  'encoding/csv',
+  'encoding/json',
+  'encoding/xml',
+  'reflect',
+];
+
+// A field declaration of the struct, which moves with the comments above
+// it and its line comment.
+interface Unit {
+  field: Field;
+  // The field names, or the type name of an embedded field.
+  name: string;
+  objects: GoObject[];
+  docs: CommentGroup[];
+  comment?: CommentGroup;
+}
+
+// Orders units stably by strategy. Embedded fields stay first, as Go code
+// conventionally lists them, except when ordering by size.
+function sortUnits(
+  units: Unit[],
+  strategy: FieldOrder,
+  sizes: GoSizes
+): Unit[] {
+  const indexed = units.map((unit, index) => ({ unit, index }));
+  const embedded = (u: Unit) => (u.field.names.length === 0 ? 0 : 1);
+  const byName = (a: Unit, b: Unit) => {
+    const x = a.name.toLowerCase();
+    const y = b.name.toLowerCase();
+    if (x !== y) return x < y ? -1 : 1;
+    return a.name < b.name ? -1 : a.name > b.name ? 1 : 0;
+  };
+  const size = (u: Unit) => sizes.sizeof(u.objects[0].type!)!;
+  const align = (u: Unit) => sizes.alignof(u.objects[0].type!)!;
+  const compare = (a: Unit, b: Unit): number => {
+    switch (strategy) {
+      case 'alphabetical':
+        return embedded(a) - embedded(b) || byName(a, b);
+      case 'visibility': {
+        const exported = (u: Unit) => (isExported(u.name) ? 0 : 1);
+        return embedded(a) - embedded(b) || exported(a) - exported(b);
+      }
+      case 'size': {
+        // Fields of size zero come first, as the last field of a struct
+        // must not be one.
+        const zero = (u: Unit) => (size(u) === 0 ? 0 : 1);
+        return zero(a) - zero(b) || align(b) - align(a);
+      }
+    }
+  };
+  return indexed
+    .sort((a, b) => compare(a.unit, b.unit) || a.index - b.index)
+    .map(({ unit }) => unit);
+}
+
+// Returns the cells of a field laid out by gofmt: its names, type, tag and
+// comment. A comment after an embedded field without a tag lines up with
+// the comments after the types of named fields.
+function cells(
+  names: string,
+  type: string,
+  tag: string | undefined,
+  comment: string | undefined
+): string[] {
+  const row = names ? [names, type] : [type];
+  if (tag) row.push(tag);
+  else if (comment && !names) row.push('');
+  if (comment) row.push(comment);
+  return row;
+}
+
+// Returns the units of the struct fields and the comments after the last
+// one. Comments between fields go with the field below them.
+function unitsOf(
+  file: GoSourceFile,
+  fields: Field[],
+  objects: GoObject[],
+  open: number,
+  close: number
+): { units: Unit[]; trailing: CommentGroup[] } {
+  const within = (g: CommentGroup, n: Node) => n.pos <= g.pos && g.end <= n.end;
+  const comments = file.ast.comments.filter(
+    g => g.pos > open && g.end <= close && !fields.some(f => within(g, f))
+  );
+  let next = 0;
+  const units = fields.map(field => {
+    const count = Math.max(field.names.length, 1);
+    const docs = comments.filter(
+      g => g.pos < field.pos && !fields.some(f => f.comment === g)
+    );
+    comments.splice(0, docs.length);
+    const unit: Unit = {
+      field,
+      name:
+        field.names.length > 0
+          ? field.names.map(n => n.name).join(', ')
+          : objects[next].name,
+      objects: objects.slice(next, next + count),
+      docs,
+      comment: field.comment,
+    };
+    if (field.comment) comments.splice(comments.indexOf(field.comment), 1);
+    next += count;
+    return unit;
+  });
+  return { units, trailing: comments };
+}
+
+export async function performSortStructFields(
+  options: SortStructFieldsOptions
+): Promise<SortStructFieldsResult> {
+  const { strategy, dryRun = false } = options;
+  if (!FIELD_ORDERS.includes(strategy)) {
+    throw new ToolError(
+      'invalid_argument',
+      `Unknown strategy '${strategy}'; use one of ${FIELD_ORDERS.join(', ')}`
+    );
+  }
+  const { program, file: given } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const pkg = given.pkg;
+  const typeObj = pkg.scope?.lookup(options.typeName);
+  const spec = typeObj?.decl;
+  if (typeObj?.kind !== 'type' || spec?.type !== 'TypeSpec' || !typeObj.file) {
+    throw new ToolError(
+      'symbol_not_found',
+      `'${options.typeName}' is not a type declared in package ${pkg.name}`
+    );
+  }
+  const file = typeObj.file;
+  const struct = spec.specType;
+  const underlying = typeObj.underlying;
+  if (struct.type !== 'StructType' || underlying?.kind !== 'struct') {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${typeObj.name}' is not declared as a struct type`,
+      errorLocation(file, typeObj.pos)
+    );
+  }
+  const name = typeObj.name;
+  const refuse = (reason: string, pos = typeObj.pos, at = file) => {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot reorder the fields of '${name}': ${reason}`,
+      errorLocation(at, pos)
+    );
+  };
+  const fields = struct.fields.list;
+  const blank = fields.find(f => f.names.some(n => n.name === '_'));
+  if (blank) {
+    refuse('it has blank fields, which pad or mark its layout', blank.pos);
+  }
+  if (file.ast.imports.some(s => importPathOf(s) === 'C')) {
+    refuse('its file uses cgo, whose C code may depend on its layout');
+  }
+
+  // Code that depends on the field order is refused, and packages that
+  // see it are warned about.
+  const isT = (t: Type | undefined) =>
+    t?.kind === 'named' && sameObject(t.obj, typeObj);
+  const isStruct = (t: Type | undefined) =>
+    t?.kind === 'named'
+      ? t.obj.underlying?.kind === 'struct'
+      : t?.kind === 'struct';
+  const sensitive = new Set<string>();
+  for (const f of program.files) {
+    let uses = f === file;
+    inspect(f.ast, node => {
+      if (node.type === 'Ident' && info.uses.get(node) === typeObj) uses = true;
+      if (
+        node.type === 'CompositeLit' &&
+        node.elts.length > 0 &&
+        node.elts[0].type !== 'KeyValueExpr' &&
+        isT(info.typeOf(node))
+      ) {
+        refuse(
+          `the composite literal at ${locationOf(f, node.pos)} lists its fields without names`,
+          node.pos,
+          f
+        );
+      }
+      if (node.type !== 'CallExpr' || node.args.length !== 1) return;
+      const fun = info.types.get(node.fun);
+      const arg = info.typeOf(node.args[0]);
+      if (fun?.mode === 'type') {
+        const to = fun.type;
+        if (isT(to) !== isT(arg) && isStruct(to) && isStruct(arg)) {
+          refuse(
+            `it is converted to or from another struct type at ${locationOf(f, node.pos)}`,
+            node.pos,
+            f
+          );
+        }
+        const unsafePointer =
+          to.kind === 'named' &&
+          to.obj.externalPath === 'unsafe' &&
+          to.obj.name === 'Pointer';
+        if (unsafePointer && arg?.kind === 'pointer' && isT(arg.elem)) {
+          refuse(
+            `a pointer to it becomes an unsafe.Pointer at ${locationOf(f, node.pos)}`,
+            node.pos,
+            f
+          );
+        }
+      }
+      const callee = unparen(node.fun);
+      const operand = unparen(node.args[0]);
+      if (
+        callee.type === 'SelectorExpr' &&
+        callee.sel.name === 'Offsetof' &&
+        callee.x.type === 'Ident' &&
+        info.uses.get(callee.x)?.imported === 'unsafe' &&
+        operand.type === 'SelectorExpr'
+      ) {
+        const x = info.typeOf(operand.x);
+        if (isT(x) || (x?.kind === 'pointer' && isT(x.elem))) {
+          refuse(
+            `unsafe.Offsetof takes the offset of one of its fields at ${locationOf(f, node.pos)}`,
+            node.pos,
+            f
+          );
+        }
+      }
+    });
+    if (!uses) continue;
+    for (const s of f.ast.imports) {
+      if (ORDER_SENSITIVE.includes(importPathOf(s))) {
+        sensitive.add(`${displayPath(f.filePath)} (${importPathOf(s)})`);
+      }
+    }
+  }
+
+  const sizes = new GoSizes(wordSize(program.context.goarch));
+  if (strategy === 'size') {
+    for (const obj of underlying.fields) {
+      const t = obj.type!;
+      if (sizes.sizeof(t) === undefined) {
+        refuse(
+          `the size of field ${obj.name}, of type ${typeString(t)}, is unknown`,
+          obj.pos
+        );
+      }
+    }
+  }
+
+  const { src } = file;
+  const close = struct.end - 1;
+  const { units, trailing } = unitsOf(
+    file,
+    fields,
+    underlying.fields,
+    struct.fields.opening,
+    close
+  );
+  const sorted = sortUnits(units, strategy, sizes);
+  const text = (n: Node, indent: string) =>
+    reindent(file, n.pos, n.end, indentAt(src, n.pos), indent).substring(
+      indent.length
+    );
+
+  let updated = src;
+  if (sorted.some((u, i) => u !== units[i])) {
+    // gofmt only keeps a struct of a single field on one line.
+    const indent = `${indentAt(src, struct.pos)}\t`;
+    const out: string[] = [];
+    let rows: string[][] = [];
+    const flush = () => {
+      out.push(...alignCells(rows).map(r => `${indent}${r}`));
+      rows = [];
+    };
+    for (const unit of sorted) {
+      const { field } = unit;
+      if (unit.docs.length > 0) {
+        flush();
+        out.push(...unit.docs.map(g => `${indent}${text(g, indent)}`));
+      }
+      const names = field.names.map(n => n.name).join(', ');
+      const type = text(field.fieldType, indent);
+      const tag = field.tag?.value;
+      const comment = unit.comment && text(unit.comment, indent);
+      if (!type.includes('\n')) {
+        rows.push(cells(names, type, tag, comment));
+        continue;
+      }
+      // A field spanning several lines ends the run of aligned fields,
+      // and only its names take part.
+      rows.push(names ? [names, ''] : ['']);
+      flush();
+      out[out.length - 1] += [type, tag, comment].filter(Boolean).join(' ');
+    }
+    flush();
+    out.push(...trailing.map(g => `${indent}${text(g, indent)}`));
+    const body = `struct {\n${out.join('\n')}\n${indentAt(src, struct.pos)}}`;
+    updated = src.substring(0, struct.pos) + body + src.substring(struct.end);
+  }
+
+  const warnings: string[] = [];
+  if (isExported(name)) {
+    warnings.push(
+      `'${name}' is exported: unkeyed composite literals of it outside the module break`
+    );
+  }
+  if (sensitive.size > 0) {
+    warnings.push(
+      `These files use '${name}' with packages that follow the order of its fields: ${[...sensitive].join(', ')}`
+    );
+  }
+  const order = sorted.flatMap(u => u.objects);
+  const structSize = (fields: GoObject[]) =>
+    sizes.sizeof({ kind: 'struct', fields, tags: [] })!;
+  return {
+    typeName: name,
+    strategy,
+    fields: order.map(o => o.name),
+    sizes:
+      strategy === 'size'
+        ? { before: structSize(underlying.fields), after: structSize(order) }
+        : undefined,
+    warnings,
+    changes: await commitFileChanges(
+      [{ filePath: file.filePath, original: src, updated }],
+      dryRun,
+      options
+    ),
+    dryRun,
+  };
+}
+
+export function formatSortStructFieldsResults(
+  result: SortStructFieldsResult
+): string {
+  const { typeName, sizes } = result;
+  const output: string[] = [];
+  if (result.changes.length === 0) {
+    output.push(
+      `The fields of '${typeName}' are already in ${result.strategy} order`
+    );
+  } else {
+    output.push(
+      `Reordered the fields of '${typeName}' by ${result.strategy}: ${result.fields.join(', ')}`
+    );
+  }
+  if (sizes) {
+    output.push(
+      sizes.before === sizes.after
+        ? `Size: ${sizes.after} bytes`
+        : `Size: ${sizes.before} bytes before, ${sizes.after} bytes after`
+    );
+  }
+  if (result.warnings.length > 0) {
+    output.push('Warnings:');
+    output.push(...result.warnings.map(w => `  ${w}`));
+  }
+  if (result.changes.length === 0) return output.join('\n');
+  return `${output.join('\n')}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
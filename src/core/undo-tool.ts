@@ -0,0 +1,138 @@
+import { existsSync, readFileSync, readdirSync, rmSync, rmdirSync } from 'fs';
+import { join } from 'path';
+import {
+  displayPath,
+  notifyFilesChanged,
+  writeFilesAtomically,
+} from '../utils/file-utils.js';
+import { formatFileChanges } from '../utils/edit-utils.js';
+import type { FileChange } from '../utils/edit-utils.js';
+import { checkpoint } from '../utils/task.js';
+import type { TaskOptions } from '../utils/task.js';
+import { ToolError } from '../utils/tool-error.js';
+import {
+  dropLastOperation,
+  lastOperation,
+  undoableOperations,
+} from '../utils/undo-history.js';
+
+export interface UndoOptions extends TaskOptions {
+  dryRun?: boolean;
+}
+
+export interface UndoResult {
+  // Whether there was an operation to undo.
+  undone: boolean;
+  // The files given back their content from before the operation.
+  changes: FileChange[];
+  // Files the operation created, which are deleted.
+  removed: string[];
+  // Directories the operation created, which are deleted when nothing but
+  // the removed files is left in them.
+  removedDirs: string[];
+  // How many earlier operations can still be undone.
+  remaining: number;
+  dryRun: boolean;
+}
+
+export async function performUndo(options: UndoOptions): Promise<UndoResult> {
+  const { dryRun = false } = options;
+  const operation = lastOperation();
+  if (!operation) {
+    return {
+      undone: false,
+      changes: [],
+      removed: [],
+      removedDirs: [],
+      remaining: 0,
+      dryRun,
+    };
+  }
+  // Files edited since would lose those edits, so nothing is restored
+  // unless every file still holds what the operation wrote.
+  for (const file of operation.files) {
+    const current = existsSync(file.filePath)
+      ? readFileSync(file.filePath, 'utf-8')
+      : undefined;
+    if (current !== file.after) {
+      const how = current === undefined ? 'was deleted' : 'was modified';
+      throw new ToolError(
+        'files_changed',
+        `Cannot undo the last operation: ${displayPath(file.filePath)} ${how} after it was written. No files were changed`
+      );
+    }
+  }
+
+  const changes: FileChange[] = [];
+  const removed: string[] = [];
+  for (const file of operation.files) {
+    if (file.before === undefined) removed.push(file.filePath);
+    else {
+      changes.push({
+        filePath: file.filePath,
+        original: file.after,
+        updated: file.before,
+      });
+    }
+  }
+  const gone = new Set(removed);
+  const removedDirs: string[] = [];
+  for (const dir of operation.dirs) {
+    if (!existsSync(dir)) continue;
+    if (readdirSync(dir).every(name => gone.has(join(dir, name)))) {
+      gone.add(dir);
+      removedDirs.push(dir);
+    }
+  }
+  if (!dryRun) {
+    await checkpoint(options.signal);
+    writeFilesAtomically(
+      changes.map(c => ({ filePath: c.filePath, content: c.updated })),
+      options.onProgress
+    );
+    for (const filePath of removed) rmSync(filePath, { force: true });
+    for (const dir of removedDirs) rmdirSync(dir);
+    notifyFilesChanged(
+      removed.map(filePath => ({ filePath, kind: 'removed' as const }))
+    );
+    dropLastOperation();
+  }
+  return {
+    undone: true,
+    changes,
+    removed,
+    removedDirs,
+    remaining: undoableOperations() - (dryRun ? 1 : 0),
+    dryRun,
+  };
+}
+
+export function formatUndoResults(result: UndoResult): string {
+  if (!result.undone) return 'Nothing to undo';
+
+  const output = [
+    result.dryRun
+      ? 'Dry run: undoing the last operation'
+      : `Undid the last operation; ${result.remaining} earlier ${result.remaining === 1 ? 'operation' : 'operations'} can still be undone`,
+  ];
+  if (result.changes.length > 0 || result.removed.length === 0) {
+    output.push('', formatFileChanges(result.changes, result.dryRun));
+  }
+  if (result.removed.length > 0) {
+    const count = result.removed.length;
+    output.push(
+      '',
+      `${result.dryRun ? 'Would delete' : 'Deleted'} ${count} created ${count === 1 ? 'file' : 'files'}:`,
+      ...result.removed.map(f => `  ${displayPath(f)}`)
+    );
+  }
+  if (result.removedDirs.length > 0) {
+    const count = result.removedDirs.length;
+    output.push(
+      '',
+      `${result.dryRun ? 'Would delete' : 'Deleted'} ${count} created ${count === 1 ? 'directory' : 'directories'}:`,
+      ...result.removedDirs.map(d => `  ${displayPath(d)}`)
+    );
+  }
+  return output.join('\n');
+}
@@ -0,0 +1,383 @@
+import type {
+  Expr,
+  FuncDecl,
+  FuncLit,
+  Node,
+  ReturnStmt,
+  Stmt,
+  SwitchStmt,
+} from '../utils/go-ast.js';
+import { inspect, pathEnclosingInterval, unparen } from '../utils/go-ast.js';
+import { lookupAt } from '../utils/go-analysis.js';
+import type { GoInfo } from '../utils/go-checker.js';
+import { addImportEdits, fileQualifier } from '../utils/go-edit.js';
+import type { ImportRequest } from '../utils/go-edit.js';
+import { loadGoFile } from '../utils/go-loader.js';
+import type { LoadOptions } from '../utils/go-loader.js';
+import {
+  errorLocation,
+  locationOf,
+  resolveLocation,
+} from '../utils/go-references.js';
+import type { GoLocationInput } from '../utils/go-references.js';
+import { errorType, identical, sameObject } from '../utils/go-types.js';
+import type { GoObject, GoSourceFile } from '../utils/go-types.js';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatFileChanges,
+} from '../utils/edit-utils.js';
+import type {
+  FileChange,
+  TextEdit,
+  WriteOptions,
+} from '../utils/edit-utils.js';
+import { ToolError } from '../utils/tool-error.js';
+
+export interface WrapErrorOptions
+  extends LoadOptions,
+    WriteOptions,
+    GoLocationInput {
+  filePath: string;
+  // The context of the messages, in which {func} stands for the name of
+  // the function and {call} for the call the error came from. By default
+  // the words of the function name, as in "load config" for LoadConfig.
+  template?: string;
+  // Only wrap errors returned by calls of these functions, given by name
+  // as in Open or as written as in os.Open.
+  functions?: string[];
+  dryRun?: boolean;
+}
+
+export interface WrappedReturn {
+  location: string;
+  // The message given to fmt.Errorf.
+  message: string;
+}
+
+export interface WrapErrorResult {
+  // The function, as func F, method T.M or the function literal at a
+  // location.
+  functionName: string;
+  wrapped: WrappedReturn[];
+  // Returns of bare errors left as they are, with the reason.
+  skipped: string[];
+  changes: FileChange[];
+  dryRun: boolean;
+}
+
+// Functions whose errors are new, so that wrapping them adds nothing.
+const CREATING: Record<string, string[]> = {
+  errors: ['New', 'Join'],
+  fmt: ['Errorf'],
+};
+
+function label(file: GoSourceFile, func: FuncDecl | FuncLit): string {
+  if (func.type === 'FuncLit') {
+    return `the function literal at ${locationOf(file, func.pos)}`;
+  }
+  let recv = func.recv?.list[0]?.fieldType;
+  while (recv && recv.type !== 'Ident') {
+    if (recv.type === 'StarExpr' || recv.type === 'IndexExpr') recv = recv.x;
+    else if (recv.type === 'ParenExpr') recv = recv.x;
+    else break;
+  }
+  return recv?.type === 'Ident'
+    ? `method ${recv.name}.${func.name.name}`
+    : `func ${func.name.name}`;
+}
+
+// Splits a Go name into lower-case words: LoadConfig, HTTPServer and
+// readJSON become "load config", "http server" and "read json".
+function words(name: string): string {
+  const parts = name.match(/[A-Z]+(?![a-z])|[A-Z]?[a-z0-9]+|[A-Z]/g) ?? [];
+  return parts.map(p => p.toLowerCase()).join(' ') || name;
+}
+
+// Returns the call among the last values assigned to obj before pos in
+// body, the statements of the function, if it was assigned a call.
+function callAssigning(
+  info: GoInfo,
+  body: Node,
+  obj: GoObject,
+  pos: number
+): Expr | undefined {
+  let found: Expr | undefined;
+  let at = -1;
+  inspect(body, n => {
+    if (n.pos >= pos) return false;
+    if (n.type === 'FuncLit') return false;
+    let lhs: Expr[];
+    let rhs: Expr[];
+    if (n.type === 'AssignStmt') ({ lhs, rhs } = n);
+    else if (n.type === 'ValueSpec') [lhs, rhs] = [n.names, n.values];
+    else return;
+    const i = lhs.findIndex(
+      e => e.type === 'Ident' && sameObject(info.objectOf(e), obj)
+    );
+    if (i < 0 || n.pos < at) return;
+    at = n.pos;
+    const value = rhs.length === lhs.length ? rhs[i] : rhs[0];
+    found = value && unparen(value).type === 'CallExpr' ? value : undefined;
+  });
+  return found;
+}
+
+// Returns the called function of call as written, without type arguments.
+function calleeText(file: GoSourceFile, call: Expr): string {
+  call = unparen(call);
+  if (call.type !== 'CallExpr') return '';
+  let fun = unparen(call.fun);
+  if (fun.type === 'IndexExpr') fun = fun.x;
+  return file.src.slice(fun.pos, fun.end);
+}
+
+// Tells whether call is one of the CREATING functions.
+function creates(info: GoInfo, call: Expr): boolean {
+  call = unparen(call);
+  if (call.type !== 'CallExpr') return false;
+  const fun = unparen(call.fun);
+  if (fun.type !== 'SelectorExpr' || fun.x.type !== 'Ident') return false;
+  const pkg = info.objectOf(fun.x);
+  return (
+    pkg?.kind === 'pkgname' &&
+    !!CREATING[pkg.imported ?? '']?.includes(fun.sel.name)
+  );
+}
+
+// Tells whether cond having the value truth means that obj is not nil:
+// err != nil holding, alone or with conditions joined by &&, or
+// err == nil failing.
+function provesNonNil(
+  info: GoInfo,
+  cond: Expr,
+  obj: GoObject,
+  truth: boolean
+): boolean {
+  cond = unparen(cond);
+  if (cond.type === 'UnaryExpr' && cond.op === '!') {
+    return provesNonNil(info, cond.x, obj, !truth);
+  }
+  if (cond.type !== 'BinaryExpr') return false;
+  const { op, x, y } = cond;
+  if ((op === '&&' && truth) || (op === '||' && !truth)) {
+    return (
+      provesNonNil(info, x, obj, truth) || provesNonNil(info, y, obj, truth)
+    );
+  }
+  if (op !== (truth ? '!=' : '==')) return false;
+  const is = (e: Expr, match: (o?: GoObject) => boolean) => {
+    e = unparen(e);
+    return e.type === 'Ident' && match(info.objectOf(e));
+  };
+  const isObj = (o?: GoObject) => sameObject(o, obj);
+  const isNil = (o?: GoObject) => o?.kind === 'nil';
+  return (is(x, isObj) && is(y, isNil)) || (is(x, isNil) && is(y, isObj));
+}
+
+// Tells whether obj is assigned in block before pos.
+function assignedBefore(
+  info: GoInfo,
+  block: Node,
+  obj: GoObject,
+  pos: number
+): boolean {
+  let assigned = false;
+  inspect(block, n => {
+    if (assigned || n.pos >= pos) return false;
+    if (n.type === 'AssignStmt') {
+      assigned = n.lhs.some(
+        e => e.type === 'Ident' && sameObject(info.objectOf(e), obj)
+      );
+    }
+  });
+  return assigned;
+}
+
+// Tells whether obj, the error that ret returns, is known not to be nil
+// there: ret is in the branch of an if statement or a case of a switch
+// without a tag whose condition checks it, and obj is not assigned again
+// in that branch before ret. Wrapping a nil error would make it non-nil.
+function checkedNonNil(
+  info: GoInfo,
+  file: GoSourceFile,
+  ret: ReturnStmt,
+  obj: GoObject
+): boolean {
+  const path = pathEnclosingInterval(file.ast, ret.pos, ret.end);
+  for (let i = path.length - 2; i >= 0; i--) {
+    const p = path[i];
+    const child = path[i + 1];
+    if (p.type === 'FuncDecl' || p.type === 'FuncLit') return false;
+    let proven = false;
+    if (p.type === 'IfStmt' && child !== p.init && child !== p.cond) {
+      proven = provesNonNil(info, p.cond, obj, child === p.body);
+    } else if (
+      p.type === 'CaseClause' &&
+      p.list &&
+      path[i - 2]?.type === 'SwitchStmt' &&
+      !(path[i - 2] as SwitchStmt).tag &&
+      p.body.includes(child as Stmt)
+    ) {
+      const list = p.list;
+      proven = list.every(e => provesNonNil(info, e, obj, true));
+    }
+    if (proven) return !assignedBefore(info, child, obj, ret.pos);
+  }
+  return false;
+}
+
+export async function performWrapError(
+  options: WrapErrorOptions
+): Promise<WrapErrorResult> {
+  const { dryRun = false } = options;
+  const { program, file } = await loadGoFile(options.filePath, options);
+  const info = program.check().info;
+  const index = resolveLocation(file, options);
+  const path = pathEnclosingInterval(file.ast, index);
+  const func = [...path]
+    .reverse()
+    .find(
+      (n): n is FuncDecl | FuncLit =>
+        n.type === 'FuncDecl' || n.type === 'FuncLit'
+    );
+  if (!func) {
+    throw new ToolError(
+      'invalid_location',
+      `No function at ${locationOf(file, index)}`
+    );
+  }
+  const functionName = label(file, func);
+  const body = func.body;
+  if (!body) {
+    throw new ToolError('unsupported_construct', `${functionName} has no body`);
+  }
+  const sig =
+    func.type === 'FuncDecl'
+      ? info.defs.get(func.name)?.type
+      : info.typeOf(func);
+  const results = sig?.kind === 'signature' ? sig.results : [];
+  const errorResults = results.flatMap((r, i) =>
+    r.type && identical(r.type, errorType()) ? [i] : []
+  );
+  if (errorResults.length === 0) {
+    throw new ToolError(
+      'invalid_argument',
+      `${functionName} does not return an error`
+    );
+  }
+  // Literals are named after the function declaring them.
+  const decl = path.find((n): n is FuncDecl => n.type === 'FuncDecl');
+  const name = decl?.name.name ?? '';
+  const template = options.template ?? words(name);
+  if (!template.trim()) {
+    throw new ToolError(
+      'invalid_argument',
+      `Give a template for the messages of ${functionName}`
+    );
+  }
+
+  const returns: ReturnStmt[] = [];
+  inspect(body, n => {
+    if (n.type === 'FuncLit') return false;
+    if (n.type === 'ReturnStmt') returns.push(n);
+  });
+
+  const missing: ImportRequest[] = [];
+  const fmt = fileQualifier(file, missing)({ path: 'fmt', name: 'fmt' });
+  const fmtObj = missing.length > 0 ? undefined : file.scope?.lookup(fmt);
+  const wrapped: WrappedReturn[] = [];
+  const skipped: string[] = [];
+  const edits: TextEdit[] = [];
+  for (const ret of returns) {
+    if (ret.results.length === 0 && results[0]?.name) {
+      const at = locationOf(file, ret.pos);
+      for (const i of errorResults) {
+        skipped.push(`${at}: naked return of '${results[i].name}'`);
+      }
+      continue;
+    }
+    if (ret.results.length !== results.length) continue;
+    for (const i of errorResults) {
+      const e = unparen(ret.results[i]);
+      if (e.type !== 'Ident') continue;
+      const obj = info.objectOf(e);
+      if (obj?.kind !== 'var') continue;
+      const at = locationOf(file, e.pos);
+      const call = callAssigning(info, body, obj, ret.pos);
+      const callee = call ? calleeText(file, call) : '';
+      if (call && creates(info, call)) {
+        skipped.push(`${at}: '${e.name}' is created by ${callee}`);
+        continue;
+      }
+      if (options.functions) {
+        const last = callee.slice(callee.lastIndexOf('.') + 1);
+        const selected = options.functions.some(
+          f => f === callee || (!f.includes('.') && f === last)
+        );
+        if (!selected) continue;
+      }
+      if (!checkedNonNil(info, file, ret, obj)) {
+        skipped.push(`${at}: '${e.name}' is not checked to be non-nil`);
+        continue;
+      }
+      if (!callee && template.includes('{call}')) {
+        skipped.push(`${at}: '${e.name}' does not come from a call`);
+        continue;
+      }
+      const visible = fmt ? lookupAt(info, file, e.pos, fmt) : fmtObj;
+      if (fmtObj ? !sameObject(visible, fmtObj) : visible) {
+        throw new ToolError(
+          'name_conflict',
+          `'${fmt}' at ${at} refers to ${locationOf(visible!.file!, visible!.pos)} instead of package fmt`,
+          errorLocation(file, e.pos)
+        );
+      }
+      const context = template
+        .replaceAll('{func}', name)
+        .replaceAll('{call}', callee);
+      const message = `${context.replace(/%/g, '%%')}: %w`;
+      const errorf = fmt ? `${fmt}.Errorf` : 'Errorf';
+      edits.push({
+        pos: e.pos,
+        end: e.end,
+        newText: `${errorf}(${JSON.stringify(message)}, ${e.name})`,
+      });
+      wrapped.push({ location: at, message });
+    }
+  }
+  if (edits.length > 0) edits.push(...addImportEdits(file, missing));
+
+  const changes =
+    edits.length > 0
+      ? await commitFileChanges(
+          [
+            {
+              filePath: file.filePath,
+              original: file.src,
+              updated: applyTextEdits(file.src, edits),
+            },
+          ],
+          dryRun,
+          options
+        )
+      : [];
+  return { functionName, wrapped, skipped, changes, dryRun };
+}
+
+export function formatWrapErrorResults(result: WrapErrorResult): string {
+  const skipped =
+    result.skipped.length > 0
+      ? `\n\nNot wrapped:\n${result.skipped.map(s => `  ${s}`).join('\n')}`
+      : '';
+  if (result.wrapped.length === 0) {
+    return `No returns of ${result.functionName} return a bare error to wrap${skipped}`;
+  }
+
+  const count = result.wrapped.length;
+  const output = [
+    `Wrapped ${count} returned ${count === 1 ? 'error' : 'errors'} of ${result.functionName}:`,
+    ...result.wrapped.map(w => `  ${w.location}: "${w.message}"`),
+  ];
+  return `${output.join('\n')}${skipped}\n\n${formatFileChanges(result.changes, result.dryRun)}`;
+}
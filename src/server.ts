@@ -1,17 +1,335 @@
-import { McpServer } from '@modelcontextprotocol/sdk/server/mcp.js';
+import {
+  McpServer,
+  ResourceTemplate,
+} from '@modelcontextprotocol/sdk/server/mcp.js';
+import type { ToolCallback } from '@modelcontextprotocol/sdk/server/mcp.js';
 import { StdioServerTransport } from '@modelcontextprotocol/sdk/server/stdio.js';
+import type { RequestHandlerExtra } from '@modelcontextprotocol/sdk/shared/protocol.js';
+import {
+  SubscribeRequestSchema,
+  UnsubscribeRequestSchema,
+} from '@modelcontextprotocol/sdk/types.js';
+import type {
+  CallToolResult,
+  ReadResourceResult,
+  ServerNotification,
+  ServerRequest,
+} from '@modelcontextprotocol/sdk/types.js';
+import { dirname, join } from 'path';
+import { fileURLToPath } from 'url';
 import { z } from 'zod';
+import type { ZodRawShape } from 'zod';
 import { performSearch, formatSearchResults } from './core/search-tool.js';
 import { performRefactor, formatRefactorResults } from './core/refactor-tool.js';
+import {
+  performFindReferences,
+  formatFindReferencesResults,
+} from './core/find-references-tool.js';
+import {
+  performExtractFunction,
+  performExtractMethod,
+  formatExtractFunctionResults,
+} from './core/extract-function-tool.js';
+import {
+  performInlineFunction,
+  formatInlineFunctionResults,
+} from './core/inline-function-tool.js';
+import {
+  performChangeSignature,
+  formatChangeSignatureResults,
+} from './core/change-signature-tool.js';
+import {
+  performExtractInterface,
+  formatExtractInterfaceResults,
+} from './core/extract-interface-tool.js';
+import {
+  performImplementInterface,
+  formatImplementInterfaceResults,
+} from './core/implement-interface-tool.js';
+import {
+  performMoveDeclaration,
+  formatMoveDeclarationResults,
+  performSplitFile,
+  formatSplitFileResults,
+} from './core/move-declaration-tool.js';
+import {
+  performRenameSymbol,
+  formatRenameSymbolResults,
+} from './core/rename-symbol-tool.js';
+import { performReload, formatReloadResults } from './core/reload-tool.js';
+import {
+  performOrganizeImports,
+  formatOrganizeImportsResults,
+} from './core/organize-imports-tool.js';
+import {
+  performExtractVariable,
+  formatExtractVariableResults,
+} from './core/extract-variable-tool.js';
+import {
+  performInlineVariable,
+  formatInlineVariableResults,
+} from './core/inline-variable-tool.js';
+import {
+  performSafeDelete,
+  formatSafeDeleteResults,
+} from './core/safe-delete-tool.js';
+import {
+  performGenerateTests,
+  formatGenerateTestsResults,
+} from './core/generate-tests-tool.js';
+import {
+  performRenamePackage,
+  formatRenamePackageResults,
+} from './core/rename-package-tool.js';
+import {
+  performConvertReceiver,
+  formatConvertReceiverResults,
+} from './core/convert-receiver-tool.js';
+import {
+  performAddStructTags,
+  formatAddStructTagsResults,
+} from './core/add-struct-tags-tool.js';
+import {
+  performGenerateStringer,
+  formatGenerateStringerResults,
+} from './core/generate-stringer-tool.js';
+import {
+  performExtractConstant,
+  formatExtractConstantResults,
+} from './core/extract-constant-tool.js';
+import {
+  performInlineConstant,
+  formatInlineConstantResults,
+} from './core/inline-constant-tool.js';
+import {
+  performFindImplementations,
+  formatFindImplementationsResults,
+} from './core/find-implementations-tool.js';
+import {
+  performConvertNamedReturns,
+  formatConvertNamedReturnsResults,
+} from './core/convert-named-returns-tool.js';
+import {
+  performListSymbols,
+  formatListSymbolsResults,
+} from './core/list-symbols-tool.js';
+import {
+  performWrapError,
+  formatWrapErrorResults,
+} from './core/wrap-error-tool.js';
+import { performUndo, formatUndoResults } from './core/undo-tool.js';
+import {
+  performConvertFuncToMethod,
+  performConvertMethodToFunc,
+  formatConvertFuncMethodResults,
+} from './core/convert-func-method-tool.js';
+import {
+  performGroupDeclarations,
+  formatGroupDeclarationsResults,
+} from './core/group-declarations-tool.js';
+import {
+  performSortStructFields,
+  formatSortStructFieldsResults,
+  FIELD_ORDERS,
+} from './core/sort-struct-fields-tool.js';
+import {
+  performReplaceLoopWithRange,
+  performReplaceRangeWithIndex,
+  formatConvertLoopResults,
+} from './core/convert-loop-tool.js';
+import {
+  performConvertIfElseToSwitch,
+  performConvertSwitchToIfElse,
+  formatConvertSwitchResults,
+} from './core/convert-switch-tool.js';
+import {
+  performRemoveUnused,
+  formatRemoveUnusedResults,
+} from './core/remove-unused-tool.js';
+import {
+  performGenerateConstructor,
+  formatGenerateConstructorResults,
+} from './core/generate-constructor-tool.js';
+import {
+  performDeduplicateFunctions,
+  formatDeduplicateFunctionsResults,
+} from './core/deduplicate-functions-tool.js';
+import {
+  performReorderParameters,
+  formatReorderParametersResults,
+} from './core/reorder-parameters-tool.js';
+import {
+  performExtractPackage,
+  formatExtractPackageResults,
+} from './core/extract-package-tool.js';
+import {
+  performCompileCheck,
+  formatCompileCheckResults,
+} from './core/compile-check-tool.js';
+import {
+  performExtractTypeAlias,
+  formatExtractTypeAliasResults,
+} from './core/extract-type-alias-tool.js';
+import {
+  performInlineTypeAlias,
+  formatInlineTypeAliasResults,
+} from './core/inline-type-alias-tool.js';
+import {
+  performCapabilities,
+  formatCapabilitiesResults,
+} from './core/capabilities-tool.js';
+import type { ToolCapability } from './core/capabilities-tool.js';
+import {
+  PACKAGES_URI,
+  affectedResources,
+  fileResources,
+  listPackages,
+  packageResources,
+  readGoFile,
+  readPackage,
+  resourceRoot,
+} from './core/package-resources.js';
+import type { ProgressReporter, TaskOptions } from './utils/task.js';
+import { ReadWriteLock } from './utils/lock.js';
+import { errorResult } from './utils/tool-error.js';
+import { onFilesChanged, readFileContent } from './utils/file-utils.js';
+import { UNDO_LIMIT } from './utils/undo-history.js';
+import { GO_FORMATS } from './utils/go-format.js';
+import { objectSchemaOf } from './utils/json-schema.js';
 
 // Re-export for backward compatibility
 export { searchFiles, readFileContent, writeFileContent } from './utils/file-utils.js';
 export { groupConsecutiveLines } from './utils/line-utils.js';
 
-const server = new McpServer({
-  name: 'refactor-mcp',
-  version: '1.0.0',
-});
+// Parameters of the Go tools that select files by build constraints.
+const buildSchema = {
+  build_flags: z
+    .array(z.string())
+    .optional()
+    .describe(
+      'Go build flags choosing the files to load, such as ["-tags=integration"]; only -tags is supported'
+    ),
+  goos: z
+    .string()
+    .optional()
+    .describe('Target operating system (defaults to $GOOS or the host)'),
+  goarch: z
+    .string()
+    .optional()
+    .describe('Target architecture (defaults to $GOARCH or the host)'),
+};
+
+// The parameter of the Go tools that write files choosing how the Go files
+// they write are formatted.
+const formatSchema = {
+  format: z
+    .enum(GO_FORMATS)
+    .optional()
+    .describe(
+      'Formatter applied to the Go files written: gofmt, gofumpt, or none to leave the rest of each file alone (defaults to $REFACTOR_MCP_FORMAT or gofmt)'
+    ),
+};
+
+// The parameter of the Go tools that can find a symbol by its name instead
+// of a location.
+const symbolSchema = {
+  symbol: z
+    .string()
+    .optional()
+    .describe(
+      'Name of the symbol, such as Lookup, Store.Get or store.Store.Get, as an alternative to offset or line and column; file_path then only selects the module and the package searched first'
+    ),
+};
+
+// Returns a reporter that sends MCP progress notifications for a tool call,
+// or undefined when the client did not ask for them with a progress token.
+// Every message counts as one more step, since how many steps a call takes
+// is not known in advance. Progress is best effort: a notification that
+// cannot be sent does not fail the call.
+function progressReporter(
+  extra: RequestHandlerExtra<ServerRequest, ServerNotification>
+): ProgressReporter | undefined {
+  const progressToken = extra._meta?.progressToken;
+  if (progressToken === undefined) return undefined;
+  let progress = 0;
+  return message => {
+    progress++;
+    extra
+      .sendNotification({
+        method: 'notifications/progress',
+        params: { progressToken, progress, message },
+      })
+      .catch(() => {});
+  };
+}
+
+// Returns the options that tie a tool's work to its request: progress
+// notifications, and the signal the SDK aborts when the client cancels.
+function taskOptions(
+  extra: RequestHandlerExtra<ServerRequest, ServerNotification>
+): TaskOptions {
+  return { onProgress: progressReporter(extra), signal: extra.signal };
+}
+
+// The server reports the version of its package.
+const packageJson = JSON.parse(
+  readFileContent(
+    join(dirname(fileURLToPath(import.meta.url)), '../package.json')
+  )
+);
+
+const SERVER_INFO = { name: 'refactor-mcp', version: packageJson.version };
+
+const server = new McpServer(SERVER_INFO);
+
+// Tool calls run concurrently, except that a call writing files holds
+// toolLock alone: no other call loads packages or reads files between the
+// files it reads and those it writes, and no two write at once. Calls of
+// read-only tools and dry runs share the lock.
+const toolLock = new ReadWriteLock();
+
+// The tools registered, as the capabilities tool lists them, with the zod
+// shapes of their parameters.
+const registeredTools: {
+  name: string;
+  title: string;
+  description: string;
+  readOnly: boolean;
+  inputSchema: ZodRawShape;
+}[] = [];
+
+// Registers a tool with server, declaring whether it only reads files in
+// its readOnlyHint annotation, and runs its calls under toolLock.
+function registerTool<Args extends ZodRawShape>(
+  name: string,
+  config: {
+    title: string;
+    description: string;
+    annotations: { readOnlyHint: boolean };
+    inputSchema: Args;
+  },
+  callback: ToolCallback<Args>
+): void {
+  const call = callback as (
+    args: { dry_run?: boolean },
+    extra: RequestHandlerExtra<ServerRequest, ServerNotification>
+  ) => Promise<CallToolResult>;
+  const guarded = (
+    args: { dry_run?: boolean },
+    extra: RequestHandlerExtra<ServerRequest, ServerNotification>
+  ) =>
+    config.annotations.readOnlyHint || args.dry_run
+      ? toolLock.read(() => call(args, extra))
+      : toolLock.write(() => call(args, extra));
+  server.registerTool(name, config, guarded as ToolCallback<Args>);
+  registeredTools.push({
+    name,
+    title: config.title,
+    description: config.description,
+    readOnly: config.annotations.readOnlyHint,
+    inputSchema: config.inputSchema,
+  });
+}
 
 // Register prompt resources for common code extraction patterns
 server.registerPrompt(
@@ -236,13 +554,106 @@ Example usage:
   }
 );
 
+// Resources browsing the Go module of the server's directory. Reads share
+// toolLock with the tool calls, so that they never see the files of a call
+// half written.
+function jsonResource(uri: URL, value: unknown): ReadResourceResult {
+  return {
+    contents: [
+      {
+        uri: uri.href,
+        mimeType: 'application/json',
+        text: JSON.stringify(value, null, 2),
+      },
+    ],
+  };
+}
+
+server.registerResource(
+  'packages',
+  PACKAGES_URI,
+  {
+    title: 'Go Packages',
+    description:
+      'The modules loaded from the server directory, or $REFACTOR_MCP_ROOT, and their packages with their import paths, directories and gopkg:// URIs',
+    mimeType: 'application/json',
+  },
+  async uri => toolLock.read(async () => jsonResource(uri, listPackages()))
+);
+
+server.registerResource(
+  'package',
+  new ResourceTemplate('gopkg://{+importPath}', {
+    list: async () =>
+      toolLock.read(async () => ({ resources: packageResources() })),
+  }),
+  {
+    title: 'Go Package',
+    description:
+      'A Go package by import path: its name, directory, imports and files with their gofile:// URIs, including those left out by build constraints',
+    mimeType: 'application/json',
+  },
+  async (uri, { importPath }) =>
+    toolLock.read(async () =>
+      jsonResource(uri, readPackage(String(importPath)))
+    )
+);
+
+server.registerResource(
+  'file',
+  new ResourceTemplate('gofile://{+path}', {
+    list: async () =>
+      toolLock.read(async () => ({ resources: fileResources() })),
+  }),
+  {
+    title: 'Go File',
+    description:
+      'The source of a Go file, named by the import path of its directory and its file name',
+    mimeType: 'text/x-go',
+  },
+  async (uri, { path }) =>
+    toolLock.read(async () => {
+      const name = String(path);
+      const slash = name.lastIndexOf('/');
+      const text = readGoFile(name.slice(0, slash), name.slice(slash + 1));
+      return { contents: [{ uri: uri.href, mimeType: 'text/x-go', text }] };
+    })
+);
+
+// The URIs of the resources clients subscribed to. Subscribers are told
+// when a tool changes the file or package of a resource, and every client
+// when a tool creates or removes files, which changes the list.
+const subscriptions = new Set<string>();
+
+server.server.registerCapabilities({
+  resources: { subscribe: true, listChanged: true },
+});
+server.server.setRequestHandler(SubscribeRequestSchema, async request => {
+  subscriptions.add(request.params.uri);
+  return {};
+});
+server.server.setRequestHandler(UnsubscribeRequestSchema, async request => {
+  subscriptions.delete(request.params.uri);
+  return {};
+});
+
+onFilesChanged(events => {
+  const uris = new Set(events.flatMap(affectedResources));
+  for (const uri of uris) {
+    if (!subscriptions.has(uri)) continue;
+    server.server.sendResourceUpdated({ uri }).catch(() => {});
+  }
+  if (events.some(e => e.kind !== 'changed')) server.sendResourceListChanged();
+});
+
 
-server.registerTool(
+registerTool(
   'code_refactor',
   {
     title: 'Code Refactor',
     description:
       'Refactor code by replacing search pattern with replace pattern using regex',
+    annotations: { readOnlyHint: false },
     inputSchema: {
       search_pattern: z
         .string()
@@ -268,6 +679,12 @@ server.registerTool(
         .boolean()
         .optional()
         .describe('Include matched text in the results'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
     },
   },
   async ({
@@ -277,6 +694,7 @@ server.registerTool(
     file_pattern,
     include_capture_groups,
     include_matched_text,
+    dry_run = false,
   }) => {
     try {
       const results = await performRefactor({
@@ -284,33 +702,31 @@ server.registerTool(
         replacePattern: replace_pattern,
         contextPattern: context_pattern,
         filePattern: file_pattern,
-        dryRun: false,
+        dryRun: dry_run,
       });
 
       const summary = formatRefactorResults(results, {
         includeCaptureGroups: include_capture_groups,
         includeMatchedText: include_matched_text,
-        dryRun: false,
+        dryRun: dry_run,
       });
 
       return {
         content: [{ type: 'text', text: summary }],
       };
     } catch (error) {
-      return {
-        content: [{ type: 'text', text: `Error during refactoring: ${error}` }],
-        isError: true,
-      };
+      return errorResult('refactoring', error);
     }
   }
 );
 
-server.registerTool(
+registerTool(
   'code_search',
   {
     title: 'Code Search',
     description:
       'Search for code patterns using regex and return file locations with line numbers',
+    annotations: { readOnlyHint: true },
     inputSchema: {
       search_pattern: z
         .string()
@@ -350,10 +766,2940 @@ server.registerTool(
         content: [{ type: 'text', text: summary }],
       };
     } catch (error) {
+      return errorResult('search', error);
+    }
+  }
+);
+
+registerTool(
+  'find_references',
+  {
+    title: 'Find References',
+    description:
+      'Find every reference to the Go symbol at a position, including its declaration, across the module',
+    annotations: { readOnlyHint: true },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to the Go file containing the identifier'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the identifier within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the identifier (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the identifier (used with line)'),
+      ...symbolSchema,
+      ...buildSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      symbol,
+      build_flags,
+      goos,
+      goarch,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performFindReferences({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        symbol,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatFindReferencesResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('find references', error);
+    }
+  }
+);
+
+registerTool(
+  'extract_function',
+  {
+    title: 'Extract Function',
+    description:
+      'Move a range of Go statements into a new function and replace them with a call, passing the variables they read as parameters and returning those they assign',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to the Go file'),
+      start_line: z
+        .number()
+        .describe('First line of the statements (1-based)'),
+      end_line: z
+        .number()
+        .describe('Last line of the statements (1-based, inclusive)'),
+      function_name: z.string().describe('Name of the new function'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      start_line,
+      end_line,
+      function_name,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performExtractFunction({
+        filePath: file_path,
+        startLine: start_line,
+        endLine: end_line,
+        functionName: function_name,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatExtractFunctionResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('extract function', error);
+    }
+  }
+);
+
+registerTool(
+  'inline_function',
+  {
+    title: 'Inline Function',
+    description:
+      'Replace every call to a Go function with its body, binding arguments to parameters and turning return statements into assignments, then delete the function',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file containing the function or a call to it'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the function name within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the function name (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the function name (used with line)'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performInlineFunction({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatInlineFunctionResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('inline function', error);
+    }
+  }
+);
+
+registerTool(
+  'change_signature',
+  {
+    title: 'Change Signature',
+    description:
+      'Add, remove and reorder the parameters of a Go function or method, updating every call site and the other methods of interfaces it belongs to',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file containing the function or a call to it'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the function name within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the function name (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the function name (used with line)'),
+      ...symbolSchema,
+      parameters: z
+        .array(
+          z.discriminatedUnion('action', [
+            z.object({
+              action: z.literal('keep'),
+              index: z
+                .number()
+                .describe('0-based index of the current parameter to keep'),
+            }),
+            z.object({
+              action: z.literal('drop'),
+              index: z
+                .number()
+                .describe('0-based index of the current parameter to remove'),
+            }),
+            z.object({
+              action: z.literal('add'),
+              name: z.string().describe('Name of the new parameter'),
+              type: z
+                .string()
+                .describe(
+                  'Go type of the new parameter, written as in the file declaring the function'
+                ),
+              default_value: z
+                .string()
+                .optional()
+                .describe(
+                  'Argument passed at existing call sites (defaults to the zero value of the type)'
+                ),
+            }),
+          ])
+        )
+        .describe(
+          'The new parameter list in order, with a drop entry for each removed parameter'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      symbol,
+      parameters,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performChangeSignature({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        symbol,
+        parameters: parameters.map(p =>
+          p.action === 'add'
+            ? {
+                action: 'add' as const,
+                name: p.name,
+                type: p.type,
+                defaultValue: p.default_value,
+              }
+            : p
+        ),
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatChangeSignatureResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('change signature', error);
+    }
+  }
+);
+
+registerTool(
+  'extract_interface',
+  {
+    title: 'Extract Interface',
+    description:
+      'Declare a Go interface with the methods of a concrete type, including promoted ones, and optionally use it for parameters and struct fields of that type',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file in the package declaring the type'),
+      type_name: z.string().describe('Name of the concrete type'),
+      interface_name: z.string().describe('Name of the new interface'),
+      methods: z
+        .array(z.string())
+        .optional()
+        .describe(
+          'Methods to include, in order (defaults to every exported method; unexported ones must be listed)'
+        ),
+      replace: z
+        .array(z.string())
+        .optional()
+        .describe(
+          'Parameters and struct fields of the package to retype to the interface, as Func.param, Type.Method.param or Struct.field'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      type_name,
+      interface_name,
+      methods,
+      replace,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performExtractInterface({
+        filePath: file_path,
+        typeName: type_name,
+        interfaceName: interface_name,
+        methods,
+        replace,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatExtractInterfaceResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('extract interface', error);
+    }
+  }
+);
+
+registerTool(
+  'implement_interface',
+  {
+    title: 'Implement Interface',
+    description:
+      'Add stub methods to a Go type for every method of an interface it is missing, following the receivers of its existing methods',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file in the package declaring the type'),
+      type_name: z.string().describe('Name of the type to add methods to'),
+      interface_name: z
+        .string()
+        .describe(
+          'Interface to implement, qualified by its package name when declared in another package (e.g. store.Store)'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      type_name,
+      interface_name,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performImplementInterface({
+        filePath: file_path,
+        typeName: type_name,
+        interfaceName: interface_name,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatImplementInterfaceResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('implement interface', error);
+    }
+  }
+);
+
+registerTool(
+  'move_declaration',
+  {
+    title: 'Move Declaration',
+    description:
+      'Move a top-level Go declaration with its doc comment to another file of the same package, fixing the imports of both files',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to the Go file containing the declaration'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of a position within the declaration'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line within the declaration (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column (used with line)'),
+      destination: z
+        .string()
+        .describe(
+          'Go file of the same package to move the declaration to, created if missing'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      destination,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performMoveDeclaration({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        destination,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatMoveDeclarationResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('move declaration', error);
+    }
+  }
+);
+
+registerTool(
+  'rename_symbol',
+  {
+    title: 'Rename Symbol',
+    description:
+      'Rename the Go symbol at a position and every reference to it across all packages of the module, including qualified uses, fields and interface methods',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to the Go file containing the identifier'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the identifier within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the identifier (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the identifier (used with line)'),
+      ...symbolSchema,
+      new_name: z.string().describe('New name for the symbol'),
+      update_comments: z
+        .boolean()
+        .optional()
+        .describe(
+          'Also replace the old name, as a whole word, in the comments next to the declaration'
+        ),
+      update_strings: z
+        .boolean()
+        .optional()
+        .describe(
+          'Also replace string literals that spell exactly the old name'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      symbol,
+      new_name,
+      update_comments,
+      update_strings,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performRenameSymbol({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        symbol,
+        newName: new_name,
+        updateComments: update_comments,
+        updateStrings: update_strings,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
       return {
-        content: [{ type: 'text', text: `Error during search: ${error}` }],
-        isError: true,
+        content: [{ type: 'text', text: formatRenameSymbolResults(result) }],
       };
+    } catch (error) {
+      return errorResult('rename symbol', error);
+    }
+  }
+);
+
+registerTool(
+  'reload',
+  {
+    title: 'Reload Go Packages',
+    description:
+      'Drop the cached parse and type information of Go modules so the next tool call reads every file from disk again. Changes are normally detected from file modification times; use this when files changed in ways that keep them identical',
+    // Not read-only, so that it waits for the calls using the cache and
+    // holds toolLock alone while it drops it.
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .optional()
+        .describe(
+          'A file or directory of the module to reload; all modules when omitted'
+        ),
+    },
+  },
+  async ({ file_path }) => {
+    try {
+      const result = await performReload({ filePath: file_path });
+
+      return {
+        content: [{ type: 'text', text: formatReloadResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('reload', error);
+    }
+  }
+);
+
+registerTool(
+  'organize_imports',
+  {
+    title: 'Organize Imports',
+    description:
+      'Remove unused imports from Go files, add the missing ones, and sort them into standard library, third-party and module groups like goimports',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe(
+          'Go file to organize, or a package directory to organize every file of'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    { file_path, dry_run, build_flags, goos, goarch, format },
+    extra
+  ) => {
+    try {
+      const result = await performOrganizeImports({
+        filePath: file_path,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatOrganizeImportsResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('organize imports', error);
+    }
+  }
+);
+
+registerTool(
+  'extract_variable',
+  {
+    title: 'Extract Variable',
+    description:
+      'Declare a local Go variable holding a selected expression before the enclosing statement and replace the expression, or optionally every equal occurrence in the block, with the variable',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to the Go file'),
+      start_line: z
+        .number()
+        .describe('1-based line where the expression starts'),
+      start_column: z
+        .number()
+        .describe('1-based byte column where the expression starts'),
+      end_line: z.number().describe('1-based line where the expression ends'),
+      end_column: z
+        .number()
+        .describe('1-based byte column just past the end of the expression'),
+      variable_name: z.string().describe('Name of the new variable'),
+      replace_all: z
+        .boolean()
+        .optional()
+        .describe(
+          'Also replace the other occurrences of the expression in the block'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      start_line,
+      start_column,
+      end_line,
+      end_column,
+      variable_name,
+      replace_all,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performExtractVariable({
+        filePath: file_path,
+        startLine: start_line,
+        startColumn: start_column,
+        endLine: end_line,
+        endColumn: end_column,
+        variableName: variable_name,
+        replaceAll: replace_all,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatExtractVariableResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('extract variable', error);
+    }
+  }
+);
+
+registerTool(
+  'inline_variable',
+  {
+    title: 'Inline Variable',
+    description:
+      'Replace the uses of a Go local variable with the expression it is initialized to and delete its declaration, refusing when that could change what the program computes',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to the Go file containing the variable'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the variable name within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the variable name (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the variable name (used with line)'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performInlineVariable({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatInlineVariableResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('inline variable', error);
+    }
+  }
+);
+
+registerTool(
+  'safe_delete',
+  {
+    title: 'Safe Delete',
+    description:
+      'Delete a package-level Go declaration only if nothing in the module still refers to it; otherwise list the blocking references and change nothing. A type is deleted together with its methods, and imports left unused are removed',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to the Go file containing the declaration'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the declared name within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the declared name (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the declared name (used with line)'),
+      ...symbolSchema,
+      force: z
+        .boolean()
+        .optional()
+        .describe(
+          'Delete exported symbols, which packages outside the module may use'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      symbol,
+      force,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performSafeDelete({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        symbol,
+        force,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatSafeDeleteResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('safe delete', error);
+    }
+  }
+);
+
+registerTool(
+  'generate_tests',
+  {
+    title: 'Generate Tests',
+    description:
+      'Scaffold a table-driven Go test for a function or method in the _test.go file next to it: a Test function with an empty test-case table whose fields mirror the parameters and results, and a t.Run loop that calls the function and compares the results',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to the Go file containing the function'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the function name within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the function name (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the function name (used with line)'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performGenerateTests({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatGenerateTestsResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('generate tests', error);
+    }
+  }
+);
+
+registerTool(
+  'rename_package',
+  {
+    title: 'Rename Package',
+    description:
+      'Rename a Go package of the module: the package clause of each of its files, including external tests, and the qualifiers of every importing file that uses the default package name. Imports with an explicit name are left alone; where the new name would conflict, the import keeps the old name explicitly. The directory and import path stay the same',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Any file or directory of the Go module'),
+      import_path: z.string().describe('Import path of the package to rename'),
+      new_name: z.string().describe('New name for the package'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      import_path,
+      new_name,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performRenamePackage({
+        filePath: file_path,
+        importPath: import_path,
+        newName: new_name,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatRenamePackageResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('rename package', error);
+    }
+  }
+);
+
+// Both directions of the receiver conversion take the same arguments.
+for (const receiver of ['pointer', 'value'] as const) {
+  registerTool(
+    `convert_to_${receiver}_receiver`,
+    {
+      title: `Convert to ${receiver === 'pointer' ? 'Pointer' : 'Value'} Receivers`,
+      description:
+        receiver === 'pointer'
+          ? 'Give every method of a Go type a pointer receiver, updating method expressions and calls on composite literals; refuses when a value of the type is used where the methods are needed or a call is on a value whose address cannot be taken, such as a map element'
+          : 'Give every method of a Go type a value receiver; refuses when a method modifies its receiver or uses it as a pointer',
+      annotations: { readOnlyHint: false },
+      inputSchema: {
+        file_path: z
+          .string()
+          .describe('Path to a Go file in the package declaring the type'),
+        type_name: z.string().describe('Name of the type whose methods change'),
+        dry_run: z
+          .boolean()
+          .optional()
+          .describe(
+            'Preview the changes as a unified diff without modifying files'
+          ),
+        ...buildSchema,
+        ...formatSchema,
+      },
+    },
+    async (
+      {
+        file_path,
+        type_name,
+        dry_run,
+        build_flags,
+        goos,
+        goarch,
+        format,
+      },
+      extra
+    ) => {
+      try {
+        const result = await performConvertReceiver({
+          filePath: file_path,
+          typeName: type_name,
+          receiver,
+          dryRun: dry_run,
+          buildFlags: build_flags,
+          goos,
+          goarch,
+          format,
+          ...taskOptions(extra),
+        });
+
+        return {
+          content: [
+            { type: 'text', text: formatConvertReceiverResults(result) },
+          ],
+        };
+      } catch (error) {
+        return errorResult(`convert to ${receiver} receivers`, error);
+      }
+    }
+  );
+}
+
+registerTool(
+  'add_struct_tags',
+  {
+    title: 'Add Struct Tags',
+    description:
+      'Add or update one key of the struct tags of the exported fields of a Go struct type, naming each after its field; tags for other keys are kept, and fields whose tag for the key is "-" are left alone',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file in the package declaring the type'),
+      type_name: z.string().describe('Name of the struct type'),
+      key: z.string().describe('Tag key to set, such as json, yaml or db'),
+      naming: z
+        .enum(['snake_case', 'camelCase', 'as-is'])
+        .optional()
+        .describe(
+          'How field names become tag names: UserID as user_id, userId or UserID (default: snake_case)'
+        ),
+      omit_empty: z
+        .boolean()
+        .optional()
+        .describe('Add the omitempty option to the tags'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      type_name,
+      key,
+      naming,
+      omit_empty,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performAddStructTags({
+        filePath: file_path,
+        typeName: type_name,
+        key,
+        naming,
+        omitEmpty: omit_empty,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatAddStructTagsResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('add struct tags', error);
+    }
+  }
+);
+
+registerTool(
+  'generate_stringer',
+  {
+    title: 'Generate Stringer',
+    description:
+      'Generate a String method for a Go integer type that returns the name of the package-level constant equal to the value, like the stringer tool; replaces a String method the type already has',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file in the package declaring the type'),
+      type_name: z.string().describe('Name of the integer type'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      type_name,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performGenerateStringer({
+        filePath: file_path,
+        typeName: type_name,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatGenerateStringerResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('generate stringer', error);
+    }
+  }
+);
+
+registerTool(
+  'extract_constant',
+  {
+    title: 'Extract Constant',
+    description:
+      'Declare an untyped Go constant for a literal and replace the literals of the same kind and value in its package or function with it',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to the Go file containing the literal'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the literal within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the literal (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the literal (used with line)'),
+      constant_name: z.string().describe('Name of the new constant'),
+      scope: z
+        .enum(['package', 'function'])
+        .optional()
+        .describe(
+          'Declare the constant at package level and replace the literal throughout the package, or in the enclosing function and replace it there (default: package)'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      constant_name,
+      scope,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performExtractConstant({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        constantName: constant_name,
+        scope,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatExtractConstantResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('extract constant', error);
+    }
+  }
+);
+
+registerTool(
+  'inline_constant',
+  {
+    title: 'Inline Constant',
+    description:
+      'Replace the uses of a Go constant across the module with its expression or value, converted to its type if it is typed, and delete its declaration',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file declaring or using the constant'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the constant name within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the constant name (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the constant name (used with line)'),
+      ...symbolSchema,
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      symbol,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performInlineConstant({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        symbol,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatInlineConstantResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('inline constant', error);
+    }
+  }
+);
+
+registerTool(
+  'split_file',
+  {
+    title: 'Split File',
+    description:
+      'Move several top-level Go declarations of a file, with their doc comments, to other files of the same package in one change, fixing the imports of every file',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to the Go file to split'),
+      targets: z
+        .record(z.string(), z.string())
+        .describe(
+          'Declaration names, with methods as Type.Method, mapped to the file of the package to move each one to, created if missing. Declarations not listed stay'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    { file_path, targets, dry_run, build_flags, goos, goarch, format },
+    extra
+  ) => {
+    try {
+      const result = await performSplitFile({
+        filePath: file_path,
+        targets,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatSplitFileResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('split file', error);
+    }
+  }
+);
+
+registerTool(
+  'find_implementations',
+  {
+    title: 'Find Implementations',
+    description:
+      'List the named Go types of the module that implement the interface at a position, telling apart types whose values implement it from those where only pointers do',
+    annotations: { readOnlyHint: true },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to the Go file containing the interface name'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the interface name within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the interface name (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the interface name (used with line)'),
+      ...symbolSchema,
+      ...buildSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      symbol,
+      build_flags,
+      goos,
+      goarch,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performFindImplementations({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        symbol,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatFindImplementationsResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('find implementations', error);
+    }
+  }
+);
+
+registerTool(
+  'convert_named_returns',
+  {
+    title: 'Convert Named Returns',
+    description:
+      'Give the results of a Go function names, derived from their types unless given, or remove their names, rewriting naked returns to return the result values explicitly; removing is refused where a deferred call may change a result after the return',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to the Go file containing the function'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of a position within the function'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line within the function (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column (used with line)'),
+      mode: z
+        .enum(['name', 'unname'])
+        .describe('Whether to name the results or remove their names'),
+      names: z
+        .array(z.string())
+        .optional()
+        .describe(
+          'Names for the results in order, when naming them (defaults to names derived from the result types, such as err for error)'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      mode,
+      names,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performConvertNamedReturns({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        mode,
+        names,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatConvertNamedReturnsResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('convert named returns', error);
+    }
+  }
+);
+
+registerTool(
+  'list_symbols',
+  {
+    title: 'List Symbols',
+    description:
+      'List the top-level declarations of a Go package with their kind, signature and location, including methods and their receiver types',
+    annotations: { readOnlyHint: true },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Package directory, or a Go file of the package'),
+      include_tests: z
+        .boolean()
+        .optional()
+        .describe('Also list the declarations of the _test.go files'),
+      ...buildSchema,
+    },
+  },
+  async ({ file_path, include_tests, build_flags, goos, goarch }, extra) => {
+    try {
+      const result = await performListSymbols({
+        filePath: file_path,
+        includeTests: include_tests,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatListSymbolsResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('list symbols', error);
+    }
+  }
+);
+
+registerTool(
+  'wrap_error',
+  {
+    title: 'Wrap Error',
+    description:
+      'Wrap the errors a Go function returns unwrapped in fmt.Errorf("<context>: %w", err), with a context derived from the function name or a template, optionally only for errors from calls of given functions; errors created in the function are left alone',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to the Go file containing the function'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of a position within the function'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line within the function (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column (used with line)'),
+      template: z
+        .string()
+        .optional()
+        .describe(
+          'Context of the messages, where {func} is the function name and {call} the called function the error came from (defaults to the words of the function name, such as "load config" for LoadConfig)'
+        ),
+      functions: z
+        .array(z.string())
+        .optional()
+        .describe(
+          'Only wrap errors from calls of these functions, such as Open or os.Open'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      template,
+      functions,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performWrapError({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        template,
+        functions,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatWrapErrorResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('wrap error', error);
+    }
+  }
+);
+
+registerTool(
+  'undo',
+  {
+    title: 'Undo',
+    description: `Revert the files written by the most recent tool call that changed files, restoring their earlier content and deleting the files it created. Each further call undoes the operation before, up to the last ${UNDO_LIMIT}. Fails without changing anything if a file was modified since the operation wrote it`,
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+    },
+  },
+  async ({ dry_run }, extra) => {
+    try {
+      const result = await performUndo({
+        dryRun: dry_run,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatUndoResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('undo', error);
+    }
+  }
+);
+
+registerTool(
+  'convert_func_to_method',
+  {
+    title: 'Convert Function to Method',
+    description:
+      'Turn a Go function into a method on the type of one of its parameters, removing the parameter and rewriting every call from F(x, a) to x.F(a); refuses when the type is declared in another package, since methods can only be declared in the package of their receiver type',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file containing the function or a call to it'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the function name within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the function name (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the function name (used with line)'),
+      ...symbolSchema,
+      parameter: z
+        .number()
+        .describe('0-based index of the parameter that becomes the receiver'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      symbol,
+      parameter,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performConvertFuncToMethod({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        symbol,
+        parameter,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatConvertFuncMethodResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('convert func to method', error);
+    }
+  }
+);
+
+registerTool(
+  'convert_method_to_func',
+  {
+    title: 'Convert Method to Function',
+    description:
+      'Turn a Go method into a function taking the receiver as a parameter, rewriting every call from x.F(a) to F(x, a); refuses when the type needs the method to implement an interface of the module',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file containing the method or a call to it'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the method name within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the method name (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the method name (used with line)'),
+      ...symbolSchema,
+      parameter: z
+        .number()
+        .optional()
+        .describe(
+          '0-based index of the parameter the receiver becomes (defaults to 0, the first)'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      symbol,
+      parameter,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performConvertMethodToFunc({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        symbol,
+        parameter,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatConvertFuncMethodResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('convert method to func', error);
+    }
+  }
+);
+
+registerTool(
+  'group_declarations',
+  {
+    title: 'Group Declarations',
+    description:
+      'Merge adjacent top-level const, var and import declarations of a Go file into parenthesized blocks, keeping their comments and aligning them like gofmt',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Go file whose declarations to group'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    { file_path, dry_run, build_flags, goos, goarch, format },
+    extra
+  ) => {
+    try {
+      const result = await performGroupDeclarations({
+        filePath: file_path,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatGroupDeclarationsResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('group declarations', error);
+    }
+  }
+);
+
+registerTool(
+  'sort_struct_fields',
+  {
+    title: 'Sort Struct Fields',
+    description:
+      'Reorder the fields of a Go struct type alphabetically, exported ones first, or by alignment to reduce padding, moving tags and comments with their fields; refuses when code depends on the field order',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file in the package declaring the type'),
+      type_name: z.string().describe('Name of the struct type'),
+      strategy: z
+        .enum(FIELD_ORDERS)
+        .describe(
+          'alphabetical sorts by name, visibility moves exported fields first, size orders by alignment so the struct needs the least padding'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      type_name,
+      strategy,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performSortStructFields({
+        filePath: file_path,
+        typeName: type_name,
+        strategy,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatSortStructFieldsResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('sort struct fields', error);
+    }
+  }
+);
+
+registerTool(
+  'extract_method',
+  {
+    title: 'Extract Method',
+    description:
+      'Move a range of Go statements into a new method of the receiver of the enclosing method, called on the receiver, when they use it; otherwise extract a function like extract_function',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to the Go file'),
+      start_line: z
+        .number()
+        .describe('First line of the statements (1-based)'),
+      end_line: z
+        .number()
+        .describe('Last line of the statements (1-based, inclusive)'),
+      method_name: z.string().describe('Name of the new method'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      start_line,
+      end_line,
+      method_name,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performExtractMethod({
+        filePath: file_path,
+        startLine: start_line,
+        endLine: end_line,
+        functionName: method_name,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatExtractFunctionResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('extract method', error);
+    }
+  }
+);
+
+registerTool(
+  'replace_loop_with_range',
+  {
+    title: 'Replace Loop with Range',
+    description:
+      'Rewrite a Go loop for i := 0; i < len(s); i++ over a slice or array as for i, v := range s, using v for the reads of s[i] and keeping i only if still used; refuses maps, strings, bodies that assign s or the index, and other index arithmetic',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to the Go file'),
+      line: z
+        .number()
+        .describe('1-based line of the for keyword of the loop'),
+      variable_name: z
+        .string()
+        .optional()
+        .describe(
+          'Name of the value variable replacing s[i] (default v, numbered if taken)'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      line,
+      variable_name,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performReplaceLoopWithRange({
+        filePath: file_path,
+        line,
+        name: variable_name,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatConvertLoopResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('replace loop with range', error);
+    }
+  }
+);
+
+registerTool(
+  'replace_range_with_index',
+  {
+    title: 'Replace Range with Index',
+    description:
+      'Rewrite a Go range loop over a slice or array as for i := 0; i < len(s); i++, declaring the value variable as v := s[i] at the top of the body',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to the Go file'),
+      line: z
+        .number()
+        .describe('1-based line of the for keyword of the loop'),
+      variable_name: z
+        .string()
+        .optional()
+        .describe(
+          'Name of the index variable when the loop has none (default i, numbered if taken)'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      line,
+      variable_name,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performReplaceRangeWithIndex({
+        filePath: file_path,
+        line,
+        name: variable_name,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatConvertLoopResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('replace range with index', error);
+    }
+  }
+);
+
+registerTool(
+  'convert_if_else_to_switch',
+  {
+    title: 'Convert If/Else to Switch',
+    description:
+      'Rewrite a Go if/else if chain whose conditions all compare the same side-effect-free expression with distinct constants, as in x == a || x == b, into a switch on that expression, the final else becoming the default',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to the Go file'),
+      line: z
+        .number()
+        .describe('1-based line of the if keyword of any if of the chain'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    { file_path, line, dry_run, build_flags, goos, goarch, format },
+    extra
+  ) => {
+    try {
+      const result = await performConvertIfElseToSwitch({
+        filePath: file_path,
+        line,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatConvertSwitchResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('convert if/else to switch', error);
+    }
+  }
+);
+
+registerTool(
+  'convert_switch_to_if_else',
+  {
+    title: 'Convert Switch to If/Else',
+    description:
+      'Rewrite a Go expression switch without fallthrough or break into an if/else if chain comparing the tag with the values of each case, the default becoming the final else',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to the Go file'),
+      line: z
+        .number()
+        .describe('1-based line of the switch keyword'),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    { file_path, line, dry_run, build_flags, goos, goarch, format },
+    extra
+  ) => {
+    try {
+      const result = await performConvertSwitchToIfElse({
+        filePath: file_path,
+        line,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatConvertSwitchResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('convert switch to if/else', error);
+    }
+  }
+);
+
+registerTool(
+  'remove_unused',
+  {
+    title: 'Remove Unused',
+    description:
+      'Delete the unused local variables and imports of a Go function and its file, keeping values with effects, and optionally drop its unused parameters from the signature and every call',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to the Go file of the function'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of a position inside the function'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of a position inside the function'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column within the line (used with line)'),
+      ...symbolSchema,
+      remove_parameters: z
+        .boolean()
+        .optional()
+        .describe(
+          'Also remove the unused parameters, unless the function implements an interface or is used as a value'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      symbol,
+      remove_parameters,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performRemoveUnused({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        symbol,
+        removeParameters: remove_parameters,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatRemoveUnusedResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('remove unused code', error);
+    }
+  }
+);
+
+registerTool(
+  'generate_constructor',
+  {
+    title: 'Generate Constructor',
+    description:
+      'Generate a NewT constructor for a Go struct type taking the chosen fields as parameters, in the order of the struct, and returning a pointer to the struct or the struct; replaces a function of the same name the package already declares',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file in the package declaring the type'),
+      type_name: z.string().describe('Name of the struct type'),
+      fields: z
+        .array(z.string())
+        .optional()
+        .describe(
+          'Names of the fields to take as parameters, the others being left zero (default: all fields)'
+        ),
+      form: z
+        .enum(['pointer', 'value'])
+        .optional()
+        .describe(
+          'Return a pointer to the struct or the struct itself (default: pointer)'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      type_name,
+      fields,
+      form,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performGenerateConstructor({
+        filePath: file_path,
+        typeName: type_name,
+        fields,
+        form,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatGenerateConstructorResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('generate constructor', error);
+    }
+  }
+);
+
+registerTool(
+  'deduplicate_functions',
+  {
+    title: 'Deduplicate Functions',
+    description:
+      'Find Go functions whose bodies are the same apart from the names of their parameters and locals, in a package or the whole module, and optionally merge each group of functions with the same signature into one, replacing the references to the others and deleting them',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to a Go file in the package'),
+      scope: z
+        .enum(['package', 'module'])
+        .optional()
+        .describe(
+          'Compare the functions of the package or of every package in its module (default: package)'
+        ),
+      merge: z
+        .boolean()
+        .optional()
+        .describe(
+          'Merge the groups that can be merged instead of only reporting them'
+        ),
+      keep: z
+        .array(z.string())
+        .optional()
+        .describe(
+          'Functions to keep when their group is merged, as Name, pkg.Name or importpath.Name'
+        ),
+      force: z
+        .boolean()
+        .optional()
+        .describe(
+          'Also merge away exported functions, which code outside the module may use'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      scope,
+      merge,
+      keep,
+      force,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performDeduplicateFunctions({
+        filePath: file_path,
+        scope,
+        merge,
+        keep,
+        force,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatDeduplicateFunctionsResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('deduplicate functions', error);
+    }
+  }
+);
+
+registerTool(
+  'reorder_parameters_by_convention',
+  {
+    title: 'Reorder Parameters by Convention',
+    description:
+      'Move the context.Context parameter of every Go function, method and interface method of a package to the front, and optionally the error handlers to the end before a variadic parameter, updating every call in one change; functions whose calls cannot be updated are left alone and reported',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to a Go file in the package'),
+      error_handlers_last: z
+        .boolean()
+        .optional()
+        .describe(
+          'Also move parameters of function types taking an error, such as onErr func(error), to the end'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      error_handlers_last,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performReorderParameters({
+        filePath: file_path,
+        errorHandlersLast: error_handlers_last,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatReorderParametersResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('reorder parameters', error);
+    }
+  }
+);
+
+registerTool(
+  'extract_package',
+  {
+    title: 'Extract Package',
+    description:
+      'Move top-level Go declarations of a package into a new package in another directory of the module, exporting the names used across the new boundary and qualifying every reference with an import of the new package; changes that would create an import cycle are refused',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z.string().describe('Path to a Go file in the package'),
+      declarations: z
+        .array(z.string())
+        .describe(
+          'Names of the declarations to move, with methods as Type.Method. The methods of the types moved go with them'
+        ),
+      destination: z
+        .string()
+        .describe(
+          'Directory of the new package in the module, which must not hold Go files yet'
+        ),
+      package_name: z
+        .string()
+        .optional()
+        .describe(
+          'Name of the new package, by default the last element of its import path'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      declarations,
+      destination,
+      package_name,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performExtractPackage({
+        filePath: file_path,
+        declarations,
+        destination,
+        packageName: package_name,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatExtractPackageResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('extract package', error);
+    }
+  }
+);
+
+registerTool(
+  'compile_check',
+  {
+    title: 'Compile Check',
+    description:
+      'Type-check a Go package, or its whole module, without building or writing anything, and list the errors the go command would report with their file, line and column: syntax errors, undefined names, missing and unused imports, unused variables, and wrong numbers of arguments or results. An empty list means the code checks',
+    annotations: { readOnlyHint: true },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Package directory, or a Go file of the package'),
+      scope: z
+        .enum(['package', 'module'])
+        .optional()
+        .describe(
+          'Check the package with its tests (default), or every package of the module'
+        ),
+      ...buildSchema,
+    },
+  },
+  async ({ file_path, scope, build_flags, goos, goarch }, extra) => {
+    try {
+      const result = await performCompileCheck({
+        filePath: file_path,
+        scope,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatCompileCheckResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('compile check', error);
+    }
+  }
+);
+
+registerTool(
+  'extract_type_alias',
+  {
+    title: 'Extract Type Alias',
+    description:
+      'Declare a name for a Go type expression, as an alias (type Name = T) or a defined type (type Name T), and replace the identical type expressions in its package or function with it. A defined type is a new type, so occurrences where it would change the identity of other types, such as inside other type literals, are kept and listed',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to the Go file containing the type expression'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset within the type expression'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the type expression (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe(
+          '1-based byte column within the type expression (used with line); the innermost type literal there is extracted'
+        ),
+      type_name: z.string().describe('Name of the new type'),
+      kind: z
+        .enum(['alias', 'defined'])
+        .optional()
+        .describe(
+          'Declare an alias, which is the same type, or a defined type, which is a new one (default: alias)'
+        ),
+      scope: z
+        .enum(['package', 'function'])
+        .optional()
+        .describe(
+          'Declare the type at package level and replace the expression throughout the package, or in the enclosing function and replace it there (default: package)'
+        ),
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      type_name,
+      kind,
+      scope,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performExtractTypeAlias({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        typeName: type_name,
+        kind,
+        scope,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatExtractTypeAliasResults(result) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('extract type alias', error);
+    }
+  }
+);
+
+registerTool(
+  'inline_type_alias',
+  {
+    title: 'Inline Type Alias',
+    description:
+      'Replace the uses of a Go type alias or defined type across the module with the type expression it is declared as, and delete its declaration. Inlining an alias never changes a type; a defined type is refused where dropping it would change methods, embedded field names or what type assertions match',
+    annotations: { readOnlyHint: false },
+    inputSchema: {
+      file_path: z
+        .string()
+        .describe('Path to a Go file declaring or using the type'),
+      offset: z
+        .number()
+        .optional()
+        .describe('Byte offset of the type name within the file'),
+      line: z
+        .number()
+        .optional()
+        .describe('1-based line of the type name (used with column)'),
+      column: z
+        .number()
+        .optional()
+        .describe('1-based byte column of the type name (used with line)'),
+      ...symbolSchema,
+      dry_run: z
+        .boolean()
+        .optional()
+        .describe(
+          'Preview the changes as a unified diff without modifying files'
+        ),
+      ...buildSchema,
+      ...formatSchema,
+    },
+  },
+  async (
+    {
+      file_path,
+      offset,
+      line,
+      column,
+      symbol,
+      dry_run,
+      build_flags,
+      goos,
+      goarch,
+      format,
+    },
+    extra
+  ) => {
+    try {
+      const result = await performInlineTypeAlias({
+        filePath: file_path,
+        offset,
+        line,
+        column,
+        symbol,
+        dryRun: dry_run,
+        buildFlags: build_flags,
+        goos,
+        goarch,
+        format,
+        ...taskOptions(extra),
+      });
+
+      return {
+        content: [{ type: 'text', text: formatInlineTypeAliasResults(result) }],
+      };
+    } catch (error) {
+      return errorResult('inline type alias', error);
+    }
+  }
+);
+
+registerTool(
+  'capabilities',
+  {
+    title: 'Capabilities',
+    description:
+      'Report the version of the server, the tools it provides with the JSON Schemas of their parameters, the version of the installed go command, and the Go version of a module with what it allows, such as generics and per-iteration loop variables. The language features follow the go directive of go.mod, which the server reports apart from the installed go command, since it parses and type-checks Go itself. Call it first to find out what the server supports',
+    annotations: { readOnlyHint: true },
+    inputSchema: {
+      file_path: z
+        .string()
+        .optional()
+        .describe(
+          'A file or directory of the module to report the Go version of (defaults to $REFACTOR_MCP_ROOT or the server directory)'
+        ),
+    },
+  },
+  async ({ file_path }) => {
+    try {
+      const tools: ToolCapability[] = registeredTools.map(t => ({
+        ...t,
+        inputSchema: objectSchemaOf(t.inputSchema),
+      }));
+      const result = await performCapabilities({
+        filePath: file_path ?? resourceRoot(),
+        server: SERVER_INFO,
+        tools,
+      });
+
+      return {
+        content: [
+          { type: 'text', text: formatCapabilitiesResults(result) },
+          { type: 'text', text: JSON.stringify(result, null, 2) },
+        ],
+      };
+    } catch (error) {
+      return errorResult('report capabilities', error);
     }
   }
 );
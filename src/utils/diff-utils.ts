@@ -0,0 +1,138 @@
+type DiffOp = { kind: 'equal' | 'delete' | 'insert'; line: string };
+
+// Splits content into lines that keep their terminating newline, so that a
+// final line without one compares unequal to the same text with one.
+function splitLines(content: string): string[] {
+  return content.match(/[^\n]*\n|[^\n]+$/g) ?? [];
+}
+
+// Computes a shortest edit script between two line arrays using Myers'
+// algorithm. Each step d keeps only the diagonals it reads, -d-1 to d+1,
+// so the trace takes O(D^2) memory for D edits rather than O(D(N+M)).
+function diffLines(a: string[], b: string[]): DiffOp[] {
+  const n = a.length;
+  const m = b.length;
+  const max = n + m;
+  const offset = max + 1;
+  const v = new Int32Array(2 * max + 2);
+  // The furthest x on diagonals -d-1 to d+1 before step d, by k + d + 1.
+  const trace: Int32Array[] = [];
+
+  let found = false;
+  for (let d = 0; d <= max && !found; d++) {
+    trace.push(v.slice(offset - d - 1, offset + d + 2));
+    for (let k = -d; k <= d; k += 2) {
+      let x =
+        k === -d || (k !== d && v[offset + k - 1] < v[offset + k + 1])
+          ? v[offset + k + 1]
+          : v[offset + k - 1] + 1;
+      let y = x - k;
+      while (x < n && y < m && a[x] === b[y]) {
+        x++;
+        y++;
+      }
+      v[offset + k] = x;
+      if (x >= n && y >= m) {
+        found = true;
+        break;
+      }
+    }
+  }
+
+  const ops: DiffOp[] = [];
+  let x = n;
+  let y = m;
+  for (let d = trace.length - 1; d >= 0; d--) {
+    const vd = trace[d];
+    const k = x - y;
+    const prevK =
+      k === -d || (k !== d && vd[d + k] < vd[d + k + 2]) ? k + 1 : k - 1;
+    const prevX = vd[d + 1 + prevK];
+    const prevY = prevX - prevK;
+    while (x > prevX && y > prevY) {
+      ops.push({ kind: 'equal', line: a[--x] });
+      y--;
+    }
+    if (d > 0) {
+      if (x === prevX) {
+        ops.push({ kind: 'insert', line: b[--y] });
+      } else {
+        ops.push({ kind: 'delete', line: a[--x] });
+      }
+    }
+  }
+  return ops.reverse();
+}
+
+function hunkRange(start: number, count: number): string {
+  // An empty range is reported at the line before it, as diff -u does.
+  const first = count === 0 ? start : start + 1;
+  return count === 1 ? `${first}` : `${first},${count}`;
+}
+
+// Produces a unified diff (the format of diff -u and git diff) between two
+// versions of a file. Returns an empty string when they are identical.
+export function createUnifiedDiff(
+  filePath: string,
+  oldContent: string,
+  newContent: string,
+  contextLines = 3
+): string {
+  if (oldContent === newContent) return '';
+
+  const oldLines = splitLines(oldContent);
+  const newLines = splitLines(newContent);
+  const ops = diffLines(oldLines, newLines);
+
+  // Line indices of each op in the old and new files.
+  const positions: { oldIndex: number; newIndex: number }[] = [];
+  let oldIndex = 0;
+  let newIndex = 0;
+  for (const op of ops) {
+    positions.push({ oldIndex, newIndex });
+    if (op.kind !== 'insert') oldIndex++;
+    if (op.kind !== 'delete') newIndex++;
+  }
+
+  const output: string[] = [`--- a/${filePath}`, `+++ b/${filePath}`];
+  let i = 0;
+  while (i < ops.length) {
+    while (i < ops.length && ops[i].kind === 'equal') i++;
+    if (i >= ops.length) break;
+
+    const start = Math.max(0, i - contextLines);
+    let end = i;
+    // Extend the hunk while changes are separated by at most twice the
+    // context size.
+    for (;;) {
+      while (end < ops.length && ops[end].kind !== 'equal') end++;
+      let next = end;
+      while (next < ops.length && ops[next].kind === 'equal') next++;
+      if (next < ops.length && next - end <= contextLines * 2) {
+        end = next;
+        continue;
+      }
+      end = Math.min(ops.length, end + contextLines);
+      break;
+    }
+
+    const hunk = ops.slice(start, end);
+    const oldCount = hunk.filter(op => op.kind !== 'insert').length;
+    const newCount = hunk.filter(op => op.kind !== 'delete').length;
+    output.push(
+      `@@ -${hunkRange(positions[start].oldIndex, oldCount)} +${hunkRange(positions[start].newIndex, newCount)} @@`
+    );
+    for (const op of hunk) {
+      const prefix =
+        op.kind === 'equal' ? ' ' : op.kind === 'delete' ? '-' : '+';
+      if (op.line.endsWith('\n')) {
+        output.push(prefix + op.line.slice(0, -1));
+      } else {
+        output.push(prefix + op.line, '\\ No newline at end of file');
+      }
+    }
+    i = end;
+  }
+
+  return output.join('\n') + '\n';
+}
@@ -0,0 +1,122 @@
+import { existsSync } from 'fs';
+import { resolve } from 'path';
+import { writeFilesAtomically, displayPath } from './file-utils.js';
+import { createUnifiedDiff } from './diff-utils.js';
+import { defaultGoFormat, formatGoSource } from './go-format.js';
+import type { GoFormat } from './go-format.js';
+import { checkpoint } from './task.js';
+import type { TaskOptions } from './task.js';
+import { ToolError } from './tool-error.js';
+import { recordOperation } from './undo-history.js';
+
+// A replacement of the text between two string indices.
+export interface TextEdit {
+  pos: number;
+  end: number;
+  newText: string;
+}
+
+// The complete before and after content of a file touched by a refactoring.
+export interface FileChange {
+  filePath: string;
+  original: string;
+  updated: string;
+}
+
+// How a tool writes the files it changes.
+export interface WriteOptions extends TaskOptions {
+  // How the Go files are formatted; defaults to the server's format.
+  format?: GoFormat;
+  // Directories created for the files, the innermost first, which undoing
+  // the call deletes again.
+  createdDirs?: string[];
+}
+
+// Applies non-overlapping edits to content. Edits may be given in any
+// order; insertions at the same position keep their relative order.
+export function applyTextEdits(content: string, edits: TextEdit[]): string {
+  const sorted = edits
+    .map((edit, index) => ({ edit, index }))
+    .sort((a, b) => a.edit.pos - b.edit.pos || a.index - b.index)
+    .map(({ edit }) => edit);
+
+  let result = '';
+  let last = 0;
+  for (const edit of sorted) {
+    if (edit.pos < last) {
+      throw new ToolError(
+        'internal_error',
+        `Overlapping edits at ${edit.pos}-${edit.end} and before ${last}`
+      );
+    }
+    result += content.substring(last, edit.pos) + edit.newText;
+    last = edit.end;
+  }
+  return result + content.substring(last);
+}
+
+// Writes every changed file to disk unless dryRun is set. Either way the
+// same changes are returned, so a preview always matches the real run. The
+// files are written all or nothing: when one of them cannot be written, the
+// others are left as they were. A task cancelled before the writes start
+// changes no file; once started, the writes complete and each file is
+// reported to task.onProgress. Written changes are recorded so that the
+// undo tool can revert them. Go files are formatted as task.format asks
+// before they are compared and written.
+export async function commitFileChanges(
+  changes: FileChange[],
+  dryRun = false,
+  task: WriteOptions = {}
+): Promise<FileChange[]> {
+  const format = task.format ?? defaultGoFormat();
+  const effective = changes
+    .map(c =>
+      c.filePath.endsWith('.go')
+        ? { ...c, updated: formatGoSource(c.filePath, c.updated, format) }
+        : c
+    )
+    .filter(c => c.original !== c.updated);
+  if (!dryRun) {
+    await checkpoint(task.signal);
+    const snapshots = effective.map(c => ({
+      filePath: resolve(c.filePath),
+      before: existsSync(c.filePath) ? c.original : undefined,
+      after: c.updated,
+    }));
+    writeFilesAtomically(
+      effective.map(c => ({ filePath: c.filePath, content: c.updated })),
+      task.onProgress
+    );
+    recordOperation(snapshots, task.createdDirs?.map(dir => resolve(dir)));
+  }
+  return effective;
+}
+
+export function createFileDiff(change: FileChange): string {
+  return createUnifiedDiff(
+    displayPath(change.filePath),
+    change.original,
+    change.updated
+  );
+}
+
+// Formats the unified diff of each change followed by a summary line.
+export function formatDryRunDiff(changes: FileChange[]): string {
+  if (changes.length === 0) {
+    return 'Dry run: no files would be changed';
+  }
+  const diffs = changes.map(createFileDiff).join('');
+  return `${diffs}\nDry run: ${changes.length} ${changes.length === 1 ? 'file' : 'files'} would be changed`;
+}
+
+// Describes the outcome of a refactoring: the preview diff for a dry run,
+// otherwise the list of files that were written.
+export function formatFileChanges(
+  changes: FileChange[],
+  dryRun = false
+): string {
+  if (dryRun) return formatDryRunDiff(changes);
+  if (changes.length === 0) return 'No files were changed';
+  const files = changes.map(c => `  ${displayPath(c.filePath)}`);
+  return `Modified ${changes.length} ${changes.length === 1 ? 'file' : 'files'}:\n${files.join('\n')}`;
+}
@@ -1,5 +1,24 @@
-import { readFileSync, writeFileSync, existsSync, statSync } from 'fs';
+import {
+  readFileSync,
+  writeFileSync,
+  existsSync,
+  statSync,
+  chmodSync,
+  realpathSync,
+  renameSync,
+  rmSync,
+} from 'fs';
+import {
+  basename,
+  dirname,
+  isAbsolute,
+  join,
+  relative,
+  resolve,
+} from 'path';
 import { glob } from 'glob';
+import type { ProgressReporter } from './task.js';
+import { ToolError } from './tool-error.js';
 
 export async function searchFiles(filePattern?: string): Promise<string[]> {
   if (!filePattern) {
@@ -35,7 +54,11 @@ export function readFileContent(filePath: string): string {
   try {
     return readFileSync(filePath, 'utf-8');
   } catch (error) {
-    throw new Error(`Failed to read file ${filePath}: ${error}`);
+    throw new ToolError(
+      (error as NodeJS.ErrnoException).code === 'ENOENT'
+        ? 'file_not_found'
+        : 'io_error',
+      `Failed to read file ${filePath}: ${error}`);
   }
 }
 
@@ -43,6 +66,135 @@ export function writeFileContent(filePath: string, content: string): void {
   try {
     writeFileSync(filePath, content, 'utf-8');
   } catch (error) {
-    throw new Error(`Failed to write file ${filePath}: ${error}`);
+    throw new ToolError(
+      'io_error',
+      `Failed to write file ${filePath}: ${error}`
+    );
   }
 }
+
+// What a tool did to a file it wrote or deleted.
+export interface FileEvent {
+  // Absolute path of the file.
+  filePath: string;
+  kind: 'created' | 'changed' | 'removed';
+}
+
+type FileListener = (events: FileEvent[]) => void;
+
+const fileListeners: FileListener[] = [];
+
+// Registers a listener that is told of the files every successful write
+// of the tools created, changed or removed, such as the server keeping
+// the clients subscribed to their resources up to date.
+export function onFilesChanged(listener: FileListener): void {
+  fileListeners.push(listener);
+}
+
+// Tells the listeners of files written or deleted other than through
+// writeFilesAtomically, which reports its own.
+export function notifyFilesChanged(events: FileEvent[]): void {
+  if (events.length === 0) return;
+  const resolved = events.map(e => ({ ...e, filePath: resolve(e.filePath) }));
+  for (const listener of fileListeners) listener(resolved);
+}
+
+export interface FileWrite {
+  filePath: string;
+  content: string;
+}
+
+interface StagedWrite {
+  filePath: string;
+  target: string;
+  temp: string;
+  // The previous content of the target, or undefined for a new file.
+  backup?: Buffer;
+}
+
+// Writes several files as a single transaction. Every content is first
+// written to a temporary file beside its target, and the temporaries are
+// renamed into place only once all of them were written. If any step fails,
+// the files replaced so far are restored and the error names the file that
+// failed, so the files end up either all written or all untouched.
+export function writeFilesAtomically(
+  files: FileWrite[],
+  onProgress?: ProgressReporter
+): void {
+  const staged: StagedWrite[] = [];
+  const discard = (writes: StagedWrite[]) => {
+    for (const write of writes) rmSync(write.temp, { force: true });
+  };
+
+  for (const [index, { filePath, content }] of files.entries()) {
+    onProgress?.(`Writing files (${index + 1}/${files.length})`);
+    try {
+      // Symbolic links are kept by replacing the file they point to.
+      const exists = existsSync(filePath);
+      const target = exists ? realpathSync(filePath) : filePath;
+      const temp = join(
+        dirname(target),
+        `.${basename(target)}.${process.pid}.tmp`
+      );
+      const stat = exists ? statSync(target) : undefined;
+      const backup = stat?.isFile() ? readFileSync(target) : undefined;
+      writeFileSync(temp, content, 'utf-8');
+      staged.push({ filePath, target, temp, backup });
+      if (stat?.isFile()) chmodSync(temp, stat.mode);
+    } catch (error) {
+      discard(staged);
+      throw new ToolError(
+        'io_error',
+        `Failed to write file ${filePath}: ${error}. No files were changed`
+      );
+    }
+  }
+
+  for (let i = 0; i < staged.length; i++) {
+    try {
+      renameSync(staged[i].temp, staged[i].target);
+    } catch (error) {
+      discard(staged.slice(i));
+      const unrestored = restoreFiles(staged.slice(0, i));
+      const outcome =
+        unrestored.length === 0
+          ? 'All changes were rolled back'
+          : `Could not restore ${unrestored.join(', ')}`;
+      throw new ToolError(
+        'io_error',
+        `Failed to write file ${staged[i].filePath}: ${error}. ${outcome}`
+      );
+    }
+  }
+  notifyFilesChanged(
+    staged.map(write => ({
+      filePath: write.filePath,
+      kind: write.backup ? 'changed' : 'created',
+    }))
+  );
+}
+
+// Puts back the previous content of files that were already replaced, and
+// returns the paths that could not be restored.
+function restoreFiles(writes: StagedWrite[]): string[] {
+  const failed: string[] = [];
+  for (const write of writes) {
+    try {
+      if (write.backup) {
+        writeFileSync(write.target, write.backup);
+      } else {
+        rmSync(write.target, { force: true });
+      }
+    } catch {
+      failed.push(write.filePath);
+    }
+  }
+  return failed;
+}
+
+// Formats a path relative to the working directory when it lies inside it,
+// matching how the search tools report files.
+export function displayPath(filePath: string): string {
+  const rel = relative(process.cwd(), filePath);
+  return rel && !rel.startsWith('..') && !isAbsolute(rel) ? rel : filePath;
+}
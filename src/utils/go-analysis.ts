@@ -0,0 +1,327 @@
+// Analyses of checked Go code shared by the refactoring tools.
+
+import type {
+  BlockStmt,
+  CaseClause,
+  CommClause,
+  Expr,
+  Ident,
+  Node,
+  Stmt,
+} from './go-ast.js';
+import { inspect, pathEnclosingInterval, unparen } from './go-ast.js';
+import type { GoInfo } from './go-checker.js';
+import type { GoProgram } from './go-loader.js';
+import {
+  INVALID,
+  identical,
+  implementsInterface,
+  sameObject,
+  under,
+} from './go-types.js';
+import type {
+  GoObject,
+  GoSourceFile,
+  NamedType,
+  Scope,
+} from './go-types.js';
+
+// Reports whether obj is declared inside a function.
+export function isLocal(obj: GoObject): boolean {
+  return obj.parent?.kind === 'func' || obj.parent?.kind === 'block';
+}
+
+// Returns the variable an assignment to e modifies, if e denotes (part of)
+// a variable rather than memory reached through a pointer, slice or map.
+export function modifiedVariable(info: GoInfo, e: Expr): Ident | undefined {
+  e = unparen(e);
+  switch (e.type) {
+    case 'Ident':
+      return e;
+    case 'SelectorExpr': {
+      const sel = info.selections.get(e);
+      if (!sel || sel.kind !== 'field' || sel.indirect) return undefined;
+      const t = info.typeOf(e.x);
+      if (!t || under(t).kind === 'pointer') return undefined;
+      return modifiedVariable(info, e.x);
+    }
+    case 'IndexExpr': {
+      const t = info.typeOf(e.x);
+      if (!t || under(t).kind !== 'array') return undefined;
+      return modifiedVariable(info, e.x);
+    }
+  }
+  return undefined;
+}
+
+// Reports whether the address of e may be taken: e is a variable, a field
+// of an addressable struct or reached through a pointer, an element of a
+// slice or of an addressable array, or a pointer indirection.
+export function isAddressable(info: GoInfo, e: Expr): boolean {
+  e = unparen(e);
+  switch (e.type) {
+    case 'Ident':
+      return info.objectOf(e)?.kind === 'var';
+    case 'StarExpr':
+      return true;
+    case 'SelectorExpr': {
+      const sel = info.selections.get(e);
+      // A variable of another package.
+      if (!sel) return info.uses.get(e.sel)?.kind === 'var';
+      if (sel.kind !== 'field') return false;
+      return sel.indirect || isAddressable(info, e.x);
+    }
+    case 'IndexExpr': {
+      const t = info.typeOf(e.x);
+      const u = t && under(t);
+      if (u?.kind === 'slice') return true;
+      if (u?.kind === 'pointer') return under(u.elem).kind === 'array';
+      return u?.kind === 'array' && isAddressable(info, e.x);
+    }
+  }
+  return false;
+}
+
+export interface Writes {
+  // Identifiers whose variables may be modified.
+  modified: Set<Ident>;
+  // Identifiers that are overwritten as a whole without being read.
+  overwritten: Set<Ident>;
+  // Identifiers whose variables have their address taken, explicitly or
+  // by a pointer method call or by slicing an array.
+  addressed: Set<Ident>;
+}
+
+export function collectWrites(info: GoInfo, nodes: Node[]): Writes {
+  const writes: Writes = {
+    modified: new Set(),
+    overwritten: new Set(),
+    addressed: new Set(),
+  };
+  const modify = (e: Expr | undefined, whole: boolean, address = false) => {
+    if (!e) return;
+    const id = modifiedVariable(info, e);
+    if (!id) return;
+    writes.modified.add(id);
+    if (whole && unparen(e) === id) writes.overwritten.add(id);
+    if (address) writes.addressed.add(id);
+  };
+  for (const node of nodes) {
+    inspect(node, n => {
+      switch (n.type) {
+        case 'AssignStmt':
+          for (const lhs of n.lhs) {
+            modify(lhs, n.tok === '=' || n.tok === ':=');
+          }
+          break;
+        case 'IncDecStmt':
+          modify(n.x, false);
+          break;
+        case 'RangeStmt':
+          if (n.tok === '=') {
+            modify(n.key, true);
+            modify(n.value, true);
+          }
+          break;
+        case 'UnaryExpr':
+          if (n.op === '&') modify(n.x, false, true);
+          break;
+        case 'SliceExpr': {
+          const t = info.typeOf(n.x);
+          if (t && under(t).kind === 'array') modify(n.x, false, true);
+          break;
+        }
+        case 'SelectorExpr': {
+          // Calling a pointer method on an addressable value takes its
+          // address implicitly.
+          const sel = info.selections.get(n);
+          const t = info.typeOf(n.x);
+          if (
+            sel?.kind === 'method' &&
+            sel.obj.pointerRecv &&
+            t &&
+            t.kind !== 'pointer'
+          ) {
+            modify(n.x, false, true);
+          }
+          break;
+        }
+      }
+    });
+  }
+  return writes;
+}
+
+// Reports whether evaluating e has no effects, so that it may be dropped.
+export function isPure(info: GoInfo, e: Expr): boolean {
+  e = unparen(e);
+  switch (e.type) {
+    case 'Ident':
+    case 'BasicLit':
+    case 'FuncLit':
+      return true;
+    case 'SelectorExpr':
+    case 'StarExpr':
+      return isPure(info, e.x);
+    case 'UnaryExpr':
+      return e.op !== '<-' && isPure(info, e.x);
+    case 'BinaryExpr':
+      return isPure(info, e.x) && isPure(info, e.y);
+    case 'KeyValueExpr':
+      return isPure(info, e.key) && isPure(info, e.value);
+    case 'CompositeLit':
+      return e.elts.every(elt => isPure(info, elt));
+    case 'IndexExpr':
+      return isPure(info, e.x) && e.indices.every(i => isPure(info, i));
+    case 'CallExpr': {
+      const mode = info.types.get(e.fun)?.mode;
+      const fun = unparen(e.fun);
+      const pureBuiltin =
+        mode === 'builtin' &&
+        fun.type === 'Ident' &&
+        ['len', 'cap', 'complex', 'real', 'imag'].includes(fun.name);
+      return (
+        (mode === 'type' || pureBuiltin) &&
+        e.args.every(arg => isPure(info, arg))
+      );
+    }
+  }
+  return false;
+}
+
+// A list of statements: a block, or the body of a case or select clause.
+export type StmtList = BlockStmt | CaseClause | CommClause;
+
+export function statementsOf(n: StmtList): Stmt[] {
+  return n.type === 'BlockStmt' ? n.list : n.body;
+}
+
+// Returns the innermost scope enclosing the end of path.
+export function scopeAt(info: GoInfo, path: Node[]): Scope | undefined {
+  for (let i = path.length - 1; i >= 0; i--) {
+    const scope = info.scopes.get(path[i]);
+    if (scope) return scope;
+  }
+  return undefined;
+}
+
+// Returns where the scope of a local obj begins: variables become visible
+// after the statement declaring them, other names at their identifier.
+export function scopeStart(obj: GoObject): number {
+  const decl = obj.decl;
+  return obj.kind === 'var' &&
+    (decl?.type === 'AssignStmt' || decl?.type === 'ValueSpec')
+    ? decl.end
+    : obj.pos;
+}
+
+// Returns the object named name that scope declares at pos. Function and
+// block scopes only declare their names from the declaration onwards.
+export function declaredAt(
+  scope: Scope,
+  name: string,
+  pos: number
+): GoObject | undefined {
+  const obj = scope.lookup(name);
+  if (!obj) return undefined;
+  const local = scope.kind === 'func' || scope.kind === 'block';
+  return local && scopeStart(obj) > pos ? undefined : obj;
+}
+
+// Returns the object that name refers to at pos in scope.
+export function resolveAt(
+  scope: Scope | undefined,
+  name: string,
+  pos: number
+): GoObject | undefined {
+  for (let s = scope; s; s = s.parent) {
+    const obj = declaredAt(s, name, pos);
+    if (obj) return obj;
+  }
+  return undefined;
+}
+
+// Returns the object that name refers to at pos in file, if any.
+export function lookupAt(
+  info: GoInfo,
+  file: GoSourceFile,
+  pos: number,
+  name: string
+): GoObject | undefined {
+  const path = pathEnclosingInterval(file.ast, pos, pos);
+  return resolveAt(scopeAt(info, path), name, pos);
+}
+
+// Returns the identifiers of e that are looked up in scopes.
+export function freeIdents(info: GoInfo, e: Expr): Ident[] {
+  const free: Ident[] = [];
+  const visit = (n: Node): boolean | void => {
+    if (n.type === 'SelectorExpr') {
+      inspect(n.x, visit);
+      return false;
+    }
+    if (n.type === 'Ident' && info.uses.get(n)) free.push(n);
+  };
+  inspect(e, visit);
+  return free;
+}
+
+// Returns the defined types declared at package level in the module.
+export function namedTypes(program: GoProgram): NamedType[] {
+  const types: NamedType[] = [];
+  for (const pkg of program.packages) {
+    for (const obj of pkg.scope?.names.values() ?? []) {
+      if (obj.kind === 'type' && !obj.isAlias && obj.type?.kind === 'named') {
+        types.push(obj.type);
+      }
+    }
+  }
+  return types;
+}
+
+// Returns obj together with the methods whose signature must change with
+// it: the methods of interfaces in the module that obj's type implements,
+// and the methods of every type implementing those interfaces in turn.
+export function relatedMethods(program: GoProgram, obj: GoObject): GoObject[] {
+  if (!obj.recv) return [obj];
+  const types = namedTypes(program);
+  const sig = obj.type ?? INVALID;
+  const result = [obj];
+  const work = [obj];
+  while (work.length > 0) {
+    const m = work.pop()!;
+    const recv = m.recv?.type;
+    if (!recv) continue;
+    const inInterface = m.decl?.type === 'Field';
+    const found: GoObject[] = [];
+    for (const t of types) {
+      const u = under(t);
+      if (inInterface) {
+        const own = t.obj.methods?.find(x => x.name === obj.name);
+        if (own && implementsInterface(t, recv, true).ok) found.push(own);
+      } else if (u.kind === 'interface') {
+        const own = u.methods.find(
+          x => x.name === obj.name && identical(x.type ?? INVALID, sig)
+        );
+        if (own && implementsInterface(recv, t, true).ok) found.push(own);
+      }
+    }
+    for (const f of found) {
+      if (!result.some(r => sameObject(r, f))) {
+        result.push(f);
+        work.push(f);
+      }
+    }
+  }
+  return result;
+}
+
+// Reports whether code in the package from may import the package to,
+// which internal directories restrict to the tree of their parent.
+export function internalVisible(from: string, to: string): boolean {
+  const parts = to.split('/');
+  const i = parts.lastIndexOf('internal');
+  if (i < 0) return true;
+  const parent = parts.slice(0, i).join('/');
+  return parent === '' || from === parent || from.startsWith(`${parent}/`);
+}
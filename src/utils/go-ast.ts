@@ -0,0 +1,676 @@
+// Syntax tree node definitions for Go source files. The node shapes mirror
+// go/ast so that the analysis code reads like its Go counterpart. All
+// positions are string indices into the file content.
+
+export interface Comment {
+  text: string;
+  pos: number;
+  end: number;
+}
+
+export interface CommentGroup {
+  list: Comment[];
+  pos: number;
+  end: number;
+}
+
+interface NodeBase {
+  pos: number;
+  end: number;
+}
+
+// ----------------------------------------------------------------------------
+// Expressions and types
+
+export interface Ident extends NodeBase {
+  type: 'Ident';
+  name: string;
+}
+
+export interface BasicLit extends NodeBase {
+  type: 'BasicLit';
+  kind: 'INT' | 'FLOAT' | 'IMAG' | 'CHAR' | 'STRING';
+  value: string;
+}
+
+export interface Ellipsis extends NodeBase {
+  type: 'Ellipsis';
+  elt?: Expr;
+}
+
+export interface FuncLit extends NodeBase {
+  type: 'FuncLit';
+  funcType: FuncType;
+  body: BlockStmt;
+}
+
+export interface CompositeLit extends NodeBase {
+  type: 'CompositeLit';
+  litType?: Expr;
+  elts: Expr[];
+  lbrace: number;
+}
+
+export interface ParenExpr extends NodeBase {
+  type: 'ParenExpr';
+  x: Expr;
+}
+
+export interface SelectorExpr extends NodeBase {
+  type: 'SelectorExpr';
+  x: Expr;
+  sel: Ident;
+}
+
+export interface IndexExpr extends NodeBase {
+  type: 'IndexExpr';
+  x: Expr;
+  indices: Expr[];
+}
+
+export interface SliceExpr extends NodeBase {
+  type: 'SliceExpr';
+  x: Expr;
+  low?: Expr;
+  high?: Expr;
+  max?: Expr;
+}
+
+export interface TypeAssertExpr extends NodeBase {
+  type: 'TypeAssertExpr';
+  x: Expr;
+  // Undefined for the x.(type) form used in type switches.
+  assertType?: Expr;
+}
+
+export interface CallExpr extends NodeBase {
+  type: 'CallExpr';
+  fun: Expr;
+  args: Expr[];
+  lparen: number;
+  ellipsis?: number;
+}
+
+export interface StarExpr extends NodeBase {
+  type: 'StarExpr';
+  x: Expr;
+}
+
+export interface UnaryExpr extends NodeBase {
+  type: 'UnaryExpr';
+  op: string;
+  x: Expr;
+}
+
+export interface BinaryExpr extends NodeBase {
+  type: 'BinaryExpr';
+  op: string;
+  x: Expr;
+  y: Expr;
+}
+
+export interface KeyValueExpr extends NodeBase {
+  type: 'KeyValueExpr';
+  key: Expr;
+  value: Expr;
+}
+
+export interface ArrayType extends NodeBase {
+  type: 'ArrayType';
+  // Undefined for slice types; an Ellipsis for [...]T array literals.
+  len?: Expr;
+  elt: Expr;
+}
+
+export interface StructType extends NodeBase {
+  type: 'StructType';
+  fields: FieldList;
+}
+
+export interface FuncType extends NodeBase {
+  type: 'FuncType';
+  typeParams?: FieldList;
+  params: FieldList;
+  results?: FieldList;
+}
+
+export interface InterfaceType extends NodeBase {
+  type: 'InterfaceType';
+  methods: FieldList;
+}
+
+export interface MapType extends NodeBase {
+  type: 'MapType';
+  key: Expr;
+  value: Expr;
+}
+
+export interface ChanType extends NodeBase {
+  type: 'ChanType';
+  dir: 'both' | 'send' | 'recv';
+  value: Expr;
+}
+
+export interface BadExpr extends NodeBase {
+  type: 'BadExpr';
+}
+
+export type Expr =
+  | Ident
+  | BasicLit
+  | Ellipsis
+  | FuncLit
+  | CompositeLit
+  | ParenExpr
+  | SelectorExpr
+  | IndexExpr
+  | SliceExpr
+  | TypeAssertExpr
+  | CallExpr
+  | StarExpr
+  | UnaryExpr
+  | BinaryExpr
+  | KeyValueExpr
+  | ArrayType
+  | StructType
+  | FuncType
+  | InterfaceType
+  | MapType
+  | ChanType
+  | BadExpr;
+
+export interface Field extends NodeBase {
+  type: 'Field';
+  doc?: CommentGroup;
+  names: Ident[];
+  // Undefined only for type-union terms inside interfaces that were
+  // absorbed into fieldType; always set otherwise.
+  fieldType: Expr;
+  tag?: BasicLit;
+  comment?: CommentGroup;
+}
+
+export interface FieldList extends NodeBase {
+  type: 'FieldList';
+  // Position of the opening delimiter, or -1 when there is none (a single
+  // unparenthesized result type).
+  opening: number;
+  list: Field[];
+}
+
+// ----------------------------------------------------------------------------
+// Statements
+
+export interface BadStmt extends NodeBase {
+  type: 'BadStmt';
+}
+
+export interface DeclStmt extends NodeBase {
+  type: 'DeclStmt';
+  decl: GenDecl;
+}
+
+export interface EmptyStmt extends NodeBase {
+  type: 'EmptyStmt';
+  implicit: boolean;
+}
+
+export interface LabeledStmt extends NodeBase {
+  type: 'LabeledStmt';
+  label: Ident;
+  stmt: Stmt;
+}
+
+export interface ExprStmt extends NodeBase {
+  type: 'ExprStmt';
+  x: Expr;
+}
+
+export interface SendStmt extends NodeBase {
+  type: 'SendStmt';
+  chan: Expr;
+  value: Expr;
+}
+
+export interface IncDecStmt extends NodeBase {
+  type: 'IncDecStmt';
+  x: Expr;
+  tok: '++' | '--';
+}
+
+export interface AssignStmt extends NodeBase {
+  type: 'AssignStmt';
+  lhs: Expr[];
+  tok: string;
+  tokPos: number;
+  rhs: Expr[];
+}
+
+export interface GoStmt extends NodeBase {
+  type: 'GoStmt';
+  call: Expr;
+}
+
+export interface DeferStmt extends NodeBase {
+  type: 'DeferStmt';
+  call: Expr;
+}
+
+export interface ReturnStmt extends NodeBase {
+  type: 'ReturnStmt';
+  results: Expr[];
+}
+
+export interface BranchStmt extends NodeBase {
+  type: 'BranchStmt';
+  tok: 'break' | 'continue' | 'goto' | 'fallthrough';
+  label?: Ident;
+}
+
+export interface BlockStmt extends NodeBase {
+  type: 'BlockStmt';
+  list: Stmt[];
+  lbrace: number;
+  rbrace: number;
+}
+
+export interface IfStmt extends NodeBase {
+  type: 'IfStmt';
+  init?: Stmt;
+  cond: Expr;
+  body: BlockStmt;
+  else?: Stmt;
+}
+
+export interface CaseClause extends NodeBase {
+  type: 'CaseClause';
+  // Undefined for the default clause.
+  list?: Expr[];
+  colon: number;
+  body: Stmt[];
+}
+
+export interface SwitchStmt extends NodeBase {
+  type: 'SwitchStmt';
+  init?: Stmt;
+  tag?: Expr;
+  body: BlockStmt;
+}
+
+export interface TypeSwitchStmt extends NodeBase {
+  type: 'TypeSwitchStmt';
+  init?: Stmt;
+  // Either an ExprStmt holding x.(type) or an AssignStmt v := x.(type).
+  assign: Stmt;
+  body: BlockStmt;
+}
+
+export interface CommClause extends NodeBase {
+  type: 'CommClause';
+  // Undefined for the default clause.
+  comm?: Stmt;
+  colon: number;
+  body: Stmt[];
+}
+
+export interface SelectStmt extends NodeBase {
+  type: 'SelectStmt';
+  body: BlockStmt;
+}
+
+export interface ForStmt extends NodeBase {
+  type: 'ForStmt';
+  init?: Stmt;
+  cond?: Expr;
+  post?: Stmt;
+  body: BlockStmt;
+}
+
+export interface RangeStmt extends NodeBase {
+  type: 'RangeStmt';
+  key?: Expr;
+  value?: Expr;
+  tok?: ':=' | '=';
+  x: Expr;
+  body: BlockStmt;
+}
+
+export type Stmt =
+  | BadStmt
+  | DeclStmt
+  | EmptyStmt
+  | LabeledStmt
+  | ExprStmt
+  | SendStmt
+  | IncDecStmt
+  | AssignStmt
+  | GoStmt
+  | DeferStmt
+  | ReturnStmt
+  | BranchStmt
+  | BlockStmt
+  | IfStmt
+  | CaseClause
+  | SwitchStmt
+  | TypeSwitchStmt
+  | CommClause
+  | SelectStmt
+  | ForStmt
+  | RangeStmt;
+
+// ----------------------------------------------------------------------------
+// Declarations
+
+export interface ImportSpec extends NodeBase {
+  type: 'ImportSpec';
+  doc?: CommentGroup;
+  name?: Ident;
+  path: BasicLit;
+  comment?: CommentGroup;
+}
+
+export interface ValueSpec extends NodeBase {
+  type: 'ValueSpec';
+  doc?: CommentGroup;
+  names: Ident[];
+  valueType?: Expr;
+  values: Expr[];
+  comment?: CommentGroup;
+  // Index of the spec within its const group, used to evaluate iota.
+  iota: number;
+}
+
+export interface TypeSpec extends NodeBase {
+  type: 'TypeSpec';
+  doc?: CommentGroup;
+  name: Ident;
+  typeParams?: FieldList;
+  assign: boolean;
+  specType: Expr;
+  comment?: CommentGroup;
+}
+
+export type Spec = ImportSpec | ValueSpec | TypeSpec;
+
+export interface GenDecl extends NodeBase {
+  type: 'GenDecl';
+  doc?: CommentGroup;
+  tok: 'import' | 'const' | 'type' | 'var';
+  // Position of the opening parenthesis, or -1 for an ungrouped decl.
+  lparen: number;
+  rparen: number;
+  specs: Spec[];
+}
+
+export interface FuncDecl extends NodeBase {
+  type: 'FuncDecl';
+  doc?: CommentGroup;
+  recv?: FieldList;
+  name: Ident;
+  funcType: FuncType;
+  body?: BlockStmt;
+}
+
+export interface BadDecl extends NodeBase {
+  type: 'BadDecl';
+}
+
+export type Decl = GenDecl | FuncDecl | BadDecl;
+
+export interface File extends NodeBase {
+  type: 'File';
+  doc?: CommentGroup;
+  // Position of the package keyword.
+  packagePos: number;
+  name: Ident;
+  decls: Decl[];
+  imports: ImportSpec[];
+  comments: CommentGroup[];
+}
+
+export type Node =
+  | Expr
+  | Stmt
+  | Spec
+  | Decl
+  | Field
+  | FieldList
+  | File;
+
+// Returns the child nodes of n in source order.
+export function children(n: Node): Node[] {
+  const out: Node[] = [];
+  const add = (c: Node | undefined) => {
+    if (c) out.push(c);
+  };
+  const addAll = (cs: readonly Node[] | undefined) => {
+    if (cs) out.push(...cs);
+  };
+
+  switch (n.type) {
+    case 'Ident':
+    case 'BasicLit':
+    case 'BadExpr':
+    case 'BadStmt':
+    case 'BadDecl':
+    case 'EmptyStmt':
+      break;
+    case 'Ellipsis':
+      add(n.elt);
+      break;
+    case 'FuncLit':
+      add(n.funcType);
+      add(n.body);
+      break;
+    case 'CompositeLit':
+      add(n.litType);
+      addAll(n.elts);
+      break;
+    case 'ParenExpr':
+      add(n.x);
+      break;
+    case 'SelectorExpr':
+      add(n.x);
+      add(n.sel);
+      break;
+    case 'IndexExpr':
+      add(n.x);
+      addAll(n.indices);
+      break;
+    case 'SliceExpr':
+      add(n.x);
+      add(n.low);
+      add(n.high);
+      add(n.max);
+      break;
+    case 'TypeAssertExpr':
+      add(n.x);
+      add(n.assertType);
+      break;
+    case 'CallExpr':
+      add(n.fun);
+      addAll(n.args);
+      break;
+    case 'StarExpr':
+    case 'UnaryExpr':
+      add(n.x);
+      break;
+    case 'BinaryExpr':
+      add(n.x);
+      add(n.y);
+      break;
+    case 'KeyValueExpr':
+      add(n.key);
+      add(n.value);
+      break;
+    case 'ArrayType':
+      add(n.len);
+      add(n.elt);
+      break;
+    case 'StructType':
+      add(n.fields);
+      break;
+    case 'FuncType':
+      add(n.typeParams);
+      add(n.params);
+      add(n.results);
+      break;
+    case 'InterfaceType':
+      add(n.methods);
+      break;
+    case 'MapType':
+      add(n.key);
+      add(n.value);
+      break;
+    case 'ChanType':
+      add(n.value);
+      break;
+    case 'Field':
+      addAll(n.names);
+      add(n.fieldType);
+      add(n.tag);
+      break;
+    case 'FieldList':
+      addAll(n.list);
+      break;
+    case 'DeclStmt':
+      add(n.decl);
+      break;
+    case 'LabeledStmt':
+      add(n.label);
+      add(n.stmt);
+      break;
+    case 'ExprStmt':
+      add(n.x);
+      break;
+    case 'SendStmt':
+      add(n.chan);
+      add(n.value);
+      break;
+    case 'IncDecStmt':
+      add(n.x);
+      break;
+    case 'AssignStmt':
+      addAll(n.lhs);
+      addAll(n.rhs);
+      break;
+    case 'GoStmt':
+    case 'DeferStmt':
+      add(n.call);
+      break;
+    case 'ReturnStmt':
+      addAll(n.results);
+      break;
+    case 'BranchStmt':
+      add(n.label);
+      break;
+    case 'BlockStmt':
+      addAll(n.list);
+      break;
+    case 'IfStmt':
+      add(n.init);
+      add(n.cond);
+      add(n.body);
+      add(n.else);
+      break;
+    case 'CaseClause':
+      addAll(n.list);
+      addAll(n.body);
+      break;
+    case 'SwitchStmt':
+      add(n.init);
+      add(n.tag);
+      add(n.body);
+      break;
+    case 'TypeSwitchStmt':
+      add(n.init);
+      add(n.assign);
+      add(n.body);
+      break;
+    case 'CommClause':
+      add(n.comm);
+      addAll(n.body);
+      break;
+    case 'SelectStmt':
+      add(n.body);
+      break;
+    case 'ForStmt':
+      add(n.init);
+      add(n.cond);
+      add(n.post);
+      add(n.body);
+      break;
+    case 'RangeStmt':
+      add(n.key);
+      add(n.value);
+      add(n.x);
+      add(n.body);
+      break;
+    case 'ImportSpec':
+      add(n.name);
+      add(n.path);
+      break;
+    case 'ValueSpec':
+      addAll(n.names);
+      add(n.valueType);
+      addAll(n.values);
+      break;
+    case 'TypeSpec':
+      add(n.name);
+      add(n.typeParams);
+      add(n.specType);
+      break;
+    case 'GenDecl':
+      addAll(n.specs);
+      break;
+    case 'FuncDecl':
+      add(n.recv);
+      add(n.name);
+      add(n.funcType);
+      add(n.body);
+      break;
+    case 'File':
+      add(n.name);
+      addAll(n.decls);
+      break;
+  }
+  return out;
+}
+
+// Calls visit for n and each of its descendants in depth-first order.
+// Returning false from visit skips the children of that node.
+export function inspect(n: Node, visit: (node: Node) => boolean | void): void {
+  if (visit(n) === false) return;
+  for (const child of children(n)) {
+    inspect(child, visit);
+  }
+}
+
+// Returns the chain of nodes from root down to the innermost node whose
+// range contains [start, end).
+export function pathEnclosingInterval(
+  root: Node,
+  start: number,
+  end: number = start
+): Node[] {
+  const path: Node[] = [];
+  let current: Node | undefined = root;
+  while (current) {
+    path.push(current);
+    current = children(current).find(
+      child => child.pos <= start && end <= child.end && child.end > child.pos
+    );
+  }
+  return path;
+}
+
+// Removes redundant parentheses around an expression.
+export function unparen(e: Expr): Expr {
+  while (e.type === 'ParenExpr') e = e.x;
+  return e;
+}
+
+export function isExported(name: string): boolean {
+  const first = name.charAt(0);
+  return first !== first.toLowerCase() && first === first.toUpperCase();
+}
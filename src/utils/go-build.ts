@@ -0,0 +1,318 @@
+import { basename } from 'path';
+import { ToolError } from './tool-error.js';
+
+// Settings that select the files of a package, as the go command takes them
+// from its flags and environment.
+export interface BuildOptions {
+  // Build flags such as ['-tags=integration']; only -tags is understood.
+  buildFlags?: string[];
+  // Target operating system and architecture, defaulting to $GOOS and
+  // $GOARCH or the host.
+  goos?: string;
+  goarch?: string;
+}
+
+export interface BuildContext {
+  goos: string;
+  goarch: string;
+  tags: string[];
+  cgo: boolean;
+}
+
+const knownOS = new Set([
+  'aix',
+  'android',
+  'darwin',
+  'dragonfly',
+  'freebsd',
+  'hurd',
+  'illumos',
+  'ios',
+  'js',
+  'linux',
+  'nacl',
+  'netbsd',
+  'openbsd',
+  'plan9',
+  'solaris',
+  'wasip1',
+  'windows',
+  'zos',
+]);
+
+const unixOS = new Set([
+  'aix',
+  'android',
+  'darwin',
+  'dragonfly',
+  'freebsd',
+  'hurd',
+  'illumos',
+  'ios',
+  'linux',
+  'netbsd',
+  'openbsd',
+  'solaris',
+]);
+
+const knownArch = new Set([
+  '386',
+  'amd64',
+  'amd64p32',
+  'arm',
+  'armbe',
+  'arm64',
+  'arm64be',
+  'loong64',
+  'mips',
+  'mipsle',
+  'mips64',
+  'mips64le',
+  'mips64p32',
+  'mips64p32le',
+  'ppc',
+  'ppc64',
+  'ppc64le',
+  'riscv',
+  'riscv64',
+  's390',
+  's390x',
+  'sparc',
+  'sparc64',
+  'wasm',
+]);
+
+// Architectures whose pointers are 4 bytes wide.
+const arch32 = new Set([
+  '386',
+  'amd64p32',
+  'arm',
+  'armbe',
+  'mips',
+  'mipsle',
+  'mips64p32',
+  'mips64p32le',
+  'ppc',
+  'riscv',
+  's390',
+  'sparc',
+]);
+
+// Returns the size in bytes of a word, and of a pointer, on goarch.
+export function wordSize(goarch: string): number {
+  return arch32.has(goarch) ? 4 : 8;
+}
+
+// Go names of the Node platforms and architectures that differ from them.
+const hostOS: Record<string, string> = { win32: 'windows', sunos: 'solaris' };
+const hostArch: Record<string, string> = {
+  x64: 'amd64',
+  ia32: '386',
+  mipsel: 'mipsle',
+};
+
+function hostGOOS(): string {
+  return hostOS[process.platform] ?? process.platform;
+}
+
+function hostGOARCH(): string {
+  return hostArch[process.arch] ?? process.arch;
+}
+
+// Collects the tags of -tags flags, which list them separated by commas or,
+// in the older form, by spaces.
+function parseBuildFlags(flags: string[]): string[] {
+  const words = flags.flatMap(f => f.trim().split(/\s+/)).filter(Boolean);
+  const tags: string[] = [];
+  for (let i = 0; i < words.length; i++) {
+    const match = words[i].match(/^--?tags(?:=(.*))?$/);
+    if (!match) {
+      throw new ToolError(
+        'invalid_argument',
+        `Unsupported build flag '${words[i]}'; only -tags is supported`
+      );
+    }
+    let value = match[1];
+    if (value === undefined) {
+      if (i + 1 >= words.length) {
+        throw new ToolError('invalid_argument', 'Missing value for -tags');
+      }
+      value = words[++i];
+    }
+    tags.push(...value.split(',').filter(Boolean));
+  }
+  return tags;
+}
+
+// Resolves build options to the context files are matched against. cgo
+// counts as enabled like the go command does: when CGO_ENABLED says so or,
+// if it is unset, when building for the host.
+export function buildContext(options: BuildOptions = {}): BuildContext {
+  const goos = options.goos || process.env.GOOS || hostGOOS();
+  const goarch = options.goarch || process.env.GOARCH || hostGOARCH();
+  if (!knownOS.has(goos)) {
+    throw new ToolError('invalid_argument', `Unknown GOOS '${goos}'`);
+  }
+  if (!knownArch.has(goarch)) {
+    throw new ToolError('invalid_argument', `Unknown GOARCH '${goarch}'`);
+  }
+  const enabled = process.env.CGO_ENABLED;
+  const cgo =
+    enabled === undefined || enabled === ''
+      ? goos === hostGOOS() && goarch === hostGOARCH()
+      : enabled === '1';
+  const tags = [...new Set(parseBuildFlags(options.buildFlags ?? []))].sort();
+  return { goos, goarch, tags, cgo };
+}
+
+// Identifies a context among the others, for caching.
+export function buildContextKey(context: BuildContext): string {
+  const cgo = context.cgo ? ' cgo' : '';
+  return `${context.goos}/${context.goarch}${cgo} ${context.tags.join(',')}`;
+}
+
+// Reports whether a tag of a build constraint holds in context.
+function matchTag(context: BuildContext, tag: string): boolean {
+  const { goos } = context;
+  if (tag === goos || tag === context.goarch) return true;
+  if (tag === 'linux' && goos === 'android') return true;
+  if (tag === 'solaris' && goos === 'illumos') return true;
+  if (tag === 'darwin' && goos === 'ios') return true;
+  if (tag === 'unix') return unixOS.has(goos);
+  if (tag === 'cgo') return context.cgo || context.tags.includes(tag);
+  // Files are checked as if by the gc toolchain of a current release.
+  if (tag === 'gc' || /^go1\.\d+$/.test(tag)) return true;
+  return context.tags.includes(tag);
+}
+
+// Evaluates a //go:build expression, returning undefined if it is
+// malformed.
+function evalGoBuild(
+  context: BuildContext,
+  expr: string
+): boolean | undefined {
+  const tokens = expr.match(/&&|\|\||[!()]|[\w.]+|\S/g) ?? [];
+  let i = 0;
+  const parseOr = (): boolean => {
+    let value = parseAnd();
+    while (tokens[i] === '||') {
+      i++;
+      value = parseAnd() || value;
+    }
+    return value;
+  };
+  const parseAnd = (): boolean => {
+    let value = parseNot();
+    while (tokens[i] === '&&') {
+      i++;
+      value = parseNot() && value;
+    }
+    return value;
+  };
+  const parseNot = (): boolean => {
+    const token = tokens[i++];
+    if (token === '!') return !parseNot();
+    if (token === '(') {
+      const value = parseOr();
+      if (tokens[i++] !== ')') throw new SyntaxError(expr);
+      return value;
+    }
+    if (!token || !/^[\w.]+$/.test(token)) throw new SyntaxError(expr);
+    return matchTag(context, token);
+  };
+  try {
+    const value = parseOr();
+    return i === tokens.length ? value : undefined;
+  } catch {
+    return undefined;
+  }
+}
+
+// Evaluates a // +build line: options separated by spaces of which one must
+// hold, each a comma-separated list of possibly negated tags that all must.
+function evalPlusBuild(context: BuildContext, line: string): boolean {
+  return line
+    .split(/\s+/)
+    .filter(Boolean)
+    .some(option =>
+      option
+        .split(',')
+        .every(term =>
+          term.startsWith('!')
+            ? !matchTag(context, term.slice(1))
+            : matchTag(context, term)
+        )
+    );
+}
+
+// Returns the build constraint lines of src: the line comments before the
+// package clause reading //go:build or // +build.
+function constraintLines(src: string): string[] {
+  const lines: string[] = [];
+  let inBlock = false;
+  for (const raw of src.split('\n')) {
+    const line = raw.trim();
+    if (inBlock) {
+      inBlock = !line.includes('*/');
+      continue;
+    }
+    if (line === '') continue;
+    if (line.startsWith('/*')) {
+      inBlock = !line.slice(2).includes('*/');
+      continue;
+    }
+    if (!line.startsWith('//')) break;
+    if (/^\/\/go:build\s/.test(line) || /^\/\/\s*\+build\s/.test(line)) {
+      lines.push(line);
+    }
+  }
+  return lines;
+}
+
+// Checks the _GOOS, _GOARCH or _GOOS_GOARCH suffix of a file name. Returns
+// the suffix if it excludes the file.
+function nameConstraint(
+  context: BuildContext,
+  filePath: string
+): string | undefined {
+  let name = basename(filePath).replace(/\..*$/, '');
+  const first = name.indexOf('_');
+  if (first < 0) return undefined;
+  // The part before the first underscore never counts, so that a file
+  // named linux.go is not constrained.
+  name = name.slice(first);
+  const parts = name.split('_');
+  if (parts[parts.length - 1] === 'test') parts.pop();
+  const n = parts.length;
+  if (n >= 3 && knownOS.has(parts[n - 2]) && knownArch.has(parts[n - 1])) {
+    const ok =
+      matchTag(context, parts[n - 2]) && matchTag(context, parts[n - 1]);
+    return ok ? undefined : `_${parts[n - 2]}_${parts[n - 1]}`;
+  }
+  const last = parts[n - 1];
+  if (n >= 2 && (knownOS.has(last) || knownArch.has(last))) {
+    return matchTag(context, last) ? undefined : `_${last}`;
+  }
+  return undefined;
+}
+
+// Returns the constraint that excludes the Go file at filePath with
+// contents src from builds in context, or undefined if it is included.
+export function excludingConstraint(
+  context: BuildContext,
+  filePath: string,
+  src: string
+): string | undefined {
+  const suffix = nameConstraint(context, filePath);
+  if (suffix) return `file name suffix ${suffix}`;
+  const lines = constraintLines(src);
+  // A //go:build line takes precedence over // +build lines.
+  const goBuild = lines.find(l => l.startsWith('//go:build'));
+  if (goBuild) {
+    const expr = goBuild.slice('//go:build'.length).trim();
+    return evalGoBuild(context, expr) === false ? goBuild : undefined;
+  }
+  return lines.find(
+    l => !evalPlusBuild(context, l.replace(/^\/\/\s*\+build/, ''))
+  );
+}
@@ -0,0 +1,1784 @@
+// Resolves identifiers and infers expression types for Go packages, in the
+// spirit of go/types. The checker is deliberately forgiving: anything it
+// cannot understand (most notably members of packages outside the module)
+// is recorded as unresolved rather than treated as an error, so that the
+// refactoring tools can decide how cautious to be.
+
+import type {
+  AssignStmt,
+  BlockStmt,
+  CallExpr,
+  CompositeLit,
+  Expr,
+  FieldList,
+  FuncDecl,
+  FuncType,
+  Ident,
+  ImportSpec,
+  Node,
+  SelectorExpr,
+  Stmt,
+  TypeSpec,
+  ValueSpec,
+} from './go-ast.js';
+import { inspect, unparen } from './go-ast.js';
+import { unquoteGoString } from './go-scanner.js';
+import {
+  ANY,
+  INVALID,
+  Scope,
+  UNTYPED_BOOL,
+  UNTYPED_COMPLEX,
+  UNTYPED_FLOAT,
+  UNTYPED_INT,
+  UNTYPED_NIL,
+  UNTYPED_RUNE,
+  UNTYPED_STRING,
+  basic,
+  defaultPackageName,
+  defaultType,
+  deref,
+  isExternal,
+  isUntyped,
+  lookupFieldOrMethod,
+  subst,
+  substMap,
+  typeContains,
+  under,
+  universe,
+} from './go-types.js';
+import type {
+  GoObject,
+  GoPackage,
+  GoSourceFile,
+  InterfaceTypeT,
+  Selection,
+  SignatureType,
+  Type,
+} from './go-types.js';
+
+export type OperandMode =
+  | 'value'
+  | 'type'
+  | 'novalue'
+  | 'builtin'
+  | 'pkgname'
+  | 'invalid';
+
+export interface Operand {
+  mode: OperandMode;
+  type: Type;
+  obj?: GoObject;
+}
+
+export type ConstValue = bigint | number | string | boolean;
+
+export interface UnresolvedRef {
+  ident: Ident;
+  file: GoSourceFile;
+  // For selectors, the operand whose type could not be determined.
+  selector?: SelectorExpr;
+}
+
+export class GoInfo {
+  readonly defs = new Map<Ident, GoObject>();
+  readonly uses = new Map<Ident, GoObject>();
+  readonly implicits = new Map<Node, GoObject>();
+  readonly types = new Map<Expr, Operand>();
+  readonly selections = new Map<SelectorExpr, Selection>();
+  readonly scopes = new Map<Node, Scope>();
+  readonly unresolved: UnresolvedRef[] = [];
+
+  // Returns the object an identifier defines or refers to.
+  objectOf(id: Ident): GoObject | undefined {
+    return this.defs.get(id) ?? this.uses.get(id);
+  }
+
+  typeOf(e: Expr): Type | undefined {
+    return this.types.get(e)?.type;
+  }
+}
+
+export interface CheckContext {
+  file: GoSourceFile;
+  sig?: SignatureType;
+  labels?: Scope;
+}
+
+const OK_OPERAND: Operand = { mode: 'novalue', type: INVALID };
+
+function invalid(): Operand {
+  return { mode: 'invalid', type: INVALID };
+}
+
+function value(type: Type): Operand {
+  return { mode: 'value', type };
+}
+
+export type Importer = (path: string) => GoPackage | undefined;
+
+export class GoChecker {
+  readonly info = new GoInfo();
+  private readonly importer: Importer;
+  private readonly collected = new Set<GoPackage>();
+  private readonly checked = new Set<GoPackage>();
+  private readonly resolving = new Set<GoObject>();
+  private readonly typeMemo = new Map<Node, Type>();
+  private readonly externals = new Map<string, GoObject>();
+  private readonly constSource = new Map<ValueSpec, ValueSpec>();
+  private readonly funcScopes = new Map<Node, Scope>();
+
+  constructor(importer: Importer) {
+    this.importer = importer;
+  }
+
+  // Reports whether the bodies of pkg have been checked.
+  isChecked(pkg: GoPackage): boolean {
+    return this.checked.has(pkg);
+  }
+
+  // Returns a checker importing through importer that starts from what this
+  // one found about the packages of kept, which must have been checked and
+  // import only packages of kept. What it found about every other package
+  // is left out for them to be checked afresh. This checker is not changed,
+  // so that programs still using it are not disturbed.
+  reuse(importer: Importer, kept: Set<GoPackage>): GoChecker {
+    const stale = new Set<Node>();
+    for (const pkg of this.collected) {
+      if (kept.has(pkg)) continue;
+      for (const file of pkg.files) inspect(file.ast, n => void stale.add(n));
+    }
+    const copy = <K extends Node, V>(from: Map<K, V>, to: Map<K, V>) => {
+      for (const [node, value] of from) {
+        if (!stale.has(node)) to.set(node, value);
+      }
+    };
+    const checker = new GoChecker(importer);
+    const { info } = checker;
+    copy(this.info.defs, info.defs);
+    copy(this.info.uses, info.uses);
+    copy(this.info.implicits, info.implicits);
+    copy(this.info.types, info.types);
+    copy(this.info.selections, info.selections);
+    copy(this.info.scopes, info.scopes);
+    info.unresolved.push(...this.info.unresolved.filter(u => !stale.has(u.ident)));
+    copy(this.typeMemo, checker.typeMemo);
+    copy(this.constSource, checker.constSource);
+    copy(this.funcScopes, checker.funcScopes);
+    for (const [key, obj] of this.externals) checker.externals.set(key, obj);
+    for (const pkg of kept) {
+      checker.collected.add(pkg);
+      checker.checked.add(pkg);
+    }
+    return checker;
+  }
+
+  // --------------------------------------------------------------------------
+  // Package-level declarations
+
+  collect(pkg: GoPackage): void {
+    if (this.collected.has(pkg)) return;
+    this.collected.add(pkg);
+    pkg.scope = new Scope(universe, 'package');
+    const methods: { obj: GoObject; decl: FuncDecl }[] = [];
+    const dotImports: { file: GoSourceFile; pkg: GoPackage }[] = [];
+
+    for (const file of pkg.files) {
+      file.scope = new Scope(pkg.scope, 'file', file.ast.pos, file.ast.end);
+      this.info.scopes.set(file.ast, file.scope);
+
+      for (const decl of file.ast.decls) {
+        if (decl.type === 'FuncDecl') {
+          const obj: GoObject = {
+            kind: 'func',
+            name: decl.name.name,
+            pos: decl.name.pos,
+            file,
+            pkg,
+            decl,
+          };
+          this.info.defs.set(decl.name, obj);
+          if (decl.recv) {
+            methods.push({ obj, decl });
+          } else if (obj.name !== 'init' && obj.name !== '_') {
+            pkg.scope.insert(obj);
+          }
+          continue;
+        }
+        if (decl.type !== 'GenDecl') continue;
+
+        let lastWithValues: ValueSpec | undefined;
+        for (const spec of decl.specs) {
+          if (spec.type === 'ImportSpec') {
+            const imported = this.declareImport(file, spec);
+            if (imported) dotImports.push({ file, pkg: imported });
+          } else if (spec.type === 'ValueSpec') {
+            if (decl.tok === 'const') {
+              if (spec.values.length > 0 || spec.valueType) lastWithValues = spec;
+              if (lastWithValues && spec.values.length === 0) {
+                this.constSource.set(spec, lastWithValues);
+              }
+            }
+            for (const name of spec.names) {
+              const obj: GoObject = {
+                kind: decl.tok === 'const' ? 'const' : 'var',
+                name: name.name,
+                pos: name.pos,
+                file,
+                pkg,
+                decl: spec,
+                iota: spec.iota,
+              };
+              this.info.defs.set(name, obj);
+              if (name.name !== '_') pkg.scope.insert(obj);
+            }
+          } else {
+            const obj = this.newTypeName(spec, file, pkg);
+            if (spec.name.name !== '_') pkg.scope.insert(obj);
+          }
+        }
+      }
+    }
+
+    for (const { obj, decl } of methods) {
+      const recvType = decl.recv!.list[0]?.fieldType;
+      if (!recvType) continue;
+      let base = unparen(recvType);
+      if (base.type === 'StarExpr') {
+        obj.pointerRecv = true;
+        base = unparen(base.x);
+      }
+      if (base.type === 'IndexExpr') base = base.x;
+      if (base.type !== 'Ident') continue;
+      const typeObj = pkg.scope.lookup(base.name);
+      if (typeObj?.kind === 'type') {
+        obj.recv = typeObj;
+        (typeObj.methods ??= []).push(obj);
+      }
+    }
+
+    for (const { file, pkg: imported } of dotImports) {
+      this.collect(imported);
+      for (const [name, obj] of imported.scope!.names) {
+        if (/^\p{Lu}/u.test(name)) file.scope!.names.set(name, obj);
+      }
+    }
+  }
+
+  private newTypeName(spec: TypeSpec, file: GoSourceFile, pkg: GoPackage | undefined): GoObject {
+    const obj: GoObject = {
+      kind: 'type',
+      name: spec.name.name,
+      pos: spec.name.pos,
+      file,
+      pkg,
+      decl: spec,
+      isAlias: spec.assign,
+    };
+    if (!spec.assign) obj.type = { kind: 'named', obj };
+    this.info.defs.set(spec.name, obj);
+    return obj;
+  }
+
+  // Declares the package name introduced by an import spec. Returns the
+  // imported package for dot imports so that its members can be added to
+  // the file scope once collected.
+  private declareImport(file: GoSourceFile, spec: ImportSpec): GoPackage | undefined {
+    const path = unquoteGoString(spec.path.value);
+    const imported = this.importer(path);
+    const local = spec.name?.name;
+    if (local === '_') return undefined;
+    if (local === '.') return imported;
+    const name = local ?? imported?.name ?? defaultPackageName(path);
+    const obj: GoObject = {
+      kind: 'pkgname',
+      name,
+      pos: spec.name ? spec.name.pos : spec.path.pos,
+      file,
+      pkg: file.pkg,
+      decl: spec,
+      imported: path,
+    };
+    if (spec.name) this.info.defs.set(spec.name, obj);
+    this.info.implicits.set(spec, obj);
+    file.scope!.insert(obj);
+    return undefined;
+  }
+
+  private externalObject(path: string, name: string): GoObject {
+    const key = `${path}.${name}`;
+    let obj = this.externals.get(key);
+    if (!obj) {
+      obj = { kind: 'type', name, pos: -1, externalPath: path };
+      obj.type = { kind: 'named', obj };
+      obj.underlying = INVALID;
+      this.externals.set(key, obj);
+    }
+    return obj;
+  }
+
+  // Looks up an exported member of an imported package.
+  private packageMember(pkgName: GoObject, name: string): GoObject | undefined {
+    const imported = this.importer(pkgName.imported!);
+    if (!imported) return undefined;
+    this.collect(imported);
+    return imported.scope!.lookup(name);
+  }
+
+  // --------------------------------------------------------------------------
+  // Object types
+
+  objectType(obj: GoObject): Type {
+    if (obj.kind === 'type') {
+      this.resolveTypeName(obj);
+      return obj.type ?? INVALID;
+    }
+    if (obj.type) return obj.type;
+    if (this.resolving.has(obj) || !obj.file) return INVALID;
+    this.resolving.add(obj);
+    try {
+      obj.type = this.computeObjectType(obj);
+    } finally {
+      this.resolving.delete(obj);
+    }
+    return obj.type;
+  }
+
+  private computeObjectType(obj: GoObject): Type {
+    const ctx: CheckContext = { file: obj.file! };
+    const scope = declScope(obj);
+    const decl = obj.decl;
+
+    if (decl?.type === 'FuncDecl') {
+      return this.funcDeclSignature(decl, obj.file!);
+    }
+    if (decl?.type === 'ValueSpec') {
+      const src = this.constSource.get(decl) ?? decl;
+      const index = decl.names.findIndex(n => n.pos === obj.pos);
+      if (src.valueType) {
+        return this.typeExpr(src.valueType, scope, ctx);
+      }
+      if (src.values.length === src.names.length && src.values[index]) {
+        const t = this.checkExpr(src.values[index], scope, ctx).type;
+        return obj.kind === 'var' ? defaultType(t) : t;
+      }
+      if (src.values.length === 1) {
+        const t = this.checkExpr(src.values[0], scope, ctx).type;
+        if (t.kind === 'tuple') return t.types[index] ?? INVALID;
+      }
+    }
+    return INVALID;
+  }
+
+  resolveTypeName(obj: GoObject): void {
+    if (obj.underlying !== undefined || obj.pos < 0 || !obj.file) return;
+    if (obj.isAlias && obj.type) return;
+    const spec = obj.decl;
+    if (!spec || spec.type !== 'TypeSpec') return;
+    if (this.resolving.has(obj)) return;
+    this.resolving.add(obj);
+    try {
+      const ctx: CheckContext = { file: obj.file };
+      let scope = declScope(obj);
+      if (spec.typeParams) {
+        scope = new Scope(scope, 'block', spec.pos, spec.end);
+        this.info.scopes.set(spec, scope);
+        obj.typeParams = this.declareTypeParams(spec.typeParams, scope, ctx);
+      }
+      if (obj.isAlias) {
+        obj.type = this.typeExpr(spec.specType, scope, ctx);
+        return;
+      }
+      const t = this.typeExpr(spec.specType, scope, ctx);
+      let u = t;
+      if (t.kind === 'named') {
+        this.resolveTypeName(t.obj);
+        u = under(t);
+      }
+      if (u.kind === 'interface') {
+        for (const m of u.methods) m.recv ??= obj;
+      }
+      obj.underlying = u;
+    } finally {
+      this.resolving.delete(obj);
+    }
+    // Method signatures are needed by any selector on the type, possibly
+    // before the declaring package itself has been checked.
+    for (const m of obj.methods ?? []) this.objectType(m);
+  }
+
+  private declareTypeParams(list: FieldList, scope: Scope, ctx: CheckContext): GoObject[] {
+    const params: GoObject[] = [];
+    for (const field of list.list) {
+      for (const name of field.names) {
+        const tp: GoObject = {
+          kind: 'type',
+          name: name.name,
+          pos: name.pos,
+          file: ctx.file,
+          pkg: ctx.file.pkg,
+          decl: field,
+        };
+        tp.type = { kind: 'typeparam', obj: tp };
+        tp.underlying = tp.type;
+        this.info.defs.set(name, tp);
+        scope.insert(tp);
+        params.push(tp);
+      }
+    }
+    for (const field of list.list) {
+      const c = this.constraintType(field.fieldType, scope, ctx);
+      for (const name of field.names) {
+        const tp = this.info.defs.get(name);
+        if (tp) tp.constraint = c;
+      }
+    }
+    return params;
+  }
+
+  private constraintType(e: Expr, scope: Scope, ctx: CheckContext): Type {
+    const terms: Type[] = [];
+    const collectTerms = (x: Expr) => {
+      if (x.type === 'BinaryExpr' && x.op === '|') {
+        collectTerms(x.x);
+        collectTerms(x.y);
+      } else if (x.type === 'UnaryExpr' && x.op === '~') {
+        terms.push(this.typeExpr(x.x, scope, ctx));
+      } else {
+        terms.push(this.typeExpr(x, scope, ctx));
+      }
+    };
+    collectTerms(e);
+    if (terms.length === 1) {
+      const u = under(terms[0]);
+      if (u.kind === 'interface') return u;
+    }
+    return { kind: 'interface', methods: [], embeddeds: [], isConstraint: true, terms };
+  }
+
+  private funcDeclSignature(decl: FuncDecl, file: GoSourceFile): SignatureType {
+    const memo = this.typeMemo.get(decl);
+    if (memo) return memo as SignatureType;
+    const scope = this.funcScope(decl, file);
+    const ctx: CheckContext = { file };
+    let recv: GoObject | undefined;
+    if (decl.recv) {
+      const field = decl.recv.list[0];
+      if (field) {
+        this.declareRecvTypeParams(field.fieldType, scope, ctx);
+        const t = this.typeExpr(field.fieldType, scope, ctx);
+        const name = field.names[0];
+        recv = {
+          kind: 'var',
+          name: name?.name ?? '',
+          pos: name?.pos ?? field.pos,
+          file,
+          pkg: file.pkg,
+          decl: field,
+          type: t,
+          isParam: true,
+        };
+        if (name) {
+          this.info.defs.set(name, recv);
+          if (name.name !== '_') scope.insert(recv);
+        }
+      }
+    }
+    const sig = this.signature(decl.funcType, scope, ctx, true);
+    sig.recv = recv;
+    this.typeMemo.set(decl, sig);
+    return sig;
+  }
+
+  // Receiver type parameters such as T in func (l *List[T]) are declared by
+  // the receiver itself and stand for the type parameters of List.
+  private declareRecvTypeParams(recvType: Expr, scope: Scope, ctx: CheckContext): void {
+    let base = unparen(recvType);
+    if (base.type === 'StarExpr') base = unparen(base.x);
+    if (base.type !== 'IndexExpr' || base.x.type !== 'Ident') return;
+    const typeObj = ctx.file.pkg.scope?.lookup(base.x.name);
+    if (typeObj) this.resolveTypeName(typeObj);
+    base.indices.forEach((index, i) => {
+      if (index.type !== 'Ident' || index.name === '_') return;
+      const tp: GoObject = {
+        kind: 'type',
+        name: index.name,
+        pos: index.pos,
+        file: ctx.file,
+        pkg: ctx.file.pkg,
+        decl: index,
+      };
+      const origin = typeObj?.typeParams?.[i];
+      // Reuse the origin's type parameter type so that substitution of the
+      // receiver's type arguments applies inside the method body too.
+      tp.type = origin?.type ?? { kind: 'typeparam', obj: tp };
+      tp.constraint = origin?.constraint;
+      this.info.defs.set(index, tp);
+      scope.insert(tp);
+    });
+  }
+
+  private funcScope(decl: Node, file: GoSourceFile): Scope {
+    let scope = this.funcScopes.get(decl);
+    if (!scope) {
+      scope = new Scope(file.scope!, 'func', decl.pos, decl.end);
+      this.funcScopes.set(decl, scope);
+      this.info.scopes.set(decl, scope);
+    }
+    return scope;
+  }
+
+  // Builds a signature from a function type. When declare is set, named
+  // parameters and results are inserted into scope.
+  private signature(ft: FuncType, scope: Scope, ctx: CheckContext, declare: boolean): SignatureType {
+    const memo = this.typeMemo.get(ft);
+    if (memo) return memo as SignatureType;
+    let typeParams: GoObject[] | undefined;
+    if (ft.typeParams) {
+      typeParams = this.declareTypeParams(ft.typeParams, scope, ctx);
+    }
+    let variadic = false;
+    const vars = (list: FieldList | undefined, isResult: boolean): GoObject[] => {
+      const out: GoObject[] = [];
+      for (const field of list?.list ?? []) {
+        let t: Type;
+        if (field.fieldType.type === 'Ellipsis' && !isResult) {
+          variadic = true;
+          t = { kind: 'slice', elem: this.typeExpr(field.fieldType.elt!, scope, ctx) };
+        } else {
+          t = this.typeExpr(field.fieldType, scope, ctx);
+        }
+        if (field.names.length === 0) {
+          out.push({ kind: 'var', name: '', pos: field.pos, file: ctx.file, pkg: ctx.file.pkg, decl: field, type: t, isParam: true });
+          continue;
+        }
+        for (const name of field.names) {
+          const v: GoObject = {
+            kind: 'var',
+            name: name.name,
+            pos: name.pos,
+            file: ctx.file,
+            pkg: ctx.file.pkg,
+            decl: field,
+            type: t,
+            isParam: true,
+          };
+          this.info.defs.set(name, v);
+          out.push(v);
+        }
+      }
+      return out;
+    };
+    const params = vars(ft.params, false);
+    const results = vars(ft.results, true);
+    if (declare) {
+      for (const v of [...params, ...results]) {
+        if (v.name && v.name !== '_') scope.insert(v);
+      }
+    }
+    const sig: SignatureType = { kind: 'signature', typeParams, params, results, variadic };
+    this.typeMemo.set(ft, sig);
+    return sig;
+  }
+
+  // --------------------------------------------------------------------------
+  // Type expressions
+
+  typeExpr(e: Expr, scope: Scope, ctx: CheckContext): Type {
+    const memo = this.typeMemo.get(e);
+    if (memo) return memo;
+    const t = this.computeTypeExpr(e, scope, ctx);
+    this.typeMemo.set(e, t);
+    if (!this.info.types.has(e)) this.info.types.set(e, { mode: 'type', type: t });
+    return t;
+  }
+
+  private computeTypeExpr(e: Expr, scope: Scope, ctx: CheckContext): Type {
+    switch (e.type) {
+      case 'Ident':
+      case 'SelectorExpr': {
+        const op = this.checkExpr(e, scope, ctx);
+        if (op.mode === 'type') return op.type;
+        if (e.type === 'SelectorExpr' && op.mode === 'invalid') {
+          const x = unparen(e.x);
+          if (x.type === 'Ident') {
+            const pkgName = this.info.uses.get(x);
+            if (pkgName?.kind === 'pkgname') {
+              const ext = this.externalObject(pkgName.imported!, e.sel.name);
+              // In type position the member is known to be a type.
+              const i = this.info.unresolved.findIndex(u => u.ident === e.sel);
+              if (i >= 0) this.info.unresolved.splice(i, 1);
+              this.info.uses.set(e.sel, ext);
+              this.info.types.set(e, { mode: 'type', type: ext.type! });
+              return ext.type!;
+            }
+          }
+        }
+        return INVALID;
+      }
+      case 'ParenExpr':
+        return this.typeExpr(e.x, scope, ctx);
+      case 'StarExpr':
+        return { kind: 'pointer', elem: this.typeExpr(e.x, scope, ctx) };
+      case 'ArrayType': {
+        const elem = this.typeExpr(e.elt, scope, ctx);
+        if (!e.len) return { kind: 'slice', elem };
+        let len: number | undefined;
+        if (e.len.type !== 'Ellipsis') {
+          this.checkExpr(e.len, scope, ctx);
+          const v = this.constValue(e.len, scope, ctx);
+          if (typeof v === 'bigint') len = Number(v);
+        }
+        return { kind: 'array', len, elem };
+      }
+      case 'Ellipsis':
+        return { kind: 'slice', elem: e.elt ? this.typeExpr(e.elt, scope, ctx) : INVALID };
+      case 'MapType':
+        return { kind: 'map', key: this.typeExpr(e.key, scope, ctx), elem: this.typeExpr(e.value, scope, ctx) };
+      case 'ChanType':
+        return { kind: 'chan', dir: e.dir, elem: this.typeExpr(e.value, scope, ctx) };
+      case 'FuncType':
+        return this.signature(e, new Scope(scope, 'func', e.pos, e.end), ctx, false);
+      case 'StructType': {
+        const fields: GoObject[] = [];
+        const tags: (string | undefined)[] = [];
+        for (const field of e.fields.list) {
+          const t = this.typeExpr(field.fieldType, scope, ctx);
+          const tag = field.tag?.value;
+          if (field.names.length === 0) {
+            const name = embeddedFieldName(field.fieldType);
+            const f: GoObject = {
+              kind: 'var',
+              name: name?.name ?? '',
+              pos: name?.pos ?? field.pos,
+              file: ctx.file,
+              pkg: ctx.file.pkg,
+              decl: field,
+              type: t,
+              isField: true,
+              embedded: true,
+            };
+            fields.push(f);
+            tags.push(tag);
+            continue;
+          }
+          for (const name of field.names) {
+            const f: GoObject = {
+              kind: 'var',
+              name: name.name,
+              pos: name.pos,
+              file: ctx.file,
+              pkg: ctx.file.pkg,
+              decl: field,
+              type: t,
+              isField: true,
+            };
+            this.info.defs.set(name, f);
+            fields.push(f);
+            tags.push(tag);
+          }
+        }
+        return { kind: 'struct', fields, tags };
+      }
+      case 'InterfaceType': {
+        const iface: InterfaceTypeT = { kind: 'interface', methods: [], embeddeds: [] };
+        for (const field of e.methods.list) {
+          if (field.names.length > 0 && field.fieldType.type === 'FuncType') {
+            const name = field.names[0];
+            const m: GoObject = {
+              kind: 'func',
+              name: name.name,
+              pos: name.pos,
+              file: ctx.file,
+              pkg: ctx.file.pkg,
+              decl: field,
+            };
+            this.info.defs.set(name, m);
+            m.type = this.signature(field.fieldType, new Scope(scope, 'func', field.pos, field.end), ctx, false);
+            iface.methods.push(m);
+          } else {
+            const c = this.constraintType(field.fieldType, scope, ctx);
+            // Types of packages outside the module are not loaded; a lone
+            // one is taken to be an embedded interface, such as io.Closer.
+            const external =
+              field.fieldType.type !== 'UnaryExpr' &&
+              c.kind === 'interface' &&
+              c.terms?.length === 1 &&
+              isExternal(c.terms[0]);
+            if (c.kind === 'interface' && c.terms && !external) {
+              iface.isConstraint = true;
+              iface.terms = [...(iface.terms ?? []), ...c.terms];
+            } else {
+              const t = this.typeExpr(field.fieldType, scope, ctx);
+              iface.embeddeds.push(t);
+            }
+          }
+        }
+        if (iface.methods.length === 0 && iface.embeddeds.length === 0 && !iface.terms) {
+          return ANY;
+        }
+        return iface;
+      }
+      case 'IndexExpr': {
+        const op = this.checkExpr(e, scope, ctx);
+        return op.mode === 'type' ? op.type : INVALID;
+      }
+      case 'BinaryExpr':
+      case 'UnaryExpr':
+        return this.constraintType(e, scope, ctx);
+    }
+    this.checkExpr(e, scope, ctx);
+    return INVALID;
+  }
+
+  // --------------------------------------------------------------------------
+  // Expressions
+
+  checkExpr(e: Expr, scope: Scope, ctx: CheckContext, expected?: Type): Operand {
+    const memo = this.info.types.get(e);
+    if (memo) return memo;
+    const op = this.computeExpr(e, scope, ctx, expected);
+    this.info.types.set(e, op);
+    return op;
+  }
+
+  private resolveIdent(id: Ident, scope: Scope, ctx: CheckContext): GoObject | undefined {
+    if (id.name === '_') return undefined;
+    const obj = scope.lookupParent(id.name);
+    if (!obj) {
+      this.info.unresolved.push({ ident: id, file: ctx.file });
+      return undefined;
+    }
+    this.info.uses.set(id, obj);
+    return obj;
+  }
+
+  private objectOperand(obj: GoObject): Operand {
+    switch (obj.kind) {
+      case 'type':
+        return { mode: 'type', type: this.objectType(obj), obj };
+      case 'pkgname':
+        return { mode: 'pkgname', type: INVALID, obj };
+      case 'builtin':
+        return { mode: 'builtin', type: INVALID, obj };
+      case 'nil':
+        return { mode: 'value', type: UNTYPED_NIL, obj };
+      case 'label':
+        return invalid();
+      default:
+        return { mode: 'value', type: this.objectType(obj), obj };
+    }
+  }
+
+  private computeExpr(e: Expr, scope: Scope, ctx: CheckContext, expected?: Type): Operand {
+    switch (e.type) {
+      case 'Ident': {
+        const obj = this.resolveIdent(e, scope, ctx);
+        return obj ? this.objectOperand(obj) : invalid();
+      }
+      case 'BasicLit': {
+        const t = {
+          INT: UNTYPED_INT,
+          FLOAT: UNTYPED_FLOAT,
+          IMAG: UNTYPED_COMPLEX,
+          CHAR: UNTYPED_RUNE,
+          STRING: UNTYPED_STRING,
+        }[e.kind];
+        return value(t);
+      }
+      case 'ParenExpr':
+        return this.checkExpr(e.x, scope, ctx, expected);
+      case 'FuncLit': {
+        const fscope = new Scope(scope, 'func', e.pos, e.end);
+        this.info.scopes.set(e, fscope);
+        const sig = this.signature(e.funcType, fscope, ctx, true);
+        this.checkBody(e.body, fscope, { file: ctx.file, sig });
+        return value(sig);
+      }
+      case 'CompositeLit':
+        return this.checkCompositeLit(e, scope, ctx, expected);
+      case 'SelectorExpr':
+        return this.checkSelector(e, scope, ctx);
+      case 'IndexExpr':
+        return this.checkIndex(e, scope, ctx);
+      case 'SliceExpr': {
+        const x = this.checkExpr(e.x, scope, ctx);
+        for (const i of [e.low, e.high, e.max]) {
+          if (i) this.checkExpr(i, scope, ctx);
+        }
+        const u = under(deref(x.type).type);
+        if (u.kind === 'basic') return value(isUntyped(x.type) ? basic('string') : x.type);
+        if (u.kind === 'array') return value({ kind: 'slice', elem: u.elem });
+        return value(x.type);
+      }
+      case 'TypeAssertExpr': {
+        this.checkExpr(e.x, scope, ctx);
+        if (!e.assertType) return invalid();
+        return value(this.typeExpr(e.assertType, scope, ctx));
+      }
+      case 'CallExpr':
+        return this.checkCall(e, scope, ctx, expected);
+      case 'StarExpr': {
+        const x = this.checkExpr(e.x, scope, ctx);
+        if (x.mode === 'type') {
+          return { mode: 'type', type: { kind: 'pointer', elem: x.type } };
+        }
+        const u = under(x.type);
+        return value(u.kind === 'pointer' ? u.elem : INVALID);
+      }
+      case 'UnaryExpr': {
+        const elemExpected =
+          e.op === '&' && expected && under(expected).kind === 'pointer'
+            ? (under(expected) as { elem: Type }).elem
+            : undefined;
+        const x = this.checkExpr(e.x, scope, ctx, elemExpected);
+        switch (e.op) {
+          case '&':
+            return value({ kind: 'pointer', elem: x.type });
+          case '<-': {
+            const u = under(x.type);
+            return value(u.kind === 'chan' ? u.elem : INVALID);
+          }
+          case '!':
+            return value(x.type);
+          default:
+            return value(x.type);
+        }
+      }
+      case 'BinaryExpr': {
+        const x = this.checkExpr(e.x, scope, ctx);
+        const y = this.checkExpr(e.y, scope, ctx);
+        switch (e.op) {
+          case '==':
+          case '!=':
+          case '<':
+          case '<=':
+          case '>':
+          case '>=':
+            return value(UNTYPED_BOOL);
+          case '<<':
+          case '>>':
+            return value(x.type);
+          case '&&':
+          case '||':
+            return value(isUntyped(x.type) ? y.type : x.type);
+        }
+        if (isUntyped(x.type) && !isUntyped(y.type)) return value(y.type);
+        if (isUntyped(x.type) && isUntyped(y.type)) {
+          return value(untypedRank(x.type) >= untypedRank(y.type) ? x.type : y.type);
+        }
+        return value(x.type);
+      }
+      case 'KeyValueExpr':
+        this.checkExpr(e.key, scope, ctx);
+        this.checkExpr(e.value, scope, ctx);
+        return invalid();
+      case 'ArrayType':
+      case 'MapType':
+      case 'ChanType':
+      case 'FuncType':
+      case 'StructType':
+      case 'InterfaceType':
+      case 'Ellipsis':
+        return { mode: 'type', type: this.typeExpr(e, scope, ctx) };
+      case 'BadExpr':
+        return invalid();
+    }
+  }
+
+  private checkSelector(e: SelectorExpr, scope: Scope, ctx: CheckContext): Operand {
+    const x = this.checkExpr(e.x, scope, ctx);
+    const name = e.sel.name;
+
+    if (x.mode === 'pkgname') {
+      const member = this.packageMember(x.obj!, name);
+      if (member) {
+        this.info.uses.set(e.sel, member);
+        return this.objectOperand(member);
+      }
+      if (!this.importer(x.obj!.imported!)) {
+        // A member of a package outside the module.
+        this.info.unresolved.push({ ident: e.sel, file: ctx.file, selector: e });
+      } else {
+        this.info.unresolved.push({ ident: e.sel, file: ctx.file });
+      }
+      return invalid();
+    }
+
+    if (x.mode === 'invalid' || x.type.kind === 'invalid') {
+      this.info.unresolved.push({ ident: e.sel, file: ctx.file, selector: e });
+      return invalid();
+    }
+
+    const sel = lookupFieldOrMethod(x.type, name);
+    if (!sel) {
+      this.info.unresolved.push({ ident: e.sel, file: ctx.file, selector: e });
+      return invalid();
+    }
+    this.info.uses.set(e.sel, sel.obj);
+    this.info.selections.set(e, sel);
+
+    if (x.mode === 'type') {
+      // Method expression T.m: the receiver becomes the first parameter.
+      if (sel.kind === 'method' && sel.type.kind === 'signature') {
+        const recv: GoObject = { kind: 'var', name: '', pos: -1, type: x.type };
+        return value({ ...sel.type, params: [recv, ...sel.type.params] });
+      }
+      return invalid();
+    }
+    return value(sel.type);
+  }
+
+  private checkIndex(e: Expr & { type: 'IndexExpr' }, scope: Scope, ctx: CheckContext): Operand {
+    const x = this.checkExpr(e.x, scope, ctx);
+    if (x.mode === 'type') {
+      const args = e.indices.map(i => this.typeExpr(i, scope, ctx));
+      if (x.type.kind === 'named') {
+        return { mode: 'type', type: { kind: 'named', obj: x.type.obj, typeArgs: args }, obj: x.obj };
+      }
+      return { mode: 'type', type: x.type };
+    }
+    if (x.type.kind === 'signature' && x.type.typeParams) {
+      const { typeParams } = x.type;
+      const args = e.indices.map(i => this.typeExpr(i, scope, ctx));
+      // The type arguments left out of a partial instantiation are
+      // inferred from the constraints, or else from the arguments of a call.
+      const m = substMap(typeParams, args);
+      inferFromConstraints(typeParams, m);
+      const rest = typeParams.filter(p => !m.has(p));
+      const inst = subst({ ...x.type, typeParams: rest.length > 0 ? rest : undefined }, typeArgMap(typeParams, m));
+      return { mode: 'value', type: inst, obj: x.obj };
+    }
+
+    const u = under(deref(x.type).type);
+    const keyExpected = u.kind === 'map' ? u.key : undefined;
+    for (const i of e.indices) this.checkExpr(i, scope, ctx, keyExpected);
+    switch (u.kind) {
+      case 'basic':
+        return value(basic('byte'));
+      case 'slice':
+      case 'array':
+        return value(u.elem);
+      case 'map':
+        return value(u.elem);
+    }
+    return invalid();
+  }
+
+  private checkCompositeLit(e: CompositeLit, scope: Scope, ctx: CheckContext, expected?: Type): Operand {
+    let t: Type;
+    if (e.litType) {
+      if (e.litType.type === 'ArrayType' && e.litType.len?.type === 'Ellipsis') {
+        const elem = this.typeExpr(e.litType.elt, scope, ctx);
+        t = { kind: 'array', len: e.elts.length, elem };
+        this.info.types.set(e.litType, { mode: 'type', type: t });
+      } else {
+        t = this.typeExpr(e.litType, scope, ctx);
+      }
+    } else {
+      t = expected ?? INVALID;
+      if (under(t).kind === 'pointer') t = (under(t) as { elem: Type }).elem;
+    }
+
+    const u = under(t);
+    if (u.kind === 'struct') {
+      e.elts.forEach((elt, i) => {
+        if (elt.type === 'KeyValueExpr' && elt.key.type === 'Ident') {
+          const field = u.fields.find(f => f.name === (elt.key as Ident).name);
+          if (field) this.info.uses.set(elt.key, field);
+          this.checkExpr(elt.value, scope, ctx, field?.type);
+        } else {
+          this.checkExpr(elt, scope, ctx, u.fields[i]?.type);
+        }
+      });
+    } else if (u.kind === 'slice' || u.kind === 'array' || u.kind === 'map') {
+      const keyType = u.kind === 'map' ? u.key : undefined;
+      for (const elt of e.elts) {
+        if (elt.type === 'KeyValueExpr') {
+          this.checkExpr(elt.key, scope, ctx, keyType);
+          this.checkExpr(elt.value, scope, ctx, u.elem);
+        } else {
+          this.checkExpr(elt, scope, ctx, u.elem);
+        }
+      }
+    } else {
+      // Unknown literal type: keys may be field names of an external
+      // struct, so only values are resolved.
+      for (const elt of e.elts) {
+        if (elt.type === 'KeyValueExpr') {
+          if (elt.key.type !== 'Ident') this.checkExpr(elt.key, scope, ctx);
+          this.checkExpr(elt.value, scope, ctx);
+        } else {
+          this.checkExpr(elt, scope, ctx);
+        }
+      }
+    }
+    return value(t);
+  }
+
+  private checkCall(e: CallExpr, scope: Scope, ctx: CheckContext, expected?: Type): Operand {
+    const fun = this.checkExpr(e.fun, scope, ctx);
+
+    if (fun.mode === 'type') {
+      for (const a of e.args) this.checkExpr(a, scope, ctx, fun.type);
+      return value(fun.type);
+    }
+
+    if (fun.mode === 'builtin') {
+      return this.checkBuiltin(fun.obj!.name, e, scope, ctx, expected);
+    }
+
+    const sig = fun.type.kind === 'signature' ? fun.type : undefined;
+    if (!sig) {
+      for (const a of e.args) this.checkExpr(a, scope, ctx);
+      return invalid();
+    }
+
+    const paramType = (i: number): Type | undefined => {
+      if (sig.variadic && i >= sig.params.length - 1) {
+        const last = sig.params[sig.params.length - 1]?.type;
+        if (e.ellipsis !== undefined) return last;
+        return last?.kind === 'slice' ? last.elem : undefined;
+      }
+      return sig.params[i]?.type;
+    };
+    const argTypes = e.args.map((a, i) => this.checkExpr(a, scope, ctx, paramType(i)).type);
+
+    let results = sig.results.map(r => r.type ?? INVALID);
+    if (sig.typeParams && sig.typeParams.length > 0) {
+      const m = new Map<GoObject, Type>();
+      let flatArgs = argTypes;
+      if (argTypes.length === 1 && argTypes[0].kind === 'tuple') flatArgs = argTypes[0].types;
+      flatArgs.forEach((t, i) => {
+        const p = paramType(i);
+        if (p) unify(p, t, m, sig.typeParams!);
+      });
+      for (const tp of sig.typeParams) {
+        const bound = m.get(tp);
+        if (bound) m.set(tp, defaultType(bound));
+      }
+      inferFromConstraints(sig.typeParams, m);
+      const resolved = typeArgMap(sig.typeParams, m);
+      results = results.map(r => subst(r, resolved));
+    }
+
+    if (results.length === 0) return OK_OPERAND;
+    if (results.length === 1) return value(results[0]);
+    return value({ kind: 'tuple', types: results });
+  }
+
+  private checkBuiltin(name: string, e: CallExpr, scope: Scope, ctx: CheckContext, expected?: Type): Operand {
+    const argType = (i: number) => (e.args[i] ? this.checkExpr(e.args[i], scope, ctx).type : INVALID);
+    switch (name) {
+      case 'make':
+      case 'new': {
+        const t = e.args[0] ? this.typeExpr(e.args[0], scope, ctx) : INVALID;
+        for (const a of e.args.slice(1)) this.checkExpr(a, scope, ctx);
+        return value(name === 'new' ? { kind: 'pointer', elem: t } : t);
+      }
+      case 'len':
+      case 'cap':
+      case 'copy':
+        e.args.forEach((_, i) => argType(i));
+        return value(basic('int'));
+      case 'append': {
+        const first = e.args[0] ? this.checkExpr(e.args[0], scope, ctx, expected).type : INVALID;
+        const u = under(first);
+        for (const a of e.args.slice(1)) {
+          this.checkExpr(a, scope, ctx, u.kind === 'slice' && e.ellipsis === undefined ? u.elem : undefined);
+        }
+        return value(first.kind === 'basic' && first.name === 'untyped nil' ? expected ?? INVALID : first);
+      }
+      case 'min':
+      case 'max': {
+        const types = e.args.map((_, i) => argType(i));
+        return value(types.find(t => !isUntyped(t)) ?? types[0] ?? INVALID);
+      }
+      case 'complex':
+        e.args.forEach((_, i) => argType(i));
+        return value(basic('complex128'));
+      case 'real':
+      case 'imag':
+        e.args.forEach((_, i) => argType(i));
+        return value(basic('float64'));
+      case 'recover':
+        return value(ANY);
+      default:
+        e.args.forEach((_, i) => argType(i));
+        return OK_OPERAND;
+    }
+  }
+
+  // --------------------------------------------------------------------------
+  // Statements
+
+  private collectLabels(body: BlockStmt, labels: Scope, ctx: CheckContext): void {
+    const visit = (s: Stmt) => {
+      switch (s.type) {
+        case 'LabeledStmt': {
+          const obj: GoObject = {
+            kind: 'label',
+            name: s.label.name,
+            pos: s.label.pos,
+            file: ctx.file,
+            pkg: ctx.file.pkg,
+            decl: s,
+          };
+          this.info.defs.set(s.label, obj);
+          labels.insert(obj);
+          visit(s.stmt);
+          break;
+        }
+        case 'BlockStmt':
+          s.list.forEach(visit);
+          break;
+        case 'IfStmt':
+          visit(s.body);
+          if (s.else) visit(s.else);
+          break;
+        case 'ForStmt':
+        case 'RangeStmt':
+        case 'SelectStmt':
+        case 'SwitchStmt':
+        case 'TypeSwitchStmt':
+          visit(s.body);
+          break;
+        case 'CaseClause':
+        case 'CommClause':
+          s.body.forEach(visit);
+          break;
+      }
+    };
+    visit(body);
+  }
+
+  private checkBody(body: BlockStmt, scope: Scope, ctx: CheckContext): void {
+    const labels = new Scope(undefined, 'block', body.pos, body.end);
+    this.collectLabels(body, labels, ctx);
+    const bodyCtx: CheckContext = { ...ctx, labels };
+    this.info.scopes.set(body, scope);
+    for (const s of body.list) this.checkStmt(s, scope, bodyCtx);
+  }
+
+  private declareVar(id: Ident, t: Type, scope: Scope, ctx: CheckContext, decl: Node): GoObject {
+    const obj: GoObject = {
+      kind: 'var',
+      name: id.name,
+      pos: id.pos,
+      file: ctx.file,
+      pkg: ctx.file.pkg,
+      decl,
+      type: t,
+    };
+    this.info.defs.set(id, obj);
+    if (id.name !== '_') scope.insert(obj);
+    return obj;
+  }
+
+  // Returns the types assigned to n variables from rhs.
+  private assignedTypes(n: number, rhs: Expr[], scope: Scope, ctx: CheckContext, expected?: Type): Type[] {
+    if (rhs.length === n) {
+      return rhs.map(r => this.checkExpr(r, scope, ctx, expected).type);
+    }
+    if (rhs.length === 1) {
+      const r = unparen(rhs[0]);
+      const t = this.checkExpr(rhs[0], scope, ctx, expected).type;
+      if (t.kind === 'tuple') return t.types;
+      const commaOk =
+        r.type === 'IndexExpr' ||
+        r.type === 'TypeAssertExpr' ||
+        (r.type === 'UnaryExpr' && r.op === '<-');
+      if (commaOk && n === 2) return [t, UNTYPED_BOOL];
+    }
+    for (const r of rhs) this.checkExpr(r, scope, ctx);
+    return new Array(n).fill(INVALID);
+  }
+
+  private checkDeclStmt(decl: Stmt & { type: 'DeclStmt' }, scope: Scope, ctx: CheckContext): void {
+    const gen = decl.decl;
+    if (gen.tok === 'type') {
+      for (const spec of gen.specs) {
+        if (spec.type !== 'TypeSpec') continue;
+        const obj = this.newTypeName(spec, ctx.file, ctx.file.pkg);
+        if (spec.name.name !== '_') scope.insert(obj);
+        this.resolveTypeName(obj);
+      }
+      return;
+    }
+    let last: ValueSpec | undefined;
+    for (const spec of gen.specs) {
+      if (spec.type !== 'ValueSpec') continue;
+      let src = spec;
+      if (gen.tok === 'const') {
+        if (spec.values.length > 0 || spec.valueType) last = spec;
+        else if (last) {
+          src = last;
+          this.constSource.set(spec, last);
+        }
+      }
+      const declared = src.valueType ? this.typeExpr(src.valueType, scope, ctx) : undefined;
+      let types: Type[];
+      if (src.values.length > 0) {
+        types = this.assignedTypes(spec.names.length, src.values, scope, ctx, declared);
+      } else {
+        types = new Array(spec.names.length).fill(declared ?? INVALID);
+      }
+      spec.names.forEach((name, i) => {
+        let t = declared ?? types[i] ?? INVALID;
+        if (gen.tok === 'var') t = defaultType(t);
+        const obj = this.declareVar(name, t, scope, ctx, spec);
+        if (gen.tok === 'const') {
+          obj.kind = 'const';
+          obj.iota = spec.iota;
+        }
+      });
+    }
+  }
+
+  private checkAssign(s: AssignStmt, scope: Scope, ctx: CheckContext): void {
+    if (s.tok !== ':=') {
+      for (const l of s.lhs) {
+        if (l.type === 'Ident' && l.name === '_') continue;
+        this.checkExpr(l, scope, ctx);
+      }
+      const lhsType = s.lhs.length === 1 ? this.info.typeOf(s.lhs[0]) : undefined;
+      if (s.lhs.length === s.rhs.length) {
+        s.rhs.forEach((r, i) => this.checkExpr(r, scope, ctx, this.info.typeOf(s.lhs[i]) ?? lhsType));
+      } else {
+        for (const r of s.rhs) this.checkExpr(r, scope, ctx);
+      }
+      return;
+    }
+
+    const types = this.assignedTypes(s.lhs.length, s.rhs, scope, ctx);
+    s.lhs.forEach((l, i) => {
+      if (l.type !== 'Ident') {
+        this.checkExpr(l, scope, ctx);
+        return;
+      }
+      const existing = l.name === '_' ? undefined : scope.lookup(l.name);
+      if (existing) {
+        // Redeclaration in the same scope is an assignment.
+        this.info.uses.set(l, existing);
+        this.info.types.set(l, { mode: 'value', type: existing.type ?? INVALID, obj: existing });
+        return;
+      }
+      const obj = this.declareVar(l, defaultType(types[i] ?? INVALID), scope, ctx, s);
+      this.info.types.set(l, { mode: 'value', type: obj.type!, obj });
+    });
+  }
+
+  private rangeTypes(x: Type): [Type, Type] {
+    const u = under(deref(x).type);
+    switch (u.kind) {
+      case 'basic':
+        if (u.name === 'string' || u.name === 'untyped string') return [basic('int'), basic('rune')];
+        return [defaultType(x), INVALID];
+      case 'slice':
+      case 'array':
+        return [basic('int'), u.elem];
+      case 'map':
+        return [u.key, u.elem];
+      case 'chan':
+        return [u.elem, INVALID];
+      case 'signature': {
+        const yieldSig = u.params[0]?.type;
+        if (yieldSig?.kind === 'signature') {
+          return [yieldSig.params[0]?.type ?? INVALID, yieldSig.params[1]?.type ?? INVALID];
+        }
+      }
+    }
+    return [INVALID, INVALID];
+  }
+
+  checkStmt(s: Stmt, scope: Scope, ctx: CheckContext): void {
+    switch (s.type) {
+      case 'BadStmt':
+      case 'EmptyStmt':
+        return;
+      case 'DeclStmt':
+        this.checkDeclStmt(s, scope, ctx);
+        return;
+      case 'LabeledStmt':
+        this.checkStmt(s.stmt, scope, ctx);
+        return;
+      case 'ExprStmt':
+        this.checkExpr(s.x, scope, ctx);
+        return;
+      case 'SendStmt': {
+        const ch = this.checkExpr(s.chan, scope, ctx);
+        const u = under(ch.type);
+        this.checkExpr(s.value, scope, ctx, u.kind === 'chan' ? u.elem : undefined);
+        return;
+      }
+      case 'IncDecStmt':
+        this.checkExpr(s.x, scope, ctx);
+        return;
+      case 'AssignStmt':
+        this.checkAssign(s, scope, ctx);
+        return;
+      case 'GoStmt':
+      case 'DeferStmt':
+        this.checkExpr(s.call, scope, ctx);
+        return;
+      case 'ReturnStmt':
+        s.results.forEach((r, i) => {
+          const expected = s.results.length === ctx.sig?.results.length ? ctx.sig.results[i].type : undefined;
+          this.checkExpr(r, scope, ctx, expected);
+        });
+        return;
+      case 'BranchStmt':
+        if (s.label) {
+          const obj = ctx.labels?.lookup(s.label.name);
+          if (obj) this.info.uses.set(s.label, obj);
+        }
+        return;
+      case 'BlockStmt': {
+        const inner = new Scope(scope, 'block', s.pos, s.end);
+        this.info.scopes.set(s, inner);
+        for (const x of s.list) this.checkStmt(x, inner, ctx);
+        return;
+      }
+      case 'IfStmt': {
+        const inner = new Scope(scope, 'block', s.pos, s.end);
+        this.info.scopes.set(s, inner);
+        if (s.init) this.checkStmt(s.init, inner, ctx);
+        this.checkExpr(s.cond, inner, ctx);
+        this.checkStmt(s.body, inner, ctx);
+        if (s.else) this.checkStmt(s.else, inner, ctx);
+        return;
+      }
+      case 'SwitchStmt': {
+        const inner = new Scope(scope, 'block', s.pos, s.end);
+        this.info.scopes.set(s, inner);
+        if (s.init) this.checkStmt(s.init, inner, ctx);
+        const tag = s.tag ? this.checkExpr(s.tag, inner, ctx).type : undefined;
+        for (const c of s.body.list) {
+          if (c.type !== 'CaseClause') continue;
+          const cscope = new Scope(inner, 'block', c.pos, c.end);
+          this.info.scopes.set(c, cscope);
+          for (const x of c.list ?? []) this.checkExpr(x, inner, ctx, tag);
+          for (const x of c.body) this.checkStmt(x, cscope, ctx);
+        }
+        return;
+      }
+      case 'TypeSwitchStmt': {
+        const inner = new Scope(scope, 'block', s.pos, s.end);
+        this.info.scopes.set(s, inner);
+        if (s.init) this.checkStmt(s.init, inner, ctx);
+        let symbol: Ident | undefined;
+        let guard: Expr | undefined;
+        if (s.assign.type === 'AssignStmt') {
+          symbol = s.assign.lhs[0] as Ident;
+          guard = s.assign.rhs[0];
+        } else if (s.assign.type === 'ExprStmt') {
+          guard = s.assign.x;
+        }
+        let xType: Type = INVALID;
+        if (guard?.type === 'TypeAssertExpr') {
+          xType = this.checkExpr(guard.x, inner, ctx).type;
+        }
+        let header: GoObject | undefined;
+        if (symbol && symbol.name !== '_') {
+          header = { kind: 'var', name: symbol.name, pos: symbol.pos, file: ctx.file, pkg: ctx.file.pkg, decl: s, type: xType };
+          this.info.defs.set(symbol, header);
+        }
+        for (const c of s.body.list) {
+          if (c.type !== 'CaseClause') continue;
+          const cscope = new Scope(inner, 'block', c.pos, c.end);
+          this.info.scopes.set(c, cscope);
+          const caseTypes = (c.list ?? []).map(x => {
+            if (x.type === 'Ident' && x.name === 'nil') {
+              this.checkExpr(x, inner, ctx);
+              return UNTYPED_NIL;
+            }
+            return this.typeExpr(x, inner, ctx);
+          });
+          if (header) {
+            const t = caseTypes.length === 1 && caseTypes[0] !== UNTYPED_NIL ? caseTypes[0] : xType;
+            const implicit: GoObject = { ...header, type: t, parent: undefined };
+            cscope.insert(implicit);
+            this.info.implicits.set(c, implicit);
+          }
+          for (const x of c.body) this.checkStmt(x, cscope, ctx);
+        }
+        return;
+      }
+      case 'SelectStmt':
+        for (const c of s.body.list) {
+          if (c.type !== 'CommClause') continue;
+          const cscope = new Scope(scope, 'block', c.pos, c.end);
+          this.info.scopes.set(c, cscope);
+          if (c.comm) this.checkStmt(c.comm, cscope, ctx);
+          for (const x of c.body) this.checkStmt(x, cscope, ctx);
+        }
+        return;
+      case 'ForStmt': {
+        const inner = new Scope(scope, 'block', s.pos, s.end);
+        this.info.scopes.set(s, inner);
+        if (s.init) this.checkStmt(s.init, inner, ctx);
+        if (s.cond) this.checkExpr(s.cond, inner, ctx);
+        if (s.post) this.checkStmt(s.post, inner, ctx);
+        this.checkStmt(s.body, inner, ctx);
+        return;
+      }
+      case 'RangeStmt': {
+        const inner = new Scope(scope, 'block', s.pos, s.end);
+        this.info.scopes.set(s, inner);
+        const x = this.checkExpr(s.x, scope, ctx);
+        const [kt, vt] = this.rangeTypes(x.type);
+        if (s.tok === ':=') {
+          if (s.key?.type === 'Ident') this.declareVar(s.key, kt, inner, ctx, s);
+          if (s.value?.type === 'Ident') this.declareVar(s.value, vt, inner, ctx, s);
+        } else {
+          if (s.key) this.checkExpr(s.key, scope, ctx);
+          if (s.value) this.checkExpr(s.value, scope, ctx);
+        }
+        this.checkStmt(s.body, inner, ctx);
+        return;
+      }
+      case 'CaseClause':
+      case 'CommClause':
+        return;
+    }
+  }
+
+  // --------------------------------------------------------------------------
+  // Packages
+
+  checkPackage(pkg: GoPackage): void {
+    if (this.checked.has(pkg)) return;
+    this.checked.add(pkg);
+    this.collect(pkg);
+
+    for (const file of pkg.files) {
+      const ctx: CheckContext = { file };
+      const scope = file.scope!;
+      for (const decl of file.ast.decls) {
+        if (decl.type === 'FuncDecl') {
+          const sig = this.funcDeclSignature(decl, file);
+          const obj = this.info.defs.get(decl.name);
+          if (obj && !obj.type) obj.type = sig;
+          if (decl.body) {
+            this.checkBody(decl.body, this.funcScope(decl, file), { file, sig });
+          }
+          continue;
+        }
+        if (decl.type !== 'GenDecl') continue;
+        for (const spec of decl.specs) {
+          if (spec.type === 'TypeSpec') {
+            const obj = this.info.defs.get(spec.name);
+            if (obj) this.resolveTypeName(obj);
+          } else if (spec.type === 'ValueSpec') {
+            for (const name of spec.names) {
+              const obj = this.info.defs.get(name);
+              if (obj) this.objectType(obj);
+            }
+            const src = this.constSource.get(spec) ?? spec;
+            if (src === spec) {
+              const declared = spec.valueType ? this.typeExpr(spec.valueType, scope, ctx) : undefined;
+              for (const v of spec.values) this.checkExpr(v, scope, ctx, declared);
+            }
+          }
+        }
+      }
+    }
+  }
+
+  // --------------------------------------------------------------------------
+  // Constants
+
+  // Evaluates a constant expression. Integers are returned as bigint.
+  constValue(e: Expr, scope: Scope, ctx: CheckContext, iota?: number): ConstValue | undefined {
+    switch (e.type) {
+      case 'BasicLit':
+        switch (e.kind) {
+          case 'INT':
+            return parseGoInt(e.value);
+          case 'FLOAT':
+            return Number(e.value.replace(/_/g, ''));
+          case 'CHAR':
+            return BigInt(unquoteGoString(e.value).codePointAt(0) ?? 0);
+          case 'STRING':
+            return unquoteGoString(e.value);
+        }
+        return undefined;
+      case 'ParenExpr':
+        return this.constValue(e.x, scope, ctx, iota);
+      case 'Ident': {
+        if (e.name === 'iota' && iota !== undefined && scope.lookupParent('iota') === universe.lookup('iota')) {
+          return BigInt(iota);
+        }
+        const obj = this.info.uses.get(e) ?? scope.lookupParent(e.name);
+        return obj ? this.objectConstValue(obj) : undefined;
+      }
+      case 'SelectorExpr': {
+        const obj = this.info.uses.get(e.sel);
+        return obj ? this.objectConstValue(obj) : undefined;
+      }
+      case 'UnaryExpr': {
+        const x = this.constValue(e.x, scope, ctx, iota);
+        if (x === undefined) return undefined;
+        switch (e.op) {
+          case '-':
+            return typeof x === 'bigint' ? -x : typeof x === 'number' ? -x : undefined;
+          case '+':
+            return x;
+          case '!':
+            return typeof x === 'boolean' ? !x : undefined;
+          case '^':
+            return typeof x === 'bigint' ? ~x : undefined;
+        }
+        return undefined;
+      }
+      case 'BinaryExpr': {
+        const x = this.constValue(e.x, scope, ctx, iota);
+        const y = this.constValue(e.y, scope, ctx, iota);
+        if (x === undefined || y === undefined) return undefined;
+        return binaryConst(e.op, x, y);
+      }
+      case 'CallExpr': {
+        const fun = unparen(e.fun);
+        if (fun.type === 'Ident' && fun.name === 'len' && e.args.length === 1) {
+          const s = this.constValue(e.args[0], scope, ctx, iota);
+          return typeof s === 'string' ? BigInt(Buffer.byteLength(s, 'utf-8')) : undefined;
+        }
+        if (e.args.length === 1 && this.info.types.get(e.fun)?.mode === 'type') {
+          return this.constValue(e.args[0], scope, ctx, iota);
+        }
+        return undefined;
+      }
+    }
+    return undefined;
+  }
+
+  objectConstValue(obj: GoObject): ConstValue | undefined {
+    if (obj.pos < 0) {
+      if (obj.name === 'true') return true;
+      if (obj.name === 'false') return false;
+      return undefined;
+    }
+    if (obj.kind !== 'const' || obj.decl?.type !== 'ValueSpec' || !obj.file) return undefined;
+    if (this.resolving.has(obj)) return undefined;
+    const spec = obj.decl;
+    const src = this.constSource.get(spec) ?? spec;
+    const index = spec.names.findIndex(n => n.pos === obj.pos);
+    const valueExpr = src.values[index];
+    if (!valueExpr) return undefined;
+    const scope = declScope(obj);
+    this.resolving.add(obj);
+    try {
+      return this.constValue(valueExpr, scope, { file: obj.file }, spec.iota);
+    } finally {
+      this.resolving.delete(obj);
+    }
+  }
+}
+
+// Returns the scope in which the declaration of obj is evaluated. Package
+// level declarations see the imports of their own file.
+function declScope(obj: GoObject): Scope {
+  if (!obj.parent || obj.parent.kind === 'package') return obj.file!.scope!;
+  return obj.parent;
+}
+
+function untypedRank(t: Type): number {
+  if (t.kind !== 'basic') return 0;
+  return ['untyped int', 'untyped rune', 'untyped float', 'untyped complex'].indexOf(t.name);
+}
+
+// Infers type arguments by matching a parameter type against an argument
+// type.
+function unify(param: Type, arg: Type, m: Map<GoObject, Type>, typeParams: GoObject[]): void {
+  switch (param.kind) {
+    case 'typeparam': {
+      const tp = typeParams.find(p => p.type?.kind === 'typeparam' && p.type.obj === param.obj);
+      if (tp && !m.has(tp) && arg.kind !== 'invalid' && !(arg.kind === 'basic' && arg.name === 'untyped nil')) {
+        m.set(tp, arg);
+      }
+      return;
+    }
+    case 'pointer':
+    case 'slice':
+    case 'array':
+    case 'chan': {
+      const u = arg.kind === 'named' ? under(arg) : arg;
+      if (u.kind === param.kind) unify(param.elem, (u as { elem: Type }).elem, m, typeParams);
+      return;
+    }
+    case 'map': {
+      const u = arg.kind === 'named' ? under(arg) : arg;
+      if (u.kind === 'map') {
+        unify(param.key, u.key, m, typeParams);
+        unify(param.elem, u.elem, m, typeParams);
+      }
+      return;
+    }
+    case 'named':
+      if (arg.kind === 'named' && param.typeArgs && arg.typeArgs) {
+        param.typeArgs.forEach((t, i) => {
+          if (arg.typeArgs![i]) unify(t, arg.typeArgs![i], m, typeParams);
+        });
+      }
+      return;
+    case 'signature':
+      // A generic function passed as an argument has type parameters of
+      // its own, which only go/types' reverse inference could relate.
+      if (arg.kind === 'signature' && !arg.typeParams?.length) {
+        param.params.forEach((p, i) => {
+          if (p.type && arg.params[i]?.type) unify(p.type, arg.params[i].type!, m, typeParams);
+        });
+        param.results.forEach((p, i) => {
+          if (p.type && arg.results[i]?.type) unify(p.type, arg.results[i].type!, m, typeParams);
+        });
+      }
+      return;
+    case 'interface':
+      // The methods of the argument give the type arguments in those of
+      // the interface, as in g interface{ Get() T }.
+      for (const method of param.methods) {
+        const sel = method.type && lookupFieldOrMethod(arg, method.name);
+        if (sel && sel.kind === 'method') unify(method.type!, sel.type, m, typeParams);
+      }
+      return;
+  }
+}
+
+// Maps the type parameters to the type arguments inferred for them, keyed
+// as subst expects.
+function typeArgMap(typeParams: GoObject[], m: Map<GoObject, Type>): Map<GoObject, Type> {
+  const resolved = new Map<GoObject, Type>();
+  for (const tp of typeParams) {
+    const t = m.get(tp);
+    if (t) resolved.set(tp.type?.kind === 'typeparam' ? tp.type.obj : tp, t);
+  }
+  return resolved;
+}
+
+// Infers type arguments from the constraints with a single type term, as
+// in S ~[]E: the type argument of S gives that of E, and the term gives S
+// once E is known, until no more can be inferred.
+function inferFromConstraints(typeParams: GoObject[], m: Map<GoObject, Type>): void {
+  const isParam = (t: Type) => t.kind === 'typeparam' && typeParams.some(p => p.type?.kind === 'typeparam' && p.type.obj === t.obj);
+  for (let changed = true; changed; ) {
+    changed = false;
+    for (const tp of typeParams) {
+      const c = tp.constraint && under(tp.constraint);
+      if (c?.kind !== 'interface' || c.terms?.length !== 1) continue;
+      const term = c.terms[0];
+      const bound = m.get(tp);
+      const before = m.size;
+      if (bound) {
+        unify(term, bound.kind === 'named' ? under(bound) : bound, m, typeParams);
+      } else {
+        const t = subst(term, typeArgMap(typeParams, m));
+        if (!typeContains(t, isParam)) m.set(tp, t);
+      }
+      if (m.size > before) changed = true;
+    }
+  }
+}
+
+function parseGoInt(lit: string): bigint | undefined {
+  const s = lit.replace(/_/g, '');
+  try {
+    if (/^0[0-7]+$/.test(s)) return BigInt('0o' + s.slice(1));
+    return BigInt(s.replace(/^0O/, '0o').replace(/^0X/, '0x').replace(/^0B/, '0b'));
+  } catch {
+    return undefined;
+  }
+}
+
+function compareConst(x: ConstValue, y: ConstValue): number | undefined {
+  if (typeof x === 'string' && typeof y === 'string') {
+    return x < y ? -1 : x > y ? 1 : 0;
+  }
+  if (typeof x === 'bigint' && typeof y === 'bigint') {
+    return x < y ? -1 : x > y ? 1 : 0;
+  }
+  if (
+    (typeof x === 'number' || typeof x === 'bigint') &&
+    (typeof y === 'number' || typeof y === 'bigint')
+  ) {
+    return Number(x) - Number(y);
+  }
+  return undefined;
+}
+
+function binaryConst(op: string, x: ConstValue, y: ConstValue): ConstValue | undefined {
+  if (typeof x === 'bigint' && typeof y === 'bigint') {
+    switch (op) {
+      case '+':
+        return x + y;
+      case '-':
+        return x - y;
+      case '*':
+        return x * y;
+      case '/':
+        return y === 0n ? undefined : x / y;
+      case '%':
+        return y === 0n ? undefined : x % y;
+      case '<<':
+        return x << y;
+      case '>>':
+        return x >> y;
+      case '&':
+        return x & y;
+      case '|':
+        return x | y;
+      case '^':
+        return x ^ y;
+      case '&^':
+        return x & ~y;
+    }
+  }
+  if (typeof x === 'string' && typeof y === 'string' && op === '+') {
+    return x + y;
+  }
+  if ((typeof x === 'number' || typeof x === 'bigint') && (typeof y === 'number' || typeof y === 'bigint')) {
+    const a = Number(x);
+    const b = Number(y);
+    switch (op) {
+      case '+':
+        return a + b;
+      case '-':
+        return a - b;
+      case '*':
+        return a * b;
+      case '/':
+        return a / b;
+    }
+  }
+  switch (op) {
+    case '==':
+      return x === y;
+    case '!=':
+      return x !== y;
+  }
+  const cmp = compareConst(x, y);
+  switch (op) {
+    case '<':
+      return cmp === undefined ? undefined : cmp < 0;
+    case '<=':
+      return cmp === undefined ? undefined : cmp <= 0;
+    case '>':
+      return cmp === undefined ? undefined : cmp > 0;
+    case '>=':
+      return cmp === undefined ? undefined : cmp >= 0;
+    case '&&':
+      return typeof x === 'boolean' && typeof y === 'boolean' ? x && y : undefined;
+    case '||':
+      return typeof x === 'boolean' && typeof y === 'boolean' ? x || y : undefined;
+  }
+  return undefined;
+}
+
+// Returns the identifier naming an embedded field: T, *T, pkg.T or T[A].
+export function embeddedFieldName(t: Expr): Ident | undefined {
+  let x = unparen(t);
+  if (x.type === 'StarExpr') x = unparen(x.x);
+  if (x.type === 'IndexExpr') x = x.x;
+  if (x.type === 'Ident') return x;
+  if (x.type === 'SelectorExpr') return x.sel;
+  return undefined;
+}
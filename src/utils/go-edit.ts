@@ -0,0 +1,772 @@
+// Helpers shared by the Go refactoring tools for producing source text:
+// qualifying type names from the point of view of a file, adding and
+// removing imports and declarations, and moving statements between
+// indentation levels.
+
+import type {
+  BasicLit,
+  Decl,
+  Expr,
+  File,
+  GenDecl,
+  ImportSpec,
+  Node,
+  Spec,
+} from './go-ast.js';
+import { inspect, isExported, pathEnclosingInterval } from './go-ast.js';
+import { declaredAt, scopeAt } from './go-analysis.js';
+import type { GoInfo } from './go-checker.js';
+import type { GoProgram } from './go-loader.js';
+import { parseGoExpr, parseGoFile } from './go-parser.js';
+import { errorLocation, locationOf } from './go-references.js';
+import { unquoteGoString } from './go-scanner.js';
+import { applyTextEdits } from './edit-utils.js';
+import type { TextEdit } from './edit-utils.js';
+import { defaultPackageName, under } from './go-types.js';
+import { computeLineStarts } from './line-utils.js';
+import { ToolError } from './tool-error.js';
+import type {
+  GoPackage,
+  GoSourceFile,
+  Qualifier,
+  Scope,
+  Type,
+} from './go-types.js';
+
+export interface ImportRequest {
+  path: string;
+  // The package name used in the file, which becomes an explicit import
+  // name when it differs from the one implied by the path.
+  name: string;
+}
+
+export function importPathOf(spec: ImportSpec): string {
+  return unquoteGoString(spec.path.value);
+}
+
+// Returns a qualifier that names packages the way file refers to them.
+// Packages the file does not import yet are qualified by their package name
+// and collected in missing, so that the caller can add the imports.
+export function fileQualifier(
+  file: GoSourceFile,
+  missing: ImportRequest[] = []
+): Qualifier {
+  const imported = new Map<string, string>();
+  for (const spec of file.ast.imports) {
+    const name = spec.name?.name;
+    if (name === '_') continue;
+    imported.set(importPathOf(spec), name ?? '');
+  }
+  return pkg => {
+    if (pkg.path === file.pkg.importPath && !file.pkg.isXTest) return '';
+    const local = imported.get(pkg.path);
+    if (local !== undefined) {
+      if (local === '.') return '';
+      return local || pkg.name;
+    }
+    if (!missing.some(m => m.path === pkg.path)) {
+      missing.push({ path: pkg.path, name: pkg.name });
+    }
+    return pkg.name;
+  };
+}
+
+// Formats the import spec of request.
+export function importLine(request: ImportRequest): string {
+  const implied = defaultPackageName(request.path);
+  const name =
+    request.name && request.name !== implied ? `${request.name} ` : '';
+  return `${name}"${request.path}"`;
+}
+
+// Returns the edits that add the requested imports to file. Imports the
+// file already has are skipped. New imports go into the first import
+// declaration, in sorted position within the matching group.
+export function addImportEdits(
+  file: GoSourceFile,
+  requests: ImportRequest[]
+): TextEdit[] {
+  const existing = new Set(file.ast.imports.map(importPathOf));
+  const wanted = requests
+    .filter(r => !existing.has(r.path))
+    .sort((a, b) => (a.path < b.path ? -1 : a.path > b.path ? 1 : 0));
+  if (wanted.length === 0) return [];
+
+  const decl = file.ast.decls.find(
+    (d): d is GenDecl => d.type === 'GenDecl' && d.tok === 'import'
+  );
+  if (!decl) {
+    const text =
+      wanted.length === 1
+        ? `import ${importLine(wanted[0])}`
+        : `import (\n${wanted.map(r => `\t${importLine(r)}\n`).join('')})`;
+    const pos = file.ast.name.end;
+    return [{ pos, end: pos, newText: `\n\n${text}` }];
+  }
+
+  const specs = decl.specs as ImportSpec[];
+  if (decl.lparen < 0) {
+    const lines = specs.map(s => file.src.substring(s.pos, s.end));
+    lines.push(...wanted.map(importLine));
+    lines.sort((a, b) => {
+      const pa = a.replace(/^[^"`]*/, '');
+      const pb = b.replace(/^[^"`]*/, '');
+      return pa < pb ? -1 : pa > pb ? 1 : 0;
+    });
+    return [
+      {
+        pos: decl.pos,
+        end: decl.end,
+        newText: `import (\n${lines.map(l => `\t${l}\n`).join('')})`,
+      },
+    ];
+  }
+
+  // Standard library imports and the rest are conventionally kept in
+  // separate groups, which are delimited by blank lines.
+  const isStd = (path: string) => !path.split('/')[0].includes('.');
+  const groups: ImportSpec[][] = [];
+  specs.forEach((spec, i) => {
+    const prev = specs[i - 1];
+    if (!prev || /\n[ \t]*\n/.test(file.src.substring(prev.end, spec.pos))) {
+      groups.push([]);
+    }
+    groups[groups.length - 1].push(spec);
+  });
+
+  const edits: TextEdit[] = [];
+  const ungrouped: string[] = [];
+  for (const request of wanted) {
+    const group = groups.find(g =>
+      g.every(s => isStd(importPathOf(s)) === isStd(request.path))
+    );
+    if (!group) {
+      ungrouped.push(`\t${importLine(request)}\n`);
+      continue;
+    }
+    const before = group.find(s => importPathOf(s) > request.path);
+    const pos = before
+      ? lineStart(file.src, before.pos)
+      : lineEnd(file.src, group[group.length - 1].end);
+    edits.push({ pos, end: pos, newText: `\t${importLine(request)}\n` });
+  }
+  if (ungrouped.length > 0) {
+    const pos = lineStart(file.src, decl.rparen);
+    const sep = specs.length > 0 ? '\n' : '';
+    edits.push({ pos, end: pos, newText: sep + ungrouped.join('') });
+  }
+  return edits;
+}
+
+// Returns the file to create at filePath, holding just the package clause,
+// after the build constraint line if one is given.
+export function newGoFile(
+  filePath: string,
+  pkg: GoPackage,
+  constraint?: string
+): GoSourceFile {
+  const clause = `package ${pkg.name}\n`;
+  const src = constraint ? `${constraint}\n\n${clause}` : clause;
+  return {
+    filePath,
+    src,
+    ast: parseGoFile(filePath, src),
+    lineStarts: computeLineStarts(src),
+    pkg,
+  };
+}
+
+// Returns the edit deleting decl together with its doc comment and one of
+// the blank lines around it.
+export function declRemovalEdit(src: string, decl: Decl): TextEdit {
+  let pos = lineStart(src, decl.doc?.pos ?? decl.pos);
+  let end = lineEnd(src, decl.end - 1);
+  if (/^[ \t]*\n/.test(src.substring(end))) {
+    end = lineEnd(src, end);
+  } else if (pos >= 2 && src.substring(pos - 2, pos) === '\n\n') {
+    pos--;
+  }
+  return { pos, end, newText: '' };
+}
+
+function importedNames(ast: File): Set<string> {
+  const names = new Set<string>();
+  inspect(ast, n => {
+    if (n.type === 'SelectorExpr' && n.x.type === 'Ident') names.add(n.x.name);
+  });
+  return names;
+}
+
+// Removes from updated, the new content of file, the imports that file
+// used but updated no longer does. Usage is judged syntactically by the
+// qualified identifiers of both versions. With all, the imports file did
+// not use either go too, when the name of their package is known.
+export function pruneImports(
+  file: GoSourceFile,
+  info: GoInfo,
+  updated: string,
+  all = false
+): string {
+  const before = importedNames(file.ast);
+  const names = new Map<string, string>();
+  for (const spec of file.ast.imports) {
+    const known = spec.name?.name ?? info.implicits.get(spec)?.name;
+    const name = known ?? defaultPackageName(importPathOf(spec));
+    if (name !== '_' && name !== '.' && (before.has(name) || (all && known))) {
+      names.set(importPathOf(spec), name);
+    }
+  }
+  if (names.size === 0) return updated;
+
+  const ast = parseGoFile(file.filePath, updated);
+  const after = importedNames(ast);
+  const edits: TextEdit[] = [];
+  for (const decl of ast.decls) {
+    if (decl.type !== 'GenDecl' || decl.tok !== 'import') continue;
+    const specs = decl.specs as ImportSpec[];
+    const unused = specs.filter(spec => {
+      const name = names.get(importPathOf(spec));
+      return name !== undefined && !after.has(spec.name?.name ?? name);
+    });
+    if (unused.length === 0) continue;
+    if (unused.length === specs.length) {
+      edits.push(declRemovalEdit(updated, decl));
+      continue;
+    }
+    for (const spec of unused) edits.push(specRemovalEdit(updated, spec));
+  }
+  return applyTextEdits(updated, edits);
+}
+
+// Returns the edit deleting spec from a grouped declaration. A spec that is
+// alone in its group takes the blank line separating the group with it.
+export function specRemovalEdit(src: string, spec: Spec): TextEdit {
+  let pos = lineStart(src, spec.doc?.pos ?? spec.pos);
+  let end = lineEnd(src, spec.end - 1);
+  const prev = src.substring(lineStart(src, pos - 1), pos).trim();
+  const next = src.substring(end, lineEnd(src, end)).trim();
+  if (prev === '' || prev.endsWith('(')) {
+    if (next === '') {
+      end = lineEnd(src, end);
+    } else if (next.startsWith(')') && prev === '') {
+      pos = lineStart(src, pos - 1);
+    }
+  }
+  return { pos, end, newText: '' };
+}
+
+// Returns the zero value of the predeclared basic type name.
+export function basicZero(name: string): string | undefined {
+  if (name === 'bool') return 'false';
+  if (name === 'string') return '""';
+  if (name === 'unsafe.Pointer') return 'nil';
+  const numeric =
+    /^(u?int(8|16|32|64)?|uintptr|float(32|64)|complex(64|128)|byte|rune)$/;
+  return numeric.test(name) ? '0' : undefined;
+}
+
+// Returns the zero value of t, written as text, or undefined where it is
+// not known, as for type parameters and types outside the module.
+export function zeroOf(t: Type, text: string): string | undefined {
+  if (t.kind === 'typeparam') return undefined;
+  const u = under(t);
+  switch (u.kind) {
+    case 'basic':
+      return basicZero(u.name);
+    case 'pointer':
+    case 'slice':
+    case 'map':
+    case 'chan':
+    case 'signature':
+    case 'interface':
+      return 'nil';
+    case 'struct':
+    case 'array':
+      return `${text}{}`;
+  }
+  return undefined;
+}
+
+// Returns the conversion of text to type, parenthesizing types that would
+// otherwise not parse as the operand of a call.
+export function conversion(type: string, text: string): string {
+  return /^(\*|<-|func\b|chan\b)/.test(type)
+    ? `(${type})(${text})`
+    : `${type}(${text})`;
+}
+
+const PRECEDENCE: Record<string, number> = {
+  '||': 1,
+  '&&': 2,
+  '==': 3,
+  '!=': 3,
+  '<': 3,
+  '<=': 3,
+  '>': 3,
+  '>=': 3,
+  '+': 4,
+  '-': 4,
+  '|': 4,
+  '^': 4,
+};
+
+function precedence(op: string): number {
+  return PRECEDENCE[op] ?? 5;
+}
+
+// Reports whether replacing the operand child of parent by e requires
+// parentheses around e.
+export function needsParens(e: Expr, parent: Node, child: Node): boolean {
+  const postfix =
+    (parent.type === 'SelectorExpr' && parent.x === child) ||
+    (parent.type === 'IndexExpr' && parent.x === child) ||
+    (parent.type === 'SliceExpr' && parent.x === child) ||
+    (parent.type === 'TypeAssertExpr' && parent.x === child) ||
+    (parent.type === 'CallExpr' && parent.fun === child);
+  if (e.type === 'BinaryExpr') {
+    if (parent.type === 'BinaryExpr') {
+      const inner = precedence(e.op);
+      const outer = precedence(parent.op);
+      return inner < outer || (inner === outer && child === parent.y);
+    }
+    return postfix || parent.type === 'UnaryExpr' || parent.type === 'StarExpr';
+  }
+  if (e.type === 'UnaryExpr' || e.type === 'StarExpr') return postfix;
+  return false;
+}
+
+export function lineStart(src: string, index: number): number {
+  return src.lastIndexOf('\n', index - 1) + 1;
+}
+
+// Returns the index just past the newline ending the line containing
+// index, or the end of src for the last line.
+export function lineEnd(src: string, index: number): number {
+  const nl = src.indexOf('\n', index);
+  return nl < 0 ? src.length : nl + 1;
+}
+
+// Returns the edit deleting item k of a comma-separated list.
+export function listItemRemoval(items: Node[], k: number): TextEdit {
+  return k > 0
+    ? { pos: items[k - 1].end, end: items[k].end, newText: '' }
+    : { pos: items[0].pos, end: items[1].pos, newText: '' };
+}
+
+// Returns the leading whitespace of the line containing index.
+export function indentAt(src: string, index: number): string {
+  const start = lineStart(src, index);
+  return /^[ \t]*/.exec(src.substring(start))![0];
+}
+
+// Lays out consecutive lines of cells the way gofmt aligns struct fields:
+// every cell but the last of a line is padded with spaces to one more than
+// the widest cell of its column, among the adjacent lines that have a cell
+// after it as well. A column whose cells are all empty among those lines
+// takes no space.
+export function alignCells(rows: string[][]): string[] {
+  const widths = rows.map(row => row.map(() => 0));
+  const width = (cell: string) => [...cell].length;
+  const layout = (start: number, end: number, column: number) => {
+    for (let i = start; i < end; i++) {
+      if (column >= rows[i].length - 1) continue;
+      let j = i;
+      let max = 0;
+      for (; j < end && column < rows[j].length - 1; j++) {
+        max = Math.max(max, width(rows[j][column]));
+      }
+      if (max > 0) max++;
+      for (let k = i; k < j; k++) widths[k][column] = max;
+      layout(i, j, column + 1);
+      i = j - 1;
+    }
+  };
+  layout(0, rows.length, 0);
+  return rows.map((row, i) =>
+    row
+      .map((cell, j) =>
+        j < row.length - 1
+          ? cell + ' '.repeat(widths[i][j] - width(cell))
+          : cell
+      )
+      .join('')
+  );
+}
+
+// A line of a const, var or import group. The texts of a spec are its
+// parts as written in the group, continuation lines indented but the first
+// not; comments are written as is.
+export type GroupLine =
+  | {
+      kind: 'spec';
+      names: string;
+      type?: string;
+      values?: string;
+      comment?: string;
+    }
+  | { kind: 'comment'; text: string }
+  | { kind: 'blank' };
+
+// Writes a group declaration of lines laid out as gofmt lays it out: the
+// names, types, values and comments of adjacent specs are aligned in
+// columns, which empty lines, comment lines and specs spanning several
+// lines interrupt. As a run of specs with values keeps an empty type
+// column when one of them has a type, the values of untyped specs line up
+// with those of typed ones.
+export function layoutGroup(
+  keyword: 'import' | 'const' | 'var',
+  lines: GroupLine[]
+): string {
+  const specs = lines.filter(l => l.kind === 'spec');
+  const keepType = new Set<GroupLine>();
+  for (let i = 0; i < specs.length; i++) {
+    if (!specs[i].values) continue;
+    let j = i;
+    while (j < specs.length && specs[j].values) j++;
+    const run = specs.slice(i, j);
+    if (run.some(s => s.type !== undefined)) run.forEach(s => keepType.add(s));
+    i = j - 1;
+  }
+
+  const out: string[] = [];
+  let rows: string[][] = [];
+  const flush = () => {
+    out.push(...alignCells(rows).map(line => `\t${line}`));
+    rows = [];
+  };
+  for (const line of lines) {
+    if (line.kind === 'blank') {
+      flush();
+      if (out.length > 0 && out[out.length - 1] !== '') out.push('');
+      continue;
+    }
+    if (line.kind === 'comment') {
+      flush();
+      out.push(`\t${line.text}`);
+      continue;
+    }
+    const cells = [line.names];
+    if (keyword !== 'import') {
+      let extraTabs = 3;
+      if (line.type !== undefined || keepType.has(line)) {
+        cells.push(line.type ?? '');
+        extraTabs--;
+      }
+      if (line.values !== undefined) {
+        cells.push(`= ${line.values}`);
+        extraTabs--;
+      }
+      if (line.comment) {
+        for (; extraTabs > 1; extraTabs--) cells.push('');
+      }
+    }
+    if (line.comment) cells.push(line.comment);
+    const multiline = cells.findIndex(c => c.includes('\n'));
+    if (multiline < 0) {
+      rows.push(cells);
+      continue;
+    }
+    // The first line of the spec still lines up with the lines above it.
+    const cell = cells[multiline];
+    const newline = cell.indexOf('\n');
+    rows.push([...cells.slice(0, multiline), cell.substring(0, newline)]);
+    flush();
+    const rest = [cell.substring(newline), ...cells.slice(multiline + 1)];
+    out[out.length - 1] += rest.filter(c => c !== '').join(' ');
+  }
+  flush();
+  if (out[out.length - 1] === '') out.pop();
+  return `${keyword} (\n${out.map(l => `${l}\n`).join('')})`;
+}
+
+// Reports whether [pos, end) holds nothing but whitespace, semicolons and
+// comments.
+export function onlyComments(
+  file: GoSourceFile,
+  pos: number,
+  end: number
+): boolean {
+  for (let i = pos; i < end; i++) {
+    if (/[\s;]/.test(file.src[i])) continue;
+    const comment = file.ast.comments.find(g => g.pos <= i && i < g.end);
+    if (!comment) return false;
+    i = comment.end - 1;
+  }
+  return true;
+}
+
+// Returns the edit deleting stmt, a statement of parent: its line when
+// nothing but comments shares it, or an if or switch initializer up to the
+// condition following it.
+export function stmtRemovalEdit(
+  file: GoSourceFile,
+  stmt: Node,
+  parent: Node | undefined
+): TextEdit {
+  const src = file.src;
+  if (
+    (parent?.type === 'IfStmt' || parent?.type === 'SwitchStmt') &&
+    parent.init === stmt
+  ) {
+    let end = src.indexOf(';', stmt.end) + 1;
+    while (/[ \t]/.test(src[end])) end++;
+    return { pos: stmt.pos, end, newText: '' };
+  }
+  const start = lineStart(src, stmt.pos);
+  const end = lineEnd(src, stmt.end);
+  if (
+    /^[ \t]*$/.test(src.substring(start, stmt.pos)) &&
+    onlyComments(file, stmt.end, end)
+  ) {
+    return { pos: start, end, newText: '' };
+  }
+  let next = stmt.end;
+  while (/[ \t;]/.test(src[next])) next++;
+  return { pos: stmt.pos, end: next, newText: '' };
+}
+
+// Returns the raw string literals of root that span several lines. Their
+// continuation lines must never be re-indented.
+function multilineRawStrings(root: Node): BasicLit[] {
+  const lits: BasicLit[] = [];
+  inspect(root, node => {
+    if (
+      node.type === 'BasicLit' &&
+      node.value.startsWith('`') &&
+      node.value.includes('\n')
+    ) {
+      lits.push(node);
+    }
+  });
+  return lits;
+}
+
+// Returns the source lines in [pos, end) of file re-indented: the prefix
+// from is replaced with to on every line, and lines indented less than from
+// get just to. Lines that continue a multi-line raw string are left alone.
+// Edits with absolute positions inside the range, such as renames, are
+// applied on the way.
+export function reindent(
+  file: GoSourceFile,
+  pos: number,
+  end: number,
+  from: string,
+  to: string,
+  edits: TextEdit[] = []
+): string {
+  const raw = multilineRawStrings(file.ast).filter(
+    lit => lit.pos < end && lit.end > pos
+  );
+  const all: TextEdit[] = [];
+  let offset = pos;
+  for (const line of file.src.substring(pos, end).split(/(?<=\n)/)) {
+    const insideRaw = raw.some(lit => lit.pos < offset && offset < lit.end);
+    if (!insideRaw) {
+      const lead = /^[ \t]*/.exec(line)![0];
+      let newText = to;
+      if (line.trim() === '') {
+        newText = '';
+      } else if (lead.startsWith(from)) {
+        newText = to + lead.substring(from.length);
+      }
+      all.push({ pos: offset, end: offset + lead.length, newText });
+    }
+    offset += line.length;
+  }
+  // Indentation edits come first so that they precede a rename at the
+  // start of a line.
+  all.push(...edits);
+  return applyTextEdits(
+    file.src.substring(pos, end),
+    all.map(e => ({ ...e, pos: e.pos - pos, end: e.end - pos }))
+  );
+}
+
+// Packages that text handed to transplant may name although its origin
+// file does not import them, by name.
+export type Packages = Map<string, { path: string; name: string }>;
+
+// Resolves a package name as used by origin: an import of the file, one of
+// the known packages, or a package of the module.
+export function packageNamed(
+  program: GoProgram,
+  origin: GoSourceFile,
+  packages: Packages,
+  name: string
+): { path: string; name: string } | undefined {
+  const obj = origin.scope?.lookupParent(name);
+  if (obj?.kind === 'pkgname' && obj.imported) {
+    const pkg = program.packageByImportPath(obj.imported);
+    return { path: obj.imported, name: pkg?.name ?? name };
+  }
+  if (obj) return undefined;
+  const known = packages.get(name);
+  if (known) return known;
+  const pkg = program.packages.find(p => p.name === name && !p.isXTest);
+  return pkg ? { path: pkg.importPath, name } : undefined;
+}
+
+// Returns text, a type or expression written from the point of view of
+// origin, rewritten to mean the same at a place in file with the given
+// scope. Names that resolve there are left alone. Package names and
+// package-level names of origin that do not are qualified, and the imports
+// they need are collected by the qualifier.
+export function transplant(
+  program: GoProgram,
+  packages: Packages,
+  text: string,
+  origin: GoSourceFile,
+  file: GoSourceFile,
+  scope: Scope | undefined,
+  qualifier: Qualifier
+): string {
+  const edits: TextEdit[] = [];
+  const visit = (n: Node): boolean | void => {
+    if (n.type === 'Field') {
+      // Parameter and field names are not references.
+      inspect(n.fieldType, visit);
+      return false;
+    }
+    if (n.type === 'KeyValueExpr' && n.key.type === 'Ident') {
+      // Struct literal keys name fields.
+      inspect(n.value, visit);
+      return false;
+    }
+    if (n.type === 'SelectorExpr') {
+      if (n.x.type !== 'Ident') return;
+      if (scope?.lookupParent(n.x.name)) return false;
+      const pkg = packageNamed(program, origin, packages, n.x.name);
+      if (pkg) {
+        const q = qualifier(pkg);
+        const end = q ? n.x.end : n.sel.pos;
+        edits.push({ pos: n.x.pos, end, newText: q });
+      }
+      return false;
+    }
+    if (n.type !== 'Ident' || n.name === '_') return;
+    if (scope?.lookupParent(n.name)) return;
+    const obj = origin.scope?.lookupParent(n.name);
+    if (obj?.parent?.kind !== 'package' || obj.pkg === file.pkg) return;
+    if (!isExported(n.name)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `'${text}' refers to '${n.name}', which is not exported by package ${origin.pkg.name}`
+      );
+    }
+    const q = qualifier({ path: origin.pkg.importPath, name: origin.pkg.name });
+    if (q) edits.push({ pos: n.pos, end: n.pos, newText: `${q}.` });
+  };
+  inspect(parseGoExpr(text), visit);
+  return applyTextEdits(text, edits);
+}
+
+// Reports whether name is declared at package level in pkg or as an
+// import name in any of its files.
+export function isPackageLevelName(pkg: GoPackage, name: string): boolean {
+  if (pkg.scope?.lookup(name)) return true;
+  return pkg.files.some(f => f.scope?.lookup(name));
+}
+
+// Rejects declaring name where it would not refer to the new declaration
+// at every occurrence, being hidden by a declaration between the
+// occurrence and outer.
+export function checkShadowing(
+  info: GoInfo,
+  occurrences: { file: GoSourceFile; node: Node }[],
+  outer: Scope | undefined,
+  name: string
+): void {
+  for (const { file, node } of occurrences) {
+    const path = pathEnclosingInterval(file.ast, node.pos, node.end);
+    for (
+      let s = scopeAt(info, path);
+      s && s !== outer && s.kind !== 'file';
+      s = s.parent
+    ) {
+      const other = declaredAt(s, name, node.pos);
+      if (other) {
+        throw new ToolError(
+          'name_conflict',
+          `'${name}' at ${locationOf(file, node.pos)} would refer to the ${other.kind} declared at ${locationOf(file, other.pos)}`,
+          errorLocation(file, node.pos)
+        );
+      }
+    }
+  }
+}
+
+// Rejects declaring name where existing uses of the name inside roots
+// refer to an object declared outside of them, which the new declaration
+// would hide.
+export function checkCapture(
+  info: GoInfo,
+  roots: { file: GoSourceFile; node: Node }[],
+  name: string
+): void {
+  for (const { file, node } of roots) {
+    const visit = (n: Node): boolean | void => {
+      // Selected names are not looked up in scopes.
+      if (n.type === 'SelectorExpr') {
+        inspect(n.x, visit);
+        return false;
+      }
+      if (n.type !== 'Ident' || n.name !== name) return;
+      const obj = info.uses.get(n);
+      if (!obj || obj.isField) return;
+      const inside =
+        obj.file === file && obj.pos >= node.pos && obj.pos < node.end;
+      if (!inside) {
+        throw new ToolError(
+          'name_conflict',
+          `Declaring '${name}' would hide the ${obj.kind} used at ${locationOf(file, n.pos)}`,
+          errorLocation(file, n.pos)
+        );
+      }
+    };
+    inspect(node, visit);
+  }
+}
+
+const GO_KEYWORDS = new Set([
+  'break',
+  'case',
+  'chan',
+  'const',
+  'continue',
+  'default',
+  'defer',
+  'else',
+  'fallthrough',
+  'for',
+  'func',
+  'go',
+  'goto',
+  'if',
+  'import',
+  'interface',
+  'map',
+  'package',
+  'range',
+  'return',
+  'select',
+  'struct',
+  'switch',
+  'type',
+  'var',
+]);
+
+// Validates a name supplied for a new declaration.
+export function checkIdentifier(name: string): void {
+  if (!/^[\p{L}_][\p{L}\p{Nd}_]*$/u.test(name) || GO_KEYWORDS.has(name)) {
+    throw new ToolError(
+      'invalid_argument',
+      `'${name}' is not a valid Go identifier`
+    );
+  }
+  if (name === '_') {
+    throw new ToolError(
+      'invalid_argument',
+      "The blank identifier '_' cannot be used as a name"
+    );
+  }
+}
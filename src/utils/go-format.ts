@@ -0,0 +1,424 @@
+// Formatting of the Go files the tools write. The tools lay out their
+// edits the way gofmt prints them; before a file is written, the layout
+// rules that gofmt applies to whole files, and with gofumpt the stricter
+// rules of gofumpt, are applied to all of it, so that the result passes a
+// check with either formatter.
+
+import { dirname } from 'path';
+import type {
+  BlockStmt,
+  File,
+  GenDecl,
+  Node,
+  Stmt,
+  ValueSpec,
+} from './go-ast.js';
+import { inspect } from './go-ast.js';
+import { layoutGroup, lineEnd, lineStart } from './go-edit.js';
+import type { GroupLine } from './go-edit.js';
+import { findGoModule } from './go-loader.js';
+import { parseGoFile } from './go-parser.js';
+import { scanGo } from './go-scanner.js';
+import { applyTextEdits } from './edit-utils.js';
+import type { TextEdit } from './edit-utils.js';
+import { ToolError } from './tool-error.js';
+
+export const GO_FORMATS = ['gofmt', 'gofumpt', 'none'] as const;
+
+// How the Go files a tool writes are formatted: gofmt, gofumpt, or none to
+// write the edits without touching the rest of the file.
+export type GoFormat = (typeof GO_FORMATS)[number];
+
+// Returns the format chosen for the server by REFACTOR_MCP_FORMAT, gofmt
+// when it is not set.
+export function defaultGoFormat(): GoFormat {
+  const env = process.env.REFACTOR_MCP_FORMAT;
+  if (!env) return 'gofmt';
+  const format = GO_FORMATS.find(f => f === env);
+  if (!format) {
+    throw new ToolError(
+      'invalid_argument',
+      `REFACTOR_MCP_FORMAT is '${env}'; use one of ${GO_FORMATS.join(', ')}`
+    );
+  }
+  return format;
+}
+
+// Returns src formatted as format asks. Files that do not parse are
+// returned as they are, since their layout cannot be known.
+export function formatGoSource(
+  filePath: string,
+  src: string,
+  format: GoFormat
+): string {
+  if (format === 'none') return src;
+  const passes = format === 'gofumpt' ? [gofmt, ...GOFUMPT] : [gofmt];
+  let result = src;
+  for (const pass of passes) {
+    let ast: File;
+    try {
+      ast = parseGoFile(filePath, result);
+    } catch (error) {
+      if (error instanceof ToolError) return result;
+      throw error;
+    }
+    result = applyTextEdits(result, pass(result, ast, filePath));
+  }
+  return result;
+}
+
+type Pass = (src: string, ast: File, filePath: string) => TextEdit[];
+
+// Returns the ranges of the raw strings and comments of src that span
+// several lines, whose lines are content rather than layout.
+function multilineTokens(src: string): { pos: number; end: number }[] {
+  const { tokens, comments } = scanGo(src);
+  return [...tokens.filter(t => t.lit.startsWith('`')), ...comments].filter(
+    t => src.substring(t.pos, t.end).includes('\n')
+  );
+}
+
+// Removes trailing whitespace, runs of more than one empty line and empty
+// lines at the start and end of the file, as gofmt does.
+const gofmt: Pass = src => {
+  const tokens = multilineTokens(src);
+  const inToken = (i: number) => tokens.some(t => t.pos < i && i < t.end);
+  const edits: TextEdit[] = [];
+  // The start of the file counts as an empty line, so that empty lines
+  // before the package clause go.
+  let previousBlank = true;
+  let offset = 0;
+  for (const line of src.split(/(?<=\n)/)) {
+    const text = line.replace(/\n$/, '');
+    const textEnd = offset + text.length;
+    if (text.trim() === '' && !inToken(offset)) {
+      if (previousBlank) {
+        edits.push({ pos: offset, end: offset + line.length, newText: '' });
+      } else if (text !== '') {
+        edits.push({ pos: offset, end: textEnd, newText: '' });
+      }
+      previousBlank = true;
+    } else {
+      const trimmed = offset + text.replace(/[ \t\r]+$/, '').length;
+      if (trimmed < textEnd && !inToken(textEnd)) {
+        edits.push({ pos: trimmed, end: textEnd, newText: '' });
+      }
+      previousBlank = false;
+    }
+    offset += line.length;
+  }
+  const bodyEnd = src.replace(/\s+$/, '').length;
+  if (src.substring(bodyEnd) === '\n') return edits;
+  return [
+    ...edits.filter(e => e.pos < bodyEnd),
+    { pos: bodyEnd, end: src.length, newText: '\n' },
+  ];
+};
+
+// Returns the comment groups of ast that lie within [pos, end).
+function commentsIn(ast: File, pos: number, end: number) {
+  return ast.comments.filter(g => pos <= g.pos && g.end <= end);
+}
+
+// Returns edits removing the empty lines just inside the delimiters at
+// open and close, when each of them is alone on its side of the line.
+function blankLinesInside(
+  src: string,
+  open: number,
+  close: number
+): TextEdit[] {
+  const edits: TextEdit[] = [];
+  const first = lineEnd(src, open);
+  if (first > close || src.substring(open + 1, first).trim() !== '') {
+    return edits;
+  }
+  let end = first;
+  while (end < close) {
+    const next = lineEnd(src, end);
+    if (src.substring(end, next).trim() !== '') break;
+    end = next;
+  }
+  if (end > first) edits.push({ pos: first, end, newText: '' });
+
+  const last = lineStart(src, close);
+  if (src.substring(last, close).trim() !== '') return edits;
+  let pos = last;
+  while (pos > end) {
+    const previous = lineStart(src, pos - 1);
+    if (src.substring(previous, pos).trim() !== '') break;
+    pos = previous;
+  }
+  if (pos < last) edits.push({ pos, end: last, newText: '' });
+  return edits;
+}
+
+// No empty lines at the start or end of function bodies, composite
+// literals, field lists and blocks holding a single statement or comment.
+const blockEdges: Pass = (src, ast) => {
+  const bodies = new Set<BlockStmt>();
+  const edits: TextEdit[] = [];
+  inspect(ast, node => {
+    if (node.type === 'FuncDecl' || node.type === 'FuncLit') {
+      if (node.body) bodies.add(node.body);
+    } else if (node.type === 'BlockStmt') {
+      const items =
+        node.list.length +
+        commentsIn(ast, node.lbrace, node.rbrace).filter(
+          g => !node.list.some(s => s.pos <= g.pos && g.end <= s.end)
+        ).length;
+      if (bodies.has(node) || items <= 1) {
+        edits.push(...blankLinesInside(src, node.lbrace, node.rbrace));
+      }
+    } else if (node.type === 'CompositeLit') {
+      edits.push(...blankLinesInside(src, node.lbrace, node.end - 1));
+    } else if (node.type === 'StructType' || node.type === 'InterfaceType') {
+      const fields = node.type === 'StructType' ? node.fields : node.methods;
+      edits.push(...blankLinesInside(src, fields.opening, fields.end - 1));
+    }
+  });
+  return edits;
+};
+
+// Empty struct and interface types take a single line.
+const emptyFieldLists: Pass = (src, ast) => {
+  const edits: TextEdit[] = [];
+  inspect(ast, node => {
+    if (node.type !== 'StructType' && node.type !== 'InterfaceType') return;
+    const fields = node.type === 'StructType' ? node.fields : node.methods;
+    const inner = src.substring(fields.opening + 1, fields.end - 1);
+    if (fields.list.length === 0 && inner.includes('\n') && !inner.trim()) {
+      const keyword = node.type === 'StructType' ? 'struct' : 'interface';
+      edits.push({ pos: node.pos, end: node.end, newText: `${keyword}{}` });
+    }
+  });
+  return edits;
+};
+
+// Reports whether s is the check if err != nil of the error that the
+// statement before it assigns.
+function isErrorCheck(previous: Stmt, s: Stmt): boolean {
+  if (s.type !== 'IfStmt' || s.init || s.cond.type !== 'BinaryExpr') {
+    return false;
+  }
+  const { op, x, y } = s.cond;
+  return (
+    op === '!=' &&
+    x.type === 'Ident' &&
+    y.type === 'Ident' &&
+    y.name === 'nil' &&
+    previous.type === 'AssignStmt' &&
+    previous.lhs.some(e => e.type === 'Ident' && e.name === x.name)
+  );
+}
+
+// No empty lines between an assignment and the check of the error it
+// assigns.
+const errorChecks: Pass = (src, ast) => {
+  const edits: TextEdit[] = [];
+  const visit = (list: Stmt[]) => {
+    for (let i = 1; i < list.length; i++) {
+      if (!isErrorCheck(list[i - 1], list[i])) continue;
+      const pos = lineEnd(src, list[i - 1].end);
+      const end = lineStart(src, list[i].pos);
+      if (pos < end && src.substring(pos, end).trim() === '') {
+        edits.push({ pos, end, newText: '' });
+      }
+    }
+  };
+  inspect(ast, node => {
+    if (node.type === 'BlockStmt') visit(node.list);
+    else if (node.type === 'CaseClause' || node.type === 'CommClause') {
+      visit(node.body);
+    }
+  });
+  return edits;
+};
+
+// Reports whether the text of node holds no comments and fits on a line.
+function isPlain(src: string, ast: File, node: Node): boolean {
+  return (
+    !src.substring(node.pos, node.end).includes('\n') &&
+    commentsIn(ast, node.pos, node.end).length === 0
+  );
+}
+
+// A var declaration of a single spec has no parentheses.
+const singleVarGroups: Pass = (src, ast) => {
+  const edits: TextEdit[] = [];
+  inspect(ast, node => {
+    if (
+      node.type === 'GenDecl' &&
+      node.tok === 'var' &&
+      node.lparen >= 0 &&
+      node.specs.length === 1 &&
+      isPlain(src, ast, node.specs[0]) &&
+      commentsIn(ast, node.pos, node.end).length === 0
+    ) {
+      const spec = node.specs[0];
+      edits.push({
+        pos: node.pos,
+        end: node.end,
+        newText: `var ${src.substring(spec.pos, spec.end)}`,
+      });
+    }
+  });
+  return edits;
+};
+
+// Returns the group line of spec, whose text fits on a line.
+function groupLine(src: string, spec: ValueSpec): GroupLine {
+  const text = (n: { pos: number; end: number }) =>
+    src.substring(n.pos, n.end);
+  return {
+    kind: 'spec',
+    names: spec.names.map(n => n.name).join(', '),
+    type: spec.valueType && text(spec.valueType),
+    values:
+      spec.values.length > 0
+        ? text({ pos: spec.values[0].pos, end: spec.values.at(-1)!.end })
+        : undefined,
+  };
+}
+
+// Contiguous top-level var declarations of a single line each are
+// grouped into one declaration.
+const contiguousVars: Pass = (src, ast) => {
+  const edits: TextEdit[] = [];
+  const plain = (d: Node): d is GenDecl =>
+    d.type === 'GenDecl' &&
+    d.tok === 'var' &&
+    d.lparen < 0 &&
+    !d.doc &&
+    isPlain(src, ast, d) &&
+    commentsIn(ast, d.end, lineEnd(src, d.end)).length === 0;
+  const decls = ast.decls;
+  for (let i = 0; i < decls.length; i++) {
+    let j = i;
+    while (
+      plain(decls[j]) &&
+      j + 1 < decls.length &&
+      plain(decls[j + 1]) &&
+      /^[ \t]*\n[ \t]*$/.test(src.substring(decls[j].end, decls[j + 1].pos))
+    ) {
+      j++;
+    }
+    if (j === i) continue;
+    const run = decls.slice(i, j + 1) as GenDecl[];
+    const specs = run.map(d => d.specs[0] as ValueSpec);
+    edits.push({
+      pos: run[0].pos,
+      end: run.at(-1)!.end,
+      newText: layoutGroup('var', specs.map(s => groupLine(src, s))),
+    });
+    i = j;
+  }
+  return edits;
+};
+
+// A var statement giving each of its variables a value, without a type,
+// is a short variable declaration.
+const shortVarDecls: Pass = (src, ast) => {
+  const edits: TextEdit[] = [];
+  inspect(ast, node => {
+    if (node.type !== 'DeclStmt') return;
+    const decl = node.decl;
+    const spec = decl.specs[0];
+    if (
+      decl.tok !== 'var' ||
+      decl.lparen >= 0 ||
+      spec?.type !== 'ValueSpec' ||
+      spec.valueType ||
+      spec.values.length !== spec.names.length ||
+      spec.names.every(n => n.name === '_') ||
+      commentsIn(ast, decl.pos, decl.end).length > 0
+    ) {
+      return;
+    }
+    const names = spec.names.map(n => n.name).join(', ');
+    const values = src.substring(spec.values[0].pos, spec.values.at(-1)!.end);
+    edits.push({
+      pos: decl.pos,
+      end: decl.end,
+      newText: `${names} := ${values}`,
+    });
+  });
+  return edits;
+};
+
+// Reports whether the module of filePath declares go 1.13 or later, which
+// introduced 0o octal literals.
+function hasOctalPrefix(filePath: string): boolean {
+  const version = findGoModule(dirname(filePath))?.goVersion;
+  const m = version?.match(/^(\d+)\.(\d+)/);
+  return !!m && (Number(m[1]) > 1 || Number(m[2]) >= 13);
+}
+
+// Octal literals use the 0o prefix.
+const octalLiterals: Pass = (src, ast, filePath) => {
+  const edits: TextEdit[] = [];
+  inspect(ast, node => {
+    if (
+      node.type === 'BasicLit' &&
+      node.kind === 'INT' &&
+      /^0[0-7_]*[0-7]$/.test(node.value)
+    ) {
+      edits.push({ pos: node.pos + 1, end: node.pos + 1, newText: 'o' });
+    }
+  });
+  return edits.length > 0 && hasOctalPrefix(filePath) ? edits : [];
+};
+
+// Comments such as //go:generate, //line and //nolint that tools read.
+const DIRECTIVE =
+  /^\/\/(?:[a-z0-9]+:[a-z0-9]|line |extern |export |nolint|sys(?:nb)? |\+build)/;
+
+// Line comments start with a space, unless they are directives.
+const commentSpacing: Pass = (src, ast) => {
+  const edits: TextEdit[] = [];
+  for (const comment of ast.comments.flatMap(g => g.list)) {
+    const text = comment.text;
+    if (
+      text.startsWith('//') &&
+      text.length > 2 &&
+      !/^\/\/[ \t/]/.test(text) &&
+      !DIRECTIVE.test(text)
+    ) {
+      const pos = comment.pos + 2;
+      edits.push({ pos, end: pos, newText: ' ' });
+    }
+  }
+  return edits;
+};
+
+// Top-level declarations that span several lines are separated from their
+// neighbours by an empty line.
+const declSeparation: Pass = (src, ast) => {
+  const edits: TextEdit[] = [];
+  const multiline = (d: Node) => src.substring(d.pos, d.end).includes('\n');
+  for (let i = 1; i < ast.decls.length; i++) {
+    const previous = ast.decls[i - 1];
+    const decl = ast.decls[i];
+    const start = 'doc' in decl && decl.doc ? decl.doc.pos : decl.pos;
+    if (
+      (multiline(previous) || multiline(decl)) &&
+      /^[ \t]*\n[ \t]*$/.test(src.substring(previous.end, start))
+    ) {
+      const pos = lineStart(src, start);
+      edits.push({ pos, end: pos, newText: '\n' });
+    }
+  }
+  return edits;
+};
+
+// The rules gofumpt adds to those of gofmt, applied in this order.
+const GOFUMPT: Pass[] = [
+  emptyFieldLists,
+  blockEdges,
+  errorChecks,
+  singleVarGroups,
+  contiguousVars,
+  shortVarDecls,
+  octalLiterals,
+  commentSpacing,
+  declSeparation,
+];
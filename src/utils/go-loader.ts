@@ -0,0 +1,674 @@
+import { existsSync, readFileSync, readdirSync, statSync } from 'fs';
+import { dirname, join, relative, resolve, sep } from 'path';
+import { displayPath } from './file-utils.js';
+import type { File } from './go-ast.js';
+import {
+  buildContext,
+  buildContextKey,
+  excludingConstraint,
+} from './go-build.js';
+import type { BuildContext, BuildOptions } from './go-build.js';
+import { step } from './task.js';
+import type { TaskOptions } from './task.js';
+import { parseGoFile } from './go-parser.js';
+import { unquoteGoString } from './go-scanner.js';
+import { GoChecker } from './go-checker.js';
+import { computeLineStarts } from './line-utils.js';
+import type { GoPackage, GoSourceFile } from './go-types.js';
+import { ToolError } from './tool-error.js';
+import type { ErrorLocation } from './tool-error.js';
+
+export interface GoModule {
+  // Directory containing go.mod.
+  root: string;
+  // Module path declared in go.mod.
+  path: string;
+  // Go version of the go directive, such as 1.22, if there is one.
+  goVersion?: string;
+  // Toolchain of the toolchain directive, such as go1.22.3, if there is one.
+  toolchain?: string;
+}
+
+// A go.work file and the modules it uses.
+export interface GoWorkspace {
+  // Path of go.work.
+  file: string;
+  modules: GoModule[];
+}
+
+export interface GoLoadError {
+  filePath: string;
+  message: string;
+  // Where in the file the error was found, for syntax errors.
+  location?: ErrorLocation;
+}
+
+// How to load a module: the files to select, and where to report progress
+// and how to cancel while loading.
+export interface LoadOptions extends BuildOptions, TaskOptions {}
+
+// A file left out of its package by build constraints.
+export interface ExcludedGoFile {
+  filePath: string;
+  // The constraint that does not hold, such as its //go:build line.
+  constraint: string;
+  // Paths the file imports, if it could be parsed.
+  imports: string[];
+}
+
+// Reads the module declared by the go.mod in root, if there is one.
+function readGoModule(root: string): GoModule | undefined {
+  const modFile = join(root, 'go.mod');
+  if (!existsSync(modFile)) return undefined;
+  const content = readFileSync(modFile, 'utf-8');
+  const match = content.match(/^\s*module\s+("?)([^\s"]+)\1/m);
+  const version = content.match(/^\s*go\s+(\d+\.\d+(?:\.\d+)?)\s*$/m);
+  const toolchain = content.match(/^\s*toolchain\s+(\S+)\s*$/m);
+  return {
+    root,
+    path: match ? match[2] : '',
+    goVersion: version?.[1],
+    toolchain: toolchain?.[1],
+  };
+}
+
+// Finds the go.mod governing dir by walking up the directory tree.
+export function findGoModule(dir: string): GoModule | undefined {
+  let current = resolve(dir);
+  for (;;) {
+    const module = readGoModule(current);
+    if (module) return module;
+    const parent = dirname(current);
+    if (parent === current) return undefined;
+    current = parent;
+  }
+}
+
+// Lists the directories named by the use directives of a go.work file,
+// relative to dir, the directory of the file.
+function workspaceDirs(dir: string, content: string): string[] {
+  const dirs: string[] = [];
+  let inBlock = false;
+  for (const raw of content.split('\n')) {
+    const line = raw.replace(/\/\/.*$/, '').trim();
+    let path: string | undefined;
+    if (inBlock) {
+      if (line === ')') inBlock = false;
+      else path = line;
+    } else if (/^use\s*\($/.test(line)) {
+      inBlock = true;
+    } else {
+      path = line.match(/^use\s+(.+)$/)?.[1];
+    }
+    const m = path?.match(/^("?)([^\s"]+)\1$/);
+    if (m) dirs.push(resolve(dir, m[2]));
+  }
+  return dirs;
+}
+
+// Finds the go.work governing dir the way the go command does: the file
+// named by GOWORK, or else the nearest go.work above dir, unless GOWORK is
+// off. Returns undefined when there is none or when it does not use the
+// module of dir, leaving that module on its own.
+export function findGoWorkspace(dir: string): GoWorkspace | undefined {
+  const env = process.env.GOWORK;
+  if (env === 'off') return undefined;
+  let file: string | undefined;
+  if (env) {
+    file = resolve(env);
+  } else {
+    for (let current = resolve(dir); ; current = dirname(current)) {
+      if (existsSync(join(current, 'go.work'))) {
+        file = join(current, 'go.work');
+        break;
+      }
+      if (dirname(current) === current) break;
+    }
+  }
+  if (!file || !existsSync(file)) return undefined;
+  const content = readFileSync(file, 'utf-8');
+  const modules: GoModule[] = [];
+  for (const root of workspaceDirs(dirname(file), content)) {
+    const module = readGoModule(root);
+    if (module && !modules.some(m => m.root === root)) modules.push(module);
+  }
+  const own = findGoModule(dir);
+  if (!own || !modules.some(m => m.root === own.root)) return undefined;
+  return { file, modules };
+}
+
+// Directories that the go command never treats as part of a package tree.
+function isIgnoredDir(name: string): boolean {
+  return (
+    name === 'vendor' ||
+    name === 'testdata' ||
+    name.startsWith('.') ||
+    name.startsWith('_')
+  );
+}
+
+function isGoSourceFile(name: string): boolean {
+  return (
+    name.endsWith('.go') && !name.startsWith('.') && !name.startsWith('_')
+  );
+}
+
+function hasGoMod(dir: string): boolean {
+  return existsSync(join(dir, 'go.mod'));
+}
+
+// Lists the directories of the module rooted at root that may hold
+// packages, with their Go source files, both in name order.
+function sourceDirs(root: string): { dir: string; files: string[] }[] {
+  const result: { dir: string; files: string[] }[] = [];
+  const visit = (dir: string) => {
+    const entries = readdirSync(dir, { withFileTypes: true }).sort((a, b) =>
+      a.name < b.name ? -1 : a.name > b.name ? 1 : 0
+    );
+    const files = entries
+      .filter(entry => entry.isFile() && isGoSourceFile(entry.name))
+      .map(entry => join(dir, entry.name));
+    result.push({ dir, files });
+    for (const entry of entries) {
+      if (!entry.isDirectory() || isIgnoredDir(entry.name)) continue;
+      const sub = join(dir, entry.name);
+      // Nested modules are separate units.
+      if (!hasGoMod(sub)) visit(sub);
+    }
+  };
+  visit(root);
+  return result;
+}
+
+// Identifies the version of a file on disk by its modification time and
+// size.
+function fileStamp(filePath: string): string {
+  const stat = statSync(filePath);
+  return `${stat.mtimeMs}:${stat.size}`;
+}
+
+interface ParsedFile {
+  stamp: string;
+  src: string;
+  lineStarts: number[];
+  ast?: File;
+  error?: { message: string; location?: ErrorLocation };
+}
+
+// Parsed files by path, reused while the file is unchanged on disk.
+const parsedFiles = new Map<string, ParsedFile>();
+
+function parsedFile(filePath: string): ParsedFile {
+  const stamp = fileStamp(filePath);
+  let parsed = parsedFiles.get(filePath);
+  if (parsed?.stamp !== stamp) {
+    const src = readFileSync(filePath, 'utf-8');
+    parsed = { stamp, src, lineStarts: computeLineStarts(src) };
+    try {
+      parsed.ast = parseGoFile(filePath, src);
+    } catch (error) {
+      const message = error instanceof Error ? error.message : String(error);
+      const location = error instanceof ToolError ? error.location : undefined;
+      parsed.error = { message, location };
+    }
+    parsedFiles.set(filePath, parsed);
+  }
+  return parsed;
+}
+
+// Loaded programs by module root, or go.work file, and build context,
+// together with the roots of their modules and the stamps of the files they
+// were loaded from: base for go.work and go.mod, stamp for every file.
+const programs = new Map<
+  string,
+  { roots: string[]; base: string; stamp: string; program: GoProgram }
+>();
+
+// Loads in progress by the keys of programs, which concurrent loads of the
+// same files wait for instead of loading them again.
+const loading = new Map<
+  string,
+  { stamp: string; program: Promise<GoProgram> }
+>();
+
+// Counts the calls of clearGoCache, so that a load that started before
+// one does not store what it read.
+let generation = 0;
+
+// Forgets the cached programs and parsed files of the module rooted at
+// root, or of every module when root is omitted, so that the next load
+// reads everything from disk again. The programs of workspaces using the
+// module are dropped with it. Returns the number of modules dropped.
+export function clearGoCache(root?: string): number {
+  generation++;
+  if (root === undefined) {
+    const roots = [...programs.values()].flatMap(p => p.roots);
+    const count = new Set(roots).size;
+    programs.clear();
+    parsedFiles.clear();
+    return count;
+  }
+  const dir = resolve(root);
+  for (const path of parsedFiles.keys()) {
+    if (path.startsWith(dir + sep)) parsedFiles.delete(path);
+  }
+  let dropped = 0;
+  for (const [key, entry] of programs) {
+    if (!entry.roots.includes(dir)) continue;
+    programs.delete(key);
+    dropped = 1;
+  }
+  return dropped;
+}
+
+// A Go module loaded from disk: every package in the module, parsed and
+// ready to be type-checked. In a workspace, the packages of every module
+// that go.work uses are loaded together. Files that have not changed since
+// an earlier load are not parsed again, and packages whose files have not
+// changed are not checked again unless a package they import has. Only the
+// files that build constraints include in context belong to the packages;
+// the others are listed in excluded.
+export class GoProgram {
+  // The modules of the workspace, or the module alone.
+  readonly modules: GoModule[];
+  readonly context: BuildContext;
+  readonly packages: GoPackage[] = [];
+  readonly errors: GoLoadError[] = [];
+  readonly excluded: ExcludedGoFile[] = [];
+  private readonly byImportPath = new Map<string, GoPackage>();
+  private readonly byFile = new Map<string, GoSourceFile>();
+  // The stamps of the Go files of each directory loaded.
+  private readonly dirStamps = new Map<string, string>();
+  private checker = new GoChecker(path => this.packageByImportPath(path));
+  // How many of the packages the checker has checked, in order.
+  private checkedPackages = 0;
+
+  constructor(
+    modules: GoModule[],
+    dirs = modules.flatMap(m => sourceDirs(m.root)),
+    context = buildContext()
+  ) {
+    this.modules = modules;
+    this.context = context;
+    for (const { dir, files } of dirs) this.loadDir(dir, files);
+  }
+
+  // Loads the module containing filePath, which may be a file or directory,
+  // or the workspace of go.work if it uses the module. The program of an
+  // earlier call is returned, type information included, as long as no file
+  // of its modules was added, removed or modified since and the build
+  // options select the same files. Otherwise the new program keeps the
+  // packages of the earlier one that are unaffected by the changes.
+  static forPath(filePath: string, build: BuildOptions = {}): GoProgram {
+    const slot = GoProgram.cacheSlot(filePath, build);
+    if (slot.cached) return slot.cached;
+    const program = new GoProgram(slot.modules, slot.dirs, slot.context);
+    if (slot.previous) program.reuse(slot.previous);
+    slot.store(program);
+    return program;
+  }
+
+  // Like forPath, but reports each directory it loads and can be cancelled
+  // between them. A cancelled load is not cached. A call made while another
+  // loads the same files shares its program, or loads them itself if that
+  // load fails.
+  static async load(
+    filePath: string,
+    options: LoadOptions = {}
+  ): Promise<GoProgram> {
+    const slot = GoProgram.cacheSlot(filePath, options);
+    if (slot.cached) return slot.cached;
+    const pending = loading.get(slot.key);
+    if (pending?.stamp === slot.stamp) {
+      try {
+        return await pending.program;
+      } catch {
+        // Cancelled by its own caller, for instance.
+      }
+    }
+    const program = GoProgram.loadDirs(slot, options);
+    const entry = { stamp: slot.stamp, program };
+    loading.set(slot.key, entry);
+    try {
+      return await program;
+    } finally {
+      if (loading.get(slot.key) === entry) loading.delete(slot.key);
+    }
+  }
+
+  private static async loadDirs(
+    slot: ReturnType<typeof GoProgram.cacheSlot>,
+    options: LoadOptions
+  ): Promise<GoProgram> {
+    const { dirs } = slot;
+    const start = generation;
+    const program = new GoProgram(slot.modules, [], slot.context);
+    for (const [i, { dir, files }] of dirs.entries()) {
+      await step(options, `Loading packages (${i + 1}/${dirs.length})`);
+      program.loadDir(dir, files);
+    }
+    if (slot.previous) program.reuse(slot.previous);
+    if (generation === start) slot.store(program);
+    return program;
+  }
+
+  // Finds the module or workspace of filePath and its cached program, if
+  // still valid, or else the program to reuse packages from, if its go.work
+  // and go.mod files are unchanged.
+  private static cacheSlot(filePath: string, build: BuildOptions) {
+    const abs = resolve(filePath);
+    const dir =
+      existsSync(abs) && statSync(abs).isDirectory() ? abs : dirname(abs);
+    const module = findGoModule(dir);
+    if (!module) {
+      throw new ToolError(
+        'invalid_location',
+        `No go.mod found for ${filePath}`
+      );
+    }
+    const workspace = findGoWorkspace(dir);
+    const modules = workspace?.modules ?? [module];
+    const roots = modules.map(m => m.root);
+    const context = buildContext(build);
+    const unit = workspace?.file ?? module.root;
+    const key = `${unit}\n${buildContextKey(context)}`;
+    const dirs = roots.flatMap(root => sourceDirs(root));
+    const stamps = (paths: string[]) =>
+      paths.map(path => `${path}@${fileStamp(path)}`).join('\n');
+    const base = stamps([
+      ...(workspace ? [workspace.file] : []),
+      ...roots.map(root => join(root, 'go.mod')),
+    ]);
+    const stamp = `${base}\n${stamps(dirs.flatMap(d => d.files))}`;
+    const entry = programs.get(key);
+    const cached = entry?.stamp === stamp ? entry.program : undefined;
+    return {
+      key,
+      stamp,
+      modules,
+      dirs,
+      context,
+      cached,
+      previous: !cached && entry?.base === base ? entry.program : undefined,
+      store: (program: GoProgram) =>
+        programs.set(key, { roots, base, stamp, program }),
+    };
+  }
+
+  // Returns the module that path, a file or directory, belongs to: the one
+  // with the innermost root above it.
+  moduleOf(path: string): GoModule | undefined {
+    const abs = resolve(path);
+    let found: GoModule | undefined;
+    for (const module of this.modules) {
+      const inside = abs === module.root || abs.startsWith(module.root + sep);
+      if (inside && module.root.length > (found?.root.length ?? -1)) {
+        found = module;
+      }
+    }
+    return found;
+  }
+
+  private importPathFor(dir: string): string {
+    const module = this.moduleOf(dir) ?? this.modules[0];
+    const rel = relative(module.root, dir).split(sep).join('/');
+    if (!rel) return module.path;
+    return module.path ? `${module.path}/${rel}` : rel;
+  }
+
+  private loadDir(dir: string, paths: string[]): void {
+    const files: GoSourceFile[] = [];
+    const stamps: string[] = [];
+    for (const path of paths) {
+      const parsed = parsedFile(path);
+      stamps.push(`${path}@${parsed.stamp}`);
+      const constraint = excludingConstraint(this.context, path, parsed.src);
+      if (constraint) {
+        const specs = parsed.ast?.imports ?? [];
+        const imports = specs.map(spec => unquoteGoString(spec.path.value));
+        this.excluded.push({ filePath: path, constraint, imports });
+        continue;
+      }
+      const file = this.sourceFile(path, parsed);
+      if (file) files.push(file);
+    }
+    this.dirStamps.set(dir, stamps.join('\n'));
+    if (files.length > 0) this.addPackages(dir, files);
+  }
+
+  // Takes over the packages of previous, a program of the same modules
+  // loaded earlier, whose files are unchanged and which it has checked,
+  // together with what its checker found about them, as long as each
+  // package they import is taken over too. The others, those that changed
+  // and those importing them, directly or not, are checked afresh.
+  private reuse(previous: GoProgram): void {
+    const key = (pkg: GoPackage) => `${pkg.dir}\n${pkg.importPath}`;
+    const earlier = new Map(previous.packages.map(p => [key(p), p]));
+    const kept = new Map<GoPackage, GoPackage>();
+    for (const pkg of this.packages) {
+      const old = earlier.get(key(pkg));
+      const stamp = this.dirStamps.get(pkg.dir);
+      if (!old || previous.dirStamps.get(pkg.dir) !== stamp) continue;
+      if (previous.checker.isChecked(old)) kept.set(pkg, old);
+    }
+    // An import moved when it names another package than before.
+    const moved = (path: string) => {
+      const now = this.byImportPath.get(path);
+      const was = previous.byImportPath.get(path);
+      return now ? !kept.has(now) || kept.get(now) !== was : was !== undefined;
+    };
+    for (let changed = true; changed; ) {
+      changed = false;
+      for (const pkg of kept.keys()) {
+        const imports = pkg.files.flatMap(f => f.ast.imports);
+        if (imports.some(spec => moved(unquoteGoString(spec.path.value)))) {
+          kept.delete(pkg);
+          changed = true;
+        }
+      }
+    }
+    for (const [i, pkg] of this.packages.entries()) {
+      const old = kept.get(pkg);
+      if (!old) continue;
+      this.packages[i] = old;
+      if (!old.isXTest) this.byImportPath.set(old.importPath, old);
+      for (const file of old.files) this.byFile.set(file.filePath, file);
+    }
+    this.checker = previous.checker.reuse(
+      path => this.packageByImportPath(path),
+      new Set(kept.values())
+    );
+  }
+
+  private sourceFile(
+    filePath: string,
+    parsed: ParsedFile
+  ): GoSourceFile | undefined {
+    if (!parsed.ast) {
+      this.errors.push({ filePath, message: '', ...parsed.error });
+      return undefined;
+    }
+    // Files are created afresh for every program, since type-checking
+    // attaches scopes and packages to them; the syntax trees are shared.
+    return {
+      filePath,
+      src: parsed.src,
+      ast: parsed.ast,
+      lineStarts: parsed.lineStarts,
+      pkg: undefined as unknown as GoPackage,
+    };
+  }
+
+  // Splits the files of a directory into the package proper and, if present,
+  // its external test package (package foo_test).
+  private addPackages(dir: string, files: GoSourceFile[]): void {
+    const importPath = this.importPathFor(dir);
+    const groups = new Map<string, GoSourceFile[]>();
+    for (const file of files) {
+      const name = file.ast.name.name;
+      const key =
+        file.filePath.endsWith('_test.go') && name.endsWith('_test')
+          ? name
+          : '';
+      (groups.get(key) ?? groups.set(key, []).get(key)!).push(file);
+    }
+
+    const main = groups.get('') ?? [];
+    // Files that disagree with the majority package name are loaded anyway
+    // but reported, mirroring the go command's error.
+    let mainName = '';
+    if (main.length > 0) {
+      const counts = new Map<string, number>();
+      for (const f of main) {
+        counts.set(f.ast.name.name, (counts.get(f.ast.name.name) ?? 0) + 1);
+      }
+      mainName = [...counts.entries()].sort((a, b) => b[1] - a[1])[0][0];
+      for (const f of main) {
+        if (f.ast.name.name !== mainName) {
+          this.errors.push({
+            filePath: f.filePath,
+            message: `found packages ${mainName} and ${f.ast.name.name} in ${dir}`,
+          });
+        }
+      }
+      this.addPackage(importPath, mainName, dir, main, false);
+    }
+
+    for (const [key, xfiles] of groups) {
+      if (key === '') continue;
+      this.addPackage(`${importPath}_test`, key, dir, xfiles, true);
+    }
+  }
+
+  private addPackage(
+    importPath: string,
+    name: string,
+    dir: string,
+    files: GoSourceFile[],
+    isXTest: boolean
+  ): void {
+    const pkg: GoPackage = { importPath, name, dir, files, isXTest };
+    for (const file of files) {
+      file.pkg = pkg;
+      this.byFile.set(file.filePath, file);
+    }
+    this.packages.push(pkg);
+    if (!isXTest) this.byImportPath.set(importPath, pkg);
+  }
+
+  packageByImportPath(importPath: string): GoPackage | undefined {
+    return this.byImportPath.get(importPath);
+  }
+
+  file(filePath: string): GoSourceFile | undefined {
+    return this.byFile.get(resolve(filePath));
+  }
+
+  get files(): GoSourceFile[] {
+    return this.packages.flatMap(pkg => pkg.files);
+  }
+
+  // Type-checks every package in the module. The result is cached, and
+  // the packages taken over from an earlier program are not checked again.
+  check(): GoChecker {
+    for (const pkg of this.packages.slice(this.checkedPackages)) {
+      this.checker.checkPackage(pkg);
+      this.checkedPackages++;
+    }
+    return this.checker;
+  }
+
+  // Like check, but reports each package and can be cancelled between them.
+  // Packages checked before a cancellation are not checked again. Calls may
+  // run concurrently: a package that another call checked while this one
+  // was waiting is skipped.
+  async checkAsync(task: TaskOptions = {}): Promise<GoChecker> {
+    const count = this.packages.length;
+    while (this.checkedPackages < count) {
+      const i = this.checkedPackages;
+      if (this.checker.isChecked(this.packages[i])) {
+        this.checkedPackages++;
+        continue;
+      }
+      await step(task, `Type-checking packages (${i + 1}/${count})`);
+      if (this.checkedPackages !== i) continue;
+      this.checker.checkPackage(this.packages[i]);
+      this.checkedPackages++;
+    }
+    return this.checker;
+  }
+
+  // Like checkAsync, but checks only the bodies of pkgs. The declarations
+  // of the packages they import are checked as they are used, which is
+  // enough for the information about pkgs to be complete.
+  async checkPackagesAsync(
+    pkgs: GoPackage[],
+    task: TaskOptions = {}
+  ): Promise<GoChecker> {
+    for (const [i, pkg] of pkgs.entries()) {
+      await step(task, `Type-checking packages (${i + 1}/${pkgs.length})`);
+      this.checker.checkPackage(pkg);
+    }
+    return this.checker;
+  }
+}
+
+// The import path of the directory of pkg, which an external test package
+// shares with the package it tests.
+export function dirImportPath(pkg: GoPackage): string {
+  return pkg.isXTest ? pkg.importPath.replace(/_test$/, '') : pkg.importPath;
+}
+
+// Describes the excluded files that could refer to the declarations of
+// pkgs, those in their directories or importing them, so that tools can warn
+// that these files were not looked at.
+export function exclusionWarnings(
+  program: GoProgram,
+  pkgs: Iterable<GoPackage>
+): string[] {
+  const seen = new Set<GoPackage>(pkgs);
+  const dirs = new Set([...seen].map(pkg => pkg.dir));
+  const paths = new Set([...seen].map(pkg => pkg.importPath));
+  return program.excluded
+    .filter(
+      f => dirs.has(dirname(f.filePath)) || f.imports.some(i => paths.has(i))
+    )
+    .map(
+      f =>
+        `${displayPath(f.filePath)} is excluded by build constraints (${f.constraint})`
+    );
+}
+
+// Loads and type-checks the module containing filePath and returns it
+// together with the parsed file, failing with the parser's message if the
+// file itself could not be parsed.
+export async function loadGoFile(
+  filePath: string,
+  options: LoadOptions = {}
+): Promise<{
+  program: GoProgram;
+  file: GoSourceFile;
+}> {
+  const program = await GoProgram.load(filePath, options);
+  const file = program.file(filePath);
+  if (!file) {
+    const abs = resolve(filePath);
+    const excluded = program.excluded.find(f => f.filePath === abs);
+    if (excluded) {
+      throw new ToolError(
+        'invalid_location',
+        `${filePath} is excluded by its build constraints (${excluded.constraint}); set build_flags, goos or goarch to include it`
+      );
+    }
+    const error = program.errors.find(e => e.filePath === abs);
+    if (error) {
+      throw new ToolError('compile_error', error.message, error.location);
+    }
+    throw new ToolError(
+      'invalid_location',
+      `Not a Go source file in the module: ${filePath}`
+    );
+  }
+  await program.checkAsync(options);
+  return { program, file };
+}
@@ -0,0 +1,217 @@
+// Moving top-level declarations between files, shared by the tools that
+// move them within a package or into another one.
+
+import type { FuncDecl, GenDecl, Node, Spec } from './go-ast.js';
+import { inspect } from './go-ast.js';
+import type { GoInfo } from './go-checker.js';
+import {
+  addImportEdits,
+  declRemovalEdit,
+  fileQualifier,
+  indentAt,
+  lineEnd,
+  lineStart,
+  reindent,
+  specRemovalEdit,
+} from './go-edit.js';
+import type { ImportRequest } from './go-edit.js';
+import type { GoProgram } from './go-loader.js';
+import { defaultPackageName } from './go-types.js';
+import type { GoSourceFile } from './go-types.js';
+import { applyTextEdits } from './edit-utils.js';
+import type { TextEdit } from './edit-utils.js';
+import { ToolError } from './tool-error.js';
+
+// What is moved: a whole top-level declaration, or one spec of a grouped
+// type or var declaration.
+export interface Moved {
+  decl: FuncDecl | GenDecl;
+  spec?: Spec;
+}
+
+// Returns what can be moved out of file: its declarations, with grouped
+// type and var declarations split into their specs.
+export function movableDecls(file: GoSourceFile): Moved[] {
+  return file.ast.decls.flatMap((decl): Moved[] => {
+    if (decl.type === 'BadDecl') return [];
+    if (decl.type === 'FuncDecl') return [{ decl }];
+    if (decl.tok === 'import') return [];
+    if (decl.lparen >= 0 && decl.specs.length > 1 && decl.tok !== 'const') {
+      return decl.specs.map(spec => ({ decl, spec }));
+    }
+    return [{ decl }];
+  });
+}
+
+export function namesOf(moved: Moved): string[] {
+  const { decl } = moved;
+  if (decl.type === 'FuncDecl') {
+    let recv = decl.recv?.list[0]?.fieldType;
+    while (recv && recv.type !== 'Ident') {
+      if (recv.type === 'StarExpr') recv = recv.x;
+      else if (recv.type === 'IndexExpr' || recv.type === 'ParenExpr') {
+        recv = recv.x;
+      } else break;
+    }
+    const prefix = recv?.type === 'Ident' ? `${recv.name}.` : '';
+    return [`${prefix}${decl.name.name}`];
+  }
+  const specs = moved.spec ? [moved.spec] : (decl as GenDecl).specs;
+  return specs.flatMap(s =>
+    s.type === 'TypeSpec'
+      ? [s.name.name]
+      : s.type === 'ValueSpec'
+        ? s.names.map(id => id.name)
+        : []
+  );
+}
+
+// Returns the //go:build line of file, if any.
+export function buildConstraint(file: GoSourceFile): string | undefined {
+  for (const group of file.ast.comments) {
+    if (group.pos > file.ast.name.pos) break;
+    const line = group.list.find(c => c.text.startsWith('//go:build'));
+    if (line) return line.text.trim();
+  }
+  return undefined;
+}
+
+// Returns the edits that make the package references in root mean the same
+// in dest. Packages dest does not import yet are added to missing under the
+// name root uses for them.
+export function qualifyEdits(
+  program: GoProgram,
+  info: GoInfo,
+  file: GoSourceFile,
+  root: Node,
+  dest: GoSourceFile,
+  missing: ImportRequest[]
+): TextEdit[] {
+  const qualifier = fileQualifier(dest, missing);
+  const names = new Map<string, string>();
+  const nameFor = (path: string, local: string) => {
+    let q = names.get(path);
+    if (q === undefined) {
+      const name =
+        program.packageByImportPath(path)?.name ?? defaultPackageName(path);
+      q = qualifier({ path, name });
+      const added = missing.find(m => m.path === path);
+      if (added && local) {
+        added.name = local;
+        q = local;
+      }
+      names.set(path, q);
+    }
+    return q;
+  };
+
+  const edits: TextEdit[] = [];
+  inspect(root, n => {
+    if (n.type === 'SelectorExpr' && n.x.type === 'Ident') {
+      const obj = info.uses.get(n.x);
+      if (obj?.kind !== 'pkgname' || !obj.imported) return;
+      if (obj.imported === 'C') {
+        throw new ToolError(
+          'unsupported_construct',
+          'Declarations that use cgo cannot be moved'
+        );
+      }
+      const q = nameFor(obj.imported, n.x.name);
+      if (q !== n.x.name) {
+        const end = q ? n.x.end : n.sel.pos;
+        edits.push({ pos: n.x.pos, end, newText: q });
+      }
+      return false;
+    }
+    if (n.type !== 'Ident') return;
+    // Identifiers of other packages that are not selected come from dot
+    // imports.
+    const obj = info.uses.get(n);
+    if (!obj || obj.parent?.kind !== 'package' || obj.pkg === file.pkg) return;
+    const path = obj.pkg?.importPath ?? obj.externalPath;
+    if (!path) return;
+    const q = nameFor(path, '');
+    if (q) edits.push({ pos: n.pos, end: n.pos, newText: `${q}.` });
+  });
+  return edits;
+}
+
+// Returns the text of moved as written in dest, ending in a newline, and
+// the edit removing it from file. Extra edits of the text, such as renames,
+// are given in the positions of file.
+export function movedText(
+  program: GoProgram,
+  info: GoInfo,
+  file: GoSourceFile,
+  moved: Moved,
+  dest: GoSourceFile,
+  missing: ImportRequest[],
+  extra: TextEdit[] = []
+): { text: string; removal: TextEdit } {
+  const { decl, spec } = moved;
+  const node = spec ?? decl;
+  const pos = lineStart(file.src, node.doc?.pos ?? node.pos);
+  const end = lineEnd(file.src, node.end - 1);
+  const edits = [
+    ...qualifyEdits(program, info, file, node, dest, missing),
+    ...extra,
+  ];
+  let text: string;
+  let removal: TextEdit;
+  if (spec) {
+    const keyword = `${(decl as GenDecl).tok} `;
+    text = reindent(file, pos, end, indentAt(file.src, spec.pos), '', [
+      { pos: spec.pos, end: spec.pos, newText: keyword },
+      ...edits,
+    ]);
+    removal = specRemovalEdit(file.src, spec);
+  } else {
+    text = applyTextEdits(
+      file.src.substring(pos, end),
+      edits.map(e => ({ ...e, pos: e.pos - pos, end: e.end - pos }))
+    );
+    removal = declRemovalEdit(file.src, decl);
+  }
+  if (!text.endsWith('\n')) text += '\n';
+  return { text, removal };
+}
+
+// Returns the content of dest with texts appended, separated by blank
+// lines, and the missing imports added.
+export function appendTo(
+  dest: GoSourceFile,
+  missing: ImportRequest[],
+  texts: string[]
+): string {
+  const tail = dest.src.endsWith('\n') ? '\n' : '\n\n';
+  return applyTextEdits(dest.src, [
+    ...addImportEdits(dest, missing),
+    {
+      pos: dest.src.length,
+      end: dest.src.length,
+      newText: tail + texts.join('\n'),
+    },
+  ]);
+}
+
+// Merges the overlapping removals of adjacent declarations of src. A
+// merged removal reaching the end of src takes the blank line before it.
+export function mergeRemovals(src: string, removals: TextEdit[]): TextEdit[] {
+  const merged: TextEdit[] = [];
+  for (const r of [...removals].sort((a, b) => a.pos - b.pos)) {
+    const last = merged[merged.length - 1];
+    if (last && r.pos <= last.end) {
+      last.end = Math.max(last.end, r.end);
+    } else {
+      merged.push({ ...r });
+    }
+  }
+  const last = merged[merged.length - 1];
+  if (
+    last?.end === src.length &&
+    src.substring(last.pos - 2, last.pos) === '\n\n'
+  ) {
+    last.pos--;
+  }
+  return merged;
+}
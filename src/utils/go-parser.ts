@@ -0,0 +1,1663 @@
+// A recursive-descent parser for Go source files, structured after
+// go/parser. It produces the syntax tree defined in go-ast.ts while keeping
+// exact source positions so that refactorings can edit the original text
+// rather than reprinting it.
+
+import { scanGo, GoSyntaxError } from './go-scanner.js';
+import type { GoToken, GoComment } from './go-scanner.js';
+import {
+  computeLineStarts,
+  indexToLine,
+  indexToPosition,
+} from './line-utils.js';
+import { displayPath } from './file-utils.js';
+import { ToolError } from './tool-error.js';
+import type {
+  ArrayType,
+  BasicLit,
+  BlockStmt,
+  CallExpr,
+  CaseClause,
+  ChanType,
+  CommClause,
+  Comment,
+  CommentGroup,
+  CompositeLit,
+  Decl,
+  Expr,
+  Field,
+  FieldList,
+  File,
+  FuncDecl,
+  FuncType,
+  GenDecl,
+  Ident,
+  ImportSpec,
+  InterfaceType,
+  MapType,
+  Spec,
+  Stmt,
+  StructType,
+  TypeSpec,
+  ValueSpec,
+} from './go-ast.js';
+
+const BINARY_PRECEDENCE: Record<string, number> = {
+  '||': 1,
+  '&&': 2,
+  '==': 3,
+  '!=': 3,
+  '<': 3,
+  '<=': 3,
+  '>': 3,
+  '>=': 3,
+  '+': 4,
+  '-': 4,
+  '|': 4,
+  '^': 4,
+  '*': 5,
+  '/': 5,
+  '%': 5,
+  '<<': 5,
+  '>>': 5,
+  '&': 5,
+  '&^': 5,
+};
+
+const ASSIGN_OPS = new Set([
+  '=',
+  ':=',
+  '+=',
+  '-=',
+  '*=',
+  '/=',
+  '%=',
+  '&=',
+  '|=',
+  '^=',
+  '<<=',
+  '>>=',
+  '&^=',
+]);
+
+// Tokens that can begin a type in a parameter or field declaration.
+const TYPE_START = new Set([
+  'IDENT',
+  '[',
+  'struct',
+  '*',
+  'func',
+  'interface',
+  'map',
+  'chan',
+  '(',
+  '<-',
+  '~',
+]);
+
+type SimpleStmtMode = 'basic' | 'labelOk' | 'rangeOk';
+
+interface ParamEntry {
+  name?: Ident;
+  fieldType?: Expr;
+  pos: number;
+}
+
+export function binaryPrecedence(op: string): number {
+  return BINARY_PRECEDENCE[op] ?? 0;
+}
+
+class Parser {
+  private readonly src: string;
+  private readonly tokens: GoToken[];
+  private readonly rawComments: GoComment[];
+  private readonly lineStarts: number[];
+  private idx = 0;
+  private commentIdx = 0;
+  private exprLev = 0;
+
+  tok = '';
+  lit = '';
+  pos = 0;
+  end = 0;
+
+  readonly comments: CommentGroup[] = [];
+  leadComment?: CommentGroup;
+  lineComment?: CommentGroup;
+
+  constructor(src: string) {
+    const { tokens, comments } = scanGo(src);
+    this.src = src;
+    this.tokens = tokens;
+    this.rawComments = comments;
+    this.lineStarts = computeLineStarts(src);
+    this.load();
+  }
+
+  private line(index: number): number {
+    return indexToLine(this.lineStarts, index);
+  }
+
+  private load(): void {
+    const t = this.tokens[this.idx];
+    this.tok = t.tok;
+    this.lit = t.lit;
+    this.pos = t.pos;
+    this.end = t.end;
+  }
+
+  // Advances to the next token, collecting any comments in between into
+  // comment groups the way go/parser does.
+  next(): void {
+    const prevPos = this.pos;
+    if (this.idx < this.tokens.length - 1) this.idx++;
+    this.load();
+
+    this.leadComment = undefined;
+    this.lineComment = undefined;
+
+    const pending: GoComment[] = [];
+    while (
+      this.commentIdx < this.rawComments.length &&
+      this.rawComments[this.commentIdx].pos < this.pos
+    ) {
+      pending.push(this.rawComments[this.commentIdx++]);
+    }
+    if (pending.length === 0) return;
+
+    const groups: Comment[][] = [];
+    for (const c of pending) {
+      const last = groups[groups.length - 1];
+      if (last) {
+        const prev = last[last.length - 1];
+        if (this.line(c.pos) - this.line(prev.end) <= 1) {
+          last.push({ text: c.text, pos: c.pos, end: c.end });
+          continue;
+        }
+      }
+      groups.push([{ text: c.text, pos: c.pos, end: c.end }]);
+    }
+
+    const made = groups.map(list => {
+      const group: CommentGroup = {
+        list,
+        pos: list[0].pos,
+        end: list[list.length - 1].end,
+      };
+      this.comments.push(group);
+      return group;
+    });
+
+    const prevLine = this.line(prevPos);
+    const first = made[0];
+    if (this.idx > 0 && this.line(first.pos) === prevLine) {
+      // A comment group on the same line as the previous token is a
+      // line comment; split off comments on later lines.
+      const sameLine = first.list.filter(c => this.line(c.pos) === prevLine);
+      if (sameLine.length < first.list.length) {
+        const rest = first.list.slice(sameLine.length);
+        first.list = sameLine;
+        first.end = sameLine[sameLine.length - 1].end;
+        const restGroup: CommentGroup = {
+          list: rest,
+          pos: rest[0].pos,
+          end: rest[rest.length - 1].end,
+        };
+        this.comments.push(restGroup);
+        made.splice(1, 0, restGroup);
+      }
+      this.lineComment = first;
+      made.shift();
+    }
+
+    const last = made[made.length - 1];
+    if (last && this.line(last.end) + 1 >= this.line(this.pos)) {
+      this.leadComment = last;
+    }
+  }
+
+  error(message: string, pos: number = this.pos): never {
+    throw new GoSyntaxError(message, pos);
+  }
+
+  private describe(): string {
+    if (this.tok === ';' && this.lit === '\n') return 'newline';
+    if (this.tok === 'EOF') return 'EOF';
+    return this.lit || this.tok;
+  }
+
+  expect(tok: string): number {
+    const pos = this.pos;
+    if (this.tok !== tok) {
+      this.error(`expected '${tok}', found ${this.describe()}`);
+    }
+    this.next();
+    return pos;
+  }
+
+  // Like expect, but also accepts an automatically inserted semicolon
+  // before a closing ')' or '}' as in go/parser's expectClosing.
+  expectClosing(tok: string): number {
+    if (this.tok !== tok && this.tok === ';' && this.lit === '\n') {
+      this.next();
+    }
+    return this.expect(tok);
+  }
+
+  expectSemi(): void {
+    if (this.tok === ')' || this.tok === '}') return;
+    if (this.tok === ';') {
+      this.next();
+      return;
+    }
+    this.error(`expected ';', found ${this.describe()}`);
+  }
+
+  got(tok: string): boolean {
+    if (this.tok === tok) {
+      this.next();
+      return true;
+    }
+    return false;
+  }
+
+  peek(offset = 1): GoToken {
+    return this.tokens[Math.min(this.idx + offset, this.tokens.length - 1)];
+  }
+
+  // --------------------------------------------------------------------------
+  // Identifiers and lists
+
+  parseIdent(): Ident {
+    const pos = this.pos;
+    let name = '_';
+    if (this.tok === 'IDENT') {
+      name = this.lit;
+      this.next();
+    } else {
+      this.expect('IDENT');
+    }
+    return { type: 'Ident', name, pos, end: pos + name.length };
+  }
+
+  parseIdentList(): Ident[] {
+    const list = [this.parseIdent()];
+    while (this.got(',')) {
+      list.push(this.parseIdent());
+    }
+    return list;
+  }
+
+  parseExprList(): Expr[] {
+    const list = [this.parseExpr()];
+    while (this.got(',')) {
+      list.push(this.parseExpr());
+    }
+    return list;
+  }
+
+  // --------------------------------------------------------------------------
+  // Types
+
+  parseType(): Expr {
+    const t = this.tryType();
+    if (!t) this.error(`expected type, found ${this.describe()}`);
+    return t;
+  }
+
+  parseQualifiedIdent(ident?: Ident): Expr {
+    let x: Expr = ident ?? this.parseIdent();
+    if (this.tok === '.') {
+      this.next();
+      const sel = this.parseIdent();
+      x = { type: 'SelectorExpr', x, sel, pos: x.pos, end: sel.end };
+    }
+    if (this.tok === '[') {
+      x = this.parseTypeInstance(x);
+    }
+    return x;
+  }
+
+  parseTypeInstance(x: Expr): Expr {
+    this.expect('[');
+    this.exprLev++;
+    const indices = [this.parseType()];
+    while (this.got(',')) {
+      if (this.tok === ']') break;
+      indices.push(this.parseType());
+    }
+    this.exprLev--;
+    const end = this.expectClosing(']') + 1;
+    return { type: 'IndexExpr', x, indices, pos: x.pos, end };
+  }
+
+  parseArrayType(lbrack: number, len?: Expr): ArrayType {
+    if (len === undefined) {
+      this.exprLev++;
+      if (this.tok === '...') {
+        len = { type: 'Ellipsis', pos: this.pos, end: this.end };
+        this.next();
+      } else if (this.tok !== ']') {
+        len = this.parseRhs();
+      }
+      this.exprLev--;
+      this.expect(']');
+    }
+    const elt = this.parseType();
+    return { type: 'ArrayType', len, elt, pos: lbrack, end: elt.end };
+  }
+
+  parseStructType(): StructType {
+    const pos = this.expect('struct');
+    const opening = this.expect('{');
+    const list: Field[] = [];
+    while (this.tok === 'IDENT' || this.tok === '*' || this.tok === '(') {
+      list.push(this.parseFieldDecl());
+    }
+    const rbrace = this.expectClosing('}');
+    return {
+      type: 'StructType',
+      fields: { type: 'FieldList', opening, list, pos: opening, end: rbrace + 1 },
+      pos,
+      end: rbrace + 1,
+    };
+  }
+
+  parseFieldDecl(): Field {
+    const doc = this.leadComment;
+    const pos = this.pos;
+    let names: Ident[] = [];
+    let fieldType: Expr;
+
+    if (this.tok === 'IDENT') {
+      const name = this.parseIdent();
+      if (this.tok === '.' || this.tok === 'STRING' || this.tok === ';' || this.tok === '}') {
+        // Embedded type, possibly qualified.
+        fieldType = this.parseQualifiedIdent(name);
+      } else if (this.tok === '[') {
+        const { name: n, fieldType: t } = this.parseArrayFieldOrTypeInstance(name);
+        if (n) names = [n];
+        fieldType = t!;
+      } else {
+        names = [name];
+        while (this.got(',')) {
+          names.push(this.parseIdent());
+        }
+        fieldType = this.parseType();
+      }
+    } else if (this.tok === '*') {
+      const star = this.pos;
+      this.next();
+      const x = this.parseQualifiedIdent();
+      fieldType = { type: 'StarExpr', x, pos: star, end: x.end };
+    } else {
+      const lparen = this.expect('(');
+      const x = this.parseType();
+      const rparen = this.expect(')');
+      fieldType = { type: 'ParenExpr', x, pos: lparen, end: rparen + 1 };
+    }
+
+    let tag: BasicLit | undefined;
+    if (this.tok === 'STRING') {
+      tag = { type: 'BasicLit', kind: 'STRING', value: this.lit, pos: this.pos, end: this.end };
+      this.next();
+    }
+    const end = tag ? tag.end : fieldType.end;
+    this.expectSemi();
+    const comment = this.lineComment;
+    return { type: 'Field', doc, names, fieldType, tag, comment, pos, end };
+  }
+
+  // Disambiguates "name [N]T" (a named array or slice field) from "T[A]"
+  // (an embedded or unnamed generic type instance).
+  parseArrayFieldOrTypeInstance(name: Ident): ParamEntry {
+    const lbrack = this.expect('[');
+    if (this.tok === ']') {
+      this.next();
+      const elt = this.parseType();
+      return {
+        name,
+        fieldType: { type: 'ArrayType', elt, pos: lbrack, end: elt.end },
+        pos: name.pos,
+      };
+    }
+
+    this.exprLev++;
+    const args: Expr[] = [];
+    if (this.tok === '...') {
+      args.push({ type: 'Ellipsis', pos: this.pos, end: this.end });
+      this.next();
+    } else {
+      args.push(this.parseTypeOrExpr());
+      while (this.got(',')) {
+        if (this.tok === ']') break;
+        args.push(this.parseTypeOrExpr());
+      }
+    }
+    this.exprLev--;
+    const rbrack = this.expectClosing(']');
+
+    if (args.length === 1 && TYPE_START.has(this.tok)) {
+      const elt = this.parseType();
+      return {
+        name,
+        fieldType: { type: 'ArrayType', len: args[0], elt, pos: lbrack, end: elt.end },
+        pos: name.pos,
+      };
+    }
+    return {
+      fieldType: { type: 'IndexExpr', x: name, indices: args, pos: name.pos, end: rbrack + 1 },
+      pos: name.pos,
+    };
+  }
+
+  parsePointerType(): Expr {
+    const pos = this.expect('*');
+    const x = this.parseType();
+    return { type: 'StarExpr', x, pos, end: x.end };
+  }
+
+  parseFuncType(pos: number): FuncType {
+    let typeParams: FieldList | undefined;
+    if (this.tok === '[') {
+      typeParams = this.parseParameters(true);
+    }
+    const params = this.parseParameters(false);
+    const results = this.parseResult();
+    return {
+      type: 'FuncType',
+      typeParams,
+      params,
+      results,
+      pos,
+      end: results ? results.end : params.end,
+    };
+  }
+
+  parseResult(): FieldList | undefined {
+    if (this.tok === '(') {
+      return this.parseParameters(false);
+    }
+    const t = this.tryType();
+    if (t) {
+      const field: Field = { type: 'Field', names: [], fieldType: t, pos: t.pos, end: t.end };
+      return { type: 'FieldList', opening: -1, list: [field], pos: t.pos, end: t.end };
+    }
+    return undefined;
+  }
+
+  parseParamEntry(typeParams: boolean): ParamEntry {
+    const pos = this.pos;
+    if (this.tok === 'IDENT') {
+      const ident = this.parseIdent();
+      if (typeParams) {
+        // Type parameters are always named.
+        if (this.tok === ',' || this.tok === ']') {
+          return { fieldType: ident, pos };
+        }
+        return { name: ident, fieldType: this.parseConstraint(), pos };
+      }
+      switch (this.tok) {
+        case '.': {
+          return { fieldType: this.parseQualifiedIdent(ident), pos };
+        }
+        case '[': {
+          return this.parseArrayFieldOrTypeInstance(ident);
+        }
+        case ',':
+        case ')':
+          return { fieldType: ident, pos };
+        case '...': {
+          const dots = this.pos;
+          this.next();
+          const elt = this.parseType();
+          return { name: ident, fieldType: { type: 'Ellipsis', elt, pos: dots, end: elt.end }, pos };
+        }
+        default: {
+          return { name: ident, fieldType: this.parseType(), pos };
+        }
+      }
+    }
+    if (this.tok === '...') {
+      const dots = this.pos;
+      this.next();
+      const elt = this.parseType();
+      return { fieldType: { type: 'Ellipsis', elt, pos: dots, end: elt.end }, pos };
+    }
+    return { fieldType: typeParams ? this.parseConstraint() : this.parseType(), pos };
+  }
+
+  parseParameters(typeParams: boolean): FieldList {
+    const open = typeParams ? '[' : '(';
+    const close = typeParams ? ']' : ')';
+    const opening = this.expect(open);
+    const entries: ParamEntry[] = [];
+    const prevLev = this.exprLev;
+    this.exprLev = 0;
+    while (this.tok !== close && this.tok !== 'EOF') {
+      entries.push(this.parseParamEntry(typeParams));
+      if (!this.got(',')) break;
+    }
+    this.exprLev = prevLev;
+    const closing = this.expectClosing(close);
+
+    const list: Field[] = [];
+    const named = entries.some(e => e.name);
+    if (named) {
+      let pending: Ident[] = [];
+      for (const entry of entries) {
+        if (entry.name) {
+          const names = [...pending, entry.name];
+          list.push({
+            type: 'Field',
+            names,
+            fieldType: entry.fieldType!,
+            pos: names[0].pos,
+            end: entry.fieldType!.end,
+          });
+          pending = [];
+        } else if (entry.fieldType?.type === 'Ident') {
+          pending.push(entry.fieldType);
+        } else {
+          this.error('mixed named and unnamed parameters', entry.pos);
+        }
+      }
+      if (pending.length > 0) {
+        this.error('mixed named and unnamed parameters', pending[0].pos);
+      }
+    } else {
+      for (const entry of entries) {
+        list.push({
+          type: 'Field',
+          names: [],
+          fieldType: entry.fieldType!,
+          pos: entry.fieldType!.pos,
+          end: entry.fieldType!.end,
+        });
+      }
+    }
+    return { type: 'FieldList', opening, list, pos: opening, end: closing + 1 };
+  }
+
+  // Parses a type constraint: a union of possibly approximate type terms.
+  parseConstraint(): Expr {
+    let x = this.parseTypeTerm();
+    while (this.tok === '|') {
+      this.next();
+      const y = this.parseTypeTerm();
+      x = { type: 'BinaryExpr', op: '|', x, y, pos: x.pos, end: y.end };
+    }
+    return x;
+  }
+
+  parseTypeTerm(): Expr {
+    if (this.tok === '~') {
+      const pos = this.pos;
+      this.next();
+      const x = this.parseType();
+      return { type: 'UnaryExpr', op: '~', x, pos, end: x.end };
+    }
+    return this.parseType();
+  }
+
+  parseInterfaceType(): InterfaceType {
+    const pos = this.expect('interface');
+    const opening = this.expect('{');
+    const list: Field[] = [];
+    while (this.tok !== '}' && this.tok !== 'EOF') {
+      const doc = this.leadComment;
+      const start = this.pos;
+      if (this.tok === 'IDENT' && this.peek().tok === '(') {
+        const name = this.parseIdent();
+        const ft = this.parseFuncType(name.pos);
+        const end = ft.end;
+        this.expectSemi();
+        list.push({
+          type: 'Field',
+          doc,
+          names: [name],
+          fieldType: ft,
+          comment: this.lineComment,
+          pos: start,
+          end,
+        });
+      } else {
+        const t = this.parseConstraint();
+        this.expectSemi();
+        list.push({
+          type: 'Field',
+          doc,
+          names: [],
+          fieldType: t,
+          comment: this.lineComment,
+          pos: start,
+          end: t.end,
+        });
+      }
+    }
+    const rbrace = this.expectClosing('}');
+    return {
+      type: 'InterfaceType',
+      methods: { type: 'FieldList', opening, list, pos: opening, end: rbrace + 1 },
+      pos,
+      end: rbrace + 1,
+    };
+  }
+
+  parseMapType(): MapType {
+    const pos = this.expect('map');
+    this.expect('[');
+    const key = this.parseType();
+    this.expect(']');
+    const value = this.parseType();
+    return { type: 'MapType', key, value, pos, end: value.end };
+  }
+
+  parseChanType(): ChanType {
+    const pos = this.pos;
+    let dir: ChanType['dir'] = 'both';
+    if (this.tok === 'chan') {
+      this.next();
+      if (this.tok === '<-') {
+        this.next();
+        dir = 'send';
+      }
+    } else {
+      this.expect('<-');
+      this.expect('chan');
+      dir = 'recv';
+    }
+    const value = this.parseType();
+    return { type: 'ChanType', dir, value, pos, end: value.end };
+  }
+
+  tryType(): Expr | undefined {
+    switch (this.tok) {
+      case 'IDENT':
+        return this.parseQualifiedIdent();
+      case '[': {
+        const lbrack = this.pos;
+        this.next();
+        return this.parseArrayType(lbrack);
+      }
+      case 'struct':
+        return this.parseStructType();
+      case '*':
+        return this.parsePointerType();
+      case 'func': {
+        const pos = this.pos;
+        this.next();
+        return this.parseFuncType(pos);
+      }
+      case 'interface':
+        return this.parseInterfaceType();
+      case 'map':
+        return this.parseMapType();
+      case 'chan':
+      case '<-':
+        return this.parseChanType();
+      case '(': {
+        const lparen = this.pos;
+        this.next();
+        const x = this.parseType();
+        const rparen = this.expect(')');
+        return { type: 'ParenExpr', x, pos: lparen, end: rparen + 1 };
+      }
+    }
+    return undefined;
+  }
+
+  // --------------------------------------------------------------------------
+  // Blocks
+
+  parseStmtList(): Stmt[] {
+    const list: Stmt[] = [];
+    while (
+      this.tok !== 'case' &&
+      this.tok !== 'default' &&
+      this.tok !== '}' &&
+      this.tok !== 'EOF'
+    ) {
+      list.push(this.parseStmt());
+    }
+    return list;
+  }
+
+  parseBlockStmt(): BlockStmt {
+    const lbrace = this.expect('{');
+    const list = this.parseStmtList();
+    const rbrace = this.expectClosing('}');
+    return { type: 'BlockStmt', list, lbrace, rbrace, pos: lbrace, end: rbrace + 1 };
+  }
+
+  // --------------------------------------------------------------------------
+  // Expressions
+
+  parseFuncTypeOrLit(): Expr {
+    const pos = this.expect('func');
+    const funcType = this.parseFuncType(pos);
+    if (this.tok !== '{') {
+      return funcType;
+    }
+    this.exprLev++;
+    const body = this.parseBlockStmt();
+    this.exprLev--;
+    return { type: 'FuncLit', funcType, body, pos, end: body.end };
+  }
+
+  parseOperand(): Expr {
+    switch (this.tok) {
+      case 'IDENT':
+        return this.parseIdent();
+      case 'INT':
+      case 'FLOAT':
+      case 'IMAG':
+      case 'CHAR':
+      case 'STRING': {
+        const lit: BasicLit = {
+          type: 'BasicLit',
+          kind: this.tok as BasicLit['kind'],
+          value: this.lit,
+          pos: this.pos,
+          end: this.end,
+        };
+        this.next();
+        return lit;
+      }
+      case '(': {
+        const lparen = this.pos;
+        this.next();
+        this.exprLev++;
+        const x = this.parseTypeOrExpr();
+        this.exprLev--;
+        const rparen = this.expectClosing(')');
+        return { type: 'ParenExpr', x, pos: lparen, end: rparen + 1 };
+      }
+      case 'func':
+        return this.parseFuncTypeOrLit();
+    }
+    const t = this.tryType();
+    if (t) return t;
+    this.error(`expected operand, found ${this.describe()}`);
+  }
+
+  parseTypeOrExpr(): Expr {
+    if (this.tok === '~') {
+      return this.parseConstraint();
+    }
+    return this.parseExpr();
+  }
+
+  parseSelectorOrTypeAssertion(x: Expr): Expr {
+    this.expect('.');
+    if (this.tok === 'IDENT') {
+      const sel = this.parseIdent();
+      return { type: 'SelectorExpr', x, sel, pos: x.pos, end: sel.end };
+    }
+    this.expect('(');
+    let assertType: Expr | undefined;
+    if (this.tok === 'type') {
+      this.next();
+    } else {
+      assertType = this.parseType();
+    }
+    const rparen = this.expect(')');
+    return { type: 'TypeAssertExpr', x, assertType, pos: x.pos, end: rparen + 1 };
+  }
+
+  parseIndexOrSlice(x: Expr): Expr {
+    this.expect('[');
+    this.exprLev++;
+    const index: (Expr | undefined)[] = [undefined, undefined, undefined];
+    let ncolons = 0;
+    if (this.tok !== ':') {
+      index[0] = this.parseRhsOrType();
+    }
+    const args: Expr[] = [];
+    if (this.tok === ',') {
+      // Generic instantiation with multiple type arguments.
+      args.push(index[0]!);
+      while (this.got(',')) {
+        if (this.tok === ']') break;
+        args.push(this.parseType());
+      }
+    } else {
+      while (this.tok === ':' && ncolons < 2) {
+        ncolons++;
+        this.next();
+        if (this.tok !== ':' && this.tok !== ']') {
+          index[ncolons] = this.parseRhs();
+        }
+      }
+    }
+    this.exprLev--;
+    const rbrack = this.expectClosing(']');
+
+    if (ncolons > 0) {
+      return {
+        type: 'SliceExpr',
+        x,
+        low: index[0],
+        high: index[1],
+        max: index[2],
+        pos: x.pos,
+        end: rbrack + 1,
+      };
+    }
+    return {
+      type: 'IndexExpr',
+      x,
+      indices: args.length > 0 ? args : [index[0]!],
+      pos: x.pos,
+      end: rbrack + 1,
+    };
+  }
+
+  parseCallOrConversion(fun: Expr): CallExpr {
+    const lparen = this.expect('(');
+    this.exprLev++;
+    const args: Expr[] = [];
+    let ellipsis: number | undefined;
+    while (this.tok !== ')' && this.tok !== 'EOF') {
+      args.push(this.parseRhsOrType());
+      if (this.tok === '...') {
+        ellipsis = this.pos;
+        this.next();
+      }
+      if (!this.got(',')) break;
+    }
+    this.exprLev--;
+    const rparen = this.expectClosing(')');
+    return { type: 'CallExpr', fun, args, lparen, ellipsis, pos: fun.pos, end: rparen + 1 };
+  }
+
+  parseElement(): Expr {
+    const x = this.parseValue();
+    if (this.tok === ':') {
+      this.next();
+      const value = this.parseValue();
+      return { type: 'KeyValueExpr', key: x, value, pos: x.pos, end: value.end };
+    }
+    return x;
+  }
+
+  parseValue(): Expr {
+    if (this.tok === '{') {
+      return this.parseLiteralValue(undefined);
+    }
+    return this.parseExpr();
+  }
+
+  parseLiteralValue(litType: Expr | undefined): CompositeLit {
+    const lbrace = this.expect('{');
+    const elts: Expr[] = [];
+    this.exprLev++;
+    while (this.tok !== '}' && this.tok !== 'EOF') {
+      elts.push(this.parseElement());
+      if (!this.got(',')) break;
+    }
+    this.exprLev--;
+    const rbrace = this.expectClosing('}');
+    return {
+      type: 'CompositeLit',
+      litType,
+      elts,
+      lbrace,
+      pos: litType ? litType.pos : lbrace,
+      end: rbrace + 1,
+    };
+  }
+
+  parsePrimaryExpr(): Expr {
+    let x = this.parseOperand();
+    for (;;) {
+      switch (this.tok) {
+        case '.':
+          x = this.parseSelectorOrTypeAssertion(x);
+          continue;
+        case '[':
+          x = this.parseIndexOrSlice(x);
+          continue;
+        case '(':
+          x = this.parseCallOrConversion(x);
+          continue;
+        case '{':
+          if (isCompositeLitType(x, this.exprLev)) {
+            x = this.parseLiteralValue(x);
+            continue;
+          }
+          return x;
+      }
+      return x;
+    }
+  }
+
+  parseUnaryExpr(): Expr {
+    const pos = this.pos;
+    switch (this.tok) {
+      case '+':
+      case '-':
+      case '!':
+      case '^':
+      case '&':
+      case '~': {
+        const op = this.tok;
+        this.next();
+        const x = this.parseUnaryExpr();
+        return { type: 'UnaryExpr', op, x, pos, end: x.end };
+      }
+      case '<-': {
+        if (this.peek().tok === 'chan') {
+          return this.parseChanType();
+        }
+        this.next();
+        const x = this.parseUnaryExpr();
+        return { type: 'UnaryExpr', op: '<-', x, pos, end: x.end };
+      }
+      case '*': {
+        this.next();
+        const x = this.parseUnaryExpr();
+        return { type: 'StarExpr', x, pos, end: x.end };
+      }
+    }
+    return this.parsePrimaryExpr();
+  }
+
+  parseBinaryExpr(prec1: number): Expr {
+    let x = this.parseUnaryExpr();
+    for (;;) {
+      const op = this.tok;
+      const prec = binaryPrecedence(op);
+      if (prec < prec1) return x;
+      this.next();
+      const y = this.parseBinaryExpr(prec + 1);
+      x = { type: 'BinaryExpr', op, x, y, pos: x.pos, end: y.end };
+    }
+  }
+
+  parseExpr(): Expr {
+    return this.parseBinaryExpr(1);
+  }
+
+  parseRhs(): Expr {
+    return this.parseExpr();
+  }
+
+  parseRhsOrType(): Expr {
+    return this.parseTypeOrExpr();
+  }
+
+  // --------------------------------------------------------------------------
+  // Statements
+
+  parseSimpleStmt(mode: SimpleStmtMode): { stmt: Stmt; isRange: boolean } {
+    const pos = this.pos;
+    if (mode === 'rangeOk' && this.tok === 'range') {
+      // for range x
+      this.next();
+      const x = this.parseExpr();
+      return {
+        stmt: { type: 'RangeStmt', x, body: emptyBlock(), pos, end: x.end },
+        isRange: true,
+      };
+    }
+
+    const lhs = this.parseExprList();
+
+    if (ASSIGN_OPS.has(this.tok)) {
+      const tok = this.tok;
+      const tokPos = this.pos;
+      this.next();
+      if (mode === 'rangeOk' && this.tok === 'range' && (tok === '=' || tok === ':=')) {
+        this.next();
+        const x = this.parseExpr();
+        return {
+          stmt: {
+            type: 'RangeStmt',
+            key: lhs[0],
+            value: lhs[1],
+            tok: tok as ':=' | '=',
+            x,
+            body: emptyBlock(),
+            pos,
+            end: x.end,
+          },
+          isRange: true,
+        };
+      }
+      const rhs = this.parseExprList();
+      return {
+        stmt: { type: 'AssignStmt', lhs, tok, tokPos, rhs, pos, end: rhs[rhs.length - 1].end },
+        isRange: false,
+      };
+    }
+
+    if (lhs.length > 1) {
+      this.error(`expected 1 expression, found ${lhs.length}`, lhs[0].pos);
+    }
+    const x = lhs[0];
+
+    switch (this.tok) {
+      case ':':
+        if (mode === 'labelOk' && x.type === 'Ident') {
+          this.next();
+          if (this.tok === '}' || this.tok === 'case' || this.tok === 'default') {
+            // A label at the end of a block labels an empty statement.
+            const empty: Stmt = { type: 'EmptyStmt', implicit: true, pos: this.pos, end: this.pos };
+            return {
+              stmt: { type: 'LabeledStmt', label: x, stmt: empty, pos, end: this.pos },
+              isRange: false,
+            };
+          }
+          const stmt = this.parseStmt();
+          return {
+            stmt: { type: 'LabeledStmt', label: x, stmt, pos, end: stmt.end },
+            isRange: false,
+          };
+        }
+        break;
+      case '<-': {
+        this.next();
+        const value = this.parseExpr();
+        return {
+          stmt: { type: 'SendStmt', chan: x, value, pos, end: value.end },
+          isRange: false,
+        };
+      }
+      case '++':
+      case '--': {
+        const tok = this.tok as '++' | '--';
+        const end = this.end;
+        this.next();
+        return { stmt: { type: 'IncDecStmt', x, tok, pos, end }, isRange: false };
+      }
+    }
+    return { stmt: { type: 'ExprStmt', x, pos, end: x.end }, isRange: false };
+  }
+
+  parseCallExprFor(keyword: string): Expr {
+    const x = this.parseExpr();
+    if (x.type !== 'CallExpr') {
+      this.error(`expression in ${keyword} must be function call`, x.pos);
+    }
+    return x;
+  }
+
+  parseReturnStmt(): Stmt {
+    const pos = this.expect('return');
+    let results: Expr[] = [];
+    if (this.tok !== ';' && this.tok !== '}') {
+      results = this.parseExprList();
+    }
+    const end = results.length > 0 ? results[results.length - 1].end : pos + 6;
+    this.expectSemi();
+    return { type: 'ReturnStmt', results, pos, end };
+  }
+
+  parseBranchStmt(tok: 'break' | 'continue' | 'goto' | 'fallthrough'): Stmt {
+    const pos = this.expect(tok);
+    let label: Ident | undefined;
+    if (tok !== 'fallthrough' && this.tok === 'IDENT') {
+      label = this.parseIdent();
+    }
+    const end = label ? label.end : pos + tok.length;
+    this.expectSemi();
+    return { type: 'BranchStmt', tok, label, pos, end };
+  }
+
+  // Parses the header of an if, switch or for statement. Composite
+  // literals of bare type names are not permitted at this expression level.
+  parseIfHeader(): { init?: Stmt; cond: Expr } {
+    if (this.tok === '{') {
+      this.error('missing condition in if statement');
+    }
+    const prevLev = this.exprLev;
+    this.exprLev = -1;
+    let init: Stmt | undefined;
+    let cond: Expr | undefined;
+    if (this.tok !== ';') {
+      init = this.parseSimpleStmt('basic').stmt;
+    }
+    if (this.tok === ';') {
+      this.next();
+      if (this.tok === '{') {
+        this.error('missing condition in if statement');
+      }
+      const s = this.parseSimpleStmt('basic').stmt;
+      if (s.type !== 'ExprStmt') {
+        this.error('cannot use statement as value', s.pos);
+      }
+      cond = s.x;
+    } else {
+      if (!init || init.type !== 'ExprStmt') {
+        this.error('cannot use statement as value', init?.pos ?? this.pos);
+      }
+      cond = init.x;
+      init = undefined;
+    }
+    this.exprLev = prevLev;
+    return { init, cond };
+  }
+
+  parseIfStmt(): Stmt {
+    const pos = this.expect('if');
+    const { init, cond } = this.parseIfHeader();
+    const body = this.parseBlockStmt();
+    let elseStmt: Stmt | undefined;
+    if (this.tok === 'else') {
+      this.next();
+      if (this.tok === 'if') {
+        elseStmt = this.parseIfStmt();
+      } else if (this.tok === '{') {
+        elseStmt = this.parseBlockStmt();
+        this.expectSemi();
+      } else {
+        this.error('expected if statement or block');
+      }
+    } else {
+      this.expectSemi();
+    }
+    return { type: 'IfStmt', init, cond, body, else: elseStmt, pos, end: (elseStmt ?? body).end };
+  }
+
+  parseCaseClause(): CaseClause {
+    const pos = this.pos;
+    let list: Expr[] | undefined;
+    if (this.tok === 'case') {
+      this.next();
+      list = [this.parseTypeOrExpr()];
+      while (this.got(',')) {
+        list.push(this.parseTypeOrExpr());
+      }
+    } else {
+      this.expect('default');
+    }
+    const colon = this.expect(':');
+    const body = this.parseStmtList();
+    const end = body.length > 0 ? body[body.length - 1].end : colon + 1;
+    return { type: 'CaseClause', list, colon, body, pos, end };
+  }
+
+  parseSwitchStmt(): Stmt {
+    const pos = this.expect('switch');
+    let s1: Stmt | undefined;
+    let s2: Stmt | undefined;
+    if (this.tok !== '{') {
+      const prevLev = this.exprLev;
+      this.exprLev = -1;
+      if (this.tok !== ';') {
+        s2 = this.parseSimpleStmt('basic').stmt;
+      }
+      if (this.tok === ';') {
+        this.next();
+        s1 = s2;
+        s2 = undefined;
+        if (this.tok !== '{') {
+          s2 = this.parseSimpleStmt('basic').stmt;
+        }
+      }
+      this.exprLev = prevLev;
+    }
+
+    const typeSwitch = s2 !== undefined && isTypeSwitchGuard(s2);
+    const lbrace = this.expect('{');
+    const list: Stmt[] = [];
+    while (this.tok === 'case' || this.tok === 'default') {
+      list.push(this.parseCaseClause());
+    }
+    const rbrace = this.expectClosing('}');
+    this.expectSemi();
+    const body: BlockStmt = { type: 'BlockStmt', list, lbrace, rbrace, pos: lbrace, end: rbrace + 1 };
+
+    if (typeSwitch) {
+      return { type: 'TypeSwitchStmt', init: s1, assign: s2!, body, pos, end: body.end };
+    }
+    let tag: Expr | undefined;
+    if (s2) {
+      if (s2.type !== 'ExprStmt') {
+        this.error('switch expression must be an expression', s2.pos);
+      }
+      tag = s2.x;
+    }
+    return { type: 'SwitchStmt', init: s1, tag, body, pos, end: body.end };
+  }
+
+  parseCommClause(): CommClause {
+    const pos = this.pos;
+    let comm: Stmt | undefined;
+    if (this.tok === 'case') {
+      this.next();
+      comm = this.parseSimpleStmt('basic').stmt;
+    } else {
+      this.expect('default');
+    }
+    const colon = this.expect(':');
+    const body = this.parseStmtList();
+    const end = body.length > 0 ? body[body.length - 1].end : colon + 1;
+    return { type: 'CommClause', comm, colon, body, pos, end };
+  }
+
+  parseSelectStmt(): Stmt {
+    const pos = this.expect('select');
+    const lbrace = this.expect('{');
+    const list: Stmt[] = [];
+    while (this.tok === 'case' || this.tok === 'default') {
+      list.push(this.parseCommClause());
+    }
+    const rbrace = this.expectClosing('}');
+    this.expectSemi();
+    const body: BlockStmt = { type: 'BlockStmt', list, lbrace, rbrace, pos: lbrace, end: rbrace + 1 };
+    return { type: 'SelectStmt', body, pos, end: body.end };
+  }
+
+  parseForStmt(): Stmt {
+    const pos = this.expect('for');
+    let s1: Stmt | undefined;
+    let s2: Stmt | undefined;
+    let s3: Stmt | undefined;
+    let isRange = false;
+
+    if (this.tok !== '{') {
+      const prevLev = this.exprLev;
+      this.exprLev = -1;
+      if (this.tok !== ';') {
+        const r = this.parseSimpleStmt('rangeOk');
+        s2 = r.stmt;
+        isRange = r.isRange;
+      }
+      if (!isRange && this.tok === ';') {
+        this.next();
+        s1 = s2;
+        s2 = undefined;
+        if (this.tok !== ';') {
+          s2 = this.parseSimpleStmt('basic').stmt;
+        }
+        this.expect(';');
+        if (this.tok !== '{') {
+          s3 = this.parseSimpleStmt('basic').stmt;
+        }
+      }
+      this.exprLev = prevLev;
+    }
+
+    const body = this.parseBlockStmt();
+    this.expectSemi();
+
+    if (isRange && s2?.type === 'RangeStmt') {
+      return { ...s2, body, pos, end: body.end };
+    }
+
+    let cond: Expr | undefined;
+    if (s2) {
+      if (s2.type !== 'ExprStmt') {
+        this.error('expected for loop condition', s2.pos);
+      }
+      cond = s2.x;
+    }
+    return { type: 'ForStmt', init: s1, cond, post: s3, body, pos, end: body.end };
+  }
+
+  parseStmt(): Stmt {
+    switch (this.tok) {
+      case 'const':
+      case 'type':
+      case 'var': {
+        const decl = this.parseGenDecl(this.tok);
+        return { type: 'DeclStmt', decl, pos: decl.pos, end: decl.end };
+      }
+      case 'IDENT':
+      case 'INT':
+      case 'FLOAT':
+      case 'IMAG':
+      case 'CHAR':
+      case 'STRING':
+      case 'func':
+      case '(':
+      case '[':
+      case 'struct':
+      case 'map':
+      case 'chan':
+      case 'interface':
+      case '+':
+      case '-':
+      case '*':
+      case '&':
+      case '^':
+      case '<-':
+      case '!': {
+        const { stmt } = this.parseSimpleStmt('labelOk');
+        if (stmt.type !== 'LabeledStmt') {
+          this.expectSemi();
+        }
+        return stmt;
+      }
+      case 'go':
+      case 'defer': {
+        const keyword = this.tok;
+        const pos = this.pos;
+        this.next();
+        const call = this.parseCallExprFor(keyword);
+        this.expectSemi();
+        return keyword === 'go'
+          ? { type: 'GoStmt', call, pos, end: call.end }
+          : { type: 'DeferStmt', call, pos, end: call.end };
+      }
+      case 'return':
+        return this.parseReturnStmt();
+      case 'break':
+      case 'continue':
+      case 'goto':
+      case 'fallthrough':
+        return this.parseBranchStmt(this.tok);
+      case '{': {
+        const block = this.parseBlockStmt();
+        this.expectSemi();
+        return block;
+      }
+      case 'if':
+        return this.parseIfStmt();
+      case 'switch':
+        return this.parseSwitchStmt();
+      case 'select':
+        return this.parseSelectStmt();
+      case 'for':
+        return this.parseForStmt();
+      case ';': {
+        const stmt: Stmt = { type: 'EmptyStmt', implicit: this.lit === '\n', pos: this.pos, end: this.pos };
+        this.next();
+        return stmt;
+      }
+      case '}':
+        return { type: 'EmptyStmt', implicit: true, pos: this.pos, end: this.pos };
+    }
+    this.error(`expected statement, found ${this.describe()}`);
+  }
+
+  // --------------------------------------------------------------------------
+  // Declarations
+
+  parseImportSpec(doc: CommentGroup | undefined): ImportSpec {
+    const pos = this.pos;
+    let name: Ident | undefined;
+    if (this.tok === '.') {
+      name = { type: 'Ident', name: '.', pos: this.pos, end: this.end };
+      this.next();
+    } else if (this.tok === 'IDENT') {
+      name = this.parseIdent();
+    }
+    if (this.tok !== 'STRING') {
+      this.error(`expected import path, found ${this.describe()}`);
+    }
+    const path: BasicLit = { type: 'BasicLit', kind: 'STRING', value: this.lit, pos: this.pos, end: this.end };
+    this.next();
+    this.expectSemi();
+    return { type: 'ImportSpec', doc, name, path, comment: this.lineComment, pos, end: path.end };
+  }
+
+  parseValueSpec(doc: CommentGroup | undefined, keyword: string, iota: number): ValueSpec {
+    const pos = this.pos;
+    const names = this.parseIdentList();
+    let valueType: Expr | undefined;
+    let values: Expr[] = [];
+    if (this.tok !== '=' && this.tok !== ';' && this.tok !== ')') {
+      valueType = this.parseType();
+    }
+    if (this.got('=')) {
+      values = this.parseExprList();
+    }
+    if (keyword === 'var' && !valueType && values.length === 0) {
+      this.error('missing variable type or initialization', pos);
+    }
+    const end = values.length > 0 ? values[values.length - 1].end : (valueType ?? names[names.length - 1]).end;
+    this.expectSemi();
+    return { type: 'ValueSpec', doc, names, valueType, values, comment: this.lineComment, iota, pos, end };
+  }
+
+  parseTypeSpec(doc: CommentGroup | undefined): TypeSpec {
+    const pos = this.pos;
+    const name = this.parseIdent();
+    let typeParams: FieldList | undefined;
+    let specType: Expr;
+
+    if (this.tok === '[') {
+      const next = this.peek();
+      const after = this.peek(2);
+      if (next.tok === 'IDENT' && after.tok !== ']' && startsTypeParam(after.tok)) {
+        typeParams = this.parseParameters(true);
+        this.got('=');
+        specType = this.parseType();
+        const end = specType.end;
+        this.expectSemi();
+        return { type: 'TypeSpec', doc, name, typeParams, assign: false, specType, comment: this.lineComment, pos, end };
+      }
+      const lbrack = this.pos;
+      this.next();
+      specType = this.parseArrayType(lbrack);
+    } else {
+      const assign = this.got('=');
+      specType = this.parseType();
+      const end = specType.end;
+      this.expectSemi();
+      return { type: 'TypeSpec', doc, name, assign, specType, comment: this.lineComment, pos, end };
+    }
+    const end = specType.end;
+    this.expectSemi();
+    return { type: 'TypeSpec', doc, name, assign: false, specType, comment: this.lineComment, pos, end };
+  }
+
+  parseGenDecl(keyword: string): GenDecl {
+    const doc = this.leadComment;
+    const pos = this.expect(keyword);
+    const tok = keyword as GenDecl['tok'];
+    const specs: Spec[] = [];
+    let lparen = -1;
+    let rparen = -1;
+
+    const parseSpec = (specDoc: CommentGroup | undefined, iota: number): Spec => {
+      switch (tok) {
+        case 'import':
+          return this.parseImportSpec(specDoc);
+        case 'type':
+          return this.parseTypeSpec(specDoc);
+        default:
+          return this.parseValueSpec(specDoc, tok, iota);
+      }
+    };
+
+    if (this.tok === '(') {
+      lparen = this.pos;
+      this.next();
+      for (let iota = 0; this.tok !== ')' && this.tok !== 'EOF'; iota++) {
+        specs.push(parseSpec(this.leadComment, iota));
+      }
+      rparen = this.expect(')');
+      this.expectSemi();
+      return { type: 'GenDecl', doc, tok, lparen, rparen, specs, pos, end: rparen + 1 };
+    }
+
+    const spec = parseSpec(undefined, 0);
+    specs.push(spec);
+    return { type: 'GenDecl', doc, tok, lparen, rparen, specs, pos, end: spec.end };
+  }
+
+  parseFuncDecl(): FuncDecl {
+    const doc = this.leadComment;
+    const pos = this.expect('func');
+    let recv: FieldList | undefined;
+    if (this.tok === '(') {
+      recv = this.parseParameters(false);
+    }
+    const name = this.parseIdent();
+    const funcType = this.parseFuncType(pos);
+    let body: BlockStmt | undefined;
+    if (this.tok === '{') {
+      this.exprLev++;
+      body = this.parseBlockStmt();
+      this.exprLev--;
+    }
+    const end = body ? body.end : funcType.end;
+    this.expectSemi();
+    return { type: 'FuncDecl', doc, recv, name, funcType: { ...funcType, pos }, body, pos, end };
+  }
+
+  parseDecl(): Decl {
+    switch (this.tok) {
+      case 'const':
+      case 'type':
+      case 'var':
+        return this.parseGenDecl(this.tok);
+      case 'func':
+        return this.parseFuncDecl();
+    }
+    this.error(`expected declaration, found ${this.describe()}`);
+  }
+
+  parseFile(): File {
+    // Pick up any comments before the package clause.
+    this.leadComment = undefined;
+    const leading: GoComment[] = [];
+    while (
+      this.commentIdx < this.rawComments.length &&
+      this.rawComments[this.commentIdx].pos < this.pos
+    ) {
+      leading.push(this.rawComments[this.commentIdx++]);
+    }
+    let doc: CommentGroup | undefined;
+    let current: Comment[] = [];
+    const flush = () => {
+      if (current.length === 0) return;
+      const group: CommentGroup = { list: current, pos: current[0].pos, end: current[current.length - 1].end };
+      this.comments.push(group);
+      current = [];
+      return group;
+    };
+    for (const c of leading) {
+      const last = current[current.length - 1];
+      if (last && this.line(c.pos) - this.line(last.end) > 1) flush();
+      current.push({ text: c.text, pos: c.pos, end: c.end });
+    }
+    const lastGroup = flush();
+    if (lastGroup && this.line(lastGroup.end) + 1 >= this.line(this.pos)) {
+      doc = lastGroup;
+    }
+
+    const packagePos = this.expect('package');
+    const name = this.parseIdent();
+    if (name.name === '_') {
+      this.error('invalid package name _', name.pos);
+    }
+    this.expectSemi();
+
+    const decls: Decl[] = [];
+    const imports: ImportSpec[] = [];
+    while (this.tok === 'import') {
+      const decl = this.parseGenDecl('import');
+      decls.push(decl);
+      imports.push(...(decl.specs as ImportSpec[]));
+    }
+    while (this.tok !== 'EOF') {
+      decls.push(this.parseDecl());
+    }
+
+    this.comments.sort((a, b) => a.pos - b.pos);
+    return {
+      type: 'File',
+      doc,
+      packagePos,
+      name,
+      decls,
+      imports,
+      comments: this.comments,
+      pos: packagePos,
+      end: this.src.length,
+    };
+  }
+}
+
+function emptyBlock(): BlockStmt {
+  return { type: 'BlockStmt', list: [], lbrace: -1, rbrace: -1, pos: -1, end: -1 };
+}
+
+function startsTypeParam(tok: string): boolean {
+  return (
+    tok === 'IDENT' ||
+    tok === ',' ||
+    tok === 'interface' ||
+    tok === '[' ||
+    tok === '*' ||
+    tok === '~' ||
+    tok === 'func' ||
+    tok === 'map' ||
+    tok === 'chan' ||
+    tok === 'struct' ||
+    tok === '('
+  );
+}
+
+// Reports whether a '{' following x starts a composite literal. Inside
+// control clause headers (exprLev < 0) a block is assumed instead unless x
+// is unambiguously a literal type.
+function isCompositeLitType(x: Expr, exprLev: number): boolean {
+  switch (x.type) {
+    case 'ArrayType':
+    case 'StructType':
+    case 'MapType':
+      return true;
+    case 'Ident':
+    case 'SelectorExpr':
+    case 'IndexExpr':
+      return exprLev >= 0;
+  }
+  return false;
+}
+
+function isTypeSwitchGuard(s: Stmt): boolean {
+  if (s.type === 'ExprStmt') {
+    return s.x.type === 'TypeAssertExpr' && s.x.assertType === undefined;
+  }
+  if (s.type === 'AssignStmt' && s.tok === ':=' && s.lhs.length === 1 && s.rhs.length === 1) {
+    const rhs = s.rhs[0];
+    return rhs.type === 'TypeAssertExpr' && rhs.assertType === undefined;
+  }
+  return false;
+}
+
+// Parses a complete Go source file. Syntax errors are reported as
+// "file:line:column: message".
+export function parseGoFile(filePath: string, src: string): File {
+  try {
+    return new Parser(src).parseFile();
+  } catch (error) {
+    if (error instanceof GoSyntaxError) {
+      const { line, column } = indexToPosition(src, error.pos);
+      throw new ToolError(
+        'compile_error',
+        `${filePath}:${line}:${column}: ${error.message}`,
+        { filePath: displayPath(filePath), line, column }
+      );
+    }
+    throw error;
+  }
+}
+
+// Parses a single Go expression, as used for caller-supplied snippets such
+// as default arguments.
+export function parseGoExpr(src: string): Expr {
+  const parser = new Parser(src);
+  try {
+    const x = parser.parseTypeOrExpr();
+    if (parser.tok === ';' && parser.lit === '\n') parser.next();
+    if (parser.tok !== 'EOF') {
+      parser.error(`unexpected ${parser.lit || parser.tok} after expression`);
+    }
+    return x;
+  } catch (error) {
+    if (error instanceof GoSyntaxError) {
+      throw new ToolError(
+        'invalid_argument',
+        `invalid expression ${JSON.stringify(src)}: ${error.message}`
+      );
+    }
+    throw error;
+  }
+}
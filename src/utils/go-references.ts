@@ -0,0 +1,358 @@
+import { inspect } from './go-ast.js';
+import type { Ident, ImportSpec, Node } from './go-ast.js';
+import type { GoObject, GoPackage, GoSourceFile } from './go-types.js';
+import { interfaceMethods, sameObject, under } from './go-types.js';
+import type { GoProgram } from './go-loader.js';
+import { displayPath } from './file-utils.js';
+import { ToolError } from './tool-error.js';
+import type { ErrorCandidate, ErrorLocation } from './tool-error.js';
+import {
+  byteOffsetToIndex,
+  indexToPosition,
+  positionToIndex,
+} from './line-utils.js';
+
+export interface GoLocationInput {
+  offset?: number;
+  line?: number;
+  column?: number;
+}
+
+export interface GoSymbolInput extends GoLocationInput {
+  // A name such as Lookup, Store.Get or store.Store.Get, as an alternative
+  // to a location.
+  symbol?: string;
+}
+
+export interface GoReference {
+  file: GoSourceFile;
+  pos: number;
+  end: number;
+  isDeclaration: boolean;
+}
+
+// Converts either a byte offset or a line/column pair into a string index
+// into the file content.
+export function resolveLocation(
+  file: GoSourceFile,
+  location: GoLocationInput
+): number {
+  if (location.offset !== undefined) {
+    return byteOffsetToIndex(file.src, location.offset);
+  }
+  if (location.line !== undefined && location.column !== undefined) {
+    return positionToIndex(
+      file.src,
+      { line: location.line, column: location.column },
+      file.lineStarts
+    );
+  }
+  throw new ToolError(
+    'invalid_location',
+    'Either offset or line and column must be provided'
+  );
+}
+
+// Formats pos in file as path:line:column.
+export function locationOf(file: GoSourceFile, pos: number): string {
+  const { line, column } = indexToPosition(file.src, pos, file.lineStarts);
+  return `${displayPath(file.filePath)}:${line}:${column}`;
+}
+
+// Returns the location of pos in file, for reporting with a ToolError.
+export function errorLocation(file: GoSourceFile, pos: number): ErrorLocation {
+  const { line, column } = indexToPosition(file.src, pos, file.lineStarts);
+  return { filePath: displayPath(file.filePath), line, column };
+}
+
+// Returns the identifier covering index. An index just past the end of an
+// identifier also counts, so that a cursor placed after a name works.
+export function identAt(file: GoSourceFile, index: number): Ident | undefined {
+  let found: Ident | undefined;
+  inspect(file.ast, node => {
+    if (found || node.end < index || node.pos > index) return false;
+    if (node.type === 'Ident') {
+      found = node;
+      return false;
+    }
+  });
+  return found;
+}
+
+function importSpecAt(
+  file: GoSourceFile,
+  index: number
+): ImportSpec | undefined {
+  return file.ast.imports.find(
+    spec => spec.path.pos <= index && index <= spec.path.end
+  );
+}
+
+export interface ResolvedSymbol {
+  obj: GoObject;
+  // The identifier at the requested location, if any. Unnamed imports are
+  // located by their path literal instead.
+  ident?: Ident;
+}
+
+// Resolves the object referred to by the identifier at index.
+export function symbolAt(
+  program: GoProgram,
+  file: GoSourceFile,
+  index: number
+): ResolvedSymbol {
+  const info = program.check().info;
+  const spec = importSpecAt(file, index);
+  if (spec && !spec.name) {
+    const obj = info.implicits.get(spec);
+    if (obj) return { obj };
+  }
+
+  const ident = identAt(file, index);
+  if (!ident) {
+    throw new ToolError(
+      'symbol_not_found',
+      'No identifier found at the given position'
+    );
+  }
+  const obj = info.objectOf(ident);
+  if (!obj) {
+    throw new ToolError(
+      'symbol_not_found',
+      `Could not resolve identifier '${ident.name}'`
+    );
+  }
+  if (obj.pos < 0 && !obj.externalPath) {
+    throw new ToolError(
+      'unsupported_construct',
+      `'${ident.name}' is a predeclared identifier`
+    );
+  }
+  return { obj, ident };
+}
+
+interface NamedSymbol {
+  obj: GoObject;
+  // The type declaring a field or method.
+  owner?: GoObject;
+}
+
+// Returns the fields and methods declared by the type named obj.
+function membersOf(obj: GoObject): GoObject[] {
+  const u = obj.type && under(obj.type);
+  return [
+    ...(obj.methods ?? []),
+    ...(u?.kind === 'struct' ? u.fields : []),
+    ...(u?.kind === 'interface' ? interfaceMethods(u) : []),
+  ];
+}
+
+// Returns the packages of the module that name, a package name or import
+// path, may refer to.
+function packagesNamed(program: GoProgram, name: string): GoPackage[] {
+  return program.packages.filter(
+    p =>
+      p.name === name ||
+      p.importPath === name ||
+      p.importPath.endsWith(`/${name}`)
+  );
+}
+
+// Finds the declarations in the module that symbol names: a package-level
+// name, qualified by a package name or import path or not, optionally
+// followed by a field or method of the type it names. Unqualified names
+// are looked up in the package of file first, as Go's scopes do.
+function symbolsNamed(
+  program: GoProgram,
+  file: GoSourceFile,
+  symbol: string
+): NamedSymbol[] {
+  const slash = symbol.lastIndexOf('/');
+  const parts = symbol.slice(slash + 1).split('.');
+  const word = /^[\p{L}_][\p{L}\p{Nd}_]*$/u;
+  // An import path alone names no declaration.
+  const pathOnly = slash >= 0 && parts.length === 1;
+  if (parts.length > 3 || pathOnly || !parts.every(p => word.test(p))) {
+    throw new ToolError(
+      'invalid_argument',
+      `'${symbol}' is not a symbol name such as Lookup, Store.Get or store.Store.Get`
+    );
+  }
+  // An import path qualifies the name as a whole.
+  parts[0] = symbol.slice(0, slash + 1) + parts[0];
+
+  const topLevel = (pkgs: GoPackage[], name: string): NamedSymbol[] =>
+    pkgs.flatMap(p => {
+      const obj = p.scope?.names.get(name);
+      return obj?.file ? [{ obj }] : [];
+    });
+  const members = (types: NamedSymbol[], name: string): NamedSymbol[] =>
+    types.flatMap(({ obj: owner }) =>
+      owner.kind === 'type'
+        ? membersOf(owner)
+            .filter(m => m.name === name && m.file)
+            .map(obj => ({ obj, owner }))
+        : []
+    );
+  const preferOwn = (pick: (pkgs: GoPackage[]) => NamedSymbol[]) => {
+    const own = pick([file.pkg]);
+    return own.length > 0 ? own : pick(program.packages);
+  };
+
+  const [a, b, c] = parts;
+  const found =
+    parts.length === 1
+      ? preferOwn(pkgs => topLevel(pkgs, a))
+      : parts.length === 2
+        ? [
+            ...topLevel(packagesNamed(program, a), b),
+            ...preferOwn(pkgs => members(topLevel(pkgs, a), b)),
+          ]
+        : members(topLevel(packagesNamed(program, a), b), c);
+  return found.filter(
+    (s, i) => found.findIndex(o => sameObject(o.obj, s.obj)) === i
+  );
+}
+
+// Returns a name for the symbol that symbolsNamed resolves to it alone.
+function qualifiedName(program: GoProgram, { obj, owner }: NamedSymbol) {
+  const pkg = (owner ?? obj).pkg!;
+  const shared = program.packages.filter(p => p.name === pkg.name).length;
+  const qualifier = shared > 1 ? pkg.importPath : pkg.name;
+  return owner
+    ? `${qualifier}.${owner.name}.${obj.name}`
+    : `${qualifier}.${obj.name}`;
+}
+
+// Resolves the object at the location of input, or the declaration of the
+// module its symbol names, which must be the only one.
+export function resolveSymbol(
+  program: GoProgram,
+  file: GoSourceFile,
+  input: GoSymbolInput
+): ResolvedSymbol {
+  const located = input.offset !== undefined || input.line !== undefined;
+  if (input.symbol === undefined) {
+    if (located) return symbolAt(program, file, resolveLocation(file, input));
+    throw new ToolError(
+      'invalid_location',
+      'Either offset, line and column, or symbol must be provided'
+    );
+  }
+  if (located) {
+    throw new ToolError(
+      'invalid_argument',
+      'Give either a location or a symbol name, not both'
+    );
+  }
+
+  program.check();
+  const found = symbolsNamed(program, file, input.symbol);
+  if (found.length === 1) return { obj: found[0].obj };
+  if (found.length === 0) {
+    throw new ToolError(
+      'symbol_not_found',
+      `No declaration in the module is named '${input.symbol}'`
+    );
+  }
+  const candidates: ErrorCandidate[] = found.map(s => ({
+    symbol: qualifiedName(program, s),
+    kind: objectKindLabel(s.obj),
+    ...errorLocation(s.obj.file!, s.obj.pos),
+  }));
+  throw new ToolError(
+    'ambiguous_location',
+    `'${input.symbol}' names ${found.length} declarations; give one of these instead:\n${candidates.map(c => `  ${c.symbol} (${c.kind} at ${c.filePath}:${c.line}:${c.column})`).join('\n')}`,
+    undefined,
+    candidates
+  );
+}
+
+// Describes the kind of obj the way Go documentation does.
+export function objectKindLabel(obj: GoObject): string {
+  if (obj.kind === 'pkgname') return 'package';
+  if (obj.kind === 'func' && obj.recv) return 'method';
+  if (obj.kind === 'var' && obj.isField) return 'field';
+  if (obj.kind === 'type' && obj.type?.kind === 'typeparam') {
+    return 'type parameter';
+  }
+  return obj.kind;
+}
+
+// Returns the name of the function obj, qualified by its receiver type if
+// it is a method, as in Store.Get.
+export function functionName(obj: GoObject): string {
+  return obj.recv ? `${obj.recv.name}.${obj.name}` : obj.name;
+}
+
+function isSameSymbol(a: GoObject | undefined, target: GoObject): boolean {
+  if (!a) return false;
+  return sameObject(a, target);
+}
+
+// Finds every reference to obj across the program, including its
+// declaration. References are sorted by file and position.
+export function findReferences(
+  program: GoProgram,
+  target: GoObject
+): GoReference[] {
+  const info = program.check().info;
+  const refs: GoReference[] = [];
+  const seen = new Set<string>();
+  const add = (file: GoSourceFile, node: Node, isDeclaration: boolean) => {
+    const key = `${file.filePath}:${node.pos}`;
+    if (seen.has(key)) return;
+    seen.add(key);
+    refs.push({ file, pos: node.pos, end: node.end, isDeclaration });
+  };
+
+  // Embedded fields are named after their type, so a type's references
+  // include selections of fields that embed it.
+  const embeddedFields: GoObject[] = [];
+  if (target.kind === 'type') {
+    for (const obj of info.uses.values()) {
+      if (obj.embedded && obj.isField && !embeddedFields.includes(obj)) {
+        embeddedFields.push(obj);
+      }
+    }
+  }
+
+  const visitFiles = (match: (obj: GoObject | undefined) => boolean) => {
+    for (const file of program.files) {
+      inspect(file.ast, node => {
+        if (node.type === 'ImportSpec' && !node.name) {
+          if (match(info.implicits.get(node))) add(file, node.path, true);
+          return;
+        }
+        if (node.type !== 'Ident') return;
+        const def = info.defs.get(node);
+        if (def) {
+          if (match(def)) add(file, node, true);
+          return;
+        }
+        if (match(info.uses.get(node))) add(file, node, false);
+      });
+    }
+  };
+
+  visitFiles(obj => isSameSymbol(obj, target));
+
+  if (embeddedFields.length > 0) {
+    const fields = embeddedFields.filter(f =>
+      refs.some(r => r.file === f.file && r.pos === f.pos)
+    );
+    if (fields.length > 0) {
+      visitFiles(
+        obj => !!obj?.isField && fields.some(f => isSameSymbol(obj, f))
+      );
+    }
+  }
+
+  return refs.sort((a, b) =>
+    a.file.filePath === b.file.filePath
+      ? a.pos - b.pos
+      : a.file.filePath < b.file.filePath
+        ? -1
+        : 1
+  );
+}
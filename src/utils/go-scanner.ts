@@ -0,0 +1,380 @@
+// A scanner for Go source text that follows the rules of go/scanner,
+// including automatic semicolon insertion. Positions are string indices
+// into the scanned source.
+
+export interface GoToken {
+  tok: string;
+  lit: string;
+  pos: number;
+  end: number;
+}
+
+export interface GoComment {
+  text: string;
+  pos: number;
+  end: number;
+}
+
+export interface GoScanResult {
+  tokens: GoToken[];
+  comments: GoComment[];
+}
+
+export const GO_KEYWORDS = new Set([
+  'break',
+  'case',
+  'chan',
+  'const',
+  'continue',
+  'default',
+  'defer',
+  'else',
+  'fallthrough',
+  'for',
+  'func',
+  'go',
+  'goto',
+  'if',
+  'import',
+  'interface',
+  'map',
+  'package',
+  'range',
+  'return',
+  'select',
+  'struct',
+  'switch',
+  'type',
+  'var',
+]);
+
+// Operators ordered so that the longest match is tried first.
+const OPERATORS = [
+  '<<=',
+  '>>=',
+  '&^=',
+  '...',
+  '&&',
+  '||',
+  '<-',
+  '++',
+  '--',
+  '==',
+  '!=',
+  '<=',
+  '>=',
+  ':=',
+  '+=',
+  '-=',
+  '*=',
+  '/=',
+  '%=',
+  '&=',
+  '|=',
+  '^=',
+  '<<',
+  '>>',
+  '&^',
+  '+',
+  '-',
+  '*',
+  '/',
+  '%',
+  '&',
+  '|',
+  '^',
+  '<',
+  '>',
+  '=',
+  '!',
+  '(',
+  ')',
+  '[',
+  ']',
+  '{',
+  '}',
+  ',',
+  ';',
+  '.',
+  ':',
+  '~',
+];
+
+const SEMICOLON_TRIGGERS = new Set([
+  'IDENT',
+  'INT',
+  'FLOAT',
+  'IMAG',
+  'CHAR',
+  'STRING',
+  'break',
+  'continue',
+  'fallthrough',
+  'return',
+  '++',
+  '--',
+  ')',
+  ']',
+  '}',
+]);
+
+export class GoSyntaxError extends Error {
+  readonly pos: number;
+
+  constructor(message: string, pos: number) {
+    super(message);
+    this.name = 'GoSyntaxError';
+    this.pos = pos;
+  }
+}
+
+function isLetter(ch: string): boolean {
+  return (
+    (ch >= 'a' && ch <= 'z') ||
+    (ch >= 'A' && ch <= 'Z') ||
+    ch === '_' ||
+    (ch >= '\u0080' && /\p{L}/u.test(ch))
+  );
+}
+
+function isDigit(ch: string): boolean {
+  return (ch >= '0' && ch <= '9') || (ch >= '\u0080' && /\p{Nd}/u.test(ch));
+}
+
+export function isGoIdentifier(name: string): boolean {
+  if (name.length === 0 || GO_KEYWORDS.has(name)) return false;
+  const chars = [...name];
+  return (
+    isLetter(chars[0]) && chars.every(ch => isLetter(ch) || isDigit(ch))
+  );
+}
+
+export function scanGo(src: string): GoScanResult {
+  const tokens: GoToken[] = [];
+  const comments: GoComment[] = [];
+  let i = 0;
+  let insertSemi = false;
+
+  const push = (tok: string, lit: string, pos: number, end: number) => {
+    tokens.push({ tok, lit, pos, end });
+    insertSemi = SEMICOLON_TRIGGERS.has(tok);
+  };
+
+  const autoSemicolon = (pos: number) => {
+    tokens.push({ tok: ';', lit: '\n', pos, end: pos });
+    insertSemi = false;
+  };
+
+  while (i < src.length) {
+    const ch = src[i];
+
+    if (ch === '\n') {
+      if (insertSemi) autoSemicolon(i);
+      i++;
+      continue;
+    }
+    if (ch === ' ' || ch === '\t' || ch === '\r' || ch === '\uFEFF') {
+      i++;
+      continue;
+    }
+
+    const start = i;
+
+    if (ch === '/' && src[i + 1] === '/') {
+      let end = src.indexOf('\n', i);
+      if (end === -1) end = src.length;
+      if (insertSemi) autoSemicolon(start);
+      comments.push({ text: src.substring(start, end), pos: start, end });
+      i = end;
+      continue;
+    }
+
+    if (ch === '/' && src[i + 1] === '*') {
+      const close = src.indexOf('*/', i + 2);
+      if (close === -1) {
+        throw new GoSyntaxError('comment not terminated', start);
+      }
+      const end = close + 2;
+      const text = src.substring(start, end);
+      if (insertSemi && text.includes('\n')) autoSemicolon(start);
+      comments.push({ text, pos: start, end });
+      i = end;
+      continue;
+    }
+
+    if (isLetter(ch)) {
+      let end = i + 1;
+      while (end < src.length && (isLetter(src[end]) || isDigit(src[end]))) {
+        end++;
+      }
+      const word = src.substring(start, end);
+      push(GO_KEYWORDS.has(word) ? word : 'IDENT', word, start, end);
+      i = end;
+      continue;
+    }
+
+    if (isDigit(ch) || (ch === '.' && isDigit(src[i + 1] ?? ''))) {
+      const { tok, end } = scanNumber(src, i);
+      push(tok, src.substring(start, end), start, end);
+      i = end;
+      continue;
+    }
+
+    if (ch === '"') {
+      let end = i + 1;
+      while (end < src.length && src[end] !== '"') {
+        if (src[end] === '\n') {
+          throw new GoSyntaxError('string literal not terminated', start);
+        }
+        if (src[end] === '\\') end++;
+        end++;
+      }
+      if (end >= src.length) {
+        throw new GoSyntaxError('string literal not terminated', start);
+      }
+      end++;
+      push('STRING', src.substring(start, end), start, end);
+      i = end;
+      continue;
+    }
+
+    if (ch === '`') {
+      const close = src.indexOf('`', i + 1);
+      if (close === -1) {
+        throw new GoSyntaxError('raw string literal not terminated', start);
+      }
+      const end = close + 1;
+      push('STRING', src.substring(start, end), start, end);
+      i = end;
+      continue;
+    }
+
+    if (ch === "'") {
+      let end = i + 1;
+      while (end < src.length && src[end] !== "'") {
+        if (src[end] === '\n') {
+          throw new GoSyntaxError('rune literal not terminated', start);
+        }
+        if (src[end] === '\\') end++;
+        end++;
+      }
+      if (end >= src.length) {
+        throw new GoSyntaxError('rune literal not terminated', start);
+      }
+      end++;
+      push('CHAR', src.substring(start, end), start, end);
+      i = end;
+      continue;
+    }
+
+    const op = OPERATORS.find(candidate => src.startsWith(candidate, i));
+    if (!op) {
+      throw new GoSyntaxError(`invalid character ${JSON.stringify(ch)}`, i);
+    }
+    push(op, op, start, start + op.length);
+    i += op.length;
+  }
+
+  if (insertSemi) autoSemicolon(src.length);
+  tokens.push({ tok: 'EOF', lit: '', pos: src.length, end: src.length });
+  return { tokens, comments };
+}
+
+function scanNumber(src: string, start: number): { tok: string; end: number } {
+  let i = start;
+  let tok = 'INT';
+  const isHexDigit = (c: string) => /[0-9a-fA-F_]/.test(c);
+  const isDecDigit = (c: string) => /[0-9_]/.test(c);
+
+  if (src[i] === '0' && /[xX]/.test(src[i + 1] ?? '')) {
+    i += 2;
+    while (i < src.length && isHexDigit(src[i])) i++;
+    if (src[i] === '.') {
+      tok = 'FLOAT';
+      i++;
+      while (i < src.length && isHexDigit(src[i])) i++;
+    }
+    if (/[pP]/.test(src[i] ?? '')) {
+      tok = 'FLOAT';
+      i++;
+      if (/[+-]/.test(src[i] ?? '')) i++;
+      while (i < src.length && isDecDigit(src[i])) i++;
+    }
+  } else if (src[i] === '0' && /[bBoO]/.test(src[i + 1] ?? '')) {
+    i += 2;
+    while (i < src.length && isDecDigit(src[i])) i++;
+  } else {
+    while (i < src.length && isDecDigit(src[i])) i++;
+    if (src[i] === '.') {
+      tok = 'FLOAT';
+      i++;
+      while (i < src.length && isDecDigit(src[i])) i++;
+    }
+    if (/[eE]/.test(src[i] ?? '')) {
+      tok = 'FLOAT';
+      i++;
+      if (/[+-]/.test(src[i] ?? '')) i++;
+      while (i < src.length && isDecDigit(src[i])) i++;
+    }
+  }
+
+  if (src[i] === 'i') {
+    tok = 'IMAG';
+    i++;
+  }
+  return { tok, end: i };
+}
+
+const SIMPLE_ESCAPES: Record<string, number> = {
+  a: 7,
+  b: 8,
+  f: 12,
+  n: 10,
+  r: 13,
+  t: 9,
+  v: 11,
+  '\\': 92,
+  "'": 39,
+  '"': 34,
+};
+
+// Decodes a Go string or rune literal into its value. Byte escapes such as
+// \xff are decoded as UTF-8.
+export function unquoteGoString(lit: string): string {
+  if (lit.startsWith('`')) {
+    return lit.slice(1, -1).replace(/\r/g, '');
+  }
+  const body = lit.slice(1, -1);
+  const bytes: number[] = [];
+  const pushCodePoint = (cp: number) => {
+    bytes.push(...Buffer.from(String.fromCodePoint(cp), 'utf-8'));
+  };
+  for (let i = 0; i < body.length; i++) {
+    const ch = body[i];
+    if (ch !== '\\') {
+      const cp = body.codePointAt(i)!;
+      pushCodePoint(cp);
+      if (cp > 0xffff) i++;
+      continue;
+    }
+    const esc = body[++i];
+    if (esc in SIMPLE_ESCAPES) {
+      bytes.push(SIMPLE_ESCAPES[esc]);
+    } else if (esc === 'x') {
+      bytes.push(parseInt(body.substr(i + 1, 2), 16));
+      i += 2;
+    } else if (esc === 'u') {
+      pushCodePoint(parseInt(body.substr(i + 1, 4), 16));
+      i += 4;
+    } else if (esc === 'U') {
+      pushCodePoint(parseInt(body.substr(i + 1, 8), 16));
+      i += 8;
+    } else if (esc >= '0' && esc <= '7') {
+      bytes.push(parseInt(body.substr(i, 3), 8));
+      i += 2;
+    } else {
+      throw new Error(`invalid escape sequence \\${esc} in ${lit}`);
+    }
+  }
+  return Buffer.from(bytes).toString('utf-8');
+}
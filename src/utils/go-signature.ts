@@ -0,0 +1,719 @@
+// Rewriting the parameters of a function, of the interface methods that go
+// with it and of their calls, shared by the tools changing signatures.
+
+import type {
+  CallExpr,
+  Expr,
+  Field,
+  FuncDecl,
+  FuncType,
+  Ident,
+  Node,
+} from './go-ast.js';
+import { inspect, pathEnclosingInterval, unparen } from './go-ast.js';
+import { isPure, relatedMethods, scopeAt } from './go-analysis.js';
+import type { GoInfo } from './go-checker.js';
+import {
+  addImportEdits,
+  basicZero,
+  checkIdentifier,
+  fileQualifier,
+  indentAt,
+  packageNamed,
+  pruneImports,
+  transplant,
+  zeroOf,
+} from './go-edit.js';
+import type { ImportRequest, Packages } from './go-edit.js';
+import type { GoProgram } from './go-loader.js';
+import { parseGoExpr } from './go-parser.js';
+import {
+  errorLocation,
+  findReferences,
+  locationOf,
+  objectKindLabel,
+} from './go-references.js';
+import type {
+  GoObject,
+  GoSourceFile,
+  Qualifier,
+  SignatureType,
+} from './go-types.js';
+import { applyTextEdits } from './edit-utils.js';
+import type { FileChange, TextEdit } from './edit-utils.js';
+import { displayPath } from './file-utils.js';
+import { step } from './task.js';
+import type { TaskOptions } from './task.js';
+import { ToolError } from './tool-error.js';
+
+// One entry of the new parameter list. Existing parameters are identified
+// by their 0-based index in the current signature, and each of them must be
+// either kept or dropped. Kept and added parameters appear in list order.
+export type ParameterChange =
+  | { action: 'keep'; index: number }
+  | { action: 'drop'; index: number }
+  | {
+      action: 'add';
+      name: string;
+      // A Go type written as in the file declaring the function.
+      type: string;
+      // The argument passed at existing call sites, the zero value of the
+      // type when omitted.
+      defaultValue?: string;
+    };
+
+// A function, method or interface method whose parameters are rewritten.
+interface Target {
+  obj: GoObject;
+  file: GoSourceFile;
+  funcType: FuncType;
+  // The declaration of a function or concrete method, whose body uses the
+  // parameters.
+  decl?: FuncDecl;
+}
+
+// An added parameter with its type and the argument for existing calls,
+// both written from the point of view of the target's file.
+interface Addition {
+  name: string;
+  type: string;
+  value: string;
+}
+
+// The edits of one file, with the imports they need.
+export interface FileEdits {
+  edits: TextEdit[];
+  missing: ImportRequest[];
+  qualifier: Qualifier;
+}
+
+// A call whose argument list is replaced. Calls may be nested in the
+// arguments of others, so the text is built once the inner ones are done.
+interface CallRewrite {
+  pos: number;
+  end: number;
+  render: (textOf: (e: Expr) => string) => string;
+}
+
+// Returns the names of the parameters of ft, one per parameter, paired with
+// the field declaring them. Unnamed parameters have an empty name.
+function parameterFields(ft: FuncType): { name: string; field: Field }[] {
+  return ft.params.list.flatMap(field =>
+    field.names.length === 0
+      ? [{ name: '', field }]
+      : field.names.map(id => ({ name: id.name, field }))
+  );
+}
+
+function targetOf(obj: GoObject): Target {
+  const decl = obj.decl;
+  if (decl?.type === 'FuncDecl') {
+    return { obj, file: obj.file!, funcType: decl.funcType, decl };
+  }
+  if (decl?.type === 'Field' && decl.fieldType.type === 'FuncType') {
+    return { obj, file: obj.file!, funcType: decl.fieldType };
+  }
+  throw new ToolError(
+    'symbol_not_found',
+    `Cannot find the declaration of '${obj.name}'`
+  );
+}
+
+// Checks that changes account for each of the count current parameters
+// exactly once and keeps a variadic parameter last.
+function checkChanges(
+  name: string,
+  sig: SignatureType,
+  changes: ParameterChange[]
+): void {
+  const count = sig.params.length;
+  const seen = new Set<number>();
+  for (const change of changes) {
+    if (change.action === 'add') continue;
+    const { index } = change;
+    if (!Number.isInteger(index) || index < 0 || index >= count) {
+      throw new ToolError(
+        'invalid_argument',
+        `Parameter index ${index} is out of range; '${name}' has ${count} parameter${count === 1 ? '' : 's'}`
+      );
+    }
+    if (seen.has(index)) {
+      throw new ToolError(
+        'invalid_argument',
+        `Parameter ${index} is listed more than once`
+      );
+    }
+    seen.add(index);
+  }
+  for (let i = 0; i < count; i++) {
+    if (!seen.has(i)) {
+      const param = sig.params[i].name || 'unnamed';
+      throw new ToolError(
+        'invalid_argument',
+        `Parameter ${i} (${param}) must be either kept or dropped`
+      );
+    }
+  }
+  if (sig.variadic) {
+    const listed = changes.filter(c => c.action !== 'drop');
+    const isVariadic = (c: ParameterChange) =>
+      c.action === 'keep' && c.index === count - 1;
+    if (listed.some(isVariadic) && !isVariadic(listed[listed.length - 1])) {
+      throw new ToolError(
+        'invalid_argument',
+        `The variadic parameter ${sig.params[count - 1].name} must remain last`
+      );
+    }
+  }
+}
+
+// Returns the zero value of the type written as text in origin, or
+// undefined if it cannot be told, as for types outside the module.
+function zeroValue(
+  program: GoProgram,
+  origin: GoSourceFile,
+  typeExpr: Expr,
+  text: string
+): string | undefined {
+  let e = unparen(typeExpr);
+  switch (e.type) {
+    case 'StarExpr':
+    case 'MapType':
+    case 'ChanType':
+    case 'FuncType':
+    case 'InterfaceType':
+      return 'nil';
+    case 'ArrayType':
+      return e.len ? `${text}{}` : 'nil';
+    case 'StructType':
+      return `${text}{}`;
+  }
+  if (e.type === 'IndexExpr') e = unparen(e.x);
+  let obj: GoObject | undefined;
+  if (e.type === 'Ident') {
+    obj = origin.scope?.lookupParent(e.name);
+    if (obj?.kind === 'builtin' || (obj && obj.pos < 0 && !obj.externalPath)) {
+      return e.name === 'error' || e.name === 'any' ? 'nil' : basicZero(e.name);
+    }
+  } else if (e.type === 'SelectorExpr' && e.x.type === 'Ident') {
+    const pkgName = origin.scope?.lookupParent(e.x.name);
+    const pkg = pkgName?.imported
+      ? program.packageByImportPath(pkgName.imported)
+      : undefined;
+    obj = pkg?.scope?.lookup(e.sel.name);
+  }
+  if (obj?.kind !== 'type' || !obj.type || obj.pos < 0) return undefined;
+  return zeroOf(obj.type, text);
+}
+
+function parseAddition(
+  program: GoProgram,
+  origin: GoSourceFile,
+  packages: Packages,
+  change: Extract<ParameterChange, { action: 'add' }>
+): Addition {
+  checkIdentifier(change.name);
+  const type = change.type.trim();
+  if (type.startsWith('...')) {
+    throw new ToolError(
+      'invalid_argument',
+      `The new parameter '${change.name}' cannot be variadic`
+    );
+  }
+  let typeExpr: Expr;
+  try {
+    typeExpr = parseGoExpr(type);
+  } catch (error) {
+    throw new ToolError(
+      'invalid_argument',
+      `Invalid type '${type}' for parameter '${change.name}': ${error instanceof Error ? error.message : error}`
+    );
+  }
+  // Qualifiers in a type can only be package names, so those the file does
+  // not know are taken for standard library packages.
+  inspect(typeExpr, n => {
+    if (n.type !== 'SelectorExpr' || n.x.type !== 'Ident') return;
+    const name = n.x.name;
+    if (packageNamed(program, origin, packages, name)) return false;
+    if (!/^[a-z][a-z0-9]*$/.test(name)) {
+      throw new ToolError(
+        'invalid_argument',
+        `Cannot resolve the package '${name}' in type '${type}'; import it in ${displayPath(origin.filePath)} first`
+      );
+    }
+    packages.set(name, { path: name, name });
+    return false;
+  });
+
+  let value = change.defaultValue?.trim();
+  if (value) {
+    try {
+      parseGoExpr(value);
+    } catch (error) {
+      throw new ToolError(
+        'invalid_argument',
+        `Invalid default value '${value}' for parameter '${change.name}': ${error instanceof Error ? error.message : error}`
+      );
+    }
+  } else {
+    value = zeroValue(program, origin, typeExpr, type);
+    if (!value) {
+      throw new ToolError(
+        'invalid_argument',
+        `Cannot tell the zero value of ${type}; provide a default value for parameter '${change.name}'`
+      );
+    }
+  }
+  return { name: change.name, type, value };
+}
+
+// Checks that the body of target still compiles with the new parameters:
+// dropped parameters must be unused and added ones must neither clash
+// with nor shadow other names.
+function checkTarget(
+  info: GoInfo,
+  target: Target,
+  changes: ParameterChange[],
+  additions: Addition[],
+  deleted: (id: Ident) => boolean
+): void {
+  const { obj, decl, funcType } = target;
+  const params = parameterFields(funcType);
+  const dropped = new Set(
+    changes.flatMap(c => (c.action === 'drop' ? [params[c.index].name] : []))
+  );
+  dropped.delete('');
+  dropped.delete('_');
+  const results = (funcType.results?.list ?? []).flatMap(f => f.names);
+  const recv = decl?.recv?.list[0]?.names ?? [];
+  const taken = new Set([
+    ...params.map(p => p.name).filter(n => !dropped.has(n)),
+    ...[...results, ...recv].map(id => id.name),
+  ]);
+  for (const add of additions) {
+    if (taken.has(add.name)) {
+      throw new ToolError(
+        'name_conflict',
+        `'${add.name}' is already declared in '${obj.name}'`
+      );
+    }
+    taken.add(add.name);
+  }
+  if (!decl?.body) return;
+
+  const scope = info.scopes.get(decl);
+  for (const add of additions) {
+    const local = scope?.lookup(add.name);
+    if (local && !local.isParam) {
+      throw new ToolError(
+        'name_conflict',
+        `'${add.name}' is already declared in the body of '${obj.name}' at ${locationOf(target.file, local.pos)}`,
+        errorLocation(target.file, local.pos)
+      );
+    }
+  }
+  inspect(decl.body, n => {
+    if (n.type !== 'Ident') return;
+    const use = info.uses.get(n);
+    if (!use) return;
+    const param = scope?.lookup(use.name) === use;
+    if (use.isParam && param && dropped.has(use.name) && !deleted(n)) {
+      throw new ToolError(
+        'unsupported_construct',
+        `Cannot drop parameter '${use.name}' of '${obj.name}', which is used at ${locationOf(target.file, n.pos)}`,
+        errorLocation(target.file, n.pos)
+      );
+    }
+    const inside =
+      use.file === target.file && decl.pos <= use.pos && use.pos < decl.end;
+    if (!inside && additions.some(a => a.name === use.name)) {
+      throw new ToolError(
+        'name_conflict',
+        `The new parameter '${use.name}' would shadow the ${objectKindLabel(use)} '${use.name}' used at ${locationOf(target.file, n.pos)}`,
+        errorLocation(target.file, n.pos)
+      );
+    }
+  });
+}
+
+// Returns the edit replacing the contents of a parenthesized list. Lists
+// that had their items on separate lines keep that layout.
+function listEdit(
+  src: string,
+  lparen: number,
+  rparen: number,
+  items: string[]
+): TextEdit {
+  const inner = src.substring(lparen + 1, rparen);
+  const first = inner.search(/\S/);
+  const multiline = first >= 0 && inner.substring(0, first).includes('\n');
+  if (items.length > 0 && multiline) {
+    const indent = indentAt(src, lparen + 1 + first);
+    const text = items.map(item => `${indent}${item},\n`).join('');
+    return {
+      pos: lparen + 1,
+      end: rparen,
+      newText: `\n${text}${indentAt(src, rparen)}`,
+    };
+  }
+  return { pos: lparen + 1, end: rparen, newText: items.join(', ') };
+}
+
+// Formats the new parameters of target. Kept parameters that shared a
+// declaration stay grouped.
+function parameterItems(
+  program: GoProgram,
+  packages: Packages,
+  origin: GoSourceFile,
+  target: Target,
+  changes: ParameterChange[],
+  additions: Addition[],
+  qualifier: Qualifier
+): string[] {
+  const { file, funcType } = target;
+  const params = parameterFields(funcType);
+  // Parameters are either all named or all unnamed.
+  const blank = additions.length > 0 && params.every(p => !p.name);
+  const items: string[] = [];
+  let group: Field | undefined;
+  let added = 0;
+  for (const change of changes) {
+    if (change.action === 'drop') continue;
+    if (change.action === 'add') {
+      const add = additions[added++];
+      const type = transplant(
+        program,
+        packages,
+        add.type,
+        origin,
+        file,
+        file.scope,
+        qualifier
+      );
+      items.push(`${add.name} ${type}`);
+      group = undefined;
+      continue;
+    }
+    const { name, field } = params[change.index];
+    const type = file.src.substring(field.fieldType.pos, field.fieldType.end);
+    if (!name && !blank) {
+      items.push(type);
+    } else if (name && field === group) {
+      const prev = items.pop()!;
+      items.push(prev.replace(/ (?=[^ ]*$)/, `, ${name} `));
+    } else {
+      items.push(`${name || '_'} ${type}`);
+    }
+    group = name ? field : undefined;
+  }
+  return items;
+}
+
+function signatureText(target: Target, paramsText: string): string {
+  const { file, funcType, decl, obj } = target;
+  const results = funcType.results
+    ? ` ${file.src.substring(funcType.results.pos, funcType.results.end)}`
+    : '';
+  const head = decl
+    ? file.src.substring(decl.pos, funcType.params.pos)
+    : obj.name;
+  return `${head}(${paramsText})${results}`;
+}
+
+// Finds the call whose function is the identifier at [pos, end), and tells
+// whether it is a method expression, which takes the receiver first.
+function callOf(
+  info: GoInfo,
+  file: GoSourceFile,
+  pos: number,
+  end: number,
+  name: string
+): { call: CallExpr; methodExpr: boolean } {
+  const path = pathEnclosingInterval(file.ast, pos, end);
+  let i = path.length - 1;
+  let fun: Node = path[i];
+  let methodExpr = false;
+  const parent = () => path[i - 1];
+  const p = parent();
+  if (p?.type === 'SelectorExpr' && p.sel === fun) {
+    methodExpr = info.types.get(p.x)?.mode === 'type';
+    fun = path[--i];
+  }
+  for (let q = parent(); q; q = parent()) {
+    if ((q.type === 'IndexExpr' && q.x === fun) || q.type === 'ParenExpr') {
+      fun = path[--i];
+    } else {
+      break;
+    }
+  }
+  const call = parent();
+  if (call?.type !== 'CallExpr' || call.fun !== fun) {
+    throw new ToolError(
+      'unsupported_construct',
+      `Cannot change the signature of '${name}', which is used as a value at ${locationOf(file, pos)}`,
+      errorLocation(file, pos)
+    );
+  }
+  return { call, methodExpr };
+}
+
+function paramsEdit(target: Target, items: string[]): TextEdit {
+  const { params } = target.funcType;
+  return listEdit(target.file.src, params.pos, params.end - 1, items);
+}
+
+// A function or method, and the new list of its parameters.
+export interface SignatureChange {
+  obj: GoObject;
+  changes: ParameterChange[];
+}
+
+export interface SignatureSummary {
+  // The new signature as it appears in the declaration.
+  signature: string;
+  // Declarations changed along with the function because they declare or
+  // implement the same interface method, as path:line:column.
+  related: string[];
+  // Locations of the updated calls, as path:line:column.
+  callSites: string[];
+}
+
+export interface SignatureEdits extends SignatureSummary {
+  files: Map<GoSourceFile, FileEdits>;
+}
+
+// Returns the edits changing the parameters of the function or method obj
+// as changes lists, along with those of the interface methods it declares
+// or implements and of every call. Uses of dropped parameters are refused
+// unless deleted reports that the caller deletes them with edits of its
+// own.
+export async function signatureEdits(
+  program: GoProgram,
+  obj: GoObject,
+  changes: ParameterChange[],
+  task: TaskOptions = {},
+  deleted: (id: Ident) => boolean = () => false
+): Promise<SignatureEdits> {
+  const { summaries, files } = await batchSignatureEdits(
+    program,
+    [{ obj, changes }],
+    task,
+    deleted
+  );
+  return { ...summaries[0], files };
+}
+
+// Returns the edits of signatureEdits for several functions at once, in
+// one set of edits per file, so that calls nested in the arguments of
+// others are all updated. No two of the functions may declare or implement
+// the same interface method.
+export async function batchSignatureEdits(
+  program: GoProgram,
+  list: SignatureChange[],
+  task: TaskOptions = {},
+  deleted: (id: Ident) => boolean = () => false
+): Promise<{
+  summaries: SignatureSummary[];
+  files: Map<GoSourceFile, FileEdits>;
+}> {
+  for (const { obj, changes } of list) {
+    checkChanges(obj.name, obj.type as SignatureType, changes);
+  }
+
+  const info = program.check().info;
+  await step(task, 'Finding references');
+  const byFile = new Map<GoSourceFile, FileEdits>();
+  const editsFor = (f: GoSourceFile): FileEdits => {
+    let entry = byFile.get(f);
+    if (!entry) {
+      const missing: ImportRequest[] = [];
+      entry = { edits: [], missing, qualifier: fileQualifier(f, missing) };
+      byFile.set(f, entry);
+    }
+    return entry;
+  };
+  const rewrites = new Map<GoSourceFile, CallRewrite[]>();
+  const summaries = list.map(({ obj, changes }) =>
+    functionEdits(program, info, obj, changes, deleted, editsFor, rewrites)
+  );
+
+  // Inner calls are rendered first so that the arguments of outer ones
+  // include their changes.
+  for (const [f, calls] of rewrites) {
+    calls.sort((a, b) => a.end - a.pos - (b.end - b.pos));
+    const done: TextEdit[] = [];
+    for (const rewrite of calls) {
+      const textOf = (e: Expr) =>
+        applyTextEdits(
+          f.src.substring(e.pos, e.end),
+          done
+            .filter(d => e.pos <= d.pos && d.end <= e.end)
+            .map(d => ({ ...d, pos: d.pos - e.pos, end: d.end - e.pos }))
+        );
+      const newText = rewrite.render(textOf);
+      done.push({ pos: rewrite.pos, end: rewrite.end, newText });
+    }
+    const outermost = done.filter(
+      d => !done.some(o => o !== d && o.pos <= d.pos && d.end <= o.end)
+    );
+    editsFor(f).edits.push(...outermost);
+  }
+  return { summaries, files: byFile };
+}
+
+// Adds the edits of the declarations of obj and of the interface methods
+// that go with it to editsFor, and the rewrites of their calls to
+// rewrites.
+function functionEdits(
+  program: GoProgram,
+  info: GoInfo,
+  obj: GoObject,
+  changes: ParameterChange[],
+  deleted: (id: Ident) => boolean,
+  editsFor: (f: GoSourceFile) => FileEdits,
+  rewrites: Map<GoSourceFile, CallRewrite[]>
+): SignatureSummary {
+  const sig = obj.type as SignatureType;
+  const origin = obj.file!;
+  const targets = relatedMethods(program, obj).map(targetOf);
+  const packages: Packages = new Map();
+  const additions = changes.flatMap(c =>
+    c.action === 'add' ? [parseAddition(program, origin, packages, c)] : []
+  );
+  for (const target of targets) {
+    checkTarget(info, target, changes, additions, deleted);
+  }
+
+  let signature = '';
+  for (const target of targets) {
+    const entry = editsFor(target.file);
+    const items = parameterItems(
+      program,
+      packages,
+      origin,
+      target,
+      changes,
+      additions,
+      entry.qualifier
+    );
+    entry.edits.push(paramsEdit(target, items));
+    if (target.obj === obj) {
+      signature = signatureText(target, items.join(', '));
+    }
+  }
+
+  const count = sig.params.length;
+  const fixed = sig.variadic ? count - 1 : count;
+  const callSites: string[] = [];
+  for (const target of targets) {
+    for (const ref of findReferences(program, target.obj)) {
+      if (ref.isDeclaration) continue;
+      const f = ref.file;
+      const { call, methodExpr } = callOf(info, f, ref.pos, ref.end, obj.name);
+      const location = locationOf(f, call.pos);
+      const offset = methodExpr ? 1 : 0;
+      const args = call.args.slice(offset);
+      if (args.length === 1 && info.typeOf(args[0])?.kind === 'tuple') {
+        throw new ToolError(
+          'unsupported_construct',
+          `Cannot update the call at ${location}, which passes the results of another call`,
+          errorLocation(f, call.pos)
+        );
+      }
+      if (args.length < fixed) {
+        throw new ToolError(
+          'unsupported_construct',
+          `The call at ${location} has ${args.length} arguments, but '${obj.name}' takes ${fixed}`,
+          errorLocation(f, call.pos)
+        );
+      }
+      const argsOf = (index: number) =>
+        index < fixed ? [args[index]] : args.slice(fixed);
+
+      // Arguments with side effects must neither disappear nor change the
+      // order in which they are evaluated.
+      let last = -1;
+      for (const change of changes) {
+        if (change.action === 'add') continue;
+        for (const arg of argsOf(change.index)) {
+          if (isPure(info, arg)) continue;
+          if (change.action === 'drop') {
+            const text = f.src.substring(arg.pos, arg.end);
+            throw new ToolError(
+              'unsupported_construct',
+              `Cannot drop the argument '${text}' at ${location}, which may have side effects`,
+              errorLocation(f, call.pos)
+            );
+          }
+          const index = args.indexOf(arg);
+          if (index < last) {
+            throw new ToolError(
+              'unsupported_construct',
+              `Reordering the arguments at ${location} would change the order in which they are evaluated`,
+              errorLocation(f, call.pos)
+            );
+          }
+          last = index;
+        }
+      }
+
+      const path = pathEnclosingInterval(f.ast, call.pos, call.end);
+      const scope = scopeAt(info, path);
+      const { qualifier } = editsFor(f);
+      const values = additions.map(add =>
+        transplant(program, packages, add.value, origin, f, scope, qualifier)
+      );
+      callSites.push(location);
+      const list = rewrites.get(f) ?? rewrites.set(f, []).get(f)!;
+      const edit = (items: string[]) =>
+        listEdit(f.src, call.lparen, call.end - 1, items);
+      list.push({
+        pos: call.lparen + 1,
+        end: call.end - 1,
+        render: textOf => {
+          const items = call.args.slice(0, offset).map(textOf);
+          let added = 0;
+          for (const change of changes) {
+            if (change.action === 'drop') continue;
+            if (change.action === 'add') {
+              items.push(values[added++]);
+              continue;
+            }
+            const group = argsOf(change.index).map(textOf);
+            if (change.index === count - 1 && call.ellipsis !== undefined) {
+              group[group.length - 1] += '...';
+            }
+            items.push(...group);
+          }
+          return edit(items).newText;
+        },
+      });
+    }
+  }
+
+  return {
+    signature,
+    related: targets
+      .filter(t => t.obj !== obj)
+      .map(t => locationOf(t.file, t.obj.pos)),
+    callSites,
+  };
+}
+
+// Applies the edits of each file, adding the imports they need and removing
+// those the files no longer use.
+export function applySignatureEdits(
+  info: GoInfo,
+  files: Map<GoSourceFile, FileEdits>
+): FileChange[] {
+  const changed: FileChange[] = [];
+  for (const [f, entry] of files) {
+    let updated = applyTextEdits(f.src, [
+      ...addImportEdits(f, entry.missing),
+      ...entry.edits,
+    ]);
+    updated = pruneImports(f, info, updated);
+    changed.push({ filePath: f.filePath, original: f.src, updated });
+  }
+  return changed;
+}
@@ -0,0 +1,1029 @@
+// Type and object model for Go analysis, loosely modelled on go/types. It
+// is intentionally smaller than the real thing: packages outside the module
+// are not loaded, so their members are represented as opaque external
+// types.
+
+import type { File, Node } from './go-ast.js';
+
+export interface GoSourceFile {
+  filePath: string;
+  src: string;
+  ast: File;
+  lineStarts: number[];
+  pkg: GoPackage;
+  scope?: Scope;
+}
+
+export interface GoPackage {
+  importPath: string;
+  name: string;
+  dir: string;
+  files: GoSourceFile[];
+  // True for an external test package (package foo_test).
+  isXTest: boolean;
+  scope?: Scope;
+}
+
+export type ObjectKind =
+  | 'pkgname'
+  | 'const'
+  | 'type'
+  | 'var'
+  | 'func'
+  | 'label'
+  | 'builtin'
+  | 'nil';
+
+export interface GoObject {
+  kind: ObjectKind;
+  name: string;
+  // String index of the declaring identifier, or -1 for predeclared and
+  // external objects.
+  pos: number;
+  file?: GoSourceFile;
+  pkg?: GoPackage;
+  parent?: Scope;
+  decl?: Node;
+  type?: Type;
+
+  // Variables
+  isField?: boolean;
+  embedded?: boolean;
+  isParam?: boolean;
+  // Functions: the named type a method is declared on, or the interface
+  // type an interface method belongs to.
+  recv?: GoObject;
+  pointerRecv?: boolean;
+  // Type names
+  methods?: GoObject[];
+  underlying?: Type;
+  isAlias?: boolean;
+  typeParams?: GoObject[];
+  constraint?: Type;
+  // Package names
+  imported?: string;
+  // Set for members of packages that are not part of the loaded module.
+  externalPath?: string;
+  // Constants
+  iota?: number;
+}
+
+export class Scope {
+  readonly names = new Map<string, GoObject>();
+  readonly children: Scope[] = [];
+  readonly parent?: Scope;
+  readonly kind: 'universe' | 'package' | 'file' | 'func' | 'block';
+  readonly pos: number;
+  readonly end: number;
+
+  constructor(
+    parent: Scope | undefined,
+    kind: Scope['kind'],
+    pos = -1,
+    end = -1
+  ) {
+    this.parent = parent;
+    this.kind = kind;
+    this.pos = pos;
+    this.end = end;
+    parent?.children.push(this);
+  }
+
+  lookup(name: string): GoObject | undefined {
+    return this.names.get(name);
+  }
+
+  lookupParent(name: string): GoObject | undefined {
+    for (let s: Scope | undefined = this; s; s = s.parent) {
+      const obj = s.names.get(name);
+      if (obj) return obj;
+    }
+    return undefined;
+  }
+
+  insert(obj: GoObject): GoObject | undefined {
+    const existing = this.names.get(obj.name);
+    if (existing) return existing;
+    this.names.set(obj.name, obj);
+    obj.parent = this;
+    return undefined;
+  }
+}
+
+// ----------------------------------------------------------------------------
+// Types
+
+export interface BasicType {
+  kind: 'basic';
+  name: string;
+}
+
+export interface NamedType {
+  kind: 'named';
+  obj: GoObject;
+  typeArgs?: Type[];
+}
+
+export interface PointerType {
+  kind: 'pointer';
+  elem: Type;
+}
+
+export interface SliceType {
+  kind: 'slice';
+  elem: Type;
+}
+
+export interface ArrayTypeT {
+  kind: 'array';
+  len: number | undefined;
+  elem: Type;
+}
+
+export interface MapTypeT {
+  kind: 'map';
+  key: Type;
+  elem: Type;
+}
+
+export interface ChanTypeT {
+  kind: 'chan';
+  dir: 'both' | 'send' | 'recv';
+  elem: Type;
+}
+
+export interface SignatureType {
+  kind: 'signature';
+  typeParams?: GoObject[];
+  params: GoObject[];
+  results: GoObject[];
+  variadic: boolean;
+  recv?: GoObject;
+}
+
+export interface StructTypeT {
+  kind: 'struct';
+  fields: GoObject[];
+  tags: (string | undefined)[];
+}
+
+export interface InterfaceTypeT {
+  kind: 'interface';
+  methods: GoObject[];
+  embeddeds: Type[];
+  // Set when the interface contains type terms and can only be used as a
+  // constraint.
+  isConstraint?: boolean;
+  terms?: Type[];
+}
+
+export interface TupleType {
+  kind: 'tuple';
+  types: Type[];
+}
+
+export interface TypeParamType {
+  kind: 'typeparam';
+  obj: GoObject;
+}
+
+export interface InvalidType {
+  kind: 'invalid';
+}
+
+export type Type =
+  | BasicType
+  | NamedType
+  | PointerType
+  | SliceType
+  | ArrayTypeT
+  | MapTypeT
+  | ChanTypeT
+  | SignatureType
+  | StructTypeT
+  | InterfaceTypeT
+  | TupleType
+  | TypeParamType
+  | InvalidType;
+
+export const INVALID: InvalidType = { kind: 'invalid' };
+
+const basicTypes = new Map<string, BasicType>();
+
+export function basic(name: string): BasicType {
+  let t = basicTypes.get(name);
+  if (!t) {
+    t = { kind: 'basic', name };
+    basicTypes.set(name, t);
+  }
+  return t;
+}
+
+export const UNTYPED_INT = basic('untyped int');
+export const UNTYPED_FLOAT = basic('untyped float');
+export const UNTYPED_RUNE = basic('untyped rune');
+export const UNTYPED_STRING = basic('untyped string');
+export const UNTYPED_BOOL = basic('untyped bool');
+export const UNTYPED_NIL = basic('untyped nil');
+export const UNTYPED_COMPLEX = basic('untyped complex');
+
+export function isUntyped(t: Type): boolean {
+  return t.kind === 'basic' && t.name.startsWith('untyped ');
+}
+
+// Returns the default type of an untyped constant type.
+export function defaultType(t: Type): Type {
+  if (t.kind !== 'basic') return t;
+  switch (t.name) {
+    case 'untyped int':
+      return basic('int');
+    case 'untyped float':
+      return basic('float64');
+    case 'untyped rune':
+      return basic('rune');
+    case 'untyped string':
+      return basic('string');
+    case 'untyped bool':
+      return basic('bool');
+    case 'untyped complex':
+      return basic('complex128');
+  }
+  return t;
+}
+
+// ----------------------------------------------------------------------------
+// Universe
+
+// The empty interface denoted by the predeclared alias any.
+export const ANY: InterfaceTypeT = { kind: 'interface', methods: [], embeddeds: [] };
+
+export const universe = new Scope(undefined, 'universe');
+
+const BASIC_NAMES = [
+  'bool',
+  'complex64',
+  'complex128',
+  'float32',
+  'float64',
+  'int',
+  'int8',
+  'int16',
+  'int32',
+  'int64',
+  'string',
+  'uint',
+  'uint8',
+  'uint16',
+  'uint32',
+  'uint64',
+  'uintptr',
+];
+
+const BUILTIN_FUNCS = [
+  'append',
+  'cap',
+  'clear',
+  'close',
+  'complex',
+  'copy',
+  'delete',
+  'imag',
+  'len',
+  'make',
+  'max',
+  'min',
+  'new',
+  'panic',
+  'print',
+  'println',
+  'real',
+  'recover',
+];
+
+function defineUniverse(): void {
+  for (const name of BASIC_NAMES) {
+    universe.insert({ kind: 'type', name, pos: -1, type: basic(name) });
+  }
+  // byte and rune keep their own names for printing but are identical to
+  // uint8 and int32.
+  universe.insert({ kind: 'type', name: 'byte', pos: -1, type: basic('byte'), isAlias: true });
+  universe.insert({ kind: 'type', name: 'rune', pos: -1, type: basic('rune'), isAlias: true });
+
+  const errorObj: GoObject = { kind: 'type', name: 'error', pos: -1 };
+  const errorMethod: GoObject = {
+    kind: 'func',
+    name: 'Error',
+    pos: -1,
+    type: {
+      kind: 'signature',
+      params: [],
+      results: [{ kind: 'var', name: '', pos: -1, type: basic('string') }],
+      variadic: false,
+    },
+  };
+  const errorIface: InterfaceTypeT = { kind: 'interface', methods: [errorMethod], embeddeds: [] };
+  errorMethod.recv = errorObj;
+  errorObj.type = { kind: 'named', obj: errorObj };
+  errorObj.underlying = errorIface;
+  universe.insert(errorObj);
+
+  universe.insert({ kind: 'type', name: 'any', pos: -1, type: ANY, isAlias: true });
+
+  const comparableObj: GoObject = { kind: 'type', name: 'comparable', pos: -1 };
+  comparableObj.type = { kind: 'named', obj: comparableObj };
+  comparableObj.underlying = { kind: 'interface', methods: [], embeddeds: [], isConstraint: true };
+  universe.insert(comparableObj);
+
+  universe.insert({ kind: 'const', name: 'true', pos: -1, type: UNTYPED_BOOL });
+  universe.insert({ kind: 'const', name: 'false', pos: -1, type: UNTYPED_BOOL });
+  universe.insert({ kind: 'const', name: 'iota', pos: -1, type: UNTYPED_INT });
+  universe.insert({ kind: 'nil', name: 'nil', pos: -1, type: UNTYPED_NIL });
+  for (const name of BUILTIN_FUNCS) {
+    universe.insert({ kind: 'builtin', name, pos: -1, type: INVALID });
+  }
+}
+
+defineUniverse();
+
+export function universeType(name: string): Type {
+  return universe.lookup(name)!.type!;
+}
+
+export function errorType(): Type {
+  return universeType('error');
+}
+
+// ----------------------------------------------------------------------------
+// Type operations
+
+// Returns the underlying type of t. Named types must have been resolved by
+// the checker before calling this.
+export function under(t: Type): Type {
+  for (let i = 0; i < 100 && t.kind === 'named'; i++) {
+    const u: Type | undefined = t.obj.underlying;
+    if (!u) return INVALID;
+    if (t.typeArgs && t.obj.typeParams && u.kind !== 'named') {
+      return subst(u, substMap(t.obj.typeParams, t.typeArgs));
+    }
+    t = u;
+  }
+  if (t.kind === 'typeparam') {
+    return t.obj.constraint ?? INVALID;
+  }
+  return t;
+}
+
+export function deref(t: Type): { type: Type; pointer: boolean } {
+  if (t.kind === 'pointer') return { type: t.elem, pointer: true };
+  return { type: t, pointer: false };
+}
+
+export function isInterface(t: Type): boolean {
+  return t.kind !== 'typeparam' && under(t).kind === 'interface';
+}
+
+export function isNamed(t: Type): t is NamedType {
+  return t.kind === 'named';
+}
+
+export function isExternal(t: Type): boolean {
+  return t.kind === 'named' && t.obj.externalPath !== undefined;
+}
+
+export function substMap(
+  params: GoObject[],
+  args: Type[]
+): Map<GoObject, Type> {
+  const m = new Map<GoObject, Type>();
+  params.forEach((p, i) => {
+    if (args[i]) m.set(p, args[i]);
+  });
+  return m;
+}
+
+// Substitutes type parameters in t according to m.
+export function subst(t: Type, m: Map<GoObject, Type>): Type {
+  if (m.size === 0) return t;
+  switch (t.kind) {
+    case 'typeparam':
+      return m.get(t.obj) ?? t;
+    case 'pointer':
+      return { kind: 'pointer', elem: subst(t.elem, m) };
+    case 'slice':
+      return { kind: 'slice', elem: subst(t.elem, m) };
+    case 'array':
+      return { kind: 'array', len: t.len, elem: subst(t.elem, m) };
+    case 'map':
+      return { kind: 'map', key: subst(t.key, m), elem: subst(t.elem, m) };
+    case 'chan':
+      return { kind: 'chan', dir: t.dir, elem: subst(t.elem, m) };
+    case 'tuple':
+      return { kind: 'tuple', types: t.types.map(x => subst(x, m)) };
+    case 'named':
+      if (!t.typeArgs) return t;
+      return { kind: 'named', obj: t.obj, typeArgs: t.typeArgs.map(x => subst(x, m)) };
+    case 'signature': {
+      const sv = (v: GoObject): GoObject => ({ ...v, type: v.type ? subst(v.type, m) : v.type });
+      return {
+        kind: 'signature',
+        params: t.params.map(sv),
+        results: t.results.map(sv),
+        variadic: t.variadic,
+        recv: t.recv,
+      };
+    }
+    case 'struct':
+      return {
+        kind: 'struct',
+        fields: t.fields.map(f => ({ ...f, type: f.type ? subst(f.type, m) : f.type })),
+        tags: t.tags,
+      };
+    case 'interface':
+      return {
+        kind: 'interface',
+        methods: t.methods.map(f => ({ ...f, type: f.type ? subst(f.type, m) : f.type })),
+        embeddeds: t.embeddeds.map(e => subst(e, m)),
+        isConstraint: t.isConstraint,
+        terms: t.terms?.map(e => subst(e, m)),
+      };
+  }
+  return t;
+}
+
+// Reports whether t or any type it is composed of satisfies pred. Named
+// types are not expanded, but their type arguments are visited.
+export function typeContains(t: Type, pred: (t: Type) => boolean): boolean {
+  if (pred(t)) return true;
+  const anyOf = (ts: Type[]) => ts.some(x => typeContains(x, pred));
+  const vars = (vs: GoObject[]) => anyOf(vs.map(v => v.type ?? INVALID));
+  switch (t.kind) {
+    case 'pointer':
+    case 'slice':
+    case 'array':
+    case 'chan':
+      return typeContains(t.elem, pred);
+    case 'map':
+      return anyOf([t.key, t.elem]);
+    case 'tuple':
+      return anyOf(t.types);
+    case 'named':
+      return anyOf(t.typeArgs ?? []);
+    case 'signature':
+      return vars(t.params) || vars(t.results);
+    case 'struct':
+      return vars(t.fields);
+    case 'interface':
+      return vars(t.methods) || anyOf(t.embeddeds) || anyOf(t.terms ?? []);
+  }
+  return false;
+}
+
+// Sizes and alignments of types as the gc compiler lays them out for an
+// architecture with words of wordSize bytes, like types.SizesFor("gc").
+// They are undefined for types whose layout is unknown: type parameters
+// and types of packages outside the module.
+export class GoSizes {
+  readonly wordSize: number;
+
+  constructor(wordSize: number) {
+    this.wordSize = wordSize;
+  }
+
+  alignof(t: Type): number | undefined {
+    const u = this.layoutOf(t);
+    if (!u) return undefined;
+    switch (u.kind) {
+      case 'array':
+        return this.alignof(u.elem);
+      case 'struct': {
+        let max = 1;
+        for (const f of u.fields) {
+          const a = this.alignof(f.type ?? INVALID);
+          if (a === undefined) return undefined;
+          max = Math.max(max, a);
+        }
+        return max;
+      }
+      case 'slice':
+      case 'interface':
+        return this.wordSize;
+      case 'basic':
+        if (canonicalBasic(u.name) === 'string') return this.wordSize;
+    }
+    let a = this.sizeof(u);
+    if (a === undefined) return undefined;
+    if (a < 1) return 1;
+    if (u.kind === 'basic' && u.name.startsWith('complex')) a /= 2;
+    return Math.min(a, this.wordSize);
+  }
+
+  sizeof(t: Type): number | undefined {
+    const u = this.layoutOf(t);
+    if (!u) return undefined;
+    const w = this.wordSize;
+    switch (u.kind) {
+      case 'basic': {
+        const name = canonicalBasic(u.name);
+        if (name === 'string') return 2 * w;
+        return BASIC_SIZES[name] ?? w;
+      }
+      case 'array': {
+        const n = u.len;
+        const size = this.sizeof(u.elem);
+        const align = this.alignof(u.elem);
+        if (n === undefined || size === undefined || align === undefined) return undefined;
+        return n === 0 ? 0 : alignUp(size, align) * (n - 1) + size;
+      }
+      case 'slice':
+        return 3 * w;
+      case 'interface':
+        return 2 * w;
+      case 'struct': {
+        const offsets = this.offsetsof(u.fields);
+        const align = this.alignof(u);
+        if (!offsets || align === undefined) return undefined;
+        const n = u.fields.length;
+        if (n === 0) return 0;
+        const last = this.sizeof(u.fields[n - 1].type ?? INVALID)!;
+        let size = offsets[n - 1] + last;
+        // A final field of size zero gets a byte so that its address does
+        // not point past the struct.
+        if (last === 0 && size > 0) size++;
+        return alignUp(size, align);
+      }
+    }
+    return w;
+  }
+
+  // Returns the offsets of fields laid out in order.
+  offsetsof(fields: GoObject[]): number[] | undefined {
+    const offsets: number[] = [];
+    let offset = 0;
+    for (const f of fields) {
+      const size = this.sizeof(f.type ?? INVALID);
+      const align = this.alignof(f.type ?? INVALID);
+      if (size === undefined || align === undefined) return undefined;
+      offset = alignUp(offset, align);
+      offsets.push(offset);
+      offset += size;
+    }
+    return offsets;
+  }
+
+  // Returns the type whose layout t has, or undefined if it is unknown.
+  // Of the external types, only a few common ones of the standard library
+  // are known.
+  private layoutOf(t: Type): Type | undefined {
+    if (t.kind === 'named' && t.obj.externalPath !== undefined) {
+      return EXTERNAL_LAYOUTS[`${t.obj.externalPath}.${t.obj.name}`]?.();
+    }
+    if (t.kind === 'typeparam') return undefined;
+    const u = under(t);
+    return u.kind === 'invalid' || u.kind === 'tuple' ? undefined : u;
+  }
+}
+
+const layoutField = (t: Type): GoObject => ({ kind: 'var', name: '', pos: -1, type: t, isField: true });
+const layoutStruct = (...ts: Type[]): StructTypeT => ({ kind: 'struct', fields: ts.map(layoutField), tags: [] });
+const interfaceLayout = (): Type => ANY;
+
+// Layouts of standard library types as of the Go releases this tool knows.
+const EXTERNAL_LAYOUTS: Record<string, () => Type> = {
+  'unsafe.Pointer': () => basic('uintptr'),
+  'time.Duration': () => basic('int64'),
+  'time.Month': () => basic('int'),
+  'time.Weekday': () => basic('int'),
+  'time.Time': () => layoutStruct(basic('uint64'), basic('int64'), basic('uintptr')),
+  'sync.Mutex': () => layoutStruct(basic('int32'), basic('uint32')),
+  'sync.RWMutex': () => layoutStruct(basic('int32'), basic('uint32'), basic('uint32'), basic('uint32'), basic('int32'), basic('int32')),
+  'sync.Once': () => layoutStruct(basic('uint32'), basic('int32'), basic('uint32')),
+  'context.Context': interfaceLayout,
+  'fmt.Stringer': interfaceLayout,
+  'io.Closer': interfaceLayout,
+  'io.ReadCloser': interfaceLayout,
+  'io.ReadWriter': interfaceLayout,
+  'io.Reader': interfaceLayout,
+  'io.WriteCloser': interfaceLayout,
+  'io.Writer': interfaceLayout,
+  'net/http.Handler': interfaceLayout,
+};
+
+const BASIC_SIZES: Record<string, number> = {
+  bool: 1,
+  int8: 1,
+  uint8: 1,
+  int16: 2,
+  uint16: 2,
+  int32: 4,
+  uint32: 4,
+  float32: 4,
+  int64: 8,
+  uint64: 8,
+  float64: 8,
+  complex64: 8,
+  complex128: 16,
+};
+
+function alignUp(x: number, a: number): number {
+  return Math.ceil(x / a) * a;
+}
+
+// The original declaration of a possibly substituted field or method.
+// Substitution copies objects, so identity is established via position.
+export function sameObject(a: GoObject | undefined, b: GoObject | undefined): boolean {
+  if (!a || !b) return false;
+  if (a === b) return true;
+  if (a.pos < 0 || b.pos < 0) {
+    return (
+      a.pos === b.pos &&
+      a.name === b.name &&
+      a.kind === b.kind &&
+      a.externalPath !== undefined &&
+      a.externalPath === b.externalPath
+    );
+  }
+  return a.pos === b.pos && a.file === b.file && a.name === b.name;
+}
+
+function canonicalBasic(name: string): string {
+  if (name === 'byte') return 'uint8';
+  if (name === 'rune') return 'int32';
+  return name;
+}
+
+export function identical(a: Type, b: Type): boolean {
+  if (a === b) return true;
+  if (a.kind !== b.kind) return false;
+  switch (a.kind) {
+    case 'basic':
+      return canonicalBasic(a.name) === canonicalBasic((b as BasicType).name);
+    case 'named': {
+      const nb = b as NamedType;
+      if (!sameObject(a.obj, nb.obj)) return false;
+      const aa = a.typeArgs ?? [];
+      const ba = nb.typeArgs ?? [];
+      return aa.length === ba.length && aa.every((t, i) => identical(t, ba[i]));
+    }
+    case 'pointer':
+    case 'slice':
+      return identical(a.elem, (b as PointerType | SliceType).elem);
+    case 'array':
+      return a.len === (b as ArrayTypeT).len && identical(a.elem, (b as ArrayTypeT).elem);
+    case 'map':
+      return identical(a.key, (b as MapTypeT).key) && identical(a.elem, (b as MapTypeT).elem);
+    case 'chan':
+      return a.dir === (b as ChanTypeT).dir && identical(a.elem, (b as ChanTypeT).elem);
+    case 'tuple': {
+      const tb = b as TupleType;
+      return a.types.length === tb.types.length && a.types.every((t, i) => identical(t, tb.types[i]));
+    }
+    case 'signature': {
+      const sb = b as SignatureType;
+      return (
+        a.variadic === sb.variadic &&
+        a.params.length === sb.params.length &&
+        a.results.length === sb.results.length &&
+        a.params.every((p, i) => identical(p.type ?? INVALID, sb.params[i].type ?? INVALID)) &&
+        a.results.every((p, i) => identical(p.type ?? INVALID, sb.results[i].type ?? INVALID))
+      );
+    }
+    case 'struct': {
+      const sb = b as StructTypeT;
+      return (
+        a.fields.length === sb.fields.length &&
+        a.fields.every(
+          (f, i) =>
+            f.name === sb.fields[i].name &&
+            !!f.embedded === !!sb.fields[i].embedded &&
+            identical(f.type ?? INVALID, sb.fields[i].type ?? INVALID)
+        )
+      );
+    }
+    case 'interface': {
+      const ma = interfaceMethods(a);
+      const mb = interfaceMethods(b as InterfaceTypeT);
+      return (
+        ma.length === mb.length &&
+        ma.every(m => {
+          const other = mb.find(x => x.name === m.name);
+          return other !== undefined && identical(m.type ?? INVALID, other.type ?? INVALID);
+        })
+      );
+    }
+    case 'typeparam':
+      return sameObject(a.obj, (b as TypeParamType).obj);
+    case 'invalid':
+      return false;
+  }
+}
+
+// Returns the full method set of an interface, including methods of
+// embedded interfaces.
+export function interfaceMethods(t: InterfaceTypeT, seen = new Set<Type>()): GoObject[] {
+  if (seen.has(t)) return [];
+  seen.add(t);
+  const out = [...t.methods];
+  for (const e of t.embeddeds) {
+    const u = under(e);
+    if (u.kind === 'interface') {
+      for (const m of interfaceMethods(u, seen)) {
+        if (!out.some(x => x.name === m.name)) out.push(m);
+      }
+    }
+  }
+  return out;
+}
+
+export interface Selection {
+  obj: GoObject;
+  kind: 'field' | 'method';
+  // Embedded fields traversed to reach obj.
+  path: GoObject[];
+  // True if a pointer indirection was needed along the path.
+  indirect: boolean;
+  // Type of the selected field or method (after substitution).
+  type: Type;
+  // The named type (or its pointer) on which a method is declared.
+  recvType?: Type;
+}
+
+// Looks up a field or method by name in t, following embedded fields the
+// way the Go spec describes. Returns undefined if not found or ambiguous.
+export function lookupFieldOrMethod(t: Type, name: string): Selection | undefined {
+  const start = deref(t);
+  interface Entry {
+    type: Type;
+    path: GoObject[];
+    indirect: boolean;
+  }
+  let current: Entry[] = [{ type: start.type, path: [], indirect: start.pointer }];
+  const seen = new Set<GoObject>();
+
+  for (let depth = 0; current.length > 0 && depth < 16; depth++) {
+    const found: Selection[] = [];
+    const next: Entry[] = [];
+    for (const e of current) {
+      let typ = e.type;
+      if (typ.kind === 'named') {
+        if (seen.has(typ.obj)) continue;
+        seen.add(typ.obj);
+        const m = typ.obj.methods?.find(x => x.name === name);
+        if (m) {
+          const sig = m.type ?? INVALID;
+          const mapped =
+            typ.typeArgs && typ.obj.typeParams
+              ? subst(sig, substMap(typ.obj.typeParams, typ.typeArgs))
+              : sig;
+          found.push({
+            obj: m,
+            kind: 'method',
+            path: e.path,
+            indirect: e.indirect,
+            type: mapped,
+            recvType: typ,
+          });
+          continue;
+        }
+        typ = under(typ);
+      } else if (typ.kind === 'typeparam') {
+        typ = under(typ);
+      }
+
+      if (typ.kind === 'struct') {
+        for (const f of typ.fields) {
+          if (f.name === name) {
+            found.push({ obj: f, kind: 'field', path: e.path, indirect: e.indirect, type: f.type ?? INVALID });
+          }
+          if (f.embedded && f.type) {
+            const d = deref(f.type);
+            next.push({ type: d.type, path: [...e.path, f], indirect: e.indirect || d.pointer });
+          }
+        }
+      } else if (typ.kind === 'interface') {
+        const m = interfaceMethods(typ).find(x => x.name === name);
+        if (m) {
+          found.push({ obj: m, kind: 'method', path: e.path, indirect: e.indirect, type: m.type ?? INVALID, recvType: e.type });
+        }
+      }
+    }
+    if (found.length === 1) return found[0];
+    if (found.length > 1) return undefined;
+    current = next;
+  }
+  return undefined;
+}
+
+export interface MethodSetEntry {
+  obj: GoObject;
+  type: Type;
+  // Whether the method is only in the method set of the pointer type.
+  pointerOnly: boolean;
+  path: GoObject[];
+}
+
+// Computes the method set of the pointer type *T for a named or struct
+// type T, marking methods that are not in the method set of T itself.
+export function methodSet(t: Type): MethodSetEntry[] {
+  const start = deref(t);
+  const u0 = under(start.type);
+  if (u0.kind === 'interface') {
+    return interfaceMethods(u0).map(m => ({ obj: m, type: m.type ?? INVALID, pointerOnly: false, path: [] }));
+  }
+
+  const out: MethodSetEntry[] = [];
+  const names = new Set<string>();
+  interface Entry {
+    type: Type;
+    path: GoObject[];
+    viaPointer: boolean;
+  }
+  let current: Entry[] = [{ type: start.type, path: [], viaPointer: false }];
+  const seen = new Set<GoObject>();
+  const shadowed = new Set<string>();
+
+  for (let depth = 0; current.length > 0 && depth < 16; depth++) {
+    const level: MethodSetEntry[] = [];
+    const levelFields = new Set<string>();
+    const next: Entry[] = [];
+    for (const e of current) {
+      let typ = e.type;
+      if (typ.kind === 'named') {
+        if (seen.has(typ.obj)) continue;
+        seen.add(typ.obj);
+        for (const m of typ.obj.methods ?? []) {
+          const sig = m.type ?? INVALID;
+          const mapped =
+            typ.typeArgs && typ.obj.typeParams
+              ? subst(sig, substMap(typ.obj.typeParams, typ.typeArgs))
+              : sig;
+          level.push({ obj: m, type: mapped, pointerOnly: !!m.pointerRecv && !e.viaPointer, path: e.path });
+        }
+        typ = under(typ);
+      }
+      if (typ.kind === 'struct') {
+        for (const f of typ.fields) {
+          levelFields.add(f.name);
+          if (f.embedded && f.type) {
+            const d = deref(f.type);
+            next.push({ type: d.type, path: [...e.path, f], viaPointer: e.viaPointer || d.pointer });
+          }
+        }
+      } else if (typ.kind === 'interface') {
+        for (const m of interfaceMethods(typ)) {
+          level.push({ obj: m, type: m.type ?? INVALID, pointerOnly: false, path: e.path });
+        }
+      }
+    }
+    const counts = new Map<string, number>();
+    for (const m of level) counts.set(m.obj.name, (counts.get(m.obj.name) ?? 0) + 1);
+    for (const m of level) {
+      if (names.has(m.obj.name) || shadowed.has(m.obj.name)) continue;
+      if ((counts.get(m.obj.name) ?? 0) > 1) {
+        shadowed.add(m.obj.name);
+        continue;
+      }
+      names.add(m.obj.name);
+      out.push(m);
+    }
+    for (const f of levelFields) {
+      if (!names.has(f)) shadowed.add(f);
+    }
+    current = next;
+  }
+  return out;
+}
+
+export interface ImplementsResult {
+  ok: boolean;
+  // Methods that are missing or have the wrong signature.
+  missing: GoObject[];
+  // Methods that exist only on the pointer receiver.
+  pointerOnly: GoObject[];
+}
+
+// Reports whether type t (or *t) implements interface iface.
+export function implementsInterface(t: Type, iface: Type, pointer: boolean): ImplementsResult {
+  const u = under(iface);
+  const result: ImplementsResult = { ok: true, missing: [], pointerOnly: [] };
+  if (u.kind !== 'interface') return { ok: false, missing: [], pointerOnly: [] };
+  const ms = methodSet(t);
+  for (const m of interfaceMethods(u)) {
+    const have = ms.find(x => x.obj.name === m.name);
+    if (!have || !identical(have.type, m.type ?? INVALID)) {
+      result.ok = false;
+      result.missing.push(m);
+    } else if (have.pointerOnly && !pointer && t.kind !== 'pointer') {
+      result.ok = false;
+      result.pointerOnly.push(m);
+    }
+  }
+  return result;
+}
+
+export type Qualifier = (pkg: { path: string; name: string }) => string;
+
+function objPackagePath(obj: GoObject): string | undefined {
+  return obj.externalPath ?? obj.pkg?.importPath;
+}
+
+function objPackageName(obj: GoObject): string {
+  if (obj.pkg) return obj.pkg.name;
+  const path = obj.externalPath ?? '';
+  return defaultPackageName(path);
+}
+
+// Returns the conventional package name for an import path, ignoring
+// major-version suffixes such as /v2.
+export function defaultPackageName(path: string): string {
+  const parts = path.split('/');
+  let last = parts[parts.length - 1];
+  if (/^v[0-9]+$/.test(last) && parts.length > 1) {
+    last = parts[parts.length - 2];
+  }
+  last = last.replace(/^go-/, '').replace(/[.-].*$/, '');
+  return last;
+}
+
+// Formats t as Go source. The qualifier decides how types from other
+// packages are prefixed; returning an empty string omits the prefix.
+export function typeString(t: Type, qualifier?: Qualifier): string {
+  const str = (x: Type): string => typeString(x, qualifier);
+  const tuple = (vars: GoObject[], variadic: boolean): string =>
+    vars
+      .map((v, i) => {
+        let ts = str(v.type ?? INVALID);
+        if (variadic && i === vars.length - 1 && v.type?.kind === 'slice') {
+          ts = '...' + str(v.type.elem);
+        }
+        return v.name ? `${v.name} ${ts}` : ts;
+      })
+      .join(', ');
+
+  switch (t.kind) {
+    case 'basic':
+      return t.name;
+    case 'named': {
+      const path = objPackagePath(t.obj);
+      let prefix = '';
+      if (path !== undefined) {
+        const q = qualifier ? qualifier({ path, name: objPackageName(t.obj) }) : objPackageName(t.obj);
+        prefix = q ? `${q}.` : '';
+      }
+      const args = t.typeArgs && t.typeArgs.length > 0 ? `[${t.typeArgs.map(str).join(', ')}]` : '';
+      return `${prefix}${t.obj.name}${args}`;
+    }
+    case 'pointer':
+      return `*${str(t.elem)}`;
+    case 'slice':
+      return `[]${str(t.elem)}`;
+    case 'array':
+      return `[${t.len ?? '...'}]${str(t.elem)}`;
+    case 'map':
+      return `map[${str(t.key)}]${str(t.elem)}`;
+    case 'chan':
+      if (t.dir === 'send') return `chan<- ${str(t.elem)}`;
+      if (t.dir === 'recv') return `<-chan ${str(t.elem)}`;
+      return `chan ${str(t.elem)}`;
+    case 'signature': {
+      const params = tuple(t.params, t.variadic);
+      let results = '';
+      if (t.results.length === 1 && !t.results[0].name) {
+        results = ' ' + str(t.results[0].type ?? INVALID);
+      } else if (t.results.length > 0) {
+        results = ` (${tuple(t.results, false)})`;
+      }
+      return `func(${params})${results}`;
+    }
+    case 'struct': {
+      if (t.fields.length === 0) return 'struct{}';
+      const fields = t.fields.map((f, i) => {
+        const ts = str(f.type ?? INVALID);
+        const tag = t.tags[i] ? ` ${t.tags[i]}` : '';
+        return (f.embedded ? ts : `${f.name} ${ts}`) + tag;
+      });
+      return `struct{ ${fields.join('; ')} }`;
+    }
+    case 'interface': {
+      if (t === ANY) return 'any';
+      const parts = [
+        ...t.embeddeds.map(str),
+        ...t.methods.map(m => `${m.name}${str(m.type ?? INVALID).replace(/^func/, '')}`),
+      ];
+      if (t.terms) parts.push(t.terms.map(str).join(' | '));
+      if (parts.length === 0) return 'interface{}';
+      return `interface{ ${parts.join('; ')} }`;
+    }
+    case 'tuple':
+      return `(${t.types.map(str).join(', ')})`;
+    case 'typeparam':
+      return t.obj.name;
+    case 'invalid':
+      return 'invalid type';
+  }
+}
+
+// Formats a signature without the leading "func", as used in method
+// declarations and interface method specs.
+export function signatureString(t: SignatureType, qualifier?: Qualifier): string {
+  return typeString({ ...t, recv: undefined }, qualifier).replace(/^func/, '');
+}
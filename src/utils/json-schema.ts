@@ -0,0 +1,57 @@
+// JSON Schemas of the zod schemas that declare the parameters of the
+// tools, for clients reading them from the capabilities tool. Only the
+// kinds of schema the tools use are supported.
+
+import { z } from 'zod';
+import type { ZodRawShape, ZodTypeAny } from 'zod';
+
+export type JsonSchema = { [key: string]: unknown };
+
+// Returns the JSON Schema of schema, with its description.
+export function jsonSchemaOf(schema: ZodTypeAny): JsonSchema {
+  const result = typeSchema(schema);
+  return schema.description
+    ? { ...result, description: schema.description }
+    : result;
+}
+
+// Returns the JSON Schema of an object with the properties of shape, those
+// that are not optional being required.
+export function objectSchemaOf(shape: ZodRawShape): JsonSchema {
+  const properties: { [name: string]: JsonSchema } = {};
+  const required: string[] = [];
+  for (const [name, schema] of Object.entries(shape)) {
+    properties[name] = jsonSchemaOf(schema);
+    if (!schema.isOptional()) required.push(name);
+  }
+  return required.length > 0
+    ? { type: 'object', properties, required }
+    : { type: 'object', properties };
+}
+
+function typeSchema(schema: ZodTypeAny): JsonSchema {
+  if (schema instanceof z.ZodOptional) {
+    return jsonSchemaOf(schema.unwrap());
+  }
+  if (schema instanceof z.ZodString) return { type: 'string' };
+  if (schema instanceof z.ZodNumber) return { type: 'number' };
+  if (schema instanceof z.ZodBoolean) return { type: 'boolean' };
+  if (schema instanceof z.ZodLiteral) return { const: schema.value };
+  if (schema instanceof z.ZodEnum) {
+    return { type: 'string', enum: [...schema.options] };
+  }
+  if (schema instanceof z.ZodArray) {
+    return { type: 'array', items: jsonSchemaOf(schema.element) };
+  }
+  if (schema instanceof z.ZodRecord) {
+    return {
+      type: 'object',
+      additionalProperties: jsonSchemaOf(schema.valueSchema),
+    };
+  }
+  if (schema instanceof z.ZodObject) return objectSchemaOf(schema.shape);
+  if (schema instanceof z.ZodDiscriminatedUnion) {
+    return { oneOf: [...schema.options].map(jsonSchemaOf) };
+  }
+  throw new Error(`No JSON Schema for ${schema.constructor.name}`);
+}
@@ -1,3 +1,5 @@
+import { ToolError } from './tool-error.js';
+
 export function groupConsecutiveLines(lineNumbers: number[]): string[] {
   if (lineNumbers.length === 0) return [];
   if (lineNumbers.length === 1) return [`line: ${lineNumbers[0]}`];
@@ -28,3 +30,107 @@ export function groupConsecutiveLines(lineNumbers: number[]): string[] {
 
   return groups;
 }
+
+export interface Position {
+  line: number;
+  column: number;
+}
+
+// Returns the string index at which each line of content starts.
+export function computeLineStarts(content: string): number[] {
+  const starts = [0];
+  for (let i = 0; i < content.length; i++) {
+    if (content.charCodeAt(i) === 10) {
+      starts.push(i + 1);
+    }
+  }
+  return starts;
+}
+
+function findLine(lineStarts: number[], index: number): number {
+  let low = 0;
+  let high = lineStarts.length - 1;
+  while (low < high) {
+    const mid = (low + high + 1) >> 1;
+    if (lineStarts[mid] <= index) {
+      low = mid;
+    } else {
+      high = mid - 1;
+    }
+  }
+  return low;
+}
+
+// Returns the 1-based line number containing index.
+export function indexToLine(lineStarts: number[], index: number): number {
+  return findLine(lineStarts, index) + 1;
+}
+
+// Converts a string index into a 1-based line and a 1-based column counted
+// in UTF-8 bytes, which is how the Go toolchain reports positions.
+export function indexToPosition(
+  content: string,
+  index: number,
+  lineStarts: number[] = computeLineStarts(content)
+): Position {
+  const line = findLine(lineStarts, index);
+  const column =
+    Buffer.byteLength(content.substring(lineStarts[line], index), 'utf-8') + 1;
+  return { line: line + 1, column };
+}
+
+// Converts a 1-based line and byte column back into a string index.
+export function positionToIndex(
+  content: string,
+  position: Position,
+  lineStarts: number[] = computeLineStarts(content)
+): number {
+  if (position.line < 1 || position.line > lineStarts.length) {
+    throw new ToolError(
+      'invalid_location',
+      `Line ${position.line} is out of range`
+    );
+  }
+  const start = lineStarts[position.line - 1];
+  const end =
+    position.line < lineStarts.length
+      ? lineStarts[position.line] - 1
+      : content.length;
+  const lineBytes = Buffer.from(content.substring(start, end), 'utf-8');
+  if (position.column < 1 || position.column > lineBytes.length + 1) {
+    throw new ToolError(
+      'invalid_location',
+      `Column ${position.column} is out of range on line ${position.line}`
+    );
+  }
+  return (
+    start +
+    lineBytes.subarray(0, position.column - 1).toString('utf-8').length
+  );
+}
+
+// Converts a UTF-8 byte offset into a string index.
+export function byteOffsetToIndex(content: string, offset: number): number {
+  const bytes = Buffer.from(content, 'utf-8');
+  if (offset < 0 || offset > bytes.length) {
+    throw new ToolError('invalid_location', `Offset ${offset} is out of range`);
+  }
+  return bytes.subarray(0, offset).toString('utf-8').length;
+}
+
+// Converts a string index into a UTF-8 byte offset.
+export function indexToByteOffset(content: string, index: number): number {
+  return Buffer.byteLength(content.substring(0, index), 'utf-8');
+}
+
+// Returns the full text of the line containing index, without the newline.
+export function lineTextAt(
+  content: string,
+  index: number,
+  lineStarts: number[] = computeLineStarts(content)
+): string {
+  const line = findLine(lineStarts, index);
+  const end =
+    line + 1 < lineStarts.length ? lineStarts[line + 1] - 1 : content.length;
+  return content.substring(lineStarts[line], end).replace(/\r$/, '');
+}
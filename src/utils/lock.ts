@@ -0,0 +1,50 @@
+// A lock held either by any number of readers together or by one writer
+// alone. Requests are granted in the order they arrive, so that a reader
+// arriving after a waiting writer waits too and a stream of readers cannot
+// starve writers.
+export class ReadWriteLock {
+  private readers = 0;
+  private writing = false;
+  private readonly waiting: { write: boolean; grant: () => void }[] = [];
+
+  // Runs fn while holding the lock shared with other readers.
+  read<T>(fn: () => Promise<T>): Promise<T> {
+    return this.run(false, fn);
+  }
+
+  // Runs fn while holding the lock alone.
+  write<T>(fn: () => Promise<T>): Promise<T> {
+    return this.run(true, fn);
+  }
+
+  private async run<T>(write: boolean, fn: () => Promise<T>): Promise<T> {
+    await new Promise<void>(grant => {
+      this.waiting.push({ write, grant });
+      this.grantWaiting();
+    });
+    try {
+      return await fn();
+    } finally {
+      if (write) {
+        this.writing = false;
+      } else {
+        this.readers--;
+      }
+      this.grantWaiting();
+    }
+  }
+
+  private grantWaiting(): void {
+    while (this.waiting.length > 0 && !this.writing) {
+      const next = this.waiting[0];
+      if (next.write) {
+        if (this.readers > 0) return;
+        this.writing = true;
+      } else {
+        this.readers++;
+      }
+      this.waiting.shift();
+      next.grant();
+    }
+  }
+}
@@ -0,0 +1,30 @@
+import { ToolError } from './tool-error.js';
+
+// Receives what a long-running tool is doing, as short messages such as
+// "Writing files (2/5)", one for each stage or step as it starts.
+export type ProgressReporter = (message: string) => void;
+
+// How the caller of a long-running tool follows and controls it.
+export interface TaskOptions {
+  onProgress?: ProgressReporter;
+  // Cancels the tool at its next step once aborted.
+  signal?: AbortSignal;
+}
+
+// Fails with a cancelled ToolError if signal was aborted. The event loop
+// runs first, so that a cancellation that arrived while the tool was busy
+// is seen.
+export async function checkpoint(signal?: AbortSignal): Promise<void> {
+  if (!signal) return;
+  await new Promise(resolve => setImmediate(resolve));
+  if (signal.aborted) {
+    throw new ToolError('cancelled', 'The request was cancelled');
+  }
+}
+
+// Reports that task starts a step, letting a cancellation take effect
+// before the step runs.
+export async function step(task: TaskOptions, message: string): Promise<void> {
+  task.onProgress?.(message);
+  await checkpoint(task.signal);
+}
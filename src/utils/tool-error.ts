@@ -0,0 +1,114 @@
+// Errors the tools report with a stable code, so that callers can tell
+// failures apart and react to them without matching on the message.
+
+export type ToolErrorCode =
+  // Nothing the tool can work on was found at the location or by the name.
+  | 'symbol_not_found'
+  // The location or range does not single out one construct, such as a
+  // range covering part of an expression, or several symbols have the name.
+  | 'ambiguous_location'
+  // The location lies outside the file or the module, or is missing.
+  | 'invalid_location'
+  // An argument other than the location is malformed or pointless, like a
+  // new name that is not an identifier.
+  | 'invalid_argument'
+  // The change would introduce or capture a conflicting name.
+  | 'name_conflict'
+  // A file could not be parsed.
+  | 'compile_error'
+  // The construct is recognized but the refactoring does not support it,
+  // or could not apply it without changing what the program does.
+  | 'unsupported_construct'
+  | 'file_not_found'
+  // Reading or writing a file failed.
+  | 'io_error'
+  // The client cancelled the request before the tool finished.
+  | 'cancelled'
+  // Files changed on disk since the operation that undo would revert.
+  | 'files_changed'
+  | 'internal_error';
+
+export interface ErrorLocation {
+  filePath: string;
+  line: number;
+  column: number;
+}
+
+// One of the symbols an ambiguous name matches.
+export interface ErrorCandidate extends ErrorLocation {
+  // A qualified name that resolves to this symbol alone.
+  symbol: string;
+  kind: string;
+}
+
+export class ToolError extends Error {
+  readonly code: ToolErrorCode;
+  readonly location?: ErrorLocation;
+  readonly candidates?: ErrorCandidate[];
+
+  constructor(
+    code: ToolErrorCode,
+    message: string,
+    location?: ErrorLocation,
+    candidates?: ErrorCandidate[]
+  ) {
+    super(message);
+    this.name = 'ToolError';
+    this.code = code;
+    this.location = location;
+    this.candidates = candidates;
+  }
+}
+
+// The error response of a failed tool call.
+export interface ToolErrorInfo {
+  code: ToolErrorCode;
+  message: string;
+  location?: ErrorLocation;
+  candidates?: ErrorCandidate[];
+}
+
+// Describes any error thrown while running a tool. Errors other than
+// ToolErrors come from the file system, from patterns that do not compile
+// or from bugs.
+export function describeError(error: unknown): ToolErrorInfo {
+  if (error instanceof ToolError) {
+    return {
+      code: error.code,
+      message: error.message,
+      ...(error.location && { location: error.location }),
+      ...(error.candidates && { candidates: error.candidates }),
+    };
+  }
+  const message = error instanceof Error ? error.message : String(error);
+  const errno = (error as NodeJS.ErrnoException | undefined)?.code;
+  if (errno === 'ENOENT' || errno === 'ENOTDIR') {
+    return { code: 'file_not_found', message };
+  }
+  if (errno) return { code: 'io_error', message };
+  if (error instanceof SyntaxError) {
+    return { code: 'invalid_argument', message };
+  }
+  return { code: 'internal_error', message };
+}
+
+// Builds the result of a tool call that failed during action. The error is
+// returned as structured content and, for clients that only read text,
+// both as a readable message and serialized as JSON.
+export function errorResult(action: string, error: unknown) {
+  const info = describeError(error);
+  const at = info.location
+    ? ` (${info.location.filePath}:${info.location.line}:${info.location.column})`
+    : '';
+  return {
+    content: [
+      {
+        type: 'text' as const,
+        text: `Error during ${action} [${info.code}]: ${info.message}${at}`,
+      },
+      { type: 'text' as const, text: JSON.stringify({ error: info }) },
+    ],
+    structuredContent: { error: info },
+    isError: true,
+  };
+}
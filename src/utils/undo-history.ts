@@ -0,0 +1,51 @@
+// A file written by an operation: what it contained before, or undefined
+// if the operation created it, and what the operation wrote.
+export interface FileSnapshot {
+  filePath: string;
+  before?: string;
+  after: string;
+}
+
+// The files one call of a tool wrote, in the order it wrote them, and the
+// directories it created for them, the innermost first.
+export interface Operation {
+  files: FileSnapshot[];
+  dirs: string[];
+}
+
+// How many operations are kept. Older ones are forgotten and can no
+// longer be undone.
+export const UNDO_LIMIT = 10;
+
+// Operations that wrote files, the most recent last.
+const history: Operation[] = [];
+
+// Remembers the files an operation wrote so that it can be undone.
+export function recordOperation(
+  files: FileSnapshot[],
+  dirs: string[] = []
+): void {
+  if (files.length === 0) return;
+  history.push({ files, dirs });
+  if (history.length > UNDO_LIMIT) history.shift();
+}
+
+// Returns the most recent operation without forgetting it.
+export function lastOperation(): Operation | undefined {
+  return history[history.length - 1];
+}
+
+// Forgets the most recent operation, once it was undone.
+export function dropLastOperation(): void {
+  history.pop();
+}
+
+// Returns how many operations can be undone.
+export function undoableOperations(): number {
+  return history.length;
+}
+
+// Forgets every operation.
+export function clearUndoHistory(): void {
+  history.length = 0;
+}
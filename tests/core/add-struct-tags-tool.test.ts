@@ -0,0 +1,182 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performAddStructTags,
+  formatAddStructTagsResults,
+} from '../../src/core/add-struct-tags-tool.js';
+import type { TagNaming } from '../../src/core/add-struct-tags-tool.js';
+
+describe('Add Struct Tags Tool', () => {
+  const testDir = 'tests/temp-add-struct-tags';
+  const userFile = `${testDir}/user.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/tags\n\ngo 1.22\n');
+    writeFileSync(
+      userFile,
+      `package tags
+
+import "sync"
+
+type User struct {
+	UserID   int \`db:"user_id"\`
+	Name     string // the login
+	password string
+	sync.Mutex
+
+	HTTPProxy string \`json:"proxy,string" xml:"p"\`
+	Secret    string \`json:"-"\`
+}
+
+type Point struct{ X, Y int }
+
+type Names []string
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  interface AddOptions {
+    key?: string;
+    naming?: TagNaming;
+    omitEmpty?: boolean;
+  }
+
+  const addTags = (
+    typeName: string,
+    { key = 'json', ...options }: AddOptions = {}
+  ) => performAddStructTags({ filePath: userFile, typeName, key, ...options });
+
+  describe('performAddStructTags', () => {
+    test('should tag exported fields and keep other keys', async () => {
+      const result = await addTags('User');
+      expect(result.updated).toEqual(['UserID', 'Name', 'HTTPProxy']);
+      expect(result.ignored).toEqual(['Secret']);
+      expect(readFileSync(userFile, 'utf-8')).toContain(
+        `type User struct {
+	UserID   int    \`db:"user_id" json:"user_id"\`
+	Name     string \`json:"name"\` // the login
+	password string
+	sync.Mutex
+
+	HTTPProxy string \`json:"http_proxy,string" xml:"p"\`
+	Secret    string \`json:"-"\`
+}`
+      );
+    });
+
+    test('should name tags in camelCase', async () => {
+      await addTags('User', { naming: 'camelCase' });
+      const content = readFileSync(userFile, 'utf-8');
+      expect(content).toContain('`db:"user_id" json:"userId"`');
+      expect(content).toContain('`json:"httpProxy,string" xml:"p"`');
+    });
+
+    test('should add omitempty once', async () => {
+      await addTags('User', { key: 'db', omitEmpty: true });
+      await addTags('User', { key: 'db', omitEmpty: true });
+      const content = readFileSync(userFile, 'utf-8');
+      expect(content).toContain('UserID   int    `db:"user_id,omitempty"`');
+      expect(content).toContain(
+        'HTTPProxy string `json:"proxy,string" xml:"p" db:"http_proxy,omitempty"`'
+      );
+    });
+
+    test('should change nothing when run again', async () => {
+      await addTags('User', { naming: 'as-is' });
+      const content = readFileSync(userFile, 'utf-8');
+      const result = await addTags('User', { naming: 'as-is' });
+      expect(result.updated).toEqual([]);
+      expect(result.changes).toEqual([]);
+      expect(readFileSync(userFile, 'utf-8')).toBe(content);
+    });
+
+    test('should give fields declared together a tag each', async () => {
+      await addTags('Point');
+      expect(readFileSync(userFile, 'utf-8')).toContain(
+        'type Point struct {\n\tX int `json:"x"`\n\tY int `json:"y"`\n}'
+      );
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(userFile, 'utf-8');
+      const result = await performAddStructTags({
+        filePath: userFile,
+        typeName: 'User',
+        key: 'json',
+        dryRun: true,
+      });
+      expect(result.changes).toHaveLength(1);
+      expect(readFileSync(userFile, 'utf-8')).toBe(original);
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject types that are not structs',
+        typeName: 'Names',
+        error: "'Names' is not declared as a struct type",
+      },
+      {
+        name: 'should reject unknown types',
+        typeName: 'Missing',
+        error: "'Missing' is not a type declared in package tags",
+      },
+      {
+        name: 'should reject invalid keys',
+        typeName: 'User',
+        key: 'a:b',
+        error: "'a:b' is not a valid struct tag key",
+      },
+      {
+        name: 'should reject malformed tags',
+        typeName: 'Bad',
+        extra: '\ntype Bad struct {\n\tA int `json`\n}\n',
+        error: 'The tag of field A does not consist of key:"value" pairs',
+      },
+    ];
+
+    errorCases.forEach(({ name, typeName, key, extra, error }) => {
+      test(name, async () => {
+        if (extra) {
+          writeFileSync(userFile, readFileSync(userFile, 'utf-8') + extra);
+        }
+        const original = readFileSync(userFile, 'utf-8');
+        await expect(addTags(typeName, { key })).rejects.toThrow(error);
+        expect(readFileSync(userFile, 'utf-8')).toBe(original);
+      });
+    });
+  });
+
+  describe('formatAddStructTagsResults', () => {
+    test('should list the tagged and ignored fields', () => {
+      expect(
+        formatAddStructTagsResults({
+          typeName: 'User',
+          key: 'json',
+          updated: ['Name'],
+          ignored: ['Secret'],
+          changes: [{ filePath: 'user.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        `Set the json tag of 1 field of 'User': Name\nLeft alone, since their json tag is "-": Secret\n\nModified 1 file:\n  user.go`
+      );
+    });
+  });
+});
@@ -0,0 +1,168 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import { writeFileSync, existsSync, rmSync, mkdirSync } from 'fs';
+import { resolve } from 'path';
+import {
+  performCapabilities,
+  formatCapabilitiesResults,
+} from '../../src/core/capabilities-tool.js';
+
+describe('Capabilities Tool', () => {
+  const testDir = 'tests/temp-capabilities';
+  const appDir = `${testDir}/app`;
+  const binDir = `${testDir}/bin`;
+  const path = process.env.PATH;
+  const server = { name: 'refactor-mcp', version: '1.2.0' };
+  const tools = [
+    {
+      name: 'reload',
+      title: 'Reload Go Packages',
+      description: 'Drop the cached packages',
+      readOnly: true,
+      inputSchema: { type: 'object', properties: {} },
+    },
+  ];
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(appDir, { recursive: true });
+    writeFileSync(
+      `${appDir}/go.mod`,
+      'module example.com/app\n\ngo 1.21\n\ntoolchain go1.22.3\n'
+    );
+    writeFileSync(`${appDir}/main.go`, 'package main\n\nfunc main() {}\n');
+    // A go command of its own, so that its version is known.
+    mkdirSync(binDir);
+    writeFileSync(
+      `${binDir}/go`,
+      '#!/bin/sh\necho go version go1.23.4 linux/arm64\n',
+      { mode: 0o755 }
+    );
+    process.env.PATH = resolve(binDir);
+  });
+
+  afterEach(() => {
+    process.env.PATH = path;
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performCapabilities', () => {
+    test('should report the Go version of the module', async () => {
+      const result = await performCapabilities({
+        filePath: `${appDir}/main.go`,
+        server,
+        tools,
+      });
+      expect(result.server).toEqual(server);
+      expect(result.tools).toBe(tools);
+      expect(result.go).toEqual({
+        installed: 'go1.23.4 linux/arm64',
+        root: resolve(appDir),
+        module: 'example.com/app',
+        goVersion: '1.21',
+        toolchain: 'go1.22.3',
+        workspace: undefined,
+        generics: true,
+        perIterationLoopVars: false,
+      });
+      expect(result.features).toMatchObject({
+        genericsAwareRename: true,
+        goWork: true,
+        formats: ['gofmt', 'gofumpt', 'none'],
+      });
+    });
+
+    test('should tell the language features apart by version', async () => {
+      const versions = ['1.17', '1.18', '1.22.1', ''];
+      const features = [];
+      for (const version of versions) {
+        writeFileSync(
+          `${appDir}/go.mod`,
+          `module example.com/app\n${version ? `\ngo ${version}\n` : ''}`
+        );
+        const { go } = await performCapabilities({
+          filePath: appDir,
+          server,
+          tools,
+        });
+        features.push([go.generics, go.perIterationLoopVars]);
+      }
+      expect(features).toEqual([
+        [false, false],
+        [true, false],
+        [true, true],
+        [false, false],
+      ]);
+    });
+
+    test('should report the workspace loading the module', async () => {
+      writeFileSync(`${testDir}/go.work`, 'go 1.22\n\nuse ./app\n');
+      const result = await performCapabilities({
+        filePath: appDir,
+        server,
+        tools,
+      });
+      expect(result.go.workspace).toBe(resolve(testDir, 'go.work'));
+    });
+
+    test('should report directories outside modules', async () => {
+      rmSync(`${appDir}/go.mod`);
+      const result = await performCapabilities({
+        filePath: appDir,
+        server,
+        tools,
+      });
+      expect(result.go).toEqual({
+        installed: 'go1.23.4 linux/arm64',
+        generics: false,
+        perIterationLoopVars: false,
+      });
+    });
+
+    test('should report a missing go command', async () => {
+      rmSync(`${binDir}/go`);
+      const result = await performCapabilities({
+        filePath: appDir,
+        server,
+        tools,
+      });
+      expect(result.go.installed).toBeUndefined();
+      expect(result.go.goVersion).toBe('1.21');
+      expect(formatCapabilitiesResults(result)).toContain(
+        '  reload (read-only)\nNo go command found\nGo module example.com/app'
+      );
+    });
+  });
+
+  describe('formatCapabilitiesResults', () => {
+    test('should summarize the tools and the Go version', () => {
+      expect(
+        formatCapabilitiesResults({
+          server,
+          tools,
+          go: {
+            installed: 'go1.23.4 linux/arm64',
+            root: resolve(appDir),
+            module: 'example.com/app',
+            goVersion: '1.21',
+            toolchain: 'go1.22.3',
+            workspace: resolve(testDir, 'go.work'),
+            generics: true,
+            perIterationLoopVars: false,
+          },
+          features: {
+            genericsAwareRename: true,
+            goWork: true,
+            formats: ['gofmt', 'gofumpt', 'none'],
+            defaultFormat: 'gofmt',
+          },
+        })
+      ).toBe(
+        'refactor-mcp 1.2.0 with 1 tool:\n  reload (read-only)\nInstalled go command: go1.23.4 linux/arm64\nGo module example.com/app at tests/temp-capabilities/app: go 1.21, toolchain go1.22.3\n  loaded with the workspace of tests/temp-capabilities/go.work\n  generics: yes\n  per-iteration loop variables: no\nFeatures:\n  generics-aware rename: yes\n  go.work workspaces: yes\n  formats: gofmt, gofumpt, none, default gofmt'
+      );
+    });
+  });
+});
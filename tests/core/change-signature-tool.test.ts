@@ -0,0 +1,301 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performChangeSignature,
+  formatChangeSignatureResults,
+} from '../../src/core/change-signature-tool.js';
+import type { ParameterChange } from '../../src/core/change-signature-tool.js';
+
+describe('Change Signature Tool', () => {
+  const testDir = 'tests/temp-change-signature';
+  const mainFile = `${testDir}/main.go`;
+  const storeFile = `${testDir}/store/store.go`;
+  const memFile = `${testDir}/mem/mem.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/store`, { recursive: true });
+    mkdirSync(`${testDir}/mem`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/sig\n\ngo 1.22\n');
+    writeFileSync(
+      storeFile,
+      `package store
+
+// Store reads values.
+type Store interface {
+	Get(key string) (string, error)
+}
+
+type Config struct{ Name string }
+`
+    );
+    writeFileSync(
+      memFile,
+      `package mem
+
+type Mem struct{ data map[string]string }
+
+func (m *Mem) Get(key string) (string, error) { return m.data[key], nil }
+`
+    );
+    writeFileSync(
+      mainFile,
+      `package main
+
+import (
+	"fmt"
+
+	"example.com/sig/mem"
+	"example.com/sig/store"
+)
+
+func greet(name string, times int, loud bool) string {
+	s := name
+	for i := 0; i < times; i++ {
+		s += "!"
+	}
+	return s
+}
+
+func sum(base int, xs ...int) int {
+	for _, x := range xs {
+		base += x
+	}
+	return base
+}
+
+func use(s store.Store) {
+	v, _ := s.Get("k")
+	fmt.Println(v)
+}
+
+func later(n int) {}
+
+func check(a, b string) {}
+
+var handler = later
+
+func main() {
+	fmt.Println(greet("a", 2, false))
+	fmt.Println(sum(1, 2, 3), sum(0, []int{1}...))
+	use(&mem.Mem{})
+	var m mem.Mem
+	fmt.Println(m.Get("x"))
+	fmt.Println(greet(greet("b", 1, true), 1, true))
+	fmt.Println(greet(
+		"c",
+		3,
+		false,
+	))
+	check(fmt.Sprint(1), fmt.Sprint(2))
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Locates the first occurrence of a call or declaration of name.
+  const locate = (file: string, name: string) => {
+    const lines = readFileSync(file, 'utf-8').split('\n');
+    const line = lines.findIndex(l => l.includes(`${name}(`));
+    return {
+      filePath: file,
+      line: line + 1,
+      column: lines[line].indexOf(`${name}(`) + 1,
+    };
+  };
+
+  const keep = (index: number): ParameterChange => ({ action: 'keep', index });
+  const drop = (index: number): ParameterChange => ({ action: 'drop', index });
+
+  describe('performChangeSignature', () => {
+    test('should reorder and drop parameters at every call', async () => {
+      const result = await performChangeSignature({
+        ...locate(mainFile, 'greet'),
+        parameters: [drop(2), keep(1), keep(0)],
+      });
+      expect(result.signature).toBe(
+        'func greet(times int, name string) string'
+      );
+      expect(result.callSites).toHaveLength(4);
+      const content = readFileSync(mainFile, 'utf-8');
+      expect(content).toContain('fmt.Println(greet(2, "a"))');
+      expect(content).toContain('fmt.Println(greet(1, greet(1, "b")))');
+      expect(content).toContain('greet(\n\t\t3,\n\t\t"c",\n\t))');
+    });
+
+    test('should update implementations and calls of interface methods', async () => {
+      const result = await performChangeSignature({
+        ...locate(storeFile, 'Get'),
+        parameters: [
+          {
+            action: 'add',
+            name: 'ctx',
+            type: 'context.Context',
+            defaultValue: 'context.Background()',
+          },
+          keep(0),
+        ],
+      });
+      expect(result.signature).toBe(
+        'Get(ctx context.Context, key string) (string, error)'
+      );
+      expect(result.related).toEqual([`${memFile}:5:15`]);
+      expect(readFileSync(storeFile, 'utf-8')).toContain(
+        'import "context"\n\n// Store reads values.\ntype Store interface {\n\tGet(ctx context.Context, key string) (string, error)\n}'
+      );
+      expect(readFileSync(memFile, 'utf-8')).toContain(
+        'func (m *Mem) Get(ctx context.Context, key string) (string, error)'
+      );
+      const content = readFileSync(mainFile, 'utf-8');
+      expect(content).toContain('\t"context"\n\t"fmt"\n');
+      expect(content).toContain('s.Get(context.Background(), "k")');
+      expect(content).toContain('m.Get(context.Background(), "x")');
+    });
+
+    test('should pass zero values qualified for each call site', async () => {
+      await performChangeSignature({
+        ...locate(storeFile, 'Get'),
+        parameters: [keep(0), { action: 'add', name: 'cfg', type: 'Config' }],
+      });
+      expect(readFileSync(memFile, 'utf-8')).toContain(
+        'import "example.com/sig/store"\n\ntype Mem'
+      );
+      expect(readFileSync(memFile, 'utf-8')).toContain(
+        'Get(key string, cfg store.Config)'
+      );
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        'm.Get("x", store.Config{})'
+      );
+    });
+
+    test('should insert parameters before a variadic one', async () => {
+      await performChangeSignature({
+        ...locate(mainFile, 'sum'),
+        parameters: [
+          keep(0),
+          { action: 'add', name: 'p', type: '*int' },
+          keep(1),
+        ],
+      });
+      const content = readFileSync(mainFile, 'utf-8');
+      expect(content).toContain('func sum(base int, p *int, xs ...int) int');
+      expect(content).toContain('sum(1, nil, 2, 3), sum(0, nil, []int{1}...)');
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(mainFile, 'utf-8');
+      const result = await performChangeSignature({
+        ...locate(mainFile, 'greet'),
+        parameters: [keep(1), keep(0), keep(2)],
+        dryRun: true,
+      });
+      expect(readFileSync(mainFile, 'utf-8')).toBe(original);
+      const output = formatChangeSignatureResults(result);
+      expect(output).toContain(
+        '+func greet(times int, name string, loud bool) string {\n'
+      );
+      expect(output).toContain('Dry run: 1 file would be changed');
+    });
+
+    const errorCases = [
+      {
+        name: 'should require every parameter to be kept or dropped',
+        function: 'greet',
+        parameters: [keep(0), keep(1)],
+        error: 'Parameter 2 (loud) must be either kept or dropped',
+      },
+      {
+        name: 'should keep variadic parameters last',
+        function: 'sum',
+        parameters: [keep(1), keep(0)],
+        error: 'The variadic parameter xs must remain last',
+      },
+      {
+        name: 'should reject dropping parameters that are used',
+        function: 'greet',
+        parameters: [drop(0), keep(1), keep(2)],
+        error: "Cannot drop parameter 'name' of 'greet', which is used at",
+      },
+      {
+        name: 'should reject names declared in the body',
+        function: 'greet',
+        parameters: [
+          keep(0),
+          keep(1),
+          keep(2),
+          { action: 'add', name: 's', type: 'int' },
+        ],
+        error: "'s' is already declared in the body of 'greet'",
+      },
+      {
+        name: 'should reject arguments with side effects that would be dropped',
+        function: 'check',
+        parameters: [keep(0), drop(1)],
+        error: "Cannot drop the argument 'fmt.Sprint(2)'",
+      },
+      {
+        name: 'should preserve the order of evaluation',
+        function: 'check',
+        parameters: [keep(1), keep(0)],
+        error: 'would change the order in which they are evaluated',
+      },
+      {
+        name: 'should require defaults for types of unknown zero value',
+        function: 'greet',
+        parameters: [
+          keep(0),
+          keep(1),
+          keep(2),
+          { action: 'add', name: 'ctx', type: 'context.Context' },
+        ],
+        error: 'provide a default value for parameter',
+      },
+      {
+        name: 'should reject functions used as values',
+        function: 'later',
+        parameters: [drop(0)],
+        error: "Cannot change the signature of 'later', which is used as a value",
+      },
+    ];
+
+    errorCases.forEach(({ name, function: fn, parameters, error }) => {
+      test(name, async () => {
+        await expect(
+          performChangeSignature({ ...locate(mainFile, fn), parameters })
+        ).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatChangeSignatureResults', () => {
+    test('should report the signature, related methods and calls', () => {
+      expect(
+        formatChangeSignatureResults({
+          functionName: 'Get',
+          signature: 'Get(ctx context.Context, key string) string',
+          related: ['mem.go:5:15'],
+          callSites: ['main.go:26:10'],
+          changes: [{ filePath: 'main.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Changed 'Get' to Get(ctx context.Context, key string) string\nAlso changed 1 declaration of the same interface method:\n  mem.go:5:15\nUpdated 1 call site:\n  main.go:26:10\n\nModified 1 file:\n  main.go"
+      );
+    });
+  });
+});
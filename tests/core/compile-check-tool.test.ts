@@ -0,0 +1,253 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import { writeFileSync, existsSync, rmSync, mkdirSync } from 'fs';
+import {
+  performCompileCheck,
+  formatCompileCheckResults,
+} from '../../src/core/compile-check-tool.js';
+
+describe('Compile Check Tool', () => {
+  const testDir = 'tests/temp-compile-check';
+  const libFile = `${testDir}/lib/lib.go`;
+  const appFile = `${testDir}/app/app.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/lib`, { recursive: true });
+    mkdirSync(`${testDir}/app`, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/cc\n\ngo 1.22\n');
+    writeFileSync(
+      libFile,
+      `package lib
+
+type Point struct{ X, Y int }
+
+func (p Point) Len() int { return p.X }
+
+func Add(a, b int) int { return a + b }
+
+func Join(sep string, parts ...string) string { return sep }
+`
+    );
+    writeFileSync(
+      appFile,
+      `package app
+
+import (
+	"fmt"
+
+	"example.com/cc/lib"
+)
+
+func Run() {
+	p := lib.Point{X: 1}
+	fmt.Println(lib.Add(p.X, p.Len()), lib.Join(",", "a", "b"))
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performCompileCheck', () => {
+    test('should report no errors for a package that checks', async () => {
+      const result = await performCompileCheck({ filePath: appFile });
+      expect(result).toEqual({
+        scope: 'package',
+        target: 'example.com/cc/app',
+        packages: 1,
+        files: 1,
+        errors: [],
+        warnings: [],
+      });
+    });
+
+    test('should report errors with their locations', async () => {
+      writeFileSync(
+        appFile,
+        `package app
+
+import (
+	"fmt"
+	"os"
+
+	"example.com/cc/lib"
+)
+
+var _ lib.Nope
+
+func Run(x any) (int, error) {
+	unused := 1
+	p := lib.Point{}
+	fmt.Println(p.Z, lib.Add(1), lib.Join(), undefinedThing)
+	switch v := x.(type) {
+	case int:
+	}
+	return p.Len(), nil, nil
+}
+`
+      );
+      const result = await performCompileCheck({ filePath: appFile });
+      const path = 'tests/temp-compile-check/app/app.go';
+      expect(result.errors).toEqual([
+        {
+          filePath: path,
+          line: 5,
+          column: 2,
+          message: '"os" imported and not used',
+        },
+        {
+          filePath: path,
+          line: 10,
+          column: 11,
+          message: 'undefined: lib.Nope',
+        },
+        {
+          filePath: path,
+          line: 13,
+          column: 2,
+          message: 'declared and not used: unused',
+        },
+        {
+          filePath: path,
+          line: 15,
+          column: 16,
+          message: 'p.Z undefined (type lib.Point has no field or method Z)',
+        },
+        {
+          filePath: path,
+          line: 15,
+          column: 27,
+          message: 'not enough arguments in call to lib.Add',
+        },
+        {
+          filePath: path,
+          line: 15,
+          column: 31,
+          message: 'not enough arguments in call to lib.Join',
+        },
+        {
+          filePath: path,
+          line: 15,
+          column: 43,
+          message: 'undefined: undefinedThing',
+        },
+        {
+          filePath: path,
+          line: 16,
+          column: 9,
+          message: 'v declared and not used',
+        },
+        {
+          filePath: path,
+          line: 19,
+          column: 23,
+          message: 'too many return values',
+        },
+      ]);
+    });
+
+    test('should report syntax errors', async () => {
+      writeFileSync(
+        `${testDir}/app/bad.go`,
+        'package app\n\nfunc broken( {\n'
+      );
+      const result = await performCompileCheck({ filePath: appFile });
+      expect(result.errors).toEqual([
+        {
+          filePath: 'tests/temp-compile-check/app/bad.go',
+          line: 3,
+          column: 14,
+          message: 'expected type, found {',
+        },
+      ]);
+    });
+
+    test('should check the whole module on request', async () => {
+      writeFileSync(
+        libFile,
+        'package lib\n\nfunc Add(a, b int) int { return a + c }\n'
+      );
+      const pkg = await performCompileCheck({ filePath: appFile });
+      expect(pkg.errors.map(e => e.message)).toEqual([
+        'undefined: lib.Point',
+        'undefined: lib.Join',
+      ]);
+      const module = await performCompileCheck({
+        filePath: `${testDir}/lib`,
+        scope: 'module',
+      });
+      expect(module.target).toBe('example.com/cc');
+      expect(module.packages).toBe(2);
+      expect(module.errors.map(e => `${e.filePath}: ${e.message}`)).toEqual([
+        'tests/temp-compile-check/app/app.go: undefined: lib.Point',
+        'tests/temp-compile-check/app/app.go: undefined: lib.Join',
+        'tests/temp-compile-check/lib/lib.go: undefined: c',
+      ]);
+    });
+
+    test('should report imports of the module that cannot be found', async () => {
+      writeFileSync(
+        `${testDir}/app/more.go`,
+        'package app\n\nimport "example.com/cc/gone"\n\nvar _ = gone.X\n'
+      );
+      const result = await performCompileCheck({ filePath: appFile });
+      expect(result.errors.map(e => e.message)).toEqual([
+        'could not import example.com/cc/gone: no Go files in tests/temp-compile-check/gone',
+      ]);
+    });
+
+    test('should not guess about packages outside the module', async () => {
+      writeFileSync(
+        `${testDir}/app/more.go`,
+        'package app\n\nimport (\n\t"github.com/mattn/go-sqlite3"\n\t"golang.org/x/sync/errgroup"\n)\n\nvar _ = sqlite3.ErrNo\n\nvar g errgroup.Group\n\nfunc wait() error { return g.Wait() }\n'
+      );
+      const result = await performCompileCheck({ filePath: appFile });
+      expect(result.errors).toEqual([]);
+    });
+  });
+
+  describe('formatCompileCheckResults', () => {
+    test('should list the errors found', () => {
+      expect(
+        formatCompileCheckResults({
+          scope: 'module',
+          target: 'example.com/cc',
+          packages: 2,
+          files: 3,
+          errors: [
+            {
+              filePath: 'app/app.go',
+              line: 5,
+              column: 2,
+              message: '"os" imported and not used',
+            },
+          ],
+          warnings: [],
+        })
+      ).toBe(
+        'Found 1 error in the 2 packages of module example.com/cc (3 files):\n  app/app.go:5:2: "os" imported and not used'
+      );
+    });
+
+    test('should report packages that check', () => {
+      expect(
+        formatCompileCheckResults({
+          scope: 'package',
+          target: 'example.com/cc/app',
+          packages: 1,
+          files: 1,
+          errors: [],
+          warnings: ['app/x_windows.go is excluded by build constraints'],
+        })
+      ).toBe(
+        'No errors in package example.com/cc/app (1 file)\nNot checked, check these by hand:\n  app/x_windows.go is excluded by build constraints'
+      );
+    });
+  });
+});
@@ -0,0 +1,264 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performConvertFuncToMethod,
+  performConvertMethodToFunc,
+  formatConvertFuncMethodResults,
+} from '../../src/core/convert-func-method-tool.js';
+
+describe('Convert Func Method Tool', () => {
+  const testDir = 'tests/temp-convert-func-method';
+  const storeFile = `${testDir}/store/store.go`;
+  const appFile = `${testDir}/app/app.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/store`, { recursive: true });
+    mkdirSync(`${testDir}/app`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/fm\n\ngo 1.22\n');
+    writeFileSync(
+      storeFile,
+      `package store
+
+type Store struct {
+	items map[string]string
+	Size  int
+}
+
+type Level int
+
+type Sizer interface{ Len() int }
+
+func Get(s *Store, key string) string { return s.items[key] }
+
+func Put(key string, s *Store, value string) {
+	s.items[key] = value
+}
+
+func Name(l Level) string { return "level" }
+
+func Size(s Store) int { return len(s.items) }
+
+func Count(items []string) int { return len(items) }
+
+func (s *Store) Len() int { return len(s.items) }
+
+func (s Store) Keys() []string { return nil }
+
+func use(s Store) {
+	_ = Get(&s, "a")
+	Put("k", &s, Get(&s, "b"))
+	f := Get
+	_ = f
+	_ = Name(3)
+	_ = s.Keys()
+}
+`
+    );
+    writeFileSync(
+      appFile,
+      `package app
+
+import "example.com/fm/store"
+
+type Wrapper struct {
+	*store.Store
+}
+
+type Local struct{}
+
+func Describe(s *store.Store) string { return "" }
+
+func Run(s *store.Store, w Wrapper) int {
+	_ = store.Get(s, "x")
+	return len(w.Keys())
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performConvertFuncToMethod', () => {
+    test('should make the parameter the receiver at every call', async () => {
+      const result = await performConvertFuncToMethod({
+        filePath: storeFile,
+        symbol: 'Get',
+        parameter: 0,
+      });
+      expect(result.to).toBe('method Store.Get');
+      expect(result.callSites).toHaveLength(4);
+      const content = readFileSync(storeFile, 'utf-8');
+      expect(content).toContain(
+        'func (s *Store) Get(key string) string { return s.items[key] }'
+      );
+      expect(content).toContain('_ = s.Get("a")');
+      expect(content).toContain('Put("k", &s, s.Get("b"))');
+      expect(content).toContain('f := (*Store).Get');
+      expect(readFileSync(appFile, 'utf-8')).toContain('_ = s.Get("x")');
+    });
+
+    test('should remove a parameter from the middle', async () => {
+      await performConvertFuncToMethod({
+        filePath: storeFile,
+        symbol: 'Put',
+        parameter: 1,
+      });
+      const content = readFileSync(storeFile, 'utf-8');
+      expect(content).toContain(
+        'func (s *Store) Put(key string, value string) {'
+      );
+      expect(content).toContain('s.Put("k", Get(&s, "b"))');
+    });
+
+    test('should convert untyped constants to the receiver type', async () => {
+      await performConvertFuncToMethod({
+        filePath: storeFile,
+        symbol: 'Name',
+        parameter: 0,
+      });
+      const content = readFileSync(storeFile, 'utf-8');
+      expect(content).toContain('func (l Level) Name() string {');
+      expect(content).toContain('_ = Level(3).Name()');
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject types declared in another package',
+        filePath: appFile,
+        symbol: 'Describe',
+        parameter: 0,
+        code: 'unsupported_construct',
+        error:
+          'Cannot make func Describe a method of store.Store: methods can only be declared in the package of their receiver type, example.com/fm/store, and func Describe is in example.com/fm/app',
+      },
+      {
+        name: 'should reject parameters of unnamed types',
+        filePath: storeFile,
+        symbol: 'Count',
+        parameter: 0,
+        code: 'unsupported_construct',
+        error:
+          'The parameter items of func Count has type []string; only a named type or a pointer to one can be a receiver',
+      },
+      {
+        name: 'should reject names the type already has',
+        filePath: storeFile,
+        symbol: 'Size',
+        parameter: 0,
+        code: 'name_conflict',
+        error: `Store already has a field named Size at ${storeFile}:5:2`,
+      },
+      {
+        name: 'should reject parameter indices out of range',
+        filePath: storeFile,
+        symbol: 'Get',
+        parameter: 2,
+        code: 'invalid_argument',
+        error: 'func Get has no parameter 2; give an index from 0 to 1',
+      },
+      {
+        name: 'should reject methods',
+        filePath: storeFile,
+        symbol: 'Store.Len',
+        parameter: 0,
+        code: 'invalid_argument',
+        error: "'Len' is already a method",
+      },
+    ];
+
+    errorCases.forEach(({ name, filePath, symbol, parameter, code, error }) => {
+      test(name, async () => {
+        const original = readFileSync(filePath, 'utf-8');
+        await expect(
+          performConvertFuncToMethod({ filePath, symbol, parameter })
+        ).rejects.toMatchObject({ code, message: error });
+        expect(readFileSync(filePath, 'utf-8')).toBe(original);
+      });
+    });
+  });
+
+  describe('performConvertMethodToFunc', () => {
+    test('should pass the receiver, through embedded fields', async () => {
+      const result = await performConvertMethodToFunc({
+        filePath: storeFile,
+        symbol: 'Store.Keys',
+      });
+      expect(result.to).toBe('func Keys');
+      expect(readFileSync(storeFile, 'utf-8')).toContain(
+        'func Keys(s Store) []string { return nil }'
+      );
+      expect(readFileSync(storeFile, 'utf-8')).toContain('_ = Keys(s)');
+      expect(readFileSync(appFile, 'utf-8')).toContain(
+        'return len(store.Keys(*w.Store))'
+      );
+    });
+
+    test('should undo convert_func_to_method', async () => {
+      const original = readFileSync(storeFile, 'utf-8');
+      await performConvertFuncToMethod({
+        filePath: storeFile,
+        symbol: 'Put',
+        parameter: 1,
+      });
+      await performConvertMethodToFunc({
+        filePath: storeFile,
+        symbol: 'Store.Put',
+        parameter: 1,
+      });
+      expect(readFileSync(storeFile, 'utf-8')).toBe(original);
+    });
+
+    test('should reject methods that implement an interface', async () => {
+      await expect(
+        performConvertMethodToFunc({ filePath: storeFile, symbol: 'Store.Len' })
+      ).rejects.toMatchObject({
+        code: 'unsupported_construct',
+        message: `Cannot convert method Store.Len, which Store needs to implement Sizer.Len at ${storeFile}:10:23`,
+      });
+    });
+
+    test('should reject names declared in the package', async () => {
+      writeFileSync(
+        storeFile,
+        readFileSync(storeFile, 'utf-8') + '\nvar Keys = 1\n'
+      );
+      await expect(
+        performConvertMethodToFunc({ filePath: storeFile, symbol: 'Store.Keys' })
+      ).rejects.toMatchObject({
+        code: 'name_conflict',
+        message: `'Keys' is already declared in package store at ${storeFile}:37:5`,
+      });
+    });
+  });
+
+  describe('formatConvertFuncMethodResults', () => {
+    test('should list the call sites and warnings', () => {
+      expect(
+        formatConvertFuncMethodResults({
+          from: 'func Get',
+          to: 'method Store.Get',
+          callSites: ['store.go:3:6'],
+          warnings: ['Get is exported'],
+          changes: [{ filePath: 'store.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Converted func Get to method Store.Get\nUpdated 1 call site:\n  store.go:3:6\nCheck these by hand:\n  Get is exported\n\nModified 1 file:\n  store.go'
+      );
+    });
+  });
+});
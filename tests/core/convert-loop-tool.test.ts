@@ -0,0 +1,260 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performReplaceLoopWithRange,
+  performReplaceRangeWithIndex,
+  formatConvertLoopResults,
+} from '../../src/core/convert-loop-tool.js';
+
+describe('Convert Loop Tool', () => {
+  const testDir = 'tests/temp-convert-loop';
+  const mainFile = `${testDir}/main.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/loop\n\ngo 1.22\n');
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Writes a function with body to main.go, whose loop is on line 6.
+  const write = (body: string) =>
+    writeFileSync(
+      mainFile,
+      `package main
+
+type bag struct{ items []int }
+
+func run(xs []int, b *bag, m map[int]int, arr [3]int, v int) {
+${body}
+}
+`
+    );
+
+  describe('performReplaceLoopWithRange', () => {
+    const testCases = [
+      {
+        name: 'should replace the reads of the element with the value',
+        body: '\tfor i := 0; i < len(xs); i++ {\n\t\tprintln(i, xs[i], v)\n\t}',
+        expected: '\tfor i, v1 := range xs {\n\t\tprintln(i, v1, v)\n\t}',
+      },
+      {
+        name: 'should drop an index that is no longer used',
+        body: '\tfor i := 0; i < len(b.items); i++ {\n\t\tprintln(b.items[i])\n\t}',
+        expected: '\tfor _, v := range b.items {\n\t\tprintln(v)\n\t}',
+      },
+      {
+        name: 'should keep the index when the body changes elements',
+        body: '\tfor i := 0; i < len(xs); i++ {\n\t\txs[i] *= 2\n\t\tprintln(xs[i])\n\t}',
+        expected: '\tfor i := range xs {\n\t\txs[i] *= 2\n\t\tprintln(xs[i])\n\t}',
+      },
+      {
+        name: 'should drop both variables when neither is used',
+        body: '\tfor i := 0; i < len(arr); i++ {\n\t\tprintln()\n\t}',
+        expected: '\tfor range arr {\n\t\tprintln()\n\t}',
+      },
+    ];
+
+    testCases.forEach(({ name, body, expected }) => {
+      test(name, async () => {
+        write(body);
+        await performReplaceLoopWithRange({ filePath: mainFile, line: 6 });
+        expect(readFileSync(mainFile, 'utf-8')).toContain(expected);
+      });
+    });
+
+    test('should use the given value name', async () => {
+      write('\tfor i := 0; i < len(xs); i++ {\n\t\tprintln(xs[i])\n\t}');
+      const result = await performReplaceLoopWithRange({
+        filePath: mainFile,
+        line: 6,
+        name: 'x',
+      });
+      expect(result.to).toBe('for _, x := range xs');
+      expect(readFileSync(mainFile, 'utf-8')).toContain('\t\tprintln(x)\n');
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject bodies that append to the collection',
+        body: '\tfor i := 0; i < len(b.items); i++ {\n\t\tb.items = append(b.items, i)\n\t}',
+        error:
+          'Cannot convert the loop at tests/temp-convert-loop/main.go:6:2: its body assigns b.items, which may change its length during the loop',
+      },
+      {
+        name: 'should reject other steps',
+        body: '\tfor i := 0; i < len(xs); i += 2 {\n\t\tprintln(xs[i])\n\t}',
+        error: 'it steps the index with i += 2 rather than i++',
+      },
+      {
+        name: 'should reject other starts',
+        body: '\tfor i := 1; i < len(xs); i++ {\n\t\tprintln(xs[i])\n\t}',
+        error: 'the index starts at 1 rather than 0',
+      },
+      {
+        name: 'should reject other bounds',
+        body: '\tfor i := 0; i < len(xs)-1; i++ {\n\t\tprintln(xs[i])\n\t}',
+        error: 'its condition i < len(xs)-1 is not i < len(x)',
+      },
+      {
+        name: 'should reject assignments to the index',
+        body: '\tfor i := 0; i < len(xs); i++ {\n\t\tif xs[i] == 0 {\n\t\t\ti++\n\t\t}\n\t}',
+        error: 'its body assigns the index i, which range cannot express',
+      },
+      {
+        name: 'should reject maps',
+        body: '\tfor i := 0; i < len(m); i++ {\n\t\tprintln(m[i])\n\t}',
+        error:
+          'm is a map, whose keys range visits instead of the indexes 0 to len(m)-1',
+      },
+    ];
+
+    errorCases.forEach(({ name, body, error }) => {
+      test(name, async () => {
+        write(body);
+        await expect(
+          performReplaceLoopWithRange({ filePath: mainFile, line: 6 })
+        ).rejects.toThrow(error);
+      });
+    });
+
+    test('should reject range loops', async () => {
+      write('\tfor range xs {\n\t}');
+      await expect(
+        performReplaceLoopWithRange({ filePath: mainFile, line: 6 })
+      ).rejects.toThrow(
+        'The loop at tests/temp-convert-loop/main.go:6:2 is already a range loop'
+      );
+    });
+  });
+
+  describe('performReplaceRangeWithIndex', () => {
+    const testCases = [
+      {
+        name: 'should declare the value at the top of the body',
+        body: '\tfor k, x := range b.items {\n\t\tprintln(k, x)\n\t}',
+        expected:
+          '\tfor k := 0; k < len(b.items); k++ {\n\t\tx := b.items[k]\n\t\tprintln(k, x)\n\t}',
+      },
+      {
+        name: 'should add an index the loop does not name',
+        body: '\tfor _, i := range xs {\n\t\tprintln(i)\n\t}',
+        expected:
+          '\tfor i1 := 0; i1 < len(xs); i1++ {\n\t\ti := xs[i1]\n\t\tprintln(i)\n\t}',
+      },
+      {
+        name: 'should convert ranges without variables',
+        body: '\tfor range arr {\n\t\tprintln()\n\t}',
+        expected: '\tfor i := 0; i < len(arr); i++ {\n\t\tprintln()\n\t}',
+      },
+    ];
+
+    testCases.forEach(({ name, body, expected }) => {
+      test(name, async () => {
+        write(body);
+        await performReplaceRangeWithIndex({ filePath: mainFile, line: 6 });
+        expect(readFileSync(mainFile, 'utf-8')).toContain(expected);
+      });
+    });
+
+    test('should warn about calls that may change array elements', async () => {
+      write(
+        '\tp := &arr\n\tfor _, x := range arr {\n\t\tp[1] = x\n\t\tprintln(x)\n\t}'
+      );
+      const result = await performReplaceRangeWithIndex({
+        filePath: mainFile,
+        line: 7,
+      });
+      expect(result.warnings).toEqual([
+        `${mainFile}:8:3: the write through a pointer may change elements of the array arr, which range copies before the loop starts; x would then see the change`,
+      ]);
+      write(
+        '\tf := func() {}\n\tfor _, x := range arr {\n\t\tf()\n\t\tprintln(x)\n\t}'
+      );
+      const calls = await performReplaceRangeWithIndex({
+        filePath: mainFile,
+        line: 7,
+      });
+      expect(calls.warnings).toEqual([
+        `${mainFile}:8:3: the call may change elements of the array arr, which range copies before the loop starts; x would then see the change`,
+      ]);
+      write('\tfor _, x := range xs {\n\t\tprintln(len(xs), x)\n\t}');
+      const slice = await performReplaceRangeWithIndex({
+        filePath: mainFile,
+        line: 6,
+      });
+      expect(slice.warnings).toEqual([]);
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject arrays whose elements the body changes',
+        body: '\tfor i, x := range arr {\n\t\tarr[i] = x + 1\n\t}',
+        error:
+          'its body changes elements of the array arr, which range copies before the loop starts',
+      },
+      {
+        name: 'should reject bodies assigning the key',
+        body: '\tfor i := range xs {\n\t\ti++\n\t}',
+        error:
+          'its body assigns the key i, which would change the index of the loop',
+      },
+      {
+        name: 'should reject ranges assigning outer variables',
+        body: '\tfor _, v = range xs {\n\t}\n\tprintln(v)',
+        error:
+          'it assigns variables declared outside of it, which end with other values after an index loop',
+      },
+      {
+        name: 'should reject strings',
+        body: '\tfor _, r := range "abc" {\n\t\tprintln(r)\n\t}',
+        error: '"abc" is a string, whose runes range visits instead of its bytes',
+      },
+      {
+        name: 'should reject collections evaluated once',
+        body: '\tfor _, x := range append(xs, 1) {\n\t\tprintln(x)\n\t}',
+        error:
+          'range evaluates append(xs, 1) once, and an index loop evaluates it on each iteration',
+      },
+    ];
+
+    errorCases.forEach(({ name, body, error }) => {
+      test(name, async () => {
+        write(body);
+        await expect(
+          performReplaceRangeWithIndex({ filePath: mainFile, line: 6 })
+        ).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatConvertLoopResults', () => {
+    test('should report both headers and the modified file', () => {
+      expect(
+        formatConvertLoopResults({
+          location: 'main.go:6:2',
+          from: 'for i := 0; i < len(xs); i++',
+          to: 'for i := range xs',
+          warnings: [],
+          changes: [{ filePath: 'main.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Replaced 'for i := 0; i < len(xs); i++' with 'for i := range xs' at main.go:6:2\n\nModified 1 file:\n  main.go"
+      );
+    });
+  });
+});
@@ -0,0 +1,216 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performConvertNamedReturns,
+  formatConvertNamedReturnsResults,
+} from '../../src/core/convert-named-returns-tool.js';
+import type {
+  NamedReturnsMode,
+} from '../../src/core/convert-named-returns-tool.js';
+
+describe('Convert Named Returns Tool', () => {
+  const testDir = 'tests/temp-convert-named-returns';
+  const userFile = `${testDir}/user.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/user\n\ngo 1.22\n');
+    writeFileSync(
+      userFile,
+      `package user
+
+import "errors"
+
+type User struct{ Name string }
+
+func Find(id int) (*User, error) {
+	if id < 0 {
+		return nil, errors.New("negative")
+	}
+	return &User{}, nil
+}
+
+func Pair(n int) (int, int) { return n, n }
+
+func Name(u User) string { return u.Name }
+
+func Split(s string) (head, tail string, err error) {
+	if s == "" {
+		err = errors.New("empty")
+		return
+	}
+	head, tail = s[:1], s[1:]
+	return
+}
+
+func Count() (n int, ok bool) { ok = true; return }
+
+func Safe() (err error) {
+	defer func() {
+		if recover() != nil {
+			err = errors.New("panic")
+		}
+	}()
+	return
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Locates the function declared on the first line starting with prefix.
+  const convert = (
+    prefix: string,
+    mode: NamedReturnsMode,
+    names?: string[]
+  ) => {
+    const lines = readFileSync(userFile, 'utf-8').split('\n');
+    const line = lines.findIndex(l => l.startsWith(prefix)) + 1;
+    return performConvertNamedReturns({
+      filePath: userFile,
+      line,
+      column: 6,
+      mode,
+      names,
+    });
+  };
+
+  describe('performConvertNamedReturns', () => {
+    test('should derive names from the result types', async () => {
+      const result = await convert('func Find', 'name');
+      expect(result.names).toEqual(['user', 'err']);
+      expect(readFileSync(userFile, 'utf-8')).toContain(
+        'func Find(id int) (user *User, err error) {\n\tif id < 0 {\n\t\treturn nil, errors.New("negative")'
+      );
+    });
+
+    test('should number names that are shared or taken', async () => {
+      const result = await convert('func Pair', 'name');
+      expect(result.names).toEqual(['n1', 'n2']);
+      await convert('func Name', 'name');
+      const content = readFileSync(userFile, 'utf-8');
+      expect(content).toContain('func Pair(n int) (n1 int, n2 int) {');
+      expect(content).toContain('func Name(u User) (s string) {');
+    });
+
+    test('should use the given names', async () => {
+      await convert('func Find', 'name', ['found', 'err']);
+      expect(readFileSync(userFile, 'utf-8')).toContain(
+        'func Find(id int) (found *User, err error) {'
+      );
+    });
+
+    test('should make naked returns return the result variables', async () => {
+      const result = await convert('func Split', 'unname');
+      expect(result.returns).toBe(2);
+      expect(result.locals).toEqual(['head', 'tail', 'err']);
+      expect(readFileSync(userFile, 'utf-8')).toContain(
+        `func Split(s string) (string, string, error) {
+	var head string
+	var tail string
+	var err error
+	if s == "" {
+		err = errors.New("empty")
+		return head, tail, err
+	}
+	head, tail = s[:1], s[1:]
+	return head, tail, err
+}`
+      );
+    });
+
+    test('should return zero values for unused results', async () => {
+      const result = await convert('func Count', 'unname');
+      expect(result.locals).toEqual(['ok']);
+      expect(readFileSync(userFile, 'utf-8')).toContain(
+        'func Count() (int, bool) { var ok bool; ok = true; return 0, ok }'
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject results a deferred call may change',
+        prefix: 'func Safe',
+        mode: 'unname' as const,
+        error:
+          "Cannot remove the result names of func Safe: the deferred call at tests/temp-convert-named-returns/user.go:30:2 may change 'err' after it is returned",
+      },
+      {
+        name: 'should reject names of parameters',
+        prefix: 'func Find',
+        mode: 'name' as const,
+        names: ['id', 'err'],
+        error:
+          "'id' is already declared in func Find at tests/temp-convert-named-returns/user.go:7:11",
+      },
+      {
+        name: 'should reject names hiding what the body uses',
+        prefix: 'func Find',
+        mode: 'name' as const,
+        names: ['u', 'errors'],
+        error:
+          "A result named 'errors' would hide the package used at tests/temp-convert-named-returns/user.go:9:15",
+      },
+      {
+        name: 'should reject a name for each result',
+        prefix: 'func Find',
+        mode: 'name' as const,
+        names: ['u'],
+        error: 'Expected 2 names, one for each result of func Find, got 1',
+      },
+      {
+        name: 'should reject named results when naming',
+        prefix: 'func Split',
+        mode: 'name' as const,
+        error: 'The results of func Split are already named',
+      },
+      {
+        name: 'should reject unnamed results when unnaming',
+        prefix: 'func Find',
+        mode: 'unname' as const,
+        error: 'The results of func Find are not named',
+      },
+    ];
+
+    errorCases.forEach(({ name, prefix, mode, names, error }) => {
+      test(name, async () => {
+        const original = readFileSync(userFile, 'utf-8');
+        await expect(convert(prefix, mode, names)).rejects.toThrow(error);
+        expect(readFileSync(userFile, 'utf-8')).toBe(original);
+      });
+    });
+  });
+
+  describe('formatConvertNamedReturnsResults', () => {
+    test('should report the rewritten returns and the locals', () => {
+      expect(
+        formatConvertNamedReturnsResults({
+          functionName: 'func Split',
+          mode: 'unname',
+          names: ['head', 'err'],
+          returns: 2,
+          locals: ['err'],
+          changes: [{ filePath: 'user.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Removed the result names head, err of func Split, giving 2 naked returns the result values\nDeclared as local variables: err\n\nModified 1 file:\n  user.go'
+      );
+    });
+  });
+});
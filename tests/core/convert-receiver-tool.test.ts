@@ -0,0 +1,246 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performConvertReceiver,
+  formatConvertReceiverResults,
+} from '../../src/core/convert-receiver-tool.js';
+
+describe('Convert Receiver Tool', () => {
+  const testDir = 'tests/temp-convert-receiver';
+  const counterFile = `${testDir}/counter/counter.go`;
+  const appFile = `${testDir}/app/app.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/counter`, { recursive: true });
+    mkdirSync(`${testDir}/app`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/recv\n\ngo 1.22\n');
+    writeFileSync(
+      counterFile,
+      `package counter
+
+import "sync"
+
+type Counter struct {
+	name string
+	n    int
+}
+
+func (c Counter) Name() string { return c.name }
+
+func (c *Counter) Inc() { c.n++ }
+
+func (c Counter) Renamed(name string) Counter {
+	c.name = name
+	return c
+}
+
+type Point struct {
+	X, Y int
+}
+
+func (p *Point) Len() int { return p.X*p.X + p.Y*p.Y }
+
+func (p *Point) Copy() Point { return *p }
+
+func (p Point) Add(q Point) Point { return Point{p.X + q.X, p.Y + q.Y} }
+
+type guarded struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (g *guarded) get() int { return g.n }
+`
+    );
+    writeFileSync(
+      appFile,
+      `package app
+
+import "example.com/recv/counter"
+
+func Names(cs []counter.Counter) []string {
+	var out []string
+	for _, c := range cs {
+		out = append(out, c.Name())
+	}
+	return append(out, counter.Counter.Name(cs[0]), counter.Counter{}.Name())
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  const convert = (typeName: string, receiver: 'pointer' | 'value') =>
+    performConvertReceiver({ filePath: counterFile, typeName, receiver });
+
+  describe('performConvertReceiver', () => {
+    test('should convert methods to pointer receivers', async () => {
+      const result = await convert('Counter', 'pointer');
+      expect(result.converted).toEqual(['Name', 'Renamed']);
+      const content = readFileSync(counterFile, 'utf-8');
+      expect(content).toContain('func (c *Counter) Name() string');
+      expect(content).toContain(
+        'func (c *Counter) Renamed(name string) Counter {\n\tc.name = name\n\treturn *c\n}'
+      );
+      expect(content).toContain('func (c *Counter) Inc()');
+    });
+
+    test('should update calls that need an addressable value', async () => {
+      const result = await convert('Counter', 'pointer');
+      expect(result.callSites).toBe(2);
+      const content = readFileSync(appFile, 'utf-8');
+      expect(content).toContain('(*counter.Counter).Name(&cs[0])');
+      expect(content).toContain('(&counter.Counter{}).Name()');
+      expect(content).toContain('out = append(out, c.Name())');
+    });
+
+    test('should warn about methods that modify their receiver', async () => {
+      const result = await convert('Counter', 'pointer');
+      expect(result.warnings).toEqual([
+        "tests/temp-convert-receiver/counter/counter.go:15:2: Counter.Renamed modifies its receiver, which now changes the caller's value",
+        'Counter is exported, so code outside the module that uses Counter values as interfaces or calls the methods on unaddressable values may break',
+      ]);
+    });
+
+    test('should convert methods to value receivers', async () => {
+      const result = await convert('Point', 'value');
+      expect(result.converted).toEqual(['Len', 'Copy']);
+      const content = readFileSync(counterFile, 'utf-8');
+      expect(content).toContain('func (p Point) Len() int');
+      expect(content).toContain('func (p Point) Copy() Point { return p }');
+    });
+
+    test('should warn about locks copied by value receivers', async () => {
+      const result = await convert('guarded', 'value');
+      expect(result.warnings).toEqual([
+        'guarded has the field mu of type sync.Mutex, which value receivers copy',
+      ]);
+    });
+
+    test('should leave types whose methods already match', async () => {
+      await convert('Point', 'value');
+      const result = await convert('Point', 'value');
+      expect(result.changes).toEqual([]);
+      expect(formatConvertReceiverResults(result)).toBe(
+        "All methods of 'Point' already have value receivers"
+      );
+    });
+
+    test('should reject values used where the methods are needed', async () => {
+      writeFileSync(
+        `${testDir}/app/namer.go`,
+        `package app
+
+import "example.com/recv/counter"
+
+type namer interface{ Name() string }
+
+var _ namer = counter.Counter{}
+`
+      );
+      await expect(convert('Counter', 'pointer')).rejects.toMatchObject({
+        code: 'unsupported_construct',
+        message:
+          'A counter.Counter value is used as namer here, which needs its method Name; with a pointer receiver only *counter.Counter has it',
+        location: {
+          filePath: `${testDir}/app/namer.go`,
+          line: 7,
+          column: 15,
+        },
+      });
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject calls on map values',
+        src: 'func first(m map[string]counter.Counter) string {\n\treturn m["a"].Name()\n}\n',
+        typeName: 'Counter',
+        receiver: 'pointer' as const,
+        error:
+          'Cannot take the address of m["a"] to call Name once it has a pointer receiver',
+      },
+      {
+        name: 'should reject method expressions used as values',
+        src: 'var name = counter.Counter.Name\n',
+        typeName: 'Counter',
+        receiver: 'pointer' as const,
+        error:
+          'The method expression counter.Counter.Name would take a pointer once Name has a pointer receiver',
+      },
+      {
+        name: 'should reject methods that modify the receiver',
+        typeName: 'Counter',
+        receiver: 'value' as const,
+        error:
+          'Counter.Inc modifies its receiver, so with a value receiver it would only modify a copy',
+      },
+      {
+        name: 'should reject methods that use the receiver as a pointer',
+        extra: '\nfunc (p *Point) Self() *Point { return p }\n',
+        typeName: 'Point',
+        receiver: 'value' as const,
+        error:
+          'Point.Self uses its receiver p as a pointer, which a value receiver is not',
+      },
+      {
+        name: 'should reject unknown types',
+        typeName: 'Missing',
+        receiver: 'pointer' as const,
+        error: "'Missing' is not a type declared in package counter",
+      },
+    ];
+
+    errorCases.forEach(({ name, src, extra, typeName, receiver, error }) => {
+      test(name, async () => {
+        if (src) {
+          writeFileSync(
+            `${testDir}/app/extra.go`,
+            `package app\n\nimport "example.com/recv/counter"\n\n${src}`
+          );
+        }
+        if (extra) {
+          writeFileSync(
+            counterFile,
+            readFileSync(counterFile, 'utf-8') + extra
+          );
+        }
+        const original = readFileSync(counterFile, 'utf-8');
+        await expect(convert(typeName, receiver)).rejects.toThrow(error);
+        expect(readFileSync(counterFile, 'utf-8')).toBe(original);
+      });
+    });
+  });
+
+  describe('formatConvertReceiverResults', () => {
+    test('should list the converted methods and warnings', () => {
+      expect(
+        formatConvertReceiverResults({
+          typeName: 'Counter',
+          receiver: 'pointer',
+          converted: ['Name'],
+          callSites: 1,
+          warnings: ['counter.go:3:2: Counter.Name modifies its receiver'],
+          changes: [{ filePath: 'counter.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Converted 1 method of 'Counter' to pointer receivers: Name\nUpdated 1 call site\nCheck these by hand:\n  counter.go:3:2: Counter.Name modifies its receiver\n\nModified 1 file:\n  counter.go"
+      );
+    });
+  });
+});
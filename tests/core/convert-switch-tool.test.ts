@@ -0,0 +1,278 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performConvertIfElseToSwitch,
+  performConvertSwitchToIfElse,
+  formatConvertSwitchResults,
+} from '../../src/core/convert-switch-tool.js';
+
+describe('Convert Switch Tool', () => {
+  const testDir = 'tests/temp-convert-switch';
+  const mainFile = `${testDir}/main.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/sw\n\ngo 1.22\n');
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Writes a function with body to main.go, whose statement is on line 6.
+  const write = (body: string) =>
+    writeFileSync(
+      mainFile,
+      `package main
+
+const two = 2
+
+func run(x int, s string, xs []int, f func() int) {
+${body}
+}
+`
+    );
+
+  describe('performConvertIfElseToSwitch', () => {
+    const testCases = [
+      {
+        name: 'should turn the final else into the default',
+        body: '\tif x == 1 {\n\t\tprintln(1)\n\t} else if x == two {\n\t\tprintln(2)\n\t} else {\n\t\tprintln(0)\n\t}',
+        expected:
+          '\tswitch x {\n\tcase 1:\n\t\tprintln(1)\n\tcase two:\n\t\tprintln(2)\n\tdefault:\n\t\tprintln(0)\n\t}\n',
+      },
+      {
+        name: 'should join the constants of disjunctions in one case',
+        body: '\tif s == "a" || "b" == s {\n\t\tprintln(1)\n\t} else if s == "c" {\n\t}',
+        expected:
+          '\tswitch s {\n\tcase "a", "b":\n\t\tprintln(1)\n\tcase "c":\n\t}\n',
+      },
+      {
+        name: 'should keep the init statement of the first if',
+        body: '\tif y := x * 2; y == 2 {\n\t\tprintln(y)\n\t}',
+        expected: '\tswitch y := x * 2; y {\n\tcase 2:\n\t\tprintln(y)\n\t}\n',
+      },
+      {
+        name: 'should keep comments at the start of bodies',
+        body: '\tif x == 1 { // one\n\t\tprintln(1)\n\t} else if x == 2 {\n\t\t// two\n\t\tprintln(2)\n\t}',
+        expected:
+          '\tswitch x {\n\tcase 1: // one\n\t\tprintln(1)\n\tcase 2:\n\t\t// two\n\t\tprintln(2)\n\t}\n',
+      },
+    ];
+
+    testCases.forEach(({ name, body, expected }) => {
+      test(name, async () => {
+        write(body);
+        await performConvertIfElseToSwitch({ filePath: mainFile, line: 6 });
+        expect(readFileSync(mainFile, 'utf-8')).toContain(expected);
+      });
+    });
+
+    test('should convert the whole chain from any of its ifs', async () => {
+      write('\tif x == 1 {\n\t\tprintln(1)\n\t} else if x == 2 {\n\t\tprintln(2)\n\t}');
+      const result = await performConvertIfElseToSwitch({
+        filePath: mainFile,
+        line: 8,
+      });
+      expect(result.location).toBe('tests/temp-convert-switch/main.go:6:2');
+      expect(result.cases).toBe(2);
+      expect(readFileSync(mainFile, 'utf-8')).toContain('\tswitch x {\n');
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject other operators',
+        body: '\tif x == 1 {\n\t} else if x > 1 {\n\t}',
+        error:
+          'Cannot convert the if at tests/temp-convert-switch/main.go:6:2: its condition x > 1 is not a comparison with == of x and constants, joined by ||',
+      },
+      {
+        name: 'should reject comparisons of other expressions',
+        body: '\tif x == 1 {\n\t} else if len(s) == 2 {\n\t}',
+        error: 'len(s) == 2 compares len(s) rather than x',
+      },
+      {
+        name: 'should reject comparisons without constants',
+        body: '\tif x == xs[0] {\n\t}',
+        error: 'x == xs[0] does not compare an expression with a constant',
+      },
+      {
+        name: 'should reject expressions with effects',
+        body: '\tif f() == 1 {\n\t} else if f() == 2 {\n\t}',
+        error:
+          'f() may have effects, and a switch would evaluate it once rather than in each condition',
+      },
+      {
+        name: 'should reject duplicate constants',
+        body: '\tif x == 2 {\n\t} else if x == two {\n\t}',
+        error:
+          'two has the value of 2 at tests/temp-convert-switch/main.go:6:10, and a switch cannot have duplicate cases',
+      },
+      {
+        name: 'should reject init statements of else ifs',
+        body: '\tif x == 1 {\n\t} else if y := 2; x == y {\n\t}',
+        error:
+          'the else if at tests/temp-convert-switch/main.go:7:9 has an init statement, which a case cannot have',
+      },
+      {
+        name: 'should reject breaks out of an enclosing loop',
+        body: '\tfor {\n\t\tif x == 1 {\n\t\t\tbreak\n\t\t}\n\t}',
+        error:
+          'the break at tests/temp-convert-switch/main.go:8:4 leaves the enclosing loop, and would leave the switch instead',
+        line: 7,
+      },
+    ];
+
+    errorCases.forEach(({ name, body, error, line = 6 }) => {
+      test(name, async () => {
+        write(body);
+        await expect(
+          performConvertIfElseToSwitch({ filePath: mainFile, line })
+        ).rejects.toThrow(error);
+      });
+    });
+
+    test('should accept breaks of loops inside the bodies', async () => {
+      write('\tif x == 1 {\n\t\tfor {\n\t\t\tbreak\n\t\t}\n\t}');
+      await performConvertIfElseToSwitch({ filePath: mainFile, line: 6 });
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        '\tswitch x {\n\tcase 1:\n\t\tfor {\n\t\t\tbreak\n\t\t}\n\t}\n'
+      );
+    });
+  });
+
+  describe('performConvertSwitchToIfElse', () => {
+    const testCases = [
+      {
+        name: 'should compare the tag with the values of each case',
+        body: '\tswitch x {\n\tcase 1, two:\n\t\tprintln(1)\n\tcase 3:\n\t\tprintln(3)\n\t}',
+        expected:
+          '\tif x == 1 || x == two {\n\t\tprintln(1)\n\t} else if x == 3 {\n\t\tprintln(3)\n\t}\n',
+      },
+      {
+        name: 'should move the default to the final else',
+        body: '\tswitch x {\n\tdefault:\n\t\tprintln(0)\n\tcase 1:\n\t}',
+        expected: '\tif x == 1 {\n\t} else {\n\t\tprintln(0)\n\t}\n',
+      },
+      {
+        name: 'should drop an empty default',
+        body: '\tswitch x {\n\tcase 1:\n\t\tprintln(1)\n\tdefault:\n\t}',
+        expected: '\tif x == 1 {\n\t\tprintln(1)\n\t}\n}',
+      },
+      {
+        name: 'should use the cases of switches without a tag as conditions',
+        body: '\tswitch y := x + 1; {\n\tcase y > 1 && y < 3, y == 0:\n\t\tprintln(y)\n\t}',
+        expected:
+          '\tif y := x + 1; y > 1 && y < 3 || y == 0 {\n\t\tprintln(y)\n\t}\n',
+      },
+      {
+        name: 'should parenthesize comparisons in values',
+        body: '\tok := x > 0\n\tswitch ok {\n\tcase x < 2:\n\t\tprintln(ok)\n\t}',
+        expected: '\tif ok == (x < 2) {\n\t\tprintln(ok)\n\t}\n',
+        line: 7,
+      },
+    ];
+
+    testCases.forEach(({ name, body, expected, line = 6 }) => {
+      test(name, async () => {
+        write(body);
+        await performConvertSwitchToIfElse({ filePath: mainFile, line });
+        expect(readFileSync(mainFile, 'utf-8')).toContain(expected);
+      });
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject fallthrough',
+        body: '\tswitch x {\n\tcase 1:\n\t\tfallthrough\n\tcase 2:\n\t}',
+        error:
+          'Cannot convert the switch at tests/temp-convert-switch/main.go:6:2: the case at tests/temp-convert-switch/main.go:7:2 falls through, which an if/else chain cannot express',
+      },
+      {
+        name: 'should reject breaks out of the switch',
+        body: '\tswitch x {\n\tcase 1:\n\t\tif s == "" {\n\t\t\tbreak\n\t\t}\n\t}',
+        error:
+          'the break at tests/temp-convert-switch/main.go:9:4 leaves the switch, and would leave the enclosing loop instead',
+      },
+      {
+        name: 'should reject tags with effects',
+        body: '\tswitch f() {\n\tcase 1:\n\t}',
+        error:
+          'its tag f() may have effects, and an if/else chain would evaluate it in each condition',
+      },
+      {
+        name: 'should reject labeled switches',
+        body: '\tL:\n\tswitch x {\n\tcase 1:\n\t\tbreak L\n\t}',
+        error: 'it has the label L, which an if cannot be the target of',
+        line: 7,
+      },
+      {
+        name: 'should reject switches without cases',
+        body: '\tswitch x {\n\tdefault:\n\t}',
+        error: 'it has no case to write as a condition',
+      },
+    ];
+
+    errorCases.forEach(({ name, body, error, line = 6 }) => {
+      test(name, async () => {
+        write(body);
+        await expect(
+          performConvertSwitchToIfElse({ filePath: mainFile, line })
+        ).rejects.toThrow(error);
+      });
+    });
+
+    test('should reject type switches', async () => {
+      write('\tvar v any = x\n\tswitch v.(type) {\n\t}');
+      await expect(
+        performConvertSwitchToIfElse({ filePath: mainFile, line: 7 })
+      ).rejects.toThrow(
+        'it is a type switch, whose cases match types rather than values'
+      );
+    });
+  });
+
+  describe('formatConvertSwitchResults', () => {
+    test('should report the cases and the modified file', () => {
+      expect(
+        formatConvertSwitchResults({
+          location: 'main.go:6:2',
+          to: 'switch',
+          tag: 'x',
+          cases: 2,
+          hasDefault: true,
+          changes: [{ filePath: 'main.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Converted the if/else chain at main.go:6:2 into a switch on x with 2 cases and a default\n\nModified 1 file:\n  main.go'
+      );
+    });
+
+    test('should report the conditions of the chain', () => {
+      expect(
+        formatConvertSwitchResults({
+          location: 'main.go:6:2',
+          to: 'if',
+          cases: 1,
+          hasDefault: false,
+          changes: [],
+          dryRun: true,
+        })
+      ).toContain(
+        'Converted the switch at main.go:6:2 into an if/else chain of 1 condition\n'
+      );
+    });
+  });
+});
@@ -0,0 +1,363 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performDeduplicateFunctions,
+  formatDeduplicateFunctionsResults,
+} from '../../src/core/deduplicate-functions-tool.js';
+
+describe('Deduplicate Functions Tool', () => {
+  const testDir = 'tests/temp-deduplicate-functions';
+  const utilFile = `${testDir}/util/util.go`;
+  const reportFile = `${testDir}/report/report.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/util`, { recursive: true });
+    mkdirSync(`${testDir}/report`, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/dd\n\ngo 1.22\n');
+    writeFileSync(
+      utilFile,
+      `package util
+
+import "strings"
+
+func Sum(xs []int) int {
+	total := 0
+	for _, x := range xs {
+		total += x
+	}
+	return total
+}
+
+func clean(s string) string {
+	t := strings.TrimSpace(s)
+	return strings.ToLower(t)
+}
+
+func normalize(in string) string {
+	// Comments do not count.
+	out := strings.TrimSpace(in)
+
+	return strings.ToLower(out)
+}
+
+func Use() string { return normalize("a") + clean("b") }
+`
+    );
+    writeFileSync(
+      reportFile,
+      `package report
+
+type Report struct{ Values []int }
+
+func sum(values []int) int {
+	n := 0
+	for _, v := range values {
+		n += v
+	}
+	return n
+}
+
+func Total(r Report) int { return sum(r.Values) }
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performDeduplicateFunctions', () => {
+    test('should find functions differing in the names of locals', async () => {
+      const result = await performDeduplicateFunctions({ filePath: utilFile });
+      expect(result.functions).toBe(4);
+      expect(result.groups).toEqual([
+        {
+          functions: [
+            {
+              name: 'clean',
+              location: 'tests/temp-deduplicate-functions/util/util.go:13:6',
+              references: 1,
+            },
+            {
+              name: 'normalize',
+              location: 'tests/temp-deduplicate-functions/util/util.go:18:6',
+              references: 1,
+            },
+          ],
+          keep: 'clean',
+          reason: undefined,
+          differing: [],
+          merged: false,
+        },
+      ]);
+      expect(result.changes).toEqual([]);
+    });
+
+    test('should merge a group into the function kept', async () => {
+      const result = await performDeduplicateFunctions({
+        filePath: utilFile,
+        merge: true,
+        keep: ['normalize'],
+      });
+      expect(result.groups[0].merged).toBe(true);
+      expect(result.references).toBe(1);
+      const src = readFileSync(utilFile, 'utf-8');
+      expect(src).not.toContain('func clean(');
+      expect(src).toContain(
+        'func Use() string { return normalize("a") + normalize("b") }'
+      );
+    });
+
+    test('should merge across packages, adding an import', async () => {
+      const result = await performDeduplicateFunctions({
+        filePath: reportFile,
+        scope: 'module',
+        merge: true,
+      });
+      expect(result.groups.map(g => g.keep)).toEqual(['Sum', 'clean']);
+      expect(readFileSync(reportFile, 'utf-8')).toBe(`package report
+
+import "example.com/dd/util"
+
+type Report struct{ Values []int }
+
+func Total(r Report) int { return util.Sum(r.Values) }
+`);
+    });
+
+    test('should only look for duplicates in the package by default', async () => {
+      const result = await performDeduplicateFunctions({
+        filePath: reportFile,
+      });
+      expect(result.functions).toBe(2);
+      expect(result.groups).toEqual([]);
+    });
+
+    test('should not merge away exported functions unless forced', async () => {
+      writeFileSync(
+        `${testDir}/report/copy.go`,
+        'package report\n\nfunc Add(xs []int) int {\n\ttotal := 0\n\tfor _, x := range xs {\n\t\ttotal += x\n\t}\n\treturn total\n}\n'
+      );
+      const result = await performDeduplicateFunctions({
+        filePath: reportFile,
+        merge: true,
+        keep: ['sum'],
+      });
+      expect(result.groups[0].reason).toBe(
+        'Add is exported, so code outside the module may use it; set force to merge it anyway'
+      );
+      expect(result.changes).toEqual([]);
+      const forced = await performDeduplicateFunctions({
+        filePath: reportFile,
+        merge: true,
+        keep: ['sum'],
+        force: true,
+      });
+      expect(forced.groups[0].merged).toBe(true);
+      expect(readFileSync(`${testDir}/report/copy.go`, 'utf-8')).toBe(
+        'package report\n'
+      );
+    });
+
+    test('should leave alone functions with another signature', async () => {
+      writeFileSync(
+        `${testDir}/util/more.go`,
+        'package util\n\nfunc total(xs []int8) int8 {\n\tt := int8(0)\n\treturn t\n}\n\nfunc first(xs []int8) int8 {\n\tt := int8(0)\n\treturn t\n}\n\nfunc once(xs ...int8) int8 {\n\tt := int8(0)\n\treturn t\n}\n'
+      );
+      const result = await performDeduplicateFunctions({ filePath: utilFile });
+      const group = result.groups.find(g => g.keep === 'total')!;
+      expect(group.functions.map(f => f.name)).toEqual([
+        'total',
+        'first',
+        'once',
+      ]);
+      expect(group.differing).toEqual(['once(xs ...int8) int8']);
+    });
+
+    test('should report groups whose signatures all differ', async () => {
+      writeFileSync(
+        `${testDir}/util/more.go`,
+        'package util\n\nfunc a(x int) int { return 1 }\n\nfunc b(x string) int { return 1 }\n'
+      );
+      const result = await performDeduplicateFunctions({ filePath: utilFile });
+      expect(result.groups[0].reason).toBe(
+        'their signatures differ: a(x int) int; b(x string) int'
+      );
+    });
+
+    test('should match recursive functions calling themselves', async () => {
+      writeFileSync(
+        `${testDir}/util/more.go`,
+        'package util\n\nfunc fact(n int) int {\n\tif n == 0 {\n\t\treturn 1\n\t}\n\treturn n * fact(n-1)\n}\n\nfunc factorial(k int) int {\n\tif k == 0 {\n\t\treturn 1\n\t}\n\treturn k * factorial(k-1)\n}\n\nfunc mixed(k int) int {\n\tif k == 0 {\n\t\treturn 1\n\t}\n\treturn k * fact(k-1)\n}\n'
+      );
+      const result = await performDeduplicateFunctions({ filePath: utilFile });
+      expect(result.groups[0].functions.map(f => f.name)).toEqual([
+        'fact',
+        'factorial',
+      ]);
+    });
+
+    test('should tell apart bodies using other declarations', async () => {
+      writeFileSync(
+        `${testDir}/util/more.go`,
+        'package util\n\nvar x, y = 1, 2\n\nfunc getX() int { return x }\n\nfunc getY() int { return y }\n'
+      );
+      const result = await performDeduplicateFunctions({ filePath: utilFile });
+      expect(result.groups).toHaveLength(1);
+    });
+
+    test('should report methods without merging them', async () => {
+      writeFileSync(
+        `${testDir}/util/more.go`,
+        'package util\n\ntype A struct{}\n\ntype B struct{}\n\nfunc (A) Name() string { return "n" }\n\nfunc (*B) Name() string { return "n" }\n'
+      );
+      const result = await performDeduplicateFunctions({
+        filePath: utilFile,
+        merge: true,
+        keep: ['clean'],
+      });
+      expect(result.groups[0].functions.map(f => f.name)).toEqual([
+        'A.Name',
+        'B.Name',
+      ]);
+      expect(result.groups[0].reason).toBe(
+        'they are methods of the receiver types A, *B, which select them'
+      );
+    });
+
+    test('should not merge into a name hidden at a reference', async () => {
+      writeFileSync(
+        `${testDir}/util/more.go`,
+        'package util\n\nfunc run() string {\n\tclean := 1\n\t_ = clean\n\treturn normalize("c")\n}\n'
+      );
+      const result = await performDeduplicateFunctions({
+        filePath: utilFile,
+        merge: true,
+      });
+      expect(result.groups[0].keep).toBe('normalize');
+      expect(readFileSync(utilFile, 'utf-8')).not.toContain('func clean(');
+    });
+
+    test('should not merge into a package that would import its user', async () => {
+      writeFileSync(
+        `${testDir}/util/use.go`,
+        'package util\n\nimport "example.com/dd/report"\n\nvar _ = report.Total\n'
+      );
+      const result = await performDeduplicateFunctions({
+        filePath: reportFile,
+        scope: 'module',
+        merge: true,
+        keep: ['util.Sum'],
+      });
+      expect(result.groups[0].reason).toBe(
+        'example.com/dd/util imports example.com/dd/report, so tests/temp-deduplicate-functions/report/report.go:13:35 cannot refer to Sum without an import cycle'
+      );
+      expect(result.groups[0].merged).toBe(false);
+    });
+
+    test('should reject names to keep that are not duplicates', async () => {
+      await expect(
+        performDeduplicateFunctions({ filePath: utilFile, keep: ['Use'] })
+      ).rejects.toThrow("'Use' is not one of the duplicate functions found");
+    });
+
+    test('should not modify files in dry run mode', async () => {
+      const original = readFileSync(utilFile, 'utf-8');
+      const result = await performDeduplicateFunctions({
+        filePath: utilFile,
+        merge: true,
+        dryRun: true,
+      });
+      expect(result.changes).toHaveLength(1);
+      expect(readFileSync(utilFile, 'utf-8')).toBe(original);
+    });
+  });
+
+  describe('formatDeduplicateFunctionsResults', () => {
+    test('should report the groups and how they can be merged', () => {
+      expect(
+        formatDeduplicateFunctionsResults({
+          scope: 'module',
+          functions: 5,
+          groups: [
+            {
+              functions: [
+                { name: 'Sum', location: 'util.go:3:6', references: 0 },
+                { name: 'sum', location: 'report.go:5:6', references: 1 },
+              ],
+              keep: 'Sum',
+              differing: ['add(xs ...int) int'],
+              merged: false,
+            },
+            {
+              functions: [
+                { name: 'A.Name', location: 'a.go:3:9', references: 2 },
+                { name: 'B.Name', location: 'b.go:3:9', references: 0 },
+              ],
+              reason: 'they are methods of the receiver types A, B',
+              differing: [],
+              merged: false,
+            },
+          ],
+          references: 0,
+          warnings: [],
+          changes: [],
+          dryRun: false,
+        })
+      ).toBe(
+        'Found 2 groups of duplicate functions among the 5 functions of the module:\n1.\n  Sum (util.go:3:6, 0 references)\n  sum (report.go:5:6, 1 reference)\n  Left alone, with another signature: add(xs ...int) int\n  Can be merged into Sum; set merge to do so\n2.\n  A.Name (a.go:3:9, 2 references)\n  B.Name (b.go:3:9, 0 references)\n  Not merged: they are methods of the receiver types A, B'
+      );
+    });
+
+    test('should report the merged groups and the changes', () => {
+      expect(
+        formatDeduplicateFunctionsResults({
+          scope: 'package',
+          functions: 2,
+          groups: [
+            {
+              functions: [
+                { name: 'a', location: 'a.go:3:6', references: 1 },
+                { name: 'b', location: 'a.go:5:6', references: 1 },
+              ],
+              keep: 'a',
+              differing: [],
+              merged: true,
+            },
+          ],
+          references: 1,
+          warnings: [],
+          changes: [{ filePath: 'a.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Found 1 group of duplicate functions among the 2 functions of the package:\n1.\n  a (a.go:3:6, 1 reference)\n  b (a.go:5:6, 1 reference)\n  Merged into a\nReplaced 1 reference to the merged duplicates\n\nModified 1 file:\n  a.go'
+      );
+    });
+
+    test('should report packages without duplicates', () => {
+      expect(
+        formatDeduplicateFunctionsResults({
+          scope: 'package',
+          functions: 1,
+          groups: [],
+          references: 0,
+          warnings: [],
+          changes: [],
+          dryRun: false,
+        })
+      ).toBe('No duplicate functions among the 1 function of the package');
+    });
+  });
+});
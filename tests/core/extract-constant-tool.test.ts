@@ -0,0 +1,237 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performExtractConstant,
+  formatExtractConstantResults,
+} from '../../src/core/extract-constant-tool.js';
+import type { ConstantScope } from '../../src/core/extract-constant-tool.js';
+
+describe('Extract Constant Tool', () => {
+  const testDir = 'tests/temp-extract-constant';
+  const retryFile = `${testDir}/retry.go`;
+  const waitFile = `${testDir}/wait.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/retry\n\ngo 1.22\n');
+    writeFileSync(
+      retryFile,
+      `package retry
+
+import "time"
+
+type Config struct {
+	Attempts int \`json:"3"\`
+	Delay    time.Duration
+}
+
+// Retry calls do until it succeeds.
+func Retry(do func() error) (err error) {
+	for i := 0; i < 3; i++ {
+		if err = do(); err == nil || i == 0x3-1 {
+			return err
+		}
+		time.Sleep(3 * time.Millisecond)
+	}
+	return err
+}
+`
+    );
+    writeFileSync(
+      waitFile,
+      `package retry
+
+var delays = [3]float64{3.0, 3}
+
+func wait(n int) bool { return n > 3 }
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  const extract = (
+    line: number,
+    column: number,
+    constantName: string,
+    scope?: ConstantScope
+  ) =>
+    performExtractConstant({
+      filePath: retryFile,
+      line,
+      column,
+      constantName,
+      scope,
+    });
+
+  describe('performExtractConstant', () => {
+    test('should replace equal literals in the package', async () => {
+      const result = await extract(12, 18, 'maxAttempts');
+      expect(result.occurrences).toBe(6);
+      expect(result.type).toBe('untyped int');
+      const content = readFileSync(retryFile, 'utf-8');
+      expect(content).toContain(
+        `const maxAttempts = 3
+
+// Retry calls do until it succeeds.
+func Retry(do func() error) (err error) {
+	for i := 0; i < maxAttempts; i++ {
+		if err = do(); err == nil || i == maxAttempts-1 {`
+      );
+      expect(content).toContain('time.Sleep(maxAttempts * time.Millisecond)');
+      expect(content).toContain('`json:"3"`');
+      expect(readFileSync(waitFile, 'utf-8')).toBe(
+        `package retry
+
+var delays = [maxAttempts]float64{3.0, maxAttempts}
+
+func wait(n int) bool { return n > maxAttempts }
+`
+      );
+    });
+
+    test('should replace literals in the function only', async () => {
+      const result = await extract(12, 18, 'maxAttempts', 'function');
+      expect(result.occurrences).toBe(3);
+      expect(result.declaredIn).toBe('func Retry');
+      const content = readFileSync(retryFile, 'utf-8');
+      expect(content).toContain(
+        'func Retry(do func() error) (err error) {\n\tconst maxAttempts = 3\n\tfor i := 0; i < maxAttempts; i++ {'
+      );
+      expect(readFileSync(waitFile, 'utf-8')).toContain('n > 3');
+    });
+
+    test('should declare the constant in a one-line function', async () => {
+      await performExtractConstant({
+        filePath: waitFile,
+        line: 5,
+        column: 36,
+        constantName: 'limit',
+        scope: 'function',
+      });
+      expect(readFileSync(waitFile, 'utf-8')).toContain(
+        'func wait(n int) bool { const limit = 3; return n > limit }'
+      );
+    });
+
+    test('should keep floats apart from integers', async () => {
+      const result = await performExtractConstant({
+        filePath: waitFile,
+        line: 3,
+        column: 25,
+        constantName: 'base',
+      });
+      expect(result.occurrences).toBe(1);
+      expect(result.type).toBe('untyped float');
+      expect(readFileSync(waitFile, 'utf-8')).toContain(
+        'const base = 3.0\n\nvar delays = [3]float64{base, 3}'
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject positions without a literal',
+        line: 12,
+        column: 6,
+        constantName: 'n',
+        error: 'No literal at tests/temp-extract-constant/retry.go:12:6',
+      },
+      {
+        name: 'should reject struct tags',
+        line: 6,
+        column: 15,
+        constantName: 'tag',
+        error: 'Import paths and struct tags cannot be replaced by a constant',
+      },
+      {
+        name: 'should reject names declared in the package',
+        line: 12,
+        column: 18,
+        constantName: 'wait',
+        error:
+          "'wait' is already declared in package retry at tests/temp-extract-constant/wait.go:5:6",
+      },
+      {
+        name: 'should reject names declared in the function',
+        line: 12,
+        column: 18,
+        constantName: 'err',
+        scope: 'function' as const,
+        error:
+          "'err' is already declared in func Retry at tests/temp-extract-constant/retry.go:11:30",
+      },
+      {
+        name: 'should reject names that a local declaration hides',
+        line: 12,
+        column: 18,
+        constantName: 'i',
+        error:
+          "'i' at tests/temp-extract-constant/retry.go:12:18 would refer to the var declared at tests/temp-extract-constant/retry.go:12:6",
+      },
+      {
+        name: 'should reject names that hide a used builtin',
+        line: 12,
+        column: 18,
+        constantName: 'float64',
+        error:
+          "Declaring 'float64' would hide the type used at tests/temp-extract-constant/wait.go:3:17",
+      },
+    ];
+
+    errorCases.forEach(({ name, line, column, constantName, scope, error }) => {
+      test(name, async () => {
+        const original = readFileSync(retryFile, 'utf-8');
+        await expect(
+          extract(line, column, constantName, scope)
+        ).rejects.toThrow(error);
+        expect(readFileSync(retryFile, 'utf-8')).toBe(original);
+      });
+    });
+
+    test('should reject function scope outside function bodies', async () => {
+      await expect(
+        performExtractConstant({
+          filePath: waitFile,
+          line: 3,
+          column: 15,
+          constantName: 'n',
+          scope: 'function',
+        })
+      ).rejects.toThrow(
+        'The literal at tests/temp-extract-constant/wait.go:3:15 is not in a function body'
+      );
+    });
+  });
+
+  describe('formatExtractConstantResults', () => {
+    test('should describe the constant and its occurrences', () => {
+      expect(
+        formatExtractConstantResults({
+          constantName: 'maxAttempts',
+          value: '3',
+          type: 'untyped int',
+          declaredIn: 'package retry',
+          occurrences: 2,
+          changes: [{ filePath: 'retry.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Extracted constant 'maxAttempts' = 3 (untyped int) in package retry, replacing 2 occurrences\n\nModified 1 file:\n  retry.go"
+      );
+    });
+  });
+});
@@ -0,0 +1,571 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performExtractFunction,
+  performExtractMethod,
+  formatExtractFunctionResults,
+} from '../../src/core/extract-function-tool.js';
+
+describe('Extract Function Tool', () => {
+  const testDir = 'tests/temp-extract-function';
+  const mainFile = `${testDir}/main.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/geo`, { recursive: true });
+    mkdirSync(`${testDir}/shapes`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/extract\n\ngo 1.22\n');
+    writeFileSync(
+      `${testDir}/geo/geo.go`,
+      `package geo
+
+type Point struct{ X, Y int }
+`
+    );
+    writeFileSync(
+      `${testDir}/shapes/shapes.go`,
+      `package shapes
+
+import "example.com/extract/geo"
+
+func Corner() geo.Point { return geo.Point{X: 1, Y: 1} }
+`
+    );
+    writeFileSync(
+      mainFile,
+      `package main
+
+import (
+	"fmt"
+	"strings"
+
+	"example.com/extract/shapes"
+)
+
+func bounds(xs []int) (int, int) {
+	lo, hi := xs[0], xs[0]
+	for _, x := range xs {
+		if x < lo {
+			lo = x
+		}
+		if x > hi {
+			hi = x
+		}
+	}
+	return lo, hi
+}
+
+func words(s string) {
+	parts := strings.Fields(s)
+	n := len(parts)
+	fmt.Println(n)
+}
+
+func squares() {
+	sum := 0
+	for i := 0; i < 3; i++ {
+		sq := i * i
+		sum += sq
+		fmt.Println(sq)
+	}
+	fmt.Println(sum)
+}
+
+func corner() {
+	p := shapes.Corner()
+	p.X++
+	fmt.Println(p)
+}
+
+func shadow(x int) {
+	{
+		y := x + 1
+		x := y * 2
+		fmt.Println(x)
+	}
+}
+
+func Map[T, U any](xs []T, f func(T) U) []U {
+	var out []U
+	for _, x := range xs {
+		out = append(out, f(x))
+	}
+	return out
+}
+
+func first(xs []int) int {
+	for _, x := range xs {
+		if x > 0 {
+			return x
+		}
+		continue
+	}
+	return 0
+}
+
+func main() {
+	fmt.Println(bounds([]int{3, 1, 2}))
+	words("a b")
+	squares()
+	corner()
+	shadow(1)
+	fmt.Println(Map([]int{1}, fmt.Sprint), first(nil))
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performExtractFunction', () => {
+    const testCases = [
+      {
+        name: 'should pass read variables and return modified ones',
+        options: { startLine: 12, endLine: 19, functionName: 'widen' },
+        expected: {
+          signature: 'func widen(xs []int, lo, hi int) (int, int)',
+          contains: [
+            '\tlo, hi = widen(xs, lo, hi)\n\treturn lo, hi\n',
+            `func widen(xs []int, lo, hi int) (int, int) {
+	for _, x := range xs {
+		if x < lo {
+			lo = x
+		}
+		if x > hi {
+			hi = x
+		}
+	}
+	return lo, hi
+}`,
+          ],
+        },
+      },
+      {
+        name: 'should declare variables used after the selection at the call site',
+        options: { startLine: 24, endLine: 25, functionName: 'count' },
+        expected: {
+          signature: 'func count(s string) int',
+          contains: [
+            '\tn := count(s)\n\tfmt.Println(n)\n',
+            'func count(s string) int {\n\tparts := strings.Fields(s)\n\tn := len(parts)\n\treturn n\n}',
+          ],
+        },
+      },
+      {
+        name: 'should declare new results separately when assigning outer variables',
+        options: { startLine: 32, endLine: 33, functionName: 'add' },
+        expected: {
+          signature: 'func add(i, sum int) (int, int)',
+          contains: [
+            '\t\tvar sq int\n\t\tsq, sum = add(i, sum)\n\t\tfmt.Println(sq)\n',
+            'func add(i, sum int) (int, int) {\n\tsq := i * i\n\tsum += sq\n\treturn sq, sum\n}',
+          ],
+        },
+      },
+      {
+        name: 'should return values modified through method calls and fields',
+        options: { startLine: 40, endLine: 41, functionName: 'moved' },
+        expected: {
+          signature: 'func moved() geo.Point',
+          contains: [
+            '\t"example.com/extract/geo"\n\t"example.com/extract/shapes"\n',
+            '\tp := moved()\n\tfmt.Println(p)\n',
+          ],
+        },
+      },
+      {
+        name: 'should rename parameters shadowed by the moved statements',
+        options: { startLine: 47, endLine: 49, functionName: 'twice' },
+        expected: {
+          signature: 'func twice(x1 int)',
+          contains: [
+            '\t{\n\t\ttwice(x)\n\t}\n',
+            'func twice(x1 int) {\n\ty := x1 + 1\n\tx := y * 2\n\tfmt.Println(x)\n}',
+          ],
+        },
+      },
+      {
+        name: 'should redeclare type parameters of generic functions',
+        options: { startLine: 56, endLine: 56, functionName: 'push' },
+        expected: {
+          signature: 'func push[T, U any](out []U, f func(T) U, x T) []U',
+          contains: ['\t\tout = push[T, U](out, f, x)\n'],
+        },
+      },
+      {
+        name: 'should report returns for the caller to take',
+        options: { startLine: 62, endLine: 67, functionName: 'find' },
+        expected: {
+          signature: 'func find(xs []int) (int, bool)',
+          contains: [
+            '\tif ret, done := find(xs); done {\n\t\treturn ret\n\t}\n\treturn 0\n',
+            `func find(xs []int) (int, bool) {
+	for _, x := range xs {
+		if x > 0 {
+			return x, true
+		}
+		continue
+	}
+	return 0, false
+}`,
+          ],
+        },
+      },
+      {
+        name: 'should return the results of statements ending in a return',
+        options: { startLine: 62, endLine: 68, functionName: 'find' },
+        expected: {
+          signature: 'func find(xs []int) int',
+          contains: ['int {\n\treturn find(xs)\n}\n'],
+        },
+      },
+    ];
+
+    testCases.forEach(({ name, options, expected }) => {
+      test(name, async () => {
+        const result = await performExtractFunction({
+          filePath: mainFile,
+          ...options,
+        });
+        expect(result.signature).toBe(expected.signature);
+        const content = readFileSync(mainFile, 'utf-8');
+        for (const text of expected.contains) {
+          expect(content).toContain(text);
+        }
+      });
+    });
+
+    test('should keep comments with the statements they document', async () => {
+      const notesFile = `${testDir}/notes.go`;
+      writeFileSync(
+        notesFile,
+        `package main
+
+func notes() {
+	total := 0
+
+	// Add the numbers.
+	for i := 0; i < 3; i++ {
+		total += i // accumulate
+	}
+
+	/* Print it. */
+	println(total) // trailing
+
+	println("done")
+} // end of notes
+`
+      );
+      await performExtractFunction({
+        filePath: notesFile,
+        startLine: 7,
+        endLine: 12,
+        functionName: 'sum',
+      });
+      expect(readFileSync(notesFile, 'utf-8')).toBe(`package main
+
+func notes() {
+	total := 0
+
+	sum(total)
+
+	println("done")
+} // end of notes
+
+func sum(total int) {
+	// Add the numbers.
+	for i := 0; i < 3; i++ {
+		total += i // accumulate
+	}
+
+	/* Print it. */
+	println(total) // trailing
+}
+`);
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(mainFile, 'utf-8');
+      const result = await performExtractFunction({
+        filePath: mainFile,
+        startLine: 24,
+        endLine: 25,
+        functionName: 'count',
+        dryRun: true,
+      });
+      expect(readFileSync(mainFile, 'utf-8')).toBe(original);
+      expect(result.changes).toHaveLength(1);
+      const output = formatExtractFunctionResults(result);
+      expect(output).toContain('+\tn := count(s)\n');
+      expect(output).toContain('+func count(s string) int {\n');
+      expect(output).toContain('Dry run: 1 file would be changed');
+    });
+
+    test('should hand on results modified before a return', async () => {
+      const parseFile = `${testDir}/parse.go`;
+      writeFileSync(
+        parseFile,
+        `package main
+
+import "errors"
+
+func parse(xs []int) (int, error) {
+	total := 0
+	for _, x := range xs {
+		if x < 0 {
+			return 0, errors.New("negative")
+		}
+		total += x
+	}
+	return total, nil
+}
+`
+      );
+      const result = await performExtractFunction({
+        filePath: parseFile,
+        startLine: 7,
+        endLine: 12,
+        functionName: 'sum',
+      });
+      expect(result.results).toEqual(['int', 'int', 'error', 'bool']);
+      expect(readFileSync(parseFile, 'utf-8')).toBe(`package main
+
+import "errors"
+
+func parse(xs []int) (int, error) {
+	total := 0
+	total, ret, err, done := sum(xs, total)
+	if done {
+		return ret, err
+	}
+	return total, nil
+}
+
+func sum(xs []int, total int) (int, int, error, bool) {
+	for _, x := range xs {
+		if x < 0 {
+			return 0, 0, errors.New("negative"), true
+		}
+		total += x
+	}
+	return total, 0, nil, false
+}
+`);
+    });
+
+    test('should reject jumps and returns the new function cannot make', async () => {
+      const jumpsFile = `${testDir}/jumps.go`;
+      writeFileSync(
+        jumpsFile,
+        `package main
+
+func jumps(n int) (m int) {
+	if n < 0 {
+		goto done
+	}
+	if n == 0 {
+		return
+	}
+	m = n
+done:
+	return m
+}
+`
+      );
+      const extract = (startLine: number, endLine: number) =>
+        performExtractFunction({
+          filePath: jumpsFile,
+          startLine,
+          endLine,
+          functionName: 'f',
+        });
+      await expect(extract(4, 6)).rejects.toThrow(
+        "Cannot extract the goto at tests/temp-extract-function/jumps.go:5:3, which jumps to the label 'done' at line 11 outside the selection"
+      );
+      await expect(extract(7, 9)).rejects.toThrow(
+        'Cannot extract the return at tests/temp-extract-function/jumps.go:8:3, which returns the named results of the enclosing function'
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject branches leaving the selection',
+        options: { startLine: 66, endLine: 66, functionName: 'f' },
+        error:
+          'Cannot extract the continue at tests/temp-extract-function/main.go:66:3, which continues the for loop at line 62 outside the selection',
+      },
+      {
+        name: 'should reject partial statements',
+        options: { startLine: 12, endLine: 13, functionName: 'f' },
+        error: 'The selected lines must contain complete statements',
+      },
+      {
+        name: 'should reject names already declared in the package',
+        options: { startLine: 24, endLine: 25, functionName: 'bounds' },
+        error: "'bounds' is already declared in package main",
+      },
+      {
+        name: 'should reject names shadowed at the call site',
+        options: { startLine: 24, endLine: 24, functionName: 'parts' },
+        error: "The local var 'parts' would shadow the new function",
+      },
+      {
+        name: 'should reject invalid names',
+        options: { startLine: 24, endLine: 24, functionName: 'func' },
+        error: "'func' is not a valid Go identifier",
+      },
+    ];
+
+    errorCases.forEach(({ name, options, error }) => {
+      test(name, async () => {
+        await expect(
+          performExtractFunction({ filePath: mainFile, ...options })
+        ).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('performExtractMethod', () => {
+    const methodsFile = `${testDir}/methods.go`;
+
+    beforeEach(() => {
+      writeFileSync(
+        methodsFile,
+        `package main
+
+type Counter struct {
+	n    int
+	name string
+}
+
+func (c *Counter) Add(k int) {
+	total := c.n + k
+	c.n = total
+	println(c.name, total)
+}
+
+func (c Counter) Show() {
+	println("counter")
+	c.n++
+	println(c.n)
+}
+
+type Stack[T any] struct{ items []T }
+
+func (s *Stack[T]) Push(x T) {
+	s.items = append(s.items, x)
+}
+`
+      );
+    });
+
+    const extract = (startLine: number, endLine: number, name: string) =>
+      performExtractMethod({
+        filePath: methodsFile,
+        startLine,
+        endLine,
+        functionName: name,
+      });
+
+    const testCases = [
+      {
+        name: 'should call the new method on the receiver',
+        lines: [9, 10],
+        methodName: 'add',
+        signature: 'func (c *Counter) add(k int) int',
+        contains: [
+          '\ttotal := c.add(k)\n\tprintln(c.name, total)\n',
+          'func (c *Counter) add(k int) int {\n\ttotal := c.n + k\n\tc.n = total\n\treturn total\n}',
+        ],
+      },
+      {
+        name: 'should return a value receiver that is assigned',
+        lines: [16, 16],
+        methodName: 'bump',
+        signature: 'func (c Counter) bump() Counter',
+        contains: ['\tc = c.bump()\n', '\tc.n++\n\treturn c\n}'],
+      },
+      {
+        name: 'should keep the type parameters of a generic receiver',
+        lines: [23, 23],
+        methodName: 'push',
+        signature: 'func (s *Stack[T]) push(x T)',
+        contains: ['\ts.push(x)\n'],
+      },
+    ];
+
+    testCases.forEach(({ name, lines, methodName, signature, contains }) => {
+      test(name, async () => {
+        const result = await extract(lines[0], lines[1], methodName);
+        expect(result.signature).toBe(signature);
+        expect(result.fallback).toBeUndefined();
+        const content = readFileSync(methodsFile, 'utf-8');
+        for (const text of contains) {
+          expect(content).toContain(text);
+        }
+      });
+    });
+
+    test('should extract a function when the receiver is not used', async () => {
+      const result = await extract(15, 15, 'banner');
+      expect(result.signature).toBe('func banner()');
+      expect(formatExtractFunctionResults(result)).toContain(
+        'Extracted func banner() in tests/temp-extract-function/methods.go\nThe statements do not use the receiver c of Show, so banner is a function\n'
+      );
+      expect(readFileSync(methodsFile, 'utf-8')).toContain('\tbanner()\n');
+    });
+
+    test('should extract a function outside of methods', async () => {
+      const result = await performExtractMethod({
+        filePath: mainFile,
+        startLine: 24,
+        endLine: 25,
+        functionName: 'count',
+      });
+      expect(result.signature).toBe('func count(s string) int');
+      expect(result.fallback).toBe(
+        'The statements are not in a method, so count is a function'
+      );
+    });
+
+    test('should reject names of fields and methods of the receiver', async () => {
+      await expect(extract(9, 10, 'name')).rejects.toThrow(
+        'The receiver type *Counter already has a field named name'
+      );
+      await expect(extract(9, 10, 'Show')).rejects.toThrow(
+        'The receiver type *Counter already has a method named Show'
+      );
+    });
+  });
+
+  describe('formatExtractFunctionResults', () => {
+    test('should report the new function and the modified file', () => {
+      expect(
+        formatExtractFunctionResults({
+          filePath: 'main.go',
+          functionName: 'count',
+          signature: 'func count(s string) int',
+          parameters: ['s string'],
+          results: ['int'],
+          changes: [{ filePath: 'main.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Extracted func count(s string) int in main.go\n\nModified 1 file:\n  main.go'
+      );
+    });
+  });
+});
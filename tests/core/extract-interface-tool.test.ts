@@ -0,0 +1,241 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performExtractInterface,
+  formatExtractInterfaceResults,
+} from '../../src/core/extract-interface-tool.js';
+
+describe('Extract Interface Tool', () => {
+  const testDir = 'tests/temp-extract-interface';
+  const storeFile = `${testDir}/store/store.go`;
+  const serviceFile = `${testDir}/store/service.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/store`, { recursive: true });
+    mkdirSync(`${testDir}/clock`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/ei\n\ngo 1.22\n');
+    writeFileSync(
+      `${testDir}/clock/clock.go`,
+      `package clock
+
+import "time"
+
+type Clock struct{}
+
+// Now returns the current time.
+func (Clock) Now() time.Time { return time.Now() }
+
+func (Clock) tick() {}
+`
+    );
+    writeFileSync(
+      storeFile,
+      `package store
+
+import (
+	"context"
+
+	"example.com/ei/clock"
+)
+
+// Store keeps values.
+type Store struct {
+	clock.Clock
+	data map[string]string
+}
+
+// Get returns the value of key.
+func (s *Store) Get(ctx context.Context, key string) (string, error) {
+	return s.data[key], nil
+}
+
+func (s *Store) Put(key, value string) error {
+	s.data[key] = value
+	return nil
+}
+
+func (s *Store) reset() { s.data = nil }
+
+type Plain struct{}
+
+func (Plain) Name() string { return "plain" }
+`
+    );
+    writeFileSync(
+      serviceFile,
+      `package store
+
+import "context"
+
+type Service struct {
+	store *Store
+	name  string
+}
+
+func NewService(s *Store) *Service {
+	s.reset()
+	return &Service{store: s}
+}
+
+func Run(ctx context.Context, s *Store) {
+	s.Get(ctx, "k")
+	s.Put("k", "v")
+}
+
+func Describe(p Plain) string { return p.Name() }
+
+func (v *Service) Lookup(ctx context.Context) string {
+	r, _ := v.store.Get(ctx, v.name)
+	return r
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performExtractInterface', () => {
+    test('should declare exported and promoted methods after the type', async () => {
+      const result = await performExtractInterface({
+        filePath: storeFile,
+        typeName: 'Store',
+        interfaceName: 'Storer',
+      });
+      expect(result.methods).toEqual(['Get', 'Put', 'Now']);
+      expect(result.implementedBy).toBe('*Store');
+      const content = readFileSync(storeFile, 'utf-8');
+      expect(content).toContain(
+        '\t"context"\n\t"time"\n\n\t"example.com/ei/clock"\n'
+      );
+      expect(content).toContain(
+        '\tdata map[string]string\n}\n\n// Storer describes the methods of *Store.\ntype Storer interface {\n\t// Get returns the value of key.\n\tGet(ctx context.Context, key string) (string, error)\n\tPut(key, value string) error\n\t// Now returns the current time.\n\tNow() time.Time\n}\n\n// Get returns'
+      );
+    });
+
+    test('should include listed methods only, in order', async () => {
+      const result = await performExtractInterface({
+        filePath: serviceFile,
+        typeName: 'Store',
+        interfaceName: 'resetter',
+        methods: ['reset', 'Put'],
+      });
+      expect(result.methods).toEqual(['reset', 'Put']);
+      expect(readFileSync(storeFile, 'utf-8')).toContain(
+        'type resetter interface {\n\treset()\n\tPut(key, value string) error\n}'
+      );
+    });
+
+    test('should retype parameters and fields', async () => {
+      const result = await performExtractInterface({
+        filePath: storeFile,
+        typeName: 'Store',
+        interfaceName: 'Storer',
+        replace: ['Run.s', 'Service.store'],
+      });
+      expect(result.replaced).toEqual(['Run.s', 'Service.store']);
+      const content = readFileSync(serviceFile, 'utf-8');
+      expect(content).toContain('\tstore Storer\n');
+      expect(content).toContain('func Run(ctx context.Context, s Storer) {');
+      expect(content).toContain('func NewService(s *Store) *Service {');
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(storeFile, 'utf-8');
+      const result = await performExtractInterface({
+        filePath: storeFile,
+        typeName: 'Plain',
+        interfaceName: 'Namer',
+        replace: ['Describe.p'],
+        dryRun: true,
+      });
+      expect(readFileSync(storeFile, 'utf-8')).toBe(original);
+      expect(result.implementedBy).toBe('Plain');
+      const output = formatExtractInterfaceResults(result);
+      expect(output).toContain('+type Namer interface {\n+\tName() string\n');
+      expect(output).toContain('+func Describe(p Namer) string {');
+      expect(output).toContain('Dry run: 2 files would be changed');
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject unknown types',
+        typeName: 'Missing',
+        error: "'Missing' is not a type declared in package store",
+      },
+      {
+        name: 'should reject names that are already declared',
+        interfaceName: 'Service',
+        error: "'Service' is already declared in package store",
+      },
+      {
+        name: 'should reject unknown methods',
+        methods: ['Delete'],
+        error: "'Store' has no method 'Delete'",
+      },
+      {
+        name: 'should reject unexported methods of other packages',
+        methods: ['tick'],
+        error: "Method 'tick' is promoted from package clock and unexported",
+      },
+      {
+        name: 'should reject replacements of another type',
+        replace: ['Service.name'],
+        error: "'Service.name' has type string, not Store or *Store",
+      },
+      {
+        name: 'should reject replacements used beyond the methods',
+        replace: ['NewService.s'],
+        error: "Cannot change 'NewService.s' to Storer: it is used at",
+      },
+      {
+        name: 'should reject replacements that cannot be found',
+        replace: ['Run.x'],
+        error: "Cannot find 'Run.x' in package store",
+      },
+    ];
+
+    errorCases.forEach(({ name, error, ...options }) => {
+      test(name, async () => {
+        await expect(
+          performExtractInterface({
+            filePath: storeFile,
+            typeName: 'Store',
+            interfaceName: 'Storer',
+            ...options,
+          })
+        ).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatExtractInterfaceResults', () => {
+    test('should report the methods and replacements', () => {
+      expect(
+        formatExtractInterfaceResults({
+          interfaceName: 'Storer',
+          implementedBy: '*Store',
+          methods: ['Get'],
+          replaced: ['Run.s'],
+          changes: [{ filePath: 'store.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Extracted interface 'Storer' with 1 method implemented by *Store: Get\nChanged to Storer:\n  Run.s\n\nModified 1 file:\n  store.go"
+      );
+    });
+  });
+});
@@ -0,0 +1,313 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import { resolve } from 'path';
+import {
+  performExtractPackage,
+  formatExtractPackageResults,
+} from '../../src/core/extract-package-tool.js';
+import { performUndo } from '../../src/core/undo-tool.js';
+
+describe('Extract Package Tool', () => {
+  const testDir = 'tests/temp-extract-package';
+  const priceFile = `${testDir}/shop/price.go`;
+  const shopFile = `${testDir}/shop/shop.go`;
+  const appFile = `${testDir}/app/app.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/shop`, { recursive: true });
+    mkdirSync(`${testDir}/app`, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/ep\n\ngo 1.22\n');
+    writeFileSync(
+      priceFile,
+      `package shop
+
+import "fmt"
+
+// Price is an amount in cents.
+type Price int
+
+func (p Price) String() string { return fmt.Sprintf("%d.%02d", p/100, p%100) }
+
+func format(p Price) string { return currency + p.String() }
+`
+    );
+    writeFileSync(
+      shopFile,
+      `package shop
+
+var currency = "$"
+
+func Label(p Price) string { return format(p) }
+`
+    );
+    writeFileSync(
+      appFile,
+      `package app
+
+import "example.com/ep/shop"
+
+func Show() string { return shop.Price(5).String() + shop.Label(1) }
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performExtractPackage', () => {
+    test('should move declarations into a new package and qualify their uses', async () => {
+      const result = await performExtractPackage({
+        filePath: shopFile,
+        declarations: ['Price', 'format', 'currency'],
+        destination: `${testDir}/shop/money`,
+      });
+      expect(result.importPath).toBe('example.com/ep/shop/money');
+      expect(result.names).toEqual([
+        'Price',
+        'Price.String',
+        'format',
+        'currency',
+      ]);
+      expect(result.exported).toEqual([
+        { packageName: 'money', from: 'format', to: 'Format' },
+      ]);
+      expect(result.references).toBe(3);
+      expect(readFileSync(`${testDir}/shop/money/price.go`, 'utf-8')).toBe(
+        `package money
+
+import "fmt"
+
+// Price is an amount in cents.
+type Price int
+
+func (p Price) String() string { return fmt.Sprintf("%d.%02d", p/100, p%100) }
+
+func Format(p Price) string { return currency + p.String() }
+`
+      );
+      expect(readFileSync(`${testDir}/shop/money/shop.go`, 'utf-8')).toBe(
+        'package money\n\nvar currency = "$"\n'
+      );
+      expect(readFileSync(priceFile, 'utf-8')).toBe('package shop\n');
+      expect(readFileSync(shopFile, 'utf-8')).toBe(`package shop
+
+import "example.com/ep/shop/money"
+
+func Label(p money.Price) string { return money.Format(p) }
+`);
+      expect(readFileSync(appFile, 'utf-8')).toBe(`package app
+
+import (
+	"example.com/ep/shop"
+	"example.com/ep/shop/money"
+)
+
+func Show() string { return money.Price(5).String() + shop.Label(1) }
+`);
+    });
+
+    test('should export what the moved code uses of the package', async () => {
+      const result = await performExtractPackage({
+        filePath: shopFile,
+        declarations: ['Label'],
+        destination: `${testDir}/shop/label`,
+      });
+      expect(result.exported).toEqual([
+        { packageName: 'shop', from: 'format', to: 'Format' },
+      ]);
+      expect(readFileSync(`${testDir}/shop/label/shop.go`, 'utf-8')).toBe(
+        'package label\n\nimport "example.com/ep/shop"\n\nfunc Label(p shop.Price) string { return shop.Format(p) }\n'
+      );
+      expect(readFileSync(priceFile, 'utf-8')).toContain(
+        'func Format(p Price) string {'
+      );
+      expect(readFileSync(appFile, 'utf-8')).toContain(
+        'return shop.Price(5).String() + label.Label(1)'
+      );
+    });
+
+    test('should refuse to create an import cycle', async () => {
+      await expect(
+        performExtractPackage({
+          filePath: shopFile,
+          declarations: ['Price', 'format'],
+          destination: `${testDir}/shop/money`,
+        })
+      ).rejects.toThrow(
+        'Extracting the declarations would create the import cycle example.com/ep/shop/money -> example.com/ep/shop -> example.com/ep/shop/money: the moved code uses currency at tests/temp-extract-package/shop/price.go:10:38, and tests/temp-extract-package/shop/shop.go:5:14 uses Price, which is moved'
+      );
+      expect(existsSync(`${testDir}/shop/money`)).toBe(false);
+    });
+
+    test('should keep the build constraint and split groups', async () => {
+      writeFileSync(
+        `${testDir}/shop/kinds.go`,
+        '//go:build !tiny\n\npackage shop\n\ntype (\n\t// Kind of product.\n\tKind int\n\tSize int\n)\n\nvar sizes = map[Size]string{}\n'
+      );
+      await performExtractPackage({
+        filePath: shopFile,
+        declarations: ['Kind'],
+        destination: `${testDir}/kinds`,
+        packageName: 'kind',
+      });
+      expect(readFileSync(`${testDir}/kinds/kinds.go`, 'utf-8')).toBe(
+        '//go:build !tiny\n\npackage kind\n\n// Kind of product.\ntype Kind int\n'
+      );
+      expect(readFileSync(`${testDir}/shop/kinds.go`, 'utf-8')).not.toContain(
+        'Kind'
+      );
+    });
+
+    test('should not move methods without their type', async () => {
+      await expect(
+        performExtractPackage({
+          filePath: shopFile,
+          declarations: ['Price.String'],
+          destination: `${testDir}/shop/money`,
+        })
+      ).rejects.toThrow("'Price.String' cannot be moved without its type Price");
+    });
+
+    test('should refuse unexported fields used across the boundary', async () => {
+      writeFileSync(
+        `${testDir}/shop/box.go`,
+        'package shop\n\ntype box struct{ w, h int }\n\nfunc area(b box) int { return b.w * b.h }\n'
+      );
+      await expect(
+        performExtractPackage({
+          filePath: shopFile,
+          declarations: ['box'],
+          destination: `${testDir}/box`,
+        })
+      ).rejects.toThrow(
+        'tests/temp-extract-package/shop/box.go:5:33 uses the unexported field w, which would be declared in package box'
+      );
+    });
+
+    test('should refuse exported names that clash', async () => {
+      writeFileSync(
+        `${testDir}/shop/other.go`,
+        'package shop\n\nfunc other() string {\n\tFormat := 1\n\t_ = Format\n\treturn format(0)\n}\n'
+      );
+      await expect(
+        performExtractPackage({
+          filePath: shopFile,
+          declarations: ['Label'],
+          destination: `${testDir}/shop/label`,
+        })
+      ).rejects.toThrow(
+        "Cannot export 'format' as 'Format', which refers to another declaration at tests/temp-extract-package/shop/other.go:6:9"
+      );
+    });
+
+    test('should refuse internal packages that users cannot import', async () => {
+      await expect(
+        performExtractPackage({
+          filePath: shopFile,
+          declarations: ['Price', 'format', 'currency'],
+          destination: `${testDir}/shop/internal/money`,
+        })
+      ).rejects.toThrow(
+        'example.com/ep/shop/internal/money is internal, and tests/temp-extract-package/app/app.go:5:34 in package app cannot import it'
+      );
+    });
+
+    test('should refuse destinations holding Go files', async () => {
+      await expect(
+        performExtractPackage({
+          filePath: shopFile,
+          declarations: ['Label'],
+          destination: `${testDir}/app`,
+        })
+      ).rejects.toThrow('tests/temp-extract-package/app already holds Go files');
+    });
+
+    test('should not modify files in dry run mode', async () => {
+      const original = readFileSync(appFile, 'utf-8');
+      const result = await performExtractPackage({
+        filePath: shopFile,
+        declarations: ['Label'],
+        destination: `${testDir}/shop/label`,
+        dryRun: true,
+      });
+      expect(result.changes).toHaveLength(4);
+      expect(readFileSync(appFile, 'utf-8')).toBe(original);
+      expect(existsSync(`${testDir}/shop/label`)).toBe(false);
+    });
+
+    test('should let undo delete the directories it created', async () => {
+      await performExtractPackage({
+        filePath: shopFile,
+        declarations: ['Label'],
+        destination: `${testDir}/shop/ui/label`,
+      });
+      const result = await performUndo({});
+      expect(result.removedDirs).toEqual([
+        resolve(`${testDir}/shop/ui/label`),
+        resolve(`${testDir}/shop/ui`),
+      ]);
+      expect(existsSync(`${testDir}/shop/ui`)).toBe(false);
+      expect(readFileSync(shopFile, 'utf-8')).toContain('func Label(');
+    });
+
+    test('should remove the directories it created when writing fails', async () => {
+      // Cancelled at the check that follows the last step, once the
+      // directory is created, just before the files are written.
+      let checks = -Infinity;
+      const signal = {
+        get aborted() {
+          return checks++ > 0;
+        },
+      } as AbortSignal;
+      const onProgress = (message: string) => {
+        checks = message === 'Finding references' ? 0 : -Infinity;
+      };
+      await expect(
+        performExtractPackage({
+          filePath: shopFile,
+          declarations: ['Label'],
+          destination: `${testDir}/shop/ui/label`,
+          signal,
+          onProgress,
+        })
+      ).rejects.toThrow('cancelled');
+      expect(existsSync(`${testDir}/shop/ui`)).toBe(false);
+      expect(existsSync(`${testDir}/shop`)).toBe(true);
+    });
+  });
+
+  describe('formatExtractPackageResults', () => {
+    test('should report the declarations moved and the names exported', () => {
+      expect(
+        formatExtractPackageResults({
+          importPath: 'example.com/ep/money',
+          packageName: 'money',
+          dir: 'money',
+          names: ['Price', 'format'],
+          exported: [{ packageName: 'money', from: 'format', to: 'Format' }],
+          references: 2,
+          warnings: [],
+          changes: [
+            { filePath: 'shop.go', original: 'a', updated: 'b' },
+            { filePath: 'money/price.go', original: '', updated: 'c' },
+          ],
+          dryRun: false,
+        })
+      ).toBe(
+        'Extracted 2 declarations into package money (example.com/ep/money) in money: Price, format\nExported format of package money as Format\nUpdated 2 references\n\nModified 2 files:\n  shop.go\n  money/price.go'
+      );
+    });
+  });
+});
@@ -0,0 +1,241 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performExtractTypeAlias,
+  formatExtractTypeAliasResults,
+} from '../../src/core/extract-type-alias-tool.js';
+
+describe('Extract Type Alias Tool', () => {
+  const testDir = 'tests/temp-extract-type-alias';
+  const indexFile = `${testDir}/index.go`;
+  const storeFile = `${testDir}/store.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/ta\n\ngo 1.22\n');
+    writeFileSync(
+      indexFile,
+      `package index
+
+import "time"
+
+type Doc struct{ Key string }
+
+var index map[string][]*Doc
+
+func build(docs []*Doc) map[string][]*Doc {
+	m := map[string][]*Doc{}
+	for _, d := range docs {
+		m[d.Key] = append(m[d.Key], d)
+	}
+	return m
+}
+
+func find(x any) bool {
+	_, ok := x.(map[string][]*Doc)
+	return ok
+}
+
+func ages(d map[string]time.Duration) int { return len(d) }
+`
+    );
+    writeFileSync(
+      storeFile,
+      `package index
+
+import "time"
+
+type Store struct {
+	docs map[string][]*Doc
+	ttl  map[string]time.Duration
+}
+
+func (s *Store) All() map[string][]*Doc { return s.docs }
+
+var byKey = []map[string][]*Doc{}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  const extract = (
+    line: number,
+    column: number,
+    options: Partial<Parameters<typeof performExtractTypeAlias>[0]> = {}
+  ) =>
+    performExtractTypeAlias({
+      filePath: indexFile,
+      line,
+      column,
+      typeName: 'Index',
+      ...options,
+    });
+
+  describe('performExtractTypeAlias', () => {
+    test('should declare an alias and replace identical types in the package', async () => {
+      const result = await extract(7, 11);
+      expect(result.type).toBe('map[string][]*Doc');
+      expect(result.occurrences).toBe(7);
+      expect(result.kept).toEqual([]);
+      expect(readFileSync(indexFile, 'utf-8')).toBe(`package index
+
+import "time"
+
+type Doc struct{ Key string }
+
+type Index = map[string][]*Doc
+
+var index Index
+
+func build(docs []*Doc) Index {
+	m := Index{}
+	for _, d := range docs {
+		m[d.Key] = append(m[d.Key], d)
+	}
+	return m
+}
+
+func find(x any) bool {
+	_, ok := x.(Index)
+	return ok
+}
+
+func ages(d map[string]time.Duration) int { return len(d) }
+`);
+      expect(readFileSync(storeFile, 'utf-8')).toContain(
+        'func (s *Store) All() Index { return s.docs }\n\nvar byKey = []Index{}\n'
+      );
+    });
+
+    test('should extract the innermost type literal at the position', async () => {
+      const result = await extract(7, 22, { typeName: 'Docs' });
+      expect(result.type).toBe('[]*Doc');
+      expect(readFileSync(indexFile, 'utf-8')).toContain(
+        'func build(docs Docs) map[string]Docs {\n\tm := map[string]Docs{}\n'
+      );
+    });
+
+    test('should keep occurrences whose identity a defined type would change', async () => {
+      const result = await extract(7, 11, { kind: 'defined' });
+      expect(result.kept).toEqual([
+        'tests/temp-extract-type-alias/index.go:18:14',
+        'tests/temp-extract-type-alias/store.go:10:23',
+        'tests/temp-extract-type-alias/store.go:12:15',
+      ]);
+      const content = readFileSync(indexFile, 'utf-8');
+      expect(content).toContain('type Index map[string][]*Doc\n\nvar index Index\n');
+      expect(content).toContain('func build(docs []*Doc) Index {\n\tm := Index{}\n');
+      expect(content).toContain('x.(map[string][]*Doc)');
+      expect(readFileSync(storeFile, 'utf-8')).toContain('\tdocs Index\n');
+    });
+
+    test('should remove imports only the replaced occurrences used', async () => {
+      writeFileSync(
+        storeFile,
+        'package index\n\nimport "time"\n\nvar ttl map[string]time.Duration\n'
+      );
+      await extract(22, 13, { typeName: 'Ages' });
+      expect(readFileSync(storeFile, 'utf-8')).toBe(
+        'package index\n\nvar ttl Ages\n'
+      );
+      expect(readFileSync(indexFile, 'utf-8')).toContain(
+        'type Ages = map[string]time.Duration\n\nfunc ages(d Ages) int'
+      );
+    });
+
+    test('should declare the type in the enclosing function', async () => {
+      const result = await extract(10, 7, { scope: 'function' });
+      expect(result.declaredIn).toBe('func build');
+      expect(result.occurrences).toBe(1);
+      expect(readFileSync(indexFile, 'utf-8')).toContain(
+        'func build(docs []*Doc) map[string][]*Doc {\n\ttype Index = map[string][]*Doc\n\tm := Index{}\n'
+      );
+    });
+
+    test('should not replace embedded fields and receivers', async () => {
+      writeFileSync(
+        storeFile,
+        'package index\n\ntype Cache struct {\n\t*Doc\n\tnext *Doc\n}\n\nfunc (d *Doc) Self() *Doc { return d }\n'
+      );
+      await extract(5, 7, { typeName: 'Ref', filePath: storeFile });
+      expect(readFileSync(storeFile, 'utf-8')).toBe(
+        'package index\n\ntype Ref = *Doc\n\ntype Cache struct {\n\t*Doc\n\tnext Ref\n}\n\nfunc (d *Doc) Self() Ref { return d }\n'
+      );
+      await expect(
+        performExtractTypeAlias({
+          filePath: storeFile,
+          line: 6,
+          column: 2,
+          typeName: 'Other',
+        })
+      ).rejects.toThrow(
+        'The type at tests/temp-extract-type-alias/store.go:6:2 cannot be replaced by a name, being a receiver or an embedded field'
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject positions outside type expressions',
+        options: { line: 11, column: 3 },
+        error: 'No type expression at tests/temp-extract-type-alias/index.go:11:3',
+      },
+      {
+        name: 'should reject names already declared in the package',
+        options: { line: 7, column: 11, typeName: 'Store' },
+        error: "'Store' is already declared in package index",
+      },
+      {
+        name: 'should reject names declared closer to an occurrence',
+        options: { line: 7, column: 11, typeName: 'x' },
+        error:
+          "'x' at tests/temp-extract-type-alias/index.go:18:14 would refer to the var declared at tests/temp-extract-type-alias/index.go:17:11",
+      },
+      {
+        name: 'should reject function scope outside function bodies',
+        options: { line: 7, column: 11, scope: 'function' as const },
+        error:
+          'The type at tests/temp-extract-type-alias/index.go:7:11 is not in a function body',
+      },
+    ];
+
+    errorCases.forEach(({ name, options, error }) => {
+      test(name, async () => {
+        const { line, column, ...rest } = options;
+        await expect(extract(line, column, rest)).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatExtractTypeAliasResults', () => {
+    test('should list the occurrences a defined type kept', () => {
+      expect(
+        formatExtractTypeAliasResults({
+          typeName: 'Index',
+          kind: 'defined',
+          type: 'map[string][]*Doc',
+          declaredIn: 'package index',
+          occurrences: 2,
+          kept: ['index.go:18:14'],
+          changes: [{ filePath: 'index.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Extracted type 'Index' map[string][]*Doc in package index, replacing 2 occurrences\nKept this occurrence, where a defined type would change the identity of other types or what type assertions match:\n  index.go:18:14\n\nModified 1 file:\n  index.go"
+      );
+    });
+  });
+});
@@ -0,0 +1,215 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performExtractVariable,
+  formatExtractVariableResults,
+} from '../../src/core/extract-variable-tool.js';
+
+describe('Extract Variable Tool', () => {
+  const testDir = 'tests/temp-extract-variable';
+  const shopFile = `${testDir}/shop/shop.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/shop`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/extract\n\ngo 1.22\n');
+    writeFileSync(
+      shopFile,
+      `package shop
+
+import "strings"
+
+type Item struct {
+	Name  string
+	Price float64
+	Count int
+}
+
+func Total(items []Item, rate float64) float64 {
+	sum := 0.0
+	for i := len(items) - 1; i >= 0; i-- {
+		sum += items[i].Price * float64(items[i].Count)
+	}
+	if sum > 100 {
+		return sum * (1 + rate) * (1 + rate)
+	}
+	return sum * (1 + rate)
+}
+
+func Label(it Item) string {
+	var limit float64 = 10 * 2
+	if it.Price > limit && strings.HasPrefix(it.Name, "x") {
+		return strings.ToUpper(it.Name)
+	}
+	it.Count++
+	return strings.ToLower(it.Name)
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Selects the nth occurrence of text in shop.go.
+  const select = (text: string, nth = 0) => {
+    const lines = readFileSync(shopFile, 'utf-8').split('\n');
+    let line = -1;
+    let column = -1;
+    for (let k = 0; k <= nth; k++) {
+      do {
+        if (column < 0) line++;
+        column = lines[line].indexOf(text, column < 0 ? 0 : column + 1);
+      } while (column < 0);
+    }
+    return {
+      filePath: shopFile,
+      startLine: line + 1,
+      startColumn: column + 1,
+      endLine: line + 1,
+      endColumn: column + text.length + 1,
+    };
+  };
+
+  describe('performExtractVariable', () => {
+    test('should declare the expression before its statement', async () => {
+      const result = await performExtractVariable({
+        ...select('items[i].Price * float64(items[i].Count)'),
+        variableName: 'cost',
+      });
+      expect(result.type).toBe('float64');
+      expect(result.occurrences).toBe(1);
+      expect(readFileSync(shopFile, 'utf-8')).toContain(
+        '\t\tcost := items[i].Price * float64(items[i].Count)\n\t\tsum += cost\n'
+      );
+    });
+
+    test('should replace every occurrence in the block', async () => {
+      const result = await performExtractVariable({
+        ...select('(1 + rate)', 2),
+        variableName: 'factor',
+        replaceAll: true,
+      });
+      expect(result.occurrences).toBe(3);
+      expect(readFileSync(shopFile, 'utf-8')).toContain(
+        `	factor := 1 + rate
+	if sum > 100 {
+		return sum * factor * factor
+	}
+	return sum * factor
+`
+      );
+    });
+
+    test('should hoist expressions out of a for init', async () => {
+      await performExtractVariable({
+        ...select('len(items) - 1'),
+        variableName: 'last',
+      });
+      expect(readFileSync(shopFile, 'utf-8')).toContain(
+        '\tlast := len(items) - 1\n\tfor i := last; i >= 0; i-- {\n'
+      );
+    });
+
+    test('should keep untyped constants constant', async () => {
+      const result = await performExtractVariable({
+        ...select('10 * 2'),
+        variableName: 'base',
+      });
+      expect(result.type).toBe('untyped int');
+      expect(readFileSync(shopFile, 'utf-8')).toContain(
+        '\tconst base = 10 * 2\n\tvar limit float64 = base\n'
+      );
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(shopFile, 'utf-8');
+      const result = await performExtractVariable({
+        ...select('strings.ToLower(it.Name)'),
+        variableName: 'lower',
+        dryRun: true,
+      });
+      expect(readFileSync(shopFile, 'utf-8')).toBe(original);
+      const output = formatExtractVariableResults(result);
+      expect(output).toContain('+\tlower := strings.ToLower(it.Name)\n');
+      expect(output).toContain('Dry run: 1 file would be changed');
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject partial expressions',
+        text: 'Price * float64',
+        error: 'The selected range must cover a complete expression',
+      },
+      {
+        name: 'should reject loop conditions',
+        text: 'i >= 0',
+        error: 'Cannot extract an expression from a loop condition',
+      },
+      {
+        name: 'should reject conditionally evaluated operands',
+        text: 'strings.HasPrefix(it.Name, "x")',
+        error: 'Cannot extract the right operand of &&',
+      },
+      {
+        name: 'should reject assigned expressions',
+        text: 'it.Count',
+        error: 'Cannot extract an expression that is assigned to',
+      },
+      {
+        name: 'should reject names declared in the block',
+        text: 'strings.ToLower(it.Name)',
+        variableName: 'it',
+        error: "'it' is already declared in this block at",
+      },
+      {
+        name: 'should reject names that shadow later uses',
+        text: 'it.Price > limit',
+        variableName: 'strings',
+        error: "Declaring 'strings' would shadow the pkgname used at",
+      },
+      {
+        name: 'should reject types',
+        text: 'float64',
+        error: "'float64' is not a value",
+      },
+    ];
+
+    errorCases.forEach(({ name, text, variableName = 'v', error }) => {
+      test(name, async () => {
+        await expect(
+          performExtractVariable({ ...select(text), variableName })
+        ).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatExtractVariableResults', () => {
+    test('should report the variable and its occurrences', () => {
+      expect(
+        formatExtractVariableResults({
+          filePath: 'shop.go',
+          variableName: 'factor',
+          type: 'float64',
+          occurrences: 3,
+          changes: [{ filePath: 'shop.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Extracted variable 'factor' of type float64 in shop.go, replacing 3 occurrences\n\nModified 1 file:\n  shop.go"
+      );
+    });
+  });
+});
@@ -0,0 +1,192 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import { writeFileSync, existsSync, rmSync, mkdirSync } from 'fs';
+import {
+  performFindImplementations,
+  formatFindImplementationsResults,
+} from '../../src/core/find-implementations-tool.js';
+
+describe('Find Implementations Tool', () => {
+  const testDir = 'tests/temp-find-implementations';
+  const storeFile = `${testDir}/store/store.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/store`, { recursive: true });
+    mkdirSync(`${testDir}/mem`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/impl\n\ngo 1.22\n');
+    writeFileSync(
+      storeFile,
+      `package store
+
+import "io"
+
+type Store interface {
+	Get(key string) (string, error)
+}
+
+type Closer interface {
+	Store
+	io.Closer
+}
+
+type sealed interface{ seal() }
+
+type Number interface{ ~int | ~float64 }
+
+type Disk struct{}
+
+func (d *Disk) Get(key string) (string, error) { return "", nil }
+
+type Box[T any] struct{ v T }
+
+func (b Box[T]) Get(key string) (string, error) { return "", nil }
+
+type File struct{}
+
+func (File) seal() {}
+
+func (File) Get(key string) (int, error) { return 0, nil }
+
+var _ io.Reader = nil
+`
+    );
+    writeFileSync(
+      `${testDir}/mem/mem.go`,
+      `package mem
+
+type Mem struct{ Base }
+
+type Base struct{}
+
+func (Base) Get(key string) (string, error) { return "", nil }
+
+func (Mem) seal() {}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  const find = (line: number, column: number) =>
+    performFindImplementations({ filePath: storeFile, line, column });
+
+  describe('performFindImplementations', () => {
+    test('should find types implementing by value and by pointer', async () => {
+      const result = await find(5, 6);
+      expect(result.implementations).toEqual([
+        {
+          name: 'mem.Mem',
+          filePath: `${testDir}/mem/mem.go`,
+          line: 3,
+          column: 6,
+          receiver: 'value',
+        },
+        {
+          name: 'mem.Base',
+          filePath: `${testDir}/mem/mem.go`,
+          line: 5,
+          column: 6,
+          receiver: 'value',
+        },
+        {
+          name: 'Disk',
+          filePath: storeFile,
+          line: 18,
+          column: 6,
+          receiver: 'pointer',
+        },
+      ]);
+      expect(result.unchecked).toEqual([]);
+    });
+
+    test('should report embedded interfaces of other modules', async () => {
+      const result = await find(9, 6);
+      expect(result.implementations.map(i => i.name)).toEqual([
+        'mem.Mem',
+        'mem.Base',
+        'Disk',
+      ]);
+      expect(result.unchecked).toEqual(['io.Closer']);
+    });
+
+    test('should keep unexported methods to their package', async () => {
+      const result = await find(14, 6);
+      expect(result.implementations.map(i => i.name)).toEqual(['File']);
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject types that are not interfaces',
+        line: 18,
+        column: 6,
+        error: "'Disk' is not an interface type",
+      },
+      {
+        name: 'should reject constraints',
+        line: 16,
+        column: 6,
+        error: "'Number' has type terms and can only be used as a constraint",
+      },
+      {
+        name: 'should reject interfaces of other modules',
+        line: 32,
+        column: 11,
+        error: "'Reader' is declared in io, outside the module",
+      },
+    ];
+
+    errorCases.forEach(({ name, line, column, error }) => {
+      test(name, async () => {
+        await expect(find(line, column)).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatFindImplementationsResults', () => {
+    test('should tell value and pointer implementations apart', () => {
+      expect(
+        formatFindImplementationsResults({
+          interfaceName: 'Store',
+          implementations: [
+            {
+              name: 'mem.Mem',
+              filePath: 'mem/mem.go',
+              line: 3,
+              column: 6,
+              receiver: 'value',
+            },
+            {
+              name: 'Disk',
+              filePath: 'store/store.go',
+              line: 18,
+              column: 6,
+              receiver: 'pointer',
+            },
+          ],
+          unchecked: ['io.Closer'],
+          warnings: [],
+        })
+      ).toBe(
+        'Implementations of interface Store:\n  mem/mem.go:3:6: mem.Mem (value and pointer)\n  store/store.go:18:6: *Disk (pointer only)\n\nTotal: 2 types\n\nNot checked, since they are declared outside the module: the methods of io.Closer'
+      );
+    });
+
+    test('should say when nothing implements the interface', () => {
+      expect(
+        formatFindImplementationsResults({
+          interfaceName: 'Store',
+          implementations: [],
+          unchecked: [],
+          warnings: [],
+        })
+      ).toBe('No types in the module implement Store');
+    });
+  });
+});
@@ -0,0 +1,366 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import { writeFileSync, existsSync, rmSync, mkdirSync } from 'fs';
+import {
+  performFindReferences,
+  formatFindReferencesResults,
+} from '../../src/core/find-references-tool.js';
+
+describe('Find References Tool', () => {
+  const testDir = 'tests/temp-find-references';
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/geo`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/refs\n\ngo 1.22\n');
+    writeFileSync(
+      `${testDir}/geo/point.go`,
+      `package geo
+
+type Point struct {
+	X, Y int
+}
+
+func (p Point) Add(o Point) Point {
+	return Point{X: p.X + o.X, Y: p.Y + o.Y}
+}
+
+func Sum(ps []Point) int {
+	total := 0
+	for _, p := range ps {
+		total := total + p.X
+		_ = total
+	}
+	return total
+}
+`
+    );
+    writeFileSync(
+      `${testDir}/geo/point_test.go`,
+      `package geo
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	p := Point{X: 1}.Add(Point{Y: 2})
+	if p.X != 1 {
+		t.Fatal(p)
+	}
+}
+`
+    );
+    writeFileSync(
+      `${testDir}/main.go`,
+      `package main
+
+import (
+	"fmt"
+
+	"example.com/refs/geo"
+)
+
+func main() {
+	fmt.Println(geo.Sum([]geo.Point{{X: 1}}))
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performFindReferences', () => {
+    const testCases = [
+      {
+        name: 'should find a type across packages and test files',
+        options: { filePath: `${testDir}/geo/point.go`, line: 3, column: 6 },
+        expected: {
+          symbol: 'Point',
+          kind: 'type',
+          locations: [
+            `${testDir}/geo/point.go:3:6`,
+            `${testDir}/geo/point.go:7:9`,
+            `${testDir}/geo/point.go:7:22`,
+            `${testDir}/geo/point.go:7:29`,
+            `${testDir}/geo/point.go:8:9`,
+            `${testDir}/geo/point.go:11:15`,
+            `${testDir}/geo/point_test.go:6:7`,
+            `${testDir}/geo/point_test.go:6:23`,
+            `${testDir}/main.go:10:28`,
+          ],
+        },
+      },
+      {
+        name: 'should find fields including composite literal keys',
+        options: { filePath: `${testDir}/geo/point.go`, line: 4, column: 2 },
+        expected: {
+          symbol: 'X',
+          kind: 'field',
+          locations: [
+            `${testDir}/geo/point.go:4:2`,
+            `${testDir}/geo/point.go:8:15`,
+            `${testDir}/geo/point.go:8:20`,
+            `${testDir}/geo/point.go:8:26`,
+            `${testDir}/geo/point.go:14:22`,
+            `${testDir}/geo/point_test.go:6:13`,
+            `${testDir}/geo/point_test.go:7:7`,
+            `${testDir}/main.go:10:35`,
+          ],
+        },
+      },
+      {
+        name: 'should distinguish shadowed variables',
+        options: { filePath: `${testDir}/geo/point.go`, line: 12, column: 2 },
+        expected: {
+          symbol: 'total',
+          kind: 'var',
+          locations: [
+            `${testDir}/geo/point.go:12:2`,
+            `${testDir}/geo/point.go:14:12`,
+            `${testDir}/geo/point.go:17:9`,
+          ],
+        },
+      },
+      {
+        name: 'should resolve the inner variable of a shadowing pair',
+        options: { filePath: `${testDir}/geo/point.go`, line: 15, column: 7 },
+        expected: {
+          symbol: 'total',
+          kind: 'var',
+          locations: [
+            `${testDir}/geo/point.go:14:3`,
+            `${testDir}/geo/point.go:15:7`,
+          ],
+        },
+      },
+      {
+        name: 'should accept a byte offset',
+        options: { filePath: `${testDir}/geo/point.go`, offset: 61 },
+        expected: {
+          symbol: 'Add',
+          kind: 'method',
+          locations: [
+            `${testDir}/geo/point.go:7:16`,
+            `${testDir}/geo/point_test.go:6:19`,
+          ],
+        },
+      },
+      {
+        name: 'should find package names from an import path',
+        options: { filePath: `${testDir}/main.go`, line: 6, column: 3 },
+        expected: {
+          symbol: 'geo',
+          kind: 'package',
+          locations: [
+            `${testDir}/main.go:6:2`,
+            `${testDir}/main.go:10:14`,
+            `${testDir}/main.go:10:24`,
+          ],
+        },
+      },
+      {
+        name: 'should resolve names qualified by their package',
+        options: { filePath: `${testDir}/main.go`, symbol: 'geo.Sum' },
+        expected: {
+          symbol: 'Sum',
+          kind: 'func',
+          locations: [
+            `${testDir}/geo/point.go:11:6`,
+            `${testDir}/main.go:10:18`,
+          ],
+        },
+      },
+      {
+        name: 'should resolve methods by their type and import path',
+        options: {
+          filePath: `${testDir}/main.go`,
+          symbol: 'example.com/refs/geo.Point.Add',
+        },
+        expected: {
+          symbol: 'Add',
+          kind: 'method',
+          locations: [
+            `${testDir}/geo/point.go:7:16`,
+            `${testDir}/geo/point_test.go:6:19`,
+          ],
+        },
+      },
+      {
+        name: 'should resolve fields of types in the same package',
+        options: { filePath: `${testDir}/geo/point.go`, symbol: 'Point.Y' },
+        expected: {
+          symbol: 'Y',
+          kind: 'field',
+          locations: [
+            `${testDir}/geo/point.go:4:5`,
+            `${testDir}/geo/point.go:8:29`,
+            `${testDir}/geo/point.go:8:34`,
+            `${testDir}/geo/point.go:8:40`,
+            `${testDir}/geo/point_test.go:6:29`,
+          ],
+        },
+      },
+    ];
+
+    testCases.forEach(({ name, options, expected }) => {
+      test(name, async () => {
+        const result = await performFindReferences(options);
+        expect(result.symbol).toBe(expected.symbol);
+        expect(result.kind).toBe(expected.kind);
+        expect(
+          result.references.map(r => `${r.filePath}:${r.line}:${r.column}`)
+        ).toEqual(expected.locations);
+      });
+    });
+
+    test('should list the declarations an ambiguous name matches', async () => {
+      mkdirSync(`${testDir}/stats`);
+      writeFileSync(
+        `${testDir}/stats/stats.go`,
+        'package stats\n\nfunc Sum(xs []int) int { return 0 }\n'
+      );
+      await expect(
+        performFindReferences({ filePath: `${testDir}/main.go`, symbol: 'Sum' })
+      ).rejects.toMatchObject({
+        code: 'ambiguous_location',
+        candidates: [
+          {
+            symbol: 'geo.Sum',
+            kind: 'func',
+            filePath: `${testDir}/geo/point.go`,
+            line: 11,
+            column: 6,
+          },
+          {
+            symbol: 'stats.Sum',
+            kind: 'func',
+            filePath: `${testDir}/stats/stats.go`,
+            line: 3,
+            column: 6,
+          },
+        ],
+      });
+    });
+
+    test('should mark the declaration and include a snippet', async () => {
+      const result = await performFindReferences({
+        filePath: `${testDir}/geo/point.go`,
+        line: 11,
+        column: 6,
+      });
+      expect(result.references[0]).toEqual({
+        filePath: `${testDir}/geo/point.go`,
+        line: 11,
+        column: 6,
+        snippet: 'func Sum(ps []Point) int {',
+        isDeclaration: true,
+      });
+      expect(result.references[1].isDeclaration).toBe(false);
+      expect(result.references[1].snippet).toBe(
+        'fmt.Println(geo.Sum([]geo.Point{{X: 1}}))'
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject positions without an identifier',
+        options: { filePath: `${testDir}/geo/point.go`, line: 2, column: 1 },
+        error: 'No identifier found at the given position',
+      },
+      {
+        name: 'should reject predeclared identifiers',
+        options: { filePath: `${testDir}/geo/point.go`, line: 4, column: 8 },
+        error: "'int' is a predeclared identifier",
+      },
+      {
+        name: 'should require a position',
+        options: { filePath: `${testDir}/geo/point.go` },
+        error: 'Either offset, line and column, or symbol must be provided',
+      },
+      {
+        name: 'should reject names that no declaration has',
+        options: { filePath: `${testDir}/main.go`, symbol: 'geo.Point.Z' },
+        error: "No declaration in the module is named 'geo.Point.Z'",
+      },
+      {
+        name: 'should reject malformed names',
+        options: { filePath: `${testDir}/main.go`, symbol: 'geo..Sum' },
+        error:
+          "'geo..Sum' is not a symbol name such as Lookup, Store.Get or store.Store.Get",
+      },
+      {
+        name: 'should reject a name together with a location',
+        options: {
+          filePath: `${testDir}/main.go`,
+          line: 1,
+          column: 1,
+          symbol: 'geo.Sum',
+        },
+        error: 'Give either a location or a symbol name, not both',
+      },
+      {
+        name: 'should require a module',
+        options: { filePath: '/nonexistent/dir/file.go', line: 1, column: 1 },
+        error: 'No go.mod found',
+      },
+    ];
+
+    errorCases.forEach(({ name, options, error }) => {
+      test(name, async () => {
+        await expect(performFindReferences(options)).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatFindReferencesResults', () => {
+    test('should format references with a summary and warnings', () => {
+      const output = formatFindReferencesResults({
+        symbol: 'Sum',
+        kind: 'func',
+        references: [
+          {
+            filePath: 'geo/point.go',
+            line: 11,
+            column: 6,
+            snippet: 'func Sum(ps []Point) int {',
+            isDeclaration: true,
+          },
+          {
+            filePath: 'main.go',
+            line: 10,
+            column: 18,
+            snippet: 'fmt.Println(geo.Sum(nil))',
+            isDeclaration: false,
+          },
+        ],
+        warnings: [
+          'geo/sum_windows.go is excluded by build constraints (file name suffix _windows)',
+        ],
+      });
+      expect(output).toBe(
+        'References to func Sum:\n' +
+          '  geo/point.go:11:6: func Sum(ps []Point) int { (declaration)\n' +
+          '  main.go:10:18: fmt.Println(geo.Sum(nil))\n' +
+          '\nTotal: 2 references in 2 files\n' +
+          '\nNot searched:\n' +
+          '  geo/sum_windows.go is excluded by build constraints (file name suffix _windows)'
+      );
+    });
+
+    test('should report when nothing is found', () => {
+      expect(
+        formatFindReferencesResults({
+          symbol: 'x',
+          kind: 'var',
+          references: [],
+          warnings: [],
+        })
+      ).toBe('No references found for x');
+    });
+  });
+});
@@ -0,0 +1,277 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performGenerateConstructor,
+  formatGenerateConstructorResults,
+} from '../../src/core/generate-constructor-tool.js';
+
+describe('Generate Constructor Tool', () => {
+  const testDir = 'tests/temp-generate-constructor';
+  const mainFile = `${testDir}/main.go`;
+  const otherFile = `${testDir}/other.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/gc\n\ngo 1.22\n');
+    writeFileSync(
+      mainFile,
+      `package main
+
+import "net/http"
+
+type Base struct{}
+
+// Server serves.
+type Server struct {
+	*Base
+	Addr, Host string
+	URL        string
+	Type       int
+	Client     *http.Client
+	_          int
+}
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type config struct {
+	config string
+}
+
+type Handler func()
+
+func main() {}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performGenerateConstructor', () => {
+    test('should take every field in order after the type', async () => {
+      const result = await performGenerateConstructor({
+        filePath: mainFile,
+        typeName: 'Server',
+      });
+      expect(result.parameters).toEqual([
+        'Base',
+        'Addr',
+        'Host',
+        'URL',
+        'Type',
+        'Client',
+      ]);
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        `	_          int
+}
+
+// NewServer returns a new Server.
+func NewServer(base *Base, addr, host string, url string, t int, client *http.Client) *Server {
+	return &Server{
+		Base:   base,
+		Addr:   addr,
+		Host:   host,
+		URL:    url,
+		Type:   t,
+		Client: client,
+	}
+}
+
+type Pair`
+      );
+    });
+
+    test('should leave the fields not chosen zero', async () => {
+      const result = await performGenerateConstructor({
+        filePath: mainFile,
+        typeName: 'Server',
+        fields: ['Client', 'Host'],
+        form: 'value',
+      });
+      expect(result.zero).toEqual(['Base', 'Addr', 'URL', 'Type']);
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        'func NewServer(host string, client *http.Client) Server {\n\treturn Server{\n\t\tHost:   host,\n\t\tClient: client,\n\t}\n}'
+      );
+    });
+
+    test('should keep the type parameters of generic types', async () => {
+      await performGenerateConstructor({
+        filePath: mainFile,
+        typeName: 'Pair',
+      });
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        'func NewPair[K comparable, V any](key K, value V) *Pair[K, V] {\n\treturn &Pair[K, V]{\n'
+      );
+    });
+
+    test('should name unexported constructors without hiding the type', async () => {
+      await performGenerateConstructor({
+        filePath: mainFile,
+        typeName: 'config',
+      });
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        '// newConfig returns a new config.\nfunc newConfig(config2 string) *config {\n\treturn &config{\n\t\tconfig: config2,\n\t}\n}'
+      );
+    });
+
+    test('should return an empty literal without fields', async () => {
+      await performGenerateConstructor({
+        filePath: mainFile,
+        typeName: 'Server',
+        fields: [],
+      });
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        'func NewServer() *Server {\n\treturn &Server{}\n}'
+      );
+    });
+
+    test('should replace an existing constructor where it is', async () => {
+      writeFileSync(
+        mainFile,
+        `package main
+
+type Pt struct{ X, Y int }
+
+func main() {}
+
+// NewPt makes a point.
+func NewPt() *Pt { return nil }
+`
+      );
+      const result = await performGenerateConstructor({
+        filePath: mainFile,
+        typeName: 'Pt',
+      });
+      expect(result.replaced).toBe(true);
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        'func main() {}\n\n// NewPt makes a point.\nfunc NewPt(x, y int) *Pt {\n'
+      );
+      const again = await performGenerateConstructor({
+        filePath: mainFile,
+        typeName: 'Pt',
+      });
+      expect(again.changes).toEqual([]);
+    });
+
+    test('should move a constructor declared in another file', async () => {
+      writeFileSync(
+        otherFile,
+        `package main
+
+import "fmt"
+
+// newConfig makes a config.
+func newConfig() *config {
+	fmt.Println()
+	return nil
+}
+`
+      );
+      const result = await performGenerateConstructor({
+        filePath: otherFile,
+        typeName: 'config',
+      });
+      expect(result.changes).toHaveLength(2);
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        '}\n\n// newConfig makes a config.\nfunc newConfig('
+      );
+      expect(readFileSync(otherFile, 'utf-8')).toBe('package main\n');
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject unknown fields',
+        typeName: 'Pair',
+        fields: ['Key', 'Val'],
+        error: "'Pair' has no field 'Val'; its fields are Key, Value",
+      },
+      {
+        name: 'should reject types that are not structs',
+        typeName: 'Handler',
+        error: "'Handler' is not declared as a struct type",
+      },
+      {
+        name: 'should reject types of other packages',
+        typeName: 'Client',
+        error: "'Client' is not a type declared in package main",
+      },
+    ];
+
+    errorCases.forEach(({ name, typeName, fields, error }) => {
+      test(name, async () => {
+        await expect(
+          performGenerateConstructor({ filePath: mainFile, typeName, fields })
+        ).rejects.toThrow(error);
+      });
+    });
+
+    test('should reject names declared otherwise', async () => {
+      writeFileSync(otherFile, 'package main\n\nvar NewPair = 1\n');
+      await expect(
+        performGenerateConstructor({ filePath: mainFile, typeName: 'Pair' })
+      ).rejects.toThrow(
+        'Package main already declares NewPair at tests/temp-generate-constructor/other.go:3:5, which is not a function'
+      );
+    });
+
+    test('should not modify files in dry run mode', async () => {
+      const original = readFileSync(mainFile, 'utf-8');
+      const result = await performGenerateConstructor({
+        filePath: mainFile,
+        typeName: 'Pair',
+        dryRun: true,
+      });
+      expect(result.changes).toHaveLength(1);
+      expect(readFileSync(mainFile, 'utf-8')).toBe(original);
+    });
+  });
+
+  describe('formatGenerateConstructorResults', () => {
+    test('should report the parameters and the zero fields', () => {
+      expect(
+        formatGenerateConstructorResults({
+          typeName: 'Server',
+          constructorName: 'NewServer',
+          form: 'pointer',
+          parameters: ['Addr'],
+          zero: ['conns'],
+          replaced: false,
+          changes: [{ filePath: 'main.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Generated NewServer returning *Server, with 1 parameter for Addr\nLeft zero: conns\n\nModified 1 file:\n  main.go'
+      );
+    });
+
+    test('should report constructors that are up to date', () => {
+      expect(
+        formatGenerateConstructorResults({
+          typeName: 'Pt',
+          constructorName: 'NewPt',
+          form: 'value',
+          parameters: [],
+          zero: [],
+          replaced: true,
+          changes: [],
+          dryRun: false,
+        })
+      ).toBe("The constructor NewPt of 'Pt' is up to date");
+    });
+  });
+});
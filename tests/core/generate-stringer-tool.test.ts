@@ -0,0 +1,185 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performGenerateStringer,
+  formatGenerateStringerResults,
+} from '../../src/core/generate-stringer-tool.js';
+
+describe('Generate Stringer Tool', () => {
+  const testDir = 'tests/temp-generate-stringer';
+  const colorFile = `${testDir}/color.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/enum\n\ngo 1.22\n');
+    writeFileSync(
+      colorFile,
+      `package enum
+
+type Color int
+
+const (
+	Red Color = iota + 1
+	Green
+	Blue
+	Crimson = Red
+)
+
+type Flag uint8
+
+const (
+	Read Flag = 1 << iota
+	Write
+	Exec
+)
+
+type Name string
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  const generate = (typeName: string) =>
+    performGenerateStringer({ filePath: colorFile, typeName });
+
+  describe('performGenerateStringer', () => {
+    test('should name contiguous values from a table', async () => {
+      const result = await generate('Color');
+      expect(result.strategy).toBe('table');
+      expect(result.constants).toEqual(['Red', 'Green', 'Blue']);
+      expect(result.duplicates).toEqual(['Crimson']);
+      const content = readFileSync(colorFile, 'utf-8');
+      expect(content).toContain('package enum\n\nimport "strconv"\n');
+      expect(content).toContain(
+        `	Crimson = Red
+)
+
+// String returns the name of the Color constant equal to c.
+func (c Color) String() string {
+	const names = "RedGreenBlue"
+	offsets := [...]uint8{0, 3, 8, 12}
+	i := c - 1
+	if i < 0 || i >= Color(len(offsets)-1) {
+		return "Color(" + strconv.FormatInt(int64(c), 10) + ")"
+	}
+	return names[offsets[i]:offsets[i+1]]
+}
+
+type Flag uint8`
+      );
+    });
+
+    test('should switch on values that are not contiguous', async () => {
+      const result = await generate('Flag');
+      expect(result.strategy).toBe('switch');
+      expect(readFileSync(colorFile, 'utf-8')).toContain(
+        `func (f Flag) String() string {
+	switch f {
+	case Read:
+		return "Read"
+	case Write:
+		return "Write"
+	case Exec:
+		return "Exec"
+	}
+	return "Flag(" + strconv.FormatUint(uint64(f), 10) + ")"
+}
+`
+      );
+    });
+
+    test('should replace an existing String method', async () => {
+      writeFileSync(
+        `${testDir}/format.go`,
+        `package enum
+
+import "fmt"
+
+// String formats c.
+func (color Color) String() string { return fmt.Sprint(int(color)) }
+`
+      );
+      const result = await generate('Color');
+      expect(result.replaced).toBe(true);
+      const content = readFileSync(`${testDir}/format.go`, 'utf-8');
+      expect(content).toContain('import (\n\t"strconv"\n)');
+      expect(content).toContain('func (color Color) String() string {');
+      expect(content).not.toContain('fmt');
+      expect(readFileSync(colorFile, 'utf-8')).not.toContain('String');
+    });
+
+    test('should change nothing when run again', async () => {
+      await generate('Color');
+      const content = readFileSync(colorFile, 'utf-8');
+      const result = await generate('Color');
+      expect(result.changes).toEqual([]);
+      expect(readFileSync(colorFile, 'utf-8')).toBe(content);
+      expect(formatGenerateStringerResults(result)).toBe(
+        "The String method of 'Color' is up to date"
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject types that are not integers',
+        typeName: 'Name',
+        error: "'Name' is not an integer type",
+      },
+      {
+        name: 'should reject types without constants',
+        typeName: 'Level',
+        extra: '\ntype Level int\n',
+        error: "Package enum declares no constants of type 'Level'",
+      },
+      {
+        name: 'should reject unknown types',
+        typeName: 'Missing',
+        error: "'Missing' is not a type declared in package enum",
+      },
+    ];
+
+    errorCases.forEach(({ name, typeName, extra, error }) => {
+      test(name, async () => {
+        if (extra) {
+          writeFileSync(colorFile, readFileSync(colorFile, 'utf-8') + extra);
+        }
+        const original = readFileSync(colorFile, 'utf-8');
+        await expect(generate(typeName)).rejects.toThrow(error);
+        expect(readFileSync(colorFile, 'utf-8')).toBe(original);
+      });
+    });
+  });
+
+  describe('formatGenerateStringerResults', () => {
+    test('should list the named and left out constants', () => {
+      expect(
+        formatGenerateStringerResults({
+          typeName: 'Color',
+          constants: ['Red', 'Green'],
+          duplicates: ['Crimson'],
+          strategy: 'switch',
+          replaced: true,
+          changes: [{ filePath: 'color.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Regenerated String for 'Color', naming 2 constants in a switch: Red, Green\nLeft out, since an earlier constant has the same value: Crimson\n\nModified 1 file:\n  color.go"
+      );
+    });
+  });
+});
@@ -0,0 +1,213 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performGenerateTests,
+  formatGenerateTestsResults,
+} from '../../src/core/generate-tests-tool.js';
+
+describe('Generate Tests Tool', () => {
+  const testDir = 'tests/temp-generate-tests';
+  const calcFile = `${testDir}/calc/calc.go`;
+  const testFile = `${testDir}/calc/calc_test.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/calc`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/gen\n\ngo 1.22\n');
+    writeFileSync(
+      calcFile,
+      `package calc
+
+import "errors"
+
+type Counter struct{ n int }
+
+func (c *Counter) Add(d int) int {
+	c.n += d
+	return c.n
+}
+
+func Scale(a, b int) int { return a * b }
+
+func Split(s string, parts ...int) ([]string, error) {
+	if s == "" {
+		return nil, errors.New("empty")
+	}
+	return []string{s}, nil
+}
+
+type item struct{ name string }
+
+func check(name item) error { return nil }
+
+func Max[T int | float64](a, b T) T { return a }
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Locates the first occurrence of text in calc.go.
+  const at = (text: string) => {
+    const lines = readFileSync(calcFile, 'utf-8').split('\n');
+    const line = lines.findIndex(l => l.includes(text));
+    return {
+      filePath: calcFile,
+      line: line + 1,
+      column: lines[line].indexOf(text) + 1,
+    };
+  };
+
+  describe('performGenerateTests', () => {
+    test('should create the test file with a table-driven test', async () => {
+      const result = await performGenerateTests(at('Scale(a'));
+      expect(result.testName).toBe('TestScale');
+      expect(result.created).toBe(true);
+      expect(readFileSync(testFile, 'utf-8')).toBe(`package calc
+
+import "testing"
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name string
+		a    int
+		b    int
+		want int
+	}{
+		// TODO: Add test cases.
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Scale(tt.a, tt.b)
+			if got != tt.want {
+				t.Errorf("Scale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+`);
+    });
+
+    test('should check errors and compare slices deeply', async () => {
+      await performGenerateTests(at('Split(s'));
+      const content = readFileSync(testFile, 'utf-8');
+      expect(content).toContain('import (\n\t"reflect"\n\t"testing"\n)\n');
+      expect(content).toContain('\t\twantErr bool\n');
+      expect(content).toContain(
+        `			got, err := Split(tt.s, tt.parts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Split() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+`
+      );
+    });
+
+    test('should call methods on a receiver field', async () => {
+      const result = await performGenerateTests(at('Add(d'));
+      expect(result.testName).toBe('TestCounter_Add');
+      const content = readFileSync(testFile, 'utf-8');
+      expect(content).toContain('\t\treceiver *Counter\n');
+      expect(content).toContain('\t\t\tgot := tt.receiver.Add(tt.d)\n');
+    });
+
+    test('should rename fields that clash and test functions returning only an error', async () => {
+      await performGenerateTests(at('check(name'));
+      const content = readFileSync(testFile, 'utf-8');
+      expect(content).toContain('func TestCheck(t *testing.T) {\n');
+      expect(content).toContain(
+        '\t\t\tif err := check(tt.name1); (err != nil) != tt.wantErr {\n'
+      );
+    });
+
+    test('should use the external test package of the other tests', async () => {
+      writeFileSync(
+        `${testDir}/calc/other_test.go`,
+        'package calc_test\n\nimport "testing"\n\nfunc TestOther(t *testing.T) {}\n'
+      );
+      const result = await performGenerateTests(at('Scale(a'));
+      expect(result.packageName).toBe('calc_test');
+      const content = readFileSync(testFile, 'utf-8');
+      expect(content).toContain('package calc_test\n');
+      expect(content).toContain('"example.com/gen/calc"');
+      expect(content).toContain('\t\t\tgot := calc.Scale(tt.a, tt.b)\n');
+    });
+
+    test('should append to an existing test file', async () => {
+      await performGenerateTests(at('Scale(a'));
+      const result = await performGenerateTests(at('Add(d'));
+      expect(result.created).toBe(false);
+      const content = readFileSync(testFile, 'utf-8');
+      expect(content).toContain('}\n\nfunc TestCounter_Add(t *testing.T) {\n');
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const result = await performGenerateTests({
+        ...at('Scale(a'),
+        dryRun: true,
+      });
+      expect(existsSync(testFile)).toBe(false);
+      expect(formatGenerateTestsResults(result)).toContain(
+        'Dry run: 1 file would be changed'
+      );
+    });
+
+    test('should reject tests that already exist', async () => {
+      await performGenerateTests(at('Scale(a'));
+      await expect(performGenerateTests(at('Scale(a'))).rejects.toThrow(
+        "'TestScale' is already declared in package calc"
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject generic functions',
+        text: 'Max[T',
+        error: "Cannot generate tests for the generic function 'Max'",
+      },
+      {
+        name: 'should reject types',
+        text: 'Counter struct',
+        error: "'Counter' is not a function or method declared in the module",
+      },
+    ];
+
+    errorCases.forEach(({ name, text, error }) => {
+      test(name, async () => {
+        await expect(performGenerateTests(at(text))).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatGenerateTestsResults', () => {
+    test('should report the test and its file', () => {
+      expect(
+        formatGenerateTestsResults({
+          functionName: 'Scale',
+          testName: 'TestScale',
+          testFile: 'calc_test.go',
+          packageName: 'calc',
+          created: true,
+          changes: [{ filePath: 'calc_test.go', original: '', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Generated TestScale for 'Scale' in calc_test.go (new file), package calc\n\nModified 1 file:\n  calc_test.go"
+      );
+    });
+  });
+});
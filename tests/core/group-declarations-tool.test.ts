@@ -0,0 +1,256 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performGroupDeclarations,
+  formatGroupDeclarationsResults,
+} from '../../src/core/group-declarations-tool.js';
+
+describe('Group Declarations Tool', () => {
+  const testDir = 'tests/temp-group-declarations';
+  const mainFile = `${testDir}/main.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/group\n\ngo 1.22\n');
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  const group = async (src: string) => {
+    writeFileSync(mainFile, `package main\n\n${src}`);
+    const result = await performGroupDeclarations({ filePath: mainFile });
+    return { result, content: readFileSync(mainFile, 'utf-8') };
+  };
+
+  describe('performGroupDeclarations', () => {
+    const testCases = [
+      {
+        name: 'should align the specs of merged const declarations',
+        src: `// Version of the server.
+const Version = "1.0"
+const Port int = 8080 // default port
+`,
+        expected: `const (
+	// Version of the server.
+	Version     = "1.0"
+	Port    int = 8080 // default port
+)
+`,
+      },
+      {
+        name: 'should merge groups and keep empty lines between declarations',
+        src: `// Limits.
+const (
+	Min = 0 // lowest
+)
+const Max = 10
+
+// Step doc.
+const (
+	// Step is the increment.
+	Step = 1
+	// more to come
+)
+`,
+        expected: `// Limits.
+const (
+	Min = 0 // lowest
+	Max = 10
+
+	// Step doc.
+	// Step is the increment.
+	Step = 1
+	// more to come
+)
+`,
+      },
+      {
+        name: 'should sort and deduplicate merged imports',
+        src: `import "os" // files
+import io "strings"
+import "fmt"
+import "os" // files
+
+var _, _, _ = os.Args, io.ToUpper, fmt.Println
+`,
+        expected: `import (
+	"fmt"
+	"os" // files
+	io "strings"
+)
+
+var _, _, _ = os.Args, io.ToUpper, fmt.Println
+`,
+      },
+      {
+        name: 'should indent specs spanning several lines',
+        src: `var short = 1
+var numbers = []int{
+	1,
+	2,
+}
+var raw = \`a
+  b\`
+`,
+        expected: `var (
+	short   = 1
+	numbers = []int{
+		1,
+		2,
+	}
+	raw = \`a
+  b\`
+)
+`,
+      },
+      {
+        name: 'should keep declarations separated by comments or other code apart',
+        src: `var a = 1
+
+// Unrelated.
+
+var b = 2
+
+func f() {}
+
+var c = 3
+var d = 4 /* block */
+var e = 5
+`,
+        expected: `var a = 1
+
+// Unrelated.
+
+var b = 2
+
+func f() {}
+
+var c = 3
+var d = 4 /* block */
+var e = 5
+`,
+      },
+      {
+        name: 'should not move const declarations using iota into a group',
+        src: `const Start = 1
+const (
+	A = iota
+	B
+)
+const C = iota
+const D = 4
+`,
+        expected: `const Start = 1
+const (
+	A = iota
+	B
+)
+const (
+	C = iota
+	D = 4
+)
+`,
+      },
+      {
+        name: 'should merge const declarations using a constant named iota',
+        src: `const iota = 7
+const A = 1
+const B = iota
+`,
+        expected: `const (
+	iota = 7
+	A    = 1
+	B    = iota
+)
+`,
+      },
+    ];
+
+    testCases.forEach(({ name, src, expected }) => {
+      test(name, async () => {
+        const { content } = await group(src);
+        expect(content).toBe(`package main\n\n${expected}`);
+      });
+    });
+
+    test('should be idempotent', async () => {
+      const { content } = await group(testCases[1].src);
+      const again = await performGroupDeclarations({ filePath: mainFile });
+      expect(again.groups).toEqual([]);
+      expect(again.changes).toEqual([]);
+      expect(readFileSync(mainFile, 'utf-8')).toBe(content);
+    });
+
+    test('should report each new group', async () => {
+      const { result } = await group(
+        'import "fmt"\nimport "os"\n\nconst a = 1\nconst b = 2\nconst c = 3\n\nvar _ = fmt.Sprint(os.Args)\n'
+      );
+      expect(result.groups).toEqual([
+        {
+          keyword: 'import',
+          location: `${mainFile}:3:1`,
+          declarations: 2,
+        },
+        {
+          keyword: 'const',
+          location: `${mainFile}:6:1`,
+          declarations: 3,
+        },
+      ]);
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const src = 'package main\n\nvar a = 1\nvar b = 2\n';
+      writeFileSync(mainFile, src);
+      const result = await performGroupDeclarations({
+        filePath: mainFile,
+        dryRun: true,
+      });
+      expect(readFileSync(mainFile, 'utf-8')).toBe(src);
+      const output = formatGroupDeclarationsResults(result);
+      expect(output).toContain('+var (\n+\ta = 1\n+\tb = 2\n+)\n');
+      expect(output).toContain('Dry run: 1 file would be changed');
+    });
+  });
+
+  describe('formatGroupDeclarationsResults', () => {
+    test('should list the groups and modified file', () => {
+      expect(
+        formatGroupDeclarationsResults({
+          filePath: 'main.go',
+          groups: [
+            { keyword: 'var', location: 'main.go:3:1', declarations: 2 },
+          ],
+          changes: [{ filePath: 'main.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Grouped declarations into 1 block:\n  var at main.go:3:1: 2 declarations\n\nModified 1 file:\n  main.go'
+      );
+    });
+
+    test('should say when there is nothing to group', () => {
+      expect(
+        formatGroupDeclarationsResults({
+          filePath: 'main.go',
+          groups: [],
+          changes: [],
+          dryRun: false,
+        })
+      ).toBe('No adjacent declarations to group in main.go');
+    });
+  });
+});
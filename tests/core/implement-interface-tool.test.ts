@@ -0,0 +1,219 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performImplementInterface,
+  formatImplementInterfaceResults,
+} from '../../src/core/implement-interface-tool.js';
+
+describe('Implement Interface Tool', () => {
+  const testDir = 'tests/temp-implement-interface';
+  const memFile = `${testDir}/mem/mem.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/store`, { recursive: true });
+    mkdirSync(`${testDir}/mem`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/impl\n\ngo 1.22\n');
+    writeFileSync(
+      `${testDir}/store/store.go`,
+      `package store
+
+import (
+	"context"
+	"io"
+)
+
+type Closer interface {
+	Close() error
+}
+
+type Store interface {
+	Closer
+	Get(ctx context.Context, key string) (string, error)
+	Dump(w io.Writer, keys ...string) (n int, err error)
+}
+
+type Config struct{}
+
+type Configurer interface {
+	Configure(c Config)
+}
+
+type Namer interface {
+	Name() int
+}
+
+type Stringer interface {
+	String() error
+}
+`
+    );
+    writeFileSync(
+      memFile,
+      `package mem
+
+import "context"
+
+type Mem struct {
+	data map[string]string
+	Name string
+}
+
+func (s *Mem) Get(ctx context.Context, key string) (string, error) {
+	return s.data[key], nil
+}
+
+type Empty struct{}
+
+type Val int
+
+func (v Val) String() string { return "" }
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performImplementInterface', () => {
+    test('should stub missing methods after the existing ones', async () => {
+      const result = await performImplementInterface({
+        filePath: memFile,
+        typeName: 'Mem',
+        interfaceName: 'store.Store',
+      });
+      expect(result.added).toEqual(['Dump', 'Close']);
+      expect(result.implementedBy).toBe('*Mem');
+      const content = readFileSync(memFile, 'utf-8');
+      expect(content).toContain('import (\n\t"context"\n\t"io"\n)\n');
+      expect(content).toContain(
+        '\treturn s.data[key], nil\n}\n\n// Dump implements store.Store.\nfunc (s *Mem) Dump(w io.Writer, keys ...string) (n int, err error) {\n\tpanic("not implemented")\n}\n\n// Close implements store.Store.\nfunc (s *Mem) Close() error {\n\tpanic("not implemented")\n}\n\ntype Empty'
+      );
+    });
+
+    test('should follow value receivers and qualify types', async () => {
+      const result = await performImplementInterface({
+        filePath: memFile,
+        typeName: 'Val',
+        interfaceName: 'store.Configurer',
+      });
+      expect(result.implementedBy).toBe('Val');
+      const content = readFileSync(memFile, 'utf-8');
+      expect(content).toContain('\t"example.com/impl/store"\n');
+      expect(content).toContain(
+        'func (v Val) Configure(c store.Config) {\n\tpanic("not implemented")\n}\n'
+      );
+    });
+
+    test('should use pointer receivers for types without methods', async () => {
+      await performImplementInterface({
+        filePath: memFile,
+        typeName: 'Empty',
+        interfaceName: 'store.Closer',
+      });
+      expect(readFileSync(memFile, 'utf-8')).toContain(
+        'type Empty struct{}\n\n// Close implements store.Closer.\nfunc (e *Empty) Close() error {'
+      );
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(memFile, 'utf-8');
+      const result = await performImplementInterface({
+        filePath: memFile,
+        typeName: 'Empty',
+        interfaceName: 'store.Closer',
+        dryRun: true,
+      });
+      expect(readFileSync(memFile, 'utf-8')).toBe(original);
+      const output = formatImplementInterfaceResults(result);
+      expect(output).toContain('+func (e *Empty) Close() error {\n');
+      expect(output).toContain('Dry run: 1 file would be changed');
+    });
+
+    test('should report types that already implement the interface', async () => {
+      await performImplementInterface({
+        filePath: memFile,
+        typeName: 'Empty',
+        interfaceName: 'store.Closer',
+      });
+      const again = await performImplementInterface({
+        filePath: memFile,
+        typeName: 'Empty',
+        interfaceName: 'store.Closer',
+      });
+      expect(again.added).toEqual([]);
+      expect(formatImplementInterfaceResults(again)).toBe(
+        '*Empty already implements store.Closer'
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject unknown types',
+        typeName: 'Missing',
+        interfaceName: 'store.Closer',
+        error: "'Missing' is not a type declared in package mem",
+      },
+      {
+        name: 'should reject names that are not interfaces',
+        typeName: 'Mem',
+        interfaceName: 'Val',
+        error: "'Val' is not an interface declared in the module",
+      },
+      {
+        name: 'should reject interfaces outside the module',
+        typeName: 'Mem',
+        interfaceName: 'context.Context',
+        error: 'Package context is outside the module',
+      },
+      {
+        name: 'should reject methods that clash with fields',
+        typeName: 'Mem',
+        interfaceName: 'store.Namer',
+        error: "'Mem' has a field Name",
+      },
+      {
+        name: 'should reject methods with a different signature',
+        typeName: 'Val',
+        interfaceName: 'store.Stringer',
+        error: "'Val' already has a method String, but its signature differs",
+      },
+    ];
+
+    errorCases.forEach(({ name, error, ...options }) => {
+      test(name, async () => {
+        await expect(
+          performImplementInterface({ filePath: memFile, ...options })
+        ).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatImplementInterfaceResults', () => {
+    test('should list the added methods', () => {
+      expect(
+        formatImplementInterfaceResults({
+          interfaceName: 'store.Closer',
+          implementedBy: '*Mem',
+          added: ['Close'],
+          changes: [{ filePath: 'mem.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Added 1 method so that *Mem implements store.Closer: Close\n\nModified 1 file:\n  mem.go'
+      );
+    });
+  });
+});
@@ -0,0 +1,193 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performInlineConstant,
+  formatInlineConstantResults,
+} from '../../src/core/inline-constant-tool.js';
+
+describe('Inline Constant Tool', () => {
+  const testDir = 'tests/temp-inline-constant';
+  const levelFile = `${testDir}/level/level.go`;
+  const appFile = `${testDir}/app/app.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/level`, { recursive: true });
+    mkdirSync(`${testDir}/app`, { recursive: true });
+
+    writeFileSync(
+      `${testDir}/go.mod`,
+      'module example.com/consts\n\ngo 1.22\n'
+    );
+    writeFileSync(
+      levelFile,
+      `package level
+
+type Level int
+
+const (
+	Low Level = iota
+	Mid
+	High
+)
+
+const base = 10
+
+// Limit is the largest level.
+const Limit = base * 2
+
+const Neg = -4
+
+const letter = 'a'
+
+func Scaled(n int) int {
+	const step = 3
+	return n*Limit + step - -Neg
+}
+
+func Letter() rune { return letter }
+
+func Levels() []Level { return []Level{Low, Mid, High} }
+`
+    );
+    writeFileSync(
+      appFile,
+      `package app
+
+import "example.com/consts/level"
+
+func Top() (level.Level, int) {
+	return level.High, level.Limit + 1
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  const inline = (line: number, column: number, filePath = levelFile) =>
+    performInlineConstant({ filePath, line, column });
+
+  describe('performInlineConstant', () => {
+    test('should inline the expression with parentheses', async () => {
+      const result = await inline(14, 7);
+      expect(result.uses).toBe(2);
+      expect(result.declaration).toBe('removed');
+      const content = readFileSync(levelFile, 'utf-8');
+      expect(content).toContain('const base = 10\n\nconst Neg = -4\n');
+      expect(content).toContain('return n*(base * 2) + step - -Neg');
+      expect(readFileSync(appFile, 'utf-8')).toContain(
+        'return level.High, 20 + 1'
+      );
+    });
+
+    test('should convert uses of typed constants to their type', async () => {
+      const result = await inline(6, 15, appFile);
+      expect(result.value).toBe('2');
+      expect(readFileSync(appFile, 'utf-8')).toContain(
+        'return level.Level(2), level.Limit + 1'
+      );
+      const content = readFileSync(levelFile, 'utf-8');
+      expect(content).toContain('const (\n\tLow Level = iota\n\tMid\n)');
+      expect(content).toContain('[]Level{Low, Mid, Level(2)}');
+    });
+
+    test('should keep constants after it as they are', async () => {
+      const result = await inline(7, 2);
+      expect(result.declaration).toBe('blank');
+      const content = readFileSync(levelFile, 'utf-8');
+      expect(content).toContain('\tLow Level = iota\n\t_\n\tHigh\n');
+      expect(content).toContain('[]Level{Low, Level(1), High}');
+    });
+
+    test('should keep negative values apart from operators', async () => {
+      await inline(16, 7);
+      expect(readFileSync(levelFile, 'utf-8')).toContain(
+        'return n*Limit + step - -(-4)'
+      );
+    });
+
+    test('should inline local constants', async () => {
+      await inline(21, 8);
+      const content = readFileSync(levelFile, 'utf-8');
+      expect(content).toContain(
+        'func Scaled(n int) int {\n\treturn n*Limit + 3 - -Neg\n}'
+      );
+    });
+
+    test('should keep untyped constants untyped', async () => {
+      await inline(18, 7);
+      expect(readFileSync(levelFile, 'utf-8')).toContain(
+        "func Letter() rune { return 'a' }"
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject variables',
+        extra: '\nvar count = 1\n\nfunc Count() int { return count }\n',
+        line: 29,
+        column: 5,
+        error: "'count' is not a constant declared in the module",
+      },
+      {
+        name: 'should reject unused constants',
+        extra: '\nconst unused = 1\n',
+        line: 29,
+        column: 7,
+        error: "'unused' is never used",
+      },
+      {
+        name: 'should reject values the other package cannot write',
+        extra: '\nconst Pi = 3.14159\n\nconst Tau = 2 * Pi\n',
+        appExtra: '\nvar tau = level.Tau\n',
+        line: 31,
+        column: 7,
+        error:
+          "Cannot inline 'Tau' at tests/temp-inline-constant/app/app.go:9:11, where the names in its expression do not refer to the same declarations",
+      },
+    ];
+
+    errorCases.forEach(({ name, extra, appExtra, line, column, error }) => {
+      test(name, async () => {
+        writeFileSync(levelFile, readFileSync(levelFile, 'utf-8') + extra);
+        if (appExtra) {
+          writeFileSync(appFile, readFileSync(appFile, 'utf-8') + appExtra);
+        }
+        const original = readFileSync(levelFile, 'utf-8');
+        await expect(inline(line, column)).rejects.toThrow(error);
+        expect(readFileSync(levelFile, 'utf-8')).toBe(original);
+      });
+    });
+  });
+
+  describe('formatInlineConstantResults', () => {
+    test('should say what happened to the declaration', () => {
+      expect(
+        formatInlineConstantResults({
+          name: 'Mid',
+          value: '1',
+          uses: 1,
+          declaration: 'blank',
+          warnings: [],
+          changes: [{ filePath: 'level.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Inlined constant 'Mid' (1) at 1 use, renaming its declaration to _ so that the constants after it keep their values\n\nModified 1 file:\n  level.go"
+      );
+    });
+  });
+});
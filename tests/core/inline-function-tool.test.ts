@@ -0,0 +1,301 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performInlineFunction,
+  formatInlineFunctionResults,
+} from '../../src/core/inline-function-tool.js';
+
+describe('Inline Function Tool', () => {
+  const testDir = 'tests/temp-inline-function';
+  const mainFile = `${testDir}/main.go`;
+  const calcFile = `${testDir}/calc/calc.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/calc`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/inline\n\ngo 1.22\n');
+    writeFileSync(
+      calcFile,
+      `package calc
+
+import "strings"
+
+const Base = 10
+
+func Scale(x int) int {
+	return x * Base
+}
+
+func Shout(s string) string {
+	return strings.ToUpper(s) + "!"
+}
+
+func secret() int { return 1 }
+
+func Hidden() int { return secret() }
+`
+    );
+    writeFileSync(
+      mainFile,
+      `package main
+
+import (
+	"fmt"
+
+	"example.com/inline/calc"
+)
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func square(n int) int { return n * n }
+
+func report(n int) {
+	total := n * 2
+	fmt.Println("total", total)
+}
+
+func log(msg string) {
+	if msg == "" {
+		return
+	}
+	fmt.Println(msg)
+}
+
+func check(n int) error {
+	if n < 0 {
+		return fmt.Errorf("negative: %d", n)
+	}
+	return nil
+}
+
+func run(n int) error {
+	return check(n)
+}
+
+func fact(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return n * fact(n-1)
+}
+
+func inc(n int) int { return n + 1 }
+
+func apply(f func(int) int) int { return f(1) }
+
+func later() {
+	defer fmt.Println("done")
+}
+
+func next() int { return 1 }
+
+func pick(n int) int {
+	m := n % 2
+	return m
+}
+
+func main() {
+	total := 3
+	a := abs(total - 5)
+	fmt.Println(square(a) + 1)
+	report(a)
+	log(fmt.Sprint(a))
+	fmt.Println(run(a))
+	fmt.Println(calc.Scale(a), calc.Shout("hey"))
+	fmt.Println(apply(inc), fact(3), calc.Hidden())
+	later()
+	fmt.Println(next(), pick(a))
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  const locate = (file: string, name: string) => {
+    const lines = readFileSync(file, 'utf-8').split('\n');
+    return {
+      filePath: file,
+      line: lines.findIndex(l => l.startsWith(`func ${name}(`)) + 1,
+      column: 6,
+    };
+  };
+
+  describe('performInlineFunction', () => {
+    const testCases = [
+      {
+        name: 'should turn early returns into assignments',
+        function: 'abs',
+        contains: [
+          '\tx := total - 5\n\tvar a int\n\tif x < 0 {\n\t\ta = -x\n\t} else {\n\t\ta = x\n\t}\n',
+        ],
+      },
+      {
+        name: 'should substitute single-expression bodies',
+        function: 'square',
+        contains: ['\tfmt.Println(a * a + 1)\n'],
+      },
+      {
+        name: 'should rename locals colliding with the caller',
+        function: 'report',
+        contains: ['\ttotal1 := a * 2\n\tfmt.Println("total", total1)\n'],
+      },
+      {
+        name: 'should invert conditions guarding a bare return',
+        function: 'log',
+        contains: [
+          '\tvar msg string = fmt.Sprint(a)\n\tif msg != "" {\n\t\tfmt.Println(msg)\n\t}\n',
+        ],
+      },
+      {
+        name: 'should keep early returns when the caller returns the result',
+        function: 'check',
+        contains: [
+          'func run(n int) error {\n\tif n < 0 {\n\t\treturn fmt.Errorf("negative: %d", n)\n\t}\n\treturn nil\n}',
+        ],
+      },
+    ];
+
+    testCases.forEach(({ name, function: fn, contains }) => {
+      test(name, async () => {
+        const result = await performInlineFunction(locate(mainFile, fn));
+        const content = readFileSync(mainFile, 'utf-8');
+        expect(content).not.toContain(`func ${fn}(`);
+        expect(result.callSites.length).toBeGreaterThan(0);
+        for (const text of contains) {
+          expect(content).toContain(text);
+        }
+      });
+    });
+
+    test('should qualify members of the inlined package', async () => {
+      await performInlineFunction(locate(calcFile, 'Scale'));
+      await performInlineFunction(locate(calcFile, 'Shout'));
+      const content = readFileSync(mainFile, 'utf-8');
+      expect(content).toContain('\t"fmt"\n\t"strings"\n');
+      expect(content).toContain(
+        'fmt.Println(a * calc.Base, strings.ToUpper("hey") + "!")'
+      );
+      const calc = readFileSync(calcFile, 'utf-8');
+      expect(calc).not.toContain('import "strings"');
+      expect(calc).not.toContain('func Scale');
+    });
+
+    test('should keep the comments and empty lines of the body', async () => {
+      const showFile = `${testDir}/show.go`;
+      writeFileSync(
+        showFile,
+        `package main
+
+func show(n int) {
+	// First.
+	println(n) // one
+
+	/* Second. */
+	println(n + 1)
+}
+
+func run() {
+	show(3)
+	println("x")
+}
+`
+      );
+      await performInlineFunction(locate(showFile, 'show'));
+      expect(readFileSync(showFile, 'utf-8')).toBe(`package main
+
+func run() {
+	// First.
+	println(3) // one
+
+	/* Second. */
+	println(3 + 1)
+	println("x")
+}
+`);
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(mainFile, 'utf-8');
+      const result = await performInlineFunction({
+        ...locate(mainFile, 'report'),
+        dryRun: true,
+      });
+      expect(readFileSync(mainFile, 'utf-8')).toBe(original);
+      const output = formatInlineFunctionResults(result);
+      expect(output).toContain('-func report(n int) {\n');
+      expect(output).toContain('+\ttotal1 := a * 2\n');
+      expect(output).toContain('Dry run: 1 file would be changed');
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject recursive functions',
+        function: 'fact',
+        error: "Cannot inline the recursive function 'fact'",
+      },
+      {
+        name: 'should reject functions used as values',
+        function: 'inc',
+        error: "Cannot inline 'inc', which is used as a value at",
+      },
+      {
+        name: 'should reject functions with defer statements',
+        function: 'later',
+        error: "Cannot inline 'later', whose defer statements would run",
+      },
+      {
+        name: 'should reject calls that cannot be preceded by statements',
+        function: 'pick',
+        error: 'which is preceded by other calls in the same statement',
+      },
+    ];
+
+    errorCases.forEach(({ name, function: fn, error }) => {
+      test(name, async () => {
+        await expect(
+          performInlineFunction(locate(mainFile, fn))
+        ).rejects.toThrow(error);
+      });
+    });
+
+    test('should reject unexported members of another package', async () => {
+      await expect(
+        performInlineFunction(locate(calcFile, 'Hidden'))
+      ).rejects.toThrow("'Hidden' uses 'secret', which is not exported");
+    });
+  });
+
+  describe('formatInlineFunctionResults', () => {
+    test('should list the call sites and modified files', () => {
+      expect(
+        formatInlineFunctionResults({
+          functionName: 'abs',
+          callSites: ['main.go:12:7'],
+          changes: [{ filePath: 'main.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Inlined 'abs' at 1 call site:\n  main.go:12:7\n\nModified 1 file:\n  main.go"
+      );
+    });
+  });
+});
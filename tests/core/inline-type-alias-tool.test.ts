@@ -0,0 +1,226 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performInlineTypeAlias,
+  formatInlineTypeAliasResults,
+} from '../../src/core/inline-type-alias-tool.js';
+
+describe('Inline Type Alias Tool', () => {
+  const testDir = 'tests/temp-inline-type-alias';
+  const treeFile = `${testDir}/tree/tree.go`;
+  const appFile = `${testDir}/app/app.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/tree`, { recursive: true });
+    mkdirSync(`${testDir}/app`, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/ia\n\ngo 1.22\n');
+    writeFileSync(
+      treeFile,
+      `package tree
+
+type Node struct{ Next *Node }
+
+type NodePtr = *Node
+
+type Children = []*Node
+
+func walk(n NodePtr) *Node { return (NodePtr)(n).Next }
+
+func first(c Children) NodePtr { return c[0] }
+`
+    );
+    writeFileSync(
+      appFile,
+      `package app
+
+import "example.com/ia/tree"
+
+var roots tree.Children
+
+func count() int { return len(roots) }
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performInlineTypeAlias', () => {
+    test('should replace uses with the aliased type', async () => {
+      const result = await performInlineTypeAlias({
+        filePath: treeFile,
+        symbol: 'NodePtr',
+      });
+      expect(result).toMatchObject({
+        name: 'NodePtr',
+        kind: 'alias',
+        type: '*Node',
+        uses: 3,
+        declaration: 'removed',
+        warnings: [],
+      });
+      expect(readFileSync(treeFile, 'utf-8')).toBe(
+        `package tree
+
+type Node struct{ Next *Node }
+
+type Children = []*Node
+
+func walk(n *Node) *Node { return (*Node)(n).Next }
+
+func first(c Children) *Node { return c[0] }
+`
+      );
+    });
+
+    test('should qualify the type in other packages', async () => {
+      const result = await performInlineTypeAlias({
+        filePath: treeFile,
+        symbol: 'Children',
+      });
+      expect(result.uses).toBe(2);
+      expect(readFileSync(appFile, 'utf-8')).toBe(
+        `package app
+
+import "example.com/ia/tree"
+
+var roots []*tree.Node
+
+func count() int { return len(roots) }
+`
+      );
+      expect(readFileSync(treeFile, 'utf-8')).toContain(
+        'func first(c []*Node) NodePtr'
+      );
+    });
+
+    test('should add the imports the type needs', async () => {
+      writeFileSync(
+        `${testDir}/tree/time.go`,
+        'package tree\n\nimport "time"\n\ntype Ages = map[string]time.Duration\n'
+      );
+      writeFileSync(
+        appFile,
+        'package app\n\nimport "example.com/ia/tree"\n\nvar ages tree.Ages\n'
+      );
+      await performInlineTypeAlias({
+        filePath: appFile,
+        line: 5,
+        column: 15,
+      });
+      expect(readFileSync(appFile, 'utf-8')).toBe(
+        'package app\n\nimport (\n\t"time"\n)\n\nvar ages map[string]time.Duration\n'
+      );
+      expect(readFileSync(`${testDir}/tree/time.go`, 'utf-8')).toBe(
+        'package tree\n'
+      );
+    });
+
+    test('should inline defined types without methods', async () => {
+      writeFileSync(
+        appFile,
+        'package app\n\ntype ids []int\n\nfunc size(v ids) int { return len(v) }\n'
+      );
+      const result = await performInlineTypeAlias({
+        filePath: appFile,
+        symbol: 'ids',
+      });
+      expect(result.kind).toBe('defined');
+      expect(readFileSync(appFile, 'utf-8')).toBe(
+        'package app\n\nfunc size(v []int) int { return len(v) }\n'
+      );
+    });
+
+    test('should inline types declared in functions', async () => {
+      writeFileSync(
+        appFile,
+        'package app\n\nfunc sum() int {\n\ttype pair = [2]int\n\tp := pair{1, 2}\n\treturn p[0] + p[1]\n}\n'
+      );
+      await performInlineTypeAlias({
+        filePath: appFile,
+        line: 4,
+        column: 7,
+      });
+      expect(readFileSync(appFile, 'utf-8')).toBe(
+        'package app\n\nfunc sum() int {\n\tp := [2]int{1, 2}\n\treturn p[0] + p[1]\n}\n'
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject defined types with methods',
+        source:
+          'package app\n\ntype ids []int\n\nfunc (v ids) Len() int { return len(v) }\n\nvar all ids\n',
+        error:
+          "Cannot inline the defined type 'ids', which has the methods Len that []int does not have",
+      },
+      {
+        name: 'should reject defined types whose values would gain methods',
+        source:
+          'package app\n\ntype num int\n\nfunc (n num) Double() num { return n * 2 }\n\ntype value num\n\nvar v value\n',
+        symbol: 'value',
+        error:
+          "Cannot inline the defined type 'value', whose values would gain the methods Double of num",
+      },
+      {
+        name: 'should reject defined types in type assertions',
+        source:
+          'package app\n\ntype ids []int\n\nfunc is(x any) bool {\n\t_, ok := x.(ids)\n\treturn ok\n}\n',
+        error:
+          "Cannot inline 'ids' at tests/temp-inline-type-alias/app/app.go:6:14, where a type assertion tells its values from other values of []int",
+      },
+      {
+        name: 'should reject embedded fields',
+        source:
+          'package app\n\ntype ids = []int\n\ntype set struct{ ids }\n',
+        error:
+          "Cannot inline 'ids' at tests/temp-inline-type-alias/app/app.go:5:18, where it names an embedded field",
+      },
+      {
+        name: 'should reject unused types',
+        source: 'package app\n\ntype ids = []int\n',
+        error: "'ids' is never used",
+      },
+    ];
+
+    errorCases.forEach(({ name, source, symbol = 'ids', error }) => {
+      test(name, async () => {
+        writeFileSync(appFile, source);
+        await expect(
+          performInlineTypeAlias({ filePath: appFile, symbol })
+        ).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatInlineTypeAliasResults', () => {
+    test('should list the files excluded by build constraints', () => {
+      expect(
+        formatInlineTypeAliasResults({
+          name: 'NodePtr',
+          kind: 'alias',
+          type: '*Node',
+          uses: 1,
+          declaration: 'kept',
+          warnings: ['tree/tree_windows.go is excluded by build constraints'],
+          changes: [{ filePath: 'tree.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Inlined type alias 'NodePtr' (*Node) at 1 use, keeping its declaration for the files excluded by build constraints:\n  tree/tree_windows.go is excluded by build constraints\n\nModified 1 file:\n  tree.go"
+      );
+    });
+  });
+});
@@ -0,0 +1,197 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performInlineVariable,
+  formatInlineVariableResults,
+} from '../../src/core/inline-variable-tool.js';
+
+describe('Inline Variable Tool', () => {
+  const testDir = 'tests/temp-inline-variable';
+  const calcFile = `${testDir}/calc/calc.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/calc`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/inline\n\ngo 1.22\n');
+    writeFileSync(
+      calcFile,
+      `package calc
+
+func next() int { return 1 }
+
+func Scale(a, b int) int {
+	sum := a + b
+	limit := 10
+	return sum * 2 / limit
+}
+
+func Steps(a int) int {
+	n := next()
+	total := next()
+	var ratio float64 = 2
+	_ = ratio
+	for i := 0; i < a; i++ {
+		total += n
+	}
+	old := a
+	a++
+	return old + a + total
+}
+
+func Later(a int) func() int {
+	doubled := a * 2
+	a = 0
+	return func() int { return doubled }
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Locates the first occurrence of text in calc.go.
+  const at = (text: string) => {
+    const lines = readFileSync(calcFile, 'utf-8').split('\n');
+    const line = lines.findIndex(l => l.includes(text));
+    return {
+      filePath: calcFile,
+      line: line + 1,
+      column: lines[line].indexOf(text) + 1,
+    };
+  };
+
+  describe('performInlineVariable', () => {
+    test('should parenthesize the expression where precedence requires', async () => {
+      const result = await performInlineVariable(at('sum :='));
+      expect(result.uses).toBe(1);
+      expect(result.expression).toBe('a + b');
+      expect(readFileSync(calcFile, 'utf-8')).toContain(
+        '\tlimit := 10\n\treturn (a + b) * 2 / limit\n'
+      );
+    });
+
+    test('should keep the type of untyped constants', async () => {
+      await performInlineVariable(at('limit :='));
+      expect(readFileSync(calcFile, 'utf-8')).toContain(
+        'return sum * 2 / int(10)\n'
+      );
+    });
+
+    test('should convert to the declared type', async () => {
+      await performInlineVariable(at('ratio float64'));
+      expect(readFileSync(calcFile, 'utf-8')).toContain(
+        '\ttotal := next()\n\t_ = float64(2)\n'
+      );
+    });
+
+    test('should accept a use instead of the declaration', async () => {
+      const result = await performInlineVariable(at('sum * 2'));
+      expect(result.name).toBe('sum');
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(calcFile, 'utf-8');
+      const result = await performInlineVariable({
+        ...at('sum :='),
+        dryRun: true,
+      });
+      expect(readFileSync(calcFile, 'utf-8')).toBe(original);
+      const output = formatInlineVariableResults(result);
+      expect(output).toContain('-\tsum := a + b\n');
+      expect(output).toContain('Dry run: 1 file would be changed');
+    });
+
+    test('should inline one variable of a multiple declaration', async () => {
+      writeFileSync(
+        calcFile,
+        'package calc\n\nfunc next() int { return 1 }\n\nfunc Pair(a int) int {\n\tx, y := a+1, next()\n\treturn x * y\n}\n'
+      );
+      await performInlineVariable(at('x, y'));
+      expect(readFileSync(calcFile, 'utf-8')).toContain(
+        '\ty := next()\n\treturn (a+1) * y\n'
+      );
+    });
+
+    const multiple = [
+      { tok: ':=', body: '\tx, y := next(), next()\n\treturn x - y' },
+      { tok: 'var', body: '\tvar x, y = next(), next()\n\treturn x - y' },
+    ];
+    multiple.forEach(({ tok, body }) => {
+      test(`should keep the order of the values of ${tok}`, async () => {
+        writeFileSync(
+          calcFile,
+          `package calc\n\nfunc next() int { return 1 }\n\nfunc Pair() int {\n${body}\n}\n`
+        );
+        const original = readFileSync(calcFile, 'utf-8');
+        await expect(performInlineVariable(at('x, y'))).rejects.toThrow(
+          "'next()' has side effects and would then run after 'next()', which its declaration evaluates with it"
+        );
+        expect(readFileSync(calcFile, 'utf-8')).toBe(original);
+      });
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject variables assigned again',
+        text: 'total :=',
+        error: "Cannot inline 'total', which is assigned again at",
+      },
+      {
+        name: 'should reject moving side effects into loops',
+        text: 'n :=',
+        error: "Cannot inline 'n' into the loop at",
+      },
+      {
+        name: 'should reject expressions whose variables change',
+        text: 'old :=',
+        error: "'a' changes at",
+      },
+      {
+        name: 'should reject closures observing later values',
+        text: 'doubled :=',
+        error: "Cannot inline 'doubled' into the function literal at",
+      },
+      {
+        name: 'should reject parameters',
+        text: 'a, b int',
+        error: "'a' is not a local variable",
+      },
+    ];
+
+    errorCases.forEach(({ name, text, error }) => {
+      test(name, async () => {
+        await expect(performInlineVariable(at(text))).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatInlineVariableResults', () => {
+    test('should report the expression and its uses', () => {
+      expect(
+        formatInlineVariableResults({
+          filePath: 'calc.go',
+          name: 'sum',
+          expression: 'a + b',
+          uses: 2,
+          changes: [{ filePath: 'calc.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Inlined variable 'sum' (a + b) at 2 uses in calc.go\n\nModified 1 file:\n  calc.go"
+      );
+    });
+  });
+});
@@ -0,0 +1,154 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import { writeFileSync, existsSync, rmSync, mkdirSync } from 'fs';
+import {
+  performListSymbols,
+  formatListSymbolsResults,
+} from '../../src/core/list-symbols-tool.js';
+
+describe('List Symbols Tool', () => {
+  const testDir = 'tests/temp-list-symbols';
+  const storeDir = `${testDir}/store`;
+  const storeFile = `${storeDir}/store.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(storeDir, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/list\n\ngo 1.22\n');
+    writeFileSync(
+      storeFile,
+      `package store
+
+import "io"
+
+type Getter interface {
+	Get(key string) string
+}
+
+type Store struct{ data map[string]string }
+
+type ID int
+
+type Reader = io.Reader
+
+const (
+	Low ID = iota
+	High
+)
+
+var Default, _ = New(), 1
+
+func New() *Store { return &Store{} }
+
+func (s *Store) Get(key string) string { return s.data[key] }
+
+func Map[T, U any](xs []T, f func(T) U) []U { return nil }
+`
+    );
+    writeFileSync(
+      `${storeDir}/store_test.go`,
+      'package store\n\nfunc helper() {}\n'
+    );
+    writeFileSync(
+      `${storeDir}/store_windows.go`,
+      'package store\n\nfunc native() {}\n'
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performListSymbols', () => {
+    test('should list the declarations with their signatures', async () => {
+      const result = await performListSymbols({
+        filePath: storeDir,
+        goos: 'linux',
+      });
+      expect(result.packageName).toBe('store');
+      expect(result.importPath).toBe('example.com/list/store');
+      expect(result.symbols.map(s => `${s.kind}: ${s.signature}`)).toEqual([
+        'type: type Getter interface{...}',
+        'type: type Store struct{...}',
+        'type: type ID int',
+        'type: type Reader = io.Reader',
+        'const: const Low ID',
+        'const: const High ID',
+        'var: var Default *Store',
+        'func: func New() *Store',
+        'method: func (s *Store) Get(key string) string',
+        'func: func Map[T any, U any](xs []T, f func(T) U) []U',
+      ]);
+      expect(result.warnings).toEqual([
+        `${storeDir}/store_windows.go is excluded by build constraints (file name suffix _windows)`,
+      ]);
+    });
+
+    test('should give the locations the other tools take', async () => {
+      const result = await performListSymbols({ filePath: storeFile });
+      expect(result.symbols.find(s => s.name === 'Get')).toEqual({
+        kind: 'method',
+        name: 'Get',
+        exported: true,
+        receiver: '*Store',
+        filePath: storeFile,
+        line: 24,
+        column: 17,
+        offset: 276,
+        signature: 'func (s *Store) Get(key string) string',
+      });
+      expect(result.symbols.find(s => s.name === '_')).toBeUndefined();
+    });
+
+    test('should list test files when asked to', async () => {
+      const result = await performListSymbols({
+        filePath: storeDir,
+        includeTests: true,
+      });
+      expect(result.symbols.at(-1)).toMatchObject({
+        name: 'helper',
+        exported: false,
+        filePath: `${storeDir}/store_test.go`,
+      });
+    });
+
+    test('should reject directories without a package', async () => {
+      await expect(
+        performListSymbols({ filePath: testDir })
+      ).rejects.toMatchObject({
+        code: 'invalid_location',
+        message: `No Go package found in ${testDir}`,
+      });
+    });
+  });
+
+  describe('formatListSymbolsResults', () => {
+    test('should give each symbol its location', () => {
+      expect(
+        formatListSymbolsResults({
+          packageName: 'store',
+          importPath: 'example.com/list/store',
+          symbols: [
+            {
+              kind: 'func',
+              name: 'New',
+              exported: true,
+              filePath: 'store/store.go',
+              line: 3,
+              column: 6,
+              offset: 20,
+              signature: 'func New() *Store',
+            },
+          ],
+          warnings: [],
+        })
+      ).toBe(
+        'Package store (example.com/list/store), 1 symbol:\n  store/store.go:3:6 (offset 20): func New() *Store'
+      );
+    });
+  });
+});
@@ -0,0 +1,344 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performMoveDeclaration,
+  formatMoveDeclarationResults,
+  performSplitFile,
+  formatSplitFileResults,
+} from '../../src/core/move-declaration-tool.js';
+
+describe('Move Declaration Tool', () => {
+  const testDir = 'tests/temp-move-declaration';
+  const utilFile = `${testDir}/util/util.go`;
+  const otherFile = `${testDir}/util/other.go`;
+  const newFile = `${testDir}/util/shout.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/util`, { recursive: true });
+    mkdirSync(`${testDir}/app`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/move\n\ngo 1.22\n');
+    writeFileSync(
+      utilFile,
+      `package util
+
+import (
+	"fmt"
+	"os"
+	str "strings"
+)
+
+// Shout upper-cases s.
+// It also prints it.
+func Shout(s string) string {
+	fmt.Println(s)
+	return str.ToUpper(s) // loud
+}
+
+type (
+	// A is first.
+	A struct {
+		X int
+	}
+	B = []string
+)
+
+var Env = os.Getenv("X")
+
+func Keep() { fmt.Println("keep") }
+`
+    );
+    writeFileSync(
+      otherFile,
+      `package util
+
+import "strings"
+
+func Other() string { return strings.TrimSpace(" x ") }
+`
+    );
+    writeFileSync(`${testDir}/app/app.go`, 'package app\n');
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Locates the first line of util.go that starts with prefix.
+  const at = (prefix: string) => {
+    const lines = readFileSync(utilFile, 'utf-8').split('\n');
+    const line = lines.findIndex(l => l.startsWith(prefix));
+    return { filePath: utilFile, line: line + 1, column: prefix.length };
+  };
+
+  describe('performMoveDeclaration', () => {
+    test('should move a function and its doc comment to an existing file', async () => {
+      const result = await performMoveDeclaration({
+        ...at('func Shout'),
+        destination: otherFile,
+      });
+      expect(result.names).toEqual(['Shout']);
+      expect(result.created).toBe(false);
+      expect(readFileSync(otherFile, 'utf-8')).toBe(
+        `package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+func Other() string { return strings.TrimSpace(" x ") }
+
+// Shout upper-cases s.
+// It also prints it.
+func Shout(s string) string {
+	fmt.Println(s)
+	return strings.ToUpper(s) // loud
+}
+`
+      );
+      const content = readFileSync(utilFile, 'utf-8');
+      expect(content).toContain('import (\n\t"fmt"\n\t"os"\n)\n\ntype (');
+      expect(content).not.toContain('Shout');
+    });
+
+    test('should create the destination with the imports it needs', async () => {
+      const result = await performMoveDeclaration({
+        ...at('func Shout'),
+        destination: newFile,
+      });
+      expect(result.created).toBe(true);
+      expect(readFileSync(newFile, 'utf-8')).toBe(
+        `package util
+
+import (
+	"fmt"
+	str "strings"
+)
+
+// Shout upper-cases s.
+// It also prints it.
+func Shout(s string) string {
+	fmt.Println(s)
+	return str.ToUpper(s) // loud
+}
+`
+      );
+    });
+
+    test('should move one spec out of a grouped declaration', async () => {
+      const result = await performMoveDeclaration({
+        ...at('\tA struct'),
+        destination: newFile,
+      });
+      expect(result.names).toEqual(['A']);
+      expect(readFileSync(newFile, 'utf-8')).toBe(
+        'package util\n\n// A is first.\ntype A struct {\n\tX int\n}\n'
+      );
+      expect(readFileSync(utilFile, 'utf-8')).toContain(
+        'type (\n\tB = []string\n)\n'
+      );
+    });
+
+    test('should remove imports that only the moved declaration used', async () => {
+      await performMoveDeclaration({
+        ...at('var Env'),
+        destination: newFile,
+      });
+      expect(readFileSync(newFile, 'utf-8')).toBe(
+        'package util\n\nimport "os"\n\nvar Env = os.Getenv("X")\n'
+      );
+      expect(readFileSync(utilFile, 'utf-8')).toContain(
+        'import (\n\t"fmt"\n\tstr "strings"\n)\n'
+      );
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(utilFile, 'utf-8');
+      const result = await performMoveDeclaration({
+        ...at('func Keep'),
+        destination: newFile,
+        dryRun: true,
+      });
+      expect(readFileSync(utilFile, 'utf-8')).toBe(original);
+      expect(existsSync(newFile)).toBe(false);
+      const output = formatMoveDeclarationResults(result);
+      expect(output).toContain('+func Keep() { fmt.Println("keep") }\n');
+      expect(output).toContain('Dry run: 2 files would be changed');
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject import declarations',
+        prefix: 'import',
+        destination: newFile,
+        error: 'Import declarations cannot be moved',
+      },
+      {
+        name: 'should reject files of other directories',
+        prefix: 'func Keep',
+        destination: `${testDir}/app/app.go`,
+        error: 'The destination must be a Go file in',
+      },
+      {
+        name: 'should reject test files as destinations',
+        prefix: 'func Keep',
+        destination: `${testDir}/util/util_test.go`,
+        error: 'would make the declaration visible to tests only',
+      },
+      {
+        name: 'should reject the same file',
+        prefix: 'func Keep',
+        destination: utilFile,
+        error: 'The destination is the file declaring the declaration',
+      },
+    ];
+
+    errorCases.forEach(({ name, prefix, destination, error }) => {
+      test(name, async () => {
+        await expect(
+          performMoveDeclaration({ ...at(prefix), destination })
+        ).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatMoveDeclarationResults', () => {
+    test('should report the move and the new file', () => {
+      expect(
+        formatMoveDeclarationResults({
+          names: ['A', 'B'],
+          from: 'util.go',
+          to: 'types.go',
+          created: true,
+          changes: [{ filePath: 'types.go', original: '', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Moved 'A', 'B' from util.go to types.go (new file)\n\nModified 1 file:\n  types.go"
+      );
+    });
+  });
+  describe('performSplitFile', () => {
+    test('should move declarations to several files at once', async () => {
+      const result = await performSplitFile({
+        filePath: utilFile,
+        targets: { Shout: 'shout.go', A: 'types.go', B: 'types.go' },
+      });
+      expect(result.moves).toEqual([
+        { to: newFile, names: ['Shout'], created: true },
+        { to: `${testDir}/util/types.go`, names: ['A', 'B'], created: true },
+      ]);
+      expect(readFileSync(newFile, 'utf-8')).toContain(
+        'import (\n\t"fmt"\n\tstr "strings"\n)\n\n// Shout upper-cases s.'
+      );
+      expect(readFileSync(`${testDir}/util/types.go`, 'utf-8')).toBe(
+        `package util
+
+type (
+	// A is first.
+	A struct {
+		X int
+	}
+	B = []string
+)
+`
+      );
+      expect(readFileSync(utilFile, 'utf-8')).toBe(
+        `package util
+
+import (
+	"fmt"
+	"os"
+)
+
+var Env = os.Getenv("X")
+
+func Keep() { fmt.Println("keep") }
+`
+      );
+    });
+
+    test('should move the specs of a group to different files', async () => {
+      await performSplitFile({
+        filePath: utilFile,
+        targets: { A: 'types.go', B: 'other.go', Keep: 'other.go' },
+      });
+      expect(readFileSync(otherFile, 'utf-8')).toBe(
+        `package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+func Other() string { return strings.TrimSpace(" x ") }
+
+type B = []string
+
+func Keep() { fmt.Println("keep") }
+`
+      );
+      const content = readFileSync(utilFile, 'utf-8');
+      expect(content).not.toContain('type (');
+      expect(content).toMatch(/\}\n\nvar Env = os.Getenv\("X"\)\n$/);
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject names not declared in the file',
+        targets: { Other: 'shout.go' },
+        error: "'Other' is not a top-level declaration of",
+      },
+      {
+        name: 'should reject files of other directories',
+        targets: { Keep: '../app/app.go' },
+        error: 'The destination must be a Go file in',
+      },
+      {
+        name: 'should reject an empty mapping',
+        targets: {},
+        error: 'No declarations to move',
+      },
+    ];
+
+    errorCases.forEach(({ name, targets, error }) => {
+      test(name, async () => {
+        const original = readFileSync(utilFile, 'utf-8');
+        await expect(
+          performSplitFile({ filePath: utilFile, targets })
+        ).rejects.toThrow(error);
+        expect(readFileSync(utilFile, 'utf-8')).toBe(original);
+      });
+    });
+  });
+
+  describe('formatSplitFileResults', () => {
+    test('should list the declarations moved to each file', () => {
+      expect(
+        formatSplitFileResults({
+          from: 'util.go',
+          moves: [
+            { to: 'shout.go', names: ['Shout'], created: true },
+            { to: 'other.go', names: ['A', 'B'], created: false },
+          ],
+          changes: [{ filePath: 'util.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Moved 3 declarations out of util.go:\n  shout.go (new file): 'Shout'\n  other.go: 'A', 'B'\n\nModified 1 file:\n  util.go"
+      );
+    });
+  });
+});
@@ -0,0 +1,193 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import { resolve } from 'path';
+import {
+  performOrganizeImports,
+  formatOrganizeImportsResults,
+} from '../../src/core/organize-imports-tool.js';
+
+describe('Organize Imports Tool', () => {
+  const testDir = 'tests/temp-organize-imports';
+  const appFile = `${testDir}/mod/app/app.go`;
+  const otherFile = `${testDir}/mod/app/other.go`;
+  const savedCache = process.env.GOMODCACHE;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/mod/util`, { recursive: true });
+    mkdirSync(`${testDir}/mod/app`, { recursive: true });
+    const dep = `${testDir}/modcache/github.com/!acme/paint@v1.2.0/hue`;
+    mkdirSync(dep, { recursive: true });
+    process.env.GOMODCACHE = resolve(testDir, 'modcache');
+
+    writeFileSync(
+      `${testDir}/mod/go.mod`,
+      'module example.com/organize\n\ngo 1.22\n\nrequire github.com/Acme/paint v1.2.0\n'
+    );
+    writeFileSync(`${dep}/hue.go`, 'package hue\n\nfunc Red() {}\n');
+    writeFileSync(
+      `${testDir}/mod/util/util.go`,
+      'package util\n\nfunc Shout(s string) string { return s }\n'
+    );
+    writeFileSync(
+      appFile,
+      `// Package app runs things.
+package app
+
+import (
+	"os"
+	"example.com/organize/util"
+	str "strings" // aliased
+
+	// Buffers.
+	"bytes"
+	_ "embed"
+)
+
+import "io"
+
+func Run() {
+	fmt.Println(util.Shout(str.ToUpper("x")))
+	_ = bytes.NewBuffer(nil)
+	hue.Red()
+	var _ io.Reader
+}
+`
+    );
+    writeFileSync(
+      otherFile,
+      'package app\n\nimport "errors"\n\nfunc other() {}\n'
+    );
+  });
+
+  afterEach(() => {
+    if (savedCache === undefined) delete process.env.GOMODCACHE;
+    else process.env.GOMODCACHE = savedCache;
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performOrganizeImports', () => {
+    test('should remove, add, group and sort imports', async () => {
+      const result = await performOrganizeImports({ filePath: appFile });
+      expect(result.files).toEqual([
+        {
+          filePath: appFile,
+          added: ['fmt', 'github.com/Acme/paint/hue'],
+          removed: ['os'],
+        },
+      ]);
+      expect(readFileSync(appFile, 'utf-8')).toBe(
+        `// Package app runs things.
+package app
+
+import (
+	// Buffers.
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	str "strings" // aliased
+
+	"github.com/Acme/paint/hue"
+
+	"example.com/organize/util"
+)
+
+func Run() {
+	fmt.Println(util.Shout(str.ToUpper("x")))
+	_ = bytes.NewBuffer(nil)
+	hue.Red()
+	var _ io.Reader
+}
+`
+      );
+    });
+
+    test('should leave organized files unchanged', async () => {
+      await performOrganizeImports({ filePath: appFile });
+      const again = await performOrganizeImports({ filePath: appFile });
+      expect(again.files).toEqual([]);
+      expect(formatOrganizeImportsResults(again)).toBe(
+        'Imports are already organized'
+      );
+    });
+
+    test('should organize every file of a package directory', async () => {
+      const result = await performOrganizeImports({
+        filePath: `${testDir}/mod/app`,
+      });
+      expect(result.files.map(f => f.filePath)).toEqual([appFile, otherFile]);
+      expect(readFileSync(otherFile, 'utf-8')).toBe(
+        'package app\n\nfunc other() {}\n'
+      );
+    });
+
+    test('should report packages it cannot find', async () => {
+      writeFileSync(
+        otherFile,
+        'package app\n\nfunc other() { helpers.Help() }\n'
+      );
+      const result = await performOrganizeImports({ filePath: otherFile });
+      expect(result.unresolved).toEqual([`helpers (${otherFile}:3:16)`]);
+      expect(result.files).toEqual([]);
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(appFile, 'utf-8');
+      const result = await performOrganizeImports({
+        filePath: appFile,
+        dryRun: true,
+      });
+      expect(readFileSync(appFile, 'utf-8')).toBe(original);
+      const output = formatOrganizeImportsResults(result);
+      expect(output).toContain('+\t"fmt"\n');
+      expect(output).toContain('Dry run: 1 file would be changed');
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject directories without a package',
+        filePath: `${testDir}/mod`,
+        error: 'No Go package found in',
+      },
+      {
+        name: 'should reject files outside the module',
+        filePath: `${testDir}/mod/app/notes.txt`,
+        error: 'Not a Go source file in the module',
+      },
+    ];
+
+    errorCases.forEach(({ name, filePath, error }) => {
+      test(name, async () => {
+        await expect(performOrganizeImports({ filePath })).rejects.toThrow(
+          error
+        );
+      });
+    });
+  });
+
+  describe('formatOrganizeImportsResults', () => {
+    test('should list the imports of each file', () => {
+      expect(
+        formatOrganizeImportsResults({
+          files: [{ filePath: 'app.go', added: ['fmt'], removed: ['os'] }],
+          unresolved: ['helpers (app.go:3:1)'],
+          changes: [{ filePath: 'app.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Organized the imports of 1 file:\n  app.go: +fmt, -os\nCould not find packages for:\n  helpers (app.go:3:1)\n\nModified 1 file:\n  app.go'
+      );
+    });
+  });
+});
@@ -0,0 +1,145 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import { writeFileSync, existsSync, rmSync, mkdirSync } from 'fs';
+import { resolve } from 'path';
+import {
+  PACKAGES_URI,
+  affectedResources,
+  fileResources,
+  listPackages,
+  packageResources,
+  readGoFile,
+  readPackage,
+} from '../../src/core/package-resources.js';
+
+describe('Package Resources', () => {
+  const testDir = 'tests/temp-package-resources';
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/store`, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/res\n\ngo 1.22\n');
+    writeFileSync(
+      `${testDir}/main.go`,
+      'package main\n\nimport (\n\t"fmt"\n\n\t"example.com/res/store"\n)\n\nfunc main() { fmt.Println(store.Get()) }\n'
+    );
+    writeFileSync(
+      `${testDir}/store/store.go`,
+      'package store\n\nfunc Get() int { return 1 }\n'
+    );
+    writeFileSync(
+      `${testDir}/store/store_test.go`,
+      'package store_test\n\nimport "testing"\n\nfunc TestGet(t *testing.T) {}\n'
+    );
+    writeFileSync(
+      `${testDir}/store/store_other.go`,
+      '//go:build ignore\n\npackage store\n'
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  test('should list the packages of the module', () => {
+    const list = listPackages(testDir);
+    expect(list.modules).toEqual([{ path: 'example.com/res', root: testDir }]);
+    expect(list.packages).toEqual([
+      {
+        importPath: 'example.com/res',
+        name: 'main',
+        dir: testDir,
+        uri: 'gopkg://example.com/res',
+        files: 1,
+      },
+      {
+        importPath: 'example.com/res/store',
+        name: 'store',
+        dir: `${testDir}/store`,
+        uri: 'gopkg://example.com/res/store',
+        files: 1,
+      },
+      {
+        importPath: 'example.com/res/store_test',
+        name: 'store_test',
+        dir: `${testDir}/store`,
+        uri: 'gopkg://example.com/res/store_test',
+        files: 1,
+      },
+    ]);
+  });
+
+  test('should describe the files and imports of a package', () => {
+    const pkg = readPackage('example.com/res', testDir);
+    expect(pkg.imports).toEqual(['example.com/res/store', 'fmt']);
+    expect(readPackage('example.com/res/store', testDir).files).toEqual([
+      {
+        name: 'store.go',
+        uri: 'gofile://example.com/res/store/store.go',
+      },
+      {
+        name: 'store_other.go',
+        uri: 'gofile://example.com/res/store/store_other.go',
+        excludedBy: '//go:build ignore',
+      },
+    ]);
+  });
+
+  test('should name the files of external tests by their directory', () => {
+    const pkg = readPackage('example.com/res/store_test', testDir);
+    expect(pkg.isXTest).toBe(true);
+    expect(pkg.files[0].uri).toBe(
+      'gofile://example.com/res/store/store_test.go'
+    );
+    const src = readGoFile('example.com/res/store', 'store_test.go', testDir);
+    expect(src).toBe(
+      'package store_test\n\nimport "testing"\n\nfunc TestGet(t *testing.T) {}\n'
+    );
+  });
+
+  test('should read files left out by build constraints', () => {
+    expect(
+      readGoFile('example.com/res/store', 'store_other.go', testDir)
+    ).toContain('//go:build ignore');
+  });
+
+  test('should reject files outside of the package', () => {
+    expect(() =>
+      readGoFile('example.com/res/store', '../go.mod', testDir)
+    ).toThrow('No Go file ../go.mod in package example.com/res/store');
+    expect(() => readPackage('example.com/res/cache', testDir)).toThrow(
+      'No package example.com/res/cache in the module at tests/temp-package-resources'
+    );
+  });
+
+  test('should list every package and file as a resource', () => {
+    expect(packageResources(testDir).map(r => r.uri)).toEqual([
+      'gopkg://example.com/res',
+      'gopkg://example.com/res/store',
+      'gopkg://example.com/res/store_test',
+    ]);
+    expect(fileResources(testDir).map(r => r.name)).toEqual([
+      'example.com/res/main.go',
+      'example.com/res/store/store.go',
+      'example.com/res/store/store_test.go',
+    ]);
+    expect(packageResources('/')).toEqual([]);
+  });
+
+  test('should find the resources a file change affects', () => {
+    const filePath = resolve(`${testDir}/store/cache.go`);
+    expect(affectedResources({ filePath, kind: 'changed' })).toEqual([
+      'gofile://example.com/res/store/cache.go',
+      'gopkg://example.com/res/store',
+      'gopkg://example.com/res/store_test',
+    ]);
+    expect(affectedResources({ filePath, kind: 'created' })).toContain(
+      PACKAGES_URI
+    );
+    const goMod = resolve(`${testDir}/go.mod`);
+    expect(affectedResources({ filePath: goMod, kind: 'changed' })).toEqual([]);
+  });
+});
@@ -263,6 +263,51 @@ legacy_sdk.initialize();`
     });
   });
 
+  describe('dry run diffs', () => {
+    test('should return a unified diff without modifying files', async () => {
+      const originalContent = readFileSync(`${testDir}/variables.js`, 'utf-8');
+      const results = await performRefactor({
+        searchPattern: 'const (\\w+) = ',
+        replacePattern: 'let $1 = ',
+        filePattern: `${testDir}/variables.js`,
+        dryRun: true,
+      });
+
+      expect(results[0].diff).toBe(
+        `--- a/${testDir}/variables.js\n` +
+          `+++ b/${testDir}/variables.js\n` +
+          '@@ -1,4 +1,4 @@\n' +
+          "-const oldVariable = 'test';\n" +
+          '-const anotherOld = 123;\n' +
+          '+let oldVariable = \'test\';\n' +
+          '+let anotherOld = 123;\n' +
+          " let someVar = 'keep this';\n" +
+          '-const finalOld = true;\n' +
+          '\\ No newline at end of file\n' +
+          '+let finalOld = true;\n' +
+          '\\ No newline at end of file\n'
+      );
+      expect(readFileSync(`${testDir}/variables.js`, 'utf-8')).toBe(
+        originalContent
+      );
+
+      const output = formatRefactorResults(results, { dryRun: true });
+      expect(output).toContain('Total: 3 replacements in 1 files (dry run)');
+      expect(output).toContain(results[0].diff);
+    });
+
+    test('should not compute diffs for real runs', async () => {
+      const results = await performRefactor({
+        searchPattern: 'const',
+        replacePattern: 'let',
+        filePattern: `${testDir}/variables.js`,
+        dryRun: false,
+      });
+      expect(results[0].diff).toBeUndefined();
+      expect(formatRefactorResults(results)).not.toContain('@@');
+    });
+  });
+
   describe('formatRefactorResults', () => {
     const testCases = [
       {
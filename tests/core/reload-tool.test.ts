@@ -0,0 +1,162 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import { writeFileSync, existsSync, rmSync, mkdirSync } from 'fs';
+import { resolve } from 'path';
+import {
+  performReload,
+  formatReloadResults,
+} from '../../src/core/reload-tool.js';
+import { GoProgram, loadGoFile } from '../../src/utils/go-loader.js';
+
+describe('Reload Tool', () => {
+  const testDir = 'tests/temp-reload';
+  const mainFile = `${testDir}/main.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/reload\n\ngo 1.22\n');
+    writeFileSync(mainFile, 'package main\n\nfunc main() {}\n');
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('package cache', () => {
+    test('should reuse the program while no file changes', () => {
+      const program = GoProgram.forPath(mainFile);
+      program.check();
+      expect(GoProgram.forPath(testDir)).toBe(program);
+    });
+
+    test('should load the module again when a file changes', () => {
+      const program = GoProgram.forPath(mainFile);
+      writeFileSync(mainFile, 'package main\n\nfunc main() { helper() }\n');
+      const reloaded = GoProgram.forPath(mainFile);
+      expect(reloaded).not.toBe(program);
+      expect(reloaded.file(mainFile)?.src).toContain('helper()');
+    });
+
+    test('should load the module again when a file is added', () => {
+      const program = GoProgram.forPath(mainFile);
+      writeFileSync(`${testDir}/util.go`, 'package main\n\nfunc helper() {}\n');
+      const reloaded = GoProgram.forPath(mainFile);
+      expect(reloaded).not.toBe(program);
+      expect(reloaded.files).toHaveLength(2);
+    });
+
+    test('should only check the packages affected by a change again', () => {
+      for (const [name, src] of [
+        ['a', 'package a\n\nfunc A() int { return 1 }\n'],
+        [
+          'b',
+          'package b\n\nimport "example.com/reload/a"\n\nvar B = a.A()\n',
+        ],
+        ['c', 'package c\n\nfunc C() {}\n'],
+      ]) {
+        mkdirSync(`${testDir}/${name}`);
+        writeFileSync(`${testDir}/${name}/${name}.go`, src);
+      }
+      const program = GoProgram.forPath(mainFile);
+      program.check();
+      const a = program.file(`${testDir}/a/a.go`)!;
+      writeFileSync(
+        `${testDir}/a/a.go`,
+        'package a\n\nfunc A() int { return 10 }\n'
+      );
+      const reloaded = GoProgram.forPath(mainFile);
+      const { info } = reloaded.check();
+      const path = (name: string) => `example.com/reload/${name}`;
+      expect(reloaded.packageByImportPath(path('c'))).toBe(
+        program.packageByImportPath(path('c'))
+      );
+      // b imports a, so it is checked again.
+      expect(reloaded.packageByImportPath(path('b'))).not.toBe(
+        program.packageByImportPath(path('b'))
+      );
+      const decl = (file: string) => {
+        const d = reloaded.file(file)!.ast.decls.at(-1)!;
+        return d.type === 'FuncDecl' ? d.name : undefined;
+      };
+      expect(info.defs.get(decl(`${testDir}/c/c.go`)!)?.name).toBe('C');
+      const oldA = a.ast.decls[0];
+      expect(oldA.type === 'FuncDecl' && info.defs.has(oldA.name)).toBe(false);
+      const newA = info.defs.get(decl(`${testDir}/a/a.go`)!);
+      const uses = [...info.uses.values()].filter(obj => obj.name === 'A');
+      expect(uses).toHaveLength(1);
+      expect(uses[0]).toBe(newA);
+    });
+
+    test('should share concurrent loads of the same module', async () => {
+      mkdirSync(`${testDir}/util`);
+      writeFileSync(
+        `${testDir}/util/util.go`,
+        'package util\n\nfunc Helper() {}\n'
+      );
+      const { signal } = new AbortController();
+      const [a, b] = await Promise.all([
+        loadGoFile(mainFile, { signal }),
+        loadGoFile(`${testDir}/util/util.go`, { signal }),
+      ]);
+      expect(a.program).toBe(b.program);
+      const decl = b.file.ast.decls[0];
+      const info = a.program.check().info;
+      expect(decl.type === 'FuncDecl' && info.defs.get(decl.name)).toBeTruthy();
+    });
+
+    test('should not cache a load that a reload interrupted', async () => {
+      const { signal } = new AbortController();
+      const loading = GoProgram.load(mainFile, { signal });
+      await performReload({ filePath: mainFile });
+      const program = await loading;
+      expect(GoProgram.forPath(mainFile)).not.toBe(program);
+    });
+  });
+
+  describe('performReload', () => {
+    test('should drop the cached program of the module', async () => {
+      const program = GoProgram.forPath(mainFile);
+      const result = await performReload({ filePath: mainFile });
+      expect(result).toEqual({ root: resolve(testDir), cleared: 1 });
+      expect(GoProgram.forPath(mainFile)).not.toBe(program);
+    });
+
+    test('should report modules that were not cached', async () => {
+      await performReload({ filePath: testDir });
+      const result = await performReload({ filePath: testDir });
+      expect(result.cleared).toBe(0);
+      expect(formatReloadResults(result)).toBe(
+        `No packages of ${testDir} were cached`
+      );
+    });
+
+    test('should drop every module without a path', async () => {
+      const program = GoProgram.forPath(mainFile);
+      const result = await performReload({});
+      expect(result.cleared).toBeGreaterThanOrEqual(1);
+      expect(GoProgram.forPath(mainFile)).not.toBe(program);
+    });
+
+    test('should reject paths outside a module', async () => {
+      await expect(performReload({ filePath: '/' })).rejects.toThrow(
+        'No go.mod found for /'
+      );
+    });
+  });
+
+  describe('formatReloadResults', () => {
+    test('should report the reloaded module', () => {
+      expect(formatReloadResults({ root: 'app', cleared: 1 })).toBe(
+        'Cleared the cached packages of app; the next call loads them from disk'
+      );
+      expect(formatReloadResults({ cleared: 2 })).toBe(
+        'Cleared the cached packages of 2 modules'
+      );
+    });
+  });
+});
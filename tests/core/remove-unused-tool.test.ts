@@ -0,0 +1,263 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performRemoveUnused,
+  formatRemoveUnusedResults,
+} from '../../src/core/remove-unused-tool.js';
+
+describe('Remove Unused Tool', () => {
+  const testDir = 'tests/temp-remove-unused';
+  const mainFile = `${testDir}/main.go`;
+  const utilFile = `${testDir}/util/util.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/util`, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/ru\n\ngo 1.22\n');
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Writes main.go with the imports and a function run with the body.
+  const write = (imports: string, body: string, rest = '') =>
+    writeFileSync(
+      mainFile,
+      `package main
+
+import (
+${imports}
+)
+
+func run(k int, ch chan int) {
+${body}
+}
+${rest}`
+    );
+
+  describe('performRemoveUnused', () => {
+    const testCases = [
+      {
+        name: 'should delete variables that are only assigned',
+        body: '\tn := 0\n\tn++\n\tn = k\n\tprintln(k)',
+        expected: '\t_ = fmt.Sprint\n\tprintln(k)\n}',
+      },
+      {
+        name: 'should keep the other variables a statement declares',
+        body: '\ta, b := k, 2\n\tprintln(a)',
+        expected: '\ta := k\n\tprintln(a)\n}',
+      },
+      {
+        name: 'should keep calls assigned to _',
+        body: '\ts := fmt.Sprint(k)\n\ts = ""',
+        expected: '\t_ = fmt.Sprint\n\t_ = fmt.Sprint(k)\n}',
+      },
+      {
+        name: 'should keep receives as statements',
+        body: '\tv := <-ch\n\t_ = k',
+        expected: '\t<-ch\n\t_ = k\n}',
+      },
+      {
+        name: 'should delete the variables left unused by the others',
+        body: '\tx := k\n\ty := x\n\ty++',
+        expected: '\t_ = fmt.Sprint\n}',
+      },
+      {
+        name: 'should delete specs of var declarations',
+        body: '\tvar (\n\t\tc = 2\n\t\td = k\n\t)\n\tprintln(c)',
+        expected: '\tvar (\n\t\tc = 2\n\t)\n\tprintln(c)\n}',
+      },
+      {
+        name: 'should delete the init statement of an if',
+        body: '\tif n := k; k > 0 {\n\t\tn++\n\t}',
+        expected: '\tif k > 0 {\n\t}\n}',
+      },
+    ];
+
+    testCases.forEach(({ name, body, expected }) => {
+      test(name, async () => {
+        write('\t"fmt"', `\t_ = fmt.Sprint\n${body}`);
+        await performRemoveUnused({ filePath: mainFile, line: 7, column: 2 });
+        expect(readFileSync(mainFile, 'utf-8')).toContain(expected);
+      });
+    });
+
+    test('should remove the imports the file no longer uses', async () => {
+      write(
+        '\t"os"\n\t"strings"',
+        '\tp := os.Args\n\tp = nil\n\t_ = strings.ToUpper'
+      );
+      const result = await performRemoveUnused({
+        filePath: mainFile,
+        symbol: 'run',
+      });
+      expect(result.variables).toEqual([
+        'p (tests/temp-remove-unused/main.go:9:2)',
+      ]);
+      expect(result.imports).toEqual(['os']);
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        'import (\n\t"strings"\n)'
+      );
+    });
+
+    test('should keep variables read by closures', async () => {
+      write('\t"fmt"', '\tn := k\n\tf := func() { fmt.Println(n) }\n\tf()');
+      const result = await performRemoveUnused({
+        filePath: mainFile,
+        symbol: 'run',
+      });
+      expect(result.variables).toEqual([]);
+      expect(result.changes).toEqual([]);
+    });
+
+    test('should drop unused parameters from the calls', async () => {
+      writeFileSync(
+        utilFile,
+        `package util
+
+func Load(path string, verbose bool) string {
+	return path
+}
+`
+      );
+      write(
+        '\t"example.com/ru/util"',
+        '\t_ = util.Load("a", k > 0)\n\t_ = util.Load("b", true)'
+      );
+      const result = await performRemoveUnused({
+        filePath: utilFile,
+        symbol: 'Load',
+        removeParameters: true,
+      });
+      expect(result.parameters).toEqual([
+        'verbose (tests/temp-remove-unused/util/util.go:3:24)',
+      ]);
+      expect(result.callSites).toHaveLength(2);
+      expect(readFileSync(utilFile, 'utf-8')).toContain(
+        'func Load(path string) string {'
+      );
+      const main = readFileSync(mainFile, 'utf-8');
+      expect(main).toContain('\t_ = util.Load("a")\n\t_ = util.Load("b")\n');
+    });
+
+    test('should keep parameters unless asked to remove them', async () => {
+      write('\t"fmt"', '\tfmt.Println(k)');
+      const result = await performRemoveUnused({
+        filePath: mainFile,
+        symbol: 'run',
+      });
+      expect(result.keptParameters).toEqual(['ch']);
+      expect(result.keptReason).toBe(
+        'set remove_parameters to drop them from the signature and the calls'
+      );
+      expect(result.changes).toEqual([]);
+    });
+
+    test('should keep the parameters of functions used as values', async () => {
+      write('\t"fmt"', '\tfmt.Println(k)', '\nvar f = run\n');
+      const result = await performRemoveUnused({
+        filePath: mainFile,
+        symbol: 'run',
+        removeParameters: true,
+      });
+      expect(result.keptReason).toBe(
+        'run is used as a value at tests/temp-remove-unused/main.go:11:9, which needs its signature'
+      );
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        'func run(k int, ch chan int) {'
+      );
+    });
+
+    test('should keep the parameters of interface methods', async () => {
+      writeFileSync(
+        mainFile,
+        `package main
+
+type Namer interface{ Name(id int) string }
+
+type T struct{}
+
+func (T) Name(id int) string {
+	return "t"
+}
+
+var _ Namer = T{}
+`
+      );
+      const result = await performRemoveUnused({
+        filePath: mainFile,
+        symbol: 'T.Name',
+        removeParameters: true,
+      });
+      expect(result.keptParameters).toEqual(['id']);
+      expect(result.keptReason).toBe(
+        'T.Name declares or implements the interface method at tests/temp-remove-unused/main.go:3:23, whose signature it must keep'
+      );
+    });
+
+    test('should reject positions outside of functions', async () => {
+      write('\t"fmt"', '\tfmt.Println(k, ch)');
+      await expect(
+        performRemoveUnused({ filePath: mainFile, line: 3, column: 1 })
+      ).rejects.toThrow('No function at tests/temp-remove-unused/main.go:3:1');
+    });
+
+    test('should not modify files in dry run mode', async () => {
+      write('\t"fmt"', '\tn := fmt.Sprint(k, ch)\n\tn = ""');
+      const original = readFileSync(mainFile, 'utf-8');
+      const result = await performRemoveUnused({
+        filePath: mainFile,
+        symbol: 'run',
+        dryRun: true,
+      });
+      expect(result.changes).toHaveLength(1);
+      expect(readFileSync(mainFile, 'utf-8')).toBe(original);
+    });
+  });
+
+  describe('formatRemoveUnusedResults', () => {
+    test('should list what was removed and kept', () => {
+      expect(
+        formatRemoveUnusedResults({
+          functionName: 'run',
+          variables: ['n (main.go:4:2)'],
+          parameters: [],
+          imports: ['os'],
+          keptParameters: ['a', 'b'],
+          keptReason: 'set remove_parameters to drop them',
+          callSites: [],
+          changes: [{ filePath: 'main.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Removed 1 variable:\n  n (main.go:4:2)\nRemoved 1 import:\n  os\nKept the unused parameters a, b: set remove_parameters to drop them\n\nModified 1 file:\n  main.go'
+      );
+    });
+
+    test('should report functions without anything unused', () => {
+      expect(
+        formatRemoveUnusedResults({
+          functionName: 'T.Name',
+          variables: [],
+          parameters: [],
+          imports: [],
+          keptParameters: [],
+          callSites: [],
+          changes: [],
+          dryRun: false,
+        })
+      ).toContain('Nothing unused in T.Name\n');
+    });
+  });
+});
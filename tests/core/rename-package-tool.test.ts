@@ -0,0 +1,205 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performRenamePackage,
+  formatRenamePackageResults,
+} from '../../src/core/rename-package-tool.js';
+
+describe('Rename Package Tool', () => {
+  const testDir = 'tests/temp-rename-package';
+  const storeFile = `${testDir}/store/store.go`;
+  const xtestFile = `${testDir}/store/store_test.go`;
+  const appFile = `${testDir}/app/app.go`;
+  const aliasFile = `${testDir}/app/alias.go`;
+  const cmdFile = `${testDir}/cmd/cmd.go`;
+  const importPath = 'example.com/pkgs/store';
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    for (const dir of ['store', 'app', 'cmd']) {
+      mkdirSync(`${testDir}/${dir}`, { recursive: true });
+    }
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/pkgs\n\ngo 1.22\n');
+    writeFileSync(
+      storeFile,
+      `// Package store keeps values.
+package store
+
+type Store struct{}
+
+func New() *Store { return &Store{} }
+`
+    );
+    writeFileSync(
+      xtestFile,
+      `package store_test
+
+import (
+	"testing"
+
+	"example.com/pkgs/store"
+)
+
+func TestNew(t *testing.T) {
+	if store.New() == nil {
+		t.Fatal("nil")
+	}
+}
+`
+    );
+    writeFileSync(
+      appFile,
+      `package app
+
+import "example.com/pkgs/store"
+
+func Open() *store.Store { return store.New() }
+`
+    );
+    writeFileSync(
+      aliasFile,
+      `package app
+
+import st "example.com/pkgs/store"
+
+var shared = st.New()
+`
+    );
+    writeFileSync(
+      cmdFile,
+      `package cmd
+
+import "example.com/pkgs/store"
+
+func Run() int {
+	storage := 1
+	_ = store.New()
+	return storage
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  const rename = (newName: string, dryRun = false) =>
+    performRenamePackage({ filePath: testDir, importPath, newName, dryRun });
+
+  describe('performRenamePackage', () => {
+    test('should rename the package clause and its comment', async () => {
+      const result = await rename('storage');
+      expect(result.oldName).toBe('store');
+      expect(result.packageFiles).toBe(2);
+      expect(readFileSync(storeFile, 'utf-8')).toContain(
+        '// Package storage keeps values.\npackage storage\n'
+      );
+      const xtest = readFileSync(xtestFile, 'utf-8');
+      expect(xtest).toContain('package storage_test\n');
+      expect(xtest).toContain('if storage.New() == nil {');
+    });
+
+    test('should update qualifiers of importers using the default name', async () => {
+      await rename('storage');
+      expect(readFileSync(appFile, 'utf-8')).toContain(
+        'import "example.com/pkgs/store"\n\nfunc Open() *storage.Store { return storage.New() }'
+      );
+    });
+
+    test('should leave imports with an explicit name alone', async () => {
+      const original = readFileSync(aliasFile, 'utf-8');
+      await rename('storage');
+      expect(readFileSync(aliasFile, 'utf-8')).toBe(original);
+    });
+
+    test('should keep the old name where the new one conflicts', async () => {
+      const result = await rename('storage');
+      expect(result.aliased).toEqual([cmdFile]);
+      expect(result.importers).toBe(2);
+      const content = readFileSync(cmdFile, 'utf-8');
+      expect(content).toContain('import store "example.com/pkgs/store"\n');
+      expect(content).toContain('_ = store.New()');
+    });
+
+    test('should keep the old name where the new one is predeclared', async () => {
+      await rename('len');
+      expect(readFileSync(appFile, 'utf-8')).toContain('len.New()');
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(storeFile, 'utf-8');
+      const result = await rename('storage', true);
+      expect(readFileSync(storeFile, 'utf-8')).toBe(original);
+      expect(formatRenamePackageResults(result)).toContain(
+        'Dry run: 4 files would be changed'
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject unknown import paths',
+        importPath: 'example.com/pkgs/missing',
+        newName: 'storage',
+        error: 'No package with import path example.com/pkgs/missing',
+      },
+      {
+        name: 'should reject renaming to main',
+        importPath,
+        newName: 'main',
+        error: 'Renaming the package to main would turn it into a command',
+      },
+      {
+        name: 'should reject the current name',
+        importPath,
+        newName: 'store',
+        error: "Package example.com/pkgs/store is already named 'store'",
+      },
+      {
+        name: 'should reject invalid names',
+        importPath,
+        newName: 'my-store',
+        error: "'my-store' is not a valid Go identifier",
+      },
+    ];
+
+    errorCases.forEach(({ name, importPath, newName, error }) => {
+      test(name, async () => {
+        await expect(
+          performRenamePackage({ filePath: testDir, importPath, newName })
+        ).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatRenamePackageResults', () => {
+    test('should report files that keep the old name', () => {
+      expect(
+        formatRenamePackageResults({
+          importPath: 'example.com/m/store',
+          oldName: 'store',
+          newName: 'storage',
+          packageFiles: 1,
+          importers: 2,
+          aliased: ['cmd/cmd.go'],
+          warnings: [],
+          changes: [{ filePath: 'store.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Renamed package store (example.com/m/store) to storage in 1 file and 2 files importing it\nKept the name store as an explicit import name, since storage is taken there:\n  cmd/cmd.go\n\nModified 1 file:\n  store.go'
+      );
+    });
+  });
+});
@@ -0,0 +1,589 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performRenameSymbol,
+  formatRenameSymbolResults,
+} from '../../src/core/rename-symbol-tool.js';
+
+describe('Rename Symbol Tool', () => {
+  const testDir = 'tests/temp-rename-symbol';
+  const storeFile = `${testDir}/store/store.go`;
+  const appFile = `${testDir}/app/app.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/store`, { recursive: true });
+    mkdirSync(`${testDir}/app`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/rename\n\ngo 1.22\n');
+    writeFileSync(
+      storeFile,
+      `package store
+
+import "fmt"
+
+type Getter interface {
+	Get(key string) string
+}
+
+type Store struct {
+	Name string
+	data map[string]string
+}
+
+func (s *Store) Get(key string) string { return s.data[key] }
+
+type Mem struct{}
+
+func (Mem) Get(key string) string { return key }
+
+func Lookup(g Getter, key string) string {
+	v := g.Get(key)
+	fmt.Println(v)
+	return v
+}
+
+func Describe(s *Store) string {
+	count := 1
+	if count > 0 {
+		total := Lookup(s, "k")
+		_ = total + fmt.Sprint(count)
+	}
+	return fmt.Sprint("Lookup", s.Name, count)
+}
+`
+    );
+    writeFileSync(
+      appFile,
+      `package app
+
+import "example.com/rename/store"
+
+func Run() string {
+	s := &store.Store{Name: "x"}
+	_ = s.Name
+	return store.Lookup(s, "k") + s.Get("a")
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Locates the first occurrence of text in store.go; the identifier
+  // starts where text does.
+  const at = (text: string) => {
+    const lines = readFileSync(storeFile, 'utf-8').split('\n');
+    const line = lines.findIndex(l => l.includes(text));
+    return {
+      filePath: storeFile,
+      line: line + 1,
+      column: lines[line].indexOf(text) + 1,
+    };
+  };
+
+  describe('performRenameSymbol', () => {
+    test('should rename qualified references in other packages', async () => {
+      const result = await performRenameSymbol({
+        ...at('Lookup(g'),
+        newName: 'Find',
+      });
+      expect(result.kind).toBe('func');
+      expect(result.references).toBe(3);
+      expect(readFileSync(storeFile, 'utf-8')).toContain(
+        'func Find(g Getter, key string) string {'
+      );
+      expect(readFileSync(appFile, 'utf-8')).toContain(
+        'return store.Find(s, "k") + s.Get("a")'
+      );
+    });
+
+    test('should report names spelled in strings', async () => {
+      const result = await performRenameSymbol({
+        ...at('Lookup(g'),
+        newName: 'Find',
+      });
+      expect(result.warnings).toEqual([
+        `${storeFile}:32:20: return fmt.Sprint("Lookup", s.Name, count)`,
+      ]);
+    });
+
+    test('should update whole words in adjacent comments', async () => {
+      const original = readFileSync(storeFile, 'utf-8');
+      writeFileSync(
+        storeFile,
+        original
+          .replace(
+            '\tGet(key string)',
+            '\t// Get returns the value of key; see Getter, Forget.\n\tGet(key string)'
+          )
+          .replace(
+            'return s.data[key] }',
+            'return s.data[key] } // Get reads s.data'
+          )
+          .replace('type Mem struct{}', '// Mem has Get.\ntype Mem struct{}')
+      );
+      const result = await performRenameSymbol({
+        ...at('Get(key)'),
+        newName: 'Fetch',
+        updateComments: true,
+      });
+      expect(result.comments).toBe(2);
+      const content = readFileSync(storeFile, 'utf-8');
+      expect(content).toContain(
+        '\t// Fetch returns the value of key; see Getter, Forget.\n\tFetch(key string)'
+      );
+      expect(content).toContain('return s.data[key] } // Fetch reads s.data');
+      expect(content).toContain('// Mem has Get.\n');
+    });
+
+    test('should replace strings that spell exactly the old name', async () => {
+      writeFileSync(
+        storeFile,
+        readFileSync(storeFile, 'utf-8') + '\nvar usage = "Lookup key"\n'
+      );
+      const result = await performRenameSymbol({
+        ...at('Lookup(g'),
+        newName: 'Find',
+        updateStrings: true,
+      });
+      expect(result.strings).toBe(1);
+      expect(result.warnings).toEqual([
+        `${storeFile}:35:13: var usage = "Lookup key"`,
+      ]);
+      expect(readFileSync(storeFile, 'utf-8')).toContain(
+        'fmt.Sprint("Find", s.Name, count)'
+      );
+    });
+
+    test('should rename a method found by its name', async () => {
+      const result = await performRenameSymbol({
+        filePath: appFile,
+        symbol: 'store.Store.Get',
+        newName: 'Fetch',
+      });
+      expect(result.related).toEqual(['Getter.Get', 'Mem.Get']);
+      expect(readFileSync(appFile, 'utf-8')).toContain('s.Fetch("a")');
+    });
+
+    test('should rename fields in selectors and composite literals', async () => {
+      await performRenameSymbol({ ...at('Name string'), newName: 'Title' });
+      const app = readFileSync(appFile, 'utf-8');
+      expect(app).toContain('s := &store.Store{Title: "x"}\n\t_ = s.Title\n');
+      expect(readFileSync(storeFile, 'utf-8')).toContain(
+        'fmt.Sprint("Lookup", s.Title, count)'
+      );
+    });
+
+    test('should rename methods of interfaces and their implementations', async () => {
+      const result = await performRenameSymbol({
+        ...at('Get(key)'),
+        newName: 'Fetch',
+      });
+      expect(result.kind).toBe('method');
+      expect(result.related).toEqual(['Store.Get', 'Mem.Get']);
+      const content = readFileSync(storeFile, 'utf-8');
+      expect(content).toContain('\tFetch(key string) string\n');
+      expect(content).toContain('func (s *Store) Fetch(key string) string');
+      expect(content).toContain('func (Mem) Fetch(key string) string');
+      expect(content).toContain('v := g.Fetch(key)');
+      expect(readFileSync(appFile, 'utf-8')).toContain('s.Fetch("a")');
+    });
+
+    test('should not modify files in a dry run', async () => {
+      const original = readFileSync(storeFile, 'utf-8');
+      const result = await performRenameSymbol({
+        ...at('count :='),
+        newName: 'n',
+        dryRun: true,
+      });
+      expect(readFileSync(storeFile, 'utf-8')).toBe(original);
+      expect(result.warnings).toEqual([]);
+      const output = formatRenameSymbolResults(result);
+      expect(output).toContain('+\tif n > 0 {\n');
+      expect(output).toContain('Dry run: 1 file would be changed');
+    });
+
+    test('should report the stages of the rename', async () => {
+      const messages: string[] = [];
+      await performRenameSymbol({
+        ...at('Lookup(g'),
+        newName: 'Find',
+        onProgress: message => messages.push(message),
+      });
+      expect(messages).toEqual([
+        'Loading packages (1/3)',
+        'Loading packages (2/3)',
+        'Loading packages (3/3)',
+        'Type-checking packages (1/2)',
+        'Type-checking packages (2/2)',
+        'Finding references',
+        'Writing files (1/2)',
+        'Writing files (2/2)',
+      ]);
+    });
+
+    test('should not start a cancelled rename', async () => {
+      const controller = new AbortController();
+      controller.abort();
+      await expect(
+        performRenameSymbol({
+          ...at('Lookup(g'),
+          newName: 'Find',
+          signal: controller.signal,
+        })
+      ).rejects.toMatchObject({ code: 'cancelled' });
+    });
+
+    test('should stop a rename cancelled while it runs', async () => {
+      const original = readFileSync(storeFile, 'utf-8');
+      const controller = new AbortController();
+      await expect(
+        performRenameSymbol({
+          ...at('Lookup(g'),
+          newName: 'Find',
+          onProgress: message => {
+            if (message === 'Finding references') controller.abort();
+          },
+          signal: controller.signal,
+        })
+      ).rejects.toMatchObject({ code: 'cancelled' });
+      expect(readFileSync(storeFile, 'utf-8')).toBe(original);
+    });
+
+    describe('workspaces', () => {
+      const toolFile = `${testDir}/tool/main.go`;
+
+      beforeEach(() => {
+        mkdirSync(`${testDir}/tool`, { recursive: true });
+        writeFileSync(
+          `${testDir}/tool/go.mod`,
+          'module example.com/tool\n\ngo 1.22\n\nrequire example.com/rename v0.0.0\n'
+        );
+        writeFileSync(
+          toolFile,
+          `package main
+
+import "example.com/rename/store"
+
+func main() { println(store.Lookup(store.Mem{}, "k")) }
+`
+        );
+      });
+
+      test('should rename in the other modules of go.work', async () => {
+        writeFileSync(
+          `${testDir}/go.work`,
+          'go 1.22\n\nuse (\n\t.\n\t./tool\n)\n'
+        );
+        const result = await performRenameSymbol({
+          ...at('Lookup(g'),
+          newName: 'Find',
+        });
+        expect(result.references).toBe(4);
+        expect(readFileSync(toolFile, 'utf-8')).toContain(
+          'println(store.Find(store.Mem{}, "k"))'
+        );
+      });
+
+      test('should leave modules outside go.work alone', async () => {
+        writeFileSync(`${testDir}/go.work`, 'go 1.22\n\nuse .\n');
+        const result = await performRenameSymbol({
+          ...at('Lookup(g'),
+          newName: 'Find',
+        });
+        expect(result.references).toBe(3);
+        expect(readFileSync(toolFile, 'utf-8')).toContain('store.Lookup(');
+      });
+    });
+
+    describe('build constraints', () => {
+      const taggedFile = `${testDir}/app/app_integration.go`;
+
+      beforeEach(() => {
+        writeFileSync(
+          taggedFile,
+          `//go:build integration
+
+package app
+
+import "example.com/rename/store"
+
+var probe = store.Lookup
+`
+        );
+      });
+
+      test('should warn about files the constraints exclude', async () => {
+        const result = await performRenameSymbol({
+          ...at('Lookup(g'),
+          newName: 'Find',
+        });
+        expect(result.warnings).toContain(
+          `${taggedFile} is excluded by build constraints (//go:build integration)`
+        );
+        expect(readFileSync(taggedFile, 'utf-8')).toContain('store.Lookup');
+      });
+
+      test('should rename in files selected by build tags', async () => {
+        const result = await performRenameSymbol({
+          ...at('Lookup(g'),
+          newName: 'Find',
+          buildFlags: ['-tags=integration'],
+        });
+        expect(result.references).toBe(4);
+        expect(readFileSync(taggedFile, 'utf-8')).toContain(
+          'var probe = store.Find\n'
+        );
+      });
+
+      test('should reject locations in excluded files', async () => {
+        await expect(
+          performRenameSymbol({
+            filePath: taggedFile,
+            line: 7,
+            column: 5,
+            newName: 'check',
+            goos: 'linux',
+          })
+        ).rejects.toThrow(
+          'is excluded by its build constraints (//go:build integration)'
+        );
+      });
+    });
+
+    describe('generics', () => {
+      const genericFile = `${testDir}/store/generic.go`;
+      const usesFile = `${testDir}/app/generic.go`;
+
+      beforeEach(() => {
+        writeFileSync(
+          genericFile,
+          `package store
+
+type Number interface{ ~int | ~float64 }
+
+func Map[T any, U any](xs []T, f func(T) U) []U {
+	var out []U
+	for _, x := range xs {
+		out = append(out, f(x))
+	}
+	return out
+}
+
+func Sum[N Number](xs ...N) N {
+	var s N
+	return s
+}
+
+type List[T any] struct{ items []T }
+
+func (l *List[T]) Push(v T) { l.items = append(l.items, v) }
+
+func Keys[M ~map[K]V, K comparable, V any](m M) []K { return nil }
+
+func Id[V any](v V) V { return v }
+`
+        );
+        writeFileSync(
+          usesFile,
+          `package app
+
+import "example.com/rename/store"
+
+func Generic() {
+	_ = store.Map([]int{1}, func(i int) int { return i })
+	_ = store.Map[int, string]
+	l := &store.List[string]{}
+	l.Push("a")
+	_ = store.Keys(map[store.Mem]int{})[0].Get("k")
+}
+`
+        );
+      });
+
+      // Locates the first occurrence of text in generic.go.
+      const inGeneric = (text: string) => {
+        const lines = readFileSync(genericFile, 'utf-8').split('\n');
+        const line = lines.findIndex(l => l.includes(text));
+        return {
+          filePath: genericFile,
+          line: line + 1,
+          column: lines[line].indexOf(text) + 1,
+        };
+      };
+
+      test('should rename generic functions where instantiated', async () => {
+        const result = await performRenameSymbol({
+          ...inGeneric('Map['),
+          newName: 'Apply',
+        });
+        expect(result.references).toBe(3);
+        const uses = readFileSync(usesFile, 'utf-8');
+        expect(uses).toContain('_ = store.Apply([]int{1}, func');
+        expect(uses).toContain('_ = store.Apply[int, string]\n');
+      });
+
+      test('should rename type parameters in their declaration', async () => {
+        const result = await performRenameSymbol({
+          ...inGeneric('T any, U'),
+          newName: 'Elem',
+        });
+        expect(result.kind).toBe('type parameter');
+        const src = readFileSync(genericFile, 'utf-8');
+        expect(src).toContain(
+          'func Map[Elem any, U any](xs []Elem, f func(Elem) U) []U {'
+        );
+        expect(src).toContain('type List[T any] struct{ items []T }');
+      });
+
+      test('should rename methods called on instantiations', async () => {
+        const lines = readFileSync(usesFile, 'utf-8').split('\n');
+        const result = await performRenameSymbol({
+          filePath: usesFile,
+          line: lines.findIndex(l => l.includes('l.Push')) + 1,
+          column: 4,
+          newName: 'Add',
+        });
+        expect(result.references).toBe(2);
+        expect(readFileSync(genericFile, 'utf-8')).toContain(
+          'func (l *List[T]) Add(v T) {'
+        );
+      });
+
+      test('should infer type arguments from constraints', async () => {
+        const result = await performRenameSymbol({
+          ...at('Get(key string) string {'),
+          newName: 'Fetch',
+        });
+        expect(result.related).toContain('Mem.Get');
+        expect(readFileSync(usesFile, 'utf-8')).toContain('[0].Fetch("k")');
+      });
+
+      test('should reject type parameters hiding constraints', async () => {
+        await expect(
+          performRenameSymbol({ ...inGeneric('N Number'), newName: 'Number' })
+        ).rejects.toThrow(
+          "Renaming would make 'Number' at tests/temp-rename-symbol/store/generic.go:13:12 refer to the renamed type parameter"
+        );
+      });
+
+      test('should reject selectors on uninferred type arguments', async () => {
+        writeFileSync(
+          usesFile,
+          `package app
+
+import "example.com/rename/store"
+
+func Reverse() {
+	_ = store.Map([]store.Mem{}, store.Id)[0].Get("k")
+}
+`
+        );
+        await expect(
+          performRenameSymbol({
+            ...at('Get(key string) string {'),
+            newName: 'Fetch',
+          })
+        ).rejects.toThrow(
+          "Cannot rename 'Get': the selector at tests/temp-rename-symbol/app/generic.go:6:44 may select it, but the type of its operand depends on a type argument of a generic call that cannot be inferred"
+        );
+      });
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject names declared in the same scope',
+        text: 'v :=',
+        newName: 'key',
+        error: "'key' is already declared in the same scope at",
+      },
+      {
+        name: 'should reject names declared in the package',
+        text: 'Lookup(g',
+        newName: 'Describe',
+        error: "'Describe' is already declared in package store",
+      },
+      {
+        name: 'should reject shadowed references',
+        text: 'count :=',
+        newName: 'total',
+        error: 'Renaming would make the reference at',
+      },
+      {
+        name: 'should reject captured uses of the new name',
+        text: 'v :=',
+        newName: 'fmt',
+        error: "Renaming would make 'fmt' at",
+      },
+      {
+        name: 'should reject unexporting symbols used by other packages',
+        text: 'Lookup(g',
+        newName: 'lookup',
+        error: "'lookup' would be unexported, but 'Lookup' is used outside",
+      },
+      {
+        name: 'should reject methods that clash with fields',
+        text: 'Get(key)',
+        newName: 'Name',
+        error: "Cannot rename to 'Name': 'Store' has a field Name",
+      },
+      {
+        name: 'should reject package names',
+        text: 'fmt.Println',
+        newName: 'f',
+        error: "'fmt' is a package name, which cannot be renamed",
+      },
+    ];
+
+    errorCases.forEach(({ name, text, newName, error }) => {
+      test(name, async () => {
+        await expect(
+          performRenameSymbol({ ...at(text), newName })
+        ).rejects.toThrow(error);
+      });
+    });
+
+    test('should report conflicts with their location', async () => {
+      await expect(
+        performRenameSymbol({ ...at('v :='), newName: 'key' })
+      ).rejects.toMatchObject({
+        code: 'name_conflict',
+        location: { filePath: storeFile },
+      });
+    });
+  });
+
+  describe('formatRenameSymbolResults', () => {
+    test('should report related methods and warnings', () => {
+      expect(
+        formatRenameSymbolResults({
+          oldName: 'Get',
+          newName: 'Fetch',
+          kind: 'method',
+          references: 3,
+          related: ['Mem.Get'],
+          comments: 2,
+          strings: 1,
+          warnings: ['store.go:3:1: "Get"'],
+          changes: [{ filePath: 'store.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Renamed method 'Get' to 'Fetch' at 3 locations in 1 file\nAlso updated 2 mentions in comments and 1 string literal\nAlso renamed the related methods:\n  Mem.Get\nNot updated, check these by hand:\n  store.go:3:1: \"Get\"\n\nModified 1 file:\n  store.go"
+      );
+    });
+  });
+});
@@ -0,0 +1,240 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performReorderParameters,
+  formatReorderParametersResults,
+} from '../../src/core/reorder-parameters-tool.js';
+
+describe('Reorder Parameters Tool', () => {
+  const testDir = 'tests/temp-reorder-parameters';
+  const storeFile = `${testDir}/store/store.go`;
+  const appFile = `${testDir}/app/app.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/store`, { recursive: true });
+    mkdirSync(`${testDir}/app`, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/rp\n\ngo 1.22\n');
+    writeFileSync(
+      storeFile,
+      `package store
+
+import "context"
+
+type Getter interface {
+	Get(key string, ctx context.Context) (string, error)
+}
+
+type Store struct{}
+
+func (s *Store) Get(key string, ctx context.Context) (string, error) {
+	return key, ctx.Err()
+}
+
+func Fetch(url string, onErr func(error), ctx context.Context, opts ...string) string {
+	return url
+}
+
+func Load(ctx context.Context, path string) {}
+`
+    );
+    writeFileSync(
+      appFile,
+      `package app
+
+import (
+	"context"
+
+	"example.com/rp/store"
+)
+
+func Run(ctx context.Context, g store.Getter) {
+	v, _ := g.Get("k", ctx)
+	store.Fetch(v, nil, ctx, "a", "b")
+	_ = store.Fetch(store.Fetch("x", nil, ctx), nil, ctx)
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('performReorderParameters', () => {
+    test('should move the context first and update every call', async () => {
+      const result = await performReorderParameters({ filePath: storeFile });
+      expect(result.functions).toEqual([
+        {
+          name: 'Getter.Get',
+          location: 'tests/temp-reorder-parameters/store/store.go:6:2',
+          signature: 'Get(ctx context.Context, key string) (string, error)',
+          related: ['tests/temp-reorder-parameters/store/store.go:11:17'],
+          callSites: 1,
+        },
+        {
+          name: 'Fetch',
+          location: 'tests/temp-reorder-parameters/store/store.go:15:6',
+          signature:
+            'func Fetch(ctx context.Context, url string, onErr func(error), opts ...string) string',
+          related: [],
+          callSites: 3,
+        },
+      ]);
+      expect(readFileSync(storeFile, 'utf-8')).toContain(
+        'func (s *Store) Get(ctx context.Context, key string) (string, error) {'
+      );
+      expect(readFileSync(appFile, 'utf-8')).toContain(
+        '\tv, _ := g.Get(ctx, "k")\n\tstore.Fetch(ctx, v, nil, "a", "b")\n\t_ = store.Fetch(ctx, store.Fetch(ctx, "x", nil), nil)\n'
+      );
+    });
+
+    test('should move error handlers last, before a variadic parameter', async () => {
+      await performReorderParameters({
+        filePath: storeFile,
+        errorHandlersLast: true,
+      });
+      expect(readFileSync(storeFile, 'utf-8')).toContain(
+        'func Fetch(ctx context.Context, url string, onErr func(error), opts ...string) string {'
+      );
+      writeFileSync(
+        `${testDir}/store/more.go`,
+        'package store\n\nimport "context"\n\ntype Handler func(ctx context.Context, err error)\n\nfunc Watch(ctx context.Context, h Handler, name string) { Watch(ctx, nil, name) }\n'
+      );
+      await performReorderParameters({
+        filePath: storeFile,
+        errorHandlersLast: true,
+      });
+      expect(readFileSync(`${testDir}/store/more.go`, 'utf-8')).toContain(
+        'func Watch(ctx context.Context, name string, h Handler) { Watch(ctx, name, nil) }'
+      );
+    });
+
+    test('should leave alone functions whose calls cannot be updated', async () => {
+      writeFileSync(
+        `${testDir}/store/more.go`,
+        `package store
+
+import "context"
+
+func Both(a, b context.Context) {}
+
+func Wrap(a string, ctx context.Context) string {
+	return Fetch(a, nil, ctx)
+}
+
+var handler = Wrap
+
+func Next(n int, ctx context.Context) int { return n }
+
+func use() int { return Next(step(), background()) }
+
+func step() int { return 0 }
+
+func background() context.Context { return context.Background() }
+`
+      );
+      const result = await performReorderParameters({ filePath: storeFile });
+      expect(result.skipped).toEqual([
+        {
+          name: 'Both',
+          location: 'tests/temp-reorder-parameters/store/more.go:5:6',
+          reason: 'it takes 2 context.Context parameters',
+        },
+        {
+          name: 'Wrap',
+          location: 'tests/temp-reorder-parameters/store/more.go:7:6',
+          reason:
+            "Cannot change the signature of 'Wrap', which is used as a value at tests/temp-reorder-parameters/store/more.go:11:15",
+        },
+        {
+          name: 'Next',
+          location: 'tests/temp-reorder-parameters/store/more.go:13:6',
+          reason:
+            'Reordering the arguments at tests/temp-reorder-parameters/store/more.go:15:25 would change the order in which they are evaluated',
+        },
+      ]);
+      expect(result.functions.map(f => f.name)).toEqual([
+        'Getter.Get',
+        'Fetch',
+      ]);
+      expect(readFileSync(`${testDir}/store/more.go`, 'utf-8')).toContain(
+        '\treturn Fetch(ctx, a, nil)\n'
+      );
+    });
+
+    test('should report packages that follow the convention', async () => {
+      writeFileSync(
+        storeFile,
+        'package store\n\nimport "context"\n\nfunc Load(ctx context.Context, path string) {}\n'
+      );
+      const result = await performReorderParameters({ filePath: storeFile });
+      expect(result.functions).toEqual([]);
+      expect(result.changes).toEqual([]);
+    });
+
+    test('should not modify files in dry run mode', async () => {
+      const original = readFileSync(appFile, 'utf-8');
+      const result = await performReorderParameters({
+        filePath: storeFile,
+        dryRun: true,
+      });
+      expect(result.changes).toHaveLength(2);
+      expect(readFileSync(appFile, 'utf-8')).toBe(original);
+    });
+  });
+
+  describe('formatReorderParametersResults', () => {
+    test('should list the functions changed and those left alone', () => {
+      expect(
+        formatReorderParametersResults({
+          packageName: 'store',
+          functions: [
+            {
+              name: 'Getter.Get',
+              location: 'store.go:6:2',
+              signature: 'Get(ctx context.Context, key string) error',
+              related: ['store.go:11:17'],
+              callSites: 1,
+            },
+          ],
+          skipped: [
+            {
+              name: 'Both',
+              location: 'store.go:15:6',
+              reason: 'it takes 2 context.Context parameters',
+            },
+          ],
+          changes: [{ filePath: 'store.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Reordered the parameters of 1 function:\n  Getter.Get (store.go:6:2): Get(ctx context.Context, key string) error, 1 call site\n    also store.go:11:17\nLeft alone:\n  Both (store.go:15:6): it takes 2 context.Context parameters\n\nModified 1 file:\n  store.go'
+      );
+    });
+
+    test('should report packages that follow the convention', () => {
+      expect(
+        formatReorderParametersResults({
+          packageName: 'store',
+          functions: [],
+          skipped: [],
+          changes: [],
+          dryRun: false,
+        })
+      ).toBe(
+        'The parameters of the functions of package store already follow the convention'
+      );
+    });
+  });
+});
@@ -0,0 +1,228 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performSafeDelete,
+  formatSafeDeleteResults,
+} from '../../src/core/safe-delete-tool.js';
+
+describe('Safe Delete Tool', () => {
+  const testDir = 'tests/temp-safe-delete';
+  const shapesFile = `${testDir}/shapes/shapes.go`;
+  const extraFile = `${testDir}/shapes/extra.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/shapes`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/safe\n\ngo 1.22\n');
+    writeFileSync(
+      shapesFile,
+      `package shapes
+
+import (
+	"fmt"
+	"strings"
+)
+
+type shape interface {
+	area() float64
+}
+
+type square struct{ side float64 }
+
+func (s square) area() float64 { return s.side * s.side }
+
+// circle is not used anywhere.
+type circle struct{ r float64 }
+
+func (c circle) describe() string { return fmt.Sprintf("circle %v", c.r) }
+
+const (
+	small = iota
+	large
+)
+
+const (
+	red   = "red"
+	green = "green"
+)
+
+var counter = next()
+
+func next() int { return 0 }
+
+func label(s string) string {
+	return strings.ToUpper(s) + fact(3)
+}
+
+func fact(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fact(n - 1)
+}
+
+func Total(shapes []shape) float64 {
+	sum := 0.0
+	for _, s := range shapes {
+		sum += s.area()
+	}
+	_ = square{}
+	return sum + float64(small+large) + float64(len(green))
+}
+`
+    );
+    writeFileSync(
+      extraFile,
+      `package shapes
+
+func (c circle) scale(f float64) circle { return circle{c.r * f} }
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Locates the first occurrence of text in shapes.go.
+  const at = (text: string) => {
+    const lines = readFileSync(shapesFile, 'utf-8').split('\n');
+    const line = lines.findIndex(l => l.includes(text));
+    return {
+      filePath: shapesFile,
+      line: line + 1,
+      column: lines[line].indexOf(text) + 1,
+    };
+  };
+
+  describe('performSafeDelete', () => {
+    test('should delete a type with its methods and prune imports', async () => {
+      const result = await performSafeDelete(at('circle struct'));
+      expect(result.deleted).toBe(true);
+      expect(result.methods).toEqual(['circle.scale', 'circle.describe']);
+      const content = readFileSync(shapesFile, 'utf-8');
+      expect(content).not.toContain('circle');
+      expect(content).not.toContain('"fmt"');
+      expect(content).toContain('import (\n\t"strings"\n)\n');
+      expect(readFileSync(extraFile, 'utf-8')).toBe('package shapes\n');
+    });
+
+    test('should ignore references inside the declaration', async () => {
+      const result = await performSafeDelete(at('fact(n int)'));
+      expect(result.deleted).toBe(false);
+      expect(result.blockers).toEqual([
+        {
+          filePath: shapesFile,
+          line: 36,
+          column: 30,
+          snippet: 'return strings.ToUpper(s) + fact(3)',
+          viaInterface: false,
+        },
+      ]);
+    });
+
+    test('should delete unreferenced functions', async () => {
+      await performSafeDelete(at('label(s'));
+      const content = readFileSync(shapesFile, 'utf-8');
+      expect(content).not.toContain('label');
+      expect(content).toContain('var counter = next()\n\nfunc next() int');
+      expect(content).toContain('import (\n\t"fmt"\n)\n');
+    });
+
+    test('should delete one spec of a group', async () => {
+      await performSafeDelete(at('red '));
+      expect(readFileSync(shapesFile, 'utf-8')).toContain(
+        'const (\n\tgreen = "green"\n)\n'
+      );
+    });
+
+    test('should report interface methods a method may implement', async () => {
+      const result = await performSafeDelete(at('area() float64 {'));
+      expect(result.deleted).toBe(false);
+      expect(result.blockers).toHaveLength(1);
+      expect(result.blockers[0]).toMatchObject({ line: 9, viaInterface: true });
+    });
+
+    test('should not modify files when references remain', async () => {
+      const original = readFileSync(shapesFile, 'utf-8');
+      const result = await performSafeDelete(at('square struct'));
+      expect(readFileSync(shapesFile, 'utf-8')).toBe(original);
+      expect(result.changes).toEqual([]);
+      expect(formatSafeDeleteResults(result)).toContain(
+        "Cannot delete type 'square', which is still used at 1 location:"
+      );
+    });
+
+    test('should delete exported symbols when forced', async () => {
+      const result = await performSafeDelete({
+        ...at('Total('),
+        force: true,
+        dryRun: true,
+      });
+      expect(result.deleted).toBe(true);
+      expect(formatSafeDeleteResults(result)).toContain(
+        'Dry run: 1 file would be changed'
+      );
+    });
+
+    const errorCases = [
+      {
+        name: 'should require force for exported symbols',
+        text: 'Total(',
+        error: "'Total' is exported, so code outside the module may use it",
+      },
+      {
+        name: 'should reject initializers with side effects',
+        text: 'counter',
+        error: "The initializer of 'counter' may have side effects",
+      },
+      {
+        name: 'should reject constants that later ones depend on',
+        text: 'small =',
+        error: "Deleting 'small' would change the values of the constants",
+      },
+      {
+        name: 'should reject locals',
+        text: 'sum :=',
+        error: "'sum' is a var that is not declared at package level",
+      },
+    ];
+
+    errorCases.forEach(({ name, text, error }) => {
+      test(name, async () => {
+        await expect(performSafeDelete(at(text))).rejects.toThrow(error);
+      });
+    });
+  });
+
+  describe('formatSafeDeleteResults', () => {
+    test('should report the deleted methods', () => {
+      expect(
+        formatSafeDeleteResults({
+          symbol: 'circle',
+          kind: 'type',
+          filePath: 'shapes.go',
+          deleted: true,
+          blockers: [],
+          methods: ['circle.describe'],
+          warnings: [],
+          changes: [{ filePath: 'shapes.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Deleted type 'circle' from shapes.go together with its methods 'circle.describe'\n\nModified 1 file:\n  shapes.go"
+      );
+    });
+  });
+});
@@ -0,0 +1,228 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performSortStructFields,
+  formatSortStructFieldsResults,
+} from '../../src/core/sort-struct-fields-tool.js';
+
+describe('Sort Struct Fields Tool', () => {
+  const testDir = 'tests/temp-sort-struct-fields';
+  const mainFile = `${testDir}/main.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/sort\n\ngo 1.22\n');
+    writeFileSync(
+      mainFile,
+      `package main
+
+import (
+	"io"
+	"time"
+)
+
+// Record is a record.
+type Record struct {
+	// Name of the record.
+	Name string \`json:"name"\` // required
+	io.Reader // embedded
+	id   int
+	Flag bool
+	Meta struct {
+		X int
+	} \`json:"meta"\`
+	Alpha, beta float32
+	ok bool // ok
+	// The end.
+}
+
+type small struct {
+	a    bool
+	when time.Time
+	b    int64
+	c    bool
+	none struct{}
+}
+
+func main() {
+	_ = Record{Name: "x"}
+	_ = small{a: true}
+}
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  const sort = (
+    typeName: string,
+    strategy: 'alphabetical' | 'visibility' | 'size'
+  ) => performSortStructFields({ filePath: mainFile, typeName, strategy });
+
+  describe('performSortStructFields', () => {
+    const testCases = [
+      {
+        name: 'should sort fields by name after the embedded ones',
+        strategy: 'alphabetical' as const,
+        fields: ['Reader', 'Alpha', 'beta', 'Flag', 'id', 'Meta', 'Name', 'ok'],
+        expected: `type Record struct {
+	io.Reader   // embedded
+	Alpha, beta float32
+	Flag        bool
+	id          int
+	Meta        struct {
+		X int
+	} \`json:"meta"\`
+	// Name of the record.
+	Name string \`json:"name"\` // required
+	ok   bool   // ok
+	// The end.
+}`,
+      },
+      {
+        name: 'should move exported fields first',
+        strategy: 'visibility' as const,
+        fields: ['Reader', 'Name', 'Flag', 'Meta', 'Alpha', 'beta', 'id', 'ok'],
+        expected: `type Record struct {
+	io.Reader // embedded
+	// Name of the record.
+	Name string \`json:"name"\` // required
+	Flag bool
+	Meta struct {
+		X int
+	} \`json:"meta"\`
+	Alpha, beta float32
+	id          int
+	ok          bool // ok
+	// The end.
+}`,
+      },
+    ];
+
+    testCases.forEach(({ name, strategy, fields, expected }) => {
+      test(name, async () => {
+        const result = await sort('Record', strategy);
+        expect(result.fields).toEqual(fields);
+        expect(readFileSync(mainFile, 'utf-8')).toContain(expected);
+      });
+    });
+
+    test('should order fields by alignment to reduce padding', async () => {
+      const result = await sort('small', 'size');
+      expect(result.fields).toEqual(['none', 'when', 'b', 'a', 'c']);
+      expect(result.sizes).toEqual({ before: 48, after: 40 });
+      expect(readFileSync(mainFile, 'utf-8')).toContain(
+        'type small struct {\n\tnone struct{}\n\twhen time.Time\n\tb    int64\n\ta    bool\n\tc    bool\n}'
+      );
+    });
+
+    test('should compute sizes for the target architecture', async () => {
+      const result = await performSortStructFields({
+        filePath: mainFile,
+        typeName: 'small',
+        strategy: 'size',
+        goarch: '386',
+      });
+      expect(result.sizes).toEqual({ before: 36, after: 32 });
+    });
+
+    test('should warn about exported types and order-sensitive packages', async () => {
+      writeFileSync(
+        `${testDir}/encode.go`,
+        'package main\n\nimport "encoding/json"\n\nfunc encode(r Record) ([]byte, error) { return json.Marshal(r) }\n'
+      );
+      const result = await sort('Record', 'alphabetical');
+      expect(result.warnings).toEqual([
+        "'Record' is exported: unkeyed composite literals of it outside the module break",
+        `These files use 'Record' with packages that follow the order of its fields: ${testDir}/encode.go (encoding/json)`,
+      ]);
+    });
+
+    test('should leave sorted structs alone', async () => {
+      await sort('Record', 'alphabetical');
+      const content = readFileSync(mainFile, 'utf-8');
+      const result = await sort('Record', 'alphabetical');
+      expect(result.changes).toEqual([]);
+      expect(readFileSync(mainFile, 'utf-8')).toBe(content);
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject unkeyed composite literals',
+        code: 'import "time"\n\nvar _ = []small{{true, time.Time{}, 1, false, struct{}{}}}',
+        error:
+          "Cannot reorder the fields of 'small': the composite literal at tests/temp-sort-struct-fields/extra.go:5:17 lists its fields without names",
+      },
+      {
+        name: 'should reject conversions to other struct types',
+        code: 'import "time"\n\ntype twin struct {\n\ta    bool\n\twhen time.Time\n\tb    int64\n\tc    bool\n\tnone struct{}\n}\n\nvar _ = twin(small{})',
+        error:
+          "Cannot reorder the fields of 'small': it is converted to or from another struct type",
+      },
+      {
+        name: 'should reject field offsets',
+        code: 'import "unsafe"\n\nvar _ = unsafe.Offsetof(small{}.b)',
+        error:
+          "Cannot reorder the fields of 'small': unsafe.Offsetof takes the offset",
+      },
+    ];
+
+    errorCases.forEach(({ name, code, error }) => {
+      test(name, async () => {
+        writeFileSync(`${testDir}/extra.go`, `package main\n\n${code}\n`);
+        await expect(sort('small', 'alphabetical')).rejects.toThrow(error);
+      });
+    });
+
+    test('should reject blank fields', async () => {
+      writeFileSync(
+        `${testDir}/extra.go`,
+        'package main\n\ntype padded struct {\n\tz int\n\t_ [0]func()\n}\n'
+      );
+      await expect(sort('padded', 'alphabetical')).rejects.toThrow(
+        "Cannot reorder the fields of 'padded': it has blank fields"
+      );
+    });
+
+    test('should reject sizes of unknown types', async () => {
+      writeFileSync(
+        `${testDir}/extra.go`,
+        'package main\n\nimport "bytes"\n\ntype buffered struct {\n\tok  bool\n\tbuf bytes.Buffer\n}\n'
+      );
+      await expect(sort('buffered', 'size')).rejects.toThrow(
+        "Cannot reorder the fields of 'buffered': the size of field buf, of type bytes.Buffer, is unknown"
+      );
+    });
+  });
+
+  describe('formatSortStructFieldsResults', () => {
+    test('should report the new order, sizes and warnings', () => {
+      expect(
+        formatSortStructFieldsResults({
+          typeName: 'small',
+          strategy: 'size',
+          fields: ['b', 'a'],
+          sizes: { before: 16, after: 16 },
+          warnings: ['careful'],
+          changes: [{ filePath: 'main.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        "Reordered the fields of 'small' by size: b, a\nSize: 16 bytes\nWarnings:\n  careful\n\nModified 1 file:\n  main.go"
+      );
+    });
+  });
+});
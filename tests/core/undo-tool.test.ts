@@ -0,0 +1,185 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import { resolve } from 'path';
+import {
+  performUndo,
+  formatUndoResults,
+} from '../../src/core/undo-tool.js';
+import { performRenameSymbol } from '../../src/core/rename-symbol-tool.js';
+import { commitFileChanges } from '../../src/utils/edit-utils.js';
+import {
+  UNDO_LIMIT,
+  clearUndoHistory,
+  undoableOperations,
+} from '../../src/utils/undo-history.js';
+
+describe('Undo Tool', () => {
+  const testDir = 'tests/temp-undo';
+  const storeFile = `${testDir}/store/store.go`;
+  const mainFile = `${testDir}/main.go`;
+  const storeSrc = `package store
+
+func Lookup(key string) string { return key }
+`;
+  const mainSrc = `package main
+
+import "example.com/undo/store"
+
+func main() { println(store.Lookup("k")) }
+`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/store`, { recursive: true });
+    clearUndoHistory();
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/undo\n\ngo 1.22\n');
+    writeFileSync(storeFile, storeSrc);
+    writeFileSync(mainFile, mainSrc);
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  const rename = (newName: string) =>
+    performRenameSymbol({ filePath: storeFile, symbol: 'Lookup', newName });
+
+  describe('performUndo', () => {
+    test('should restore every file of the last operation', async () => {
+      await rename('Find');
+      expect(readFileSync(mainFile, 'utf-8')).toContain('store.Find("k")');
+      const result = await performUndo({});
+      expect(result.changes.map(c => c.filePath).sort()).toEqual([
+        resolve(mainFile),
+        resolve(storeFile),
+      ]);
+      expect(readFileSync(storeFile, 'utf-8')).toBe(storeSrc);
+      expect(readFileSync(mainFile, 'utf-8')).toBe(mainSrc);
+      expect(result.remaining).toBe(0);
+    });
+
+    test('should undo earlier operations one by one', async () => {
+      await rename('Find');
+      await performRenameSymbol({
+        filePath: storeFile,
+        symbol: 'Find',
+        newName: 'Get',
+      });
+      await performUndo({});
+      expect(readFileSync(storeFile, 'utf-8')).toContain('func Find(');
+      await performUndo({});
+      expect(readFileSync(storeFile, 'utf-8')).toBe(storeSrc);
+      expect((await performUndo({})).undone).toBe(false);
+    });
+
+    test('should delete the files an operation created', async () => {
+      const created = `${testDir}/store/extra.go`;
+      await commitFileChanges([
+        { filePath: created, original: '', updated: 'package store\n' },
+      ]);
+      const result = await performUndo({});
+      expect(result.removed).toEqual([resolve(created)]);
+      expect(existsSync(created)).toBe(false);
+    });
+
+    test('should delete the directories an operation created', async () => {
+      const dir = `${testDir}/store/a/b`;
+      mkdirSync(dir, { recursive: true });
+      await commitFileChanges(
+        [{ filePath: `${dir}/b.go`, original: '', updated: 'package b\n' }],
+        false,
+        { createdDirs: [dir, `${testDir}/store/a`] }
+      );
+      writeFileSync(`${testDir}/store/a/notes.txt`, 'kept\n');
+      const result = await performUndo({});
+      expect(result.removedDirs).toEqual([resolve(dir)]);
+      expect(existsSync(dir)).toBe(false);
+      expect(existsSync(`${testDir}/store/a/notes.txt`)).toBe(true);
+    });
+
+    test('should refuse to undo when a file changed since', async () => {
+      await rename('Find');
+      const edited = readFileSync(mainFile, 'utf-8') + '\n// edited\n';
+      writeFileSync(mainFile, edited);
+      await expect(performUndo({})).rejects.toMatchObject({
+        code: 'files_changed',
+        message: `Cannot undo the last operation: ${mainFile} was modified after it was written. No files were changed`,
+      });
+      expect(readFileSync(mainFile, 'utf-8')).toBe(edited);
+      expect(readFileSync(storeFile, 'utf-8')).toContain('func Find(');
+      expect(undoableOperations()).toBe(1);
+    });
+
+    test('should not modify files in a dry run', async () => {
+      await rename('Find');
+      const result = await performUndo({ dryRun: true });
+      expect(result.changes).toHaveLength(2);
+      expect(readFileSync(storeFile, 'utf-8')).toContain('func Find(');
+      expect(undoableOperations()).toBe(1);
+    });
+
+    test(`should keep the last ${UNDO_LIMIT} operations`, async () => {
+      for (let i = 0; i <= UNDO_LIMIT; i++) {
+        await commitFileChanges([
+          {
+            filePath: storeFile,
+            original: readFileSync(storeFile, 'utf-8'),
+            updated: `${storeSrc}// ${i}\n`,
+          },
+        ]);
+      }
+      expect(undoableOperations()).toBe(UNDO_LIMIT);
+    });
+
+    test('should not record dry runs', async () => {
+      await performRenameSymbol({
+        filePath: storeFile,
+        symbol: 'Lookup',
+        newName: 'Find',
+        dryRun: true,
+      });
+      expect(undoableOperations()).toBe(0);
+    });
+  });
+
+  describe('formatUndoResults', () => {
+    test('should list the restored and deleted files', () => {
+      expect(
+        formatUndoResults({
+          undone: true,
+          changes: [{ filePath: 'a.go', original: 'b', updated: 'a' }],
+          removed: ['b/b.go'],
+          removedDirs: ['b'],
+          remaining: 1,
+          dryRun: false,
+        })
+      ).toBe(
+        'Undid the last operation; 1 earlier operation can still be undone\n\nModified 1 file:\n  a.go\n\nDeleted 1 created file:\n  b/b.go\n\nDeleted 1 created directory:\n  b'
+      );
+    });
+
+    test('should report that there is nothing to undo', () => {
+      expect(
+        formatUndoResults({
+          undone: false,
+          changes: [],
+          removed: [],
+          removedDirs: [],
+          remaining: 0,
+          dryRun: false,
+        })
+      ).toBe('Nothing to undo');
+    });
+  });
+});
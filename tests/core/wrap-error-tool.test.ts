@@ -0,0 +1,215 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import {
+  writeFileSync,
+  readFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+} from 'fs';
+import {
+  performWrapError,
+  formatWrapErrorResults,
+} from '../../src/core/wrap-error-tool.js';
+
+describe('Wrap Error Tool', () => {
+  const testDir = 'tests/temp-wrap-error';
+  const configFile = `${testDir}/config.go`;
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/wrap\n\ngo 1.22\n');
+    writeFileSync(
+      configFile,
+      `package config
+
+import (
+	"errors"
+	"os"
+)
+
+type Config struct{ Data []byte }
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		err := errors.New("empty")
+		return nil, err
+	}
+	if err := validate(data); err != nil {
+		return nil, err
+	}
+	return &Config{Data: data}, nil
+}
+
+func validate(data []byte) error { return nil }
+
+func Save(c *Config, path string) (err error) {
+	err = os.WriteFile(path, c.Data, 0o644)
+	return
+}
+
+func Size() int { return 0 }
+`
+    );
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  // Locates the function declared on the first line starting with prefix.
+  const wrap = (
+    prefix: string,
+    options: { template?: string; functions?: string[] } = {}
+  ) => {
+    const lines = readFileSync(configFile, 'utf-8').split('\n');
+    const line = lines.findIndex(l => l.startsWith(prefix)) + 1;
+    return performWrapError({
+      filePath: configFile,
+      line,
+      column: 6,
+      ...options,
+    });
+  };
+
+  describe('performWrapError', () => {
+    test('should wrap returned errors with the function name', async () => {
+      const result = await wrap('func LoadConfig');
+      expect(result.wrapped).toEqual([
+        { location: `${configFile}:13:15`, message: 'load config: %w' },
+        { location: `${configFile}:20:15`, message: 'load config: %w' },
+      ]);
+      expect(result.skipped).toEqual([
+        `${configFile}:17:15: 'err' is created by errors.New`,
+      ]);
+      const content = readFileSync(configFile, 'utf-8');
+      expect(content).toContain('import (\n\t"errors"\n\t"fmt"\n\t"os"\n)');
+      expect(content).toContain(
+        'return nil, fmt.Errorf("load config: %w", err)\n\t}\n\tif len(data) == 0 {'
+      );
+    });
+
+    test('should fill in the template', async () => {
+      await wrap('func LoadConfig', { template: '{func}: {call} 100%' });
+      expect(readFileSync(configFile, 'utf-8')).toContain(
+        'return nil, fmt.Errorf("LoadConfig: os.ReadFile 100%%: %w", err)'
+      );
+    });
+
+    test('should only wrap errors of the given functions', async () => {
+      const result = await wrap('func LoadConfig', {
+        functions: ['validate'],
+      });
+      expect(result.wrapped.map(w => w.location)).toEqual([
+        `${configFile}:20:15`,
+      ]);
+      const content = readFileSync(configFile, 'utf-8');
+      expect(content).toContain('\t\treturn nil, err\n\t}\n\tif len(data)');
+    });
+
+    test('should report naked returns', async () => {
+      const original = readFileSync(configFile, 'utf-8');
+      const result = await wrap('func Save');
+      expect(result.wrapped).toEqual([]);
+      expect(result.skipped).toEqual([
+        `${configFile}:29:2: naked return of 'err'`,
+      ]);
+      expect(readFileSync(configFile, 'utf-8')).toBe(original);
+    });
+
+    test('should not wrap errors that may be nil', async () => {
+      writeFileSync(
+        configFile,
+        `package config
+
+import "os"
+
+func Open(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	return f, err
+}
+
+func Close(f *os.File) error {
+	err := f.Close()
+	switch {
+	case err != nil && f != nil:
+		return err
+	}
+	if err == nil {
+		return nil
+	} else {
+		err = f.Sync()
+		return err
+	}
+}
+`
+      );
+      const result = await wrap('func Open');
+      expect(result.wrapped).toEqual([]);
+      expect(result.skipped).toEqual([
+        `${configFile}:7:12: 'err' is not checked to be non-nil`,
+      ]);
+      expect(readFileSync(configFile, 'utf-8')).toContain('\treturn f, err\n');
+
+      const closed = await wrap('func Close');
+      expect(closed.wrapped).toEqual([
+        { location: `${configFile}:14:10`, message: 'close: %w' },
+      ]);
+      expect(closed.skipped).toEqual([
+        `${configFile}:20:10: 'err' is not checked to be non-nil`,
+      ]);
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject functions without an error result',
+        prefix: 'func Size',
+        error: 'func Size does not return an error',
+      },
+      {
+        name: 'should reject names hiding package fmt',
+        prefix: 'func LoadConfig',
+        extra: '\nvar fmt = 1\n',
+        error: `'fmt' at ${configFile}:13:15 refers to ${configFile}:34:5 instead of package fmt`,
+      },
+    ];
+
+    errorCases.forEach(({ name, prefix, extra, error }) => {
+      test(name, async () => {
+        if (extra) {
+          writeFileSync(configFile, readFileSync(configFile, 'utf-8') + extra);
+        }
+        const original = readFileSync(configFile, 'utf-8');
+        await expect(wrap(prefix)).rejects.toThrow(error);
+        expect(readFileSync(configFile, 'utf-8')).toBe(original);
+      });
+    });
+  });
+
+  describe('formatWrapErrorResults', () => {
+    test('should list the wrapped and skipped returns', () => {
+      expect(
+        formatWrapErrorResults({
+          functionName: 'func LoadConfig',
+          wrapped: [
+            { location: 'config.go:13:15', message: 'load config: %w' },
+          ],
+          skipped: ["config.go:17:15: 'err' is created by errors.New"],
+          changes: [{ filePath: 'config.go', original: 'a', updated: 'b' }],
+          dryRun: false,
+        })
+      ).toBe(
+        'Wrapped 1 returned error of func LoadConfig:\n  config.go:13:15: "load config: %w"\n\nNot wrapped:\n  config.go:17:15: \'err\' is created by errors.New\n\nModified 1 file:\n  config.go'
+      );
+    });
+  });
+});
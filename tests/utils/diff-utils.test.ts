@@ -0,0 +1,75 @@
+import { describe, test, expect } from 'vitest';
+import { createUnifiedDiff } from '../../src/utils/diff-utils.js';
+
+describe('Diff Utils', () => {
+  describe('createUnifiedDiff', () => {
+    const testCases = [
+      {
+        name: 'should return an empty string for identical content',
+        oldContent: 'a\nb\n',
+        newContent: 'a\nb\n',
+        expected: '',
+      },
+      {
+        name: 'should diff a single changed line with context',
+        oldContent: 'a\nb\nc\nd\ne\n',
+        newContent: 'a\nb\nC\nd\ne\n',
+        expected:
+          '--- a/f.go\n+++ b/f.go\n@@ -1,5 +1,5 @@\n a\n b\n-c\n+C\n d\n e\n',
+      },
+      {
+        name: 'should report insertions into an empty file',
+        oldContent: '',
+        newContent: 'x\n',
+        expected: '--- a/f.go\n+++ b/f.go\n@@ -0,0 +1 @@\n+x\n',
+      },
+      {
+        name: 'should mark a missing trailing newline',
+        oldContent: 'a\nb',
+        newContent: 'a\nb\n',
+        expected:
+          '--- a/f.go\n+++ b/f.go\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n',
+      },
+      {
+        name: 'should split distant changes into separate hunks',
+        oldContent: '1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n',
+        newContent: 'one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n',
+        expected:
+          '--- a/f.go\n+++ b/f.go\n' +
+          '@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n' +
+          '@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n',
+      },
+    ];
+
+    testCases.forEach(({ name, oldContent, newContent, expected }) => {
+      test(name, () => {
+        expect(createUnifiedDiff('f.go', oldContent, newContent)).toBe(
+          expected
+        );
+      });
+    });
+
+    test('should diff rewrites of every line of large files', () => {
+      const lines = (f: (i: number) => string) =>
+        Array.from({ length: 5000 }, (_, i) => `${f(i)}\n`).join('');
+      const diff = createUnifiedDiff(
+        'f.go',
+        lines(i => `old ${i}`),
+        lines(i => `new ${i}`)
+      );
+      expect(diff.match(/^@@.*/gm)).toEqual(['@@ -1,5000 +1,5000 @@']);
+      expect(diff.match(/^-old/gm)).toHaveLength(5000);
+      expect(diff.match(/^\+new/gm)).toHaveLength(5000);
+    });
+
+    test('should merge changes separated by little context', () => {
+      const diff = createUnifiedDiff(
+        'f.go',
+        '1\n2\n3\n4\n5\n',
+        'one\n2\n3\n4\nfive\n'
+      );
+      expect(diff.match(/^@@/gm)).toHaveLength(1);
+      expect(diff).toContain('@@ -1,5 +1,5 @@');
+    });
+  });
+});
@@ -0,0 +1,135 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import { writeFileSync, existsSync, rmSync, mkdirSync, readFileSync } from 'fs';
+import {
+  applyTextEdits,
+  commitFileChanges,
+  formatDryRunDiff,
+} from '../../src/utils/edit-utils.js';
+
+describe('Edit Utils', () => {
+  const testDir = 'tests/temp-edit-utils';
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(testDir, { recursive: true });
+    writeFileSync(`${testDir}/a.go`, 'package a\n');
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  describe('applyTextEdits', () => {
+    const testCases = [
+      {
+        name: 'should apply edits in any order',
+        content: 'foo(bar)',
+        edits: [
+          { pos: 4, end: 7, newText: 'baz' },
+          { pos: 0, end: 3, newText: 'qux' },
+        ],
+        expected: 'qux(baz)',
+      },
+      {
+        name: 'should keep insertions at the same position in order',
+        content: 'x',
+        edits: [
+          { pos: 0, end: 0, newText: 'a' },
+          { pos: 0, end: 0, newText: 'b' },
+        ],
+        expected: 'abx',
+      },
+      {
+        name: 'should delete text',
+        content: 'a, b, c',
+        edits: [{ pos: 1, end: 4, newText: '' }],
+        expected: 'a, c',
+      },
+    ];
+
+    testCases.forEach(({ name, content, edits, expected }) => {
+      test(name, () => {
+        expect(applyTextEdits(content, edits)).toBe(expected);
+      });
+    });
+
+    test('should reject overlapping edits', () => {
+      expect(() =>
+        applyTextEdits('abcdef', [
+          { pos: 0, end: 3, newText: 'x' },
+          { pos: 2, end: 4, newText: 'y' },
+        ])
+      ).toThrow('Overlapping edits');
+    });
+  });
+
+  describe('commitFileChanges', () => {
+    const change = () => ({
+      filePath: `${testDir}/a.go`,
+      original: 'package a\n',
+      updated: 'package b\n',
+    });
+
+    test('should write changed files', async () => {
+      const changes = await commitFileChanges([change()]);
+      expect(changes).toHaveLength(1);
+      expect(readFileSync(`${testDir}/a.go`, 'utf-8')).toBe('package b\n');
+    });
+
+    test('should leave files untouched in a dry run', async () => {
+      const changes = await commitFileChanges([change()], true);
+      expect(changes).toHaveLength(1);
+      expect(readFileSync(`${testDir}/a.go`, 'utf-8')).toBe('package a\n');
+    });
+
+    test('should leave every file untouched when one write fails', async () => {
+      const failing = {
+        filePath: `${testDir}/missing/b.go`,
+        original: 'package b\n',
+        updated: 'package c\n',
+      };
+      await expect(commitFileChanges([change(), failing])).rejects.toThrow(
+        /Failed to write file .*b\.go/
+      );
+      expect(readFileSync(`${testDir}/a.go`, 'utf-8')).toBe('package a\n');
+    });
+
+    test('should skip changes that do not modify content', async () => {
+      const unchanged = { ...change(), updated: 'package a\n' };
+      expect(await commitFileChanges([unchanged], true)).toEqual([]);
+    });
+
+    test('should write nothing once the task is cancelled', async () => {
+      const controller = new AbortController();
+      controller.abort();
+      await expect(
+        commitFileChanges([change()], false, { signal: controller.signal })
+      ).rejects.toThrow('The request was cancelled');
+      expect(readFileSync(`${testDir}/a.go`, 'utf-8')).toBe('package a\n');
+    });
+
+    test('should format Go files as asked before writing', async () => {
+      const updated = 'package b\n\nfunc f() {\n\n\tprintln()\n}\n';
+      const write = (format: 'gofmt' | 'gofumpt' | 'none') =>
+        commitFileChanges([{ ...change(), updated }], true, { format });
+      expect((await write('gofumpt'))[0].updated).toBe(
+        'package b\n\nfunc f() {\n\tprintln()\n}\n'
+      );
+      expect((await write('gofmt'))[0].updated).toBe(updated);
+      expect((await write('none'))[0].updated).toBe(updated);
+    });
+
+    test('should format diffs with a file count', () => {
+      const output = formatDryRunDiff([change()]);
+      expect(output).toBe(
+        `--- a/${testDir}/a.go\n+++ b/${testDir}/a.go\n@@ -1 +1 @@\n-package a\n+package b\n` +
+          '\nDry run: 1 file would be changed'
+      );
+      expect(formatDryRunDiff([])).toBe('Dry run: no files would be changed');
+    });
+  });
+});
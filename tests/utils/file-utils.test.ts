@@ -1,9 +1,19 @@
 import { describe, test, expect, beforeEach, afterEach } from 'vitest';
-import { writeFileSync, existsSync, rmSync, mkdirSync, readFileSync } from 'fs';
+import {
+  writeFileSync,
+  existsSync,
+  rmSync,
+  mkdirSync,
+  readFileSync,
+  readdirSync,
+  chmodSync,
+  statSync,
+} from 'fs';
 import {
   searchFiles,
   readFileContent,
   writeFileContent,
+  writeFilesAtomically,
 } from '../../src/utils/file-utils.js';
 
 describe('File Utils', () => {
@@ -353,6 +363,55 @@ describe('File Utils', () => {
     );
   });
 
+  describe('writeFilesAtomically', () => {
+    test('should write every file', () => {
+      writeFilesAtomically([
+        { filePath: `${testDir}/file1.js`, content: 'one' },
+        { filePath: `${testDir}/new.js`, content: 'two' },
+      ]);
+      expect(readFileSync(`${testDir}/file1.js`, 'utf-8')).toBe('one');
+      expect(readFileSync(`${testDir}/new.js`, 'utf-8')).toBe('two');
+      expect(readdirSync(testDir).some(f => f.endsWith('.tmp'))).toBe(false);
+    });
+
+    test('should keep the permissions of replaced files', () => {
+      chmodSync(`${testDir}/file1.js`, 0o755);
+      writeFilesAtomically([{ filePath: `${testDir}/file1.js`, content: 'x' }]);
+      expect(statSync(`${testDir}/file1.js`).mode & 0o777).toBe(0o755);
+    });
+
+    const errorCases = [
+      {
+        name: 'should change nothing when a file cannot be staged',
+        failing: `${testDir}/missing/file.js`,
+        error: /Failed to write file .*missing\/file\.js.*No files were changed/,
+      },
+      {
+        name: 'should roll back replaced files when a later one fails',
+        // A directory cannot be replaced by a file.
+        failing: `${testDir}/nested`,
+        error: /Failed to write file .*nested.*All changes were rolled back/,
+      },
+    ];
+
+    errorCases.forEach(({ name, failing, error }) => {
+      test(name, () => {
+        expect(() =>
+          writeFilesAtomically([
+            { filePath: `${testDir}/file1.js`, content: 'changed' },
+            { filePath: `${testDir}/new.js`, content: 'created' },
+            { filePath: failing, content: 'failing' },
+          ])
+        ).toThrow(error);
+        expect(readFileSync(`${testDir}/file1.js`, 'utf-8')).toBe(
+          'console.log("file1");'
+        );
+        expect(existsSync(`${testDir}/new.js`)).toBe(false);
+        expect(readdirSync(testDir).some(f => f.endsWith('.tmp'))).toBe(false);
+      });
+    });
+  });
+
   describe('integration', () => {
     const testCases = [
       {
@@ -0,0 +1,110 @@
+import { describe, test, expect } from 'vitest';
+import {
+  buildContext,
+  excludingConstraint,
+} from '../../src/utils/go-build.js';
+
+describe('Go Build', () => {
+  describe('buildContext', () => {
+    test('should collect the tags of build flags', () => {
+      const context = buildContext({
+        buildFlags: ['-tags integration,e2e', '--tags=slow'],
+        goos: 'linux',
+        goarch: 'arm64',
+      });
+      expect(context.goos).toBe('linux');
+      expect(context.goarch).toBe('arm64');
+      expect(context.tags).toEqual(['e2e', 'integration', 'slow']);
+    });
+
+    const errorCases = [
+      {
+        name: 'should reject flags other than -tags',
+        options: { buildFlags: ['-race'] },
+        error: "Unsupported build flag '-race'; only -tags is supported",
+      },
+      {
+        name: 'should reject -tags without a value',
+        options: { buildFlags: ['-tags'] },
+        error: 'Missing value for -tags',
+      },
+      {
+        name: 'should reject unknown operating systems',
+        options: { goos: 'linx' },
+        error: "Unknown GOOS 'linx'",
+      },
+    ];
+
+    errorCases.forEach(({ name, options, error }) => {
+      test(name, () => {
+        expect(() => buildContext(options)).toThrow(error);
+      });
+    });
+  });
+
+  describe('excludingConstraint', () => {
+    const context = {
+      goos: 'linux',
+      goarch: 'amd64',
+      tags: ['integration'],
+      cgo: false,
+    };
+
+    const testCases = [
+      {
+        name: 'should include files without constraints',
+        file: 'a.go',
+        src: 'package a\n',
+        expected: undefined,
+      },
+      {
+        name: 'should evaluate //go:build expressions',
+        file: 'a.go',
+        src: '//go:build (linux || darwin) && !integration\n\npackage a\n',
+        expected: '//go:build (linux || darwin) && !integration',
+      },
+      {
+        name: 'should include files whose tags are set',
+        file: 'a.go',
+        src: '// Copyright\n\n//go:build unix && integration\n\npackage a\n',
+        expected: undefined,
+      },
+      {
+        name: 'should evaluate // +build lines',
+        file: 'a.go',
+        src: '// +build windows,amd64 plan9\n\npackage a\n',
+        expected: '// +build windows,amd64 plan9',
+      },
+      {
+        name: 'should exclude files for other operating systems',
+        file: 'dir/open_windows_test.go',
+        src: 'package a\n',
+        expected: 'file name suffix _windows',
+      },
+      {
+        name: 'should match operating system and architecture suffixes',
+        file: 'open_linux_arm64.go',
+        src: 'package a\n',
+        expected: 'file name suffix _linux_arm64',
+      },
+      {
+        name: 'should not treat the first word as a suffix',
+        file: 'windows.go',
+        src: 'package a\n',
+        expected: undefined,
+      },
+      {
+        name: 'should ignore constraints after the package clause',
+        file: 'a.go',
+        src: 'package a\n\n//go:build ignore\n',
+        expected: undefined,
+      },
+    ];
+
+    testCases.forEach(({ name, file, src, expected }) => {
+      test(name, () => {
+        expect(excludingConstraint(context, file, src)).toBe(expected);
+      });
+    });
+  });
+});
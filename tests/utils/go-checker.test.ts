@@ -0,0 +1,207 @@
+import { describe, test, expect, beforeEach, afterEach } from 'vitest';
+import { writeFileSync, existsSync, rmSync, mkdirSync } from 'fs';
+import { GoProgram, findGoModule } from '../../src/utils/go-loader.js';
+import { typeString } from '../../src/utils/go-types.js';
+import type { GoObject } from '../../src/utils/go-types.js';
+
+describe('Go Checker', () => {
+  const testDir = 'tests/temp-go-checker';
+
+  beforeEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+    mkdirSync(`${testDir}/shapes`, { recursive: true });
+    mkdirSync(`${testDir}/testdata`, { recursive: true });
+
+    writeFileSync(`${testDir}/go.mod`, 'module example.com/app\n\ngo 1.22\n');
+    writeFileSync(
+      `${testDir}/shapes/shapes.go`,
+      `package shapes
+
+type Shape interface {
+	Area() float64
+}
+
+type Rect struct {
+	W, H float64
+}
+
+func (r Rect) Area() float64 { return r.W * r.H }
+
+const (
+	Small = iota
+	Medium
+	Large
+)
+
+func Map[T, U any](xs []T, f func(T) U) []U {
+	out := make([]U, 0, len(xs))
+	for _, x := range xs {
+		out = append(out, f(x))
+	}
+	return out
+}
+`
+    );
+    writeFileSync(
+      `${testDir}/main.go`,
+      `package main
+
+import (
+	"fmt"
+
+	"example.com/app/shapes"
+)
+
+func main() {
+	r := shapes.Rect{W: 2, H: 3}
+	var s shapes.Shape = r
+	area := s.Area()
+	sizes := shapes.Map([]shapes.Rect{r}, func(r shapes.Rect) string { return fmt.Sprint(r.W) })
+	m := map[string][]int{}
+	v, ok := m["a"]
+	fmt.Println(area, sizes, v, ok, shapes.Large)
+}
+`
+    );
+    writeFileSync(`${testDir}/testdata/ignored.go`, 'package ignored\n');
+  });
+
+  afterEach(() => {
+    if (existsSync(testDir)) {
+      rmSync(testDir, { recursive: true, force: true });
+    }
+  });
+
+  function defsByName(program: GoProgram): Map<string, GoObject> {
+    const info = program.check().info;
+    const defs = new Map<string, GoObject>();
+    for (const [ident, obj] of info.defs) {
+      if (!defs.has(ident.name)) defs.set(ident.name, obj);
+    }
+    return defs;
+  }
+
+  test('should find the enclosing module', () => {
+    const module = findGoModule(`${testDir}/shapes`);
+    expect(module?.path).toBe('example.com/app');
+  });
+
+  test('should load packages and skip testdata', () => {
+    const program = GoProgram.forPath(testDir);
+    expect(program.packages.map(p => p.importPath).sort()).toEqual([
+      'example.com/app',
+      'example.com/app/shapes',
+    ]);
+    expect(program.errors).toEqual([]);
+  });
+
+  describe('workspaces', () => {
+    beforeEach(() => {
+      mkdirSync(`${testDir}/lib`, { recursive: true });
+      writeFileSync(`${testDir}/lib/go.mod`, 'module example.com/lib\n');
+      writeFileSync(`${testDir}/lib/lib.go`, 'package lib\n\nvar N = 1\n');
+      writeFileSync(
+        `${testDir}/go.work`,
+        'go 1.22\n\nuse (\n\t.\n\t./lib // shared code\n)\n'
+      );
+    });
+
+    afterEach(() => {
+      delete process.env.GOWORK;
+    });
+
+    test('should load every module that go.work uses', () => {
+      const program = GoProgram.forPath(`${testDir}/lib`);
+      expect(program.modules.map(m => m.path)).toEqual([
+        'example.com/app',
+        'example.com/lib',
+      ]);
+      expect(program.packages.map(p => p.importPath).sort()).toEqual([
+        'example.com/app',
+        'example.com/app/shapes',
+        'example.com/lib',
+      ]);
+      expect(GoProgram.forPath(testDir)).toBe(program);
+    });
+
+    test('should ignore go.work when GOWORK is off', () => {
+      process.env.GOWORK = 'off';
+      const program = GoProgram.forPath(testDir);
+      expect(program.packages.map(p => p.importPath).sort()).toEqual([
+        'example.com/app',
+        'example.com/app/shapes',
+      ]);
+    });
+
+    test('should ignore a go.work that does not use the module', () => {
+      writeFileSync(`${testDir}/go.work`, 'go 1.22\n\nuse ./lib\n');
+      const program = GoProgram.forPath(testDir);
+      expect(program.modules.map(m => m.path)).toEqual(['example.com/app']);
+    });
+  });
+
+  const typeCases = [
+    { name: 'r', expected: 'shapes.Rect' },
+    { name: 'area', expected: 'float64' },
+    { name: 'sizes', expected: '[]string' },
+    { name: 'v', expected: '[]int' },
+    { name: 'ok', expected: 'bool' },
+    { name: 'Medium', expected: 'untyped int' },
+  ];
+
+  typeCases.forEach(({ name, expected }) => {
+    test(`should infer the type of ${name}`, () => {
+      const program = GoProgram.forPath(testDir);
+      const obj = defsByName(program).get(name);
+      expect(obj).toBeDefined();
+      expect(typeString(obj!.type!)).toBe(expected);
+    });
+  });
+
+  test('should infer type arguments from constraints', () => {
+    writeFileSync(
+      `${testDir}/infer.go`,
+      `package main
+
+import "example.com/app/shapes"
+
+func Keys[M ~map[K]V, K comparable, V any](m M) []K { return nil }
+
+func Zero[T any, PT interface{ *T }]() PT { return nil }
+
+func Area[S shapes.Shape](s S) S { return s }
+
+var (
+	keys  = Keys(map[shapes.Rect]int{})
+	zero  = Zero[shapes.Rect]()
+	area2 = Area(shapes.Rect{}).Area()
+)
+`
+    );
+    const defs = defsByName(GoProgram.forPath(testDir));
+    expect(typeString(defs.get('keys')!.type!)).toBe('[]shapes.Rect');
+    expect(typeString(defs.get('zero')!.type!)).toBe('*shapes.Rect');
+    expect(typeString(defs.get('area2')!.type!)).toBe('float64');
+  });
+
+  test('should evaluate constants with iota', () => {
+    const program = GoProgram.forPath(testDir);
+    const checker = program.check();
+    const large = defsByName(program).get('Large')!;
+    expect(checker.objectConstValue(large)).toBe(2n);
+  });
+
+  test('should attach methods to their receiver type', () => {
+    const program = GoProgram.forPath(testDir);
+    const rect = defsByName(program).get('Rect')!;
+    expect(rect.methods?.map(m => m.name)).toEqual(['Area']);
+  });
+
+  test('should leave only external members unresolved', () => {
+    const program = GoProgram.forPath(testDir);
+    const unresolved = program.check().info.unresolved;
+    expect(unresolved.map(u => u.ident.name)).toEqual(['Sprint', 'Println']);
+  });
+});
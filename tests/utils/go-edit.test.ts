@@ -0,0 +1,228 @@
+import { describe, test, expect } from 'vitest';
+import { parseGoFile } from '../../src/utils/go-parser.js';
+import { applyTextEdits } from '../../src/utils/edit-utils.js';
+import {
+  addImportEdits,
+  alignCells,
+  checkIdentifier,
+  declRemovalEdit,
+  fileQualifier,
+  pruneImports,
+  reindent,
+} from '../../src/utils/go-edit.js';
+import { GoInfo } from '../../src/utils/go-checker.js';
+import { computeLineStarts } from '../../src/utils/line-utils.js';
+import type { GoPackage, GoSourceFile } from '../../src/utils/go-types.js';
+
+function sourceFile(src: string): GoSourceFile {
+  const pkg: GoPackage = {
+    importPath: 'example.com/app',
+    name: 'app',
+    dir: '/app',
+    files: [],
+    isXTest: false,
+  };
+  const file: GoSourceFile = {
+    filePath: '/app/app.go',
+    src,
+    ast: parseGoFile('app.go', src),
+    lineStarts: computeLineStarts(src),
+    pkg,
+  };
+  pkg.files.push(file);
+  return file;
+}
+
+describe('Go Edit Helpers', () => {
+  describe('addImportEdits', () => {
+    const testCases = [
+      {
+        name: 'should add an import declaration after the package clause',
+        src: 'package app\n\nfunc f() {}\n',
+        imports: [{ path: 'fmt', name: 'fmt' }],
+        expected: 'package app\n\nimport "fmt"\n\nfunc f() {}\n',
+      },
+      {
+        name: 'should group a single import with the new one',
+        src: 'package app\n\nimport "os"\n',
+        imports: [{ path: 'fmt', name: 'fmt' }],
+        expected: 'package app\n\nimport (\n\t"fmt"\n\t"os"\n)\n',
+      },
+      {
+        name: 'should insert into the matching group in sorted order',
+        src: 'package app\n\nimport (\n\t"fmt"\n\t"os"\n\n\t"example.com/app/b"\n)\n',
+        imports: [
+          { path: 'example.com/app/a', name: 'a' },
+          { path: 'io', name: 'io' },
+        ],
+        expected:
+          'package app\n\nimport (\n\t"fmt"\n\t"io"\n\t"os"\n\n\t"example.com/app/a"\n\t"example.com/app/b"\n)\n',
+      },
+      {
+        name: 'should start a new group for module imports',
+        src: 'package app\n\nimport (\n\t"fmt"\n)\n',
+        imports: [{ path: 'example.com/lib/v2', name: 'lib' }],
+        expected:
+          'package app\n\nimport (\n\t"fmt"\n\n\t"example.com/lib/v2"\n)\n',
+      },
+      {
+        name: 'should name imports whose package name differs from the path',
+        src: 'package app\n\nimport (\n\t"fmt"\n)\n',
+        imports: [{ path: 'example.com/go-kit', name: 'gokit' }],
+        expected:
+          'package app\n\nimport (\n\t"fmt"\n\n\tgokit "example.com/go-kit"\n)\n',
+      },
+      {
+        name: 'should skip imports that already exist',
+        src: 'package app\n\nimport "fmt"\n',
+        imports: [{ path: 'fmt', name: 'fmt' }],
+        expected: 'package app\n\nimport "fmt"\n',
+      },
+    ];
+
+    testCases.forEach(({ name, src, imports, expected }) => {
+      test(name, () => {
+        const file = sourceFile(src);
+        expect(applyTextEdits(src, addImportEdits(file, imports))).toBe(
+          expected
+        );
+      });
+    });
+  });
+
+  describe('declRemovalEdit', () => {
+    test('should remove the declaration with its doc comment', () => {
+      const src =
+        'package app\n\nfunc a() {}\n\n// b does nothing.\nfunc b() {}\n\nfunc c() {}\n';
+      const file = sourceFile(src);
+      const edit = declRemovalEdit(src, file.ast.decls[1]);
+      expect(applyTextEdits(src, [edit])).toBe(
+        'package app\n\nfunc a() {}\n\nfunc c() {}\n'
+      );
+    });
+
+    test('should take the preceding blank line at the end of the file', () => {
+      const src = 'package app\n\nfunc a() {}\n\nfunc b() {}\n';
+      const file = sourceFile(src);
+      const edit = declRemovalEdit(src, file.ast.decls[1]);
+      expect(applyTextEdits(src, [edit])).toBe('package app\n\nfunc a() {}\n');
+    });
+  });
+
+  describe('pruneImports', () => {
+    const testCases = [
+      {
+        name: 'should remove imports that are no longer used',
+        src: 'package app\n\nimport (\n\t"fmt"\n\t"os"\n)\n\nfunc f() { fmt.Println(os.Args) }\n',
+        updated:
+          'package app\n\nimport (\n\t"fmt"\n\t"os"\n)\n\nfunc f() { fmt.Println() }\n',
+        expected:
+          'package app\n\nimport (\n\t"fmt"\n)\n\nfunc f() { fmt.Println() }\n',
+      },
+      {
+        name: 'should remove a whole import declaration',
+        src: 'package app\n\nimport "os"\n\nvar x = os.Args\n',
+        updated: 'package app\n\nimport "os"\n\nvar x []string\n',
+        expected: 'package app\n\nvar x []string\n',
+      },
+      {
+        name: 'should remove the blank line of a group that becomes empty',
+        src: 'package app\n\nimport (\n\t"fmt"\n\n\t"example.com/lib"\n)\n\nvar x = fmt.Sprint(lib.X)\n',
+        updated:
+          'package app\n\nimport (\n\t"fmt"\n\n\t"example.com/lib"\n)\n\nvar x = fmt.Sprint()\n',
+        expected:
+          'package app\n\nimport (\n\t"fmt"\n)\n\nvar x = fmt.Sprint()\n',
+      },
+      {
+        name: 'should keep imports that were unused before',
+        src: 'package app\n\nimport _ "embed"\n',
+        updated: 'package app\n\nimport _ "embed"\n\nvar x int\n',
+        expected: 'package app\n\nimport _ "embed"\n\nvar x int\n',
+      },
+    ];
+
+    testCases.forEach(({ name, src, updated, expected }) => {
+      test(name, () => {
+        expect(pruneImports(sourceFile(src), new GoInfo(), updated)).toBe(
+          expected
+        );
+      });
+    });
+  });
+
+  describe('fileQualifier', () => {
+    test('should use import names and collect missing imports', () => {
+      const file = sourceFile(
+        'package app\n\nimport (\n\tstr "strings"\n\t. "math"\n)\n'
+      );
+      const missing: { path: string; name: string }[] = [];
+      const q = fileQualifier(file, missing);
+      expect(q({ path: 'strings', name: 'strings' })).toBe('str');
+      expect(q({ path: 'math', name: 'math' })).toBe('');
+      expect(q({ path: 'example.com/app', name: 'app' })).toBe('');
+      expect(q({ path: 'os', name: 'os' })).toBe('os');
+      expect(missing).toEqual([{ path: 'os', name: 'os' }]);
+    });
+  });
+
+  describe('reindent', () => {
+    test('should move lines to a new indentation level', () => {
+      const src = 'package app\n\nfunc f() {\n\t\tif x {\n\t\t\ty()\n\t\t}\n\n}\n';
+      const file = sourceFile(src);
+      const pos = src.indexOf('\t\tif');
+      const end = src.lastIndexOf('}');
+      expect(reindent(file, pos, end, '\t\t', '\t')).toBe(
+        '\tif x {\n\t\ty()\n\t}\n\n'
+      );
+    });
+
+    test('should leave raw string continuation lines alone', () => {
+      const src = 'package app\n\nfunc f() {\n\t\ts := `a\n\t\tb`\n}\n';
+      const file = sourceFile(src);
+      const pos = src.indexOf('\t\ts');
+      const end = src.lastIndexOf('}');
+      expect(reindent(file, pos, end, '\t\t', '\t')).toBe('\ts := `a\n\t\tb`\n');
+    });
+
+    test('should apply edits on the way', () => {
+      const src = 'package app\n\nfunc f() {\n\t\tx++\n}\n';
+      const file = sourceFile(src);
+      const pos = src.indexOf('\t\tx');
+      const x = src.indexOf('x++');
+      expect(
+        reindent(file, pos, pos + 6, '\t\t', '', [
+          { pos: x, end: x + 1, newText: 'y' },
+        ])
+      ).toBe('y++\n');
+    });
+  });
+
+  describe('alignCells', () => {
+    test('should align columns among the lines that continue them', () => {
+      expect(
+        alignCells([
+          ['ID', 'int', '`json:"id"`'],
+          ['Name', 'string'],
+          ['Größe', 'float64', '`json:"g"`', '// size'],
+        ])
+      ).toEqual([
+        'ID    int `json:"id"`',
+        'Name  string',
+        'Größe float64 `json:"g"` // size',
+      ]);
+    });
+  });
+
+  describe('checkIdentifier', () => {
+    const invalid = ['func', '1x', 'a-b', '_'];
+    invalid.forEach(name => {
+      test(`should reject ${name}`, () => {
+        expect(() => checkIdentifier(name)).toThrow();
+      });
+    });
+
+    test('should accept Unicode identifiers', () => {
+      expect(() => checkIdentifier('größe')).not.toThrow();
+    });
+  });
+});
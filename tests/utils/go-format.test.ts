@@ -0,0 +1,171 @@
+import { describe, test, expect, afterEach } from 'vitest';
+import { existsSync, mkdirSync, rmSync, writeFileSync } from 'fs';
+import {
+  defaultGoFormat,
+  formatGoSource,
+} from '../../src/utils/go-format.js';
+
+describe('Go Format', () => {
+  describe('formatGoSource', () => {
+    const gofmtCases = [
+      {
+        name: 'should remove trailing whitespace',
+        src: 'package app \n\nfunc f() {} \t\n',
+        expected: 'package app\n\nfunc f() {}\n',
+      },
+      {
+        name: 'should collapse runs of empty lines',
+        src: 'package app\n\n\n\nfunc f() {}\n\n \n\nfunc g() {}\n',
+        expected: 'package app\n\nfunc f() {}\n\nfunc g() {}\n',
+      },
+      {
+        name: 'should remove empty lines at the start and end of the file',
+        src: '\n\npackage app\n\nfunc f() {}\n\n\n',
+        expected: 'package app\n\nfunc f() {}\n',
+      },
+      {
+        name: 'should keep raw strings and comments as they are',
+        src: 'package app\n\n/* a  \n\n\n b */\nvar s = `x  \n\n\ny`\n',
+        expected: 'package app\n\n/* a  \n\n\n b */\nvar s = `x  \n\n\ny`\n',
+      },
+    ];
+
+    gofmtCases.forEach(({ name, src, expected }) => {
+      test(name, () => {
+        expect(formatGoSource('app.go', src, 'gofmt')).toBe(expected);
+      });
+    });
+
+    const gofumptCases = [
+      {
+        name: 'should remove empty lines around function bodies',
+        src: 'package app\n\nfunc f() {\n\n\tprintln()\n\n\tprintln()\n\n}\n',
+        expected: 'package app\n\nfunc f() {\n\tprintln()\n\n\tprintln()\n}\n',
+      },
+      {
+        name: 'should remove empty lines around a lone statement',
+        src: 'package app\n\nfunc f(b bool) {\n\tif b {\n\n\t\tprintln()\n\n\t}\n}\n',
+        expected:
+          'package app\n\nfunc f(b bool) {\n\tif b {\n\t\tprintln()\n\t}\n}\n',
+      },
+      {
+        name: 'should keep empty lines between several statements',
+        src: 'package app\n\nfunc f(b bool) {\n\tif b {\n\n\t\tprintln()\n\t\tprintln()\n\t}\n}\n',
+        expected:
+          'package app\n\nfunc f(b bool) {\n\tif b {\n\n\t\tprintln()\n\t\tprintln()\n\t}\n}\n',
+      },
+      {
+        name: 'should remove empty lines inside literals and field lists',
+        src: 'package app\n\ntype T struct {\n\n\tA int\n}\n\nvar xs = []int{\n\t1,\n\n}\n',
+        expected:
+          'package app\n\ntype T struct {\n\tA int\n}\n\nvar xs = []int{\n\t1,\n}\n',
+      },
+      {
+        name: 'should write empty struct and interface types on one line',
+        src: 'package app\n\ntype T struct {\n}\n\ntype I interface {\n}\n',
+        expected: 'package app\n\ntype T struct{}\n\ntype I interface{}\n',
+      },
+      {
+        name: 'should remove empty lines before an error check',
+        src: 'package app\n\nfunc f() error {\n\terr := g()\n\n\tif err != nil {\n\t\treturn err\n\t}\n\treturn nil\n}\n',
+        expected:
+          'package app\n\nfunc f() error {\n\terr := g()\n\tif err != nil {\n\t\treturn err\n\t}\n\treturn nil\n}\n',
+      },
+      {
+        name: 'should ungroup single var declarations',
+        src: 'package app\n\nvar (\n\tx = 1\n)\n',
+        expected: 'package app\n\nvar x = 1\n',
+      },
+      {
+        name: 'should group contiguous var declarations',
+        src: 'package app\n\nvar nicer = "x"\nvar with = "y"\nvar n int = 1\n',
+        expected:
+          'package app\n\nvar (\n\tnicer     = "x"\n\twith      = "y"\n\tn     int = 1\n)\n',
+      },
+      {
+        name: 'should turn simple var statements into short declarations',
+        src: 'package app\n\nfunc f() {\n\tvar a, b = 1, 2\n\tvar c int = 3\n\tvar _ = a\n\t_, _, _ = a, b, c\n}\n',
+        expected:
+          'package app\n\nfunc f() {\n\ta, b := 1, 2\n\tvar c int = 3\n\tvar _ = a\n\t_, _, _ = a, b, c\n}\n',
+      },
+      {
+        name: 'should start comments with a space, except directives',
+        src: 'package app\n\n//go:generate stringer\n//nolint:all\n//comment\n//\nfunc f() {}\n',
+        expected:
+          'package app\n\n//go:generate stringer\n//nolint:all\n// comment\n//\nfunc f() {}\n',
+      },
+      {
+        name: 'should separate multiline top-level declarations',
+        src: 'package app\n\nfunc f() {\n}\nfunc g() {}\n// h does nothing.\nfunc h() {}\n',
+        expected:
+          'package app\n\nfunc f() {\n}\n\nfunc g() {}\n// h does nothing.\nfunc h() {}\n',
+      },
+    ];
+
+    gofumptCases.forEach(({ name, src, expected }) => {
+      test(name, () => {
+        expect(formatGoSource('app.go', src, 'gofumpt')).toBe(expected);
+      });
+    });
+
+    describe('octal literals', () => {
+      const testDir = 'tests/temp-go-format';
+
+      afterEach(() => {
+        if (existsSync(testDir)) {
+          rmSync(testDir, { recursive: true, force: true });
+        }
+      });
+
+      const format = (goVersion: string) => {
+        mkdirSync(testDir, { recursive: true });
+        writeFileSync(
+          `${testDir}/go.mod`,
+          `module example.com/app\n\ngo ${goVersion}\n`
+        );
+        const src = 'package app\n\nconst mode = 0755\n';
+        return formatGoSource(`${testDir}/app.go`, src, 'gofumpt');
+      };
+
+      test('should use the 0o prefix from go 1.13 on', () => {
+        expect(format('1.22')).toBe('package app\n\nconst mode = 0o755\n');
+      });
+
+      test('should keep the old form before go 1.13', () => {
+        expect(format('1.12')).toBe('package app\n\nconst mode = 0755\n');
+      });
+    });
+
+    test('should leave files alone with none', () => {
+      const src = 'package app\n\n\n\nvar (\n\tx = 1\n)  \n';
+      expect(formatGoSource('app.go', src, 'none')).toBe(src);
+    });
+
+    test('should leave files that do not parse alone', () => {
+      const src = 'package app\n\n\n\nfunc f( {\n';
+      expect(formatGoSource('app.go', src, 'gofumpt')).toBe(src);
+    });
+  });
+
+  describe('defaultGoFormat', () => {
+    afterEach(() => {
+      delete process.env.REFACTOR_MCP_FORMAT;
+    });
+
+    test('should default to gofmt', () => {
+      expect(defaultGoFormat()).toBe('gofmt');
+    });
+
+    test('should read REFACTOR_MCP_FORMAT', () => {
+      process.env.REFACTOR_MCP_FORMAT = 'gofumpt';
+      expect(defaultGoFormat()).toBe('gofumpt');
+    });
+
+    test('should reject unknown formats', () => {
+      process.env.REFACTOR_MCP_FORMAT = 'prettier';
+      expect(() => defaultGoFormat()).toThrow(
+        "REFACTOR_MCP_FORMAT is 'prettier'; use one of gofmt, gofumpt, none"
+      );
+    });
+  });
+});
@@ -0,0 +1,154 @@
+import { describe, test, expect } from 'vitest';
+import { parseGoExpr, parseGoFile } from '../../src/utils/go-parser.js';
+import { inspect, pathEnclosingInterval } from '../../src/utils/go-ast.js';
+import type { Node } from '../../src/utils/go-ast.js';
+
+function nodeTypes(root: Node): string[] {
+  const types: string[] = [];
+  inspect(root, n => {
+    types.push(n.type);
+  });
+  return types;
+}
+
+describe('Go Parser', () => {
+  describe('parseGoFile', () => {
+    test('should parse package clause, imports and declarations', () => {
+      const src = `// Package p does things.
+package p
+
+import (
+	"fmt"
+	str "strings"
+)
+
+const (
+	A = iota
+	B
+)
+
+type T struct {
+	Name string \`json:"name"\`
+}
+
+func (t *T) String() string { return fmt.Sprint(str.ToUpper(t.Name)) }
+`;
+      const file = parseGoFile('p.go', src);
+      expect(file.name.name).toBe('p');
+      expect(file.doc?.list[0].text).toBe('// Package p does things.');
+      expect(file.imports.map(i => i.path.value)).toEqual([
+        '"fmt"',
+        '"strings"',
+      ]);
+      expect(file.imports[1].name?.name).toBe('str');
+      expect(file.decls.map(d => d.type)).toEqual([
+        'GenDecl',
+        'GenDecl',
+        'GenDecl',
+        'FuncDecl',
+      ]);
+
+      const consts = file.decls[1];
+      expect(consts.type === 'GenDecl' && consts.specs.length).toBe(2);
+
+      const method = file.decls[3];
+      expect(method.type).toBe('FuncDecl');
+      if (method.type === 'FuncDecl') {
+        expect(method.name.name).toBe('String');
+        expect(method.recv?.list[0].names[0].name).toBe('t');
+        expect(src.substring(method.pos, method.end)).toMatch(
+          /^func \(t \*T\) String\(\).*\}$/
+        );
+      }
+    });
+
+    test('should not treat a block after a control clause as a composite literal', () => {
+      const file = parseGoFile(
+        'p.go',
+        'package p\n\nfunc f(m map[string]bool, k string) {\n\tif m[k] {\n\t}\n\tfor x := range m {\n\t\t_ = x\n\t}\n}\n'
+      );
+      const types = nodeTypes(file);
+      expect(types).toContain('IfStmt');
+      expect(types).toContain('RangeStmt');
+      expect(types).not.toContain('CompositeLit');
+    });
+
+    test('should parse generic declarations', () => {
+      const file = parseGoFile(
+        'p.go',
+        'package p\n\ntype List[T any] struct{ items []T }\n\nfunc Map[T, U any](xs []T, f func(T) U) []U { return nil }\n\ntype Bytes interface{ ~[]byte | string }\n'
+      );
+      const list = file.decls[0];
+      expect(list.type === 'GenDecl' && list.specs[0].type).toBe('TypeSpec');
+      if (list.type === 'GenDecl' && list.specs[0].type === 'TypeSpec') {
+        expect(list.specs[0].typeParams?.list[0].names[0].name).toBe('T');
+      }
+      const fn = file.decls[1];
+      if (fn.type === 'FuncDecl') {
+        expect(
+          fn.funcType.typeParams?.list[0].names.map(n => n.name)
+        ).toEqual(['T', 'U']);
+      }
+    });
+
+    test('should attach doc and line comments to fields', () => {
+      const file = parseGoFile(
+        'p.go',
+        'package p\n\ntype T struct {\n\t// A is a.\n\tA int // trailing\n}\n'
+      );
+      let field: Node | undefined;
+      inspect(file, n => {
+        if (n.type === 'Field') field = n;
+      });
+      expect(field?.type).toBe('Field');
+      if (field?.type === 'Field') {
+        expect(field.doc?.list[0].text).toBe('// A is a.');
+        expect(field.comment?.list[0].text).toBe('// trailing');
+      }
+    });
+
+    test('should report syntax errors with a position', () => {
+      expect(() => parseGoFile('bad.go', 'package p\n\nfunc f( {\n}\n')).toThrow(
+        /^bad\.go:3:\d+: /
+      );
+    });
+  });
+
+  describe('parseGoExpr', () => {
+    const testCases = [
+      { name: 'should respect precedence', src: 'a + b*c', expected: 'BinaryExpr' },
+      { name: 'should parse calls', src: 'f(x, y...)', expected: 'CallExpr' },
+      { name: 'should parse composite literals', src: 'T{A: 1}', expected: 'CompositeLit' },
+      { name: 'should parse function literals', src: 'func() {}', expected: 'FuncLit' },
+      { name: 'should parse type assertions', src: 'x.(T)', expected: 'TypeAssertExpr' },
+    ];
+
+    testCases.forEach(({ name, src, expected }) => {
+      test(name, () => {
+        expect(parseGoExpr(src).type).toBe(expected);
+      });
+    });
+
+    test('should build a right-leaning tree for higher precedence', () => {
+      const expr = parseGoExpr('a + b*c');
+      expect(expr.type === 'BinaryExpr' && expr.op).toBe('+');
+      expect(expr.type === 'BinaryExpr' && expr.y.type).toBe('BinaryExpr');
+    });
+  });
+
+  describe('pathEnclosingInterval', () => {
+    test('should return the chain of enclosing nodes', () => {
+      const src = 'package p\n\nfunc f() { g(1) }\n';
+      const file = parseGoFile('p.go', src);
+      const path = pathEnclosingInterval(file, src.indexOf('1'));
+      expect(path.map(n => n.type)).toEqual([
+        'File',
+        'FuncDecl',
+        'BlockStmt',
+        'ExprStmt',
+        'CallExpr',
+        'BasicLit',
+      ]);
+    });
+  });
+});
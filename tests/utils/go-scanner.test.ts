@@ -0,0 +1,107 @@
+import { describe, test, expect } from 'vitest';
+import {
+  isGoIdentifier,
+  scanGo,
+  unquoteGoString,
+} from '../../src/utils/go-scanner.js';
+
+describe('Go Scanner', () => {
+  describe('scanGo', () => {
+    const testCases = [
+      {
+        name: 'should scan identifiers, keywords and operators',
+        src: 'x := a &^ b',
+        expected: ['IDENT', ':=', 'IDENT', '&^', 'IDENT', ';', 'EOF'],
+      },
+      {
+        name: 'should insert semicolons at line ends after operands',
+        src: 'return x\n}\n',
+        expected: ['return', 'IDENT', ';', '}', ';', 'EOF'],
+      },
+      {
+        name: 'should not insert semicolons after operators',
+        src: 'a +\nb',
+        expected: ['IDENT', '+', 'IDENT', ';', 'EOF'],
+      },
+      {
+        name: 'should insert a semicolon before a trailing line comment',
+        src: 'x++ // inc\ny',
+        expected: ['IDENT', '++', ';', 'IDENT', ';', 'EOF'],
+      },
+      {
+        name: 'should scan number literals',
+        src: '0x1F 1_000 1.5e3 .5 0b101 0o17 2i',
+        expected: [
+          'INT',
+          'INT',
+          'FLOAT',
+          'FLOAT',
+          'INT',
+          'INT',
+          'IMAG',
+          ';',
+          'EOF',
+        ],
+      },
+      {
+        name: 'should scan string and rune literals',
+        src: '"a\\"b" `raw\nstring` \'\\n\'',
+        expected: ['STRING', 'STRING', 'CHAR', ';', 'EOF'],
+      },
+    ];
+
+    testCases.forEach(({ name, src, expected }) => {
+      test(name, () => {
+        const { tokens } = scanGo(src);
+        expect(tokens.map(t => t.tok)).toEqual(expected);
+      });
+    });
+
+    test('should collect comments with their positions', () => {
+      const src = 'a /* b */ // c\n';
+      const { comments } = scanGo(src);
+      expect(comments).toEqual([
+        { text: '/* b */', pos: 2, end: 9 },
+        { text: '// c', pos: 10, end: 14 },
+      ]);
+    });
+
+    test('should report unterminated literals', () => {
+      expect(() => scanGo('"abc')).toThrow('string literal not terminated');
+      expect(() => scanGo('/* abc')).toThrow('comment not terminated');
+    });
+  });
+
+  describe('isGoIdentifier', () => {
+    const testCases = [
+      { name: 'should accept a simple name', input: 'foo', expected: true },
+      { name: 'should accept unicode letters', input: 'héllo', expected: true },
+      { name: 'should accept underscores', input: '_x1', expected: true },
+      { name: 'should reject keywords', input: 'func', expected: false },
+      { name: 'should reject leading digits', input: '1x', expected: false },
+      { name: 'should reject empty names', input: '', expected: false },
+    ];
+
+    testCases.forEach(({ name, input, expected }) => {
+      test(name, () => {
+        expect(isGoIdentifier(input)).toBe(expected);
+      });
+    });
+  });
+
+  describe('unquoteGoString', () => {
+    const testCases = [
+      { name: 'should decode escapes', input: '"a\\tb\\n"', expected: 'a\tb\n' },
+      { name: 'should keep raw strings', input: '`a\\n`', expected: 'a\\n' },
+      { name: 'should decode unicode', input: '"\\u00e9"', expected: 'é' },
+      { name: 'should decode bytes as UTF-8', input: '"\\xc3\\xa9"', expected: 'é' },
+      { name: 'should decode runes', input: "'\\''", expected: "'" },
+    ];
+
+    testCases.forEach(({ name, input, expected }) => {
+      test(name, () => {
+        expect(unquoteGoString(input)).toBe(expected);
+      });
+    });
+  });
+});
@@ -0,0 +1,91 @@
+import { describe, test, expect } from 'vitest';
+import { z } from 'zod';
+import { jsonSchemaOf, objectSchemaOf } from '../../src/utils/json-schema.js';
+
+describe('JSON Schema', () => {
+  describe('objectSchemaOf', () => {
+    test('should require the properties that are not optional', () => {
+      expect(
+        objectSchemaOf({
+          file_path: z.string().describe('Path to the Go file'),
+          line: z.number().optional().describe('1-based line number'),
+          dry_run: z.boolean().optional(),
+        })
+      ).toEqual({
+        type: 'object',
+        properties: {
+          file_path: { type: 'string', description: 'Path to the Go file' },
+          line: { type: 'number', description: '1-based line number' },
+          dry_run: { type: 'boolean' },
+        },
+        required: ['file_path'],
+      });
+    });
+
+    test('should leave out required when every property is optional', () => {
+      expect(objectSchemaOf({ file_path: z.string().optional() })).toEqual({
+        type: 'object',
+        properties: { file_path: { type: 'string' } },
+      });
+    });
+  });
+
+  describe('jsonSchemaOf', () => {
+    const cases = [
+      {
+        name: 'enums',
+        schema: z.enum(['gofmt', 'gofumpt']),
+        expected: { type: 'string', enum: ['gofmt', 'gofumpt'] },
+      },
+      {
+        name: 'arrays',
+        schema: z.array(z.string()),
+        expected: { type: 'array', items: { type: 'string' } },
+      },
+      {
+        name: 'records',
+        schema: z.record(z.string(), z.string()),
+        expected: { type: 'object', additionalProperties: { type: 'string' } },
+      },
+      {
+        name: 'discriminated unions',
+        schema: z.discriminatedUnion('action', [
+          z.object({ action: z.literal('keep'), index: z.number() }),
+          z.object({ action: z.literal('add'), name: z.string().optional() }),
+        ]),
+        expected: {
+          oneOf: [
+            {
+              type: 'object',
+              properties: {
+                action: { const: 'keep' },
+                index: { type: 'number' },
+              },
+              required: ['action', 'index'],
+            },
+            {
+              type: 'object',
+              properties: {
+                action: { const: 'add' },
+                name: { type: 'string' },
+              },
+              required: ['action'],
+            },
+          ],
+        },
+      },
+    ];
+
+    cases.forEach(({ name, schema, expected }) => {
+      test(`should describe ${name}`, () => {
+        expect(jsonSchemaOf(schema)).toEqual(expected);
+      });
+    });
+
+    test('should reject schemas it does not know', () => {
+      expect(() => jsonSchemaOf(z.date())).toThrow(
+        'No JSON Schema for ZodDate'
+      );
+    });
+  });
+});
@@ -1,5 +1,13 @@
 import { describe, test, expect } from 'vitest';
-import { groupConsecutiveLines } from '../../src/utils/line-utils.js';
+import {
+  byteOffsetToIndex,
+  computeLineStarts,
+  groupConsecutiveLines,
+  indexToByteOffset,
+  indexToPosition,
+  lineTextAt,
+  positionToIndex,
+} from '../../src/utils/line-utils.js';
 
 describe('Line Utils', () => {
   describe('groupConsecutiveLines', () => {
@@ -137,4 +145,67 @@ describe('Line Utils', () => {
       expect(result[1]).toBe('line: 4');
     });
   });
+
+  describe('positions', () => {
+    const content = 'package p\n\nvar s = "héllo" // x\nvar t = 1';
+
+    test('should compute line starts', () => {
+      expect(computeLineStarts(content)).toEqual([0, 10, 11, 32]);
+    });
+
+    const positionCases = [
+      {
+        name: 'should map the first character',
+        index: 0,
+        expected: { line: 1, column: 1 },
+      },
+      {
+        name: 'should map an empty line',
+        index: 10,
+        expected: { line: 2, column: 1 },
+      },
+      {
+        name: 'should count columns in UTF-8 bytes',
+        index: content.indexOf('//'),
+        expected: { line: 3, column: 18 },
+      },
+      {
+        name: 'should map the end of content',
+        index: content.length,
+        expected: { line: 4, column: 10 },
+      },
+    ];
+
+    positionCases.forEach(({ name, index, expected }) => {
+      test(name, () => {
+        expect(indexToPosition(content, index)).toEqual(expected);
+        expect(positionToIndex(content, expected)).toBe(index);
+      });
+    });
+
+    test('should reject out of range positions', () => {
+      expect(() => positionToIndex(content, { line: 5, column: 1 })).toThrow(
+        'Line 5 is out of range'
+      );
+      expect(() => positionToIndex(content, { line: 1, column: 12 })).toThrow(
+        'Column 12 is out of range on line 1'
+      );
+    });
+
+    test('should convert between byte offsets and indices', () => {
+      const index = content.indexOf('//');
+      expect(indexToByteOffset(content, index)).toBe(index + 1);
+      expect(byteOffsetToIndex(content, index + 1)).toBe(index);
+      expect(() => byteOffsetToIndex(content, 1000)).toThrow(
+        'Offset 1000 is out of range'
+      );
+    });
+
+    test('should return the text of the line containing an index', () => {
+      expect(lineTextAt(content, content.indexOf('héllo'))).toBe(
+        'var s = "héllo" // x'
+      );
+      expect(lineTextAt('a\r\nb', 0)).toBe('a');
+    });
+  });
 });
@@ -0,0 +1,65 @@
+import { describe, test, expect } from 'vitest';
+import { ReadWriteLock } from '../../src/utils/lock.js';
+
+describe('Lock', () => {
+  describe('ReadWriteLock', () => {
+    // Returns a task that logs when it starts and ends, and ends when its
+    // finish function is called.
+    const task = (log: string[], name: string) => {
+      let finish = () => {};
+      const done = new Promise<void>(resolve => (finish = resolve));
+      return {
+        run: async () => {
+          log.push(`${name} start`);
+          await done;
+          log.push(`${name} end`);
+          return name;
+        },
+        finish: () => finish(),
+      };
+    };
+    const tick = () => new Promise(resolve => setImmediate(resolve));
+
+    test('should let readers run together', async () => {
+      const lock = new ReadWriteLock();
+      const log: string[] = [];
+      const a = task(log, 'a');
+      const b = task(log, 'b');
+      const results = [lock.read(a.run), lock.read(b.run)];
+      await tick();
+      expect(log).toEqual(['a start', 'b start']);
+      b.finish();
+      a.finish();
+      expect(await Promise.all(results)).toEqual(['a', 'b']);
+    });
+
+    test('should run writers alone and in order', async () => {
+      const lock = new ReadWriteLock();
+      const log: string[] = [];
+      const r1 = task(log, 'r1');
+      const w = task(log, 'w');
+      const r2 = task(log, 'r2');
+      const results = [lock.read(r1.run), lock.write(w.run), lock.read(r2.run)];
+      await tick();
+      expect(log).toEqual(['r1 start']);
+      r1.finish();
+      await tick();
+      expect(log).toEqual(['r1 start', 'r1 end', 'w start']);
+      w.finish();
+      await tick();
+      expect(log.slice(3)).toEqual(['w end', 'r2 start']);
+      r2.finish();
+      await Promise.all(results);
+    });
+
+    test('should release the lock when the holder fails', async () => {
+      const lock = new ReadWriteLock();
+      await expect(
+        lock.write(async () => {
+          throw new Error('failed');
+        })
+      ).rejects.toThrow('failed');
+      expect(await lock.write(async () => 'next')).toBe('next');
+    });
+  });
+});
@@ -0,0 +1,98 @@
+import { describe, test, expect } from 'vitest';
+import {
+  ToolError,
+  describeError,
+  errorResult,
+} from '../../src/utils/tool-error.js';
+
+describe('Tool Error', () => {
+  describe('describeError', () => {
+    const testCases = [
+      {
+        name: 'should keep the code and location of tool errors',
+        error: new ToolError('name_conflict', "'x' is already declared", {
+          filePath: 'a.go',
+          line: 3,
+          column: 2,
+        }),
+        expected: {
+          code: 'name_conflict',
+          message: "'x' is already declared",
+          location: { filePath: 'a.go', line: 3, column: 2 },
+        },
+      },
+      {
+        name: 'should keep the candidates of ambiguous names',
+        error: new ToolError('ambiguous_location', "'Sum' names 2", undefined, [
+          {
+            symbol: 'a.Sum',
+            kind: 'func',
+            filePath: 'a.go',
+            line: 3,
+            column: 6,
+          },
+        ]),
+        expected: {
+          code: 'ambiguous_location',
+          message: "'Sum' names 2",
+          candidates: [
+            {
+              symbol: 'a.Sum',
+              kind: 'func',
+              filePath: 'a.go',
+              line: 3,
+              column: 6,
+            },
+          ],
+        },
+      },
+      {
+        name: 'should report missing files',
+        error: Object.assign(new Error('ENOENT: no such file'), {
+          code: 'ENOENT',
+        }),
+        expected: { code: 'file_not_found', message: 'ENOENT: no such file' },
+      },
+      {
+        name: 'should report invalid patterns as invalid arguments',
+        error: new SyntaxError('Invalid regular expression'),
+        expected: {
+          code: 'invalid_argument',
+          message: 'Invalid regular expression',
+        },
+      },
+      {
+        name: 'should report other errors as internal errors',
+        error: new Error('boom'),
+        expected: { code: 'internal_error', message: 'boom' },
+      },
+    ];
+
+    testCases.forEach(({ name, error, expected }) => {
+      test(name, () => {
+        expect(describeError(error)).toEqual(expected);
+      });
+    });
+  });
+
+  describe('errorResult', () => {
+    test('should return the error as text, JSON and structured content', () => {
+      const result = errorResult(
+        'rename symbol',
+        new ToolError('symbol_not_found', 'No identifier found', {
+          filePath: 'a.go',
+          line: 1,
+          column: 5,
+        })
+      );
+      expect(result.isError).toBe(true);
+      expect(result.content[0].text).toBe(
+        'Error during rename symbol [symbol_not_found]: No identifier found (a.go:1:5)'
+      );
+      expect(JSON.parse(result.content[1].text)).toEqual({
+        error: result.structuredContent.error,
+      });
+      expect(result.structuredContent.error.code).toBe('symbol_not_found');
+    });
+  });
+});